@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit writes the audit trail of the secret sync controller and the secret rotator:
+// one JSON line per sync or rotation event, recording who did what to which secret and when, but never any secret value.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"k8s.io/klog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operation is the operation of an audit record.
+type Operation string
+
+const (
+	// Sync is the write of the destination of a sync spec.
+	Sync Operation = "sync"
+	// Refresh is the provisioning of a new version of a rotated secret.
+	Refresh Operation = "refresh"
+	// Deactivate is the deactivation and the destruction of an old version of a rotated secret.
+	Deactivate Operation = "deactivate"
+)
+
+// Result is the result of an audit record.
+type Result string
+
+const (
+	Succeeded Result = "succeeded"
+	Failed    Result = "failed"
+	// Deferred means that the operation is held for later, e.g. outside the write window of a sync spec.
+	Deferred Result = "deferred"
+)
+
+// Record is an audit record. It deliberately holds no field that could carry a secret value,
+// and its Error must be redacted by the caller, e.g. with redact.Error().
+type Record struct {
+	Time time.Time `json:"time"`
+	// Component and Actor identify who performed the operation, e.g. the secret rotator in the pod named Actor.
+	Component string    `json:"component"`
+	Actor     string    `json:"actor,omitempty"`
+	Operation Operation `json:"operation"`
+	// Spec identifies the sync spec or the rotated secret.
+	Spec   string `json:"spec"`
+	Result Result `json:"result"`
+	// Version is the Secret Manager version synced, created or deactivated, if known.
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Logger writes audit records as JSON lines. A nil Logger discards the records, so that auditing is optional.
+type Logger struct {
+	component string
+	actor     string
+	w         io.Writer
+	closer    io.Closer
+	lock      sync.Mutex
+	// now returns the time of the records, a fake clock in tests.
+	now func() time.Time
+}
+
+// NewLogger returns a Logger writing the records of component and actor to w.
+func NewLogger(w io.Writer, component, actor string) *Logger {
+	return &Logger{
+		component: component,
+		actor:     actor,
+		w:         w,
+		now:       time.Now,
+	}
+}
+
+// Open returns a Logger writing the records of component to sink, either "-" for stdout or the path of a file,
+// to which the records are appended. The actor of the records is the host name, i.e. the pod name in Kubernetes.
+func Open(sink, component string) (*Logger, error) {
+	actor, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("Fail to get host name: %s", err)
+	}
+
+	if sink == "-" {
+		return NewLogger(os.Stdout, component, actor), nil
+	}
+
+	file, err := os.OpenFile(sink, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to open audit log %s: %s", sink, err)
+	}
+	logger := NewLogger(file, component, actor)
+	logger.closer = file
+	return logger, nil
+}
+
+// Log writes record, stamped with the time, the component and the actor of the logger.
+// Failures to write are logged, and never fail the audited operation.
+func (l *Logger) Log(record Record) {
+	if l == nil {
+		return
+	}
+
+	record.Time = l.now().UTC()
+	record.Component = l.component
+	record.Actor = l.actor
+	line, err := json.Marshal(record)
+	if err != nil {
+		klog.Errorf("Fail to marshal audit record of %s %s: %s", record.Operation, record.Spec, err)
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	if err != nil {
+		klog.Errorf("Fail to write audit record of %s %s: %s", record.Operation, record.Spec, err)
+	}
+}
+
+// Close closes the file of the logger, if opened by Open().
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "secret-rotator", "pod-1")
+	logger.now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	logger.Log(Record{Operation: Refresh, Spec: "projects/project-1/secrets/secret-1", Result: Succeeded, Version: "2"})
+	logger.Log(Record{Operation: Deactivate, Spec: "projects/project-1/secrets/secret-1", Result: Failed, Version: "1", Error: "denied"})
+
+	expected := []map[string]interface{}{
+		{
+			"time":      "2020-01-01T00:00:00Z",
+			"component": "secret-rotator",
+			"actor":     "pod-1",
+			"operation": "refresh",
+			"spec":      "projects/project-1/secrets/secret-1",
+			"result":    "succeeded",
+			"version":   "2",
+		},
+		{
+			"time":      "2020-01-01T00:00:00Z",
+			"component": "secret-rotator",
+			"actor":     "pod-1",
+			"operation": "deactivate",
+			"spec":      "projects/project-1/secrets/secret-1",
+			"result":    "failed",
+			"version":   "1",
+			"error":     "denied",
+		},
+	}
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, but got %q.", len(expected), buf.String())
+	}
+	for i, line := range lines {
+		record := map[string]interface{}{}
+		err := json.Unmarshal(line, &record)
+		if err != nil {
+			t.Fatalf("Invalid JSON line %q: %s", line, err)
+		}
+		if !reflect.DeepEqual(record, expected[i]) {
+			t.Errorf("Expected record %v, but got %v.", expected[i], record)
+		}
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	logger.Log(Record{Operation: Sync, Spec: "ns/secret[key]", Result: Succeeded})
+	if err := logger.Close(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	// records are appended across restarts
+	for i := 0; i < 2; i++ {
+		logger, err := Open(path, "secret-sync-controller")
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.Log(Record{Operation: Sync, Spec: fmt.Sprintf("ns/secret[key-%d]", i), Result: Succeeded})
+		err = logger.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Errorf("Expected 2 records, but got %q.", data)
+	}
+}
@@ -22,12 +22,16 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"flag"
 	"fmt"
 	"k8s.io/klog"
+	"os"
 	"path/filepath"
-	"regexp"
+	"sigs.k8s.io/k8s-gsm-tools/exitcode"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
 	rotclient "sigs.k8s.io/k8s-gsm-tools/secret-rotator/client"
+	rotconfig "sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
 	syncclient "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
 	syncconfig "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
@@ -48,6 +52,7 @@ type options struct {
 	pollPeriod     int64
 	duration       int64
 	gsmProject     string
+	exportCSV      bool
 }
 
 func (o *options) Validate() error {
@@ -66,6 +71,7 @@ func gatherOptions() options {
 	flag.Int64Var(&o.resyncPeriod, "resync-period", 1000, "Resync period in milliseconds.")
 	flag.Int64Var(&o.pollPeriod, "poll-period", 500, "Polling period in milliseconds.")
 	flag.Int64Var(&o.duration, "duration", 150000, "Logging duration in milliseconds.")
+	flag.BoolVar(&o.exportCSV, "export-csv", false, "Also export the raw timeline of each spec as CSV under the output path.")
 	flag.Parse()
 	return o
 }
@@ -77,22 +83,22 @@ func main() {
 	o := gatherOptions()
 	err := o.Validate()
 	if err != nil {
-		klog.Errorf("Invalid options: %s", err)
+		exitcode.Fatalf(exitcode.ConfigError, "Invalid options: %s", err)
 	}
 
 	// prepare clients
 	k8sClientset, err := syncclient.NewK8sClientset(o.kubeconfig)
 	if err != nil {
-		klog.Errorf("Fail to create new kubernetes client: %s", err)
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new kubernetes client: %s", err)
 	}
 	secretManagerClient, err := syncclient.NewSecretManagerClient(context.Background())
 	if err != nil {
-		klog.Errorf("Fail to create new Secret Manager client: %s", err)
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new Secret Manager client: %s", err)
 	}
 
 	rotationClient, err := rotclient.NewClient(context.Background())
 	if err != nil {
-		klog.Errorf("Fail to create new rotation client: %s", err)
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new rotation client: %s", err)
 	}
 
 	testClient := &tests.E2eTestClient{
@@ -106,7 +112,7 @@ func main() {
 	syncConfigAgent := &syncconfig.Agent{}
 	syncUpdateFunc, err := syncConfigAgent.WatchConfig(o.syncConfigPath)
 	if err != nil {
-		klog.Fatal(err)
+		exitcode.Fatal(exitcode.ConfigError, err)
 	}
 
 	syncCtx, syncCancel := context.WithCancel(context.Background())
@@ -118,7 +124,8 @@ func main() {
 		RotClient:  rotationClient,
 		Agent:      syncConfigAgent,
 		PollPeriod: time.Duration(o.resyncPeriod) * time.Millisecond,
-		LogData:    map[string]*logData{},
+		LogData:    map[syncconfig.SpecID]*logData{},
+		ExportCSV:  o.exportCSV,
 	}
 
 	// start controller and logger
@@ -136,7 +143,9 @@ type Logger struct {
 	RotClient  *rotclient.Client
 	Agent      *syncconfig.Agent
 	PollPeriod time.Duration
-	LogData    map[string]*logData
+	LogData    map[syncconfig.SpecID]*logData
+	// ExportCSV also writes the raw timeline of each spec as CSV alongside the plots.
+	ExportCSV bool
 }
 
 type logData struct {
@@ -144,68 +153,65 @@ type logData struct {
 	K8sSecretLog []string
 	Time         []float64
 	States       []string
+	// ActiveCounts is the number of active versions at each point of Time.
+	ActiveCounts []int
 }
 
+// Start logs every PollPeriod until stopped. Cycles overrunning PollPeriod are logged, and the ticks missed meanwhile are dropped.
 func (l *Logger) Start(stopChan <-chan struct{}) error {
-	logChan := make(chan struct{})
-
 	startTime := time.Now()
 
 	// controller period for logging
-	go func() {
-		for {
-			logChan <- struct{}{}
-			time.Sleep(l.PollPeriod)
-		}
-	}()
+	ticker := time.NewTicker(l.PollPeriod)
+	defer ticker.Stop()
 
 	for {
-		select {
-		case <-stopChan:
-			klog.V(2).Info("Stop signal received. Quitting syncLogger...")
-			return nil
-		case <-logChan:
-			for _, spec := range l.Agent.Config().Specs {
-
-				d, ok := l.LogData[spec.String()]
-				if !ok {
-					d = &logData{}
-					l.LogData[spec.String()] = d
-				}
+		cycleStart := time.Now()
+		for _, spec := range l.Agent.Config().Specs {
 
-				// get secret values
-				srcData, err := l.SyncClient.GetSecretManagerSecretValue(spec.Source.Project, spec.Source.Secret)
-				if err != nil {
-					klog.Errorf("Secret log failed for %s: %s", spec, err)
-				}
+			d, ok := l.LogData[spec.ID()]
+			if !ok {
+				d = &logData{}
+				l.LogData[spec.ID()] = d
+			}
 
-				destData, err := l.SyncClient.GetKubernetesSecretValue(spec.Destination.Namespace, spec.Destination.Secret, spec.Destination.Key)
-				if err != nil {
-					klog.Errorf("Secret log failed for %s: %s", spec, err)
-				}
+			// get secret values
+			srcData, err := l.SyncClient.GetSecretManagerSecretValue(spec.Source.Project, spec.Source.Secret)
+			if err != nil {
+				klog.Errorf("Secret log failed for %s: %s", spec, err)
+			}
 
-				labels, err := l.RotClient.GetSecretLabels(spec.Source.Project, spec.Source.Secret)
-				if err != nil {
-					return err
-				}
+			destData, err := l.SyncClient.GetKubernetesSecretValue(spec.Destination.Namespace, spec.Destination.Secret, spec.Destination.Key)
+			if err != nil {
+				klog.Errorf("Secret log failed for %s: %s", spec, err)
+			}
 
-				active := []string{}
+			labels, err := l.RotClient.GetSecretLabels(spec.Source.Project, spec.Source.Secret)
+			if err != nil {
+				return err
+			}
 
-				for key, _ := range labels {
-					// the key of a label for [version: data] pair should be in the format of "v%d"
-					matched, err := regexp.Match(`^v[0-9]+$`, []byte(key))
-					if err != nil {
-						return err
-					}
+			active := []string{}
 
-					if matched {
-						active = append(active, key)
-					}
+			for key, _ := range labels {
+				// the key of a label for [version: data] pair should be in the format of "v%d"
+				if _, ok := rotconfig.ParseVersionLabel(key); ok {
+					active = append(active, key)
 				}
-
-				// append to log
-				d.Append(time.Now().Sub(startTime), srcData, destData, active)
 			}
+
+			// append to log
+			d.Append(time.Now().Sub(startTime), srcData, destData, active)
+		}
+		if elapsed := time.Since(cycleStart); elapsed > l.PollPeriod {
+			klog.Warningf("Logging cycle took %s, overrunning the poll period of %s. Ticks dropped.", elapsed, l.PollPeriod)
+		}
+
+		select {
+		case <-stopChan:
+			klog.V(2).Info("Stop signal received. Quitting syncLogger...")
+			return nil
+		case <-ticker.C:
 		}
 	}
 }
@@ -214,16 +220,17 @@ func (d *logData) Append(t time.Duration, gsm []byte, k8s []byte, active []strin
 	d.Time = append(d.Time, float64(t.Milliseconds())/1000)
 	d.GSMSecretLog = append(d.GSMSecretLog, string(gsm))
 	d.K8sSecretLog = append(d.K8sSecretLog, string(k8s))
+	d.ActiveCounts = append(d.ActiveCounts, len(active))
 
 	if i := len(d.Time) - 1; i == 0 {
-		klog.Infof("\tK8s secret value intial value: '%s'\n", d.K8sSecretLog[i])
-		klog.Infof("\tGSM secret value intial value: '%s'\n", d.GSMSecretLog[i])
+		klog.Infof("\tK8s secret value intial value: %s\n", redact.Value(d.K8sSecretLog[i]))
+		klog.Infof("\tGSM secret value intial value: %s\n", redact.Value(d.GSMSecretLog[i]))
 	} else {
 		if d.GSMSecretLog[i] != d.GSMSecretLog[i-1] {
-			klog.Infof("\tGSM secret value updated from '%s' to '%s'\n", d.GSMSecretLog[i-1], d.GSMSecretLog[i])
+			klog.Infof("\tGSM secret value updated from %s to %s\n", redact.Value(d.GSMSecretLog[i-1]), redact.Value(d.GSMSecretLog[i]))
 		}
 		if d.K8sSecretLog[i] != d.K8sSecretLog[i-1] {
-			klog.Infof("\tK8s secret value updated from '%s' to '%s'\n", d.K8sSecretLog[i-1], d.K8sSecretLog[i])
+			klog.Infof("\tK8s secret value updated from %s to %s\n", redact.Value(d.K8sSecretLog[i-1]), redact.Value(d.K8sSecretLog[i]))
 		}
 	}
 
@@ -307,13 +314,56 @@ func (d *logData) Plot(name string) {
 
 }
 
+// WriteCSV writes the timeline of secret values of both source and destination as CSV,
+// with markers for the points where a value changes, and the number of active versions.
+func (d *logData) WriteCSV(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	err = w.Write([]string{"time", "gsm_value", "k8s_value", "gsm_changed", "k8s_changed", "active_versions"})
+	if err != nil {
+		return err
+	}
+
+	for i := range d.Time {
+		gsmChanged := i > 0 && d.GSMSecretLog[i] != d.GSMSecretLog[i-1]
+		k8sChanged := i > 0 && d.K8sSecretLog[i] != d.K8sSecretLog[i-1]
+		err = w.Write([]string{
+			strconv.FormatFloat(d.Time[i], 'f', 3, 64),
+			d.GSMSecretLog[i],
+			d.K8sSecretLog[i],
+			strconv.FormatBool(gsmChanged),
+			strconv.FormatBool(k8sChanged),
+			strconv.Itoa(d.ActiveCounts[i]),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
 // ShowResults shows the timelines in text form for all secret sync pairs.
-// It also outputs a plot "timeline_i" for the ith pair under outputPath.
+// It also outputs a plot "timeline_i" for the ith pair under outputPath,
+// and "timeline_i.csv" if l.ExportCSV is set.
 func (l *Logger) ShowResults(outputPath string) {
 	for i, spec := range l.Agent.Config().Specs {
 		name := fmt.Sprintf("timeline_%d.png", i)
 		name = filepath.Join(outputPath, name)
-		d := l.LogData[spec.String()]
+		d := l.LogData[spec.ID()]
 		d.Plot(name)
+
+		if l.ExportCSV {
+			name = filepath.Join(outputPath, fmt.Sprintf("timeline_%d.csv", i))
+			if err := d.WriteCSV(name); err != nil {
+				klog.Errorf("Fail to export %s: %s", name, err)
+			}
+		}
 	}
 }
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This command prints a read-only reconciliation report of the secret sync and secret rotator configs
+// against the live state: the existence and sync status of each sync spec,
+// and the number of active versions of each rotated secret. No secret value is printed.
+// The JSON report is written to stdout and a human summary to stderr.
+// Exits with 1 if any spec is not in sync or any rotated secret is unhealthy.
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"k8s.io/klog"
+	"os"
+	"sigs.k8s.io/k8s-gsm-tools/exitcode"
+	"sigs.k8s.io/k8s-gsm-tools/gsmoption"
+	"sigs.k8s.io/k8s-gsm-tools/report"
+	rotclient "sigs.k8s.io/k8s-gsm-tools/secret-rotator/client"
+	rotconfig "sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	syncclient "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	syncconfig "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/controller"
+)
+
+type options struct {
+	syncConfigPath    string
+	rotatorConfigPath string
+	kubeconfig        string
+	annotateSource    bool
+	gsmEndpoint       string
+	gsmFeatureSet     string
+}
+
+func (o *options) Validate() error {
+	if o.syncConfigPath == "" && o.rotatorConfigPath == "" {
+		return fmt.Errorf("at least one of flags --sync-config-path and --rotator-config-path should be set")
+	}
+	if _, err := gsmoption.FlagClientOptions(o.gsmEndpoint, o.gsmFeatureSet); err != nil {
+		return err
+	}
+	return nil
+}
+
+func gatherOptions() options {
+	o := options{}
+	flag.StringVar(&o.syncConfigPath, "sync-config-path", "", "Path to the config.yaml of the secret sync controller, or to a directory or a glob pattern of config files merged together.")
+	flag.StringVar(&o.rotatorConfigPath, "rotator-config-path", "", "Path to the config.yaml of the secret rotator, or to a directory or a glob pattern of config files merged together.")
+	flag.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to kubeconfig file.")
+	flag.BoolVar(&o.annotateSource, "annotate-source", false, "Also verify the source version annotations of the destination secrets, as written by the controller with --annotate-source.")
+	flag.StringVar(&o.gsmEndpoint, "gsm-endpoint", "", "Secret Manager endpoint in format <host>:<port>. Uses the global endpoint if unset.")
+	flag.StringVar(&o.gsmFeatureSet, "gsm-feature-set", string(gsmoption.FeatureSetFull), "Secret Manager features used by the clients, one of full or emulator. The emulator feature set connects to the emulator at --gsm-endpoint over plaintext without authentication.")
+	flag.Parse()
+	return o
+}
+
+func main() {
+	klog.InitFlags(nil)
+
+	o := gatherOptions()
+	err := o.Validate()
+	if err != nil {
+		exitcode.Fatalf(exitcode.ConfigError, "Invalid options: %s", err)
+	}
+	gsmOpts, _ := gsmoption.FlagClientOptions(o.gsmEndpoint, o.gsmFeatureSet)
+
+	syncCfg := &syncconfig.SecretSyncConfig{}
+	if o.syncConfigPath != "" {
+		err = syncCfg.Load(o.syncConfigPath)
+		if err != nil {
+			exitcode.Fatalf(exitcode.ConfigError, "Fail to load sync config: %s", err)
+		}
+		err = syncCfg.Validate()
+		if err != nil {
+			exitcode.Fatalf(exitcode.ConfigError, "Fail to validate sync config: %s", err)
+		}
+	}
+
+	rotCfg := &rotconfig.RotatedSecretConfig{}
+	if o.rotatorConfigPath != "" {
+		err = rotCfg.Load(o.rotatorConfigPath)
+		if err != nil {
+			exitcode.Fatalf(exitcode.ConfigError, "Fail to load rotator config: %s", err)
+		}
+		err = rotCfg.Validate(rotconfig.DefaultMinRefreshInterval)
+		if err != nil {
+			exitcode.Fatalf(exitcode.ConfigError, "Fail to validate rotator config: %s", err)
+		}
+	}
+
+	// prepare clients
+	k8sClientset, err := syncclient.NewK8sClientset(o.kubeconfig)
+	if err != nil {
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new kubernetes client: %s", err)
+	}
+	dynamicClient, err := syncclient.NewDynamicClient(o.kubeconfig)
+	if err != nil {
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new kubernetes dynamic client: %s", err)
+	}
+	secretManagerClient, err := syncclient.NewSecretManagerClient(context.Background(), gsmOpts...)
+	if err != nil {
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new Secret Manager client: %s", err)
+	}
+	syncClient := &syncclient.Client{
+		K8sClientset:        *k8sClientset,
+		SecretManagerClient: *secretManagerClient,
+	}
+	rotationClient, err := rotclient.NewClient(context.Background(), gsmOpts...)
+	if err != nil {
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new rotation client: %s", err)
+	}
+
+	agent := &syncconfig.Agent{}
+	agent.Set(syncCfg)
+	c := &controller.SecretSyncController{
+		Client:         syncClient,
+		Agent:          agent,
+		AnnotateSource: o.annotateSource,
+		Resources:      &syncclient.ResourceClient{Dynamic: dynamicClient},
+		Credentials:    syncclient.NewSecretManagerCredentialsCache(context.Background(), syncClient, gsmOpts...),
+	}
+
+	r := report.Assemble(c, c.ExpandSpecs(syncCfg.Specs), rotationClient, rotCfg.Specs)
+	data, err := r.JSON()
+	if err != nil {
+		exitcode.Fatalf(exitcode.Failure, "Fail to encode report: %s", err)
+	}
+	fmt.Println(string(data))
+	fmt.Fprint(os.Stderr, r.Summary())
+
+	if !r.OK() {
+		os.Exit(exitcode.Failure)
+	}
+}
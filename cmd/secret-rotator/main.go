@@ -14,37 +14,111 @@ limitations under the License.
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"io"
 	"k8s.io/klog"
+	"net/http"
+	"os"
+	"sigs.k8s.io/k8s-gsm-tools/audit"
+	"sigs.k8s.io/k8s-gsm-tools/configschema"
+	"sigs.k8s.io/k8s-gsm-tools/configwatch"
+	"sigs.k8s.io/k8s-gsm-tools/exitcode"
+	"sigs.k8s.io/k8s-gsm-tools/gsmoption"
+	"sigs.k8s.io/k8s-gsm-tools/healthz"
+	"sigs.k8s.io/k8s-gsm-tools/leaderelect"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/client"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/rotator"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/svckey"
+	syncclient "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type options struct {
-	configPath     string
-	period         int64
-	enableDeletion bool
-	runOnce        bool
+	configPath          string
+	period              int64
+	enableDeletion      bool
+	runOnce             bool
+	paused              bool
+	decommission        bool
+	verifyAttempts      int
+	verifyInterval      int64
+	maxProvisionerOps   int
+	allowShortIntervals bool
+	gsmEndpoint         string
+	gsmFeatureSet       string
+	credentialsReload   int64
+	configPoll          int64
+	configDebounce      int64
+	statusAddress       string
+	healthAddress       string
+	metricsPort         int
+	leaderElect         bool
+	leaderLease         string
+	kubeconfig          string
+	auditLog            string
+	printSchema         bool
 }
 
 func (o *options) Validate() error {
 	if o.configPath == "" {
 		return fmt.Errorf("required flag --config-path was unset")
 	}
+	if _, err := gsmoption.FlagClientOptions(o.gsmEndpoint, o.gsmFeatureSet); err != nil {
+		return err
+	}
+	// the deactivated keys would outlive their versions, no longer tracked by the rotator
+	if o.decommission && !o.enableDeletion {
+		return fmt.Errorf("flag --enable-deletion is required with --decommission")
+	}
+	if o.leaderElect && len(strings.Split(o.leaderLease, "/")) != 2 {
+		return fmt.Errorf("flag --leader-election-lease should be in format <namespace>/<name>")
+	}
+	if o.metricsPort < 0 || o.metricsPort > 65535 {
+		return fmt.Errorf("flag --metrics-port should be in range 0-65535")
+	}
 	return nil
 }
 
+// minRefreshInterval returns the floor of the refresh intervals, lifted by --allow-short-intervals.
+func (o *options) minRefreshInterval() time.Duration {
+	if o.allowShortIntervals {
+		return 0
+	}
+	return config.DefaultMinRefreshInterval
+}
+
 func gatherOptions() options {
 	o := options{}
-	flag.StringVar(&o.configPath, "config-path", "", "Path to config.yaml.")
+	flag.StringVar(&o.configPath, "config-path", "", "Path to config.yaml, or to a directory or a glob pattern of config files merged together.")
 	flag.Int64Var(&o.period, "period", 60, "Period in seconds.")
 	flag.BoolVar(&o.enableDeletion, "enable-deletion", false, "Enable deleting old secrets when deactivation triggered.")
 	flag.BoolVar(&o.runOnce, "run-once", false, "Rotate once instead of continuous loop.")
+	flag.BoolVar(&o.paused, "paused", false, "Pause all refreshes and deactivations, like paused: true in the config, while the config is still loaded and validated.")
+	flag.IntVar(&o.verifyAttempts, "verify-attempts", 6, "Maximum attempts to verify a new secret for specs with verifyBeforePublish.")
+	flag.Int64Var(&o.verifyInterval, "verify-interval", 10, "Interval in seconds between attempts to verify a new secret.")
+	flag.IntVar(&o.maxProvisionerOps, "max-provisioner-concurrency", 0, "Maximum provisioner operations, i.e. creations and deactivations of service account keys, running concurrently across all specs, to stay under the IAM rate limits. Unlimited if <= 0.")
+	flag.BoolVar(&o.decommission, "decommission", false, "Deactivate and destroy all managed secret versions of the config and exit.")
+	flag.BoolVar(&o.allowShortIntervals, "allow-short-intervals", false, "Allow refresh intervals shorter than the minimum of 1h.")
+	flag.StringVar(&o.gsmEndpoint, "gsm-endpoint", "", "Secret Manager endpoint in format <host>:<port>, e.g. the regional endpoint secretmanager.<location>.rep.googleapis.com:443. Uses the global endpoint if unset.")
+	flag.StringVar(&o.gsmFeatureSet, "gsm-feature-set", string(gsmoption.FeatureSetFull), "Secret Manager features used by the clients, one of full or emulator. The emulator feature set connects to the emulator at --gsm-endpoint over plaintext without authentication.")
+	flag.Int64Var(&o.credentialsReload, "credentials-reload-period", 60, "Period in seconds of checking the credentials file at $GOOGLE_APPLICATION_CREDENTIALS, to reload the Secret Manager client once it is updated, e.g. with a rotated key. Disabled if <= 0.")
+	flag.Int64Var(&o.configPoll, "config-poll-period", 0, "Period in seconds of checking the config file for changes. Uses the ConfigMap mount watcher if <= 0.")
+	flag.Int64Var(&o.configDebounce, "config-debounce", 0, "With --config-poll-period, delay in seconds of reloading the config file after its last change, so that a burst of changes is reloaded once.")
+	flag.StringVar(&o.statusAddress, "status-address", "", "<host>:<port> serving the read-only endpoint GET /status, listing the next refresh time of each rotated secret. Disabled if unset.")
+	flag.BoolVar(&o.leaderElect, "leader-elect", false, "Run the rotation loop only while holding the Lease of --leader-election-lease, so that several replicas can run for availability without double-provisioning secrets. The other replicas wait for the Lease.")
+	flag.StringVar(&o.leaderLease, "leader-election-lease", "default/secret-rotator", "<namespace>/<name> of the Lease of --leader-elect, held by the hostname of the leader.")
+	flag.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to kubeconfig file of the Kubernetes cluster holding the Lease of --leader-elect. Uses the in-cluster config if possible.")
+	flag.StringVar(&o.healthAddress, "health-address", "", "<host>:<port> serving the liveness endpoint GET /healthz and the readiness endpoint GET /readyz, ready once the clients are created and a valid config is loaded. Disabled if unset.")
+	flag.IntVar(&o.metricsPort, "metrics-port", 0, "Port serving the Prometheus metrics at /metrics, e.g. the next refresh time and the service account key count of each rotated secret, and whether rotation is paused. Disabled if 0.")
+	flag.StringVar(&o.auditLog, "audit-log", "", "Audit log of the refresh and deactivation events, '-' for stdout or the path of a file the JSON lines are appended to. Disabled if unset.")
+	flag.BoolVar(&o.printSchema, "print-schema", false, "Print the JSON Schema of the config to stdout and exit, e.g. to validate configs in CI.")
 	flag.Parse()
 	return o
 }
@@ -53,27 +127,57 @@ func main() {
 	klog.InitFlags(nil)
 
 	o := gatherOptions()
+	if o.printSchema {
+		err := configschema.Write(os.Stdout, "secret-rotator config", &config.RotatedSecretConfig{})
+		if err != nil {
+			exitcode.Fatalf(exitcode.Failure, "Fail to print schema: %s", err)
+		}
+		return
+	}
+
 	err := o.Validate()
 	if err != nil {
-		klog.Errorf("Invalid options: %s", err)
+		exitcode.Fatalf(exitcode.ConfigError, "Invalid options: %s", err)
+	}
+
+	health := healthz.New("clients", "config")
+	if o.healthAddress != "" {
+		health.Serve(o.healthAddress)
 	}
 
 	// prepare client
-	secretManagerClient, err := client.NewClient(context.Background())
+	gsmOpts, err := gsmoption.FlagClientOptions(o.gsmEndpoint, o.gsmFeatureSet)
 	if err != nil {
-		klog.Errorf("Fail to create new Secret Manager client: %s", err)
+		exitcode.Fatalf(exitcode.ConfigError, "Invalid Secret Manager client options: %s", err)
+	}
+	secretManagerClient, err := client.NewClient(context.Background(), gsmOpts...)
+	if err != nil {
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new Secret Manager client: %s", err)
 	}
 
 	// prepare config agent
 	configAgent := config.NewAgent()
+	configAgent.MinRefreshInterval = o.minRefreshInterval()
+	configAgent.WatchOptions = configwatch.Options{
+		PollInterval: time.Duration(o.configPoll) * time.Second,
+		Debounce:     time.Duration(o.configDebounce) * time.Second,
+	}
 	runFunc, err := configAgent.WatchConfig(o.configPath)
 	if err != nil {
-		klog.Fatal(err)
+		exitcode.Fatal(exitcode.ConfigError, err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go runFunc(ctx)
 	defer cancel()
+	health.Set("config", configAgent.Ready)
+
+	err = gsmoption.WatchCredentials(ctx, time.Duration(o.credentialsReload)*time.Second, func() (io.Closer, error) {
+		return secretManagerClient.Reload(ctx, gsmOpts...)
+	})
+	if err != nil {
+		exitcode.Fatalf(exitcode.SetupError, "Fail to watch credentials: %s", err)
+	}
 
 	// prepare provisioners for all supported types of secrets
 	provisioners := map[string]rotator.SecretProvisioner{}
@@ -81,19 +185,128 @@ func main() {
 	// temporarily disabling service account key deletion, for safety reasons.
 	newSvcProvisioner, err := svckey.NewProvisioner(o.enableDeletion)
 	if err != nil {
-		klog.Errorf("Fail to create service account key provisoner: %s", err)
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create service account key provisoner: %s", err)
 	}
 
 	provisioners[svckey.ServiceAccountKeySpec{}.Type()] = newSvcProvisioner
+	health.Pass("clients")
+
+	if o.decommission {
+		decommission(o.configPath, o.minRefreshInterval(), secretManagerClient, provisioners, rotator.NewProvisionerLimiter(o.maxProvisionerOps))
+		return
+	}
+
+	var auditLogger *audit.Logger
+	if o.auditLog != "" {
+		auditLogger, err = audit.Open(o.auditLog, "secret-rotator")
+		if err != nil {
+			exitcode.Fatal(exitcode.SetupError, err)
+		}
+		defer auditLogger.Close()
+	}
 
 	rotator := &rotator.SecretRotator{
-		Client:       secretManagerClient,
-		Agent:        configAgent,
-		Provisioners: provisioners,
-		Period:       time.Duration(o.period) * time.Second,
-		RunOnce:      o.runOnce,
+		Client:         secretManagerClient,
+		Agent:          configAgent,
+		Provisioners:   provisioners,
+		Period:         time.Duration(o.period) * time.Second,
+		RunOnce:        o.runOnce,
+		Paused:         o.paused,
+		VerifyAttempts: o.verifyAttempts,
+		VerifyInterval: time.Duration(o.verifyInterval) * time.Second,
+		AuditLogger:    auditLogger,
+		Limiter:        rotator.NewProvisionerLimiter(o.maxProvisionerOps),
+	}
+
+	if o.leaderElect {
+		rotator.LeaderElection, err = leaderElection(o.kubeconfig, o.leaderLease)
+		if err != nil {
+			exitcode.Fatalf(exitcode.SetupError, "Fail to set up leader election: %s", err)
+		}
+	}
+
+	if o.statusAddress != "" {
+		serveStatus(o.statusAddress, rotator)
+	}
+	if o.metricsPort != 0 {
+		serveMetrics(o.metricsPort)
 	}
 
 	stopChan := make(chan struct{})
-	rotator.Start(stopChan)
+	err = rotator.Start(stopChan)
+	if err != nil {
+		exitcode.Fatalf(exitcode.Failure, "Rotator stopped: %s", err)
+	}
+}
+
+// leaderElection returns the election through the Lease <namespace>/<name> of lease, held by the hostname of the leader.
+func leaderElection(kubeconfig, lease string) (*leaderelect.Config, error) {
+	k8sClientset, err := syncclient.NewK8sClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(lease, "/")
+	return &leaderelect.Config{
+		Clientset: *k8sClientset,
+		Namespace: parts[0],
+		Name:      parts[1],
+		Identity:  hostname,
+	}, nil
+}
+
+// serveStatus serves the read-only status endpoints of r at address in the background.
+func serveStatus(address string, r *rotator.SecretRotator) {
+	mux := http.NewServeMux()
+	mux.Handle("/status", r.StatusHandler())
+	go func() {
+		exitcode.Fatal(exitcode.SetupError, http.ListenAndServe(address, mux))
+	}()
+}
+
+// serveMetrics serves the Prometheus metrics at /metrics of port in the background.
+func serveMetrics(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		exitcode.Fatal(exitcode.SetupError, http.ListenAndServe(":"+strconv.Itoa(port), mux))
+	}()
+}
+
+// decommission deactivates and destroys the managed secret versions of the config at configPath after user confirmation.
+// The config is validated with refresh intervals no shorter than minInterval.
+func decommission(configPath string, minInterval time.Duration, cl client.Interface, provisioners map[string]rotator.SecretProvisioner, limiter rotator.ProvisionerLimiter) {
+	cfg := &config.RotatedSecretConfig{}
+	err := cfg.Load(configPath)
+	if err != nil {
+		exitcode.Fatalf(exitcode.ConfigError, "Fail to load config: %s", err)
+	}
+
+	err = cfg.Validate(minInterval)
+	if err != nil {
+		exitcode.Fatalf(exitcode.ConfigError, "Fail to validate config: %s", err)
+	}
+
+	if !confirm(fmt.Sprintf("Deactivate and destroy the managed secret versions of %d specs in %s?", len(cfg.Specs), configPath)) {
+		klog.Info("Decommission aborted.")
+		return
+	}
+
+	err = rotator.Decommission(cl, provisioners, limiter, cfg)
+	if err != nil {
+		exitcode.Fatalf(exitcode.Failure, "Fail to decommission: %s", err)
+	}
+}
+
+// confirm prompts the user on stdin, and returns true only if the answer is "yes".
+func confirm(prompt string) bool {
+	fmt.Printf("%s [yes/no]: ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(answer) == "yes"
 }
@@ -14,36 +14,190 @@ limitations under the License.
 package main
 
 import (
+	"bufio"
 	"context"
+	"contrib.go.opencensus.io/exporter/ocagent"
 	"flag"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opencensus.io/trace"
+	"io"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
+	"net/http"
+	"os"
+	"sigs.k8s.io/k8s-gsm-tools/audit"
+	"sigs.k8s.io/k8s-gsm-tools/configschema"
+	"sigs.k8s.io/k8s-gsm-tools/configwatch"
+	"sigs.k8s.io/k8s-gsm-tools/exitcode"
+	"sigs.k8s.io/k8s-gsm-tools/gsmoption"
+	"sigs.k8s.io/k8s-gsm-tools/healthz"
+	"sigs.k8s.io/k8s-gsm-tools/leaderelect"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/controller"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type options struct {
-	configPath   string
-	kubeconfig   string
-	runOnce      bool
-	resyncPeriod int64
+	configPath        string
+	configMap         string
+	configCRD         bool
+	crdProjects       string
+	kubeconfig        string
+	runOnce           bool
+	resyncPeriod      int64
+	decommission      bool
+	maxSpecs          int
+	annotateSource    bool
+	verifyPeriod      int64
+	autoRemediate     bool
+	instanceID        string
+	managerName       string
+	reverseImport     bool
+	manifest          string
+	waitNamespace     bool
+	refuseUnmanaged   bool
+	adoptUnmanaged    bool
+	plan              bool
+	preserveMetadata  string
+	noOpVerbosity     int
+	mockGSM           string
+	prune             bool
+	pruneKeys         bool
+	statusAnnotate    bool
+	gsmEndpoint       string
+	gsmFeatureSet     string
+	syncSpec          string
+	pubsubSub         string
+	watchDest         bool
+	otelEndpoint      string
+	credentialsReload int64
+	adminAddress      string
+	adminTokenFile    string
+	metricsPort       int
+	healthAddress     string
+	leaderElect       bool
+	leaderLease       string
+	configPoll        int64
+	configDebounce    int64
+	maxSourceBytes    int
+	breakerThreshold  int
+	auditLog          string
+	maxDriftCycles    int
+	printSchema       bool
 }
 
 func (o *options) Validate() error {
-	if o.configPath == "" {
-		return fmt.Errorf("required flag --config-path was unset")
+	sources := 0
+	for _, set := range []bool{o.configPath != "", o.configMap != "", o.configCRD} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of flags --config-path, --config-configmap and --config-crd should be set")
+	}
+	if o.configCRD != (o.crdProjects != "") {
+		return fmt.Errorf("flag --crd-source-projects should be set with, and only with, --config-crd")
+	}
+	if o.configCRD {
+		if _, err := config.ParseSourceProjects(o.crdProjects); err != nil {
+			return fmt.Errorf("flag --crd-source-projects: %s", err)
+		}
+	}
+	if o.configMap != "" && len(strings.Split(o.configMap, "/")) != 2 {
+		return fmt.Errorf("flag --config-configmap should be in format <namespace>/<name>")
+	}
+	if o.manifest != "" && len(strings.Split(o.manifest, "/")) != 2 {
+		return fmt.Errorf("flag --manifest-configmap should be in format <namespace>/<name>")
+	}
+	if o.pruneKeys && !o.prune {
+		return fmt.Errorf("flag --prune is required with --prune-keys")
+	}
+	if o.leaderElect && len(strings.Split(o.leaderLease, "/")) != 2 {
+		return fmt.Errorf("flag --leader-election-lease should be in format <namespace>/<name>")
+	}
+	if _, err := gsmoption.FlagClientOptions(o.gsmEndpoint, o.gsmFeatureSet); err != nil {
+		return err
+	}
+	if o.pubsubSub != "" {
+		parts := strings.Split(o.pubsubSub, "/")
+		if len(parts) != 4 || parts[0] != "projects" || parts[2] != "subscriptions" {
+			return fmt.Errorf("flag --pubsub-subscription should be in format projects/<project>/subscriptions/<subscription>")
+		}
+	}
+	if o.maxDriftCycles > 0 && o.verifyPeriod <= 0 {
+		return fmt.Errorf("flag --verify-period is required with --fail-on-persistent-drift")
+	}
+	if errs := validation.IsValidLabelValue(o.managerName); len(errs) > 0 {
+		return fmt.Errorf("flag --manager-name should be a label value: %s", strings.Join(errs, ", "))
+	}
+	if o.adminAddress != "" && o.adminTokenFile == "" {
+		return fmt.Errorf("flag --admin-token-file is required with --admin-address")
+	}
+	if o.metricsPort < 0 || o.metricsPort > 65535 {
+		return fmt.Errorf("flag --metrics-port should be in range 0-65535")
 	}
 	return nil
 }
 
 func gatherOptions() options {
 	o := options{}
-	flag.StringVar(&o.configPath, "config-path", "", "Path to config.yaml.")
+	flag.StringVar(&o.configPath, "config-path", "", "Path to config.yaml, or to a directory or a glob pattern of config files merged together.")
+	flag.StringVar(&o.configMap, "config-configmap", "", "<namespace>/<name> of the ConfigMap of the config, read and watched through the API instead of mounted, as an alternative to --config-path.")
+	flag.BoolVar(&o.configCRD, "config-crd", false, "Read and watch the specs of the SecretSync custom resources of all namespaces, each syncing into its own namespace, as an alternative to --config-path.")
+	flag.StringVar(&o.crdProjects, "crd-source-projects", "", "Comma-separated <namespace>=<project> entries allowing the SecretSyncs of --config-crd in namespace to read the Secret Manager secrets of project, e.g. team-a=proj-a,*=proj-shared. The namespace * allows the project to all namespaces.")
 	flag.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to kubeconfig file.")
 	flag.BoolVar(&o.runOnce, "run-once", false, "Sync once instead of continuous loop.")
+	flag.StringVar(&o.syncSpec, "sync-spec", "", "Sync only the spec identified by its name, <namespace>/<secret> or <namespace>/<secret>/<key> once, and exit.")
 	flag.Int64Var(&o.resyncPeriod, "period", 60, "Resync period in seconds.")
+	flag.BoolVar(&o.decommission, "decommission", false, "Delete all managed destination secrets of the config and exit.")
+	flag.IntVar(&o.maxSpecs, "max-specs-per-cycle", 0, "Maximum number of specs synced per resync period, processed in a round-robin manner. Syncs all specs if <= 0.")
+	flag.BoolVar(&o.annotateSource, "annotate-source", false, "Record the source secret version of each synced key in an annotation of the destination secret, even if unchanged. The written keys are annotated in any case.")
+	flag.Int64Var(&o.verifyPeriod, "verify-period", 0, "Drift verification period in seconds. Disabled if <= 0.")
+	flag.BoolVar(&o.autoRemediate, "auto-remediate", false, "Re-sync the specs found drifted by the drift verification.")
+	flag.IntVar(&o.maxDriftCycles, "fail-on-persistent-drift", 0, "Exit with code 3 once a spec is found drifted by this many consecutive drift verifications, tolerating the drifts reconciled in between, e.g. to validate a controller upgrade in staging. Requires --verify-period. Disabled if <= 0.")
+	flag.StringVar(&o.instanceID, "instance-id", "", "Identity of this controller instance, recorded in the last-writer annotation of the secrets it writes. Defaults to the hostname.")
+	flag.StringVar(&o.managerName, "manager-name", client.ManagedByValue, "Identity of this controller in the "+client.ManagedByLabel+" label of the secrets it manages, and in its audit records, e.g. to tell apart differently-purposed instances. The secrets labeled with another name are unmanaged.")
+	flag.BoolVar(&o.reverseImport, "reverse-import", false, "Create the missing Secret Manager sources of the config from their destination secrets and exit.")
+	flag.StringVar(&o.manifest, "manifest-configmap", "", "<namespace>/<name> of the ConfigMap persisting the source checksums of the synced specs, to skip the unchanged specs on the first cycle after a restart. Disabled if unset.")
+	flag.BoolVar(&o.waitNamespace, "wait-for-namespace", false, "Keep the specs whose destination namespace does not exist yet pending, and retry them with backoff until the namespace is created.")
+	flag.BoolVar(&o.refuseUnmanaged, "refuse-unmanaged", false, "Refuse to write into existing destination secrets not labeled as managed by the controller.")
+	flag.BoolVar(&o.adoptUnmanaged, "adopt-unmanaged", false, "With --refuse-unmanaged, label the unmanaged destination secrets as managed and write into them.")
+	flag.StringVar(&o.preserveMetadata, "preserve-metadata", "", "Comma-separated label and annotation keys carried over when a destination secret is recreated, e.g. ownership labels of GitOps tools.")
+	flag.IntVar(&o.noOpVerbosity, "noop-verbosity", 3, "Klog verbosity of the logs of destination keys checked without change.")
+	flag.BoolVar(&o.statusAnnotate, "status-annotations", false, "Record the time, result and source versions of the last sync in annotations of each destination secret.")
+	flag.BoolVar(&o.prune, "prune", false, "Delete the managed destination secrets of the specs removed from the config, unless they hold keys of other writers.")
+	flag.BoolVar(&o.pruneKeys, "prune-keys", false, "With --prune, remove the keys of the removed specs from the managed destination secrets holding other keys, instead of keeping them.")
+	flag.StringVar(&o.gsmEndpoint, "gsm-endpoint", "", "Secret Manager endpoint in format <host>:<port>, e.g. the regional endpoint secretmanager.<location>.rep.googleapis.com:443. Uses the global endpoint if unset.")
+	flag.StringVar(&o.gsmFeatureSet, "gsm-feature-set", string(gsmoption.FeatureSetFull), "Secret Manager features used by the clients, one of full or emulator. The emulator feature set connects to the emulator at --gsm-endpoint over plaintext without authentication.")
+	flag.StringVar(&o.pubsubSub, "pubsub-subscription", "", "Pub/Sub subscription, in format projects/<project>/subscriptions/<subscription>, of a topic receiving the Secret Manager notifications. Syncs the specs of each notified secret right away, on top of the periodic resync. Disabled if unset.")
+	flag.BoolVar(&o.watchDest, "watch-destinations", false, "Watch the managed destination secrets, and re-sync the specs of each secret edited or deleted outside the controller right away, on top of the periodic resync.")
+	flag.StringVar(&o.otelEndpoint, "otel-endpoint", "", "<host>:<port> of an OpenTelemetry Collector with an OpenCensus receiver, to export the traces of each sync cycle to. Disabled if unset.")
+	flag.Int64Var(&o.credentialsReload, "credentials-reload-period", 60, "Period in seconds of checking the credentials file at $GOOGLE_APPLICATION_CREDENTIALS, to reload the Secret Manager client once it is updated, e.g. with a rotated key. Disabled if <= 0.")
+	flag.Int64Var(&o.configPoll, "config-poll-period", 0, "Period in seconds of checking the config file for changes. Uses the ConfigMap mount watcher if <= 0.")
+	flag.Int64Var(&o.configDebounce, "config-debounce", 0, "With --config-poll-period, delay in seconds of reloading the config file after its last change, so that a burst of changes is reloaded once.")
+	flag.IntVar(&o.maxSourceBytes, "max-source-bytes", controller.DefaultMaxSourceBytes, "Maximum size in bytes of the secret values read from Secret Manager. The sync of larger values fails.")
+	flag.StringVar(&o.auditLog, "audit-log", "", "Audit log of the sync events, '-' for stdout or the path of a file the JSON lines are appended to. Disabled if unset.")
+	flag.IntVar(&o.breakerThreshold, "breaker-threshold", 0, "Number of consecutive specs failed by an unavailable Kubernetes API after which the rest of the sync cycle, and the next cycles with backoff, are skipped. Disabled if <= 0.")
+	flag.StringVar(&o.adminAddress, "admin-address", "", "<host>:<port> serving the admin endpoint POST /resync, running an immediate sync of all specs. Disabled if unset.")
+	flag.StringVar(&o.adminTokenFile, "admin-token-file", "", "Path to the file of the bearer token authenticating the requests to --admin-address.")
+	flag.BoolVar(&o.leaderElect, "leader-elect", false, "Run the sync loop only while holding the Lease of --leader-election-lease, so that several replicas can run for availability without double-writing secrets. The other replicas wait for the Lease.")
+	flag.StringVar(&o.leaderLease, "leader-election-lease", "default/secret-sync-controller", "<namespace>/<name> of the Lease of --leader-elect, held by the --instance-id of the leader.")
+	flag.StringVar(&o.healthAddress, "health-address", "", "<host>:<port> serving the liveness endpoint GET /healthz and the readiness endpoint GET /readyz, ready once the clients are created and a valid config is loaded. Disabled if unset.")
+	flag.IntVar(&o.metricsPort, "metrics-port", 0, "Port serving the Prometheus metrics at /metrics, e.g. the sync results of each spec and the Kubernetes and Secret Manager API calls. Disabled if 0.")
+	flag.BoolVar(&o.plan, "plan", false, "Print the actions a sync would take on each destination key, with checksums only, and exit.")
+	flag.BoolVar(&o.printSchema, "print-schema", false, "Print the JSON Schema of the config to stdout and exit, e.g. to validate configs in CI.")
+	if mockGSMAvailable {
+		flag.StringVar(&o.mockGSM, "mock-gsm", "", "Path to a yaml of <project>: {<secret>: <value>} seeding a fake in-process Secret Manager. For local development only.")
+	}
 	flag.Parse()
 	return o
 }
@@ -52,44 +206,393 @@ func main() {
 	klog.InitFlags(nil)
 
 	o := gatherOptions()
+	if o.printSchema {
+		err := configschema.Write(os.Stdout, "secret-sync-controller config", &config.SecretSyncConfig{})
+		if err != nil {
+			exitcode.Fatalf(exitcode.Failure, "Fail to print schema: %s", err)
+		}
+		return
+	}
+
 	err := o.Validate()
 	if err != nil {
-		klog.Errorf("Invalid options: %s", err)
+		exitcode.Fatalf(exitcode.ConfigError, "Invalid options: %s", err)
+	}
+
+	health := healthz.New("clients", "config")
+	if o.healthAddress != "" {
+		health.Serve(o.healthAddress)
+	}
+
+	if o.instanceID == "" {
+		o.instanceID, err = os.Hostname()
+		if err != nil {
+			klog.Errorf("Fail to get hostname: %s", err)
+		}
 	}
 
 	// prepare clients
 	k8sClientset, err := client.NewK8sClientset(o.kubeconfig)
 	if err != nil {
-		klog.Errorf("Fail to create new kubernetes client: %s", err)
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new kubernetes client: %s", err)
+	}
+	actualClient := &client.Client{
+		K8sClientset: *k8sClientset,
+		Manager:      o.managerName,
+	}
+	if o.preserveMetadata != "" {
+		actualClient.PreserveMetadata = strings.Split(o.preserveMetadata, ",")
+	}
+
+	gsmOpts, err := gsmoption.FlagClientOptions(o.gsmEndpoint, o.gsmFeatureSet)
+	if err != nil {
+		exitcode.Fatalf(exitcode.ConfigError, "Invalid Secret Manager client options: %s", err)
+	}
+
+	var clientInterface client.Interface = actualClient
+	// the destinations with envelope encryption fail to sync without Cloud KMS, e.g. against a fake or an emulator
+	var encrypter controller.Encrypter
+	if o.mockGSM != "" {
+		// no GCP credentials needed, the Secret Manager calls are served by the fake
+		clientInterface, err = withMockGSM(o.mockGSM, actualClient)
+		if err != nil {
+			exitcode.Fatalf(exitcode.SetupError, "Fail to create fake Secret Manager: %s", err)
+		}
+		klog.Warningf("Running against a fake Secret Manager seeded from %s. For local development only.", o.mockGSM)
+	} else {
+		secretManagerClient, err := client.NewSecretManagerClient(context.Background(), gsmOpts...)
+		if err != nil {
+			exitcode.Fatalf(exitcode.SetupError, "Fail to create new Secret Manager client: %s", err)
+		}
+		actualClient.SecretManagerClient = *secretManagerClient
+
+		if featureSet, _ := gsmoption.ParseFeatureSet(o.gsmFeatureSet); featureSet == gsmoption.FeatureSetFull {
+			kmsClient, err := client.NewKMSClient(context.Background())
+			if err != nil {
+				exitcode.Fatalf(exitcode.SetupError, "Fail to create new Cloud KMS client: %s", err)
+			}
+			encrypter = kmsClient
+		}
 	}
-	secretManagerClient, err := client.NewSecretManagerClient(context.Background())
+	credentials := client.NewSecretManagerCredentialsCache(context.Background(), clientInterface, gsmOpts...)
+	dynamicClient, err := client.NewDynamicClient(o.kubeconfig)
 	if err != nil {
-		klog.Errorf("Fail to create new Secret Manager client: %s", err)
+		exitcode.Fatalf(exitcode.SetupError, "Fail to create new kubernetes dynamic client: %s", err)
 	}
-	clientInterface := &client.Client{
-		K8sClientset:        *k8sClientset,
-		SecretManagerClient: *secretManagerClient,
+	resources := &client.ResourceClient{
+		Dynamic: dynamicClient,
+		Manager: o.managerName,
+	}
+	health.Pass("clients")
+
+	if o.decommission {
+		decommission(loadConfig(o, *k8sClientset, dynamicClient), o.configSource(), clientInterface)
+		return
+	}
+
+	if o.reverseImport {
+		reverseImport(loadConfig(o, *k8sClientset, dynamicClient), clientInterface)
+		return
+	}
+
+	if o.plan {
+		plan(loadConfig(o, *k8sClientset, dynamicClient), clientInterface, resources, credentials, encrypter)
+		return
 	}
 
 	// prepare config agent
-	configAgent := &config.Agent{}
-	runFunc, err := configAgent.WatchConfig(o.configPath)
+	configAgent := &config.Agent{
+		WatchOptions: configwatch.Options{
+			PollInterval: time.Duration(o.configPoll) * time.Second,
+			Debounce:     time.Duration(o.configDebounce) * time.Second,
+		},
+	}
+	var runFunc func(ctx context.Context)
+	switch {
+	case o.configCRD:
+		projects, _ := config.ParseSourceProjects(o.crdProjects)
+		runFunc, err = configAgent.WatchSecretSyncs(dynamicClient, projects)
+	case o.configMap != "":
+		parts := strings.Split(o.configMap, "/")
+		runFunc, err = configAgent.WatchConfigMap(*k8sClientset, parts[0], parts[1])
+	default:
+		runFunc, err = configAgent.WatchConfig(o.configPath)
+	}
 	if err != nil {
-		klog.Fatal(err)
+		exitcode.Fatal(exitcode.ConfigError, err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go runFunc(ctx)
 	defer cancel()
+	health.Set("config", configAgent.Ready)
+
+	if o.mockGSM == "" {
+		err = gsmoption.WatchCredentials(ctx, time.Duration(o.credentialsReload)*time.Second, func() (io.Closer, error) {
+			return actualClient.ReloadSecretManagerClient(ctx, gsmOpts...)
+		})
+		if err != nil {
+			exitcode.Fatalf(exitcode.SetupError, "Fail to watch credentials: %s", err)
+		}
+	}
+
+	var manifest *controller.HashManifest
+	if o.manifest != "" {
+		parts := strings.Split(o.manifest, "/")
+		manifest = &controller.HashManifest{
+			Namespace: parts[0],
+			Name:      parts[1],
+		}
+	}
+
+	var auditLogger *audit.Logger
+	if o.auditLog != "" {
+		auditLogger, err = audit.Open(o.auditLog, actualClient.ManagerName())
+		if err != nil {
+			exitcode.Fatal(exitcode.SetupError, err)
+		}
+		defer auditLogger.Close()
+	}
 
 	controller := &controller.SecretSyncController{
-		Client:       clientInterface,
-		Agent:        configAgent,
-		RunOnce:      o.runOnce,
-		ResyncPeriod: time.Duration(o.resyncPeriod) * time.Second,
+		Client:            clientInterface,
+		Agent:             configAgent,
+		RunOnce:           o.runOnce,
+		ResyncPeriod:      time.Duration(o.resyncPeriod) * time.Second,
+		MaxSpecsPerCycle:  o.maxSpecs,
+		AnnotateSource:    o.annotateSource,
+		VerifyPeriod:      time.Duration(o.verifyPeriod) * time.Second,
+		AutoRemediate:     o.autoRemediate,
+		MaxDriftCycles:    o.maxDriftCycles,
+		InstanceID:        o.instanceID,
+		Manifest:          manifest,
+		Resources:         resources,
+		WaitForNamespace:  o.waitNamespace,
+		RefuseUnmanaged:   o.refuseUnmanaged,
+		AdoptUnmanaged:    o.adoptUnmanaged,
+		Credentials:       credentials,
+		NoOpVerbosity:     klog.Level(o.noOpVerbosity),
+		Prune:             o.prune,
+		PruneKeys:         o.pruneKeys,
+		StatusAnnotations: o.statusAnnotate,
+		MaxSourceBytes:    o.maxSourceBytes,
+		BreakerThreshold:  o.breakerThreshold,
+		AuditLogger:       auditLogger,
+		Encrypter:         encrypter,
+	}
+
+	if o.syncSpec != "" {
+		syncSpec(controller, o.syncSpec)
+		return
+	}
+
+	if o.leaderElect {
+		if o.instanceID == "" {
+			exitcode.Fatalf(exitcode.ConfigError, "Flag --instance-id is required with --leader-elect")
+		}
+		parts := strings.Split(o.leaderLease, "/")
+		controller.LeaderElection = &leaderelect.Config{
+			Clientset: *k8sClientset,
+			Namespace: parts[0],
+			Name:      parts[1],
+			Identity:  o.instanceID,
+		}
+	}
+
+	if o.pubsubSub != "" {
+		subscriber, err := client.NewPubSubSubscriber(ctx, o.pubsubSub)
+		if err != nil {
+			exitcode.Fatalf(exitcode.SetupError, "Fail to create Pub/Sub subscriber: %s", err)
+		}
+		controller.Subscriber = subscriber
+	}
+
+	if o.watchDest {
+		controller.DestinationWatcher = &client.SecretWatcher{Clientset: *k8sClientset, Manager: o.managerName}
+	}
+
+	if o.otelEndpoint != "" {
+		stopTracing, err := startTracing(o.otelEndpoint)
+		if err != nil {
+			exitcode.Fatalf(exitcode.SetupError, "Fail to start tracing: %s", err)
+		}
+		defer stopTracing()
+	}
+
+	if o.adminAddress != "" {
+		err := serveAdmin(o.adminAddress, o.adminTokenFile, controller)
+		if err != nil {
+			exitcode.Fatalf(exitcode.SetupError, "Fail to serve admin endpoint: %s", err)
+		}
+	}
+
+	if o.metricsPort != 0 {
+		serveMetrics(o.metricsPort)
 	}
 
 	stopChan := make(chan struct{})
-	controller.Start(stopChan)
+	err = controller.Start(stopChan)
+	if err != nil {
+		exitcode.Fatalf(exitcode.Failure, "Controller stopped: %s", err)
+	}
+}
+
+// startTracing exports all traces to the OpenCensus receiver at endpoint.
+// Returns a function flushing the pending spans and stopping the exporter.
+func startTracing(endpoint string) (func(), error) {
+	exporter, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(endpoint),
+		ocagent.WithServiceName("secret-sync-controller"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	trace.RegisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	return func() {
+		exporter.Flush()
+		err := exporter.Stop()
+		if err != nil {
+			klog.Errorf("Fail to stop trace exporter: %s", err)
+		}
+	}, nil
+}
+
+// serveAdmin serves the admin endpoints of c at address in the background, authenticated by the token in tokenFile.
+func serveAdmin(address, tokenFile string, c *controller.SecretSyncController) error {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(token)) == "" {
+		return fmt.Errorf("empty token in %s", tokenFile)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/resync", c.ResyncHandler(strings.TrimSpace(string(token))))
+	go func() {
+		exitcode.Fatal(exitcode.SetupError, http.ListenAndServe(address, mux))
+	}()
+	return nil
+}
+
+// serveMetrics serves the Prometheus metrics at /metrics of port in the background.
+func serveMetrics(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		exitcode.Fatal(exitcode.SetupError, http.ListenAndServe(":"+strconv.Itoa(port), mux))
+	}()
+}
+
+// configSource describes the config source of --config-path, --config-configmap or --config-crd.
+func (o *options) configSource() string {
+	if o.configCRD {
+		return "SecretSync custom resources"
+	}
+	if o.configMap != "" {
+		return "ConfigMap " + o.configMap
+	}
+	return o.configPath
+}
 
+// loadConfig loads and validates the config once from --config-path, --config-configmap or --config-crd, for the one-shot modes.
+func loadConfig(o options, k8sClientset kubernetes.Interface, dynamicClient dynamic.Interface) *config.SecretSyncConfig {
+	cfg := &config.SecretSyncConfig{}
+	var err error
+	if o.configCRD {
+		list, listErr := dynamicClient.Resource(config.SecretSyncResource).List(metav1.ListOptions{})
+		if listErr != nil {
+			exitcode.Fatalf(exitcode.ConfigError, "Fail to list %s: %s", config.SecretSyncResource.Resource, listErr)
+		}
+		projects, _ := config.ParseSourceProjects(o.crdProjects)
+		cfg.LoadFromSecretSyncs(list.Items, projects)
+	} else if o.configMap != "" {
+		parts := strings.Split(o.configMap, "/")
+		configMap, getErr := k8sClientset.CoreV1().ConfigMaps(parts[0]).Get(parts[1], metav1.GetOptions{})
+		if getErr != nil {
+			exitcode.Fatalf(exitcode.ConfigError, "Fail to get ConfigMap %s: %s", o.configMap, getErr)
+		}
+		err = cfg.LoadFromConfigMap(configMap)
+	} else {
+		err = cfg.Load(o.configPath)
+	}
+	if err != nil {
+		exitcode.Fatalf(exitcode.ConfigError, "Fail to load config: %s", err)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		exitcode.Fatalf(exitcode.ConfigError, "Fail to validate config: %s", err)
+	}
+
+	return cfg
+}
+
+// decommission deletes the managed destination secrets of cfg, loaded from source, after user confirmation.
+func decommission(cfg *config.SecretSyncConfig, source string, cl client.Interface) {
+	if !confirm(fmt.Sprintf("Delete the managed destination secrets of %d specs in %s?", len(cfg.Specs), source)) {
+		klog.Info("Decommission aborted.")
+		return
+	}
+
+	err := controller.Decommission(cl, cfg)
+	if err != nil {
+		exitcode.Fatalf(exitcode.Failure, "Fail to decommission: %s", err)
+	}
+}
+
+// reverseImport creates the missing Secret Manager sources of cfg from their destination secrets.
+func reverseImport(cfg *config.SecretSyncConfig, cl client.Interface) {
+	err := controller.ReverseImport(cl, cfg)
+	if err != nil {
+		exitcode.Fatalf(exitcode.Failure, "Fail to reverse import: %s", err)
+	}
+}
+
+// plan prints the actions a sync of cfg would take, without writing.
+func plan(cfg *config.SecretSyncConfig, cl client.Interface, resources *client.ResourceClient, credentials *client.CredentialsCache, encrypter controller.Encrypter) {
+	agent := &config.Agent{}
+	agent.Set(cfg)
+	planner := &controller.SecretSyncController{
+		Client:      cl,
+		Agent:       agent,
+		Resources:   resources,
+		Credentials: credentials,
+		Encrypter:   encrypter,
+	}
+
+	err := controller.WritePlan(os.Stdout, planner.Plan())
+	if err != nil {
+		exitcode.Fatalf(exitcode.Failure, "Fail to print plan: %s", err)
+	}
+}
+
+// syncSpec syncs the spec identified by id in the config of c once, into all its namespaces if it has a namespace pattern.
+func syncSpec(c *controller.SecretSyncController, id string) {
+	found, err := c.Agent.Config().FindSpec(id)
+	if err != nil {
+		exitcode.Fatal(exitcode.ConfigError, err)
+	}
+
+	for _, spec := range c.ExpandSpecs([]config.SecretSyncSpec{found}) {
+		updated, err := c.Sync(spec)
+		if err != nil {
+			exitcode.Fatalf(exitcode.Failure, "Fail to sync %s: %s", spec, err)
+		}
+		klog.Infof("Synced %s, updated: %v", spec, updated)
+	}
+}
+
+// confirm prompts the user on stdin, and returns true only if the answer is "yes".
+func confirm(prompt string) bool {
+	fmt.Printf("%s [yes/no]: ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(answer) == "yes"
 }
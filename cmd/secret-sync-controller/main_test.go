@@ -0,0 +1,219 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		options     options
+		expectError string
+	}{
+		{
+			name: "Config path and defaults. Should be valid.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+			},
+		},
+		{
+			name: "Missing config path. Should fail.",
+			options: options{
+				gsmFeatureSet: "full",
+			},
+			expectError: "--config-path",
+		},
+		{
+			name: "Config ConfigMap. Should be valid.",
+			options: options{
+				configMap:     "ns-config/config",
+				gsmFeatureSet: "full",
+			},
+		},
+		{
+			name: "Both config path and config ConfigMap. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				configMap:     "ns-config/config",
+				gsmFeatureSet: "full",
+			},
+			expectError: "--config-configmap",
+		},
+		{
+			name: "Config custom resources. Should be valid.",
+			options: options{
+				configCRD:     true,
+				crdProjects:   "ns-a=proj-a,*=proj-shared",
+				gsmFeatureSet: "full",
+			},
+		},
+		{
+			name: "Config custom resources without source projects. Should fail.",
+			options: options{
+				configCRD:     true,
+				gsmFeatureSet: "full",
+			},
+			expectError: "--crd-source-projects",
+		},
+		{
+			name: "Malformed source projects. Should fail.",
+			options: options{
+				configCRD:     true,
+				crdProjects:   "ns-a:proj-a",
+				gsmFeatureSet: "full",
+			},
+			expectError: "--crd-source-projects",
+		},
+		{
+			name: "Source projects without config custom resources. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				crdProjects:   "ns-a=proj-a",
+				gsmFeatureSet: "full",
+			},
+			expectError: "--crd-source-projects",
+		},
+		{
+			name: "Both config ConfigMap and config custom resources. Should fail.",
+			options: options{
+				configMap:     "ns-config/config",
+				configCRD:     true,
+				gsmFeatureSet: "full",
+			},
+			expectError: "--config-crd",
+		},
+		{
+			name: "Malformed config ConfigMap. Should fail.",
+			options: options{
+				configMap:     "config",
+				gsmFeatureSet: "full",
+			},
+			expectError: "--config-configmap",
+		},
+		{
+			name: "Malformed manifest ConfigMap. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				manifest:      "manifest",
+			},
+			expectError: "--manifest-configmap",
+		},
+		{
+			name: "Unknown Secret Manager feature set. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "partial",
+			},
+			expectError: "--gsm-feature-set",
+		},
+		{
+			name: "Malformed Pub/Sub subscription. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				pubsubSub:     "subscriptions/sub-1",
+			},
+			expectError: "--pubsub-subscription",
+		},
+		{
+			name: "Persistent drift failure without verification. Should fail.",
+			options: options{
+				configPath:     "config.yaml",
+				gsmFeatureSet:  "full",
+				maxDriftCycles: 3,
+			},
+			expectError: "--verify-period",
+		},
+		{
+			name: "Persistent drift failure with verification. Should be valid.",
+			options: options{
+				configPath:     "config.yaml",
+				gsmFeatureSet:  "full",
+				maxDriftCycles: 3,
+				verifyPeriod:   60,
+			},
+		},
+		{
+			name: "Invalid manager name. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				managerName:   "secret sync controller",
+			},
+			expectError: "--manager-name",
+		},
+		{
+			name: "Admin address without token file. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				adminAddress:  ":8081",
+			},
+			expectError: "--admin-token-file",
+		},
+		{
+			name: "Metrics port. Should be valid.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				metricsPort:   9090,
+			},
+		},
+		{
+			name: "Metrics port out of range. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				metricsPort:   65536,
+			},
+			expectError: "--metrics-port",
+		},
+		{
+			name: "Leader election with lease. Should be valid.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				leaderElect:   true,
+				leaderLease:   "default/secret-sync-controller",
+			},
+		},
+		{
+			name: "Leader election with invalid lease. Should fail.",
+			options: options{
+				configPath:    "config.yaml",
+				gsmFeatureSet: "full",
+				leaderElect:   true,
+				leaderLease:   "secret-sync-controller",
+			},
+			expectError: "--leader-election-lease",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			err := tc.options.Validate()
+			if tc.expectError == "" && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if tc.expectError != "" && (err == nil || !strings.Contains(err.Error(), tc.expectError)) {
+				t.Errorf("Expected error containing %q, but got %v.", tc.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+//go:build mockgsm
+// +build mockgsm
+
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+)
+
+// mockGSMAvailable registers the --mock-gsm flag. It is only set in builds with the mockgsm tag,
+// so that the test-only mock client is never linked into, nor enabled in, production builds.
+const mockGSMAvailable = true
+
+// withMockGSM returns a client serving the Secret Manager calls from a fake seeded from seedPath,
+// and the Kubernetes calls from cl.
+func withMockGSM(seedPath string, cl client.Interface) (client.Interface, error) {
+	gsm, err := tests.LoadMockGSM(seedPath)
+	if err != nil {
+		return nil, err
+	}
+	return &tests.MockGSMClient{
+		Interface: cl,
+		GSM:       gsm,
+	}, nil
+}
@@ -0,0 +1,29 @@
+//go:build !mockgsm
+// +build !mockgsm
+
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+)
+
+// mockGSMAvailable is false in production builds. See mockgsm.go.
+const mockGSMAvailable = false
+
+func withMockGSM(seedPath string, cl client.Interface) (client.Interface, error) {
+	return nil, fmt.Errorf("Fake Secret Manager is only available in builds with the mockgsm tag")
+}
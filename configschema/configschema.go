@@ -0,0 +1,318 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configschema generates the JSON Schema of the configs of the secret sync controller and the secret rotator,
+// by reflecting over their yaml struct tags, so that the configs can be validated in CI with standard tooling.
+package configschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema version of the generated schemas.
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// durationPattern matches the duration strings parsed by time.ParseDuration, e.g. 1h30m.
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+// Enum is implemented by the string types of the config holding one of a fixed set of values,
+// e.g. the equality modes of the secret sync controller.
+type Enum interface {
+	Enum() []string
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	enumType     = reflect.TypeOf((*Enum)(nil)).Elem()
+)
+
+// Generate returns the JSON Schema of config, a config struct or pointer to one, titled title.
+// The properties are named by the yaml tags of the fields, and the fields not tagged omitempty are required.
+// Unknown properties are not allowed, so that misspelled fields are caught.
+func Generate(title string, config interface{}) map[string]interface{} {
+	schema := schemaOf(reflect.TypeOf(config))
+	schema["$schema"] = Draft
+	schema["title"] = title
+	return schema
+}
+
+// Write writes the indented JSON Schema of config, see Generate(), into w.
+func Write(w io.Writer, title string, config interface{}) error {
+	d, err := json.MarshalIndent(Generate(title, config), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(d))
+	return err
+}
+
+// schemaOf returns the schema of a value of type t.
+func schemaOf(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == durationType {
+		// yaml.v2 also accepts a number of nanoseconds
+		return map[string]interface{}{
+			"type":    []string{"string", "integer"},
+			"pattern": durationPattern,
+		}
+	}
+	if t.Implements(enumType) {
+		return map[string]interface{}{
+			"type": "string",
+			"enum": reflect.Zero(t).Interface().(Enum).Enum(),
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": schemaOf(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaOf(t.Elem()),
+		}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	}
+	// any value, e.g. an interface
+	return map[string]interface{}{}
+}
+
+// structSchema returns the schema of the yaml fields of struct type t.
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name, omitempty, inline := yamlName(field)
+		if name == "-" {
+			continue
+		}
+		if inline {
+			inlined := structSchema(field.Type)
+			for k, v := range inlined["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			required = append(required, inlined["required"].([]string)...)
+			continue
+		}
+		properties[name] = schemaOf(field.Type)
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// yamlName returns the name of field in yaml, and whether it is tagged omitempty or inline.
+// Like yaml.v2, an untagged field is named by its lowercased name.
+func yamlName(field reflect.StructField) (string, bool, bool) {
+	parts := strings.Split(field.Tag.Get("yaml"), ",")
+	name := parts[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	omitempty, inline := false, false
+	for _, flag := range parts[1:] {
+		switch flag {
+		case "omitempty":
+			omitempty = true
+		case "inline":
+			inline = true
+		}
+	}
+	return name, omitempty, inline
+}
+
+// Validate returns error if value, e.g. a config unmarshalled from yaml, does not conform to schema.
+// Only the keywords of the generated schemas are supported: type, properties, required, additionalProperties, items, enum and pattern.
+func Validate(schema map[string]interface{}, value interface{}) error {
+	return validate(schema, normalize(value), "")
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string) error {
+	if types, ok := schema["type"]; ok && !hasType(types, value) {
+		return fmt.Errorf("Invalid type of %s: expected %v, but got %T", pathOrRoot(path), types, value)
+	}
+
+	if enum, ok := schema["enum"].([]string); ok {
+		found := false
+		for _, allowed := range enum {
+			if value == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Invalid value of %s: %v should be one of %v", pathOrRoot(path), value, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+			return fmt.Errorf("Invalid value of %s: %q should match %s", pathOrRoot(path), v, pattern)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				err := validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]string); ok {
+			for _, name := range required {
+				if _, ok := v[name]; !ok {
+					return fmt.Errorf("Missing required property %s", joinPath(path, name))
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if property, ok := properties[k].(map[string]interface{}); ok {
+				err := validate(property, v[k], joinPath(path, k))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("Unknown property %s", joinPath(path, k))
+				}
+			case map[string]interface{}:
+				err := validate(additional, v[k], joinPath(path, k))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasType returns true if value is of the JSON type types, or one of types.
+func hasType(types interface{}, value interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return jsonType(value, t)
+	case []string:
+		for _, s := range t {
+			if jsonType(value, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonType(value interface{}, t string) bool {
+	switch value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case int, int64, uint64:
+		return t == "integer" || t == "number"
+	case float64:
+		return t == "number"
+	case string:
+		return t == "string"
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
+
+// normalize converts the maps unmarshalled by yaml.v2, keyed by interface{}, into maps keyed by string like JSON.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range v {
+			m[fmt.Sprint(k)] = normalize(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range v {
+			m[k] = normalize(item)
+		}
+		return m
+	case []interface{}:
+		s := []interface{}{}
+		for _, item := range v {
+			s = append(s, normalize(item))
+		}
+		return s
+	}
+	return value
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configschema
+
+import (
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	rotatorconfig "sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	syncconfig "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"strings"
+	"testing"
+)
+
+func TestValidateExamples(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		file   string
+		config interface{}
+	}{
+		{
+			name:   "Rotator demo config.",
+			file:   "../cmd/demo/rot-config.yaml",
+			config: &rotatorconfig.RotatedSecretConfig{},
+		},
+		{
+			name:   "Sync demo config.",
+			file:   "../cmd/demo/sync-config.yaml",
+			config: &syncconfig.SecretSyncConfig{},
+		},
+		{
+			name:   "Sync config of two specs.",
+			file:   "../cmd/demo/config.yaml",
+			config: &syncconfig.SecretSyncConfig{},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			d, err := ioutil.ReadFile(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var value interface{}
+			err = yaml.Unmarshal(d, &value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Validate(Generate(testname, tc.config), value)
+			if err != nil {
+				t.Errorf("Expected %s to conform to the schema, but got error: %s", tc.file, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		config      interface{}
+		yaml        string
+		expectError string
+	}{
+		{
+			name:   "Sync spec with mappings, transforms and write window. Should be valid.",
+			config: &syncconfig.SecretSyncConfig{},
+			yaml: `
+specs:
+- destination:
+    namespace: ns-a
+    secret: secret-a
+  mappings:
+  - source:
+      project: project-1
+      secret: secret-1
+    key: key-1
+  transforms: [trim, base64decode]
+  equalityMode: json-canonical
+  writeWindow:
+    cron: "0 2 * * *"
+    duration: 1h30m
+`,
+		},
+		{
+			name:   "Rotator spec with nanoseconds duration and nested fields. Should be valid.",
+			config: &rotatorconfig.RotatedSecretConfig{},
+			yaml: `
+paused: true
+specs:
+- project: project-1
+  secret: secret-1
+  type:
+    serviceAccountKey:
+      project: project-1
+      serviceAccount: service-foo
+  refreshStrategy:
+    interval: 3600000000000
+  preDeactivateProbe:
+    command: [/bin/true]
+`,
+		},
+		{
+			name:   "Misspelled field. Should be rejected.",
+			config: &syncconfig.SecretSyncConfig{},
+			yaml: `
+specs:
+- source:
+    project: project-1
+    secret: secret-1
+  destination:
+    namespace: ns-a
+    secret: secret-a
+    keys: key-a
+`,
+			expectError: "Unknown property specs[0].destination.keys",
+		},
+		{
+			name:   "Missing destination namespace. Should be rejected.",
+			config: &syncconfig.SecretSyncConfig{},
+			yaml: `
+specs:
+- source:
+    project: project-1
+    secret: secret-1
+  destination:
+    secret: secret-a
+    key: key-a
+`,
+			expectError: "Missing required property specs[0].destination.namespace",
+		},
+		{
+			name:   "Unknown equality mode. Should be rejected.",
+			config: &syncconfig.SecretSyncConfig{},
+			yaml: `
+specs:
+- source:
+    project: project-1
+    secret: secret-1
+  destination:
+    namespace: ns-a
+    secret: secret-a
+    key: key-a
+  equalityMode: fuzzy
+`,
+			expectError: "Invalid value of specs[0].equalityMode",
+		},
+		{
+			name:   "Malformed duration. Should be rejected.",
+			config: &rotatorconfig.RotatedSecretConfig{},
+			yaml: `
+specs:
+- project: project-1
+  secret: secret-1
+  type: {}
+  refreshStrategy:
+    interval: 1 day
+`,
+			expectError: "Invalid value of specs[0].refreshStrategy.interval",
+		},
+		{
+			name:   "Wrong type. Should be rejected.",
+			config: &rotatorconfig.RotatedSecretConfig{},
+			yaml: `
+paused: yes please
+specs: []
+`,
+			expectError: "Invalid type of paused",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			var value interface{}
+			err := yaml.Unmarshal([]byte(tc.yaml), &value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Validate(Generate(testname, tc.config), value)
+			if tc.expectError == "" && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if tc.expectError != "" && (err == nil || !strings.Contains(err.Error(), tc.expectError)) {
+				t.Errorf("Expected error containing %q, but got %v.", tc.expectError, err)
+			}
+		})
+	}
+}
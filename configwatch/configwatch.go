@@ -0,0 +1,171 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configwatch watches the config files mounted from a ConfigMap for the config agents
+// of the secret sync controller and the secret rotator.
+package configwatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	prow "k8s.io/test-infra/prow/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options tunes how quickly a change of the mounted config is picked up.
+type Options struct {
+	// PollInterval is the period of checking the config file for changes.
+	// The prow ConfigMap mount watcher, with its own cadence, is used if PollInterval <= 0.
+	PollInterval time.Duration
+	// Debounce delays the reload until the config file has not changed for Debounce,
+	// so that a burst of writes is reloaded once. Only used with PollInterval.
+	Debounce time.Duration
+}
+
+// Files returns the config files designated by path, in lexical order: the *.yaml and *.yml files of a directory,
+// the files matching a glob pattern, or path itself, so that a config can be split across the files of several ConfigMaps.
+// Returns error if a directory or a pattern designates no file.
+func Files(path string) ([]string, error) {
+	stat, err := os.Stat(path)
+	switch {
+	case err == nil && !stat.IsDir():
+		return []string{path}, nil
+	case err == nil:
+		yamls, err := filepath.Glob(filepath.Join(path, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		ymls, err := filepath.Glob(filepath.Join(path, "*.yml"))
+		if err != nil {
+			return nil, err
+		}
+		return regularFiles(path, append(yamls, ymls...))
+	case os.IsNotExist(err) && strings.ContainsAny(path, "*?["):
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		return regularFiles(path, matches)
+	}
+	return nil, err
+}
+
+// regularFiles returns the sorted paths that are not directories, or error if there is none.
+func regularFiles(path string, paths []string) ([]string, error) {
+	files := []string{}
+	for _, p := range paths {
+		// the timestamped directories of a ConfigMap mount start with "..", and are never config files
+		if strings.HasPrefix(filepath.Base(p), ".") {
+			continue
+		}
+		stat, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			files = append(files, p)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config file found at %s", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Watch returns a function calling eventFunc on each change of the config files at path until its context is done,
+// and errFunc on each failure to check the files or to reload them. path is resolved by Files() on each check,
+// so that files added to or removed from a directory are picked up.
+func Watch(path string, opts Options, eventFunc func() error, errFunc func(error, string)) (func(ctx context.Context), error) {
+	if opts.PollInterval <= 0 {
+		return prow.GetCMMountWatcher(eventFunc, errFunc, watchedDir(path))
+	}
+
+	// the current content is the one already loaded by the caller
+	last, err := checksum(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(opts.PollInterval)
+		defer ticker.Stop()
+
+		pending := false
+		var changedAt time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				sum, err := checksum(path)
+				if err != nil {
+					errFunc(err, "Fail to check config file "+path)
+					continue
+				}
+				if sum != last {
+					last = sum
+					pending = true
+					changedAt = now
+				}
+				if !pending || now.Sub(changedAt) < opts.Debounce {
+					continue
+				}
+
+				pending = false
+				err = eventFunc()
+				if err != nil {
+					errFunc(err, "Fail to reload config file "+path)
+				}
+			}
+		}
+	}, nil
+}
+
+// watchedDir returns the directory holding the config files at path, watched by the ConfigMap mount watcher.
+func watchedDir(path string) string {
+	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+		return path
+	}
+	return filepath.Dir(path)
+}
+
+// checksum returns the sha256 of the names and the contents of the config files at path.
+// The content is compared rather than the modification time, which the atomic symlink swap of a ConfigMap update does not bump.
+func checksum(path string) ([sha256.Size]byte, error) {
+	files, err := Files(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		// separate the names and contents by their lengths, so that different files never collide
+		fmt.Fprintf(hash, "%d:%s:%d:", len(file), file, len(data))
+		hash.Write(data)
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
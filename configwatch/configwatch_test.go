@@ -0,0 +1,260 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package configwatch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reloadRecorder records the time of each reload.
+type reloadRecorder struct {
+	mutex   sync.Mutex
+	reloads []time.Time
+}
+
+func (r *reloadRecorder) reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reloads = append(r.reloads, time.Now())
+	return nil
+}
+
+func (r *reloadRecorder) get() []time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]time.Time{}, r.reloads...)
+}
+
+func TestWatchPoll(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		opts          Options
+		writes        int
+		expectReloads int
+		maxLatency    time.Duration
+	}{
+		{
+			name:          "Short poll interval. Should pick up the change within a few polls.",
+			opts:          Options{PollInterval: 10 * time.Millisecond},
+			writes:        1,
+			expectReloads: 1,
+			maxLatency:    500 * time.Millisecond,
+		},
+		{
+			name:          "Burst of writes with debounce. Should reload once, after the debounce.",
+			opts:          Options{PollInterval: 10 * time.Millisecond, Debounce: 200 * time.Millisecond},
+			writes:        3,
+			expectReloads: 1,
+			maxLatency:    time.Second,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "configwatch")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "config.yaml")
+			err = ioutil.WriteFile(path, []byte("specs: []"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := &reloadRecorder{}
+			runFunc, err := Watch(path, tc.opts, recorder.reload, func(err error, msg string) {
+				t.Errorf("Unexpected error: %s: %s", msg, err)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				runFunc(ctx)
+				close(done)
+			}()
+			// stop polling before the dir is removed
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			// the writes land within a few polls of each other, inside the debounce
+			var written time.Time
+			for i := 0; i < tc.writes; i++ {
+				err := ioutil.WriteFile(path, []byte("specs: ["+string(rune('a'+i))+"]"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				written = time.Now()
+				time.Sleep(30 * time.Millisecond)
+			}
+
+			deadline := time.Now().Add(tc.maxLatency)
+			for len(recorder.get()) == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			// leave time for any extra reload
+			time.Sleep(3 * tc.opts.PollInterval)
+
+			reloads := recorder.get()
+			if len(reloads) != tc.expectReloads {
+				t.Fatalf("Expected %d reloads, but got %d.", tc.expectReloads, len(reloads))
+			}
+			latency := reloads[0].Sub(written)
+			if latency > tc.maxLatency {
+				t.Errorf("Expected the change picked up within %s, but took %s.", tc.maxLatency, latency)
+			}
+			if latency < tc.opts.Debounce-tc.opts.PollInterval {
+				t.Errorf("Expected the reload debounced for %s, but took %s.", tc.opts.Debounce, latency)
+			}
+		})
+	}
+}
+
+func TestWatchMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = Watch(filepath.Join(dir, "missing.yaml"), Options{PollInterval: time.Second}, func() error { return nil }, func(error, string) {})
+	if err == nil {
+		t.Errorf("Expected error but got nil.")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"b.yaml", "a.yml", ".hidden.yaml", "README.md"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte("specs: []"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.Mkdir(filepath.Join(dir, "sub.yaml"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testcases = []struct {
+		name        string
+		path        string
+		expectFiles []string
+		expectErr   bool
+	}{
+		{
+			name:        "Single file. Should return the file.",
+			path:        filepath.Join(dir, "README.md"),
+			expectFiles: []string{filepath.Join(dir, "README.md")},
+		},
+		{
+			name:        "Dir. Should return the sorted yaml files, skipping hidden files and dirs.",
+			path:        dir,
+			expectFiles: []string{filepath.Join(dir, "a.yml"), filepath.Join(dir, "b.yaml")},
+		},
+		{
+			name:        "Glob pattern. Should return the sorted matching files.",
+			path:        filepath.Join(dir, "*.y*ml"),
+			expectFiles: []string{filepath.Join(dir, "a.yml"), filepath.Join(dir, "b.yaml")},
+		},
+		{
+			name:      "Glob pattern matching nothing. Should return error.",
+			path:      filepath.Join(dir, "*.json"),
+			expectErr: true,
+		},
+		{
+			name:      "Missing file. Should return error.",
+			path:      filepath.Join(dir, "missing.yaml"),
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			files, err := Files(tc.path)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Failed to receive expected error.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(files, tc.expectFiles) {
+				t.Errorf("Expected %v, but got %v.", tc.expectFiles, files)
+			}
+		})
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte("specs: []"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &reloadRecorder{}
+	runFunc, err := Watch(dir, Options{PollInterval: 10 * time.Millisecond}, recorder.reload, func(err error, msg string) {
+		t.Errorf("Unexpected error: %s: %s", msg, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runFunc(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// a new file in the dir is a change of the merged config
+	err = ioutil.WriteFile(filepath.Join(dir, "b.yaml"), []byte("specs: []"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(recorder.get()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(recorder.get()) == 0 {
+		t.Errorf("Expected the new file picked up, but got no reload.")
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package exitcode defines the exit codes shared by the commands of the secret sync controller, the secret rotator
+// and their tools, so that wrappers and CI jobs can tell a bad config from a broken environment.
+package exitcode
+
+import (
+	"fmt"
+	"k8s.io/klog"
+	"os"
+)
+
+const (
+	// OK is returned once the command succeeds.
+	OK = 0
+	// ConfigError is returned if the flags are invalid, or the config cannot be loaded or validated.
+	ConfigError = 1
+	// SetupError is returned if the command cannot set up its clients or servers, e.g. missing credentials or a busy port.
+	SetupError = 2
+	// Failure is returned if a one-shot operation ran and failed, e.g. a decommission, or a report finding secrets out of sync.
+	Failure = 3
+)
+
+// exit is replaced in tests.
+var exit = os.Exit
+
+// Fatal logs args at the error level, flushes the logs and exits with code.
+func Fatal(code int, args ...interface{}) {
+	klog.ErrorDepth(1, args...)
+	klog.Flush()
+	exit(code)
+}
+
+// Fatalf logs the formatted message at the error level, flushes the logs and exits with code.
+func Fatalf(code int, format string, args ...interface{}) {
+	klog.ErrorDepth(1, fmt.Sprintf(format, args...))
+	klog.Flush()
+	exit(code)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exitcode
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestFatal(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		fatal      func()
+		expectCode int
+	}{
+		{
+			name:       "Config error. Should exit with 1.",
+			fatal:      func() { Fatalf(ConfigError, "Fail to load config: %s", fmt.Errorf("no such file")) },
+			expectCode: 1,
+		},
+		{
+			name:       "Setup error. Should exit with 2.",
+			fatal:      func() { Fatal(SetupError, fmt.Errorf("no credentials")) },
+			expectCode: 2,
+		},
+		{
+			name:       "Failed operation. Should exit with 3.",
+			fatal:      func() { Fatalf(Failure, "Fail to decommission: %s", fmt.Errorf("permission denied")) },
+			expectCode: 3,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			code := -1
+			exit = func(c int) { code = c }
+			defer func() { exit = os.Exit }()
+
+			tc.fatal()
+			if code != tc.expectCode {
+				t.Errorf("Expected exit code %d, but got %d.", tc.expectCode, code)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"flag"
 	"fmt"
 	"k8s.io/klog"
+	"os"
 	"sigs.k8s.io/k8s-gsm-tools/experiment/svc-consumer/keys"
 	"sigs.k8s.io/k8s-gsm-tools/experiment/svc-consumer/logger"
 	"time"
@@ -28,12 +29,24 @@ type options struct {
 	outputPath string
 	period     int64
 	gsmProject string
+	layout     string
+	maxKeys    int
+	maxKeyAge  int64
 }
 
 func (o *options) Validate() error {
 	if o.mountPath == "" {
 		return fmt.Errorf("required flag --mount-path was unset")
 	}
+	if layout := keys.Layout(o.layout); layout != keys.FlatLayout && layout != keys.VersionedLayout {
+		return fmt.Errorf("flag --layout should be either empty or %q", keys.VersionedLayout)
+	}
+	if o.maxKeys < 0 {
+		return fmt.Errorf("flag --max-keys should not be negative")
+	}
+	if o.maxKeyAge < 0 {
+		return fmt.Errorf("flag --max-key-age should not be negative")
+	}
 	return nil
 }
 
@@ -43,6 +56,9 @@ func gatherOptions() options {
 	flag.StringVar(&o.outputPath, "output-path", "consumer_keys", "Output path for svc keys.")
 	flag.StringVar(&o.gsmProject, "gsm-project", "", "Secret Manager project.")
 	flag.Int64Var(&o.period, "period", 3, "Period in seconds.")
+	flag.StringVar(&o.layout, "layout", "", "Layout of the svc keys under the output path. Flat key_<n> files if empty, or \"versioned\" for versions/<n>/key.json with a current symlink to the newest key.")
+	flag.IntVar(&o.maxKeys, "max-keys", 0, "Maximum number of svc key versions retained under the output path, the older ones being pruned. Unlimited if 0.")
+	flag.Int64Var(&o.maxKeyAge, "max-key-age", 0, "Maximum age in seconds of the svc key versions retained under the output path. The current key is always retained. Unlimited if 0.")
 	flag.Parse()
 	return o
 }
@@ -54,15 +70,24 @@ func main() {
 	err := o.Validate()
 	if err != nil {
 		klog.Errorf("Invalid options: %s", err)
+		klog.Flush()
+		// the config error exit code of the root module commands, see sigs.k8s.io/k8s-gsm-tools/exitcode
+		os.Exit(1)
 	}
 
 	// prepare keys agent
 	keysAgent := &keys.Agent{
-		Dir: o.outputPath,
+		Dir:         o.outputPath,
+		Layout:      keys.Layout(o.layout),
+		MaxVersions: o.maxKeys,
+		MaxAge:      time.Duration(o.maxKeyAge) * time.Second,
 	}
 	runFunc, err := keysAgent.WatchMounted(o.mountPath)
 	if err != nil {
-		klog.Fatal(err)
+		klog.Error(err)
+		klog.Flush()
+		// the setup error exit code of the root module commands, see sigs.k8s.io/k8s-gsm-tools/exitcode
+		os.Exit(2)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -26,12 +26,39 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 )
 
+// Layout specifies how the versions of the keyfile are organized under Agent.Dir.
+type Layout string
+
+const (
+	// FlatLayout stores the nth version of the keyfile as Dir/key_<n>.
+	FlatLayout Layout = ""
+	// VersionedLayout stores the nth version of the keyfile as Dir/versions/<n>/key.json,
+	// and maintains the symlink Dir/current pointing to the newest version.
+	VersionedLayout Layout = "versioned"
+)
+
+// currentLink is the name of the symlink to the newest version in VersionedLayout.
+const currentLink = "current"
+
 type Agent struct {
 	mutex sync.RWMutex
 	keys  []string
-	Dir   string
+	// added holds the time each of keys was observed.
+	added []time.Time
+	// version is the number of the newest version of the keyfile, which keeps counting when older versions are pruned.
+	version int
+	Dir     string
+	Layout  Layout
+	// MaxVersions is the maximum number of versions of the keyfile retained under Dir, unlimited if 0.
+	MaxVersions int
+	// MaxAge is the maximum time a version of the keyfile is retained under Dir after being observed, unlimited if 0.
+	// The newest version, which is the currently mounted one, is always retained.
+	MaxAge time.Duration
+	// now is time.Now, overridden in tests.
+	now func() time.Time
 }
 
 // WatchMounted will begin watching the secret file at the provided mountPath.
@@ -78,6 +105,7 @@ func (a *Agent) GetKeys() []string {
 // AddNewKey copies the current keyfile in mountPath into Agent.Dir,
 // where Agent.Dir is the desired directory for storing all versions of keyfile that ever existed.
 // renames the copied keyfile according to the version number and appends the new filename into Agent.keys
+// then prunes the older versions according to Agent.MaxVersions and Agent.MaxAge.
 func (a *Agent) AddNewKey(mountPath string) error {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
@@ -98,9 +126,9 @@ func (a *Agent) AddNewKey(mountPath string) error {
 
 	defer source.Close()
 
-	os.Mkdir(a.Dir, 0755)
+	copy := a.keyPath(a.version + 1)
+	os.MkdirAll(filepath.Dir(copy), 0755)
 
-	copy := filepath.Join(a.Dir, "key_"+strconv.Itoa(len(a.keys)+1))
 	destination, err := os.Create(copy)
 	if err != nil {
 		return err
@@ -113,7 +141,95 @@ func (a *Agent) AddNewKey(mountPath string) error {
 		return err
 	}
 
+	if a.Layout == VersionedLayout {
+		err = a.updateCurrent(copy)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.version++
 	a.keys = append(a.keys, copy)
+	a.added = append(a.added, a.clock())
+
+	a.prune()
 
 	return nil
 }
+
+// clock returns the current time.
+func (a *Agent) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
+
+// prune removes the versions of the keyfile beyond Agent.MaxVersions or older than Agent.MaxAge,
+// never the newest one. It must be called with the mutex held.
+// Versions failing to be removed are logged and retained, to be retried by the next prune.
+func (a *Agent) prune() {
+	if a.MaxVersions <= 0 && a.MaxAge <= 0 {
+		return
+	}
+
+	now := a.clock()
+	newest := len(a.keys) - 1
+	// copied rather than resliced, so that the slices returned by GetKeys are left intact
+	keys := []string{}
+	added := []time.Time{}
+	for i, key := range a.keys {
+		expired := a.MaxVersions > 0 && newest-i >= a.MaxVersions
+		expired = expired || a.MaxAge > 0 && now.Sub(a.added[i]) > a.MaxAge
+		if i != newest && expired {
+			err := a.removeKey(key)
+			if err == nil {
+				continue
+			}
+			klog.Errorf("Fail to prune %s: %s", key, err)
+		}
+		keys = append(keys, key)
+		added = append(added, a.added[i])
+	}
+	a.keys = keys
+	a.added = added
+}
+
+// removeKey removes the keyfile at path, along with its version directory in VersionedLayout.
+func (a *Agent) removeKey(path string) error {
+	if a.Layout == VersionedLayout {
+		return os.RemoveAll(filepath.Dir(path))
+	}
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// keyPath returns the path of the nth version of the keyfile according to Agent.Layout.
+func (a *Agent) keyPath(n int) string {
+	if a.Layout == VersionedLayout {
+		return filepath.Join(a.Dir, "versions", strconv.Itoa(n), "key.json")
+	}
+	return filepath.Join(a.Dir, "key_"+strconv.Itoa(n))
+}
+
+// updateCurrent points the symlink Agent.Dir/current to the keyfile at path.
+// The symlink is replaced atomically by renaming a temporary symlink over it,
+// so that readers of current never observe it missing.
+func (a *Agent) updateCurrent(path string) error {
+	target, err := filepath.Rel(a.Dir, path)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(a.Dir, "."+currentLink+".tmp")
+	os.Remove(tmp)
+	err = os.Symlink(target, tmp)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(a.Dir, currentLink))
+}
@@ -0,0 +1,343 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddNewKeyLayout(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		layout       Layout
+		expectKeys   []string
+		expectLinked bool
+	}{
+		{
+			name:         "Flat layout. Should write key_<n> files without symlink.",
+			layout:       FlatLayout,
+			expectKeys:   []string{"key_1", "key_2"},
+			expectLinked: false,
+		},
+		{
+			name:         "Versioned layout. Should write versions/<n>/key.json and link current to the newest.",
+			layout:       VersionedLayout,
+			expectKeys:   []string{"versions/1/key.json", "versions/2/key.json"},
+			expectLinked: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "keys")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			mountPath := filepath.Join(tmp, "mounted")
+			agent := &Agent{
+				Dir:    filepath.Join(tmp, "out"),
+				Layout: tc.layout,
+			}
+
+			for i := range tc.expectKeys {
+				value := fmt.Sprintf("key-%d", i+1)
+				err = ioutil.WriteFile(mountPath, []byte(value), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = agent.AddNewKey(mountPath)
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+
+				current, err := ioutil.ReadFile(filepath.Join(agent.Dir, currentLink))
+				if !tc.expectLinked {
+					if !os.IsNotExist(err) {
+						t.Errorf("Expected no %s symlink, but got error %v.", currentLink, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Fail to read %s: %s", currentLink, err)
+				}
+				if string(current) != value {
+					t.Errorf("Expected %s to be %s, but got %s.", currentLink, value, current)
+				}
+			}
+
+			keys := agent.GetKeys()
+			if len(keys) != len(tc.expectKeys) {
+				t.Fatalf("Expected %d keys, but got %v.", len(tc.expectKeys), keys)
+			}
+			for i, key := range keys {
+				expected := filepath.Join(agent.Dir, tc.expectKeys[i])
+				if key != expected {
+					t.Errorf("Expected key %s, but got %s.", expected, key)
+				}
+				data, err := ioutil.ReadFile(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != fmt.Sprintf("key-%d", i+1) {
+					t.Errorf("Expected key-%d in %s, but got %s.", i+1, key, data)
+				}
+			}
+		})
+	}
+}
+
+func TestCurrentSymlinkAtomic(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	mountPath := filepath.Join(tmp, "mounted")
+	agent := &Agent{
+		Dir:    filepath.Join(tmp, "out"),
+		Layout: VersionedLayout,
+	}
+	err = ioutil.WriteFile(mountPath, []byte("key"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = agent.AddNewKey(mountPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// readers of current should never observe it missing while new keys arrive
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_, err := ioutil.ReadFile(filepath.Join(agent.Dir, currentLink))
+			if err != nil {
+				t.Errorf("Fail to read %s during update: %s", currentLink, err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		err = agent.AddNewKey(mountPath)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	target, err := os.Readlink(filepath.Join(agent.Dir, currentLink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != filepath.Join("versions", "51", "key.json") {
+		t.Errorf("Expected %s to point to the newest version, but got %s.", currentLink, target)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	var testcases = []struct {
+		name           string
+		layout         Layout
+		maxVersions    int
+		maxAge         time.Duration
+		expectVersions []int
+	}{
+		{
+			name:           "No retention. Should keep all versions.",
+			layout:         FlatLayout,
+			expectVersions: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		},
+		{
+			name:           "Flat layout with max versions. Should keep the newest versions.",
+			layout:         FlatLayout,
+			maxVersions:    3,
+			expectVersions: []int{8, 9, 10},
+		},
+		{
+			name:           "Versioned layout with max versions. Should remove the version directories.",
+			layout:         VersionedLayout,
+			maxVersions:    3,
+			expectVersions: []int{8, 9, 10},
+		},
+		{
+			name:           "Max age. Should keep the versions observed within max age.",
+			layout:         FlatLayout,
+			maxAge:         25 * time.Minute,
+			expectVersions: []int{8, 9, 10},
+		},
+		{
+			name:           "Max age shorter than the update interval. Should always keep the current version.",
+			layout:         VersionedLayout,
+			maxAge:         5 * time.Minute,
+			expectVersions: []int{10},
+		},
+		{
+			name:           "Both max versions and max age. Should apply the stricter.",
+			layout:         FlatLayout,
+			maxVersions:    2,
+			maxAge:         25 * time.Minute,
+			expectVersions: []int{9, 10},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "keys")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			// a new version is observed every 10 minutes
+			now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			mountPath := filepath.Join(tmp, "mounted")
+			agent := &Agent{
+				Dir:         filepath.Join(tmp, "out"),
+				Layout:      tc.layout,
+				MaxVersions: tc.maxVersions,
+				MaxAge:      tc.maxAge,
+				now:         func() time.Time { return now },
+			}
+
+			for i := 1; i <= 10; i++ {
+				err = ioutil.WriteFile(mountPath, []byte(fmt.Sprintf("key-%d", i)), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = agent.AddNewKey(mountPath)
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+				now = now.Add(10 * time.Minute)
+			}
+
+			keys := agent.GetKeys()
+			if len(keys) != len(tc.expectVersions) {
+				t.Fatalf("Expected versions %v, but got %v.", tc.expectVersions, keys)
+			}
+			retained := map[string]bool{}
+			for i, key := range keys {
+				expected := agent.keyPath(tc.expectVersions[i])
+				if key != expected {
+					t.Errorf("Expected key %s, but got %s.", expected, key)
+				}
+				retained[key] = true
+			}
+
+			for i := 1; i <= 10; i++ {
+				path := agent.keyPath(i)
+				data, err := ioutil.ReadFile(path)
+				if !retained[path] {
+					if !os.IsNotExist(err) {
+						t.Errorf("Expected %s to be pruned, but got error %v.", path, err)
+					}
+					if tc.layout == VersionedLayout {
+						if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+							t.Errorf("Expected %s to be pruned, but got error %v.", filepath.Dir(path), err)
+						}
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != "key-"+strconv.Itoa(i) {
+					t.Errorf("Expected key-%d in %s, but got %s.", i, path, data)
+				}
+			}
+
+			if tc.layout == VersionedLayout {
+				current, err := ioutil.ReadFile(filepath.Join(agent.Dir, currentLink))
+				if err != nil {
+					t.Fatalf("Fail to read %s: %s", currentLink, err)
+				}
+				if string(current) != "key-10" {
+					t.Errorf("Expected %s to be key-10, but got %s.", currentLink, current)
+				}
+			}
+		})
+	}
+}
+
+func TestRetentionConcurrent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	mountPath := filepath.Join(tmp, "mounted")
+	err = ioutil.WriteFile(mountPath, []byte("key"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &Agent{
+		Dir:         filepath.Join(tmp, "out"),
+		Layout:      VersionedLayout,
+		MaxVersions: 2,
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				err := agent.AddNewKey(mountPath)
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				// the current version is never pruned under a reader
+				_, err = ioutil.ReadFile(filepath.Join(agent.Dir, currentLink))
+				if err != nil {
+					t.Errorf("Fail to read %s: %s", currentLink, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	keys := agent.GetKeys()
+	expected := []string{agent.keyPath(49), agent.keyPath(50)}
+	if len(keys) != len(expected) || keys[0] != expected[0] || keys[1] != expected[1] {
+		t.Errorf("Expected keys %v, but got %v.", expected, keys)
+	}
+	versions, err := ioutil.ReadDir(filepath.Join(agent.Dir, "versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(expected) {
+		t.Errorf("Expected %d version directories, but got %d.", len(expected), len(versions))
+	}
+}
@@ -32,23 +32,23 @@ type Logger struct {
 
 // Start starts the logger in continuous mode.
 // stops when stop sinal is received from stopChan.
+// Cycles overrunning Period are logged, and the ticks missed meanwhile are dropped.
 func (l *Logger) Start(stopChan <-chan struct{}) error {
-	runChan := make(chan struct{})
+	ticker := time.NewTicker(l.Period)
+	defer ticker.Stop()
 
-	go func() {
-		for {
-			runChan <- struct{}{}
-			time.Sleep(l.Period)
+	for {
+		start := time.Now()
+		l.RunOnce()
+		if elapsed := time.Since(start); elapsed > l.Period {
+			klog.Warningf("Logging cycle took %s, overrunning the period of %s. Ticks dropped.", elapsed, l.Period)
 		}
-	}()
 
-	for {
 		select {
 		case <-stopChan:
 			klog.V(2).Info("Stop signal received. Quitting...")
 			return nil
-		case <-runChan:
-			l.RunOnce()
+		case <-ticker.C:
 		}
 	}
 }
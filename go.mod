@@ -11,8 +11,11 @@ replace (
 
 require (
 	cloud.google.com/go v0.60.0
+	contrib.go.opencensus.io/exporter/ocagent v0.7.0
 	github.com/golang/protobuf v1.4.2
+	github.com/prometheus/client_golang v1.7.1
 	github.com/sirupsen/logrus v1.6.0
+	go.opencensus.io v0.22.4
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	gonum.org/v1/plot v0.7.0
 	google.golang.org/api v0.28.0
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gsmoption builds the Secret Manager client options shared by the secret sync controller and the secret rotator.
+package gsmoption
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+// FeatureSet pins the Secret Manager features used by the clients,
+// e.g. to run the tools against a Secret Manager emulator lacking some of them.
+// Client features depending on newer API fields should be gated on it.
+type FeatureSet string
+
+const (
+	// FeatureSetFull uses all features of the Secret Manager API. It is the default.
+	FeatureSetFull FeatureSet = "full"
+	// FeatureSetEmulator connects to an emulator endpoint over plaintext gRPC without authentication,
+	// and refuses regional endpoints, which emulators do not serve.
+	FeatureSetEmulator FeatureSet = "emulator"
+)
+
+// regionalEndpointSuffix is the host suffix of the regional endpoints, e.g. secretmanager.us-east1.rep.googleapis.com.
+const regionalEndpointSuffix = ".rep.googleapis.com"
+
+// ParseFeatureSet returns the feature set named s, FeatureSetFull if s is empty.
+// Returns error if s is not a known feature set.
+func ParseFeatureSet(s string) (FeatureSet, error) {
+	switch fs := FeatureSet(s); fs {
+	case "":
+		return FeatureSetFull, nil
+	case FeatureSetFull, FeatureSetEmulator:
+		return fs, nil
+	}
+	return "", fmt.Errorf("Unknown feature set %q, should be one of %s, %s", s, FeatureSetFull, FeatureSetEmulator)
+}
+
+// ValidateEndpoint returns error if endpoint is not in format <host>:<port>.
+func ValidateEndpoint(endpoint string) error {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("Invalid Secret Manager endpoint %s: %s", endpoint, err)
+	}
+	if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+		return fmt.Errorf("Invalid Secret Manager endpoint %s: host %s", endpoint, strings.Join(errs, ", "))
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("Invalid Secret Manager endpoint %s: port %s is not in range 1-65535", endpoint, port)
+	}
+	return nil
+}
+
+// ClientOptions returns the client options connecting to endpoint with the features of fs.
+// With FeatureSetFull, endpoint may be a regional endpoint, e.g. secretmanager.us-east1.rep.googleapis.com:443,
+// or empty to use the global endpoint.
+// Returns error if the endpoint is invalid or not supported by fs.
+func ClientOptions(endpoint string, fs FeatureSet) ([]option.ClientOption, error) {
+	if endpoint != "" {
+		err := ValidateEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch fs {
+	case FeatureSetFull:
+		if endpoint == "" {
+			return nil, nil
+		}
+		return []option.ClientOption{option.WithEndpoint(endpoint)}, nil
+	case FeatureSetEmulator:
+		if endpoint == "" {
+			return nil, fmt.Errorf("Feature set %s requires the endpoint of the emulator", fs)
+		}
+		host, _, _ := net.SplitHostPort(endpoint)
+		if strings.HasSuffix(host, regionalEndpointSuffix) {
+			return nil, fmt.Errorf("Feature set %s does not support regional endpoint %s", fs, endpoint)
+		}
+		return []option.ClientOption{
+			option.WithEndpoint(endpoint),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithInsecure()),
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown feature set %q", fs)
+}
+
+// FlagClientOptions returns the client options of the --gsm-endpoint and --gsm-feature-set flags of the commands, see ClientOptions().
+// Returns error naming the invalid flag.
+func FlagClientOptions(endpoint, featureSet string) ([]option.ClientOption, error) {
+	fs, err := ParseFeatureSet(featureSet)
+	if err != nil {
+		return nil, fmt.Errorf("flag --gsm-feature-set: %s", err)
+	}
+	opts, err := ClientOptions(endpoint, fs)
+	if err != nil {
+		return nil, fmt.Errorf("flag --gsm-endpoint: %s", err)
+	}
+	return opts, nil
+}
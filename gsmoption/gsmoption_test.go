@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gsmoption
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+func TestParseFeatureSet(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		value     string
+		expected  FeatureSet
+		expectErr bool
+	}{
+		{
+			name:     "Unset. Should default to all features.",
+			value:    "",
+			expected: FeatureSetFull,
+		},
+		{
+			name:     "Emulator.",
+			value:    "emulator",
+			expected: FeatureSetEmulator,
+		},
+		{
+			name:      "Unknown feature set.",
+			value:     "v1beta1",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			actual, err := ParseFeatureSet(tc.value)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got %s.", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tc.expected {
+				t.Errorf("Expected %s, got %s.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		endpoint   string
+		featureSet FeatureSet
+		expected   []option.ClientOption
+		expectErr  bool
+	}{
+		{
+			name:       "Global endpoint.",
+			endpoint:   "",
+			featureSet: FeatureSetFull,
+			expected:   nil,
+		},
+		{
+			name:       "Regional endpoint.",
+			endpoint:   "secretmanager.us-east1.rep.googleapis.com:443",
+			featureSet: FeatureSetFull,
+			expected:   []option.ClientOption{option.WithEndpoint("secretmanager.us-east1.rep.googleapis.com:443")},
+		},
+		{
+			name:       "Missing <port>.",
+			endpoint:   "secretmanager.us-east1.rep.googleapis.com",
+			featureSet: FeatureSetFull,
+			expectErr:  true,
+		},
+		{
+			name:       "Invalid <port>.",
+			endpoint:   "secretmanager.us-east1.rep.googleapis.com:https",
+			featureSet: FeatureSetFull,
+			expectErr:  true,
+		},
+		{
+			name:       "URL scheme.",
+			endpoint:   "https://secretmanager.us-east1.rep.googleapis.com:443",
+			featureSet: FeatureSetFull,
+			expectErr:  true,
+		},
+		{
+			name:       "Invalid <host>.",
+			endpoint:   "secretmanager_us-east1:443",
+			featureSet: FeatureSetFull,
+			expectErr:  true,
+		},
+		{
+			name:       "Emulator endpoint.",
+			endpoint:   "localhost:9090",
+			featureSet: FeatureSetEmulator,
+			expected: []option.ClientOption{
+				option.WithEndpoint("localhost:9090"),
+				option.WithoutAuthentication(),
+				option.WithGRPCDialOption(grpc.WithInsecure()),
+			},
+		},
+		{
+			name:       "Emulator without endpoint.",
+			endpoint:   "",
+			featureSet: FeatureSetEmulator,
+			expectErr:  true,
+		},
+		{
+			name:       "Emulator with regional endpoint.",
+			endpoint:   "secretmanager.us-east1.rep.googleapis.com:443",
+			featureSet: FeatureSetEmulator,
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			actual, err := ClientOptions(tc.endpoint, tc.featureSet)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error for endpoint %s.", tc.endpoint)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected client options %v, got %v.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFlagClientOptions(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		endpoint   string
+		featureSet string
+		expectErr  string
+	}{
+		{
+			name:       "Default flags.",
+			endpoint:   "",
+			featureSet: "",
+			expectErr:  "",
+		},
+		{
+			name:       "Unknown feature set. Should name --gsm-feature-set.",
+			endpoint:   "",
+			featureSet: "partial",
+			expectErr:  "flag --gsm-feature-set",
+		},
+		{
+			name:       "Invalid endpoint. Should name --gsm-endpoint.",
+			endpoint:   "secretmanager.googleapis.com",
+			featureSet: string(FeatureSetFull),
+			expectErr:  "flag --gsm-endpoint",
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			_, err := FlagClientOptions(tc.endpoint, tc.featureSet)
+			if tc.expectErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.expectErr) {
+				t.Errorf("Expected error naming %s, but got %v.", tc.expectErr, err)
+			}
+		})
+	}
+}
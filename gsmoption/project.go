@@ -0,0 +1,50 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gsmoption
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// projectIDPattern matches the project ids: 6 to 30 lowercase letters, digits or hyphens,
+	// starting with a letter and not ending with a hyphen, optionally scoped by a domain, e.g. example.com:my-project.
+	projectIDPattern = regexp.MustCompile(`^([a-z0-9][a-z0-9.-]*[a-z0-9]:)?[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+	// projectNumberPattern matches the project numbers.
+	projectNumberPattern = regexp.MustCompile(`^[1-9][0-9]{0,19}$`)
+)
+
+// ValidateProject returns error if project is neither a project id nor a project number,
+// as accepted by the Secret Manager resource names projects/<project>/secrets/<secret>.
+func ValidateProject(project string) error {
+	switch {
+	case project == "":
+		return fmt.Errorf("Empty project")
+	case strings.HasPrefix(project, "projects/"):
+		return fmt.Errorf("Invalid project %q: should be the project id or number, without the projects/ prefix", project)
+	case strings.ContainsAny(project, "/ \t\n"):
+		return fmt.Errorf("Invalid project %q: should not contain slashes or white spaces", project)
+	case IsProjectNumber(project), projectIDPattern.MatchString(project):
+		return nil
+	}
+	return fmt.Errorf("Invalid project %q: should be a project number, or a project id of 6 to 30 lowercase letters, digits or hyphens, starting with a letter", project)
+}
+
+// IsProjectNumber returns true if project is a project number rather than a project id, e.g. in the names of Pub/Sub notifications.
+// A project number cannot be mapped to its project id without a lookup in the Resource Manager API.
+func IsProjectNumber(project string) bool {
+	return projectNumberPattern.MatchString(project)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gsmoption
+
+import (
+	"testing"
+)
+
+func TestValidateProject(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		project      string
+		expectErr    bool
+		expectNumber bool
+	}{
+		{
+			name:    "Project id. Should be valid.",
+			project: "my-project-1",
+		},
+		{
+			name:    "Domain-scoped project id. Should be valid.",
+			project: "example.com:my-project",
+		},
+		{
+			name:         "Project number. Should be valid.",
+			project:      "123456789012",
+			expectNumber: true,
+		},
+		{
+			name:      "Empty project. Should fail.",
+			project:   "",
+			expectErr: true,
+		},
+		{
+			name:      "Resource name with the projects/ prefix. Should fail.",
+			project:   "projects/my-project",
+			expectErr: true,
+		},
+		{
+			name:      "Project with a slash. Should fail.",
+			project:   "my-project/secrets/a",
+			expectErr: true,
+		},
+		{
+			name:      "Project with a space. Should fail.",
+			project:   "my project",
+			expectErr: true,
+		},
+		{
+			name:      "Uppercase project id. Should fail.",
+			project:   "My-Project",
+			expectErr: true,
+		},
+		{
+			name:      "Project id starting with a digit. Should fail.",
+			project:   "1-my-project",
+			expectErr: true,
+		},
+		{
+			name:      "Project id ending with a hyphen. Should fail.",
+			project:   "my-project-",
+			expectErr: true,
+		},
+		{
+			name:      "Too short project id. Should fail.",
+			project:   "proj",
+			expectErr: true,
+		},
+		{
+			name:      "Project number with a leading zero. Should fail.",
+			project:   "0123456",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			err := ValidateProject(tc.project)
+			if tc.expectErr && err == nil {
+				t.Errorf("Expected error but got nil.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if IsProjectNumber(tc.project) != tc.expectNumber {
+				t.Errorf("Expected project number %v, but got %v.", tc.expectNumber, IsProjectNumber(tc.project))
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gsmoption
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"k8s.io/klog"
+	"os"
+	"time"
+)
+
+// CredentialsFileEnv is the environment variable of the ambient credentials file, read by the default credentials.
+const CredentialsFileEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// CredentialsReloader reloads the Secret Manager client of a tool once its credentials file changes,
+// e.g. when the bootstrap service account key of the tool is rotated, so that the new key takes effect without a restart.
+// The file is polled rather than watched, as mounted Kubernetes secrets are updated by swapping symlinks.
+type CredentialsReloader struct {
+	// Path is the path of the credentials file.
+	Path string
+	// Reload creates a new client reading the credentials file, and swaps it in.
+	// It returns the replaced client, closed by the next Check() once the calls in flight through it are done.
+	Reload func() (io.Closer, error)
+
+	checksum [sha256.Size]byte
+	loaded   bool
+	retired  io.Closer
+}
+
+// Check reloads the client if the content of the credentials file changed since the last Check.
+// The first Check only records the content, already loaded by the initial client.
+// A failed reload is retried by the next Check.
+// Returns true if the client is reloaded.
+func (r *CredentialsReloader) Check() (bool, error) {
+	if r.retired != nil {
+		err := r.retired.Close()
+		if err != nil {
+			klog.Warningf("Fail to close the client replaced by the credentials of %s: %s", r.Path, err)
+		}
+		r.retired = nil
+	}
+
+	data, err := ioutil.ReadFile(r.Path)
+	if err != nil {
+		return false, fmt.Errorf("Fail to read credentials file %s: %s", r.Path, err)
+	}
+	checksum := sha256.Sum256(data)
+	for i := range data {
+		data[i] = 0
+	}
+
+	if !r.loaded {
+		r.checksum, r.loaded = checksum, true
+		return false, nil
+	}
+	if checksum == r.checksum {
+		return false, nil
+	}
+
+	retired, err := r.Reload()
+	if err != nil {
+		return false, fmt.Errorf("Fail to reload credentials from %s: %s", r.Path, err)
+	}
+	r.checksum = checksum
+	r.retired = retired
+
+	return true, nil
+}
+
+// Run calls Check every period until ctx is done.
+func (r *CredentialsReloader) Run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Check()
+			if err != nil {
+				klog.Error(err)
+			} else if reloaded {
+				klog.Infof("Reloaded the Secret Manager client with the updated credentials of %s", r.Path)
+			}
+		}
+	}
+}
+
+// WatchCredentials reloads the client with reload every period once the ambient credentials file changes, until ctx is done.
+// It does nothing if period <= 0 or no ambient credentials file is set, e.g. with the credentials of the metadata server,
+// which are refreshed on their own.
+// Returns error if the credentials file cannot be read.
+func WatchCredentials(ctx context.Context, period time.Duration, reload func() (io.Closer, error)) error {
+	path := os.Getenv(CredentialsFileEnv)
+	if period <= 0 || path == "" {
+		return nil
+	}
+
+	reloader := &CredentialsReloader{
+		Path:   path,
+		Reload: reload,
+	}
+	_, err := reloader.Check()
+	if err != nil {
+		return err
+	}
+
+	go reloader.Run(ctx, period)
+	return nil
+}
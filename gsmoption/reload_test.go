@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gsmoption
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeCloser counts the calls to Close.
+type fakeCloser struct {
+	closed *int
+}
+
+func (c fakeCloser) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestCredentialsReloader(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		contents      []string
+		failures      int
+		expectReloads int
+		expectClosed  int
+	}{
+		{
+			name:          "Unchanged credentials. Should not reload.",
+			contents:      []string{"key-1", "key-1"},
+			expectReloads: 0,
+			expectClosed:  0,
+		},
+		{
+			name:          "Rotated credentials. Should reload once, and close the replaced client on the next check.",
+			contents:      []string{"key-1", "key-2", "key-2"},
+			expectReloads: 1,
+			expectClosed:  1,
+		},
+		{
+			name:          "Failing reload. Should retry on the next check.",
+			contents:      []string{"key-1", "key-2", "key-2"},
+			failures:      1,
+			expectReloads: 1,
+			expectClosed:  0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "credentials")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "key.json")
+
+			attempts, closed := 0, 0
+			reloader := &CredentialsReloader{
+				Path: path,
+				Reload: func() (io.Closer, error) {
+					attempts++
+					if attempts <= tc.failures {
+						return nil, fmt.Errorf("invalid key")
+					}
+					return fakeCloser{&closed}, nil
+				},
+			}
+
+			reloads := 0
+			for _, content := range tc.contents {
+				err = ioutil.WriteFile(path, []byte(content), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reloaded, _ := reloader.Check()
+				if reloaded {
+					reloads++
+				}
+			}
+
+			if reloads != tc.expectReloads {
+				t.Errorf("Expected %d reloads, got %d.", tc.expectReloads, reloads)
+			}
+			if closed != tc.expectClosed {
+				t.Errorf("Expected %d closed clients, got %d.", tc.expectClosed, closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package healthz serves the liveness and readiness endpoints of the secret sync controller and the secret rotator,
+// for the probes of their deployments.
+package healthz
+
+import (
+	"fmt"
+	"net/http"
+	"sigs.k8s.io/k8s-gsm-tools/exitcode"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Checks are the named readiness checks of a command, e.g. that its clients are created and its config is loaded.
+// The command is ready once all of them pass.
+type Checks struct {
+	mutex  sync.RWMutex
+	checks map[string]func() error
+}
+
+// New returns the Checks named names, failing until they are Set() or Pass(),
+// so that the command is not ready before it is set up.
+func New(names ...string) *Checks {
+	c := &Checks{checks: map[string]func() error{}}
+	for _, name := range names {
+		c.checks[name] = pending(name)
+	}
+	return c
+}
+
+// pending returns the check of name failing until it is set up.
+func pending(name string) func() error {
+	return func() error {
+		return fmt.Errorf("%s not set up yet", name)
+	}
+}
+
+// Set sets the check named name.
+func (c *Checks) Set(name string, check func() error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checks[name] = check
+}
+
+// Pass sets the check named name to always pass, e.g. once a client is created.
+func (c *Checks) Pass(name string) {
+	c.Set(name, func() error { return nil })
+}
+
+// Check returns the failures of the checks in order of names, empty if the command is ready.
+func (c *Checks) Check() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	names := []string{}
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := []string{}
+	for _, name := range names {
+		if err := c.checks[name](); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	return failures
+}
+
+// Handler serves GET /healthz, ok as long as the command serves requests,
+// and GET /readyz, ok once all checks pass, or 503 Service Unavailable listing the failed checks.
+func (c *Checks) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		failures := c.Check()
+		if len(failures) != 0 {
+			http.Error(w, strings.Join(failures, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// Serve serves the Handler at address in the background.
+func (c *Checks) Serve(address string) {
+	go func() {
+		exitcode.Fatal(exitcode.SetupError, http.ListenAndServe(address, c.Handler()))
+	}()
+}
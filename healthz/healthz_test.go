@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		setUp        func(c *Checks)
+		expectStatus int
+		expectBody   []string
+	}{
+		{
+			name:         "Checks not set up. Should not be ready.",
+			setUp:        func(c *Checks) {},
+			expectStatus: http.StatusServiceUnavailable,
+			expectBody:   []string{"clients: clients not set up yet", "config: config not set up yet"},
+		},
+		{
+			name:         "Clients created only. Should not be ready.",
+			setUp:        func(c *Checks) { c.Pass("clients") },
+			expectStatus: http.StatusServiceUnavailable,
+			expectBody:   []string{"config: config not set up yet"},
+		},
+		{
+			name: "Failed check. Should not be ready.",
+			setUp: func(c *Checks) {
+				c.Pass("clients")
+				c.Set("config", func() error { return fmt.Errorf("no config loaded") })
+			},
+			expectStatus: http.StatusServiceUnavailable,
+			expectBody:   []string{"config: no config loaded"},
+		},
+		{
+			name: "All checks passed. Should be ready.",
+			setUp: func(c *Checks) {
+				c.Pass("clients")
+				c.Set("config", func() error { return nil })
+			},
+			expectStatus: http.StatusOK,
+			expectBody:   []string{"ok"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			c := New("config", "clients")
+			tc.setUp(c)
+			handler := c.Handler()
+
+			// liveness does not depend on the checks
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if recorder.Code != http.StatusOK {
+				t.Errorf("Expected /healthz status %d, but got %d.", http.StatusOK, recorder.Code)
+			}
+
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if recorder.Code != tc.expectStatus {
+				t.Errorf("Expected /readyz status %d, but got %d.", tc.expectStatus, recorder.Code)
+			}
+			body := strings.TrimSpace(recorder.Body.String())
+			if body != strings.Join(tc.expectBody, "\n") {
+				t.Errorf("Expected /readyz body %q, but got %q.", strings.Join(tc.expectBody, "\n"), body)
+			}
+		})
+	}
+}
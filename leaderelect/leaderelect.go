@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leaderelect runs the loops of the secret sync controller and the secret rotator only while holding a lease,
+// so that their deployments can run several replicas for availability without double-writing secrets.
+package leaderelect
+
+import (
+	"context"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+	"time"
+)
+
+// Default timings of the election, the same as the ones of the Kubernetes controller manager.
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+// Config is the leader election of the replicas of a command, through a Lease object.
+type Config struct {
+	// Clientset creates and renews the Lease.
+	Clientset kubernetes.Interface
+	// Namespace and Name of the Lease, shared by the replicas.
+	Namespace string
+	Name      string
+	// Identity of this replica in the Lease, e.g. its hostname. Must be unique among the replicas.
+	Identity string
+	// LeaseDuration, RenewDeadline and RetryPeriod tune the election, see leaderelection.LeaderElectionConfig.
+	// Default to DefaultLeaseDuration, DefaultRenewDeadline and DefaultRetryPeriod if unset.
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// Run waits for the Lease, then runs start until it returns, stopChan is closed or the Lease is lost.
+// The Lease is released once start returns, so that another replica takes over right away.
+// Returns the error of start, or an error once the Lease is lost, for the replica to restart as a follower.
+func (c *Config) Run(stopChan <-chan struct{}, start func(stopChan <-chan struct{}) error) error {
+	elected := make(chan struct{})
+	elector, err := leaderelection.NewLeaderElector(c.electionConfig(elected))
+	if err != nil {
+		return fmt.Errorf("Invalid leader election: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	electionDone := make(chan struct{})
+	go func() {
+		defer close(electionDone)
+		elector.Run(ctx)
+	}()
+
+	klog.Infof("Waiting for lease %s/%s as %s...", c.Namespace, c.Name, c.Identity)
+	select {
+	case <-stopChan:
+		klog.V(2).Info("Stop signal received. Quitting...")
+		return nil
+	case <-elected:
+	}
+	klog.Infof("Acquired lease %s/%s as %s", c.Namespace, c.Name, c.Identity)
+
+	// start is stopped once stopChan is closed or the Lease is lost
+	leading := make(chan struct{})
+	startDone := make(chan struct{})
+	lost := make(chan struct{})
+	go func() {
+		select {
+		case <-stopChan:
+		case <-startDone:
+			return
+		case <-electionDone:
+			// the election only ends by itself once the Lease is lost
+			select {
+			case <-startDone:
+				return
+			default:
+			}
+			close(lost)
+		}
+		close(leading)
+	}()
+
+	err = start(leading)
+	close(startDone)
+	cancel()
+	<-electionDone
+
+	select {
+	case <-lost:
+		return fmt.Errorf("Lost lease %s/%s", c.Namespace, c.Name)
+	default:
+	}
+	return err
+}
+
+// electionConfig returns the election through the Lease of c, closing elected once the Lease is acquired.
+func (c *Config) electionConfig(elected chan<- struct{}) leaderelection.LeaderElectionConfig {
+	return leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Namespace: c.Namespace,
+				Name:      c.Name,
+			},
+			Client: c.Clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: c.Identity,
+			},
+		},
+		LeaseDuration:   orDefault(c.LeaseDuration, DefaultLeaseDuration),
+		RenewDeadline:   orDefault(c.RenewDeadline, DefaultRenewDeadline),
+		RetryPeriod:     orDefault(c.RetryPeriod, DefaultRetryPeriod),
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				close(elected)
+			},
+			OnStoppedLeading: func() {},
+			OnNewLeader: func(identity string) {
+				if identity != c.Identity {
+					klog.Infof("Lease %s/%s held by %s", c.Namespace, c.Name, identity)
+				}
+			},
+		},
+	}
+}
+
+// orDefault returns d, or def if d is unset.
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
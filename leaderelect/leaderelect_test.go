@@ -0,0 +1,194 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leaderelect
+
+import (
+	"fmt"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newConfig returns the election of replica identity through the Lease ns-a/lease, with short timings.
+func newConfig(clientset kubernetes.Interface, identity string) *Config {
+	return &Config{
+		Clientset:     clientset,
+		Namespace:     "ns-a",
+		Name:          "lease",
+		Identity:      identity,
+		LeaseDuration: 300 * time.Millisecond,
+		RenewDeadline: 200 * time.Millisecond,
+		RetryPeriod:   20 * time.Millisecond,
+	}
+}
+
+// holder returns the holder of the Lease ns-a/lease.
+func holder(t *testing.T, clientset kubernetes.Interface) string {
+	lease, err := clientset.CoordinationV1().Leases("ns-a").Get("lease", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func TestRun(t *testing.T) {
+	var testcases = []struct {
+		name     string
+		startErr error
+	}{
+		{
+			name:     "Start succeeded. Should release the lease and return nil.",
+			startErr: nil,
+		},
+		{
+			name:     "Start failed. Should release the lease and return its error.",
+			startErr: fmt.Errorf("persistent drift"),
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			config := newConfig(clientset, "replica-a")
+
+			started := false
+			err := config.Run(make(chan struct{}), func(stopChan <-chan struct{}) error {
+				started = true
+				if h := holder(t, clientset); h != "replica-a" {
+					t.Errorf("Expected lease held by replica-a while started, but got %q.", h)
+				}
+				return tc.startErr
+			})
+			if err != tc.startErr {
+				t.Errorf("Expected error %v, but got %v.", tc.startErr, err)
+			}
+			if !started {
+				t.Errorf("Expected start to run.")
+			}
+			if h := holder(t, clientset); h != "" {
+				t.Errorf("Expected lease released, but held by %q.", h)
+			}
+		})
+	}
+}
+
+func TestRunReplicas(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	// replica-a leads until stopped
+	stopA := make(chan struct{})
+	doneA := make(chan error)
+	go func() {
+		doneA <- newConfig(clientset, "replica-a").Run(stopA, func(stopChan <-chan struct{}) error {
+			<-stopChan
+			return nil
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	startedB := make(chan struct{})
+	doneB := make(chan error)
+	go func() {
+		doneB <- newConfig(clientset, "replica-b").Run(make(chan struct{}), func(stopChan <-chan struct{}) error {
+			close(startedB)
+			return nil
+		})
+	}()
+
+	// replica-b follows as long as replica-a renews the lease
+	select {
+	case <-startedB:
+		t.Fatalf("Expected replica-b to wait for the lease held by replica-a.")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	close(stopA)
+	if err := <-doneA; err != nil {
+		t.Errorf("Unexpected error of replica-a: %s", err)
+	}
+	select {
+	case <-startedB:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected replica-b to take over the released lease.")
+	}
+	if err := <-doneB; err != nil {
+		t.Errorf("Unexpected error of replica-b: %s", err)
+	}
+}
+
+func TestRunStoppedFollower(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	holderIdentity := "replica-a"
+	_, err := clientset.CoordinationV1().Leases("ns-a").Create(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "lease"},
+		Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holderIdentity},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopChan := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(stopChan) })
+	err = newConfig(clientset, "replica-b").Run(stopChan, func(stopChan <-chan struct{}) error {
+		t.Errorf("Expected start not to run without the lease.")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if h := holder(t, clientset); h != "replica-a" {
+		t.Errorf("Expected lease held by replica-a, but got %q.", h)
+	}
+}
+
+func TestRunLostLease(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	stopped := false
+	err := newConfig(clientset, "replica-a").Run(make(chan struct{}), func(stopChan <-chan struct{}) error {
+		// another replica takes over the lease, e.g. after a network partition
+		lease, err := clientset.CoordinationV1().Leases("ns-a").Get("lease", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		other := "replica-b"
+		renewTime := metav1.NowMicro()
+		lease.Spec.HolderIdentity = &other
+		lease.Spec.RenewTime = &renewTime
+		_, err = clientset.CoordinationV1().Leases("ns-a").Update(lease)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-stopChan:
+			stopped = true
+		case <-time.After(2 * time.Second):
+		}
+		return nil
+	})
+	if !stopped {
+		t.Errorf("Expected start to be stopped once the lease is lost.")
+	}
+	if err == nil || !strings.Contains(err.Error(), "Lost lease ns-a/lease") {
+		t.Errorf("Expected lost lease error, but got %v.", err)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package orchestration combines the secret rotator and the secret sync controller,
+// e.g. to rotate a secret and propagate its new value right away in tests and tooling.
+package orchestration
+
+import (
+	"fmt"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	rotconfig "sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/rotator"
+	syncconfig "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/controller"
+	"time"
+)
+
+// Result is the combined result of RotateAndSync.
+type Result struct {
+	// Rotated is true if a new version of the rotated secret is added.
+	Rotated bool
+	// Synced lists the dependent specs whose destinations are updated.
+	Synced []syncconfig.SpecID
+	// Failed lists the dependent specs that fail to sync.
+	Failed []syncconfig.SpecID
+}
+
+// RotateAndSync forces the rotation of rotatedSecret, then syncs the specs sourcing any key from the rotated secret.
+// Specs not depending on the rotated secret are left untouched.
+// The specs are not synced if the rotation fails, so that the destinations keep consistent values.
+func RotateAndSync(r *rotator.SecretRotator, c *controller.SecretSyncController, rotatedSecret rotconfig.RotatedSecretSpec, specs []syncconfig.SecretSyncSpec, now time.Time) (Result, error) {
+	result := Result{}
+
+	rotated, err := r.RotateOne(rotatedSecret, map[rotconfig.SpecID]bool{rotatedSecret.ID(): true}, now)
+	result.Rotated = rotated
+	if !rotated {
+		if err == nil {
+			return result, fmt.Errorf("Secret %s is not rotated", rotatedSecret)
+		}
+		return result, fmt.Errorf("Fail to rotate %s: %s", rotatedSecret, err)
+	}
+	errs := []error{}
+	if err != nil {
+		// the new version is added, the dependent specs should still pick it up
+		errs = append(errs, fmt.Errorf("Fail to rotate %s: %s", rotatedSecret, err))
+	}
+
+	for _, spec := range specs {
+		if !dependsOn(spec, rotatedSecret) {
+			continue
+		}
+		updated, err := c.Sync(spec)
+		if err != nil {
+			result.Failed = append(result.Failed, spec.ID())
+			errs = append(errs, err)
+		}
+		if updated {
+			result.Synced = append(result.Synced, spec.ID())
+		}
+	}
+
+	return result, utilerrors.NewAggregate(errs)
+}
+
+// dependsOn returns true if any key of spec is sourced from rotatedSecret.
+func dependsOn(spec syncconfig.SecretSyncSpec, rotatedSecret rotconfig.RotatedSecretSpec) bool {
+	for _, pair := range spec.Pairs() {
+		if pair.Source.Project == rotatedSecret.Project && pair.Source.Secret == rotatedSecret.Secret {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orchestration
+
+import (
+	"bytes"
+	"reflect"
+	rotconfig "sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/rotator"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/svckey"
+	rottests "sigs.k8s.io/k8s-gsm-tools/secret-rotator/tests"
+	syncconfig "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/controller"
+	synctests "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+	"time"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// sharedClient serves the Secret Manager reads of the sync controller from the mocked Secret Manager of the rotator,
+// so that the controller sees the versions added by the rotator.
+type sharedClient struct {
+	*synctests.MockClient
+	gsm *rottests.MockClient
+}
+
+func (cl *sharedClient) GetSecretManagerSecretValue(project, id string) ([]byte, error) {
+	return cl.gsm.GetSecretVersionData(project, id, "latest")
+}
+
+func (cl *sharedClient) GetSecretManagerSecretVersion(project, id string) ([]byte, string, error) {
+	version, err := cl.gsm.ValidateAndConvertVersion(project, id, "latest")
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := cl.gsm.GetSecretVersionData(project, id, version)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, version, nil
+}
+
+func (cl *sharedClient) GetSecretManagerSecretLabels(project, id string) (map[string]string, error) {
+	return cl.gsm.GetSecretLabels(project, id)
+}
+
+func TestRotateAndSync(t *testing.T) {
+	rotatedSecret := rotconfig.RotatedSecretSpec{
+		Project: "project-1",
+		Secret:  "secret-1",
+		Type: rotconfig.RotatedSecretType{
+			ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+				Project:        "project-1",
+				ServiceAccount: "service-foo",
+			},
+		},
+		Refresh: rotconfig.RefreshStrategy{
+			Interval: 24 * time.Hour,
+		},
+		GracePeriod: time.Hour,
+	}
+
+	dependent := syncconfig.SecretSyncSpec{
+		Source: syncconfig.SecretManagerSpec{
+			Project: "project-1",
+			Secret:  "secret-1",
+		},
+		Destination: syncconfig.KubernetesSpec{
+			Namespace: "ns-a",
+			Secret:    "secret-a",
+			Key:       "key-a",
+		},
+	}
+	unrelated := syncconfig.SecretSyncSpec{
+		Source: syncconfig.SecretManagerSpec{
+			Project: "project-1",
+			Secret:  "secret-2",
+		},
+		Destination: syncconfig.KubernetesSpec{
+			Namespace: "ns-a",
+			Secret:    "secret-b",
+			Key:       "key-b",
+		},
+	}
+
+	var testcases = []struct {
+		name          string
+		specs         []syncconfig.SecretSyncSpec
+		expectSynced  []syncconfig.SpecID
+		expectFailure bool
+	}{
+		{
+			name:         "Dependent spec. Should be synced with the rotated value.",
+			specs:        []syncconfig.SecretSyncSpec{dependent},
+			expectSynced: []syncconfig.SpecID{dependent.ID()},
+		},
+		{
+			name:         "Unrelated spec. Should not be synced.",
+			specs:        []syncconfig.SecretSyncSpec{dependent, unrelated},
+			expectSynced: []syncconfig.SpecID{dependent.ID()},
+		},
+		{
+			name:          "No dependent spec. Should rotate only.",
+			specs:         []syncconfig.SecretSyncSpec{unrelated},
+			expectSynced:  nil,
+			expectFailure: false,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			// the secret is fresh, so that only the forced rotation refreshes it
+			now := time.Now()
+			gsm := &rottests.MockClient{
+				Secrets: map[string]map[string]*rottests.Secret{
+					"project-1": map[string]*rottests.Secret{
+						"secret-1": &rottests.Secret{
+							Versions: map[string]*rottests.Version{
+								"1": &rottests.Version{
+									CreateTime: now,
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: map[string]string{
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+							},
+						},
+						"secret-2": &rottests.Secret{
+							Versions: map[string]*rottests.Version{
+								"1": &rottests.Version{
+									CreateTime: now,
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+						},
+					},
+				},
+			}
+			k8s := synctests.NewMockClient(nil)
+			err := k8s.CreateKubernetesNamespace("ns-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := &rotator.SecretRotator{
+				Client: gsm,
+				Provisioners: map[string]rotator.SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): &rottests.MockSvcProvisioner{},
+				},
+			}
+			c := &controller.SecretSyncController{
+				Client: &sharedClient{MockClient: k8s, gsm: gsm},
+				Agent:  &syncconfig.Agent{},
+			}
+
+			result, err := RotateAndSync(r, c, rotatedSecret, tc.specs, now)
+			if (err != nil) != tc.expectFailure {
+				t.Fatalf("Expected failure: %t, got error: %v", tc.expectFailure, err)
+			}
+			if !result.Rotated {
+				t.Errorf("Expected the secret to be rotated.")
+			}
+			if !reflect.DeepEqual(result.Synced, tc.expectSynced) {
+				t.Errorf("Expected synced specs %v, got %v", tc.expectSynced, result.Synced)
+			}
+
+			latest, err := gsm.GetSecretVersionData("project-1", "secret-1", "latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(latest, []byte("secret-data-1")) {
+				t.Errorf("Expected a new version of %s.", rotatedSecret)
+			}
+
+			for _, spec := range tc.specs {
+				data, err := k8s.GetKubernetesSecretValue(spec.Destination.Namespace, spec.Destination.Secret, spec.Destination.Key)
+				if spec.ID() == dependent.ID() {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(data, latest) {
+						t.Errorf("Expected %s to hold the rotated value.", spec.Destination)
+					}
+				} else if data != nil {
+					t.Errorf("Expected %s not to be synced, got %s", spec.Destination, data)
+				}
+			}
+		})
+	}
+}
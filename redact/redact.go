@@ -0,0 +1,100 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package redact renders secret values and the errors possibly holding them without their content,
+// so that the secret sync controller and the secret rotator never leak values into their logs.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// hashPrefixLength is the number of hex digits of the sha256 of a value rendered by Value and Sum,
+// enough to tell two values apart in logs, without allowing to brute force short values offline.
+const hashPrefixLength = 8
+
+// Value is a secret value rendered as <redacted:len=N,sha256prefix=...> by all fmt verbs,
+// so that it can be passed to log and error messages safely.
+type Value []byte
+
+// Sum returns the truncated sha256 of value rendered by Value, enough to tell values apart without revealing them,
+// e.g. to compare a source and a destination in a report.
+func Sum(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])[:hashPrefixLength]
+}
+
+// String returns the redacted rendering of v.
+func (v Value) String() string {
+	return fmt.Sprintf("<redacted:len=%d,sha256prefix=%s>", len(v), Sum(v))
+}
+
+// GoString returns the redacted rendering of v for the %#v verb.
+func (v Value) GoString() string {
+	return v.String()
+}
+
+// Format renders v redacted for all verbs, including %x and %q which would otherwise print the bytes.
+func (v Value) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, v.String())
+}
+
+// redactedError is an error whose message had secret values replaced by their redacted rendering.
+// It deliberately does not unwrap to the original error, which still holds the values.
+type redactedError struct {
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Error returns err with each occurrence of values in its message replaced by their redacted rendering,
+// including their base64 and JSON string encodings, e.g. echoed from the payload of a patch.
+// Returns err itself if its message holds none of the values, so that its type can still be inspected, and nil if err is nil.
+func Error(err error, values ...[]byte) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	redacted := msg
+	for _, value := range values {
+		if len(value) == 0 {
+			continue
+		}
+		for _, encoded := range encodings(value) {
+			redacted = strings.ReplaceAll(redacted, encoded, Value(value).String())
+		}
+	}
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{msg: redacted}
+}
+
+// encodings returns the forms of value that may appear in error messages.
+func encodings(value []byte) []string {
+	forms := []string{base64.StdEncoding.EncodeToString(value)}
+	quoted, err := json.Marshal(string(value))
+	if err == nil && len(quoted) > 2 {
+		// without the quotes, as embedded in a JSON document
+		forms = append(forms, string(quoted[1:len(quoted)-1]))
+	}
+	return append(forms, string(value))
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redact
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	value := Value("gsm-token-v1")
+	for _, verb := range []string{"%s", "%v", "%+v", "%#v", "%q", "%x", "%X", "%d"} {
+		rendered := fmt.Sprintf(verb, value)
+		if strings.Contains(rendered, "gsm-token-v1") || strings.Contains(rendered, fmt.Sprintf("%x", []byte("gsm-token-v1"))) {
+			t.Errorf("Expected %s to redact the value, but got %s.", verb, rendered)
+		}
+		if !strings.HasPrefix(rendered, "<redacted:len=12,sha256prefix=") {
+			t.Errorf("Expected %s to render the length and hash prefix, but got %s.", verb, rendered)
+		}
+	}
+	if Value("gsm-token-v1").String() == Value("gsm-token-v2").String() {
+		t.Errorf("Expected different values to render differently.")
+	}
+	if sum := Sum([]byte("gsm-token-v1")); !strings.Contains(value.String(), "sha256prefix="+sum+">") {
+		t.Errorf("Expected the rendering %s to hold the sum %s.", value, sum)
+	}
+}
+
+func TestError(t *testing.T) {
+	value := []byte("line-1\n\"gsm-token-v1\"")
+	original := fmt.Errorf("unrelated failure")
+
+	var testcases = []struct {
+		name          string
+		err           error
+		expectNil     bool
+		expectRedact  bool
+		expectMessage string
+	}{
+		{
+			name:      "Nil error. Should return nil.",
+			err:       nil,
+			expectNil: true,
+		},
+		{
+			name:          "Error without the value. Should return it unchanged.",
+			err:           original,
+			expectRedact:  false,
+			expectMessage: "unrelated failure",
+		},
+		{
+			name:         "Error holding the raw value. Should redact it.",
+			err:          fmt.Errorf("invalid value %s", value),
+			expectRedact: true,
+		},
+		{
+			name:         "Error holding the base64 encoded value, e.g. from the data of a patch. Should redact it.",
+			err:          fmt.Errorf(`invalid patch {"data":{"key-a":"%s"}}`, base64.StdEncoding.EncodeToString(value)),
+			expectRedact: true,
+		},
+		{
+			name:         "Error holding the JSON encoded value, e.g. from the stringData of a patch. Should redact it.",
+			err:          fmt.Errorf(`invalid patch {"stringData":{"key-a":"line-1\n\"gsm-token-v1\""}}`),
+			expectRedact: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			err := Error(tc.err, nil, value)
+			if tc.expectNil {
+				if err != nil {
+					t.Errorf("Expected nil, but got %s.", err)
+				}
+				return
+			}
+			if strings.Contains(err.Error(), "gsm-token-v1") || strings.Contains(err.Error(), base64.StdEncoding.EncodeToString(value)) {
+				t.Errorf("Expected the value redacted, but got %s.", err)
+			}
+			redacted := err != tc.err
+			if redacted != tc.expectRedact {
+				t.Errorf("Expected redacted %v, but got %s.", tc.expectRedact, err)
+			}
+			if tc.expectRedact && !strings.Contains(err.Error(), Value(value).String()) {
+				t.Errorf("Expected the redacted rendering %s, but got %s.", Value(value), err)
+			}
+			if tc.expectMessage != "" && err.Error() != tc.expectMessage {
+				t.Errorf("Expected %s, but got %s.", tc.expectMessage, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package report assembles a read-only reconciliation report of the secret sync and secret rotator configs
+// against the live state, e.g. for audits. The report never holds secret values.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	rotclient "sigs.k8s.io/k8s-gsm-tools/secret-rotator/client"
+	rotconfig "sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	syncconfig "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/controller"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SpecReport is the reconciliation status of a secret sync spec.
+type SpecReport struct {
+	Spec string `json:"spec"`
+	// MissingSources lists the Secret Manager sources that do not exist.
+	MissingSources    []string `json:"missingSources,omitempty"`
+	DestinationExists bool     `json:"destinationExists"`
+	InSync            bool     `json:"inSync"`
+	// Drifts describes each difference found between the sources and the destination.
+	Drifts []string `json:"drifts,omitempty"`
+	// Error is set if the status cannot be determined.
+	Error string `json:"error,omitempty"`
+}
+
+// RotatedSecretReport is the version status of a rotated secret.
+type RotatedSecretReport struct {
+	Secret string `json:"secret"`
+	Exists bool   `json:"exists"`
+	// ActiveVersions is the number of enabled versions.
+	ActiveVersions int `json:"activeVersions"`
+	// MaxActiveVersions is the expected maximum of ActiveVersions, 0 if it cannot be estimated.
+	MaxActiveVersions int `json:"maxActiveVersions,omitempty"`
+	// Error is set if the status cannot be determined.
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the reconciliation report of all specs and rotated secrets.
+type Report struct {
+	Specs          []SpecReport          `json:"specs"`
+	RotatedSecrets []RotatedSecretReport `json:"rotatedSecrets"`
+}
+
+// Assemble builds the report of specs with c, and of rotatedSecrets with rotClient.
+// It only reads from the clients, and keeps going on failures, recording them in the report.
+func Assemble(c *controller.SecretSyncController, specs []syncconfig.SecretSyncSpec, rotClient rotclient.Interface, rotatedSecrets []rotconfig.RotatedSecretSpec) Report {
+	report := Report{
+		Specs:          []SpecReport{},
+		RotatedSecrets: []RotatedSecretReport{},
+	}
+
+	for _, spec := range specs {
+		report.Specs = append(report.Specs, specReport(c, spec))
+	}
+	for _, secret := range rotatedSecrets {
+		report.RotatedSecrets = append(report.RotatedSecrets, rotatedSecretReport(rotClient, secret))
+	}
+
+	return report
+}
+
+func specReport(c *controller.SecretSyncController, spec syncconfig.SecretSyncSpec) SpecReport {
+	r := SpecReport{
+		Spec: spec.String(),
+	}
+	result, err := c.Status(spec)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for _, source := range result.MissingSources {
+		r.MissingSources = append(r.MissingSources, source.String())
+	}
+	r.DestinationExists = result.DestinationExists
+	r.Drifts = result.Drifts
+	r.InSync = err == nil && result.InSync()
+	return r
+}
+
+func rotatedSecretReport(rotClient rotclient.Interface, secret rotconfig.RotatedSecretSpec) RotatedSecretReport {
+	r := RotatedSecretReport{
+		Secret:            secret.String(),
+		MaxActiveVersions: secret.MaxActiveVersions(),
+	}
+	versions, err := rotClient.ListEnabledVersions(secret.Project, secret.Secret)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			r.Error = err.Error()
+		}
+		return r
+	}
+	r.Exists = true
+	r.ActiveVersions = len(versions)
+	return r
+}
+
+// OK returns true if all specs are in sync, and all rotated secrets exist within their expected number of active versions.
+func (r Report) OK() bool {
+	for _, spec := range r.Specs {
+		if !spec.InSync {
+			return false
+		}
+	}
+	for _, secret := range r.RotatedSecrets {
+		if !secret.healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r RotatedSecretReport) healthy() bool {
+	if r.Error != "" || !r.Exists {
+		return false
+	}
+	return r.MaxActiveVersions == 0 || r.ActiveVersions <= r.MaxActiveVersions
+}
+
+// JSON returns the machine-readable report.
+func (r Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Summary returns the human-readable summary of the report, one line per spec and rotated secret.
+func (r Report) Summary() string {
+	var b strings.Builder
+	inSync := 0
+	for _, spec := range r.Specs {
+		state := "in sync"
+		switch {
+		case spec.Error != "":
+			state = "error: " + spec.Error
+		case len(spec.MissingSources) != 0:
+			state = "missing sources: " + strings.Join(spec.MissingSources, ", ")
+		case !spec.DestinationExists:
+			state = "missing destination"
+		case len(spec.Drifts) != 0:
+			state = "drifted: " + strings.Join(spec.Drifts, "; ")
+		default:
+			inSync++
+		}
+		fmt.Fprintf(&b, "%s: %s\n", spec.Spec, state)
+	}
+
+	healthy := 0
+	for _, secret := range r.RotatedSecrets {
+		state := fmt.Sprintf("%d active versions", secret.ActiveVersions)
+		switch {
+		case secret.Error != "":
+			state = "error: " + secret.Error
+		case !secret.Exists:
+			state = "missing"
+		case !secret.healthy():
+			state += fmt.Sprintf(", exceeding the expected %d", secret.MaxActiveVersions)
+		}
+		if secret.healthy() {
+			healthy++
+		}
+		fmt.Fprintf(&b, "%s: %s\n", secret.Secret, state)
+	}
+
+	fmt.Fprintf(&b, "%d/%d specs in sync, %d/%d rotated secrets healthy.\n", inSync, len(r.Specs), healthy, len(r.RotatedSecrets))
+	return b.String()
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"bytes"
+	rotconfig "sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	rottests "sigs.k8s.io/k8s-gsm-tools/secret-rotator/tests"
+	syncconfig "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/controller"
+	synctests "sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"strings"
+	"testing"
+	"time"
+)
+
+func syncSpec(secret, namespace string) syncconfig.SecretSyncSpec {
+	return syncconfig.SecretSyncSpec{
+		Source: syncconfig.SecretManagerSpec{
+			Project: "project-1",
+			Secret:  secret,
+		},
+		Destination: syncconfig.KubernetesSpec{
+			Namespace: namespace,
+			Secret:    "secret-a",
+			Key:       "key-a",
+		},
+	}
+}
+
+func rotatedSecret(secret string) rotconfig.RotatedSecretSpec {
+	return rotconfig.RotatedSecretSpec{
+		Project: "project-1",
+		Secret:  secret,
+		Refresh: rotconfig.RefreshStrategy{
+			Interval: 24 * time.Hour,
+		},
+		GracePeriod: time.Hour,
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	syncClient := synctests.NewMockClient([]string{"project-1"})
+	for _, err := range []error{
+		syncClient.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v1")),
+		syncClient.UpsertSecretManagerSecret("project-1", "gsm-token-2", []byte("gsm-token-v2")),
+		syncClient.CreateKubernetesNamespace("ns-a"),
+		syncClient.CreateKubernetesNamespace("ns-b"),
+		syncClient.CreateKubernetesNamespace("ns-c"),
+		syncClient.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("gsm-token-v1")),
+		syncClient.UpsertKubernetesSecret("ns-b", "secret-a", "key-a", []byte("stale")),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &controller.SecretSyncController{
+		Client: syncClient,
+		Agent:  &syncconfig.Agent{},
+	}
+
+	rotClient := &rottests.MockClient{
+		Secrets: map[string]map[string]*rottests.Secret{
+			"project-1": {},
+		},
+	}
+	for _, data := range []string{"v1", "v2"} {
+		_, err := rotClient.UpsertSecret("project-1", "rotated", []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, data := range []string{"v1", "v2", "v3", "v4"} {
+		_, err := rotClient.UpsertSecret("project-1", "overflowing", []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var testcases = []struct {
+		name           string
+		spec           syncconfig.SecretSyncSpec
+		expectMissing  int
+		expectDest     bool
+		expectInSync   bool
+		expectDrifts   int
+		rotatedSecret  rotconfig.RotatedSecretSpec
+		expectExists   bool
+		expectVersions int
+		expectHealthy  bool
+	}{
+		{
+			name:           "Spec in sync, rotated secret with active versions.",
+			spec:           syncSpec("gsm-token", "ns-a"),
+			expectDest:     true,
+			expectInSync:   true,
+			rotatedSecret:  rotatedSecret("rotated"),
+			expectExists:   true,
+			expectVersions: 2,
+			expectHealthy:  true,
+		},
+		{
+			name:           "Spec in sync, rotated secret exceeding its expected active versions.",
+			spec:           syncSpec("gsm-token", "ns-a"),
+			expectDest:     true,
+			expectInSync:   true,
+			rotatedSecret:  rotatedSecret("overflowing"),
+			expectExists:   true,
+			expectVersions: 4,
+		},
+		{
+			name:          "Spec drifted, rotated secret missing.",
+			spec:          syncSpec("gsm-token", "ns-b"),
+			expectDest:    true,
+			expectDrifts:  1,
+			rotatedSecret: rotatedSecret("missing"),
+		},
+		{
+			name:          "Destination missing. Should not be verified.",
+			spec:          syncSpec("gsm-token-2", "ns-c"),
+			expectDest:    false,
+			rotatedSecret: rotatedSecret("missing"),
+		},
+		{
+			name:          "Source missing. Should not be verified.",
+			spec:          syncSpec("missing", "ns-a"),
+			expectMissing: 1,
+			expectDest:    true,
+			rotatedSecret: rotatedSecret("missing"),
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			r := Assemble(c, []syncconfig.SecretSyncSpec{tc.spec}, rotClient, []rotconfig.RotatedSecretSpec{tc.rotatedSecret})
+			if len(r.Specs) != 1 || len(r.RotatedSecrets) != 1 {
+				t.Fatalf("Expected 1 spec and 1 rotated secret, got %d and %d.", len(r.Specs), len(r.RotatedSecrets))
+			}
+
+			spec := r.Specs[0]
+			if spec.Error != "" {
+				t.Errorf("Unexpected error: %s", spec.Error)
+			}
+			if len(spec.MissingSources) != tc.expectMissing {
+				t.Errorf("Expected %d missing sources, got %v.", tc.expectMissing, spec.MissingSources)
+			}
+			if spec.DestinationExists != tc.expectDest {
+				t.Errorf("Expected destination existence %v, got %v.", tc.expectDest, spec.DestinationExists)
+			}
+			if spec.InSync != tc.expectInSync {
+				t.Errorf("Expected in sync %v, got %v.", tc.expectInSync, spec.InSync)
+			}
+			if len(spec.Drifts) != tc.expectDrifts {
+				t.Errorf("Expected %d drifts, got %v.", tc.expectDrifts, spec.Drifts)
+			}
+
+			secret := r.RotatedSecrets[0]
+			if secret.Exists != tc.expectExists {
+				t.Errorf("Expected rotated secret existence %v, got %v.", tc.expectExists, secret.Exists)
+			}
+			if secret.ActiveVersions != tc.expectVersions {
+				t.Errorf("Expected %d active versions, got %d.", tc.expectVersions, secret.ActiveVersions)
+			}
+
+			if r.OK() != (tc.expectInSync && tc.expectHealthy) {
+				t.Errorf("Expected OK %v, got %v.", tc.expectInSync && tc.expectHealthy, r.OK())
+			}
+
+			// no secret value should be reported
+			data, err := r.JSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, output := range [][]byte{data, []byte(r.Summary())} {
+				for _, value := range []string{"gsm-token-v1", "gsm-token-v2", "stale"} {
+					if bytes.Contains(output, []byte(value)) {
+						t.Errorf("Report contains secret value %q: %s", value, output)
+					}
+				}
+			}
+			if !strings.Contains(r.Summary(), tc.spec.String()) {
+				t.Errorf("Expected summary to list %s: %s", tc.spec, r.Summary())
+			}
+		})
+	}
+}
@@ -18,34 +18,70 @@ package client
 import (
 	"context"
 	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/api/iterator"
 	"google.golang.org/genproto/protobuf/field_mask"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"io"
 	"strings"
+	"sync"
 	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"google.golang.org/api/option"
 	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
 )
 
 type Client struct {
 	*secretmanager.Client
+	// mutex guards Client, swapped by Reload().
+	mutex sync.RWMutex
 }
 
-func NewClient(ctx context.Context) (*Client, error) {
-	gsmClient, err := secretmanager.NewClient(ctx)
+// NewClient creates a new Client with opts, using the default credentials and the global endpoint if none is given.
+func NewClient(ctx context.Context, opts ...option.ClientOption) (*Client, error) {
+	gsmClient, err := secretmanager.NewClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{gsmClient}, nil
+	return &Client{Client: gsmClient}, nil
+}
+
+// Reload creates a new Secret Manager client with opts and swaps it in,
+// e.g. once the credentials file is updated with a rotated key. The calls in flight keep the previous client.
+// Returns the previous client, to be closed once the calls in flight are done.
+func (cl *Client) Reload(ctx context.Context, opts ...option.ClientOption) (io.Closer, error) {
+	gsmClient, err := secretmanager.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	previous := cl.Client
+	cl.Client = gsmClient
+	return previous, nil
+}
+
+// gsm returns the current Secret Manager client.
+func (cl *Client) gsm() *secretmanager.Client {
+	cl.mutex.RLock()
+	defer cl.mutex.RUnlock()
+
+	return cl.Client
 }
 
 type Interface interface {
 	ValidateSecret(project, id string) error
 	ValidateSecretVersion(project, id, version string) error
-	CreateSecret(project, id string) error
+	CreateSecret(project, id string, locations []string) error
+	GetSecretReplication(project, id string) ([]string, error)
 	UpsertSecret(project, id string, data []byte) (string, error)
 	GetCreateTime(project, id, version string) (time.Time, error)
+	GetLatestVersion(project, id string) (string, error)
+	ListEnabledVersions(project, id string) ([]string, error)
+	ListSecretVersions(project, id string) (map[string]secretmanagerpb.SecretVersion_State, error)
 	GetSecretLabels(project, id string) (map[string]string, error)
 	GetSecretVersionData(project, id, version string) ([]byte, error)
 	GetSecretVersionState(project, id, version string) (secretmanagerpb.SecretVersion_State, error)
@@ -64,7 +100,7 @@ func (cl *Client) ValidateSecret(project, id string) error {
 	getReq := &secretmanagerpb.GetSecretRequest{
 		Name: name,
 	}
-	_, err := cl.GetSecret(ctx, getReq)
+	_, err := cl.gsm().GetSecret(ctx, getReq)
 
 	return err
 }
@@ -77,33 +113,77 @@ func (cl *Client) ValidateSecretVersion(project, id, version string) error {
 	getReq := &secretmanagerpb.GetSecretVersionRequest{
 		Name: name,
 	}
-	_, err := cl.GetSecretVersion(ctx, getReq)
+	_, err := cl.gsm().GetSecretVersion(ctx, getReq)
 
 	return err
 }
 
 // CreateSecret creates an empty secret specified by project, id.
+// The secret is replicated to the given locations, or automatically if no locations are given.
 // It returns nil if successful, otherwise error.
-func (cl *Client) CreateSecret(project, id string) error {
+func (cl *Client) CreateSecret(project, id string, locations []string) error {
 	parent := "projects/" + project
 
+	replication := &secretmanagerpb.Replication{
+		Replication: &secretmanagerpb.Replication_Automatic_{
+			Automatic: &secretmanagerpb.Replication_Automatic{},
+		},
+	}
+	if len(locations) != 0 {
+		replicas := []*secretmanagerpb.Replication_UserManaged_Replica{}
+		for _, location := range locations {
+			replicas = append(replicas, &secretmanagerpb.Replication_UserManaged_Replica{
+				Location: location,
+			})
+		}
+		replication.Replication = &secretmanagerpb.Replication_UserManaged_{
+			UserManaged: &secretmanagerpb.Replication_UserManaged{
+				Replicas: replicas,
+			},
+		}
+	}
+
 	// Create secret
 	req := &secretmanagerpb.CreateSecretRequest{
 		Parent:   parent,
 		SecretId: id,
 		Secret: &secretmanagerpb.Secret{
-			Replication: &secretmanagerpb.Replication{
-				Replication: &secretmanagerpb.Replication_Automatic_{
-					Automatic: &secretmanagerpb.Replication_Automatic{},
-				},
-			},
+			Replication: replication,
 		},
 	}
-	_, err := cl.Client.CreateSecret(context.TODO(), req)
+	_, err := cl.gsm().CreateSecret(context.TODO(), req)
 
 	return err
 }
 
+// GetSecretReplication gets the replication policy of the secret specified by project, id.
+// Returns the replica locations of a user-managed replication, nil for an automatic replication,
+// or error if the secret doesn't exist.
+func (cl *Client) GetSecretReplication(project, id string) ([]string, error) {
+	ctx := context.TODO()
+	name := "projects/" + project + "/secrets/" + id
+
+	getReq := &secretmanagerpb.GetSecretRequest{
+		Name: name,
+	}
+	getResult, err := cl.gsm().GetSecret(ctx, getReq)
+	if err != nil {
+		return nil, err
+	}
+
+	userManaged := getResult.GetReplication().GetUserManaged()
+	if userManaged == nil {
+		return nil, nil
+	}
+
+	locations := []string{}
+	for _, replica := range userManaged.GetReplicas() {
+		locations = append(locations, replica.GetLocation())
+	}
+
+	return locations, nil
+}
+
 // UpsertSecret adds a new version to the secret specified by project, id.
 // It inserts a new secret if id doesn't already exist.
 // If successful the latest version will have 'data' as its secret value,
@@ -115,7 +195,7 @@ func (cl *Client) UpsertSecret(project, id string, data []byte) (string, error)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			// Create secret
-			err := cl.CreateSecret(project, id)
+			err := cl.CreateSecret(project, id, nil)
 			if err != nil {
 				return "", err
 			}
@@ -131,7 +211,7 @@ func (cl *Client) UpsertSecret(project, id string, data []byte) (string, error)
 			Data: data,
 		},
 	}
-	verResp, err := cl.AddSecretVersion(context.TODO(), verReq)
+	verResp, err := cl.gsm().AddSecretVersion(context.TODO(), verReq)
 	if err != nil {
 		return "", err
 	}
@@ -153,7 +233,7 @@ func (cl *Client) GetCreateTime(project, id, version string) (time.Time, error)
 	getReq := &secretmanagerpb.GetSecretVersionRequest{
 		Name: name,
 	}
-	getResult, err := cl.GetSecretVersion(ctx, getReq)
+	getResult, err := cl.gsm().GetSecretVersion(ctx, getReq)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -166,6 +246,82 @@ func (cl *Client) GetCreateTime(project, id, version string) (time.Time, error)
 	return createTime, nil
 }
 
+// GetLatestVersion gets the number of the latest version of the secret specified by project, id.
+// Returns the version if successful, otherwise error.
+func (cl *Client) GetLatestVersion(project, id string) (string, error) {
+	ctx := context.TODO()
+	name := "projects/" + project + "/secrets/" + id + "/versions/latest"
+
+	getReq := &secretmanagerpb.GetSecretVersionRequest{
+		Name: name,
+	}
+	getResult, err := cl.gsm().GetSecretVersion(ctx, getReq)
+	if err != nil {
+		return "", err
+	}
+
+	// the name of the version is in the format of projects/*/secrets/*/versions/<version>
+	parts := strings.Split(getResult.Name, "/")
+	return parts[len(parts)-1], nil
+}
+
+// ListEnabledVersions lists the versions of the secret specified by project, id, that are in the ENABLED state.
+// Returns the versions if successful, otherwise error.
+func (cl *Client) ListEnabledVersions(project, id string) ([]string, error) {
+	ctx := context.TODO()
+	listReq := &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: "projects/" + project + "/secrets/" + id,
+	}
+
+	versions := []string{}
+	it := cl.gsm().ListSecretVersions(ctx, listReq)
+	for {
+		version, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if version.State != secretmanagerpb.SecretVersion_ENABLED {
+			continue
+		}
+		// the name of the version is in the format of projects/*/secrets/*/versions/<version>
+		parts := strings.Split(version.Name, "/")
+		versions = append(versions, parts[len(parts)-1])
+	}
+
+	return versions, nil
+}
+
+// ListSecretVersions lists the versions of the secret specified by project, id, in any state.
+// Returns the (version: state) pairs if successful, otherwise error.
+func (cl *Client) ListSecretVersions(project, id string) (map[string]secretmanagerpb.SecretVersion_State, error) {
+	ctx := context.TODO()
+	listReq := &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: "projects/" + project + "/secrets/" + id,
+	}
+
+	versions := map[string]secretmanagerpb.SecretVersion_State{}
+	it := cl.gsm().ListSecretVersions(ctx, listReq)
+	for {
+		version, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the name of the version is in the format of projects/*/secrets/*/versions/<version>
+		parts := strings.Split(version.Name, "/")
+		versions[parts[len(parts)-1]] = version.State
+	}
+
+	return versions, nil
+}
+
 // GetSecretLabels gets the labels of the secret specified by project, id.
 // Returns secret labels if successful, otherwise error
 func (cl *Client) GetSecretLabels(project, id string) (map[string]string, error) {
@@ -175,7 +331,7 @@ func (cl *Client) GetSecretLabels(project, id string) (map[string]string, error)
 	getReq := &secretmanagerpb.GetSecretRequest{
 		Name: name,
 	}
-	getResult, err := cl.GetSecret(ctx, getReq)
+	getResult, err := cl.gsm().GetSecret(ctx, getReq)
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +348,7 @@ func (cl *Client) GetSecretVersionData(project, id, version string) ([]byte, err
 	accReq := &secretmanagerpb.AccessSecretVersionRequest{
 		Name: name,
 	}
-	accResult, err := cl.Client.AccessSecretVersion(ctx, accReq)
+	accResult, err := cl.gsm().AccessSecretVersion(ctx, accReq)
 	if err != nil {
 		return nil, err
 	}
@@ -209,7 +365,7 @@ func (cl *Client) GetSecretVersionState(project, id, version string) (secretmana
 	getReq := &secretmanagerpb.GetSecretVersionRequest{
 		Name: name,
 	}
-	getResult, err := cl.GetSecretVersion(ctx, getReq)
+	getResult, err := cl.gsm().GetSecretVersion(ctx, getReq)
 
 	return getResult.State, err
 }
@@ -223,7 +379,7 @@ func (cl *Client) EnableSecretVersion(project, id, version string) error {
 	req := &secretmanagerpb.EnableSecretVersionRequest{
 		Name: name,
 	}
-	_, err := cl.Client.EnableSecretVersion(ctx, req)
+	_, err := cl.gsm().EnableSecretVersion(ctx, req)
 
 	return err
 }
@@ -237,7 +393,7 @@ func (cl *Client) DisableSecretVersion(project, id, version string) error {
 	req := &secretmanagerpb.DisableSecretVersionRequest{
 		Name: name,
 	}
-	_, err := cl.Client.DisableSecretVersion(ctx, req)
+	_, err := cl.gsm().DisableSecretVersion(ctx, req)
 
 	return err
 }
@@ -251,7 +407,7 @@ func (cl *Client) DestroySecretVersion(project, id, version string) error {
 	req := &secretmanagerpb.DestroySecretVersionRequest{
 		Name: name,
 	}
-	_, err := cl.Client.DestroySecretVersion(ctx, req)
+	_, err := cl.gsm().DestroySecretVersion(ctx, req)
 
 	return err
 }
@@ -284,7 +440,7 @@ func (cl *Client) UpsertSecretLabel(project, id, key, val string) error {
 			Paths: []string{"labels"},
 		},
 	}
-	_, err = cl.UpdateSecret(ctx, updateReq)
+	_, err = cl.gsm().UpdateSecret(ctx, updateReq)
 
 	return err
 }
@@ -312,7 +468,7 @@ func (cl *Client) DeleteSecretLabel(project, id, key string) error {
 			Paths: []string{"labels"},
 		},
 	}
-	_, err = cl.UpdateSecret(ctx, updateReq)
+	_, err = cl.gsm().UpdateSecret(ctx, updateReq)
 
 	return err
 }
@@ -19,14 +19,18 @@ package config
 import (
 	"context"
 	"fmt"
-	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog"
-	prow "k8s.io/test-infra/prow/config"
-	"path/filepath"
+	"sigs.k8s.io/k8s-gsm-tools/configwatch"
 	"sync"
+	"time"
 )
 
 type Agent struct {
+	// WatchOptions tunes how quickly WatchConfig() picks up a change of the config files.
+	WatchOptions configwatch.Options
+	// MinRefreshInterval is the floor of the refresh intervals of the loaded configs. Defaults to DefaultMinRefreshInterval.
+	MinRefreshInterval time.Duration
+
 	mutex  sync.RWMutex
 	config *RotatedSecretConfig
 	cron   *Cron
@@ -34,25 +38,26 @@ type Agent struct {
 
 func NewAgent() *Agent {
 	agent := &Agent{
-		config: &RotatedSecretConfig{},
-		cron:   NewCron(),
+		config:             &RotatedSecretConfig{},
+		cron:               NewCron(),
+		MinRefreshInterval: DefaultMinRefreshInterval,
 	}
 	agent.cron.Start()
 	return agent
 }
 
-// WatchConfig will begin watching the config file at the provided configPath.
+// WatchConfig will begin watching the config files at the provided configPath, a file, a directory or a glob pattern.
 // If the first load or valiadate fails, WatchConfig will return the error and abort.
 // Future load or valiadate failures will be logged but continue to attempt loading config.
 func (a *Agent) WatchConfig(configPath string) (func(ctx context.Context), error) {
 	updateFunc := func() error {
 		newConfig := &RotatedSecretConfig{}
-		err := newConfig.LoadFrom(configPath)
+		err := newConfig.Load(configPath)
 		if err != nil {
 			return fmt.Errorf("Fail to load config: %s", err)
 		}
 
-		err = newConfig.Validate()
+		err = newConfig.Validate(a.MinRefreshInterval)
 		if err != nil {
 			return fmt.Errorf("Fail to validate config: %s", err)
 		}
@@ -71,7 +76,7 @@ func (a *Agent) WatchConfig(configPath string) (func(ctx context.Context), error
 		return nil, err
 	}
 
-	runFunc, err := prow.GetCMMountWatcher(updateFunc, errFunc, filepath.Dir(configPath))
+	runFunc, err := configwatch.Watch(configPath, a.WatchOptions, updateFunc, errFunc)
 
 	return runFunc, err
 }
@@ -82,15 +87,24 @@ func (a *Agent) Config() *RotatedSecretConfig {
 	return a.config
 }
 
-func (a *Agent) CronQueuedSecrets() sets.String {
+func (a *Agent) CronQueuedSecrets() map[SpecID]bool {
 	a.mutex.RLock()
 	defer a.mutex.RUnlock()
 	return a.cron.QueuedSecrets()
 }
 
+// Ready returns an error until a valid config is loaded, for the readiness of the command.
+func (a *Agent) Ready() error {
+	if a.Config() == nil {
+		return fmt.Errorf("No valid config loaded")
+	}
+	return nil
+}
+
 func (a *Agent) Set(newConfig *RotatedSecretConfig) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
 	a.config = newConfig
+	recordConfigReload(newConfig)
 }
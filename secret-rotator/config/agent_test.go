@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+	"time"
+)
+
+func TestSetUpdatesMetrics(t *testing.T) {
+	agent := &Agent{}
+
+	var testcases = []struct {
+		name     string
+		config   *RotatedSecretConfig
+		expected float64
+	}{
+		{
+			name: "Config with two specs.",
+			config: &RotatedSecretConfig{
+				Specs: []RotatedSecretSpec{{}, {}},
+			},
+			expected: 2,
+		},
+		{
+			name: "Config shrinks to one spec.",
+			config: &RotatedSecretConfig{
+				Specs: []RotatedSecretSpec{{}},
+			},
+			expected: 1,
+		},
+		{
+			name:     "Empty config.",
+			config:   &RotatedSecretConfig{},
+			expected: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			before := float64(time.Now().Unix())
+
+			agent.Set(tc.config)
+
+			specs := testutil.ToFloat64(configSpecs)
+			if specs != tc.expected {
+				t.Errorf("Expected %v specs, but got %v.", tc.expected, specs)
+			}
+
+			reloaded := testutil.ToFloat64(configLastReloadTimestamp)
+			if reloaded < before {
+				t.Errorf("Expected last reload timestamp no earlier than %v, but got %v.", before, reloaded)
+			}
+		})
+	}
+}
@@ -16,17 +16,17 @@ package config
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	cron "gopkg.in/robfig/cron.v2"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
-	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // Cron is a wrapper for cron.Cron
 // It is responsible for refreshing rotated secrets with cron as refreshStrategy
 type Cron struct {
 	cronAgent *cron.Cron
-	secrets   map[string]*secretStatus
+	secrets   map[SpecID]*secretStatus
 	lock      sync.Mutex
 }
 
@@ -45,7 +45,7 @@ type secretStatus struct {
 func NewCron() *Cron {
 	return &Cron{
 		cronAgent: cron.New(),
-		secrets:   map[string]*secretStatus{},
+		secrets:   map[SpecID]*secretStatus{},
 	}
 }
 
@@ -59,16 +59,16 @@ func (c *Cron) Stop() {
 	c.cronAgent.Stop()
 }
 
-// QueuedSecrets returns a set of secret names that need to be triggered
+// QueuedSecrets returns the set of secrets that need to be triggered
 // and resets trigger in secretStatus
-func (c *Cron) QueuedSecrets() sets.String {
+func (c *Cron) QueuedSecrets() map[SpecID]bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	res := sets.NewString()
+	res := map[SpecID]bool{}
 	for k, v := range c.secrets {
 		if v.triggered {
-			res.Insert(k)
+			res[k] = true
 		}
 		c.secrets[k].triggered = false
 	}
@@ -87,19 +87,17 @@ func (c *Cron) SyncConfig(cfg *RotatedSecretConfig) error {
 		}
 	}
 
-	periodicNames := sets.NewString()
+	periodicIDs := map[SpecID]bool{}
 	for _, spec := range cfg.Specs {
-		periodicNames.Insert(spec.String())
-	}
-
-	existing := sets.NewString()
-	for k := range c.secrets {
-		existing.Insert(k)
+		periodicIDs[spec.ID()] = true
 	}
 
 	var removalErrors []error
-	for _, secret := range existing.Difference(periodicNames).List() {
-		if err := c.removeSecret(secret); err != nil {
+	for id := range c.secrets {
+		if periodicIDs[id] {
+			continue
+		}
+		if err := c.removeSecret(id); err != nil {
 			removalErrors = append(removalErrors, err)
 		}
 	}
@@ -108,21 +106,21 @@ func (c *Cron) SyncConfig(cfg *RotatedSecretConfig) error {
 }
 
 // HasSecret returns if a secret-refresh has been scheduled in cronAgent or not
-func (c *Cron) HasSecret(name string) bool {
+func (c *Cron) HasSecret(id SpecID) bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	_, ok := c.secrets[name]
+	_, ok := c.secrets[id]
 	return ok
 }
 
 func (c *Cron) addPeriodic(spec RotatedSecretSpec) error {
-	if secret, ok := c.secrets[spec.String()]; ok {
+	if secret, ok := c.secrets[spec.ID()]; ok {
 		if secret.cronStr == spec.Refresh.Cron {
 			return nil
 		}
 		// cron updated, remove old entry
-		if err := c.removeSecret(spec.String()); err != nil {
+		if err := c.removeSecret(spec.ID()); err != nil {
 			return err
 		}
 	}
@@ -132,7 +130,7 @@ func (c *Cron) addPeriodic(spec RotatedSecretSpec) error {
 		return nil
 	}
 
-	if err := c.addSecret(spec.String(), spec.Refresh.Cron); err != nil {
+	if err := c.addSecret(spec.ID(), spec.Refresh.Cron); err != nil {
 		return err
 	}
 
@@ -140,20 +138,20 @@ func (c *Cron) addPeriodic(spec RotatedSecretSpec) error {
 }
 
 // addSecret adds a cron entry for a secret-refresh to cronAgent
-func (c *Cron) addSecret(name, cron string) error {
-	id, err := c.cronAgent.AddFunc("TZ=UTC "+cron, func() {
+func (c *Cron) addSecret(id SpecID, cron string) error {
+	entryID, err := c.cronAgent.AddFunc(utcCron(cron), func() {
 		c.lock.Lock()
 		defer c.lock.Unlock()
 
-		c.secrets[name].triggered = true
+		c.secrets[id].triggered = true
 	})
 
 	if err != nil {
-		return fmt.Errorf("cronAgent fails to add refresh for %s with cron %s: %v", name, cron, err)
+		return fmt.Errorf("cronAgent fails to add refresh for %s with cron %s: %v", id, cron, err)
 	}
 
-	c.secrets[name] = &secretStatus{
-		entryID:   id,
+	c.secrets[id] = &secretStatus{
+		entryID:   entryID,
 		cronStr:   cron,
 		triggered: false,
 	}
@@ -162,12 +160,30 @@ func (c *Cron) addSecret(name, cron string) error {
 }
 
 // removeSecret removes the secret-refresh from cronAgent
-func (c *Cron) removeSecret(name string) error {
-	secret, ok := c.secrets[name]
+func (c *Cron) removeSecret(id SpecID) error {
+	secret, ok := c.secrets[id]
 	if !ok {
-		return fmt.Errorf("job %s has not been added to cronAgent yet", name)
+		return fmt.Errorf("job %s has not been added to cronAgent yet", id)
 	}
 	c.cronAgent.Remove(secret.entryID)
-	delete(c.secrets, name)
+	delete(c.secrets, id)
 	return nil
 }
+
+// utcCron returns the cron schedule of cron evaluated in UTC, as scheduled by the cron agent.
+func utcCron(cron string) string {
+	return "TZ=UTC " + cron
+}
+
+// NextCronTime returns the first time after now the Cron of the refresh strategy fires, as scheduled by the cron agent.
+// Returns the zero time if Cron is unset.
+func (r RefreshStrategy) NextCronTime(now time.Time) (time.Time, error) {
+	if r.Cron == "" {
+		return time.Time{}, nil
+	}
+	schedule, err := cron.Parse(utcCron(r.Cron))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid cron %s: %v", r.Cron, err)
+	}
+	return schedule.Next(now), nil
+}
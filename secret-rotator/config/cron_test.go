@@ -60,11 +60,11 @@ func TestSyncConfig(t *testing.T) {
 		},
 	}
 
-	shouldHaveInit := map[string]bool{
-		"SecretManager:/projects/project-1/secrets/secret-1": false,
-		"SecretManager:/projects/project-2/secrets/secret-2": true,
-		"SecretManager:/projects/project-3/secrets/secret-3": true,
-		"SecretManager:/projects/project-4/secrets/secret-4": true,
+	shouldHaveInit := map[SpecID]bool{
+		SpecID{"project-1", "secret-1"}: false,
+		SpecID{"project-2", "secret-2"}: true,
+		SpecID{"project-3", "secret-3"}: true,
+		SpecID{"project-4", "secret-4"}: true,
 	}
 
 	newConfig := &RotatedSecretConfig{
@@ -104,20 +104,20 @@ func TestSyncConfig(t *testing.T) {
 		},
 	}
 
-	shouldHaveAfter := map[string]bool{
-		"SecretManager:/projects/project-1/secrets/secret-1": true,
-		"SecretManager:/projects/project-2/secrets/secret-2": false,
-		"SecretManager:/projects/project-3/secrets/secret-3": true,
-		"SecretManager:/projects/project-4/secrets/secret-4": true,
+	shouldHaveAfter := map[SpecID]bool{
+		SpecID{"project-1", "secret-1"}: true,
+		SpecID{"project-2", "secret-2"}: false,
+		SpecID{"project-3", "secret-3"}: true,
+		SpecID{"project-4", "secret-4"}: true,
 	}
 
-	shouldUpdateAfter := map[string]bool{
-		"SecretManager:/projects/project-3/secrets/secret-3": false,
-		"SecretManager:/projects/project-4/secrets/secret-4": true,
+	shouldUpdateAfter := map[SpecID]bool{
+		SpecID{"project-3", "secret-3"}: false,
+		SpecID{"project-4", "secret-4"}: true,
 	}
 
 	c := NewCron()
-	cronIDs := map[string]cron.EntryID{}
+	cronIDs := map[SpecID]cron.EntryID{}
 
 	// initial config
 	if err := c.SyncConfig(initConfig); err != nil {
@@ -190,11 +190,11 @@ func TestTrigger(t *testing.T) {
 		},
 	}
 
-	shouldBeTriggered := map[string]bool{
-		"SecretManager:/projects/project-1/secrets/secret-1": false,
-		"SecretManager:/projects/project-2/secrets/secret-2": true,
-		"SecretManager:/projects/project-3/secrets/secret-3": true,
-		"SecretManager:/projects/project-4/secrets/secret-4": true,
+	shouldBeTriggered := map[SpecID]bool{
+		SpecID{"project-1", "secret-1"}: false,
+		SpecID{"project-2", "secret-2"}: true,
+		SpecID{"project-3", "secret-3"}: true,
+		SpecID{"project-4", "secret-4"}: true,
 	}
 
 	c := NewCron()
@@ -215,10 +215,103 @@ func TestTrigger(t *testing.T) {
 	triggered := c.QueuedSecrets()
 
 	for secret, should := range shouldBeTriggered {
-		if !should && triggered.Has(secret) {
+		if !should && triggered[secret] {
 			t.Errorf("should not have triggered secret '%s'", secret)
-		} else if should && !triggered.Has(secret) {
+		} else if should && !triggered[secret] {
 			t.Errorf("should have triggered secret '%s'", secret)
 		}
 	}
 }
+
+func TestSpecIDCollision(t *testing.T) {
+	// both specs render to "SecretManager:/projects/project-1/secrets/a/secrets/b"
+	cfg := &RotatedSecretConfig{
+		Specs: []RotatedSecretSpec{
+			{
+				Project: "project-1/secrets/a",
+				Secret:  "b",
+				Refresh: RefreshStrategy{
+					Cron: "0 0 * * 1",
+				},
+			},
+			{
+				Project: "project-1",
+				Secret:  "a/secrets/b",
+				Refresh: RefreshStrategy{
+					Cron: "0 8 * * 1",
+				},
+			},
+		},
+	}
+
+	if cfg.Specs[0].String() != cfg.Specs[1].String() {
+		t.Fatalf("Expected colliding strings, but got %s and %s", cfg.Specs[0], cfg.Specs[1])
+	}
+
+	if cfg.Specs[0].ID() == cfg.Specs[1].ID() {
+		t.Errorf("Expected different SpecIDs, but both are %s", cfg.Specs[0].ID())
+	}
+
+	c := NewCron()
+
+	if err := c.SyncConfig(cfg); err != nil {
+		t.Fatalf("error sync config: %v", err)
+	}
+
+	for _, spec := range cfg.Specs {
+		if !c.HasSecret(spec.ID()) {
+			t.Errorf("should have secret '%s' in cron", spec.ID())
+		}
+	}
+
+	if len(c.secrets) != len(cfg.Specs) {
+		t.Errorf("Expected %d secrets in cron, but got %d", len(cfg.Specs), len(c.secrets))
+	}
+}
+
+func TestNextCronTime(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		cron       string
+		now        time.Time
+		expectNext time.Time
+		expectErr  bool
+	}{
+		{
+			name:       "Weekly cron. Should fire next Sunday at midnight UTC.",
+			cron:       "0 0 0 * * 0",
+			now:        time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectNext: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Now in another time zone. Should still fire at midnight UTC.",
+			cron:       "0 0 0 * * *",
+			now:        time.Date(2000, 1, 1, 12, 0, 0, 0, time.FixedZone("UTC+8", 8*3600)),
+			expectNext: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "No cron. Should return the zero time.",
+			cron:       "",
+			now:        time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectNext: time.Time{},
+		},
+		{
+			name:      "Invalid cron. Should return error.",
+			cron:      "0 0 *",
+			now:       time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC),
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			next, err := RefreshStrategy{Cron: tc.cron}.NextCronTime(tc.now)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("Expected error %v, but got %v.", tc.expectErr, err)
+			}
+			if !next.Equal(tc.expectNext) {
+				t.Errorf("Expected next fire time %s, but got %s.", tc.expectNext, next)
+			}
+		})
+	}
+}
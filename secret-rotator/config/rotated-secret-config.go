@@ -14,18 +14,82 @@ limitations under the License.
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sigs.k8s.io/k8s-gsm-tools/configwatch"
+	"sigs.k8s.io/k8s-gsm-tools/gsmoption"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/svckey"
+	"sort"
+	"strconv"
+	"text/template"
 	"time"
 )
 
+// DefaultMinRefreshInterval is the default floor of RefreshStrategy.Interval passed to Validate() and WithLabelOverrides(),
+// guarding against accidental rapid rotation. It can be lowered, e.g. by --allow-short-intervals.
+const DefaultMinRefreshInterval = time.Hour
+
+// versionLabelPattern matches the "v<version>" labels attached by the rotator.
+// The prefix "v" is needed as Secret Manager labels need to begin with a lower case letter,
+// and versions are numbered from 1 without leading zeros.
+var versionLabelPattern = regexp.MustCompile(`^v[1-9][0-9]*$`)
+
+// VersionLabel returns the key of the label attached by the rotator for version, i.e. "v<version>".
+func VersionLabel(version string) string {
+	return "v" + version
+}
+
+// ackLabelPrefix prefixes the AckLabel() labels set by the consumers.
+const ackLabelPrefix = "acked-v"
+
+// ackLabelPattern matches the AckLabel() labels set by the consumers.
+var ackLabelPattern = regexp.MustCompile(`^` + ackLabelPrefix + `[1-9][0-9]*$`)
+
+// AckLabel returns the key of the label acknowledging the adoption of version by the consumers, i.e. "acked-v<version>".
+// Its value is not read, and can e.g. record the consumer.
+func AckLabel(version string) string {
+	return ackLabelPrefix + version
+}
+
+// ParseAckLabel returns the version acknowledged by the label key,
+// and false if key is not in the format of AckLabel().
+func ParseAckLabel(key string) (int, bool) {
+	if !ackLabelPattern.MatchString(key) {
+		return 0, false
+	}
+	version, err := strconv.Atoi(key[len(ackLabelPrefix):])
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
+// ParseVersionLabel returns the version referenced by the label key,
+// and false if key is not in the format of VersionLabel().
+func ParseVersionLabel(key string) (int, bool) {
+	if !versionLabelPattern.MatchString(key) {
+		return 0, false
+	}
+	version, err := strconv.Atoi(key[1:])
+	if err != nil {
+		return 0, false
+	}
+	return version, true
+}
+
 // RotatedSecretConfig contains the slice of RotatedSecretSpecs
 type RotatedSecretConfig struct {
 	Specs []RotatedSecretSpec `yaml:"specs"`
+	// Paused stops all refreshes and deactivations, e.g. during a maintenance freeze,
+	// while the config is still loaded and validated.
+	Paused bool `yaml:"paused,omitempty"`
 }
 
 // RotatedSecretSpec specifies a single rotated secret
@@ -34,7 +98,131 @@ type RotatedSecretSpec struct {
 	Secret      string            `yaml:"secret"`
 	Type        RotatedSecretType `yaml:"type"`
 	Refresh     RefreshStrategy   `yaml:"refreshStrategy"`
-	GracePeriod time.Duration     `yaml:"gracePeriod"`
+	GracePeriod time.Duration     `yaml:"gracePeriod,omitempty"`
+	// DestructionDelay enables a two-phase deactivation: a version out of GracePeriod is disabled first,
+	// and only destroyed once DestructionDelay has elapsed since disabling, so that it can still be re-enabled.
+	// Versions are destroyed right away if DestructionDelay is zero.
+	DestructionDelay time.Duration `yaml:"destructionDelay,omitempty"`
+	// VerifyBeforePublish verifies that a newly provisioned secret is usable before adding it as the latest version.
+	// It is only supported by types whose provisioner can verify its secrets, e.g. serviceAccountKey.
+	VerifyBeforePublish bool `yaml:"verifyBeforePublish,omitempty"`
+	// Replication specifies the replication policy of the secret, if created by the rotator.
+	Replication ReplicationSpec `yaml:"replication,omitempty"`
+	// LabelOverrides reads the refresh interval and the grace period from the RefreshIntervalLabel and GracePeriodLabel
+	// labels of the Secret Manager secret if present, so that the cadence can live with the secret.
+	// The spec is used as default for absent labels.
+	LabelOverrides bool `yaml:"labelOverrides,omitempty"`
+	// Labels are attached to the Secret Manager secret, e.g. to record its owner or the LabelOverrides labels.
+	// They cannot collide with the labels maintained by the rotator and the consumers, e.g. the "v<version>" labels.
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// PayloadTemplate is a Go template rendering the payload stored in Secret Manager from the provisioned secret,
+	// e.g. a config blob embedding a new credential with static fields. See PayloadData for the available fields.
+	// The provisioned secret is stored as is if PayloadTemplate is empty.
+	PayloadTemplate string `yaml:"payloadTemplate,omitempty"`
+	// VersionStore selects where the rotator keeps the (version: id) pairs of the versions it provisions,
+	// one of VersionStoreLabels (default) or VersionStoreSecret.
+	VersionStore string `yaml:"versionStore,omitempty"`
+	// KeepVersions keeps the KeepVersions most recent versions of the secret, not destroyed, active:
+	// older versions are deactivated regardless of time, or once GracePeriod has also elapsed if set.
+	// Versions are only retained by GracePeriod if KeepVersions is zero.
+	KeepVersions int `yaml:"keepVersions,omitempty"`
+	// AckBasedDeactivation deactivates the versions once their consumers acknowledge a newer version, instead of after GracePeriod.
+	// Deactivation is time-based if AckBasedDeactivation is nil.
+	AckBasedDeactivation *AckBasedDeactivation `yaml:"ackBasedDeactivation,omitempty"`
+	// AdoptExistingKey brings an existing secret under management, e.g. a key created manually before onboarding:
+	// if the secret has versions but none provisioned by the rotator, the provisioned secret held by its latest version
+	// is looked up with the provisioner and recorded in the version store, so that it is deactivated once rotated.
+	// It is only supported by types whose provisioner can adopt its secrets, e.g. serviceAccountKey.
+	AdoptExistingKey bool `yaml:"adoptExistingKey,omitempty"`
+	// PreDeactivateProbe checks that the consumers are healthy on the newer versions before a version is deactivated,
+	// postponing its deactivation to the next rotation cycle while the probe fails. No probe is run if nil.
+	PreDeactivateProbe *PreDeactivateProbe `yaml:"preDeactivateProbe,omitempty"`
+}
+
+// AckBasedDeactivation gates the deactivation of a version on an AckLabel of any newer version
+// on the Secret Manager secret, set by the consumers once they have adopted that version.
+type AckBasedDeactivation struct {
+	// MaxWait falls back to time-based deactivation: a version is deactivated once MaxWait has elapsed
+	// since the creation of its next version, even without acknowledgement.
+	// Versions wait for an acknowledgement indefinitely if MaxWait is zero.
+	MaxWait time.Duration `yaml:"maxWait,omitempty"`
+}
+
+// DefaultProbeTimeout is the timeout of a PreDeactivateProbe if its Timeout is unset.
+const DefaultProbeTimeout = 30 * time.Second
+
+// PreDeactivateProbe is a health signal of the consumers of a rotated secret.
+// One and only one of HTTP and Command should be set.
+type PreDeactivateProbe struct {
+	// HTTP is the URL of a health endpoint, requested with GET. The probe passes on a 2xx response.
+	HTTP string `yaml:"http,omitempty"`
+	// Command is run with the project, the secret and the version to deactivate in the
+	// ROTATED_SECRET_PROJECT, ROTATED_SECRET_NAME and ROTATED_SECRET_VERSION environment variables.
+	// The probe passes if it exits with 0.
+	Command []string `yaml:"command,omitempty"`
+	// Timeout fails the probe if it has not completed in time. Defaults to DefaultProbeTimeout if zero.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Validate returns error if the probe is not exactly one of a valid HTTP URL or a command.
+func (p PreDeactivateProbe) Validate() error {
+	if (p.HTTP == "") == (len(p.Command) == 0) {
+		return fmt.Errorf("Exactly one of <http> and <command> should be set")
+	}
+	if p.HTTP != "" {
+		u, err := url.Parse(p.HTTP)
+		if err != nil {
+			return err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid URL %s, expected http(s)://<host>/<path>", p.HTTP)
+		}
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("Negative <timeout> %s", p.Timeout)
+	}
+	return nil
+}
+
+// PayloadData is the data of RotatedSecretSpec.PayloadTemplate.
+type PayloadData struct {
+	// ID is the id of the provisioned secret, e.g. the key-id of a service account key.
+	ID string
+	// Secret is the provisioned secret, e.g. the private-key data of a service account key.
+	Secret string
+}
+
+const (
+	// RefreshIntervalLabel overrides RefreshStrategy.Interval if LabelOverrides is set.
+	RefreshIntervalLabel = "refresh-interval"
+	// GracePeriodLabel overrides GracePeriod if LabelOverrides is set.
+	GracePeriodLabel = "grace-period"
+)
+
+const (
+	// VersionStoreLabels keeps the (version: id) pairs in the "v<version>" labels of the secret.
+	VersionStoreLabels = "labels"
+	// VersionStoreSecret keeps the (version: id) pairs as a JSON map in a companion secret,
+	// see RotatedSecretSpec.VersionStoreSecret(), avoiding the size and count limits of labels.
+	VersionStoreSecret = "secret"
+)
+
+// ReplicationSpec specifies the replication policy of a Secret Manager secret.
+// The secret is replicated automatically if no Locations are specified.
+// Note that the replication policy of a secret is immutable after creation.
+type ReplicationSpec struct {
+	Locations []string `yaml:"locations,omitempty"`
+}
+
+// SpecID identifies a RotatedSecretSpec by its Secret Manager secret.
+// It is comparable, and should be used as map key instead of formatted strings, which may collide.
+type SpecID struct {
+	Project string
+	Secret  string
+}
+
+func (id SpecID) String() string {
+	return fmt.Sprintf("projects/%s/secrets/%s", id.Project, id.Secret)
 }
 
 // RotatedSecretType specifies the type of the rotated secret
@@ -45,8 +233,9 @@ type RotatedSecretType struct {
 }
 
 // RefreshStrategy specifies the refeshing strategy for the rotated secret
-// One and only one of its fields can be assigned a value
-// others should be set to nil
+// At least one of its fields should be assigned a value.
+// If both are assigned, the secret is refreshed whenever Cron triggers,
+// and at the latest Interval after its latest version, i.e. Interval is a safety ceiling of the schedule.
 type RefreshStrategy struct {
 	Interval time.Duration `yaml:"interval,omitempty"`
 	Cron     string        `yaml:"cron,omitempty"`
@@ -61,6 +250,108 @@ func (secret RotatedSecretSpec) String() string {
 	return fmt.Sprintf("SecretManager:/projects/%s/secrets/%s", secret.Project, secret.Secret)
 }
 
+// ID returns the SpecID identifying the spec.
+func (secret RotatedSecretSpec) ID() SpecID {
+	return SpecID{
+		Project: secret.Project,
+		Secret:  secret.Secret,
+	}
+}
+
+// VersionStoreSecret returns the id of the companion secret holding the (version: id) pairs,
+// in the same project, if VersionStore is VersionStoreSecret.
+func (secret RotatedSecretSpec) VersionStoreSecret() string {
+	return secret.Secret + "-versions"
+}
+
+// RenderPayload renders the payload stored in Secret Manager for the provisioned secret data of id.
+// Returns data as is if the spec has no PayloadTemplate.
+func (secret RotatedSecretSpec) RenderPayload(id string, data []byte) ([]byte, error) {
+	if secret.PayloadTemplate == "" {
+		return data, nil
+	}
+
+	tmpl, err := template.New(secret.Secret).Option("missingkey=error").Parse(secret.PayloadTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload bytes.Buffer
+	err = tmpl.Execute(&payload, PayloadData{
+		ID:     id,
+		Secret: string(data),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payload.Bytes(), nil
+}
+
+// WithLabelOverrides returns the spec with the refresh interval and the grace period overridden
+// by the RefreshIntervalLabel and GracePeriodLabel labels if present.
+// Returns error if a label value is not a valid duration for the spec, or an interval shorter than minInterval.
+func (secret RotatedSecretSpec) WithLabelOverrides(labels map[string]string, minInterval time.Duration) (RotatedSecretSpec, error) {
+	if val, ok := labels[RefreshIntervalLabel]; ok {
+		if secret.Refresh.Interval == 0 {
+			return secret, fmt.Errorf("Label %s cannot add an <interval> to the <cron> of rotated secret: %s.", RefreshIntervalLabel, secret)
+		}
+		interval, err := time.ParseDuration(val)
+		if err != nil {
+			return secret, fmt.Errorf("Invalid label %s=%s of rotated secret: %s: %s", RefreshIntervalLabel, val, secret, err)
+		}
+		if interval <= 0 || interval < minInterval {
+			return secret, fmt.Errorf("Label %s=%s is shorter than the minimum %s for rotated secret: %s.", RefreshIntervalLabel, val, minInterval, secret)
+		}
+		secret.Refresh.Interval = interval
+	}
+
+	if val, ok := labels[GracePeriodLabel]; ok {
+		gracePeriod, err := time.ParseDuration(val)
+		if err != nil {
+			return secret, fmt.Errorf("Invalid label %s=%s of rotated secret: %s: %s", GracePeriodLabel, val, secret, err)
+		}
+		if gracePeriod < 0 {
+			return secret, fmt.Errorf("Negative label %s=%s of rotated secret: %s.", GracePeriodLabel, val, secret)
+		}
+		secret.GracePeriod = gracePeriod
+	}
+
+	return secret, nil
+}
+
+// MaxActiveVersions estimates the maximum number of versions not yet deactivated at the same time,
+// i.e. the latest version plus the versions within GracePeriod, or AckBasedDeactivation.MaxWait, and DestructionDelay.
+// Returns 0 if the refresh strategy is not an interval alone, since a cron schedule may refresh more often,
+// or if the versions may wait for an acknowledgement indefinitely.
+// With KeepVersions alone, the estimate is KeepVersions, whichever the refresh strategy.
+func (secret RotatedSecretSpec) MaxActiveVersions() int {
+	if secret.KeepVersions > 0 && secret.GracePeriod == 0 && secret.DestructionDelay == 0 {
+		return secret.KeepVersions
+	}
+	if secret.Refresh.Interval <= 0 || secret.Refresh.Cron != "" {
+		return 0
+	}
+	gracePeriod := secret.GracePeriod
+	if secret.AckBasedDeactivation != nil {
+		if secret.AckBasedDeactivation.MaxWait <= 0 {
+			return 0
+		}
+		gracePeriod = secret.AckBasedDeactivation.MaxWait
+	}
+	retention := gracePeriod + secret.DestructionDelay
+	// round up, a partial interval still keeps a version active
+	active := 1 + int((retention+secret.Refresh.Interval-1)/secret.Refresh.Interval)
+	if secret.KeepVersions > 0 {
+		// the kept versions, plus the versions deactivated but not destroyed yet
+		kept := secret.KeepVersions + int((secret.DestructionDelay+secret.Refresh.Interval-1)/secret.Refresh.Interval)
+		if kept > active {
+			active = kept
+		}
+	}
+	return active
+}
+
 // RotatedSecretType.Type() is used to obtain the provisioner of the type
 func (secretType RotatedSecretType) Type() string {
 	if secretType.ServiceAccountKey != nil {
@@ -81,7 +372,67 @@ func (secretType RotatedSecretType) Labels() map[string]string {
 	}
 }
 
+// RotatedSecretType.SupportsVerification() tells whether the provisioner of the type can verify new secrets, see <verifyBeforePublish>
+func (secretType RotatedSecretType) SupportsVerification() bool {
+	// TODO: other types of secrets
+	return secretType.ServiceAccountKey != nil
+}
+
 // LoadFrom loads the rotated secret configuration from a yaml, returns error if fails.
+// Load loads the rotated secret configuration at path, either a single yaml file, a directory (see LoadFromDir())
+// or a glob pattern (see LoadFromGlob()). Returns error if fails.
+func (config *RotatedSecretConfig) Load(path string) error {
+	files, err := configwatch.Files(path)
+	if err != nil {
+		return err
+	}
+	return config.loadFiles(files)
+}
+
+// LoadFromDir loads and merges the rotated secret configurations of the *.yaml and *.yml files in dir, see LoadFromGlob().
+func (config *RotatedSecretConfig) LoadFromDir(dir string) error {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("config is not a dir - %s", dir)
+	}
+	return config.Load(dir)
+}
+
+// LoadFromGlob loads the rotated secret configurations of the files matching pattern, and concatenates their specs in the lexical order of the files,
+// so that teams can own separate files, e.g. mounted from separate ConfigMaps.
+// The merged config is meant to be validated as a whole, e.g. for the specs duplicated across files.
+func (config *RotatedSecretConfig) LoadFromGlob(pattern string) error {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no config file matches %s", pattern)
+	}
+	sort.Strings(matches)
+	return config.loadFiles(matches)
+}
+
+// loadFiles loads the specs of each of files in order into config.
+// The config is paused if any of the files pauses it.
+func (config *RotatedSecretConfig) loadFiles(files []string) error {
+	specs := config.Specs
+	for _, file := range files {
+		part := &RotatedSecretConfig{}
+		err := part.LoadFrom(file)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, part.Specs...)
+		config.Paused = config.Paused || part.Paused
+	}
+	config.Specs = specs
+	return nil
+}
+
 func (config *RotatedSecretConfig) LoadFrom(file string) error {
 	stat, err := os.Stat(file)
 	if err != nil {
@@ -105,44 +456,133 @@ func (config *RotatedSecretConfig) LoadFrom(file string) error {
 	return nil
 }
 
-func (config *RotatedSecretConfig) Validate() error {
+// Validate checks the specs of the config, with refresh intervals no shorter than minInterval, see RotatedSecretSpec.Validate().
+func (config *RotatedSecretConfig) Validate(minInterval time.Duration) error {
 	if len(config.Specs) == 0 {
 		return fmt.Errorf("Empty secret sync configuration.")
 	}
 
-	existingSecrets := sets.NewString()
+	existingSecrets := map[SpecID]bool{}
 
 	for _, spec := range config.Specs {
-		switch {
-		case spec.Project == "":
-			return fmt.Errorf("Missing <project> field for rotated secret: %s.", spec)
-		case spec.Secret == "":
-			return fmt.Errorf("Missing <secret> field for rotated secret: %s.", spec)
+		err := spec.Validate(minInterval)
+		if err != nil {
+			return err
 		}
 
-		// validate there's only one refresh stategy
-		if spec.Refresh.Interval == 0 && spec.Refresh.Cron == "" {
-			return fmt.Errorf("Missing <refresh strategy> for rotated secret: %s.", spec)
-		} else if spec.Refresh.Interval != 0 && spec.Refresh.Cron != "" {
-			return fmt.Errorf("Multiple <refresh strategy> specified for rotated secret: %s.", spec)
+		if existingSecrets[spec.ID()] {
+			return fmt.Errorf("Duplicated specification for rotated secret: %s.", spec)
 		}
 
-		// validate there's only one secret type
-		// TODO: modify this after other types are supported
-		if spec.Type.ServiceAccountKey == nil {
-			return fmt.Errorf("Missing <type> for rotated secret: %s.", spec)
-		} else {
-			err := spec.Type.ServiceAccountKey.Validate()
-			if err != nil {
-				return fmt.Errorf("Invalid <serviceAccountKey> for rotated secret: %s: %s", spec, err)
-			}
+		existingSecrets[spec.ID()] = true
+	}
+
+	// the companion secrets would otherwise be rotated, or overwritten by the version store
+	for _, spec := range config.Specs {
+		if spec.VersionStore != VersionStoreSecret {
+			continue
 		}
+		companion := SpecID{Project: spec.Project, Secret: spec.VersionStoreSecret()}
+		if existingSecrets[companion] {
+			return fmt.Errorf("Version store %s of rotated secret %s collides with another rotated secret.", companion, spec)
+		}
+	}
+	return nil
+}
 
-		if existingSecrets.Has(spec.String()) {
-			return fmt.Errorf("Duplicated specification for rotated secret: %s.", spec)
+// Validate checks the structure of the spec on its own, with refresh intervals no shorter than minInterval.
+// Checks across specs, e.g. duplicated secrets, are left to RotatedSecretConfig.Validate().
+func (spec RotatedSecretSpec) Validate(minInterval time.Duration) error {
+	switch {
+	case spec.Project == "":
+		return fmt.Errorf("Missing <project> field for rotated secret: %s.", spec)
+	case spec.Secret == "":
+		return fmt.Errorf("Missing <secret> field for rotated secret: %s.", spec)
+	}
+
+	if err := gsmoption.ValidateProject(spec.Project); err != nil {
+		return fmt.Errorf("Invalid <project> field for rotated secret: %s: %s", spec, err)
+	}
+
+	// validate there's a refresh stategy, <interval> and <cron> together refresh on whichever comes first
+	if spec.Refresh.Interval == 0 && spec.Refresh.Cron == "" {
+		return fmt.Errorf("Missing <refresh strategy> for rotated secret: %s.", spec)
+	}
+
+	if spec.Refresh.Interval != 0 && spec.Refresh.Interval < minInterval {
+		return fmt.Errorf("<interval> %s is shorter than the minimum %s for rotated secret: %s.", spec.Refresh.Interval, minInterval, spec)
+	}
+
+	switch spec.VersionStore {
+	case "", VersionStoreLabels, VersionStoreSecret:
+	default:
+		return fmt.Errorf("Invalid <versionStore> %s for rotated secret: %s, should be one of %s or %s.", spec.VersionStore, spec, VersionStoreLabels, VersionStoreSecret)
+	}
+
+	if spec.DestructionDelay < 0 {
+		return fmt.Errorf("Negative <destructionDelay> for rotated secret: %s.", spec)
+	}
+
+	if spec.AckBasedDeactivation != nil && spec.AckBasedDeactivation.MaxWait < 0 {
+		return fmt.Errorf("Negative <maxWait> of <ackBasedDeactivation> for rotated secret: %s.", spec)
+	}
+
+	if spec.KeepVersions < 0 {
+		return fmt.Errorf("Invalid <keepVersions> %d for rotated secret: %s, should be at least 1.", spec.KeepVersions, spec)
+	}
+	if spec.KeepVersions > 0 && spec.AckBasedDeactivation != nil {
+		return fmt.Errorf("Field <keepVersions> cannot be used with <ackBasedDeactivation> for rotated secret: %s.", spec)
+	}
+
+	// validate there's only one secret type
+	// TODO: modify this after other types are supported
+	if spec.Type.ServiceAccountKey == nil {
+		return fmt.Errorf("Missing <type> for rotated secret: %s.", spec)
+	} else {
+		err := spec.Type.ServiceAccountKey.Validate()
+		if err != nil {
+			return fmt.Errorf("Invalid <serviceAccountKey> for rotated secret: %s: %s", spec, err)
+		}
+
+		if keys := spec.MaxActiveVersions(); keys > svckey.MaxKeysPerServiceAccount {
+			klog.Warningf("Rotated secret %s may keep up to %d active keys, exceeding the IAM limit of %d keys per service account.",
+				spec, keys, svckey.MaxKeysPerServiceAccount)
+		}
+	}
+
+	if spec.VerifyBeforePublish && !spec.Type.SupportsVerification() {
+		return fmt.Errorf("Field <verifyBeforePublish> is not supported by the type %s for rotated secret: %s.", spec.Type.Type(), spec)
+	}
+
+	// labels in the version scheme would be mistaken for versions by the rotator
+	for key := range spec.Labels {
+		if _, ok := ParseVersionLabel(key); ok {
+			return fmt.Errorf("Label %s of <labels> collides with the version labels for rotated secret: %s.", key, spec)
+		}
+		if _, ok := ParseAckLabel(key); ok {
+			return fmt.Errorf("Label %s of <labels> collides with the acknowledgement labels for rotated secret: %s.", key, spec)
 		}
+		if _, ok := spec.Type.Labels()[key]; ok {
+			return fmt.Errorf("Label %s of <labels> collides with the labels of <type> for rotated secret: %s.", key, spec)
+		}
+	}
 
-		existingSecrets.Insert(spec.String())
+	// the payload of a template cannot be traced back to the provisioned secret
+	if spec.AdoptExistingKey && spec.PayloadTemplate != "" {
+		return fmt.Errorf("Field <adoptExistingKey> cannot be used with <payloadTemplate> for rotated secret: %s.", spec)
+	}
+
+	if spec.PreDeactivateProbe != nil {
+		if err := spec.PreDeactivateProbe.Validate(); err != nil {
+			return fmt.Errorf("Invalid <preDeactivateProbe> for rotated secret: %s: %s", spec, err)
+		}
 	}
+
+	// render a placeholder, so that unknown fields are caught before the first rotation
+	_, err := spec.RenderPayload("id", []byte("secret"))
+	if err != nil {
+		return fmt.Errorf("Invalid <payloadTemplate> for rotated secret: %s: %s", spec, err)
+	}
+
 	return nil
 }
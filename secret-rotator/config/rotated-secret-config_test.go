@@ -0,0 +1,732 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/svckey"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateRefreshInterval(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		min       time.Duration
+		refresh   RefreshStrategy
+		expectErr bool
+	}{
+		{
+			name:      "Interval above the floor. Should pass.",
+			min:       time.Hour,
+			refresh:   RefreshStrategy{Interval: 24 * time.Hour},
+			expectErr: false,
+		},
+		{
+			name:      "Interval equal to the floor. Should pass.",
+			min:       time.Hour,
+			refresh:   RefreshStrategy{Interval: time.Hour},
+			expectErr: false,
+		},
+		{
+			name:      "Interval below the floor. Should return error.",
+			min:       time.Hour,
+			refresh:   RefreshStrategy{Interval: time.Minute},
+			expectErr: true,
+		},
+		{
+			name:      "Interval below the floor with short intervals allowed. Should pass.",
+			min:       0,
+			refresh:   RefreshStrategy{Interval: time.Minute},
+			expectErr: false,
+		},
+		{
+			name:      "Cron strategy. Should not be checked against the floor.",
+			min:       time.Hour,
+			refresh:   RefreshStrategy{Cron: "* * * * *"},
+			expectErr: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			config := &RotatedSecretConfig{
+				Specs: []RotatedSecretSpec{
+					{
+						Project: "project-1",
+						Secret:  "secret-1",
+						Type: RotatedSecretType{
+							ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+								Project:        "project-1",
+								ServiceAccount: "service-foo",
+							},
+						},
+						Refresh: tc.refresh,
+					},
+				},
+			}
+
+			err := config.Validate(tc.min)
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	svc := &svckey.ServiceAccountKeySpec{
+		Project:        "project-1",
+		ServiceAccount: "service-foo",
+	}
+
+	var testcases = []struct {
+		name      string
+		spec      RotatedSecretSpec
+		expectErr bool
+	}{
+		{
+			name: "Correct spec.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <secret> field.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Project number.",
+			spec: RotatedSecretSpec{
+				Project: "123456789012",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Malformed <project> with the projects/ prefix.",
+			spec: RotatedSecretSpec{
+				Project: "projects/project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Both <interval> and <cron>.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour, Cron: "0 * * * *"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <refresh strategy>.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Missing <type>.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid <serviceAccountKey>.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: &svckey.ServiceAccountKeySpec{Project: "project-1"}},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Negative <destructionDelay>.",
+			spec: RotatedSecretSpec{
+				Project:          "project-1",
+				Secret:           "secret-1",
+				Type:             RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:          RefreshStrategy{Interval: 24 * time.Hour},
+				DestructionDelay: -time.Hour,
+			},
+			expectErr: true,
+		},
+		{
+			name: "Negative <maxWait> of <ackBasedDeactivation>.",
+			spec: RotatedSecretSpec{
+				Project:              "project-1",
+				Secret:               "secret-1",
+				Type:                 RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:              RefreshStrategy{Interval: 24 * time.Hour},
+				AckBasedDeactivation: &AckBasedDeactivation{MaxWait: -time.Hour},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Correct <payloadTemplate>.",
+			spec: RotatedSecretSpec{
+				Project:         "project-1",
+				Secret:          "secret-1",
+				Type:            RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:         RefreshStrategy{Interval: 24 * time.Hour},
+				PayloadTemplate: `{"keyId": "{{.ID}}", "key": {{printf "%q" .Secret}}}`,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Unparsable <payloadTemplate>.",
+			spec: RotatedSecretSpec{
+				Project:         "project-1",
+				Secret:          "secret-1",
+				Type:            RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:         RefreshStrategy{Interval: 24 * time.Hour},
+				PayloadTemplate: `{{.Secret`,
+			},
+			expectErr: true,
+		},
+		{
+			name: "Unknown field in <payloadTemplate>.",
+			spec: RotatedSecretSpec{
+				Project:         "project-1",
+				Secret:          "secret-1",
+				Type:            RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:         RefreshStrategy{Interval: 24 * time.Hour},
+				PayloadTemplate: `password={{.Password}}`,
+			},
+			expectErr: true,
+		},
+		{
+			name: "<adoptExistingKey>.",
+			spec: RotatedSecretSpec{
+				Project:          "project-1",
+				Secret:           "secret-1",
+				Type:             RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:          RefreshStrategy{Interval: 24 * time.Hour},
+				AdoptExistingKey: true,
+			},
+			expectErr: false,
+		},
+		{
+			name: "<adoptExistingKey> with <payloadTemplate>.",
+			spec: RotatedSecretSpec{
+				Project:          "project-1",
+				Secret:           "secret-1",
+				Type:             RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:          RefreshStrategy{Interval: 24 * time.Hour},
+				PayloadTemplate:  `{"keyId": "{{.ID}}", "key": {{printf "%q" .Secret}}}`,
+				AdoptExistingKey: true,
+			},
+			expectErr: true,
+		},
+		{
+			name: "HTTP <preDeactivateProbe>.",
+			spec: RotatedSecretSpec{
+				Project:            "project-1",
+				Secret:             "secret-1",
+				Type:               RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:            RefreshStrategy{Interval: 24 * time.Hour},
+				PreDeactivateProbe: &PreDeactivateProbe{HTTP: "https://consumer.example.com/healthz"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Command <preDeactivateProbe>.",
+			spec: RotatedSecretSpec{
+				Project:            "project-1",
+				Secret:             "secret-1",
+				Type:               RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:            RefreshStrategy{Interval: 24 * time.Hour},
+				PreDeactivateProbe: &PreDeactivateProbe{Command: []string{"./check-consumers.sh"}, Timeout: time.Minute},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<preDeactivateProbe> with both <http> and <command>.",
+			spec: RotatedSecretSpec{
+				Project:            "project-1",
+				Secret:             "secret-1",
+				Type:               RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:            RefreshStrategy{Interval: 24 * time.Hour},
+				PreDeactivateProbe: &PreDeactivateProbe{HTTP: "https://consumer.example.com/healthz", Command: []string{"./check-consumers.sh"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<preDeactivateProbe> without scheme.",
+			spec: RotatedSecretSpec{
+				Project:            "project-1",
+				Secret:             "secret-1",
+				Type:               RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:            RefreshStrategy{Interval: 24 * time.Hour},
+				PreDeactivateProbe: &PreDeactivateProbe{HTTP: "consumer.example.com/healthz"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<keepVersions>.",
+			spec: RotatedSecretSpec{
+				Project:      "project-1",
+				Secret:       "secret-1",
+				Type:         RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:      RefreshStrategy{Interval: 24 * time.Hour},
+				KeepVersions: 2,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Negative <keepVersions>.",
+			spec: RotatedSecretSpec{
+				Project:      "project-1",
+				Secret:       "secret-1",
+				Type:         RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:      RefreshStrategy{Interval: 24 * time.Hour},
+				KeepVersions: -1,
+			},
+			expectErr: true,
+		},
+		{
+			name: "<keepVersions> with <ackBasedDeactivation>.",
+			spec: RotatedSecretSpec{
+				Project:              "project-1",
+				Secret:               "secret-1",
+				Type:                 RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:              RefreshStrategy{Interval: 24 * time.Hour},
+				KeepVersions:         2,
+				AckBasedDeactivation: &AckBasedDeactivation{},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Secret <versionStore>.",
+			spec: RotatedSecretSpec{
+				Project:      "project-1",
+				Secret:       "secret-1",
+				Type:         RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:      RefreshStrategy{Interval: 24 * time.Hour},
+				VersionStore: VersionStoreSecret,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Unknown <versionStore>.",
+			spec: RotatedSecretSpec{
+				Project:      "project-1",
+				Secret:       "secret-1",
+				Type:         RotatedSecretType{ServiceAccountKey: svc},
+				Refresh:      RefreshStrategy{Interval: 24 * time.Hour},
+				VersionStore: "annotations",
+			},
+			expectErr: true,
+		},
+		{
+			name: "Owner <labels>.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+				Labels:  map[string]string{"owner": "team-foo", RefreshIntervalLabel: "48h"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<labels> colliding with the version labels.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+				Labels:  map[string]string{"v2024": "release"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<labels> colliding with the acknowledgement labels.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+				Labels:  map[string]string{AckLabel("3"): "consumer-foo"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<labels> colliding with the labels of <type>.",
+			spec: RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type:    RotatedSecretType{ServiceAccountKey: svc},
+				Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+				Labels:  map[string]string{svckey.ServiceAccountLabel: "service-bar"},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			err := tc.spec.Validate(DefaultMinRefreshInterval)
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestValidateVersionStoreCollision(t *testing.T) {
+	svc := &svckey.ServiceAccountKeySpec{
+		Project:        "project-1",
+		ServiceAccount: "service-foo",
+	}
+
+	var testcases = []struct {
+		name      string
+		other     string
+		expectErr bool
+	}{
+		{
+			name:      "Distinct secrets. Should pass.",
+			other:     "secret-2",
+			expectErr: false,
+		},
+		{
+			name:      "Other secret is the version store. Should return error.",
+			other:     "secret-1-versions",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			config := &RotatedSecretConfig{
+				Specs: []RotatedSecretSpec{
+					{
+						Project:      "project-1",
+						Secret:       "secret-1",
+						Type:         RotatedSecretType{ServiceAccountKey: svc},
+						Refresh:      RefreshStrategy{Interval: 24 * time.Hour},
+						VersionStore: VersionStoreSecret,
+					},
+					{
+						Project: "project-1",
+						Secret:  tc.other,
+						Type:    RotatedSecretType{ServiceAccountKey: svc},
+						Refresh: RefreshStrategy{Interval: 24 * time.Hour},
+					},
+				},
+			}
+
+			err := config.Validate(DefaultMinRefreshInterval)
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestMaxActiveVersions(t *testing.T) {
+	var testcases = []struct {
+		name     string
+		spec     RotatedSecretSpec
+		expected int
+	}{
+		{
+			name: "Grace period shorter than the interval. Should keep two versions.",
+			spec: RotatedSecretSpec{
+				Refresh:     RefreshStrategy{Interval: 24 * time.Hour},
+				GracePeriod: time.Hour,
+			},
+			expected: 2,
+		},
+		{
+			name: "Grace period of several intervals. Should keep a version per partial interval.",
+			spec: RotatedSecretSpec{
+				Refresh:     RefreshStrategy{Interval: time.Hour},
+				GracePeriod: 150 * time.Minute,
+			},
+			expected: 4,
+		},
+		{
+			name: "Grace period and destruction delay beyond the IAM key limit. Should exceed the limit.",
+			spec: RotatedSecretSpec{
+				Refresh:          RefreshStrategy{Interval: time.Hour},
+				GracePeriod:      2 * time.Hour,
+				DestructionDelay: 24 * time.Hour,
+			},
+			expected: 27,
+		},
+		{
+			name: "Ack-based deactivation with a max wait. Should keep the versions within the max wait.",
+			spec: RotatedSecretSpec{
+				Refresh:              RefreshStrategy{Interval: time.Hour},
+				GracePeriod:          time.Hour,
+				AckBasedDeactivation: &AckBasedDeactivation{MaxWait: 3 * time.Hour},
+			},
+			expected: 4,
+		},
+		{
+			name: "Ack-based deactivation without max wait. Should not be estimated.",
+			spec: RotatedSecretSpec{
+				Refresh:              RefreshStrategy{Interval: time.Hour},
+				AckBasedDeactivation: &AckBasedDeactivation{},
+			},
+			expected: 0,
+		},
+		{
+			name: "Keep versions alone with a cron strategy. Should keep the kept versions.",
+			spec: RotatedSecretSpec{
+				Refresh:      RefreshStrategy{Cron: "0 * * * *"},
+				KeepVersions: 3,
+			},
+			expected: 3,
+		},
+		{
+			name: "Keep versions beyond the grace period. Should keep the kept versions and the versions within destruction delay.",
+			spec: RotatedSecretSpec{
+				Refresh:          RefreshStrategy{Interval: time.Hour},
+				GracePeriod:      time.Hour,
+				DestructionDelay: 90 * time.Minute,
+				KeepVersions:     4,
+			},
+			expected: 6,
+		},
+		{
+			name: "Grace period beyond the keep versions. Should keep the versions within the grace period.",
+			spec: RotatedSecretSpec{
+				Refresh:      RefreshStrategy{Interval: time.Hour},
+				GracePeriod:  5 * time.Hour,
+				KeepVersions: 2,
+			},
+			expected: 6,
+		},
+		{
+			name: "Cron strategy. Should not be estimated.",
+			spec: RotatedSecretSpec{
+				Refresh:     RefreshStrategy{Cron: "0 * * * *"},
+				GracePeriod: 24 * time.Hour,
+			},
+			expected: 0,
+		},
+		{
+			name: "Cron strategy with an interval ceiling. Should not be estimated.",
+			spec: RotatedSecretSpec{
+				Refresh:     RefreshStrategy{Interval: 24 * time.Hour, Cron: "0 * * * *"},
+				GracePeriod: 24 * time.Hour,
+			},
+			expected: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			got := tc.spec.MaxActiveVersions()
+			if got != tc.expected {
+				t.Errorf("Expected %d, but got %d.", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseVersionLabel(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		key           string
+		expectVersion int
+		expectOk      bool
+	}{
+		{
+			name:          "Version label.",
+			key:           "v12",
+			expectVersion: 12,
+			expectOk:      true,
+		},
+		{
+			name:     "Leading zero.",
+			key:      "v012",
+			expectOk: false,
+		},
+		{
+			name:     "Version zero.",
+			key:      "v0",
+			expectOk: false,
+		},
+		{
+			name:     "Disabled-at label.",
+			key:      "disabled-v1",
+			expectOk: false,
+		},
+		{
+			name:     "Provisioner label.",
+			key:      svckey.ProjectLabel,
+			expectOk: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			version, ok := ParseVersionLabel(tc.key)
+			if ok != tc.expectOk || version != tc.expectVersion {
+				t.Errorf("Expected (%d, %v), but got (%d, %v).", tc.expectVersion, tc.expectOk, version, ok)
+			}
+			if ok && VersionLabel(strconv.Itoa(version)) != tc.key {
+				t.Errorf("Expected label %s, but got %s.", tc.key, VersionLabel(strconv.Itoa(version)))
+			}
+		})
+	}
+}
+
+func TestLoadMultipleFiles(t *testing.T) {
+	teamA := `specs:
+- project: project-1
+  secret: secret-1
+  type:
+    serviceAccountKey:
+      project: project-1
+      serviceAccount: service-foo
+  refreshStrategy:
+    interval: 24h
+`
+	teamB := `specs:
+- project: project-1
+  secret: secret-2
+  type:
+    serviceAccountKey:
+      project: project-1
+      serviceAccount: service-bar
+  refreshStrategy:
+    interval: 24h
+`
+	teamBDuplicate := `specs:
+- project: project-1
+  secret: secret-1
+  type:
+    serviceAccountKey:
+      project: project-1
+      serviceAccount: service-bar
+  refreshStrategy:
+    interval: 24h
+`
+	var testcases = []struct {
+		name           string
+		files          map[string]string
+		pattern        string
+		expectLoadErr  bool
+		expectSecrets  []string
+		expectValidErr bool
+	}{
+		{
+			name:          "Two files in a dir. Should concatenate the specs in the order of the files.",
+			files:         map[string]string{"b.yaml": teamB, "a.yaml": teamA, ".hidden.yaml": teamBDuplicate},
+			expectSecrets: []string{"secret-1", "secret-2"},
+		},
+		{
+			name:          "Two files matching a glob. Should concatenate the specs in the order of the files.",
+			files:         map[string]string{"team-b.yml": teamB, "team-a.yml": teamA, "other.yaml": teamBDuplicate},
+			pattern:       "team-*.yml",
+			expectSecrets: []string{"secret-1", "secret-2"},
+		},
+		{
+			name:           "Same secret in two files. Should fail validation.",
+			files:          map[string]string{"a.yaml": teamA, "b.yaml": teamBDuplicate},
+			expectSecrets:  []string{"secret-1", "secret-1"},
+			expectValidErr: true,
+		},
+		{
+			name:          "Glob matching no file. Should return error.",
+			files:         map[string]string{"a.yaml": teamA},
+			pattern:       "team-*.yaml",
+			expectLoadErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, content := range tc.files {
+				err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config := &RotatedSecretConfig{}
+			if tc.pattern == "" {
+				err = config.LoadFromDir(dir)
+			} else {
+				err = config.LoadFromGlob(filepath.Join(dir, tc.pattern))
+			}
+			if tc.expectLoadErr {
+				if err == nil {
+					t.Errorf("Failed to receive expected error.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			secrets := []string{}
+			for _, spec := range config.Specs {
+				secrets = append(secrets, spec.Secret)
+			}
+			if strings.Join(secrets, ",") != strings.Join(tc.expectSecrets, ",") {
+				t.Errorf("Expected specs of %v, but got %v.", tc.expectSecrets, secrets)
+			}
+
+			err = config.Validate(DefaultMinRefreshInterval)
+			if tc.expectValidErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectValidErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"fmt"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// Decommission deactivates and destroys all secret versions managed by the rotator for the specs in cfg,
+// regardless of their grace period, pacing the provisioner operations with limiter.
+// Only versions in the version store of each spec, e.g. its "v<version>" labels, are touched.
+// A version is removed from the store once it is destroyed, so that it is safe to re-run.
+// The provisioners need to delete the deactivated secrets, e.g. with --enable-deletion,
+// otherwise the secrets outlive the versions and the store entries tracking them.
+// Returns the aggregated error of all versions that it failed to decommission.
+func Decommission(cl client.Interface, provisioners map[string]SecretProvisioner, limiter ProvisionerLimiter, cfg *config.RotatedSecretConfig) error {
+	errs := []error{}
+
+	for _, rotatedSecret := range cfg.Specs {
+		labels, err := cl.GetSecretLabels(rotatedSecret.Project, rotatedSecret.Secret)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				klog.V(2).Infof("Secret %s not found. Skipping...", rotatedSecret)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("Fail to get labels of %s: %s", rotatedSecret, err))
+			continue
+		}
+
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+
+		// attach the labels needed for the provisioner
+		for key, val := range rotatedSecret.Type.Labels() {
+			labels[key] = val
+		}
+
+		provisioner, ok := provisioners[rotatedSecret.Type.Type()]
+		if !ok {
+			errs = append(errs, fmt.Errorf("Missing provisioner of type %s for %s", rotatedSecret.Type.Type(), rotatedSecret))
+			continue
+		}
+
+		store := newVersionStore(cl, rotatedSecret)
+		ids, err := store.Versions(rotatedSecret)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		attachVersionLabels(labels, ids)
+
+		versions, err := managedVersions(cl, rotatedSecret, ids)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, version := range versions {
+			err = decommissionVersion(cl, provisioner, limiter, store, rotatedSecret, labels, version)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			klog.V(2).Infof("Decommissioned %s/%s", rotatedSecret, version)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// decommissionVersion deactivates the provisioned secret of version, destroys the version if not yet destroyed,
+// and removes it from the version store.
+func decommissionVersion(cl client.Interface, provisioner SecretProvisioner, limiter ProvisionerLimiter, store VersionStore, rotatedSecret config.RotatedSecretSpec, labels map[string]string, version string) error {
+	err := limiter.Deactivate(provisioner, labels, version)
+	if err != nil {
+		return fmt.Errorf("Fail to deactivate %s/%s: %s", rotatedSecret, version, err)
+	}
+
+	state, err := cl.GetSecretVersionState(rotatedSecret.Project, rotatedSecret.Secret, version)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return fmt.Errorf("Fail to get state of %s/%s: %s", rotatedSecret, version, err)
+	}
+
+	if err == nil && state != secretmanagerpb.SecretVersion_DESTROYED {
+		err = cl.DestroySecretVersion(rotatedSecret.Project, rotatedSecret.Secret, version)
+		if err != nil {
+			return fmt.Errorf("Fail to destroy %s/%s: %s", rotatedSecret, version, err)
+		}
+
+		postDeactivate(provisioner, rotatedSecret, labels, version)
+	}
+
+	return store.Remove(rotatedSecret, version)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/svckey"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/tests"
+	"testing"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+func TestDecommission(t *testing.T) {
+	provisioners := map[string]SecretProvisioner{
+		svckey.ServiceAccountKeySpec{}.Type(): &tests.MockSvcProvisioner{},
+	}
+
+	cl := &tests.MockClient{
+		Secrets: map[string]map[string]*tests.Secret{
+			"project-1": map[string]*tests.Secret{
+				"secret-1": &tests.Secret{
+					Versions: map[string]*tests.Version{
+						"1": &tests.Version{
+							CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+							State:      secretmanagerpb.SecretVersion_DESTROYED,
+						},
+						"2": &tests.Version{
+							CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+							State:      secretmanagerpb.SecretVersion_ENABLED,
+						},
+						"3": &tests.Version{
+							CreateTime: str2Time("2000-01-01T14:00:00+00:00"),
+							State:      secretmanagerpb.SecretVersion_ENABLED,
+						},
+					},
+					// version 1 is already destroyed and unlabeled,
+					// version 3 is not provisioned by the rotator.
+					Labels: map[string]string{
+						svckey.ProjectLabel:        "project-1",
+						svckey.ServiceAccountLabel: "service-foo",
+						"v2":                       "key-2",
+						"owner":                    "team-foo",
+					},
+				},
+			},
+		},
+	}
+
+	cfg := &config.RotatedSecretConfig{
+		Specs: []config.RotatedSecretSpec{
+			{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+			},
+			{
+				Project: "project-1",
+				Secret:  "missed",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+			},
+		},
+	}
+
+	expected := tests.Snapshot{
+		"1": {State: secretmanagerpb.SecretVersion_DESTROYED, CreateTime: str2Time("2000-01-01T00:00:00+00:00")},
+		"2": {State: secretmanagerpb.SecretVersion_DESTROYED, CreateTime: str2Time("2000-01-01T07:00:00+00:00")},
+		"3": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T14:00:00+00:00")},
+	}
+
+	// decommission twice to make sure it is safe to re-run
+	for i := 0; i < 2; i++ {
+		err := Decommission(cl, provisioners, NewProvisionerLimiter(1), cfg)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+
+		snapshot, err := tests.TakeSnapshot(cl, "project-1", "secret-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := snapshot.Match(expected); err != nil {
+			t.Error(err)
+		}
+
+		labels, _ := cl.GetSecretLabels("project-1", "secret-1")
+		if _, ok := labels["v2"]; ok {
+			t.Errorf("Label v2 should be removed after decommissioning.")
+		}
+		if labels["owner"] != "team-foo" {
+			t.Errorf("Unmanaged label owner should be preserved.")
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+// ProvisionerLimiter bounds the provisioner operations, i.e. CreateNew, Deactivate and Discard, running concurrently across all specs,
+// so that rotating many secrets at once is paced under the rate limits of the provisioned systems, e.g. IAM for service account keys.
+// It is independent of any limit on the Secret Manager calls.
+// A nil ProvisionerLimiter does not limit.
+type ProvisionerLimiter chan struct{}
+
+// NewProvisionerLimiter returns a ProvisionerLimiter allowing up to n concurrent provisioner operations.
+// Returns nil, i.e. no limit, if n <= 0.
+func NewProvisionerLimiter(n int) ProvisionerLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(ProvisionerLimiter, n)
+}
+
+// CreateNew calls provisioner.CreateNew once a slot is free.
+func (l ProvisionerLimiter) CreateNew(provisioner SecretProvisioner, labels map[string]string) (string, []byte, error) {
+	l.acquire()
+	defer l.release()
+	return provisioner.CreateNew(labels)
+}
+
+// Deactivate calls provisioner.Deactivate once a slot is free.
+func (l ProvisionerLimiter) Deactivate(provisioner SecretProvisioner, labels map[string]string, version string) error {
+	l.acquire()
+	defer l.release()
+	return provisioner.Deactivate(labels, version)
+}
+
+// Discard calls discarder.Discard once a slot is free.
+func (l ProvisionerLimiter) Discard(discarder SecretDiscarder, labels map[string]string, id string) error {
+	l.acquire()
+	defer l.release()
+	return discarder.Discard(labels, id)
+}
+
+func (l ProvisionerLimiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+func (l ProvisionerLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
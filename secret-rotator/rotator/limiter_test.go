@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyProvisioner records the maximum number of its operations running concurrently.
+type concurrencyProvisioner struct {
+	lock    sync.Mutex
+	running int
+	max     int
+}
+
+func (p *concurrencyProvisioner) run() {
+	p.lock.Lock()
+	p.running++
+	if p.running > p.max {
+		p.max = p.running
+	}
+	p.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	p.lock.Lock()
+	p.running--
+	p.lock.Unlock()
+}
+
+func (p *concurrencyProvisioner) CreateNew(labels map[string]string) (string, []byte, error) {
+	p.run()
+	return "id", []byte("secret"), nil
+}
+
+func (p *concurrencyProvisioner) Deactivate(labels map[string]string, version string) error {
+	p.run()
+	return nil
+}
+
+func TestProvisionerLimiter(t *testing.T) {
+	var testcases = []struct {
+		name  string
+		limit int
+	}{
+		{
+			name:  "Limited to 2. Should run at most 2 operations concurrently.",
+			limit: 2,
+		},
+		{
+			name:  "Limited to 1. Should run the operations one at a time.",
+			limit: 1,
+		},
+		{
+			name:  "Unlimited. Should not block any operation.",
+			limit: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			provisioner := &concurrencyProvisioner{}
+			limiter := NewProvisionerLimiter(tc.limit)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					limiter.CreateNew(provisioner, nil)
+				}()
+				go func() {
+					defer wg.Done()
+					limiter.Deactivate(provisioner, nil, "1")
+				}()
+			}
+			wg.Wait()
+
+			if tc.limit > 0 && provisioner.max > tc.limit {
+				t.Errorf("Expected at most %d concurrent operations, but got %d.", tc.limit, provisioner.max)
+			}
+		})
+	}
+}
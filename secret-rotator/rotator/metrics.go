@@ -0,0 +1,45 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	replicationDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "secret_rotator_replication_drift",
+		Help: "Whether the replication policy of an existing secret differs from its spec (1) or not (0). Replication is immutable, drifted secrets need manual recreation.",
+	}, []string{"project", "secret"})
+	lastVersionGuarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_rotator_last_version_guarded_total",
+		Help: "Number of deactivations skipped because they would leave a secret without any ENABLED version.",
+	}, []string{"project", "secret"})
+	nextRefresh = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "secret_rotator_next_refresh_timestamp",
+		Help: "Unix time a secret is next due for refreshing, by its interval or its cron, at the last rotation cycle.",
+	}, []string{"project", "secret"})
+	paused = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "secret_rotator_paused",
+		Help: "Whether the rotation is paused (1), skipping all refreshes and deactivations, or not (0), at the last rotation cycle.",
+	})
+	deactivationPostponed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_rotator_deactivation_postponed_total",
+		Help: "Number of deactivations postponed because the pre-deactivation probe of the consumers failed.",
+	}, []string{"project", "secret"})
+)
+
+func init() {
+	prometheus.MustRegister(replicationDrift, lastVersionGuarded, nextRefresh, deactivationPostponed, paused)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"k8s.io/klog"
+	"net/http"
+	"os"
+	"os/exec"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+)
+
+// Prober runs the PreDeactivateProbe of a rotated secret before version is deactivated.
+// It returns nil if the consumers are healthy on the newer versions, abstracted for testing.
+type Prober interface {
+	Probe(rotatedSecret config.RotatedSecretSpec, version string) error
+}
+
+// defaultProber requests the HTTP endpoint or runs the command of the probe.
+type defaultProber struct{}
+
+func (defaultProber) Probe(rotatedSecret config.RotatedSecretSpec, version string) error {
+	probe := rotatedSecret.PreDeactivateProbe
+	timeout := probe.Timeout
+	if timeout <= 0 {
+		timeout = config.DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if probe.HTTP != "" {
+		req, err := http.NewRequest(http.MethodGet, probe.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		// drain the body, so that the connection is reused
+		io.Copy(ioutil.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("GET %s returned %s", probe.HTTP, resp.Status)
+		}
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, probe.Command[0], probe.Command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"ROTATED_SECRET_PROJECT="+rotatedSecret.Project,
+		"ROTATED_SECRET_NAME="+rotatedSecret.Secret,
+		"ROTATED_SECRET_VERSION="+version,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v failed: %s: %s", probe.Command, err, out)
+	}
+	return nil
+}
+
+// probe runs the PreDeactivateProbe of rotatedSecret, if any, and returns true if version may be deactivated.
+// A failing probe postpones the deactivation to the next cycle, and is alerted on by the deactivationPostponed metric.
+func (r *SecretRotator) probe(rotatedSecret config.RotatedSecretSpec, version string) bool {
+	if rotatedSecret.PreDeactivateProbe == nil {
+		return true
+	}
+
+	var prober Prober = defaultProber{}
+	if r.Prober != nil {
+		prober = r.Prober
+	}
+	err := prober.Probe(rotatedSecret, version)
+	if err != nil {
+		klog.Warningf("Pre-deactivation probe of %s failed, postponing the deactivation of version %s: %s", rotatedSecret, version, err)
+		deactivationPostponed.WithLabelValues(rotatedSecret.Project, rotatedSecret.Secret).Inc()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"testing"
+	"time"
+)
+
+func TestDefaultProber(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer slow.Close()
+
+	var testcases = []struct {
+		name      string
+		probe     config.PreDeactivateProbe
+		expectErr bool
+	}{
+		{
+			name:      "Healthy endpoint. Should pass.",
+			probe:     config.PreDeactivateProbe{HTTP: healthy.URL},
+			expectErr: false,
+		},
+		{
+			name:      "Unhealthy endpoint. Should fail.",
+			probe:     config.PreDeactivateProbe{HTTP: unhealthy.URL},
+			expectErr: true,
+		},
+		{
+			name:      "Endpoint timing out. Should fail.",
+			probe:     config.PreDeactivateProbe{HTTP: slow.URL, Timeout: 50 * time.Millisecond},
+			expectErr: true,
+		},
+		{
+			name:      "Command exiting with 0 for the probed version. Should pass.",
+			probe:     config.PreDeactivateProbe{Command: []string{"sh", "-c", `test "$ROTATED_SECRET_NAME/$ROTATED_SECRET_VERSION" = secret-1/1`}},
+			expectErr: false,
+		},
+		{
+			name:      "Command exiting with 1. Should fail.",
+			probe:     config.PreDeactivateProbe{Command: []string{"sh", "-c", "exit 1"}},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			probe := tc.probe
+			spec := config.RotatedSecretSpec{
+				Project:            "project-1",
+				Secret:             "secret-1",
+				PreDeactivateProbe: &probe,
+			}
+
+			err := defaultProber{}.Probe(spec, "1")
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
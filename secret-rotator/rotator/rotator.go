@@ -14,34 +14,97 @@ limitations under the License.
 package rotator
 
 import (
+	"fmt"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog"
-	"regexp"
+	"sigs.k8s.io/k8s-gsm-tools/audit"
+	"sigs.k8s.io/k8s-gsm-tools/leaderelect"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/client"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"sort"
 	"strconv"
 	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
 )
 
+// disabledAtLabelPrefix prefixes the label recording the unix time a version is disabled at,
+// during a two-phase deactivation with RotatedSecretSpec.DestructionDelay.
+const disabledAtLabelPrefix = "disabled-v"
+
 type SecretProvisioner interface {
 	CreateNew(labels map[string]string) (string, []byte, error)
 	Deactivate(labels map[string]string, version string) error
 }
 
+// SecretVerifier is an optional interface of SecretProvisioner,
+// implemented by provisioners that can verify a newly provisioned secret is usable.
+type SecretVerifier interface {
+	Verify(labels map[string]string, id string, data []byte) error
+}
+
+// SecretAdopter is an optional interface of SecretProvisioner,
+// implemented by provisioners that can find the id of an existing secret they did not provision, see RotatedSecretSpec.AdoptExistingKey.
+type SecretAdopter interface {
+	Adopt(labels map[string]string, data []byte) (string, error)
+}
+
+// PostDeactivator is an optional interface of SecretProvisioner,
+// implemented by provisioners that clean up external systems once a deactivated version is destroyed,
+// e.g. removing the key id from an allowlist.
+type PostDeactivator interface {
+	PostDeactivate(labels map[string]string, version string) error
+}
+
+// SecretDiscarder is an optional interface of SecretProvisioner,
+// implemented by provisioners that can delete a newly provisioned secret by its id, e.g. one failing verification before being published.
+type SecretDiscarder interface {
+	Discard(labels map[string]string, id string) error
+}
+
 type SecretRotator struct {
 	Client       client.Interface
 	Agent        *config.Agent
 	Provisioners map[string]SecretProvisioner
 	Period       time.Duration
 	RunOnce      bool
+	// VerifyAttempts and VerifyInterval bound the retries of verifying a newly provisioned secret,
+	// for specs with VerifyBeforePublish set.
+	VerifyAttempts int
+	VerifyInterval time.Duration
+	// Prober runs the PreDeactivateProbe of the specs setting one.
+	// Defaults to requesting the HTTP endpoint or running the command of the probe if nil.
+	Prober Prober
+	// AuditLogger records each refresh and each deactivation of a version, or failure of them, in the audit trail.
+	// Auditing is disabled if nil.
+	AuditLogger *audit.Logger
+	// Paused skips all refreshes and deactivations of RotateAll(), like RotatedSecretConfig.Paused.
+	Paused bool
+	// Limiter bounds the concurrent CreateNew and Deactivate calls to the Provisioners.
+	// Unlimited if nil.
+	Limiter ProvisionerLimiter
+	// LeaderElection runs the loop of Start() only while holding its lease if set,
+	// so that several replicas can run without double-provisioning secrets. The followers wait for the lease.
+	LeaderElection *leaderelect.Config
 }
 
 // Start starts the secret rotator in continuous mode.
 // stops when stop sinal is received from stopChan.
+// With LeaderElection, the loop waits for the lease, and stops with an error once the lease is lost.
 func (r *SecretRotator) Start(stopChan <-chan struct{}) error {
+	if r.LeaderElection != nil {
+		return r.LeaderElection.Run(stopChan, r.start)
+	}
+	return r.start(stopChan)
+}
+
+// start runs the loop of Start() until stopChan is closed.
+func (r *SecretRotator) start(stopChan <-chan struct{}) error {
 	runChan := make(chan struct{})
 
 	go func() {
@@ -67,52 +130,120 @@ func (r *SecretRotator) Start(stopChan <-chan struct{}) error {
 
 // RotateAll checks all rotated secrets in Agent.Config().Specs
 // Pops error message for any failure in refreshing or deactivating each secret.
+// Does nothing while Paused or Agent.Config().Paused is set.
 func (r *SecretRotator) RotateAll() {
+	if r.Paused || r.Agent.Config().Paused {
+		// the cron triggers are kept queued, so that the secrets due during the pause are refreshed once resumed
+		klog.Info("Rotation is paused. Skipping all refreshes and deactivations...")
+		paused.Set(1)
+		return
+	}
+	paused.Set(0)
+
 	// get all triggered cron instances for secret refreshing
 	triggered := r.Agent.CronQueuedSecrets()
 
+	// drop the next refresh times of the specs removed from the config
+	nextRefresh.Reset()
+
 	// iterating on rotatedSecret instead of index so that the config stays consistent within each iteration,
 	// even if a config update occurs in the middle of the loop.
 	for _, rotatedSecret := range r.Agent.Config().Specs {
-		err := r.BootstrapSecret(rotatedSecret)
+		now := time.Now()
+		_, err := r.RotateOne(rotatedSecret, triggered, now)
 		if err != nil {
 			klog.Error(err)
 		}
+		r.recordNextRefresh(rotatedSecret, now)
+	}
+}
 
-		err = r.UpsertLabels(rotatedSecret)
-		if err != nil {
-			klog.Error(err)
-		}
+// RotateOne bootstraps the secret of rotatedSecret, refreshes it if needed, and deactivates its outdated versions.
+// Each step is attempted even if a previous one fails.
+// Returns true if the secret is refreshed, and the aggregated error of all failed steps.
+func (r *SecretRotator) RotateOne(rotatedSecret config.RotatedSecretSpec, triggered map[config.SpecID]bool, now time.Time) (bool, error) {
+	errs := []error{}
 
-		_, err = r.Refresh(rotatedSecret, triggered, time.Now())
-		if err != nil {
-			klog.Error(err)
-		}
+	err := r.BootstrapSecret(rotatedSecret)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = r.UpsertLabels(rotatedSecret)
+	if err != nil {
+		errs = append(errs, err)
+	}
 
-		err = r.Deactivate(rotatedSecret, time.Now())
+	if rotatedSecret.AdoptExistingKey {
+		err = r.AdoptExisting(rotatedSecret)
 		if err != nil {
-			klog.Error(err)
+			errs = append(errs, err)
 		}
 	}
+
+	refreshed, err := r.Refresh(rotatedSecret, triggered, now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = r.Deactivate(rotatedSecret, now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return refreshed, utilerrors.NewAggregate(errs)
 }
 
 // BootstrapSecret creates an empty secret specified by rotatedSecret, if it does not exist.
+// If the secret already exists, it warns about any drift in its replication policy from rotatedSecret.
 // It returns error if fails.
 func (r *SecretRotator) BootstrapSecret(rotatedSecret config.RotatedSecretSpec) error {
 	err := r.Client.ValidateSecret(rotatedSecret.Project, rotatedSecret.Secret)
 	if err == nil {
-		return nil
+		return r.CheckReplication(rotatedSecret)
 	}
 
 	// create the secret it does not already exist
 	if status.Code(err) == codes.NotFound {
-		err = r.Client.CreateSecret(rotatedSecret.Project, rotatedSecret.Secret)
+		err = r.Client.CreateSecret(rotatedSecret.Project, rotatedSecret.Secret, rotatedSecret.Replication.Locations)
 	}
 
 	return err
 }
 
-// UpsertLabels updates or inserts labels needed by the provisioner specified by rotatedSecret
+// CheckReplication compares the replication policy of the existing secret with rotatedSecret.Replication.
+// Since replication is immutable after creation, a drift is only warned and exported as a metric.
+// It returns error if fails to get the replication policy, and then drops the stale drift of the secret.
+func (r *SecretRotator) CheckReplication(rotatedSecret config.RotatedSecretSpec) error {
+	locations, err := r.Client.GetSecretReplication(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		replicationDrift.DeleteLabelValues(rotatedSecret.Project, rotatedSecret.Secret)
+		return err
+	}
+
+	drift := replicationDrift.WithLabelValues(rotatedSecret.Project, rotatedSecret.Secret)
+	if sets.NewString(locations...).Equal(sets.NewString(rotatedSecret.Replication.Locations...)) {
+		drift.Set(0)
+		return nil
+	}
+
+	klog.Warningf("Replication policy of %s drifts from the spec: expected %s, but got %s. The secret needs to be recreated manually.",
+		rotatedSecret, replicationString(rotatedSecret.Replication.Locations), replicationString(locations))
+	drift.Set(1)
+
+	return nil
+}
+
+// replicationString formats the replica locations of a replication policy.
+func replicationString(locations []string) string {
+	if len(locations) == 0 {
+		return "automatic"
+	}
+	return fmt.Sprintf("user-managed %v", sets.NewString(locations...).List())
+}
+
+// UpsertLabels updates or inserts labels needed by the provisioner specified by rotatedSecret,
+// and the labels of rotatedSecret.Labels.
 // Returns error if fails.
 func (r *SecretRotator) UpsertLabels(rotatedSecret config.RotatedSecretSpec) error {
 	_, err := r.Client.GetSecretLabels(rotatedSecret.Project, rotatedSecret.Secret)
@@ -128,25 +259,93 @@ func (r *SecretRotator) UpsertLabels(rotatedSecret config.RotatedSecretSpec) err
 		}
 	}
 
+	// attach the labels of the spec, validated not to collide with the labels above or the version labels
+	for key, val := range rotatedSecret.Labels {
+		err = r.Client.UpsertSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, key, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AdoptExisting records the latest version of the secret in its version store, with the id found by the provisioner,
+// if the secret has versions but none in the version store, e.g. a key created manually before onboarding.
+// Returns error if the provisioner cannot adopt the secret.
+func (r *SecretRotator) AdoptExisting(rotatedSecret config.RotatedSecretSpec) error {
+	store := newVersionStore(r.Client, rotatedSecret)
+	ids, err := store.Versions(rotatedSecret)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 0 {
+		// already managed
+		return nil
+	}
+
+	latestVersion, err := r.Client.GetLatestVersion(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			// nothing to adopt, the first version is provisioned by Refresh()
+			return nil
+		}
+		return err
+	}
+
+	adopter, ok := r.Provisioners[rotatedSecret.Type.Type()].(SecretAdopter)
+	if !ok {
+		return fmt.Errorf("Provisioner of type %s cannot adopt existing secrets for %s", rotatedSecret.Type.Type(), rotatedSecret)
+	}
+
+	data, err := r.Client.GetSecretVersionData(rotatedSecret.Project, rotatedSecret.Secret, latestVersion)
+	if err != nil {
+		return err
+	}
+
+	labels := rotatedSecret.Type.Labels()
+	id, err := adopter.Adopt(labels, data)
+	if err != nil {
+		return fmt.Errorf("Fail to adopt %s/%s: %s", rotatedSecret, latestVersion, redact.Error(err, data))
+	}
+
+	err = store.Add(rotatedSecret, latestVersion, id)
+	if err != nil {
+		return err
+	}
+
+	klog.V(2).Infof("Adopted %s/%s as %s", rotatedSecret, latestVersion, id)
 	return nil
 }
 
 // Refresh checks if the secret needs to be refreshed, and if so
 // provisions a new secret and updates the Secret Manager secret.
+// Each refresh, or failure to refresh, is recorded in the audit trail.
 // Returns true if the secret is refreshed.
-func (r *SecretRotator) Refresh(rotatedSecret config.RotatedSecretSpec, triggered sets.String, now time.Time) (bool, error) {
+func (r *SecretRotator) Refresh(rotatedSecret config.RotatedSecretSpec, triggered map[config.SpecID]bool, now time.Time) (bool, error) {
+	refreshed, version, err := r.refresh(rotatedSecret, triggered, now)
+	if err != nil {
+		r.audit(audit.Refresh, rotatedSecret, version, err)
+	} else if refreshed {
+		r.audit(audit.Refresh, rotatedSecret, version, nil)
+	}
+	return refreshed, err
+}
+
+// refresh is Refresh(), also returning the version of the Secret Manager secret holding the new secret, once created.
+func (r *SecretRotator) refresh(rotatedSecret config.RotatedSecretSpec, triggered map[config.SpecID]bool, now time.Time) (bool, string, error) {
 	shouldRefresh, err := r.ShouldRefresh(rotatedSecret, triggered, now)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
 	if !shouldRefresh {
-		return false, nil
+		return false, "", nil
 	}
 
 	labels, err := r.Client.GetSecretLabels(rotatedSecret.Project, rotatedSecret.Secret)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
 	if labels == nil {
@@ -158,57 +357,135 @@ func (r *SecretRotator) Refresh(rotatedSecret config.RotatedSecretSpec, triggere
 		labels[key] = val
 	}
 
-	newId, newSecret, err := r.Provisioners[rotatedSecret.Type.Type()].CreateNew(labels)
+	provisioner := r.Provisioners[rotatedSecret.Type.Type()]
+	// checked before provisioning, otherwise every cycle would provision a secret failing verification
+	if _, ok := provisioner.(SecretVerifier); rotatedSecret.VerifyBeforePublish && !ok {
+		return false, "", fmt.Errorf("Provisioner of type %s cannot verify new secrets for %s", rotatedSecret.Type.Type(), rotatedSecret)
+	}
+
+	newId, newSecret, err := r.Limiter.CreateNew(provisioner, labels)
 	if err != nil {
-		return false, err
+		return false, "", err
+	}
+
+	if rotatedSecret.VerifyBeforePublish {
+		err = r.verify(provisioner, labels, newId, newSecret)
+		if err != nil {
+			r.discard(provisioner, rotatedSecret, labels, newId)
+			return false, "", fmt.Errorf("Fail to verify new secret %s for %s: %s", newId, rotatedSecret, redact.Error(err, newSecret))
+		}
+	}
+
+	payload, err := rotatedSecret.RenderPayload(newId, newSecret)
+	if err != nil {
+		r.discard(provisioner, rotatedSecret, labels, newId)
+		return false, "", fmt.Errorf("Fail to render payload of new secret %s for %s: %s", newId, rotatedSecret, redact.Error(err, newSecret))
 	}
 
 	// update the secret Manager secret
-	latestVersion, err := r.Client.UpsertSecret(rotatedSecret.Project, rotatedSecret.Secret, newSecret)
+	latestVersion, err := r.Client.UpsertSecret(rotatedSecret.Project, rotatedSecret.Secret, payload)
 	if err != nil {
-		return false, err
+		return false, "", redact.Error(err, payload, newSecret)
 	}
 
-	// keys in format of "v%d" indicate that they are (version: id) pairs attached by the rotator
-	// the reason for the prefix "v" is that Secret Manager labels need to begin with a lowwer case letter
-	err = r.Client.UpsertSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, "v"+latestVersion, newId)
+	// a label of the new version existing before the version was not attached by the rotator, e.g. a decoy "v2024",
+	// and is replaced by the version store, so that it never names the new version once the latest version passes it
+	if _, ok := labels[config.VersionLabel(latestVersion)]; ok {
+		klog.Warningf("Label %s of %s was not attached by the rotator. Replacing it with the new version...", config.VersionLabel(latestVersion), rotatedSecret)
+	}
+
+	err = newVersionStore(r.Client, rotatedSecret).Add(rotatedSecret, latestVersion, newId)
 	if err != nil {
-		return false, err
+		return false, latestVersion, err
+	}
+
+	return true, latestVersion, nil
+
+}
+
+// discard deletes the newly provisioned secret of key-id 'id' that will not be published,
+// so that failing cycles do not pile up secrets, e.g. reaching the limit of keys per service account.
+// Failures are logged, since the error of the cycle is already returned.
+func (r *SecretRotator) discard(provisioner SecretProvisioner, rotatedSecret config.RotatedSecretSpec, labels map[string]string, id string) {
+	discarder, ok := provisioner.(SecretDiscarder)
+	if !ok {
+		klog.Errorf("Provisioner of type %s cannot discard new secrets. Secret %s of %s needs to be deleted manually.", rotatedSecret.Type.Type(), id, rotatedSecret)
+		return
+	}
+
+	err := r.Limiter.Discard(discarder, labels, id)
+	if err != nil {
+		klog.Errorf("Fail to discard new secret %s of %s: %s", id, rotatedSecret, err)
+		return
+	}
+	klog.V(2).Infof("Discarded new secret %s of %s", id, rotatedSecret)
+}
+
+// verify verifies the newly provisioned secret of key-id 'id' with the provisioner,
+// retrying up to r.VerifyAttempts times, r.VerifyInterval apart.
+// Returns nil once the secret is usable, otherwise the error of the last attempt.
+func (r *SecretRotator) verify(provisioner SecretProvisioner, labels map[string]string, id string, data []byte) error {
+	verifier, ok := provisioner.(SecretVerifier)
+	if !ok {
+		return fmt.Errorf("Provisioner does not support verification")
 	}
 
-	return true, nil
+	for attempt := 1; ; attempt++ {
+		err := verifier.Verify(labels, id, data)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= r.VerifyAttempts {
+			return fmt.Errorf("Still unusable after %d attempts: %s", attempt, err)
+		}
 
+		klog.V(2).Infof("New secret %s is not usable yet (attempt %d/%d): %s", id, attempt, r.VerifyAttempts, err)
+		time.Sleep(r.VerifyInterval)
+	}
 }
 
 // ShouldRefresh checks whether the secret needs to be refreshed according to
-// (1)'now' and 'rotatedSecret.Refresh.Interval' if 'rotatedSecret.Refresh.Interval' is specified.
-// (2)whether the spec is in 'triggered' if 'rotatedSecret.Refresh.Cron' is specified.
+// (1)whether the spec is in 'triggered', e.g. by the cron instance if 'rotatedSecret.Refresh.Cron' is specified.
+// (2)'now' and 'rotatedSecret.Refresh.Interval' if 'rotatedSecret.Refresh.Interval' is specified.
+// The secret is refreshed if either condition is met.
+// 'rotatedSecret.Refresh.Interval' is overridden by the secret labels if 'rotatedSecret.LabelOverrides' is set.
+// A spec in 'triggered' is refreshed regardless of its strategy, e.g. when rotated on demand.
 // Returns true if the secret needs to be refreshed.
-func (r *SecretRotator) ShouldRefresh(rotatedSecret config.RotatedSecretSpec, triggered sets.String, now time.Time) (bool, error) {
-	if rotatedSecret.Refresh.Cron != "" {
-		// check if the cron instance for refreshing this secret is triggered
-		return triggered.Has(rotatedSecret.String()), nil
-	} else {
-		err := r.Client.ValidateSecretVersion(rotatedSecret.Project, rotatedSecret.Secret, "1")
-		if err != nil {
-			// create the secret and/or the first version if it does not already exist
-			if status.Code(err) == codes.NotFound {
-				return true, nil
-			}
-			return false, err
-		}
+func (r *SecretRotator) ShouldRefresh(rotatedSecret config.RotatedSecretSpec, triggered map[config.SpecID]bool, now time.Time) (bool, error) {
+	if triggered[rotatedSecret.ID()] {
+		return true, nil
+	}
 
-		createTime, err := r.Client.GetCreateTime(rotatedSecret.Project, rotatedSecret.Secret, "latest")
-		if err != nil {
-			return false, err
+	if rotatedSecret.Refresh.Interval == 0 {
+		// cron only, wait for the cron instance for refreshing this secret to be triggered
+		return false, nil
+	}
+
+	err := r.Client.ValidateSecretVersion(rotatedSecret.Project, rotatedSecret.Secret, "1")
+	if err != nil {
+		// create the secret and/or the first version if it does not already exist
+		if status.Code(err) == codes.NotFound {
+			return true, nil
 		}
+		return false, err
+	}
 
-		// check the elapsed time from its createTime to now
-		return now.After(createTime.Add(rotatedSecret.Refresh.Interval)), nil
+	rotatedSecret, err = r.resolveOverrides(rotatedSecret)
+	if err != nil {
+		return false, err
 	}
+
+	createTime, err := r.Client.GetCreateTime(rotatedSecret.Project, rotatedSecret.Secret, "latest")
+	if err != nil {
+		return false, err
+	}
+
+	// check the elapsed time from its createTime to now
+	return now.After(createTime.Add(rotatedSecret.Refresh.Interval)), nil
 }
 
-// Deactivate fetches the secret versions from the Secret Manager secret labels,
+// Deactivate fetches the secret versions from the version store of the secret,
 // if any version needs to be deactivated, deactivates it and updates the Secret Manager secret accordingly.
 func (r *SecretRotator) Deactivate(rotatedSecret config.RotatedSecretSpec, now time.Time) error {
 	labels, err := r.Client.GetSecretLabels(rotatedSecret.Project, rotatedSecret.Secret)
@@ -225,21 +502,20 @@ func (r *SecretRotator) Deactivate(rotatedSecret config.RotatedSecretSpec, now t
 		labels[key] = val
 	}
 
-	for key, _ := range labels {
-		// keys in format of "v%d" indicate that they are (version: id) pairs attached by the rotator
-		// the reason for the prefix "v" is that Secret Manager labels need to begin with a lowwer case letter
-		matched, err := regexp.Match(`^v[0-9]+$`, []byte(key))
-		if err != nil {
-			klog.Errorf("Fail to label %s in %s: %s", key, rotatedSecret, err)
-			continue
-		}
-
-		if !matched {
-			continue
-		}
+	store := newVersionStore(r.Client, rotatedSecret)
+	ids, err := store.Versions(rotatedSecret)
+	if err != nil {
+		return err
+	}
+	ignoreUnstoredVersionLabels(rotatedSecret, labels, ids)
+	attachVersionLabels(labels, ids)
 
-		version := key[1:]
+	versions, err := managedVersions(r.Client, rotatedSecret, ids)
+	if err != nil {
+		return err
+	}
 
+	for _, version := range versions {
 		shouldDeactivate, err := r.ShouldDeactivate(rotatedSecret, version, now)
 		if err != nil {
 			klog.Errorf("Fail to check for deactivating %s/%s: %s", rotatedSecret, version, err)
@@ -249,9 +525,33 @@ func (r *SecretRotator) Deactivate(rotatedSecret config.RotatedSecretSpec, now t
 			continue
 		}
 
-		err = r.Provisioners[rotatedSecret.Type.Type()].Deactivate(labels, version)
+		lastEnabled, err := r.isLastEnabled(rotatedSecret, version)
+		if err != nil {
+			klog.Errorf("Fail to check the enabled versions of %s: %s", rotatedSecret, err)
+			continue
+		}
+		if lastEnabled {
+			klog.Warningf("Refusing to deactivate %s/%s: it is the last ENABLED version of the secret. Check the grace period of the spec!", rotatedSecret, version)
+			lastVersionGuarded.WithLabelValues(rotatedSecret.Project, rotatedSecret.Secret).Inc()
+			continue
+		}
+
+		if rotatedSecret.DestructionDelay > 0 {
+			shouldDestroy, err := r.ShouldDestroy(rotatedSecret, labels, version, now)
+			if err != nil {
+				klog.Errorf("Fail to check for destroying %s/%s: %s", rotatedSecret, version, err)
+				continue
+			}
+
+			if !shouldDestroy {
+				continue
+			}
+		}
+
+		err = r.Limiter.Deactivate(r.Provisioners[rotatedSecret.Type.Type()], labels, version)
 		if err != nil {
 			klog.Errorf("Fail to deactivate %s/%s: %s", rotatedSecret, version, err)
+			r.audit(audit.Deactivate, rotatedSecret, version, err)
 			continue
 		}
 
@@ -259,23 +559,190 @@ func (r *SecretRotator) Deactivate(rotatedSecret config.RotatedSecretSpec, now t
 		err = r.Client.DestroySecretVersion(rotatedSecret.Project, rotatedSecret.Secret, version)
 		if err != nil {
 			klog.Errorf("Fail to disable %s/%s: %s", rotatedSecret, version, err)
+			r.audit(audit.Deactivate, rotatedSecret, version, err)
 			continue
 		}
+		r.audit(audit.Deactivate, rotatedSecret, version, nil)
 
-		// update the Secret Manager secret
-		// keys in format of "v%d" indicate that they are (version: id) pairs attached by the rotator
-		// the reason for the prefix "v" is that Secret Manager labels need to begin with a lowwer case letter
-		err = r.Client.DeleteSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, "v"+version)
+		postDeactivate(r.Provisioners[rotatedSecret.Type.Type()], rotatedSecret, labels, version)
+
+		err = store.Remove(rotatedSecret, version)
 		if err != nil {
-			klog.Errorf("Fail to delete label %s of %s: %s", "v"+version, rotatedSecret, err)
+			klog.Error(err)
 			continue
 		}
+
+		// the acknowledgement of a deactivated version is moot, and would count towards the label limit
+		if _, ok := labels[config.AckLabel(version)]; ok {
+			err = r.Client.DeleteSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, config.AckLabel(version))
+			if err != nil {
+				klog.Errorf("Fail to delete label %s of %s: %s", config.AckLabel(version), rotatedSecret, err)
+			}
+		}
+
+		if _, ok := labels[disabledAtLabelPrefix+version]; ok {
+			err = r.Client.DeleteSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, disabledAtLabelPrefix+version)
+			if err != nil {
+				klog.Errorf("Fail to delete label %s of %s: %s", disabledAtLabelPrefix+version, rotatedSecret, err)
+				continue
+			}
+		}
 	}
 
 	return nil
 }
 
-// ShouldDeactivate checks if the secret version needs to be deactivated according to 'now' and 'rotatedSecret.GracePeriod'
+// audit records the result of operation on version of rotatedSecret in the audit trail.
+// The errors hold no secret value, as they are redacted or never touch one.
+func (r *SecretRotator) audit(operation audit.Operation, rotatedSecret config.RotatedSecretSpec, version string, err error) {
+	record := audit.Record{
+		Operation: operation,
+		Spec:      rotatedSecret.String(),
+		Result:    audit.Succeeded,
+		Version:   version,
+	}
+	if err != nil {
+		record.Result = audit.Failed
+		record.Error = err.Error()
+	}
+	r.AuditLogger.Log(record)
+}
+
+// postDeactivate runs the PostDeactivate hook of provisioner, if implemented, for the destroyed version.
+// The hook is best-effort: the version is destroyed already, so its failure is logged and never retried.
+func postDeactivate(provisioner SecretProvisioner, rotatedSecret config.RotatedSecretSpec, labels map[string]string, version string) {
+	hook, ok := provisioner.(PostDeactivator)
+	if !ok {
+		return
+	}
+
+	err := hook.PostDeactivate(labels, version)
+	if err != nil {
+		klog.Errorf("Fail to run post-deactivation hook of %s/%s: %s", rotatedSecret, version, err)
+	}
+}
+
+// isLastEnabled returns true if version is the only ENABLED version of the secret,
+// so that deactivating it would leave the consumers without any usable version.
+// It guards against misconfigured grace periods, independently of ShouldDeactivate().
+func (r *SecretRotator) isLastEnabled(rotatedSecret config.RotatedSecretSpec, version string) (bool, error) {
+	enabled, err := r.Client.ListEnabledVersions(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	return len(enabled) == 1 && enabled[0] == version, nil
+}
+
+// managedVersions returns the versions of ids, the (version: id) pairs of the version store, in ascending order.
+// Versions beyond the latest version of the secret cannot have been provisioned by the rotator, e.g. from a "v2024" label,
+// and are ignored with a warning, so that they are never mistaken for versions to deactivate.
+func managedVersions(cl client.Interface, rotatedSecret config.RotatedSecretSpec, ids map[string]string) ([]string, error) {
+	latest := 0
+	latestVersion, err := cl.GetLatestVersion(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return nil, fmt.Errorf("Fail to get latest version of %s: %s", rotatedSecret, err)
+		}
+	} else {
+		latest, err = strconv.Atoi(latestVersion)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid latest version %s of %s: %s", latestVersion, rotatedSecret, err)
+		}
+	}
+
+	versions := []int{}
+	for key := range ids {
+		version, ok := config.ParseVersionLabel(config.VersionLabel(key))
+		if !ok {
+			klog.Warningf("Invalid version %s in the version store of %s. Ignoring...", key, rotatedSecret)
+			continue
+		}
+		if version > latest {
+			klog.Warningf("Version %s in the version store of %s is beyond the latest version %d. Ignoring...", key, rotatedSecret, latest)
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	ret := []string{}
+	for _, version := range versions {
+		ret = append(ret, strconv.Itoa(version))
+	}
+	return ret, nil
+}
+
+// ignoreUnstoredVersionLabels removes from labels the "v<version>" labels absent from ids, the (version: id) pairs of the version store,
+// with a warning: they were not attached by the rotator, e.g. a decoy "v2024" on a secret with VersionStoreSecret,
+// and are never passed to the provisioner.
+func ignoreUnstoredVersionLabels(rotatedSecret config.RotatedSecretSpec, labels map[string]string, ids map[string]string) {
+	for key := range labels {
+		version, ok := config.ParseVersionLabel(key)
+		if !ok {
+			continue
+		}
+		if _, ok := ids[strconv.Itoa(version)]; !ok {
+			klog.Warningf("Label %s of %s is not in the version store. Ignoring...", key, rotatedSecret)
+			delete(labels, key)
+		}
+	}
+}
+
+// attachVersionLabels sets the "v<version>" label of each of the (version: id) pairs in labels,
+// as the provisioners resolve the provisioned secret of a version from its label, whichever the version store.
+func attachVersionLabels(labels map[string]string, ids map[string]string) {
+	for version, id := range ids {
+		labels[config.VersionLabel(version)] = id
+	}
+}
+
+// ShouldDestroy drives the two-phase deactivation of a version that should be deactivated:
+// (1)if the version has not been disabled yet, disables it and records 'now' in its disabled-at label.
+// (2)if the version has been re-enabled since, e.g. by an operator recovering it, leaves it untouched.
+// (3)otherwise, checks the elapsed time from its disabled-at label to 'now' against 'rotatedSecret.DestructionDelay'.
+// Returns true if the version needs to be destroyed.
+func (r *SecretRotator) ShouldDestroy(rotatedSecret config.RotatedSecretSpec, labels map[string]string, version string, now time.Time) (bool, error) {
+	disabledAt, ok := labels[disabledAtLabelPrefix+version]
+	if !ok {
+		err := r.Client.DisableSecretVersion(rotatedSecret.Project, rotatedSecret.Secret, version)
+		if err != nil {
+			return false, err
+		}
+
+		// Secret Manager label values only allow lowercase letters, digits, '_' and '-'
+		err = r.Client.UpsertSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, disabledAtLabelPrefix+version, strconv.FormatInt(now.Unix(), 10))
+		if err != nil {
+			return false, err
+		}
+
+		klog.V(2).Infof("Disabled %s/%s, to be destroyed after %s", rotatedSecret, version, rotatedSecret.DestructionDelay)
+		return false, nil
+	}
+
+	disabledAtUnix, err := strconv.ParseInt(disabledAt, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("Invalid label %s=%s: %s", disabledAtLabelPrefix+version, disabledAt, err)
+	}
+
+	state, err := r.Client.GetSecretVersionState(rotatedSecret.Project, rotatedSecret.Secret, version)
+	if err != nil {
+		return false, err
+	}
+
+	if state == secretmanagerpb.SecretVersion_ENABLED {
+		klog.Warningf("%s/%s has been re-enabled, skipping its destruction. Delete its label %s to resume the deactivation.", rotatedSecret, version, disabledAtLabelPrefix+version)
+		return false, nil
+	}
+
+	return !now.Before(time.Unix(disabledAtUnix, 0).Add(rotatedSecret.DestructionDelay)), nil
+}
+
+// ShouldDeactivate checks if the secret version needs to be deactivated according to 'now' and 'rotatedSecret.GracePeriod',
+// or to the acknowledgements of the consumers if 'rotatedSecret.AckBasedDeactivation' is set.
+// 'rotatedSecret.GracePeriod' is overridden by the secret labels if 'rotatedSecret.LabelOverrides' is set.
+// If 'rotatedSecret.KeepVersions' is set, the version also needs to be older than the 'KeepVersions' most recent versions.
+// If 'rotatedSecret.PreDeactivateProbe' is set, the deactivation is postponed while the probe fails.
 // Returns true if the secret version needs to be deactivated.
 func (r *SecretRotator) ShouldDeactivate(rotatedSecret config.RotatedSecretSpec, version string, now time.Time) (bool, error) {
 
@@ -300,14 +767,100 @@ func (r *SecretRotator) ShouldDeactivate(rotatedSecret config.RotatedSecretSpec,
 		}
 	}
 
+	rotatedSecret, err = r.resolveOverrides(rotatedSecret)
+	if err != nil {
+		return false, err
+	}
+
 	nextCreateTime, err := r.Client.GetCreateTime(rotatedSecret.Project, rotatedSecret.Secret, nextVersion)
 	if err != nil {
 		return false, err
 	}
 
-	if now.After(nextCreateTime.Add(rotatedSecret.GracePeriod)) {
+	deactivate := now.After(nextCreateTime.Add(rotatedSecret.GracePeriod))
+	if rotatedSecret.AckBasedDeactivation != nil {
+		deactivate, err = r.acknowledged(rotatedSecret, v, nextCreateTime, now)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if deactivate && rotatedSecret.KeepVersions > 0 {
+		deactivate, err = r.superseded(rotatedSecret, v)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !deactivate {
+		return false, nil
+	}
+
+	return r.probe(rotatedSecret, version), nil
+}
+
+// superseded returns true if at least rotatedSecret.KeepVersions versions newer than version are not destroyed,
+// i.e. version is older than the KeepVersions most recent versions kept active.
+func (r *SecretRotator) superseded(rotatedSecret config.RotatedSecretSpec, version int) (bool, error) {
+	versions, err := r.Client.ListSecretVersions(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		return false, fmt.Errorf("Fail to list versions of %s: %s", rotatedSecret, err)
+	}
+
+	newer := 0
+	for key, state := range versions {
+		v, err := strconv.Atoi(key)
+		if err != nil || v <= version || state == secretmanagerpb.SecretVersion_DESTROYED {
+			continue
+		}
+		newer++
+	}
+	return newer >= rotatedSecret.KeepVersions, nil
+}
+
+// acknowledged returns true if the consumers have acknowledged any version newer than version with its config.AckLabel(),
+// or, if rotatedSecret.AckBasedDeactivation.MaxWait is set, once MaxWait has elapsed from nextCreateTime to now.
+func (r *SecretRotator) acknowledged(rotatedSecret config.RotatedSecretSpec, version int, nextCreateTime, now time.Time) (bool, error) {
+	labels, err := r.Client.GetSecretLabels(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	for key := range labels {
+		acked, ok := config.ParseAckLabel(key)
+		if ok && acked > version {
+			return true, nil
+		}
+	}
+
+	maxWait := rotatedSecret.AckBasedDeactivation.MaxWait
+	if maxWait > 0 && now.After(nextCreateTime.Add(maxWait)) {
+		klog.Warningf("No version of %s newer than %d acknowledged within %s. Deactivating it anyway...", rotatedSecret, version, maxWait)
 		return true, nil
 	}
 
 	return false, nil
 }
+
+// resolveOverrides returns rotatedSecret with the label overrides of its Secret Manager secret applied,
+// if rotatedSecret.LabelOverrides is set, otherwise rotatedSecret itself.
+func (r *SecretRotator) resolveOverrides(rotatedSecret config.RotatedSecretSpec) (config.RotatedSecretSpec, error) {
+	if !rotatedSecret.LabelOverrides {
+		return rotatedSecret, nil
+	}
+
+	labels, err := r.Client.GetSecretLabels(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		return rotatedSecret, err
+	}
+
+	return rotatedSecret.WithLabelOverrides(labels, r.minRefreshInterval())
+}
+
+// minRefreshInterval returns the floor of the refresh intervals of r.Agent, or config.DefaultMinRefreshInterval without an agent.
+func (r *SecretRotator) minRefreshInterval() time.Duration {
+	if r.Agent == nil {
+		return config.DefaultMinRefreshInterval
+	}
+	return r.Agent.MinRefreshInterval
+}
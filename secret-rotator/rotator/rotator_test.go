@@ -15,11 +15,17 @@ package rotator
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"math/rand"
 	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/audit"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/svckey"
 	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/tests"
+	"strconv"
 	"testing"
 	"time"
 
@@ -70,9 +76,9 @@ func TestRefresh(t *testing.T) {
 								},
 							},
 							Labels: map[string]string{
-								"project":         "project-1",
-								"service-account": "service-foo",
-								"v1":              "key_id-1",
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
 							},
 						},
 					},
@@ -98,9 +104,9 @@ func TestRefresh(t *testing.T) {
 			refresh: false,
 
 			expectedLabels: map[string]string{
-				"project":         "project-1",
-				"service-account": "service-foo",
-				"v1":              "key_id-1",
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v1":                       "key_id-1",
 			},
 
 			expectVerNum: "1",
@@ -122,9 +128,9 @@ func TestRefresh(t *testing.T) {
 								},
 							},
 							Labels: map[string]string{
-								"project":         "project-1",
-								"service-account": "service-foo",
-								"v1":              "key_id-1",
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
 							},
 						},
 					},
@@ -150,9 +156,9 @@ func TestRefresh(t *testing.T) {
 			refresh: true,
 
 			expectedLabels: map[string]string{
-				"project":         "project-1",
-				"service-account": "service-foo",
-				"v1":              "key_id-1",
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v1":                       "key_id-1",
 			},
 
 			expectVerNum: "2",
@@ -208,9 +214,9 @@ func TestRefresh(t *testing.T) {
 								},
 							},
 							Labels: map[string]string{
-								"project":         "project-1",
-								"service-account": "service-foo",
-								"v1":              "key_id-1",
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
 							},
 						},
 					},
@@ -292,6 +298,155 @@ func TestRefresh(t *testing.T) {
 	}
 }
 
+func TestRefreshVerify(t *testing.T) {
+	var testcases = []struct {
+		name           string
+		verifyFailures int
+		unverifiable   bool
+		refresh        bool
+		expectCalls    int
+		expectCreated  bool
+		expectDiscard  bool
+		expectErr      bool
+	}{
+		{
+			name:           "New secret is usable immediately. Should publish the new secret.",
+			verifyFailures: 0,
+			refresh:        true,
+			expectCalls:    1,
+			expectCreated:  true,
+			expectDiscard:  false,
+			expectErr:      false,
+		},
+		{
+			name:           "New secret becomes usable within attempts. Should publish the new secret.",
+			verifyFailures: 2,
+			refresh:        true,
+			expectCalls:    3,
+			expectCreated:  true,
+			expectDiscard:  false,
+			expectErr:      false,
+		},
+		{
+			name:           "New secret never becomes usable. Should discard the new secret without publishing it.",
+			verifyFailures: -1,
+			refresh:        false,
+			expectCalls:    3,
+			expectCreated:  true,
+			expectDiscard:  true,
+			expectErr:      true,
+		},
+		{
+			name:          "Provisioner cannot verify. Should not provision a new secret.",
+			unverifiable:  true,
+			refresh:       false,
+			expectCalls:   0,
+			expectCreated: false,
+			expectDiscard: false,
+			expectErr:     true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			provisioner := &recordingProvisioner{
+				MockSvcProvisioner: tests.MockSvcProvisioner{
+					VerifyFailures: tc.verifyFailures,
+				},
+			}
+			// hides the optional interfaces of the provisioner
+			var provisionerOfType SecretProvisioner = provisioner
+			if tc.unverifiable {
+				provisionerOfType = struct{ SecretProvisioner }{provisioner}
+			}
+
+			rotator := &SecretRotator{
+				Client: &tests.MockClient{
+					Secrets: map[string]map[string]*tests.Secret{
+						"project-1": map[string]*tests.Secret{
+							"secret-1": &tests.Secret{
+								Versions: map[string]*tests.Version{
+									"1": &tests.Version{
+										CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+										Data:       []byte("secret-data-1"),
+										State:      secretmanagerpb.SecretVersion_ENABLED,
+									},
+								},
+								Labels: map[string]string{
+									svckey.ProjectLabel:        "project-1",
+									svckey.ServiceAccountLabel: "service-foo",
+									"v1":                       "key_id-1",
+								},
+							},
+						},
+					},
+				},
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): provisionerOfType,
+				},
+				VerifyAttempts: 3,
+				VerifyInterval: time.Millisecond,
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				Refresh: config.RefreshStrategy{
+					Interval: str2Duration("20h"),
+				},
+				VerifyBeforePublish: true,
+			}
+
+			refreshed, err := rotator.Refresh(spec, nil, str2Time("2000-01-02T00:00:00+00:00"))
+			if tc.refresh && !refreshed {
+				t.Errorf("Expected refresh in secret.")
+			} else if !tc.refresh && refreshed {
+				t.Errorf("Unexpected refresh in secret.")
+			}
+
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if provisioner.VerifyCalls != tc.expectCalls {
+				t.Errorf("Expected %d verify calls, but got %d.", tc.expectCalls, provisioner.VerifyCalls)
+			}
+
+			if created := provisioner.id != ""; created != tc.expectCreated {
+				t.Errorf("Expected a new secret provisioned: %t, but got %t.", tc.expectCreated, created)
+			}
+
+			var expectDiscarded []string
+			if tc.expectDiscard {
+				expectDiscarded = []string{provisioner.id}
+			}
+			if !reflect.DeepEqual(provisioner.Discarded, expectDiscarded) {
+				t.Errorf("Expected discarded secrets %v, but got %v.", expectDiscarded, provisioner.Discarded)
+			}
+
+			expectVersions := 1
+			if tc.refresh {
+				expectVersions = 2
+			}
+			snapshot, err := tests.TakeSnapshot(rotator.Client.(*tests.MockClient), spec.Project, spec.Secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshot) != expectVersions {
+				t.Errorf("Expected %d versions, but got %d.", expectVersions, len(snapshot))
+			}
+		})
+	}
+}
+
 func TestDeactivate(t *testing.T) {
 
 	// prepare provisioners for all supported types of secrets
@@ -340,12 +495,12 @@ func TestDeactivate(t *testing.T) {
 								},
 							},
 							Labels: map[string]string{
-								"project":         "project-1",
-								"service-account": "service-foo",
-								"v1":              "key_id-1",
-								"v2":              "key_id-2",
-								"v3":              "key_id-3",
-								"v4":              "key_id-4",
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+								"v2":                       "key_id-2",
+								"v3":                       "key_id-3",
+								"v4":                       "key_id-4",
 							},
 						},
 					},
@@ -369,10 +524,10 @@ func TestDeactivate(t *testing.T) {
 			deactiveVers: []string{"1", "2"},
 
 			expectedLabels: map[string]string{
-				"project":         "project-1",
-				"service-account": "service-foo",
-				"v3":              "key_id-3",
-				"v4":              "key_id-4",
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v3":                       "key_id-3",
+				"v4":                       "key_id-4",
 			},
 		},
 		{
@@ -395,11 +550,11 @@ func TestDeactivate(t *testing.T) {
 								},
 							},
 							Labels: map[string]string{
-								"project":         "project-1",
-								"service-account": "service-foo",
-								"v1":              "key_id-1",
-								"v2":              "key_id-2",
-								"v3":              "_",
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+								"v2":                       "key_id-2",
+								"v3":                       "_",
 							},
 						},
 					},
@@ -423,10 +578,10 @@ func TestDeactivate(t *testing.T) {
 			deactiveVers: []string{"1"},
 
 			expectedLabels: map[string]string{
-				"project":         "project-1",
-				"service-account": "service-foo",
-				"v2":              "key_id-2",
-				"v3":              "_",
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v2":                       "key_id-2",
+				"v3":                       "_",
 			},
 		},
 	}
@@ -460,3 +615,1579 @@ func TestDeactivate(t *testing.T) {
 		})
 	}
 }
+
+func TestDeactivateDestructionDelay(t *testing.T) {
+	type step struct {
+		now           time.Time
+		expectedState secretmanagerpb.SecretVersion_State
+		expectLabels  []string
+	}
+
+	var testcases = []struct {
+		name      string
+		reEnabled bool
+		steps     []step
+	}{
+		{
+			name: "v1 is out of gracePeriod. Should disable v1, wait for destructionDelay, then destroy v1.",
+			steps: []step{
+				{
+					now:           str2Time("2000-01-01T10:00:00+00:00"),
+					expectedState: secretmanagerpb.SecretVersion_DISABLED,
+					expectLabels:  []string{"v1", "v2", "disabled-v1"},
+				},
+				{
+					now:           str2Time("2000-01-01T20:00:00+00:00"),
+					expectedState: secretmanagerpb.SecretVersion_DISABLED,
+					expectLabels:  []string{"v1", "v2", "disabled-v1"},
+				},
+				{
+					now:           str2Time("2000-01-02T10:00:00+00:00"),
+					expectedState: secretmanagerpb.SecretVersion_DESTROYED,
+					expectLabels:  []string{"v2"},
+				},
+			},
+		},
+		{
+			name:      "v1 is re-enabled after disabling. Should not destroy v1.",
+			reEnabled: true,
+			steps: []step{
+				{
+					now:           str2Time("2000-01-01T10:00:00+00:00"),
+					expectedState: secretmanagerpb.SecretVersion_ENABLED,
+					expectLabels:  []string{"v1", "v2", "disabled-v1"},
+				},
+				{
+					now:           str2Time("2000-01-02T10:00:00+00:00"),
+					expectedState: secretmanagerpb.SecretVersion_ENABLED,
+					expectLabels:  []string{"v1", "v2", "disabled-v1"},
+				},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: map[string]string{
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+								"v2":                       "key_id-2",
+							},
+						},
+					},
+				},
+			}
+
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): &tests.MockSvcProvisioner{},
+				},
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				GracePeriod:      str2Duration("2h"),
+				DestructionDelay: str2Duration("24h"),
+			}
+
+			for i, step := range tc.steps {
+				err := rotator.Deactivate(spec, step.now)
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+
+				if i == 0 && tc.reEnabled {
+					err = cl.EnableSecretVersion("project-1", "secret-1", "1")
+					if err != nil {
+						t.Error(err)
+					}
+				}
+
+				state, err := cl.GetSecretVersionState("project-1", "secret-1", "1")
+				if err != nil {
+					t.Error(err)
+				}
+				if state != step.expectedState {
+					t.Errorf("Step %d: expected state %s, but got %s.", i, step.expectedState, state)
+				}
+
+				labels, err := cl.GetSecretLabels("project-1", "secret-1")
+				if err != nil {
+					t.Error(err)
+				}
+				expectedLabels := []string{svckey.ProjectLabel, svckey.ServiceAccountLabel}
+				expectedLabels = append(expectedLabels, step.expectLabels...)
+				if !sets.StringKeySet(labels).Equal(sets.NewString(expectedLabels...)) {
+					t.Errorf("Step %d: expected labels %v, but got %v.", i, expectedLabels, labels)
+				}
+			}
+
+			disabledAt := cl.Secrets["project-1"]["secret-1"].Labels["disabled-v1"]
+			if disabledAt != "" && disabledAt != strconv.FormatInt(tc.steps[0].now.Unix(), 10) {
+				t.Errorf("Expected disabled-at label %d, but got %s.", tc.steps[0].now.Unix(), disabledAt)
+			}
+		})
+	}
+}
+
+func TestPostDeactivateHook(t *testing.T) {
+	var testcases = []struct {
+		name                  string
+		now                   time.Time
+		expectPostDeactivated []string
+	}{
+		{
+			name:                  "Grace period elapsed. Should run the hook for the destroyed version.",
+			now:                   str2Time("2000-01-01T10:00:00+00:00"),
+			expectPostDeactivated: []string{"1"},
+		},
+		{
+			name:                  "Within grace period. Should not run the hook.",
+			now:                   str2Time("2000-01-01T08:00:00+00:00"),
+			expectPostDeactivated: nil,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: map[string]string{
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+								"v2":                       "key_id-2",
+							},
+						},
+					},
+				},
+			}
+
+			provisioner := &tests.MockSvcProvisioner{}
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): provisioner,
+				},
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				GracePeriod: str2Duration("2h"),
+			}
+
+			err := rotator.Deactivate(spec, tc.now)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(provisioner.PostDeactivated, tc.expectPostDeactivated) {
+				t.Errorf("Expected post-deactivated versions %v, but got %v.", tc.expectPostDeactivated, provisioner.PostDeactivated)
+			}
+			// the hook identifies the key of the destroyed version by its version label
+			if len(tc.expectPostDeactivated) != 0 && provisioner.PostDeactivatedLabels["v1"] != "key_id-1" {
+				t.Errorf("Expected the hook to get label v1=key_id-1, but got %v.", provisioner.PostDeactivatedLabels)
+			}
+		})
+	}
+}
+
+// fakeProber records the versions probed, and fails them with err.
+type fakeProber struct {
+	probed []string
+	err    error
+}
+
+func (p *fakeProber) Probe(rotatedSecret config.RotatedSecretSpec, version string) error {
+	p.probed = append(p.probed, version)
+	return p.err
+}
+
+func TestPreDeactivateProbe(t *testing.T) {
+	var testcases = []struct {
+		name                  string
+		now                   time.Time
+		probeErr              error
+		expectProbed          []string
+		expectPostDeactivated []string
+		expectPostponed       float64
+	}{
+		{
+			name:                  "Probe passes. Should deactivate the version.",
+			now:                   str2Time("2000-01-01T10:00:00+00:00"),
+			expectProbed:          []string{"1"},
+			expectPostDeactivated: []string{"1"},
+		},
+		{
+			name:            "Probe fails. Should postpone the deactivation.",
+			now:             str2Time("2000-01-01T10:00:00+00:00"),
+			probeErr:        fmt.Errorf("consumers unhealthy"),
+			expectProbed:    []string{"1"},
+			expectPostponed: 1,
+		},
+		{
+			name:         "Within grace period. Should not run the probe.",
+			now:          str2Time("2000-01-01T08:00:00+00:00"),
+			expectProbed: nil,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: map[string]string{
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+								"v2":                       "key_id-2",
+							},
+						},
+					},
+				},
+			}
+
+			provisioner := &tests.MockSvcProvisioner{}
+			prober := &fakeProber{err: tc.probeErr}
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): provisioner,
+				},
+				Prober: prober,
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				GracePeriod:        str2Duration("2h"),
+				PreDeactivateProbe: &config.PreDeactivateProbe{HTTP: "http://consumer/healthz"},
+			}
+
+			postponed := testutil.ToFloat64(deactivationPostponed.WithLabelValues("project-1", "secret-1"))
+			err := rotator.Deactivate(spec, tc.now)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(prober.probed, tc.expectProbed) {
+				t.Errorf("Expected probed versions %v, but got %v.", tc.expectProbed, prober.probed)
+			}
+			if !reflect.DeepEqual(provisioner.PostDeactivated, tc.expectPostDeactivated) {
+				t.Errorf("Expected deactivated versions %v, but got %v.", tc.expectPostDeactivated, provisioner.PostDeactivated)
+			}
+			state := cl.Secrets["project-1"]["secret-1"].Versions["1"].State
+			if len(tc.expectPostDeactivated) == 0 && state != secretmanagerpb.SecretVersion_ENABLED {
+				t.Errorf("Expected version 1 kept ENABLED, but got %s.", state)
+			}
+			delta := testutil.ToFloat64(deactivationPostponed.WithLabelValues("project-1", "secret-1")) - postponed
+			if delta != tc.expectPostponed {
+				t.Errorf("Expected %v postponed deactivations, but got %v.", tc.expectPostponed, delta)
+			}
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	cl := &tests.MockClient{
+		Secrets: map[string]map[string]*tests.Secret{
+			"project-1": map[string]*tests.Secret{
+				"secret-1": &tests.Secret{
+					Versions: map[string]*tests.Version{
+						"1": &tests.Version{
+							CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+							Data:       []byte("secret-data-1"),
+							State:      secretmanagerpb.SecretVersion_ENABLED,
+						},
+						"2": &tests.Version{
+							CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+							Data:       []byte("secret-data-2"),
+							State:      secretmanagerpb.SecretVersion_ENABLED,
+						},
+					},
+					Labels: map[string]string{
+						svckey.ProjectLabel:        "project-1",
+						svckey.ServiceAccountLabel: "service-foo",
+						"v1":                       "key_id-1",
+						"v2":                       "key_id-2",
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	rotator := &SecretRotator{
+		Client: cl,
+		Provisioners: map[string]SecretProvisioner{
+			svckey.ServiceAccountKeySpec{}.Type(): &tests.MockSvcProvisioner{},
+		},
+		AuditLogger: audit.NewLogger(&buf, "secret-rotator", "pod-1"),
+	}
+
+	spec := config.RotatedSecretSpec{
+		Project: "project-1",
+		Secret:  "secret-1",
+		Type: config.RotatedSecretType{
+			ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+				Project:        "project-1",
+				ServiceAccount: "service-foo",
+			},
+		},
+		Refresh:     config.RefreshStrategy{Interval: str2Duration("20h")},
+		GracePeriod: str2Duration("2h"),
+	}
+
+	var steps = []struct {
+		name         string
+		operation    func() error
+		expectRecord *audit.Record
+	}{
+		{
+			name: "Deactivate. Should record the deactivated version.",
+			operation: func() error {
+				return rotator.Deactivate(spec, str2Time("2000-01-01T10:00:00+00:00"))
+			},
+			expectRecord: &audit.Record{Operation: audit.Deactivate, Spec: spec.String(), Result: audit.Succeeded, Version: "1"},
+		},
+		{
+			name: "Within refresh interval. Should not record.",
+			operation: func() error {
+				_, err := rotator.Refresh(spec, nil, str2Time("2000-01-01T08:00:00+00:00"))
+				return err
+			},
+		},
+		{
+			name: "Refresh. Should record the new version.",
+			operation: func() error {
+				_, err := rotator.Refresh(spec, nil, str2Time("2000-01-02T08:00:00+00:00"))
+				return err
+			},
+			expectRecord: &audit.Record{Operation: audit.Refresh, Spec: spec.String(), Result: audit.Succeeded, Version: "3"},
+		},
+	}
+	for _, step := range steps {
+		buf.Reset()
+		err := step.operation()
+		if err != nil {
+			t.Fatalf("%s Unexpected error: %s", step.name, err)
+		}
+
+		// the audit trail never holds the provisioned secrets
+		for _, version := range cl.Secrets["project-1"]["secret-1"].Versions {
+			if len(version.Data) != 0 && bytes.Contains(buf.Bytes(), version.Data) {
+				t.Errorf("%s Expected no secret value in the audit log, but got %q.", step.name, buf.String())
+			}
+		}
+
+		lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+		if step.expectRecord == nil {
+			if buf.Len() != 0 {
+				t.Errorf("%s Expected no record, but got %q.", step.name, buf.String())
+			}
+			continue
+		}
+		if len(lines) != 1 {
+			t.Fatalf("%s Expected exactly one record, but got %q.", step.name, buf.String())
+		}
+		record := audit.Record{}
+		err = json.Unmarshal(lines[0], &record)
+		if err != nil {
+			t.Fatalf("%s Invalid record %q: %s", step.name, lines[0], err)
+		}
+		if record.Component != "secret-rotator" || record.Actor != "pod-1" || record.Time.IsZero() {
+			t.Errorf("%s Expected the record stamped with its time, component and actor, but got %+v.", step.name, record)
+		}
+		record.Time, record.Component, record.Actor = time.Time{}, "", ""
+		if record != *step.expectRecord {
+			t.Errorf("%s Expected record %+v, but got %+v.", step.name, *step.expectRecord, record)
+		}
+	}
+}
+
+func TestAdoptExisting(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		versions     map[string]*tests.Version
+		labels       map[string]string
+		expectLabels map[string]string
+		expectErr    bool
+	}{
+		{
+			name: "Unmanaged key. Should record its key-id.",
+			versions: map[string]*tests.Version{
+				"1": &tests.Version{Data: []byte("manual-key"), State: secretmanagerpb.SecretVersion_ENABLED},
+			},
+			labels:       map[string]string{},
+			expectLabels: map[string]string{"v1": "key_id-manual"},
+		},
+		{
+			name: "Managed key. Should leave the version store unchanged.",
+			versions: map[string]*tests.Version{
+				"1": &tests.Version{Data: []byte("manual-key"), State: secretmanagerpb.SecretVersion_ENABLED},
+				"2": &tests.Version{Data: []byte("rotated-key"), State: secretmanagerpb.SecretVersion_ENABLED},
+			},
+			labels:       map[string]string{"v2": "key_id-2"},
+			expectLabels: map[string]string{"v2": "key_id-2"},
+		},
+		{
+			name:         "No version. Should adopt nothing.",
+			versions:     map[string]*tests.Version{},
+			labels:       map[string]string{},
+			expectLabels: map[string]string{},
+		},
+		{
+			name: "Key not found by the provisioner. Should return error.",
+			versions: map[string]*tests.Version{
+				"1": &tests.Version{Data: []byte("unknown-key"), State: secretmanagerpb.SecretVersion_ENABLED},
+			},
+			labels:       map[string]string{},
+			expectLabels: map[string]string{},
+			expectErr:    true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: tc.versions,
+							Labels:   tc.labels,
+						},
+					},
+				},
+			}
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): &tests.MockSvcProvisioner{
+						AdoptedIDs: map[string]string{"manual-key": "key_id-manual"},
+					},
+				},
+			}
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				AdoptExistingKey: true,
+			}
+
+			err := rotator.AdoptExisting(spec)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("Expected error %v, but got %v.", tc.expectErr, err)
+			}
+
+			labels, err := cl.GetSecretLabels("project-1", "secret-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(labels, tc.expectLabels) {
+				t.Errorf("Expected labels %v, but got %v.", tc.expectLabels, labels)
+			}
+		})
+	}
+}
+
+func TestDeactivateDecoyLabels(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		decoys       []string
+		expectLabels []string
+	}{
+		{
+			name:         "Label v2024 beyond the latest version. Should not be treated as a version.",
+			decoys:       []string{"v2024"},
+			expectLabels: []string{"v2", "v2024"},
+		},
+		{
+			name:         "Label v01 with a leading zero. Should not be treated as a version.",
+			decoys:       []string{"v01"},
+			expectLabels: []string{"v2", "v01"},
+		},
+		{
+			name:         "Label v0. Should not be treated as a version.",
+			decoys:       []string{"v0"},
+			expectLabels: []string{"v2", "v0"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			labels := map[string]string{
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v1":                       "key_id-1",
+				"v2":                       "key_id-2",
+			}
+			for _, decoy := range tc.decoys {
+				labels[decoy] = "decoy"
+			}
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: labels,
+						},
+					},
+				},
+			}
+
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): &tests.MockSvcProvisioner{},
+				},
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				GracePeriod: str2Duration("2h"),
+			}
+
+			err := rotator.Deactivate(spec, str2Time("2000-01-01T10:00:00+00:00"))
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			state, err := cl.GetSecretVersionState("project-1", "secret-1", "1")
+			if err != nil {
+				t.Error(err)
+			}
+			if state != secretmanagerpb.SecretVersion_DESTROYED {
+				t.Errorf("Expected v1 %s, but got %s.", secretmanagerpb.SecretVersion_DESTROYED, state)
+			}
+
+			got, err := cl.GetSecretLabels("project-1", "secret-1")
+			if err != nil {
+				t.Error(err)
+			}
+			expectedLabels := []string{svckey.ProjectLabel, svckey.ServiceAccountLabel}
+			expectedLabels = append(expectedLabels, tc.expectLabels...)
+			if !sets.StringKeySet(got).Equal(sets.NewString(expectedLabels...)) {
+				t.Errorf("Expected labels %v, but got %v.", expectedLabels, got)
+			}
+		})
+	}
+}
+
+func TestRotatePastDecoyLabel(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		labels map[string]string
+	}{
+		{
+			name:   "Decoy label of the next version. Should be replaced by the new version.",
+			labels: map[string]string{"v2": "decoy"},
+		},
+		{
+			name:   "No decoy label. Should add the new version.",
+			labels: map[string]string{},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			labels := map[string]string{
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v1":                       "key_id-1",
+			}
+			for key, val := range tc.labels {
+				labels[key] = val
+			}
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: labels,
+						},
+					},
+				},
+			}
+
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): &tests.MockSvcProvisioner{},
+				},
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				Refresh: config.RefreshStrategy{
+					Interval: str2Duration("20h"),
+				},
+				GracePeriod: str2Duration("20h"),
+				Labels:      map[string]string{"owner": "team-foo"},
+			}
+
+			refreshed, err := rotator.RotateOne(spec, nil, str2Time("2000-01-02T00:00:00+00:00"))
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if !refreshed {
+				t.Errorf("Expected the secret to be refreshed.")
+			}
+
+			got, err := cl.GetSecretLabels("project-1", "secret-1")
+			if err != nil {
+				t.Error(err)
+			}
+			if got["owner"] != "team-foo" {
+				t.Errorf("Expected label owner team-foo, but got %q.", got["owner"])
+			}
+			if id := got["v2"]; id == "" || id == "decoy" {
+				t.Errorf("Expected label v2 to hold the id of the new version, but got %q.", id)
+			}
+		})
+	}
+}
+
+func TestLabelOverrides(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		labels map[string]string
+		// agent sets the floor of the refresh intervals, config.DefaultMinRefreshInterval if nil
+		agent                 *config.Agent
+		expectErr             bool
+		expectRefresh         bool
+		expectDeactivateFirst bool
+	}{
+		{
+			name:                  "Override labels absent. Should use the interval and grace period of the spec.",
+			labels:                map[string]string{},
+			expectErr:             false,
+			expectRefresh:         false,
+			expectDeactivateFirst: true,
+		},
+		{
+			name: "Override labels present. Should use the interval and grace period of the labels.",
+			labels: map[string]string{
+				config.RefreshIntervalLabel: "2h",
+				config.GracePeriodLabel:     "5h",
+			},
+			expectErr:             false,
+			expectRefresh:         true,
+			expectDeactivateFirst: false,
+		},
+		{
+			name: "Malformed override label. Should fail.",
+			labels: map[string]string{
+				config.RefreshIntervalLabel: "two-hours",
+			},
+			expectErr: true,
+		},
+		{
+			name: "Override label below the default floor. Should fail.",
+			labels: map[string]string{
+				config.RefreshIntervalLabel: "30m",
+			},
+			expectErr: true,
+		},
+		{
+			name: "Override label below the default floor with short intervals allowed by the agent. Should use the interval of the label.",
+			labels: map[string]string{
+				config.RefreshIntervalLabel: "30m",
+			},
+			agent:                 &config.Agent{MinRefreshInterval: 0},
+			expectErr:             false,
+			expectRefresh:         true,
+			expectDeactivateFirst: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			labels := map[string]string{
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v1":                       "key_id-1",
+				"v2":                       "key_id-2",
+			}
+			for key, val := range tc.labels {
+				labels[key] = val
+			}
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: labels,
+						},
+					},
+				},
+			}
+
+			rotator := &SecretRotator{
+				Client: cl,
+				Agent:  tc.agent,
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				Refresh:        config.RefreshStrategy{Interval: str2Duration("24h")},
+				GracePeriod:    str2Duration("2h"),
+				LabelOverrides: true,
+			}
+			now := str2Time("2000-01-01T10:00:00+00:00")
+
+			shouldRefresh, err := rotator.ShouldRefresh(spec, nil, now)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			} else if shouldRefresh != tc.expectRefresh {
+				t.Errorf("Expected refresh %v, but got %v.", tc.expectRefresh, shouldRefresh)
+			}
+
+			shouldDeactivate, err := rotator.ShouldDeactivate(spec, "1", now)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			} else if shouldDeactivate != tc.expectDeactivateFirst {
+				t.Errorf("Expected deactivating v1 %v, but got %v.", tc.expectDeactivateFirst, shouldDeactivate)
+			}
+		})
+	}
+}
+
+func TestAckBasedDeactivation(t *testing.T) {
+	var testcases = []struct {
+		name             string
+		labels           map[string]string
+		maxWait          time.Duration
+		expectDeactivate bool
+	}{
+		{
+			name:             "Next version acknowledged. Should deactivate.",
+			labels:           map[string]string{config.AckLabel("2"): "consumer-a"},
+			expectDeactivate: true,
+		},
+		{
+			name:             "Later version acknowledged. Should deactivate.",
+			labels:           map[string]string{config.AckLabel("3"): ""},
+			expectDeactivate: true,
+		},
+		{
+			name:             "Only the version itself acknowledged. Should not deactivate.",
+			labels:           map[string]string{config.AckLabel("1"): ""},
+			expectDeactivate: false,
+		},
+		{
+			name:             "Acknowledgement absent without max wait. Should not deactivate, even out of the grace period.",
+			labels:           map[string]string{},
+			expectDeactivate: false,
+		},
+		{
+			name:             "Acknowledgement absent within the max wait. Should not deactivate.",
+			labels:           map[string]string{},
+			maxWait:          str2Duration("5h"),
+			expectDeactivate: false,
+		},
+		{
+			name:             "Acknowledgement absent beyond the max wait. Should fall back to deactivate.",
+			labels:           map[string]string{},
+			maxWait:          str2Duration("2h"),
+			expectDeactivate: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			labels := map[string]string{
+				svckey.ProjectLabel:        "project-1",
+				svckey.ServiceAccountLabel: "service-foo",
+				"v1":                       "key_id-1",
+				"v2":                       "key_id-2",
+				"v3":                       "key_id-3",
+			}
+			for key, val := range tc.labels {
+				labels[key] = val
+			}
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"3": &tests.Version{
+									CreateTime: str2Time("2000-01-01T08:00:00+00:00"),
+									Data:       []byte("secret-data-3"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: labels,
+						},
+					},
+				},
+			}
+
+			rotator := &SecretRotator{
+				Client: cl,
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				Refresh:              config.RefreshStrategy{Interval: str2Duration("24h")},
+				GracePeriod:          str2Duration("1h"),
+				AckBasedDeactivation: &config.AckBasedDeactivation{MaxWait: tc.maxWait},
+			}
+			now := str2Time("2000-01-01T10:00:00+00:00")
+
+			shouldDeactivate, err := rotator.ShouldDeactivate(spec, "1", now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if shouldDeactivate != tc.expectDeactivate {
+				t.Errorf("Expected deactivating v1 %v, but got %v.", tc.expectDeactivate, shouldDeactivate)
+			}
+		})
+	}
+}
+
+func TestKeepVersions(t *testing.T) {
+	var testcases = []struct {
+		name             string
+		versions         int
+		destroyed        []string
+		keepVersions     int
+		gracePeriod      time.Duration
+		expectDeactivate []string
+	}{
+		{
+			name:             "Three versions, keep two. Should deactivate the oldest version.",
+			versions:         3,
+			keepVersions:     2,
+			expectDeactivate: []string{"1"},
+		},
+		{
+			name:             "Three versions, keep three. Should deactivate no version.",
+			versions:         3,
+			keepVersions:     3,
+			expectDeactivate: []string{},
+		},
+		{
+			name:             "Five versions, keep two. Should deactivate the three oldest versions.",
+			versions:         5,
+			keepVersions:     2,
+			expectDeactivate: []string{"1", "2", "3"},
+		},
+		{
+			name:             "Single version, keep one. Should deactivate no version.",
+			versions:         1,
+			keepVersions:     1,
+			expectDeactivate: []string{},
+		},
+		{
+			name:             "Newer version destroyed. Should not count it as kept.",
+			versions:         4,
+			destroyed:        []string{"3"},
+			keepVersions:     2,
+			expectDeactivate: []string{"1"},
+		},
+		{
+			name:             "Keep two, next versions within grace period. Should only deactivate the versions past both.",
+			versions:         4,
+			keepVersions:     2,
+			gracePeriod:      str2Duration("36h"),
+			expectDeactivate: []string{"1"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			// a version a day, from 2000-01-01
+			versions := map[string]*tests.Version{}
+			for i := 1; i <= tc.versions; i++ {
+				versions[strconv.Itoa(i)] = &tests.Version{
+					CreateTime: str2Time("2000-01-01T00:00:00+00:00").Add(time.Duration(i-1) * 24 * time.Hour),
+					Data:       []byte("secret-data-" + strconv.Itoa(i)),
+					State:      secretmanagerpb.SecretVersion_ENABLED,
+				}
+			}
+			for _, version := range tc.destroyed {
+				versions[version].State = secretmanagerpb.SecretVersion_DESTROYED
+			}
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: versions,
+							Labels:   map[string]string{},
+						},
+					},
+				},
+			}
+			rotator := &SecretRotator{
+				Client: cl,
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				Refresh:      config.RefreshStrategy{Interval: str2Duration("24h")},
+				GracePeriod:  tc.gracePeriod,
+				KeepVersions: tc.keepVersions,
+			}
+			// half a day after the latest version
+			now := str2Time("2000-01-01T12:00:00+00:00").Add(time.Duration(tc.versions-1) * 24 * time.Hour)
+
+			deactivate := []string{}
+			for i := 1; i <= tc.versions; i++ {
+				version := strconv.Itoa(i)
+				if sets.NewString(tc.destroyed...).Has(version) {
+					continue
+				}
+				shouldDeactivate, err := rotator.ShouldDeactivate(spec, version, now)
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+				if shouldDeactivate {
+					deactivate = append(deactivate, version)
+				}
+			}
+			if !reflect.DeepEqual(deactivate, tc.expectDeactivate) {
+				t.Errorf("Expected deactivating versions %v, but got %v.", tc.expectDeactivate, deactivate)
+			}
+		})
+	}
+}
+
+func TestDeactivateLastEnabledVersion(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		latestState   secretmanagerpb.SecretVersion_State
+		expectedState secretmanagerpb.SecretVersion_State
+		expectGuarded float64
+	}{
+		{
+			name:          "v2 is enabled. Should destroy v1 out of gracePeriod.",
+			latestState:   secretmanagerpb.SecretVersion_ENABLED,
+			expectedState: secretmanagerpb.SecretVersion_DESTROYED,
+			expectGuarded: 0,
+		},
+		{
+			name:          "v2 is disabled, v1 is the last enabled version. Should not destroy v1.",
+			latestState:   secretmanagerpb.SecretVersion_DISABLED,
+			expectedState: secretmanagerpb.SecretVersion_ENABLED,
+			expectGuarded: 1,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			lastVersionGuarded.Reset()
+
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      tc.latestState,
+								},
+							},
+							Labels: map[string]string{
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+								"v2":                       "key_id-2",
+							},
+						},
+					},
+				},
+			}
+
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): &tests.MockSvcProvisioner{},
+				},
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				GracePeriod: str2Duration("2h"),
+			}
+
+			err := rotator.Deactivate(spec, str2Time("2000-01-01T10:00:00+00:00"))
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			state, err := cl.GetSecretVersionState("project-1", "secret-1", "1")
+			if err != nil {
+				t.Error(err)
+			}
+			if state != tc.expectedState {
+				t.Errorf("Expected v1 %s, but got %s.", tc.expectedState, state)
+			}
+
+			guarded := testutil.ToFloat64(lastVersionGuarded.WithLabelValues("project-1", "secret-1"))
+			if guarded != tc.expectGuarded {
+				t.Errorf("Expected guarded metric %v, but got %v.", tc.expectGuarded, guarded)
+			}
+		})
+	}
+}
+
+func TestBootstrapSecret(t *testing.T) {
+	var testcases = []struct {
+		name            string
+		existing        *tests.Secret
+		locations       []string
+		expectLocations []string
+		expectDrift     float64
+	}{
+		{
+			name:            "Non-existing secret. Should create the secret with the requested replication.",
+			existing:        nil,
+			locations:       []string{"us-east1", "us-west1"},
+			expectLocations: []string{"us-east1", "us-west1"},
+			expectDrift:     0,
+		},
+		{
+			name: "Existing secret with the same replication in different order. Should not report drift.",
+			existing: &tests.Secret{
+				Locations: []string{"us-west1", "us-east1"},
+			},
+			locations:       []string{"us-east1", "us-west1"},
+			expectLocations: []string{"us-west1", "us-east1"},
+			expectDrift:     0,
+		},
+		{
+			name: "Existing user-managed secret with automatic replication requested. Should report drift.",
+			existing: &tests.Secret{
+				Locations: []string{"us-east1"},
+			},
+			locations:       nil,
+			expectLocations: []string{"us-east1"},
+			expectDrift:     1,
+		},
+		{
+			name:            "Existing automatic secret with user-managed replication requested. Should report drift.",
+			existing:        &tests.Secret{},
+			locations:       []string{"us-east1"},
+			expectLocations: nil,
+			expectDrift:     1,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{},
+				},
+			}
+			if tc.existing != nil {
+				cl.Secrets["project-1"]["secret-1"] = tc.existing
+			}
+
+			rotator := &SecretRotator{
+				Client: cl,
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Replication: config.ReplicationSpec{
+					Locations: tc.locations,
+				},
+			}
+
+			err := rotator.BootstrapSecret(spec)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			locations, err := cl.GetSecretReplication("project-1", "secret-1")
+			if err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(locations, tc.expectLocations) {
+				t.Errorf("Expected locations %v, but got %v.", tc.expectLocations, locations)
+			}
+
+			drift := testutil.ToFloat64(replicationDrift.WithLabelValues("project-1", "secret-1"))
+			if drift != tc.expectDrift {
+				t.Errorf("Expected replication drift %v, but got %v.", tc.expectDrift, drift)
+			}
+		})
+	}
+}
+
+func TestCheckReplicationError(t *testing.T) {
+	cl := &tests.MockClient{
+		Secrets: map[string]map[string]*tests.Secret{
+			"project-1": map[string]*tests.Secret{},
+		},
+	}
+	rotator := &SecretRotator{
+		Client: cl,
+	}
+	spec := config.RotatedSecretSpec{
+		Project: "project-1",
+		Secret:  "deleted-secret",
+	}
+
+	// a drift reported before the secret was deleted
+	replicationDrift.WithLabelValues("project-1", "deleted-secret").Set(1)
+
+	err := rotator.CheckReplication(spec)
+	if err == nil {
+		t.Errorf("Expected error for a missing secret.")
+	}
+
+	drift := testutil.ToFloat64(replicationDrift.WithLabelValues("project-1", "deleted-secret"))
+	if drift != 0 {
+		t.Errorf("Expected the stale replication drift to be reset, but got %v.", drift)
+	}
+}
+
+func TestRefreshPayloadTemplate(t *testing.T) {
+	var testcases = []struct {
+		name     string
+		template string
+		// expect renders the expected payload from the provisioned id and secret, nil if rendering fails
+		expect func(id, secret string) string
+	}{
+		{
+			name:     "No template. Should store the provisioned secret as is.",
+			template: "",
+			expect:   func(id, secret string) string { return secret },
+		},
+		{
+			name:     "Template. Should store the rendered payload.",
+			template: "host=db.example.com user={{.ID}} password={{.Secret}}",
+			expect: func(id, secret string) string {
+				return "host=db.example.com user=" + id + " password=" + secret
+			},
+		},
+		{
+			name:     "Template failing to render. Should discard the new secret without publishing it.",
+			template: "user={{.ID.Name}}",
+			expect:   nil,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{},
+				},
+			}
+			provisioner := &recordingProvisioner{}
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): provisioner,
+				},
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				Refresh: config.RefreshStrategy{
+					Interval: str2Duration("20h"),
+				},
+				PayloadTemplate: tc.template,
+			}
+
+			err := rotator.BootstrapSecret(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			refreshed, err := rotator.Refresh(spec, nil, str2Time("2000-01-02T00:00:00+00:00"))
+			if tc.expect == nil {
+				if err == nil || refreshed {
+					t.Fatalf("Expected the refresh to fail, but got refreshed: %t, error: %v.", refreshed, err)
+				}
+				if !reflect.DeepEqual(provisioner.Discarded, []string{provisioner.id}) {
+					t.Errorf("Expected discarded secrets %v, but got %v.", []string{provisioner.id}, provisioner.Discarded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !refreshed {
+				t.Fatalf("Expected refresh in secret.")
+			}
+			if len(provisioner.Discarded) != 0 {
+				t.Errorf("Unexpected discarded secrets %v.", provisioner.Discarded)
+			}
+
+			payload, err := cl.GetSecretVersionData("project-1", "secret-1", "latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := tc.expect(provisioner.id, string(provisioner.secret))
+			if string(payload) != expected {
+				t.Errorf("Expected payload %q, but got %q.", expected, payload)
+			}
+		})
+	}
+}
+
+// recordingProvisioner wraps tests.MockSvcProvisioner, recording the last provisioned secret.
+type recordingProvisioner struct {
+	tests.MockSvcProvisioner
+	id     string
+	secret []byte
+}
+
+func (p *recordingProvisioner) CreateNew(labels map[string]string) (string, []byte, error) {
+	id, secret, err := p.MockSvcProvisioner.CreateNew(labels)
+	p.id, p.secret = id, secret
+	return id, secret, err
+}
+
+func TestShouldRefreshCombined(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		triggered     bool
+		now           time.Time
+		expectRefresh bool
+	}{
+		{
+			name:          "Cron triggered within the interval. Should refresh.",
+			triggered:     true,
+			now:           str2Time("2000-01-01T01:00:00+00:00"),
+			expectRefresh: true,
+		},
+		{
+			name:          "Interval elapsed without cron trigger. Should refresh.",
+			triggered:     false,
+			now:           str2Time("2000-01-03T00:00:00+00:00"),
+			expectRefresh: true,
+		},
+		{
+			name:          "Both pending. Should not refresh.",
+			triggered:     false,
+			now:           str2Time("2000-01-01T01:00:00+00:00"),
+			expectRefresh: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			rotator := &SecretRotator{
+				Client: &tests.MockClient{
+					Secrets: map[string]map[string]*tests.Secret{
+						"project-1": map[string]*tests.Secret{
+							"secret-1": &tests.Secret{
+								Versions: map[string]*tests.Version{
+									"1": &tests.Version{
+										CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+										Data:       []byte("secret-data-1"),
+										State:      secretmanagerpb.SecretVersion_ENABLED,
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Refresh: config.RefreshStrategy{
+					Interval: str2Duration("24h"),
+					Cron:     "0 0 * * 0",
+				},
+			}
+			triggered := map[config.SpecID]bool{}
+			if tc.triggered {
+				triggered[spec.ID()] = true
+			}
+
+			refresh, err := rotator.ShouldRefresh(spec, triggered, tc.now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if refresh != tc.expectRefresh {
+				t.Errorf("Expected refresh %v, but got %v.", tc.expectRefresh, refresh)
+			}
+		})
+	}
+}
+
+func TestPaused(t *testing.T) {
+	var testcases = []struct {
+		name            string
+		configPaused    bool
+		rotatorPaused   bool
+		expectVersions  int
+		expectV1State   secretmanagerpb.SecretVersion_State
+		expectPausedVal float64
+	}{
+		{
+			name:            "Paused by config. Should neither refresh nor deactivate.",
+			configPaused:    true,
+			expectVersions:  2,
+			expectV1State:   secretmanagerpb.SecretVersion_ENABLED,
+			expectPausedVal: 1,
+		},
+		{
+			name:            "Paused by rotator. Should neither refresh nor deactivate.",
+			rotatorPaused:   true,
+			expectVersions:  2,
+			expectV1State:   secretmanagerpb.SecretVersion_ENABLED,
+			expectPausedVal: 1,
+		},
+		{
+			name:            "Not paused. Should refresh and deactivate.",
+			expectVersions:  3,
+			expectV1State:   secretmanagerpb.SecretVersion_DESTROYED,
+			expectPausedVal: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{
+						"secret-1": &tests.Secret{
+							Versions: map[string]*tests.Version{
+								"1": &tests.Version{
+									CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+									Data:       []byte("secret-data-1"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+								"2": &tests.Version{
+									CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+									Data:       []byte("secret-data-2"),
+									State:      secretmanagerpb.SecretVersion_ENABLED,
+								},
+							},
+							Labels: map[string]string{
+								svckey.ProjectLabel:        "project-1",
+								svckey.ServiceAccountLabel: "service-foo",
+								"v1":                       "key_id-1",
+								"v2":                       "key_id-2",
+							},
+						},
+					},
+				},
+			}
+
+			provisioner := &tests.MockSvcProvisioner{
+				NewSecretID:    "key_id-3",
+				NewSecretValue: []byte("secret-data-3"),
+			}
+			rotator := &SecretRotator{
+				Client: cl,
+				Agent:  config.NewAgent(),
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): provisioner,
+				},
+				Paused: tc.rotatorPaused,
+			}
+			rotator.Agent.Set(&config.RotatedSecretConfig{
+				Specs: []config.RotatedSecretSpec{
+					{
+						Project: "project-1",
+						Secret:  "secret-1",
+						Type: config.RotatedSecretType{
+							ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+								Project:        "project-1",
+								ServiceAccount: "service-foo",
+							},
+						},
+						Refresh:     config.RefreshStrategy{Interval: str2Duration("24h")},
+						GracePeriod: str2Duration("2h"),
+					},
+				},
+				Paused: tc.configPaused,
+			})
+
+			rotator.RotateAll()
+
+			secret := cl.Secrets["project-1"]["secret-1"]
+			if len(secret.Versions) != tc.expectVersions {
+				t.Errorf("Expected %d versions, but got %d.", tc.expectVersions, len(secret.Versions))
+			}
+			if state := secret.Versions["1"].State; state != tc.expectV1State {
+				t.Errorf("Expected version 1 to be %s, but got %s.", tc.expectV1State, state)
+			}
+			if gauge := testutil.ToFloat64(paused); gauge != tc.expectPausedVal {
+				t.Errorf("Expected paused metric %v, but got %v.", tc.expectPausedVal, gauge)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"encoding/json"
+	"net/http"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RefreshStatus is the refresh schedule of a rotated secret, holding no secret value.
+type RefreshStatus struct {
+	Project     string    `json:"project"`
+	Secret      string    `json:"secret"`
+	NextRefresh time.Time `json:"nextRefresh"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// NextRefresh returns the next time rotatedSecret is due for refreshing after now, as decided by ShouldRefresh(),
+// i.e. the earliest of the next fire time of 'rotatedSecret.Refresh.Cron'
+// and the createTime of the latest version plus 'rotatedSecret.Refresh.Interval'.
+// Returns now if the secret is already due, e.g. if it has no version yet.
+func (r *SecretRotator) NextRefresh(rotatedSecret config.RotatedSecretSpec, now time.Time) (time.Time, error) {
+	next, err := rotatedSecret.Refresh.NextCronTime(now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if rotatedSecret.Refresh.Interval == 0 {
+		// cron only
+		return next, nil
+	}
+
+	err = r.Client.ValidateSecretVersion(rotatedSecret.Project, rotatedSecret.Secret, "1")
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return now, nil
+		}
+		return time.Time{}, err
+	}
+
+	rotatedSecret, err = r.resolveOverrides(rotatedSecret)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	createTime, err := r.Client.GetCreateTime(rotatedSecret.Project, rotatedSecret.Secret, "latest")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	due := createTime.Add(rotatedSecret.Refresh.Interval)
+	if due.Before(now) {
+		due = now
+	}
+	if next.IsZero() || due.Before(next) {
+		next = due
+	}
+	return next, nil
+}
+
+// Status returns the RefreshStatus of each rotated secret in Agent.Config().Specs at now,
+// and records their next refresh times in the next refresh metric.
+func (r *SecretRotator) Status(now time.Time) []RefreshStatus {
+	statuses := []RefreshStatus{}
+	for _, rotatedSecret := range r.Agent.Config().Specs {
+		statuses = append(statuses, r.recordNextRefresh(rotatedSecret, now))
+	}
+	return statuses
+}
+
+// recordNextRefresh returns the RefreshStatus of rotatedSecret at now, and records its next refresh time in the metric.
+func (r *SecretRotator) recordNextRefresh(rotatedSecret config.RotatedSecretSpec, now time.Time) RefreshStatus {
+	s := RefreshStatus{
+		Project: rotatedSecret.Project,
+		Secret:  rotatedSecret.Secret,
+	}
+	next, err := r.NextRefresh(rotatedSecret, now)
+	if err != nil {
+		s.Error = err.Error()
+		nextRefresh.DeleteLabelValues(rotatedSecret.Project, rotatedSecret.Secret)
+		return s
+	}
+	s.NextRefresh = next
+	nextRefresh.WithLabelValues(rotatedSecret.Project, rotatedSecret.Secret).Set(float64(next.Unix()))
+	return s
+}
+
+// StatusHandler serves the Status() of the rotated secrets as JSON on GET requests.
+func (r *SecretRotator) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Status(time.Now()))
+	})
+}
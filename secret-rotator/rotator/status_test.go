@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/tests"
+	"testing"
+	"time"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+func newStatusClient() *tests.MockClient {
+	return &tests.MockClient{
+		Secrets: map[string]map[string]*tests.Secret{
+			"project-1": map[string]*tests.Secret{
+				"secret-1": &tests.Secret{
+					Versions: map[string]*tests.Version{
+						"1": &tests.Version{
+							CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+							Data:       []byte("secret-data-1"),
+							State:      secretmanagerpb.SecretVersion_ENABLED,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestNextRefresh(t *testing.T) {
+	var testcases = []struct {
+		name              string
+		secret            string
+		refresh           config.RefreshStrategy
+		now               time.Time
+		expectNextRefresh time.Time
+	}{
+		{
+			name:              "Interval pending. Should be createTime + interval.",
+			secret:            "secret-1",
+			refresh:           config.RefreshStrategy{Interval: str2Duration("24h")},
+			now:               str2Time("2000-01-01T12:00:00+00:00"),
+			expectNextRefresh: str2Time("2000-01-02T00:00:00+00:00"),
+		},
+		{
+			name:              "Interval elapsed. Should be due now.",
+			secret:            "secret-1",
+			refresh:           config.RefreshStrategy{Interval: str2Duration("24h")},
+			now:               str2Time("2000-01-03T00:00:00+00:00"),
+			expectNextRefresh: str2Time("2000-01-03T00:00:00+00:00"),
+		},
+		{
+			name:              "Secret without version. Should be due now.",
+			secret:            "secret-2",
+			refresh:           config.RefreshStrategy{Interval: str2Duration("24h")},
+			now:               str2Time("2000-01-01T12:00:00+00:00"),
+			expectNextRefresh: str2Time("2000-01-01T12:00:00+00:00"),
+		},
+		{
+			name:              "Cron only. Should be the next cron fire time.",
+			secret:            "secret-1",
+			refresh:           config.RefreshStrategy{Cron: "0 0 0 * * 0"},
+			now:               str2Time("2000-01-01T12:00:00+00:00"),
+			expectNextRefresh: str2Time("2000-01-02T00:00:00+00:00"),
+		},
+		{
+			name:              "Cron firing before the interval elapses. Should be the next cron fire time.",
+			secret:            "secret-1",
+			refresh:           config.RefreshStrategy{Interval: str2Duration("240h"), Cron: "0 0 0 * * 0"},
+			now:               str2Time("2000-01-01T12:00:00+00:00"),
+			expectNextRefresh: str2Time("2000-01-02T00:00:00+00:00"),
+		},
+		{
+			name:              "Interval elapsing before the cron fires. Should be createTime + interval.",
+			secret:            "secret-1",
+			refresh:           config.RefreshStrategy{Interval: str2Duration("6h"), Cron: "0 0 0 * * 0"},
+			now:               str2Time("2000-01-01T01:00:00+00:00"),
+			expectNextRefresh: str2Time("2000-01-01T06:00:00+00:00"),
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			rotator := &SecretRotator{
+				Client: newStatusClient(),
+			}
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  tc.secret,
+				Refresh: tc.refresh,
+			}
+
+			next, err := rotator.NextRefresh(spec, tc.now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !next.Equal(tc.expectNextRefresh) {
+				t.Errorf("Expected next refresh at %s, but got %s.", tc.expectNextRefresh, next)
+			}
+		})
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	rotator := &SecretRotator{
+		Client: newStatusClient(),
+		Agent:  &config.Agent{},
+	}
+	rotator.Agent.Set(&config.RotatedSecretConfig{
+		Specs: []config.RotatedSecretSpec{
+			{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Refresh: config.RefreshStrategy{
+					// far enough in the future not to be due now
+					Interval: 1000000 * time.Hour,
+				},
+			},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	rotator.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for POST, but got %d.", http.StatusMethodNotAllowed, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	rotator.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, but got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	statuses := []RefreshStatus{}
+	err := json.Unmarshal(rec.Body.Bytes(), &statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := str2Time("2000-01-01T00:00:00+00:00").Add(1000000 * time.Hour)
+	if len(statuses) != 1 || !statuses[0].NextRefresh.Equal(expected) || statuses[0].Error != "" {
+		t.Errorf("Expected next refresh at %s, but got %+v.", expected, statuses)
+	}
+	if gauge := testutil.ToFloat64(nextRefresh.WithLabelValues("project-1", "secret-1")); gauge != float64(expected.Unix()) {
+		t.Errorf("Expected next refresh metric %v, but got %v.", float64(expected.Unix()), gauge)
+	}
+}
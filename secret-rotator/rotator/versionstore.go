@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// VersionStore persists the (version: id) pairs of the versions provisioned by the rotator,
+// i.e. the bookkeeping that Refresh() writes and Deactivate() reads.
+type VersionStore interface {
+	// Versions returns the (version: id) pairs of rotatedSecret.
+	Versions(rotatedSecret config.RotatedSecretSpec) (map[string]string, error)
+	// Add records id as the provisioned secret of version.
+	Add(rotatedSecret config.RotatedSecretSpec, version, id string) error
+	// Remove forgets version, e.g. once it is deactivated.
+	Remove(rotatedSecret config.RotatedSecretSpec, version string) error
+}
+
+// newVersionStore returns the VersionStore selected by rotatedSecret.VersionStore.
+func newVersionStore(cl client.Interface, rotatedSecret config.RotatedSecretSpec) VersionStore {
+	if rotatedSecret.VersionStore == config.VersionStoreSecret {
+		return &secretVersionStore{Client: cl}
+	}
+	return &labelVersionStore{Client: cl}
+}
+
+// labelVersionStore keeps the (version: id) pairs in the "v<version>" labels of the secret.
+type labelVersionStore struct {
+	Client client.Interface
+}
+
+func (s *labelVersionStore) Versions(rotatedSecret config.RotatedSecretSpec) (map[string]string, error) {
+	labels, err := s.Client.GetSecretLabels(rotatedSecret.Project, rotatedSecret.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[string]string{}
+	for key, val := range labels {
+		if _, ok := config.ParseVersionLabel(key); ok {
+			versions[key[1:]] = val
+		}
+	}
+	return versions, nil
+}
+
+func (s *labelVersionStore) Add(rotatedSecret config.RotatedSecretSpec, version, id string) error {
+	// the reason for the prefix "v" is that Secret Manager labels need to begin with a lowwer case letter
+	return s.Client.UpsertSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, config.VersionLabel(version), id)
+}
+
+func (s *labelVersionStore) Remove(rotatedSecret config.RotatedSecretSpec, version string) error {
+	err := s.Client.DeleteSecretLabel(rotatedSecret.Project, rotatedSecret.Secret, config.VersionLabel(version))
+	if err != nil {
+		return fmt.Errorf("Fail to delete label %s of %s: %s", config.VersionLabel(version), rotatedSecret, err)
+	}
+	return nil
+}
+
+// secretVersionStore keeps the (version: id) pairs as a JSON map in the latest version
+// of the companion secret rotatedSecret.VersionStoreSecret(), created on the first write.
+// Each write adds a version and destroys the previous one, so that a single version stays active.
+type secretVersionStore struct {
+	Client client.Interface
+}
+
+func (s *secretVersionStore) Versions(rotatedSecret config.RotatedSecretSpec) (map[string]string, error) {
+	companion := rotatedSecret.VersionStoreSecret()
+	data, err := s.Client.GetSecretVersionData(rotatedSecret.Project, companion, "latest")
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("Fail to read version store %s of %s: %s", companion, rotatedSecret, err)
+	}
+
+	versions := map[string]string{}
+	err = json.Unmarshal(data, &versions)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid version store %s of %s: %s", companion, rotatedSecret, err)
+	}
+	return versions, nil
+}
+
+func (s *secretVersionStore) Add(rotatedSecret config.RotatedSecretSpec, version, id string) error {
+	versions, err := s.Versions(rotatedSecret)
+	if err != nil {
+		return err
+	}
+
+	versions[version] = id
+	return s.write(rotatedSecret, versions)
+}
+
+func (s *secretVersionStore) Remove(rotatedSecret config.RotatedSecretSpec, version string) error {
+	versions, err := s.Versions(rotatedSecret)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := versions[version]; !ok {
+		return nil
+	}
+
+	delete(versions, version)
+	return s.write(rotatedSecret, versions)
+}
+
+// write adds versions as the latest version of the companion secret, and destroys the previous one.
+func (s *secretVersionStore) write(rotatedSecret config.RotatedSecretSpec, versions map[string]string) error {
+	companion := rotatedSecret.VersionStoreSecret()
+
+	err := s.Client.ValidateSecret(rotatedSecret.Project, companion)
+	if status.Code(err) == codes.NotFound {
+		err = s.Client.CreateSecret(rotatedSecret.Project, companion, rotatedSecret.Replication.Locations)
+	}
+	if err != nil {
+		return fmt.Errorf("Fail to create version store %s of %s: %s", companion, rotatedSecret, err)
+	}
+
+	previous, err := s.Client.GetLatestVersion(rotatedSecret.Project, companion)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return fmt.Errorf("Fail to get latest version of version store %s of %s: %s", companion, rotatedSecret, err)
+		}
+		previous = ""
+	}
+
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.UpsertSecret(rotatedSecret.Project, companion, data)
+	if err != nil {
+		return fmt.Errorf("Fail to write version store %s of %s: %s", companion, rotatedSecret, err)
+	}
+
+	if previous != "" {
+		err = s.Client.DestroySecretVersion(rotatedSecret.Project, companion, previous)
+		if err != nil {
+			return fmt.Errorf("Fail to destroy previous version %s of version store %s of %s: %s", previous, companion, rotatedSecret, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rotator
+
+import (
+	"encoding/json"
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/svckey"
+	"sigs.k8s.io/k8s-gsm-tools/secret-rotator/tests"
+	"testing"
+	"time"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// deactivationRecorder wraps tests.MockSvcProvisioner, recording the provisioned ids it is asked to deactivate,
+// as resolved from the "v<version>" labels passed by the rotator.
+type deactivationRecorder struct {
+	recordingProvisioner
+	deactivated []string
+}
+
+func (p *deactivationRecorder) Deactivate(labels map[string]string, version string) error {
+	p.deactivated = append(p.deactivated, labels[config.VersionLabel(version)])
+	return p.MockSvcProvisioner.Deactivate(labels, version)
+}
+
+func TestVersionStores(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		versionStore string
+	}{
+		{
+			name:         "Default label store.",
+			versionStore: "",
+		},
+		{
+			name:         "Label store.",
+			versionStore: config.VersionStoreLabels,
+		},
+		{
+			name:         "Companion secret store.",
+			versionStore: config.VersionStoreSecret,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &tests.MockClient{
+				Secrets: map[string]map[string]*tests.Secret{
+					"project-1": map[string]*tests.Secret{},
+				},
+			}
+			provisioner := &deactivationRecorder{}
+			rotator := &SecretRotator{
+				Client: cl,
+				Provisioners: map[string]SecretProvisioner{
+					svckey.ServiceAccountKeySpec{}.Type(): provisioner,
+				},
+			}
+			spec := config.RotatedSecretSpec{
+				Project: "project-1",
+				Secret:  "secret-1",
+				Type: config.RotatedSecretType{
+					ServiceAccountKey: &svckey.ServiceAccountKeySpec{
+						Project:        "project-1",
+						ServiceAccount: "service-foo",
+					},
+				},
+				Refresh:      config.RefreshStrategy{Interval: time.Hour},
+				GracePeriod:  time.Hour,
+				VersionStore: tc.versionStore,
+			}
+			// the mocked versions are created at the zero time, so every rotation is out of interval and grace period
+			now := str2Time("2000-01-01T00:00:00+00:00")
+
+			// the first rotation provisions version 1
+			_, err := rotator.RotateOne(spec, nil, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id1 := provisioner.id
+
+			// the second rotation provisions version 2 and deactivates version 1
+			_, err = rotator.RotateOne(spec, nil, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id2 := provisioner.id
+
+			if !reflect.DeepEqual(provisioner.deactivated, []string{id1}) {
+				t.Errorf("Expected deactivation of %v, got %v.", []string{id1}, provisioner.deactivated)
+			}
+
+			state, err := cl.GetSecretVersionState("project-1", "secret-1", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != secretmanagerpb.SecretVersion_DESTROYED {
+				t.Errorf("Expected version 1 to be destroyed, got %s.", state)
+			}
+
+			versions, err := newVersionStore(cl, spec).Versions(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := map[string]string{"2": id2}; !reflect.DeepEqual(versions, expected) {
+				t.Errorf("Expected version store %v, got %v.", expected, versions)
+			}
+
+			labels, err := cl.GetSecretLabels("project-1", "secret-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			companion := cl.Secrets["project-1"][spec.VersionStoreSecret()]
+
+			if tc.versionStore == config.VersionStoreSecret {
+				if _, ok := labels[config.VersionLabel("2")]; ok {
+					t.Errorf("Expected no version labels with the companion secret store, got %v.", labels)
+				}
+				if companion == nil {
+					t.Fatalf("Expected companion secret %s.", spec.VersionStoreSecret())
+				}
+
+				enabled, err := cl.ListEnabledVersions("project-1", spec.VersionStoreSecret())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(enabled) != 1 {
+					t.Errorf("Expected a single enabled version of the companion secret, got %v.", enabled)
+				}
+
+				data, err := cl.GetSecretVersionData("project-1", spec.VersionStoreSecret(), "latest")
+				if err != nil {
+					t.Fatal(err)
+				}
+				stored := map[string]string{}
+				err = json.Unmarshal(data, &stored)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(stored, versions) {
+					t.Errorf("Expected companion secret data %v, got %v.", versions, stored)
+				}
+			} else {
+				if labels[config.VersionLabel("2")] != id2 {
+					t.Errorf("Expected label %s=%s, got %v.", config.VersionLabel("2"), id2, labels)
+				}
+				if _, ok := labels[config.VersionLabel("1")]; ok {
+					t.Errorf("Expected label %s to be deleted, got %v.", config.VersionLabel("1"), labels)
+				}
+				if companion != nil {
+					t.Errorf("Expected no companion secret with the label store.")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package svckey
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// keyCount is updated by CreateNew() before provisioning each new key.
+var keyCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "rotator_sa_key_count",
+	Help: "Number of user-managed keys of a rotated service account, out of the IAM limit of 10 keys per service account.",
+}, []string{"project", "service_account"})
+
+func init() {
+	prometheus.MustRegister(keyCount)
+}
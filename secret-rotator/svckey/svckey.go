@@ -18,12 +18,29 @@ package svckey
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
 	"k8s.io/klog"
+	"net/http"
 	"strings"
 )
 
+const (
+	// ProjectLabel is the Secret Manager label key holding the project of the service account.
+	// Prefixed with "rotator-" to avoid clobbering business labels of the user's secret.
+	ProjectLabel = "rotator-project"
+	// ServiceAccountLabel is the Secret Manager label key holding the name of the service account.
+	ServiceAccountLabel = "rotator-service-account"
+	// MaxKeysPerServiceAccount is the IAM limit of user-managed keys per service account.
+	MaxKeysPerServiceAccount = 10
+	// KeyCountWarning is the number of user-managed keys from which a warning is logged before provisioning a new key,
+	// as the rotation fails once the service account reaches MaxKeysPerServiceAccount.
+	KeyCountWarning = MaxKeysPerServiceAccount - 2
+)
+
 type ServiceAccountKeySpec struct {
 	Project        string `yaml:"project"`
 	ServiceAccount string `yaml:"serviceAccount"`
@@ -41,8 +58,8 @@ func (svc ServiceAccountKeySpec) Type() string {
 // Labels is used to obtain the labels needed for the provisioner of the ServiceAccountKey
 func (svc ServiceAccountKeySpec) Labels() map[string]string {
 	return map[string]string{
-		"project":         svc.Project,
-		"service-account": svc.ServiceAccount,
+		ProjectLabel:        svc.Project,
+		ServiceAccountLabel: svc.ServiceAccount,
 	}
 }
 
@@ -65,6 +82,9 @@ type Provisioner struct {
 	// when Deactivate('labels', 'version') is called.
 	enableDeletion bool
 	Service        *iam.Service
+	// listKeys lists the user-managed keys of the service account name, replaced in tests.
+	// Defaults to listing them with Service.
+	listKeys func(name string) ([]*iam.ServiceAccountKey, error)
 }
 
 // NewProvisioner creates a new svc-key provisioner with a new iam service.
@@ -84,11 +104,54 @@ func NewProvisioner(enableDeletion bool) (*Provisioner, error) {
 	}, nil
 }
 
+// serviceAccountName resolves the full resource name of the service account from the provisioner labels,
+// returns error if any of the required labels is missing.
+func serviceAccountName(labels map[string]string) (string, error) {
+	project, ok := labels[ProjectLabel]
+	if !ok || project == "" {
+		return "", fmt.Errorf("Missing label <%s>", ProjectLabel)
+	}
+
+	serviceAccount, ok := labels[ServiceAccountLabel]
+	if !ok || serviceAccount == "" {
+		return "", fmt.Errorf("Missing label <%s>", ServiceAccountLabel)
+	}
+
+	return fmt.Sprintf("projects/%s/serviceAccounts/%s@%s.iam.gserviceaccount.com", project, serviceAccount, project), nil
+}
+
+// keyName resolves the full resource name of the service account key of 'version' from the provisioner labels,
+// returns error if any of the required labels is missing.
+func keyName(labels map[string]string, version string) (string, error) {
+	name, err := serviceAccountName(labels)
+	if err != nil {
+		return "", err
+	}
+
+	// keys in format of "v%d" indicate that they are (version: id) pairs attached by the rotator
+	// the reason for the prefix "v" is that Secret Manager labels need to begin with a lowwer case letter
+	key, ok := labels["v"+version]
+	if !ok || key == "" {
+		return "", fmt.Errorf("Missing label <v%s>", version)
+	}
+
+	return fmt.Sprintf("%s/keys/%s", name, key), nil
+}
+
 // CreateNew provisions a new service account key,
 // returns the key-id and private-key data of the created key if successful,
 // otherwise returns error
 func (p *Provisioner) CreateNew(labels map[string]string) (string, []byte, error) {
-	name := fmt.Sprintf("projects/%s/serviceAccounts/%s@%s.iam.gserviceaccount.com", labels["project"], labels["service-account"], labels["project"])
+	name, err := serviceAccountName(labels)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = p.checkKeyCount(labels, name)
+	if err != nil {
+		// the creation itself tells whether the limit is reached
+		klog.Errorf("Fail to count the keys of %s: %s", name, err)
+	}
+
 	request := &iam.CreateServiceAccountKeyRequest{}
 
 	resp, err := p.Service.Projects.ServiceAccounts.Keys.Create(name, request).Context(context.TODO()).Do()
@@ -106,16 +169,86 @@ func (p *Provisioner) CreateNew(labels map[string]string) (string, []byte, error
 	return key, decodedPrivateKeyData, nil
 }
 
+// checkKeyCount counts the user-managed keys of the service account name, and exports the count with the rotator_sa_key_count gauge.
+// Logs a warning if the count reaches KeyCountWarning, and an error once no new key can be created.
+func (p *Provisioner) checkKeyCount(labels map[string]string, name string) (int, error) {
+	keys, err := p.userManagedKeys(name)
+	if err != nil {
+		return 0, err
+	}
+
+	count := len(keys)
+	keyCount.WithLabelValues(labels[ProjectLabel], labels[ServiceAccountLabel]).Set(float64(count))
+	switch {
+	case count >= MaxKeysPerServiceAccount:
+		klog.Errorf("Service account %s has %d user-managed keys, reaching the IAM limit of %d. No new key can be created until old keys are deleted.", name, count, MaxKeysPerServiceAccount)
+	case count >= KeyCountWarning:
+		klog.Warningf("Service account %s has %d user-managed keys, approaching the IAM limit of %d.", name, count, MaxKeysPerServiceAccount)
+	}
+	return count, nil
+}
+
+// userManagedKeys lists the user-managed keys of the service account name, with p.listKeys if set.
+func (p *Provisioner) userManagedKeys(name string) ([]*iam.ServiceAccountKey, error) {
+	if p.listKeys != nil {
+		return p.listKeys(name)
+	}
+
+	resp, err := p.Service.Projects.ServiceAccounts.Keys.List(name).KeyTypes("USER_MANAGED").Context(context.TODO()).Do()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Adopt returns the key-id of the existing service account key 'data', e.g. a key created manually before onboarding,
+// once the key is found among the user-managed keys of the service account specified by labels.
+// Returns error if data is not a service account key, or a key of another service account.
+func (p *Provisioner) Adopt(labels map[string]string, data []byte) (string, error) {
+	name, err := serviceAccountName(labels)
+	if err != nil {
+		return "", err
+	}
+
+	var key struct {
+		PrivateKeyID string `json:"private_key_id"`
+	}
+	// the error of Unmarshal may quote the private key
+	if json.Unmarshal(data, &key) != nil || key.PrivateKeyID == "" {
+		return "", fmt.Errorf("Secret is not a service account key in JSON format")
+	}
+
+	keys, err := p.userManagedKeys(name)
+	if err != nil {
+		return "", fmt.Errorf("Fail to list the keys of %s: %s", name, err)
+	}
+
+	for _, k := range keys {
+		if k.Name == name+"/keys/"+key.PrivateKeyID {
+			klog.V(2).Infof("Adopted the existing service account key %s", k.Name)
+			return key.PrivateKeyID, nil
+		}
+	}
+
+	return "", fmt.Errorf("Key %s not found among the user-managed keys of %s", key.PrivateKeyID, name)
+}
+
 // Deactivate deletes an existing service account key specified by labels and version,
 // returns nil if successful, otherwise error
 func (p *Provisioner) Deactivate(labels map[string]string, version string) error {
-	// keys in format of "v%d" indicate that they are (version: id) pairs attached by the rotator
-	// the reason for the prefix "v" is that Secret Manager labels need to begin with a lowwer case letter
-	name := fmt.Sprintf("projects/%s/serviceAccounts/%s@%s.iam.gserviceaccount.com/keys/%s", labels["project"], labels["service-account"], labels["project"], labels["v"+version])
+	name, err := keyName(labels, version)
+	if err != nil {
+		return err
+	}
 
 	if p.enableDeletion {
-		_, err := p.Service.Projects.ServiceAccounts.Keys.Delete(name).Do()
+		_, err = p.Service.Projects.ServiceAccounts.Keys.Delete(name).Do()
 		if err != nil {
+			// the key is already deleted, e.g. when re-running an interrupted deactivation
+			if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+				klog.V(2).Infof("Service account key %s already deleted", name)
+				return nil
+			}
 			return fmt.Errorf("Projects.ServiceAccounts.Keys.Delete: %v", err)
 		}
 
@@ -126,3 +259,53 @@ func (p *Provisioner) Deactivate(labels map[string]string, version string) error
 
 	return nil
 }
+
+// Discard deletes the service account key of key-id 'id' specified by labels, e.g. a key failing verification.
+// The key was never published, thus it is deleted even if flag --enable-deletion is not set.
+// Returns nil if the key is already deleted.
+func (p *Provisioner) Discard(labels map[string]string, id string) error {
+	name, err := serviceAccountName(labels)
+	if err != nil {
+		return err
+	}
+
+	name = fmt.Sprintf("%s/keys/%s", name, id)
+	_, err = p.Service.Projects.ServiceAccounts.Keys.Delete(name).Do()
+	if err != nil {
+		if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("Projects.ServiceAccounts.Keys.Delete: %v", err)
+	}
+
+	klog.V(2).Infof("Discarded unpublished key: %s", name)
+	return nil
+}
+
+// PostDeactivate does nothing, service account keys need no cleanup once their Secret Manager version is destroyed.
+func (p *Provisioner) PostDeactivate(labels map[string]string, version string) error {
+	return nil
+}
+
+// Verify performs a trivial authenticated call with the service account key 'data' of key-id 'id',
+// returns nil if the key is accepted by GCP, otherwise error.
+// A permission denied response still proves that the key authenticates, thus considered as usable.
+func (p *Provisioner) Verify(labels map[string]string, id string, data []byte) error {
+	name, err := serviceAccountName(labels)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	service, err := iam.NewService(ctx, option.WithCredentialsJSON(data))
+	if err != nil {
+		return err
+	}
+
+	_, err = service.Projects.ServiceAccounts.Keys.Get(fmt.Sprintf("%s/keys/%s", name, id)).Context(ctx).Do()
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusForbidden {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package svckey
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/api/iam/v1"
+	"testing"
+)
+
+func TestServiceAccountName(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		labels    map[string]string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "Labels from spec. Should resolve the service account.",
+			labels: ServiceAccountKeySpec{
+				Project:        "project-1",
+				ServiceAccount: "service-foo",
+			}.Labels(),
+			expected:  "projects/project-1/serviceAccounts/service-foo@project-1.iam.gserviceaccount.com",
+			expectErr: false,
+		},
+		{
+			name: "User-defined business labels. Should not interfere with the namespaced keys.",
+			labels: map[string]string{
+				"project":           "business-project",
+				"service-account":   "business-account",
+				ProjectLabel:        "project-1",
+				ServiceAccountLabel: "service-foo",
+			},
+			expected:  "projects/project-1/serviceAccounts/service-foo@project-1.iam.gserviceaccount.com",
+			expectErr: false,
+		},
+		{
+			name: "Only un-namespaced labels. Should return error.",
+			labels: map[string]string{
+				"project":         "project-1",
+				"service-account": "service-foo",
+			},
+			expectErr: true,
+		},
+		{
+			name: "Missing service account label. Should return error.",
+			labels: map[string]string{
+				ProjectLabel: "project-1",
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			name, err := serviceAccountName(tc.labels)
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if name != tc.expected {
+				t.Errorf("Expected %s, but got %s.", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		labels    map[string]string
+		version   string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "Existing version label. Should resolve the key.",
+			labels: map[string]string{
+				ProjectLabel:        "project-1",
+				ServiceAccountLabel: "service-foo",
+				"v1":                "key-1",
+			},
+			version:   "1",
+			expected:  "projects/project-1/serviceAccounts/service-foo@project-1.iam.gserviceaccount.com/keys/key-1",
+			expectErr: false,
+		},
+		{
+			name: "Missing version label. Should return error.",
+			labels: map[string]string{
+				ProjectLabel:        "project-1",
+				ServiceAccountLabel: "service-foo",
+				"v1":                "key-1",
+			},
+			version:   "2",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			name, err := keyName(tc.labels, tc.version)
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if name != tc.expected {
+				t.Errorf("Expected %s, but got %s.", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestCheckKeyCount(t *testing.T) {
+	labels := ServiceAccountKeySpec{
+		Project:        "project-1",
+		ServiceAccount: "service-foo",
+	}.Labels()
+	name, err := serviceAccountName(labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testcases = []struct {
+		name      string
+		keys      int
+		listErr   error
+		expectErr bool
+	}{
+		{
+			name: "Few keys.",
+			keys: 2,
+		},
+		{
+			name: "Keys approaching the limit.",
+			keys: KeyCountWarning,
+		},
+		{
+			name: "Keys reaching the limit.",
+			keys: MaxKeysPerServiceAccount,
+		},
+		{
+			name:      "Failing key listing. Should keep the last count.",
+			keys:      MaxKeysPerServiceAccount,
+			listErr:   fmt.Errorf("permission denied"),
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			gauge := keyCount.WithLabelValues("project-1", "service-foo")
+			gauge.Set(-1)
+
+			p := &Provisioner{
+				listKeys: func(listed string) ([]*iam.ServiceAccountKey, error) {
+					if listed != name {
+						t.Errorf("Expected keys of %s to be listed, got %s.", name, listed)
+					}
+					if tc.listErr != nil {
+						return nil, tc.listErr
+					}
+					return make([]*iam.ServiceAccountKey, tc.keys), nil
+				},
+			}
+
+			count, err := p.checkKeyCount(labels, name)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				}
+				if value := testutil.ToFloat64(gauge); value != -1 {
+					t.Errorf("Expected the gauge to be left unchanged, got %v.", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tc.keys {
+				t.Errorf("Expected %d keys, got %d.", tc.keys, count)
+			}
+			if value := testutil.ToFloat64(gauge); value != float64(tc.keys) {
+				t.Errorf("Expected gauge %d, got %v.", tc.keys, value)
+			}
+		})
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	labels := ServiceAccountKeySpec{
+		Project:        "project-1",
+		ServiceAccount: "service-foo",
+	}.Labels()
+	name, err := serviceAccountName(labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testcases = []struct {
+		name      string
+		data      string
+		keys      []string
+		listErr   error
+		expectID  string
+		expectErr bool
+	}{
+		{
+			name:     "Key of the service account. Should return its key-id.",
+			data:     `{"type": "service_account", "private_key_id": "key_id-2", "private_key": "secret"}`,
+			keys:     []string{"key_id-1", "key_id-2"},
+			expectID: "key_id-2",
+		},
+		{
+			name:      "Key of another service account. Should return error.",
+			data:      `{"type": "service_account", "private_key_id": "key_id-3", "private_key": "secret"}`,
+			keys:      []string{"key_id-1", "key_id-2"},
+			expectErr: true,
+		},
+		{
+			name:      "Key without key-id. Should return error.",
+			data:      `{"type": "service_account", "private_key": "secret"}`,
+			keys:      []string{"key_id-1"},
+			expectErr: true,
+		},
+		{
+			name:      "Secret not in JSON format. Should return error.",
+			data:      "secret",
+			keys:      []string{"key_id-1"},
+			expectErr: true,
+		},
+		{
+			name:      "Failing key listing. Should return error.",
+			data:      `{"type": "service_account", "private_key_id": "key_id-1", "private_key": "secret"}`,
+			listErr:   fmt.Errorf("permission denied"),
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			p := &Provisioner{
+				listKeys: func(listed string) ([]*iam.ServiceAccountKey, error) {
+					if tc.listErr != nil {
+						return nil, tc.listErr
+					}
+					keys := []*iam.ServiceAccountKey{}
+					for _, key := range tc.keys {
+						keys = append(keys, &iam.ServiceAccountKey{Name: listed + "/keys/" + key})
+					}
+					return keys, nil
+				},
+			}
+
+			id, err := p.Adopt(labels, []byte(tc.data))
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got key-id %s.", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tc.expectID {
+				t.Errorf("Expected key-id %s of %s, got %s.", tc.expectID, name, id)
+			}
+		})
+	}
+}
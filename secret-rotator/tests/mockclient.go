@@ -37,9 +37,11 @@ type MockClient struct {
 // Secret mocks a Secret Manager secret, which contains metadata and a list of versions
 // Secret.Versions is a map from <version> to a secret Version object
 // Secret.Labels stores the secret metadata
+// Secret.Locations stores the replica locations of a user-managed replication, nil for an automatic replication
 type Secret struct {
-	Versions map[string]*Version
-	Labels   map[string]string
+	Versions  map[string]*Version
+	Labels    map[string]string
+	Locations []string
 }
 
 // Version mocks a Secret Manager secret version, which contains version CreateTime, secret Data and version State
@@ -92,6 +94,9 @@ func (cl *MockClient) ValidateSecretVersion(project, id, version string) error {
 // returns the numeric version string if the secret version exists, otherwise error.
 func (cl *MockClient) ValidateAndConvertVersion(project, id, version string) (string, error) {
 	err := cl.ValidateSecretVersion(project, id, version)
+	if err != nil {
+		return version, err
+	}
 
 	if version == "latest" {
 		version = strconv.Itoa(len(cl.Secrets[project][id].Versions))
@@ -100,19 +105,41 @@ func (cl *MockClient) ValidateAndConvertVersion(project, id, version string) (st
 	return version, err
 }
 
-// CreateSecret creates an empty secret specified by project, id.
+// CreateSecret creates an empty secret specified by project, id, replicated to locations.
 // It returns nil if successful, otherwise error.
-func (cl *MockClient) CreateSecret(project, id string) error {
+func (cl *MockClient) CreateSecret(project, id string, locations []string) error {
 	err := cl.ValidateProject(project)
 	if err != nil {
 		return err
 	}
 
-	cl.Secrets[project][id] = new(Secret)
+	cl.Secrets[project][id] = newSecret()
+	if len(locations) != 0 {
+		cl.Secrets[project][id].Locations = locations
+	}
 
 	return nil
 }
 
+// GetSecretReplication gets the replica locations of the secret specified by project, id.
+// Returns nil for an automatic replication, or error if the secret doesn't exist.
+func (cl *MockClient) GetSecretReplication(project, id string) ([]string, error) {
+	err := cl.ValidateSecret(project, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return cl.Secrets[project][id].Locations, nil
+}
+
+// newSecret returns an empty Secret with initialized maps.
+func newSecret() *Secret {
+	return &Secret{
+		Versions: make(map[string]*Version),
+		Labels:   make(map[string]string),
+	}
+}
+
 // UpsertSecret adds a new version to the secret specified by project, id.
 // It inserts a new secret if id doesn't already exist.
 // If successful the latest version will have 'data' as its secret value,
@@ -125,7 +152,7 @@ func (cl *MockClient) UpsertSecret(project, id string, data []byte) (string, err
 
 	err = cl.ValidateSecret(project, id)
 	if err != nil {
-		cl.Secrets[project][id] = new(Secret)
+		cl.Secrets[project][id] = newSecret()
 	}
 
 	version := strconv.Itoa(len(cl.Secrets[project][id].Versions) + 1)
@@ -150,6 +177,46 @@ func (cl *MockClient) GetCreateTime(project, id, version string) (time.Time, err
 	return creatTime, nil
 }
 
+// GetLatestVersion gets the number of the latest version of the secret specified by project, id.
+// Returns the version if successful, otherwise error.
+func (cl *MockClient) GetLatestVersion(project, id string) (string, error) {
+	return cl.ValidateAndConvertVersion(project, id, "latest")
+}
+
+// ListEnabledVersions lists the versions of the secret specified by project, id, that are in the ENABLED state.
+// Returns the versions if successful, otherwise error.
+func (cl *MockClient) ListEnabledVersions(project, id string) ([]string, error) {
+	err := cl.ValidateSecret(project, id)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for version, v := range cl.Secrets[project][id].Versions {
+		if v.State == secretmanagerpb.SecretVersion_ENABLED {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, nil
+}
+
+// ListSecretVersions lists the versions of the secret specified by project, id, in any state.
+// Returns the (version: state) pairs if successful, otherwise error.
+func (cl *MockClient) ListSecretVersions(project, id string) (map[string]secretmanagerpb.SecretVersion_State, error) {
+	err := cl.ValidateSecret(project, id)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[string]secretmanagerpb.SecretVersion_State{}
+	for version, v := range cl.Secrets[project][id].Versions {
+		versions[version] = v.State
+	}
+
+	return versions, nil
+}
+
 // GetSecretLabels gets the labels of the secret specified by project, id.
 // Returns secret labels if successful, otherwise error
 func (cl *MockClient) GetSecretLabels(project, id string) (map[string]string, error) {
@@ -17,12 +17,26 @@ package tests
 // Should be used with caution. Only for testing purpose.
 
 import (
+	"fmt"
 	"math/rand"
 )
 
 type MockSvcProvisioner struct {
 	NewSecretID    string
 	NewSecretValue []byte
+	// VerifyFailures is the number of Verify calls that fail before the provisioned secret becomes usable.
+	// A negative value means that the secret never becomes usable.
+	VerifyFailures int
+	// VerifyCalls counts the calls to Verify.
+	VerifyCalls int
+	// PostDeactivated records the versions passed to PostDeactivate, in call order.
+	PostDeactivated []string
+	// PostDeactivatedLabels records the labels passed to the last PostDeactivate call.
+	PostDeactivatedLabels map[string]string
+	// AdoptedIDs maps the secrets adoptable by Adopt to their ids.
+	AdoptedIDs map[string]string
+	// Discarded records the ids passed to Discard, in call order.
+	Discarded []string
 }
 
 var alphaNum = []rune("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ=")
@@ -55,3 +69,36 @@ func (p *MockSvcProvisioner) CreateNew(labels map[string]string) (string, []byte
 func (p *MockSvcProvisioner) Deactivate(labels map[string]string, version string) error {
 	return nil
 }
+
+// PostDeactivate records version and labels in p.PostDeactivated and p.PostDeactivatedLabels,
+// returns nil.
+func (p *MockSvcProvisioner) PostDeactivate(labels map[string]string, version string) error {
+	p.PostDeactivated = append(p.PostDeactivated, version)
+	p.PostDeactivatedLabels = labels
+	return nil
+}
+
+// Adopt mocks the lookup of an existing secret, returns the id of data in p.AdoptedIDs if any, otherwise error.
+func (p *MockSvcProvisioner) Adopt(labels map[string]string, data []byte) (string, error) {
+	id, ok := p.AdoptedIDs[string(data)]
+	if !ok {
+		return "", fmt.Errorf("secret of %d bytes not found", len(data))
+	}
+	return id, nil
+}
+
+// Verify mocks the verification of a newly provisioned secret,
+// returns error for the first p.VerifyFailures calls, otherwise nil.
+func (p *MockSvcProvisioner) Verify(labels map[string]string, id string, data []byte) error {
+	p.VerifyCalls++
+	if p.VerifyFailures < 0 || p.VerifyCalls <= p.VerifyFailures {
+		return fmt.Errorf("key %s is not usable yet", id)
+	}
+	return nil
+}
+
+// Discard records id in p.Discarded, returns nil.
+func (p *MockSvcProvisioner) Discard(labels map[string]string, id string) error {
+	p.Discarded = append(p.Discarded, id)
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+// package client implements testing clients, mocked clients, and fixtures utilities.
+// Should be used with caution. Only for testing purpose.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// VersionSnapshot records the State and CreateTime of a single secret version.
+type VersionSnapshot struct {
+	State      secretmanagerpb.SecretVersion_State
+	CreateTime time.Time
+}
+
+// Snapshot is a map from <version> to the VersionSnapshot of a secret,
+// used to assert the version states of a secret across a rotation sequence.
+type Snapshot map[string]VersionSnapshot
+
+// TakeSnapshot captures the state and createTime of all versions of the secret specified by project, id.
+// Returns the Snapshot if successful, otherwise error.
+func TakeSnapshot(cl *MockClient, project, id string) (Snapshot, error) {
+	err := cl.ValidateSecret(project, id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{}
+	for version, ver := range cl.Secrets[project][id].Versions {
+		snapshot[version] = VersionSnapshot{
+			State:      ver.State,
+			CreateTime: ver.CreateTime,
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Match compares the snapshot against the expected one.
+// Returns nil if both contain the same versions with the same states and createTimes,
+// otherwise returns an error listing every mismatched version.
+func (s Snapshot) Match(expected Snapshot) error {
+	versions := map[string]bool{}
+	for version := range s {
+		versions[version] = true
+	}
+	for version := range expected {
+		versions[version] = true
+	}
+
+	sorted := []string{}
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+	sort.Strings(sorted)
+
+	mismatches := []string{}
+	for _, version := range sorted {
+		got, gotOk := s[version]
+		want, wantOk := expected[version]
+		switch {
+		case !gotOk:
+			mismatches = append(mismatches, fmt.Sprintf("version %s: missing, expected %s", version, want))
+		case !wantOk:
+			mismatches = append(mismatches, fmt.Sprintf("version %s: unexpected %s", version, got))
+		case got.State != want.State || !got.CreateTime.Equal(want.CreateTime):
+			mismatches = append(mismatches, fmt.Sprintf("version %s: expected %s but got %s", version, want, got))
+		}
+	}
+
+	if len(mismatches) != 0 {
+		return fmt.Errorf("Snapshot mismatch: %s", strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
+
+func (v VersionSnapshot) String() string {
+	return fmt.Sprintf("{%s, created at %s}", v.State, v.CreateTime.Format(time.RFC3339))
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"testing"
+	"time"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+var str2Time = func(str string) time.Time {
+	t, _ := time.Parse(time.RFC3339, str)
+	return t
+}
+
+func newSnapshotClient() *MockClient {
+	return &MockClient{
+		Secrets: map[string]map[string]*Secret{
+			"project-1": map[string]*Secret{
+				"secret-1": &Secret{
+					Versions: map[string]*Version{
+						"1": &Version{
+							CreateTime: str2Time("2000-01-01T00:00:00+00:00"),
+							Data:       []byte("secret-data-1"),
+							State:      secretmanagerpb.SecretVersion_DESTROYED,
+						},
+						"2": &Version{
+							CreateTime: str2Time("2000-01-01T07:00:00+00:00"),
+							Data:       []byte("secret-data-2"),
+							State:      secretmanagerpb.SecretVersion_ENABLED,
+						},
+					},
+					Labels: map[string]string{},
+				},
+			},
+		},
+	}
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		project   string
+		secret    string
+		expected  Snapshot
+		expectErr bool
+	}{
+		{
+			name:    "Existing secret. Should capture all versions.",
+			project: "project-1",
+			secret:  "secret-1",
+			expected: Snapshot{
+				"1": {State: secretmanagerpb.SecretVersion_DESTROYED, CreateTime: str2Time("2000-01-01T00:00:00+00:00")},
+				"2": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T07:00:00+00:00")},
+			},
+			expectErr: false,
+		},
+		{
+			name:      "Non-existing secret. Should return error.",
+			project:   "project-1",
+			secret:    "missed",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			snapshot, err := TakeSnapshot(newSnapshotClient(), tc.project, tc.secret)
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			if tc.expectErr {
+				return
+			}
+
+			if err := snapshot.Match(tc.expected); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSnapshotMatch(t *testing.T) {
+	snapshot := Snapshot{
+		"1": {State: secretmanagerpb.SecretVersion_DESTROYED, CreateTime: str2Time("2000-01-01T00:00:00+00:00")},
+		"2": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T07:00:00+00:00")},
+	}
+
+	var testcases = []struct {
+		name      string
+		expected  Snapshot
+		expectErr bool
+	}{
+		{
+			name: "Identical snapshot. Should match.",
+			expected: Snapshot{
+				"1": {State: secretmanagerpb.SecretVersion_DESTROYED, CreateTime: str2Time("2000-01-01T00:00:00+00:00")},
+				"2": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T07:00:00+00:00")},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Different state. Should not match.",
+			expected: Snapshot{
+				"1": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T00:00:00+00:00")},
+				"2": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T07:00:00+00:00")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Different createTime. Should not match.",
+			expected: Snapshot{
+				"1": {State: secretmanagerpb.SecretVersion_DESTROYED, CreateTime: str2Time("2000-01-01T00:00:00+00:00")},
+				"2": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T08:00:00+00:00")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Missing version. Should not match.",
+			expected: Snapshot{
+				"1": {State: secretmanagerpb.SecretVersion_DESTROYED, CreateTime: str2Time("2000-01-01T00:00:00+00:00")},
+				"2": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T07:00:00+00:00")},
+				"3": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T14:00:00+00:00")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Unexpected version. Should not match.",
+			expected: Snapshot{
+				"2": {State: secretmanagerpb.SecretVersion_ENABLED, CreateTime: str2Time("2000-01-01T07:00:00+00:00")},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			err := snapshot.Match(tc.expected)
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -18,30 +18,111 @@ package client
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"google.golang.org/api/option"
 	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
 )
 
+const (
+	// ManagedByLabel is the label attached to the K8s secrets created by the secret sync controller.
+	// Only secrets carrying this label are considered managed, e.g. when decommissioning a config.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the default value of ManagedByLabel for the secret sync controller,
+	// overridden by Client.Manager, e.g. to tell apart the instances of a fleet.
+	ManagedByValue = "secret-sync-controller"
+	// SourceAnnotationPrefix is the prefix of the annotations recording the source of each synced key.
+	SourceAnnotationPrefix = "secret-sync/"
+	// LastWriterAnnotation records the instance of the secret sync controller that last wrote a secret.
+	LastWriterAnnotation = "secret-sync/last-writer"
+	// LastSyncTimeAnnotation records the RFC3339 time of the last sync of a secret.
+	LastSyncTimeAnnotation = "secret-sync/last-sync-time"
+	// LastResultAnnotation records the result of the last sync of a secret, either SyncSucceeded or SyncFailed.
+	LastResultAnnotation = "secret-sync/last-result"
+	// SourceVersionAnnotation records the source versions of the last successful sync of a secret,
+	// i.e. the version for a single source, or the comma-separated <key>=<version> pairs for mappings.
+	SourceVersionAnnotation = "secret-sync/source-version"
+
+	// MirroredLabelPrefix is the prefix of the labels mirrored from the Secret Manager sources of a secret.
+	MirroredLabelPrefix = "secret-sync/"
+
+	// SyncSucceeded and SyncFailed are the values of LastResultAnnotation.
+	SyncSucceeded = "Succeeded"
+	SyncFailed    = "Failed"
+)
+
+// SourceAnnotation returns the annotation key recording the source of the destination key.
+// It is SourceAnnotationPrefix + key + ".source" if that is a valid annotation key,
+// otherwise the key is replaced by its hash, e.g. for keys that are too long.
+func SourceAnnotation(key string) string {
+	return keyAnnotation(key, ".source")
+}
+
+// SyncStateAnnotation returns the annotation key recording the state of the last bidirectional sync of the destination key,
+// i.e. <version>:<checksum> of the Secret Manager version and of the value synced. Keys are hashed like in SourceAnnotation().
+func SyncStateAnnotation(key string) string {
+	return keyAnnotation(key, ".synced")
+}
+
+// keyAnnotation returns SourceAnnotationPrefix + key + suffix if that is a valid annotation key,
+// otherwise the key is replaced by its hash.
+func keyAnnotation(key, suffix string) string {
+	annotation := SourceAnnotationPrefix + key + suffix
+	if len(validation.IsQualifiedName(annotation)) == 0 {
+		return annotation
+	}
+	hash := sha256.Sum256([]byte(key))
+	return SourceAnnotationPrefix + "sha256-" + hex.EncodeToString(hash[:8]) + suffix
+}
+
 // NewK8sClientset creates a new K8s clientset
 // uses in-cluster configuration if possible, but falls back to out-of-cluster configuration otherwise.
 // It loads from kubeconfig, and looks for a config file under $HOME if kubeconfig is not specified.
 func NewK8sClientset(kubeconfig string) (*kubernetes.Interface, error) {
+	config, err := restConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var clientset kubernetes.Interface
+	clientset, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientset, nil
+}
+
+// restConfig creates the in-cluster config if possible, otherwise loads the config from kubeconfig.
+// The requests of its clients are counted in the secret_sync_api_calls_total metric.
+func restConfig(kubeconfig string) (*rest.Config, error) {
 	// tries to create the in-cluster config
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -56,21 +137,50 @@ func NewK8sClientset(kubeconfig string) (*kubernetes.Interface, error) {
 		}
 	}
 
-	var clientset kubernetes.Interface
-	clientset, err = kubernetes.NewForConfig(config)
+	config.Wrap(countKubernetesCalls)
+	return config, nil
+}
+
+// newSecretManagerClient creates the underlying Secret Manager clients, replaced in tests.
+// Their calls are counted in the secret_sync_api_calls_total metric.
+var newSecretManagerClient = func(ctx context.Context, opts ...option.ClientOption) (*secretmanager.Client, error) {
+	opts = append(opts, option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(countSecretManagerCalls)))
+	return secretmanager.NewClient(ctx, opts...)
+}
+
+// NewSecretManagerClient creates a new Secret Manager client with opts, using the default credentials if none is given.
+func NewSecretManagerClient(ctx context.Context, opts ...option.ClientOption) (*secretmanager.Client, error) {
+	client, err := newSecretManagerClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-
-	return &clientset, nil
+	return client, nil
 }
 
-func NewSecretManagerClient(ctx context.Context) (*secretmanager.Client, error) {
-	client, err := secretmanager.NewClient(ctx)
+// ReloadSecretManagerClient creates a new Secret Manager client with opts and swaps it in,
+// e.g. once the credentials file is updated with a rotated key. The calls in flight keep the previous client.
+// Returns the previous client, to be closed once the calls in flight are done.
+func (cl *Client) ReloadSecretManagerClient(ctx context.Context, opts ...option.ClientOption) (io.Closer, error) {
+	smClient, err := NewSecretManagerClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return client, nil
+
+	cl.gsmMutex.Lock()
+	defer cl.gsmMutex.Unlock()
+
+	previous := cl.SecretManagerClient
+	cl.SecretManagerClient = *smClient
+	return &previous, nil
+}
+
+// secretManagerClient returns the current Secret Manager client.
+func (cl *Client) secretManagerClient() *secretmanager.Client {
+	cl.gsmMutex.RLock()
+	defer cl.gsmMutex.RUnlock()
+
+	smClient := cl.SecretManagerClient
+	return &smClient
 }
 
 // structs for client interface
@@ -78,14 +188,56 @@ type Interface interface {
 	ValidateKubernetesNamespace(namespace string) error
 	ValidateKubernetesSecret(namespace, id string) error
 	CreateKubernetesNamespace(namespace string) error
+	ListKubernetesNamespaces() ([]string, error)
 	GetKubernetesSecretValue(namespace, id, key string) ([]byte, error)
+	GetKubernetesSecretKeys(namespace, id string) ([]string, error)
 	UpsertKubernetesSecret(namespace, id, key string, data []byte) error
+	UpsertKubernetesSecretStringData(namespace, id, key string, data []byte) error
+	UpsertKubernetesSecretValue(namespace, id, key string, data []byte, stringData bool, annotations map[string]string) error
+	GetKubernetesSecretLabels(namespace, id string) (map[string]string, error)
+	DeleteKubernetesSecret(namespace, id string) error
+	DeleteKubernetesSecretKey(namespace, id, key string) error
+	GetKubernetesSecretAnnotations(namespace, id string) (map[string]string, error)
+	GetKubernetesSecretType(namespace, id string) (string, error)
+	GetKubernetesSecretKeyUpdateTime(namespace, id, key string) (time.Time, error)
+	AnnotateKubernetesSecret(namespace, id string, annotations map[string]string) error
+	LabelKubernetesSecret(namespace, id string, labels map[string]string) error
+	SetKubernetesSecretOwner(namespace, id string, owner metav1.OwnerReference) error
+	RecreateKubernetesSecret(namespace, id string) error
+	GetKubernetesConfigMap(namespace, name string) (map[string]string, error)
+	UpsertKubernetesConfigMap(namespace, name string, data map[string]string) error
 	GetSecretManagerSecretValue(project, id string) ([]byte, error)
+	GetSecretManagerSecretVersion(project, id string) ([]byte, string, error)
+	GetSecretManagerSecretLabels(project, id string) (map[string]string, error)
+	GetSecretManagerSecretCreateTime(project, id, version string) (time.Time, error)
 	UpsertSecretManagerSecret(project, id string, data []byte) error
+	UpsertReplicatedSecretManagerSecret(project, id string, locations []string, data []byte) error
+	// ManagerName returns the value of ManagedByLabel stamped on, and expected of, the managed secrets.
+	ManagerName() string
 }
 type Client struct { // actual client
 	K8sClientset        kubernetes.Interface
 	SecretManagerClient secretmanager.Client
+	// gsmMutex guards SecretManagerClient, swapped by ReloadSecretManagerClient().
+	gsmMutex sync.RWMutex
+	// PreserveMetadata lists the label and annotation keys carried over by RecreateKubernetesSecret(),
+	// e.g. the ownership labels of GitOps tools. Other labels and annotations are reset.
+	PreserveMetadata []string
+	// Manager is the value of ManagedByLabel of the managed secrets and ConfigMaps. Defaults to ManagedByValue.
+	Manager string
+}
+
+// managerOrDefault returns manager, or ManagedByValue if manager is empty.
+func managerOrDefault(manager string) string {
+	if manager == "" {
+		return ManagedByValue
+	}
+	return manager
+}
+
+// ManagerName returns cl.Manager, ManagedByValue by default.
+func (cl *Client) ManagerName() string {
+	return managerOrDefault(cl.Manager)
 }
 
 // ValidateKubernetesNamespace returns nil if the namespace exists, otherwise error.
@@ -112,6 +264,22 @@ func (cl *Client) CreateKubernetesNamespace(namespace string) error {
 	return err
 }
 
+// ListKubernetesNamespaces returns the sorted names of all K8s namespaces.
+func (cl *Client) ListKubernetesNamespaces() ([]string, error) {
+	list, err := cl.K8sClientset.CoreV1().Namespaces().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := []string{}
+	for _, namespace := range list.Items {
+		namespaces = append(namespaces, namespace.Name)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
 // GetKubernetesSecretValue gets the value of key from the kubernetes secret specified by namespace, id.
 // Returns error if the namspace doesn't exist, otherwise nil if the secret or key don't exist.
 func (cl *Client) GetKubernetesSecretValue(namespace, id, key string) ([]byte, error) {
@@ -139,78 +307,406 @@ func (cl *Client) GetKubernetesSecretValue(namespace, id, key string) ([]byte, e
 	return value, nil
 }
 
+// GetKubernetesSecretKeys gets the data keys of the kubernetes secret specified by namespace, id.
+// Returns error if the secret doesn't exist.
+func (cl *Client) GetKubernetesSecretKeys(namespace, id string) ([]string, error) {
+	secret, err := cl.K8sClientset.CoreV1().Secrets(namespace).Get(id, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
 // UpsertKubernetesSecret updates the value of key of the kubernetes secret specified by namespace, id.
 // It inserts a new secret if id doesn't already exist.
 // It inserts a new key-value pair if key doesn't already exist.
+// The secret is labeled with ManagedByLabel, whether it is created or patched.
 // Returns nil if successful, error otherwise
 func (cl *Client) UpsertKubernetesSecret(namespace, id, key string, data []byte) error {
+	return cl.UpsertKubernetesSecretValue(namespace, id, key, data, false, nil)
+}
+
+// UpsertKubernetesSecretStringData updates the value of key of the kubernetes secret specified by namespace, id,
+// through the stringData field. The API server merges stringData into data, so the value reads back from data.
+// It inserts a new secret if id doesn't already exist.
+// It inserts a new key-value pair if key doesn't already exist.
+// The secret is labeled with ManagedByLabel, whether it is created or patched.
+// Returns nil if successful, error otherwise
+func (cl *Client) UpsertKubernetesSecretStringData(namespace, id, key string, data []byte) error {
+	return cl.UpsertKubernetesSecretValue(namespace, id, key, data, true, nil)
+}
+
+// UpsertKubernetesSecretValue updates the value of key of the kubernetes secret specified by namespace, id,
+// through the stringData field if stringData is set, otherwise through the data field.
+// It inserts a new secret if id doesn't already exist.
+// It inserts a new key-value pair if key doesn't already exist.
+// The secret is labeled with ManagedByLabel and annotated with annotations, whether it is created or patched.
+// Returns nil if successful, error otherwise
+func (cl *Client) UpsertKubernetesSecretValue(namespace, id, key string, data []byte, stringData bool, annotations map[string]string) error {
 	// check if the namespace exists
 	err := cl.ValidateKubernetesNamespace(namespace)
 	if err != nil {
 		return err
 	}
 
-	// encode with base64 encoding
-	encodedSrc := base64.StdEncoding.EncodeToString(data)
+	labels := map[string]string{
+		ManagedByLabel: cl.ManagerName(),
+	}
+	metadata := map[string]interface{}{
+		"labels": labels,
+	}
+	// a null annotations field would remove the annotations of the secret
+	if len(annotations) != 0 {
+		metadata["annotations"] = annotations
+	}
+	body := map[string]interface{}{
+		"metadata": metadata,
+	}
+	// create a new secret in the case that it does not already exist
+	newSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        id,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+	if stringData {
+		body["stringData"] = map[string]string{key: string(data)}
+		newSecret.StringData = map[string]string{key: string(data)}
+	} else {
+		// encode with base64 encoding
+		body["data"] = map[string]string{key: base64.StdEncoding.EncodeToString(data)}
+		newSecret.Data = map[string][]byte{key: data}
+	}
+
+	patch, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	return upsertSecret(cl.K8sClientset.CoreV1().Secrets(namespace), patch, newSecret)
+}
+
+// upsertBackoff paces and bounds the attempts of upsertSecret() racing with concurrent writers.
+var upsertBackoff = wait.Backoff{
+	Steps:    3,
+	Duration: 10 * time.Millisecond,
+	Factor:   5.0,
+	Jitter:   0.1,
+}
+
+// secretWriter is the subset of the K8s secrets client used by upsertSecret().
+type secretWriter interface {
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*v1.Secret, error)
+	Create(*v1.Secret) (*v1.Secret, error)
+}
+
+// upsertSecret applies the strategic merge patch to the secret newSecret.Name, or creates newSecret if it doesn't exist.
+// A Conflict of the patch, or an AlreadyExists of the create due to a concurrent create by another actor,
+// is retried with the patch, backing off by upsertBackoff.
+// Returns nil if successful, error otherwise
+func upsertSecret(secrets secretWriter, patch []byte, newSecret *v1.Secret) error {
+	racing := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+	return retry.OnError(upsertBackoff, racing, func() error {
+		_, err := secrets.Patch(newSecret.Name, types.StrategicMergePatchType, patch)
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = secrets.Create(newSecret)
+		return err
+	})
+}
+
+// GetKubernetesSecretLabels gets the labels of the kubernetes secret specified by namespace, id.
+// Returns error if the secret doesn't exist.
+func (cl *Client) GetKubernetesSecretLabels(namespace, id string) (map[string]string, error) {
+	secret, err := cl.K8sClientset.CoreV1().Secrets(namespace).Get(id, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return secret.ObjectMeta.Labels, nil
+}
+
+// DeleteKubernetesSecret deletes the kubernetes secret specified by namespace, id.
+// Returns nil if successful, error otherwise
+func (cl *Client) DeleteKubernetesSecret(namespace, id string) error {
+	return cl.K8sClientset.CoreV1().Secrets(namespace).Delete(id, &metav1.DeleteOptions{})
+}
+
+// DeleteKubernetesSecretKey removes key from the kubernetes secret specified by namespace, id.
+// Returns nil if successful or if the secret doesn't exist, error otherwise
+func (cl *Client) DeleteKubernetesSecretKey(namespace, id, key string) error {
+	// a null value removes the key in a strategic merge patch
 	patch, err := json.Marshal(map[string]interface{}{
-		"data": map[string]string{key: encodedSrc},
+		"data": map[string]interface{}{key: nil},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.K8sClientset.CoreV1().Secrets(namespace).Patch(id, types.StrategicMergePatchType, patch)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// GetKubernetesSecretAnnotations gets the annotations of the kubernetes secret specified by namespace, id.
+// Returns error if the secret doesn't exist.
+func (cl *Client) GetKubernetesSecretAnnotations(namespace, id string) (map[string]string, error) {
+	secret, err := cl.K8sClientset.CoreV1().Secrets(namespace).Get(id, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return secret.ObjectMeta.Annotations, nil
+}
+
+// GetKubernetesSecretKeyUpdateTime gets the time of the last update of key in the kubernetes secret specified by namespace, id,
+// i.e. the latest time of the managed fields owning the key, or the creation time of the secret if none is recorded.
+// Note that the time of a field manager is the time of its last update of any field of the secret.
+// Returns error if the secret doesn't exist.
+func (cl *Client) GetKubernetesSecretKeyUpdateTime(namespace, id, key string) (time.Time, error) {
+	secret, err := cl.K8sClientset.CoreV1().Secrets(namespace).Get(id, metav1.GetOptions{})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	updateTime := secret.ObjectMeta.CreationTimestamp.Time
+	for _, entry := range secret.ObjectMeta.ManagedFields {
+		if entry.Time != nil && entry.Time.After(updateTime) && ownsDataKey(entry.FieldsV1, key) {
+			updateTime = entry.Time.Time
+		}
+	}
+	return updateTime, nil
+}
+
+// ownsDataKey returns true if the managed fields, e.g. {"f:data":{"f:token":{}}}, include key of the data or stringData of a secret.
+func ownsDataKey(fields *metav1.FieldsV1, key string) bool {
+	if fields == nil {
+		return false
+	}
+	var set map[string]map[string]json.RawMessage
+	err := json.Unmarshal(fields.Raw, &set)
+	if err != nil {
+		return false
+	}
+	for _, field := range []string{"f:data", "f:stringData"} {
+		if _, ok := set[field]["f:"+key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GetKubernetesSecretType gets the type of the kubernetes secret specified by namespace, id.
+// Returns error if the secret doesn't exist.
+func (cl *Client) GetKubernetesSecretType(namespace, id string) (string, error) {
+	secret, err := cl.K8sClientset.CoreV1().Secrets(namespace).Get(id, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret.Type), nil
+}
+
+// AnnotateKubernetesSecret sets the annotations of the existing kubernetes secret specified by namespace, id.
+// Other annotations of the secret are left untouched.
+// Returns nil if successful, error otherwise
+func (cl *Client) AnnotateKubernetesSecret(namespace, id string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cl.K8sClientset.CoreV1().Secrets(namespace).Patch(id, types.StrategicMergePatchType, []byte(patch))
+	return err
+}
+
+// LabelKubernetesSecret sets the labels of the existing kubernetes secret specified by namespace, id.
+// Other labels of the secret are left untouched.
+// Returns nil if successful, error otherwise
+func (cl *Client) LabelKubernetesSecret(namespace, id string, labels map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labels,
+		},
 	})
 	if err != nil {
 		return err
 	}
 	_, err = cl.K8sClientset.CoreV1().Secrets(namespace).Patch(id, types.StrategicMergePatchType, []byte(patch))
+	return err
+}
+
+// SetKubernetesSecretOwner adds owner to the owner references of the existing kubernetes secret specified by namespace, id,
+// unless it is referenced already. Other owner references of the secret are left untouched.
+// Returns nil if successful, error otherwise
+func (cl *Client) SetKubernetesSecretOwner(namespace, id string, owner metav1.OwnerReference) error {
+	secrets := cl.K8sClientset.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(id, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for _, ref := range secret.OwnerReferences {
+		if ref.UID == owner.UID {
+			return nil
+		}
+	}
+
+	// owner references are merged by uid
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []metav1.OwnerReference{owner},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = secrets.Patch(id, types.StrategicMergePatchType, patch)
+	return err
+}
+
+// RecreateKubernetesSecret deletes the kubernetes secret specified by namespace, id,
+// and creates it again as an Opaque secret with the same data, e.g. to reset its immutable type.
+// The labels and annotations are reset to those of a newly created secret, except the keys in cl.PreserveMetadata.
+// Returns nil if successful, error otherwise
+func (cl *Client) RecreateKubernetesSecret(namespace, id string) error {
+	secrets := cl.K8sClientset.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(id, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = secrets.Delete(id, &metav1.DeleteOptions{})
+	if err != nil {
+		return err
+	}
+	_, err = secrets.Create(recreatedSecret(secret, cl.PreserveMetadata, cl.ManagerName()))
+	return err
+}
+
+// recreatedSecret returns a new Opaque secret with the name and data of secret,
+// labeled as managed by manager, carrying over only the labels and annotations of secret whose keys are in preserve.
+func recreatedSecret(secret *v1.Secret, preserve []string, manager string) *v1.Secret {
+	newSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secret.Name,
+			Namespace: secret.Namespace,
+			Labels: map[string]string{
+				ManagedByLabel: manager,
+			},
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: secret.Data,
+	}
+
+	for _, key := range preserve {
+		if val, ok := secret.Labels[key]; ok {
+			newSecret.Labels[key] = val
+		}
+		if val, ok := secret.Annotations[key]; ok {
+			if newSecret.Annotations == nil {
+				newSecret.Annotations = map[string]string{}
+			}
+			newSecret.Annotations[key] = val
+		}
+	}
+
+	return newSecret
+}
+
+// GetKubernetesConfigMap gets the data of the kubernetes ConfigMap specified by namespace, name.
+// Returns error if the ConfigMap doesn't exist.
+func (cl *Client) GetKubernetesConfigMap(namespace, name string) (map[string]string, error) {
+	configMap, err := cl.K8sClientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return configMap.Data, nil
+}
+
+// UpsertKubernetesConfigMap replaces the data of the kubernetes ConfigMap specified by namespace, name.
+// It inserts a new ConfigMap if name doesn't already exist.
+// Returns nil if successful, error otherwise
+func (cl *Client) UpsertKubernetesConfigMap(namespace, name string, data map[string]string) error {
+	configMaps := cl.K8sClientset.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(name, metav1.GetOptions{})
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
 			return err
 		}
 
-		// create a new secret in the case that it does not already exist
-		newSecret := &v1.Secret{
+		// create a new ConfigMap in the case that it does not already exist
+		newConfigMap := &v1.ConfigMap{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      id,
+				Name:      name,
 				Namespace: namespace,
+				Labels: map[string]string{
+					ManagedByLabel: cl.ManagerName(),
+				},
 			},
-			Data: map[string][]byte{
-				key: data,
-			},
-		}
-		_, err = cl.K8sClientset.CoreV1().Secrets(namespace).Create(newSecret)
-		if err != nil {
-			return err
+			Data: data,
 		}
+		_, err = configMaps.Create(newConfigMap)
+		return err
 	}
 
-	return nil
+	configMap.Data = data
+	_, err = configMaps.Update(configMap)
+	return err
 }
 
 // UpsertSecretManagerSecret adds a new version to the Secret Manager secret specified by project, id.
 // It inserts a new secret if id doesn't already exist.
 // If successful the latest version will have 'data' as its secret value, otherwise return error
 func (cl *Client) UpsertSecretManagerSecret(project, id string, data []byte) error {
+	return cl.UpsertReplicatedSecretManagerSecret(project, id, nil, data)
+}
+
+// UpsertReplicatedSecretManagerSecret adds a new version to the Secret Manager secret specified by project, id.
+// It inserts a new secret replicated to the given locations, or automatically if no locations are given, if id doesn't already exist.
+// Otherwise the replication of the existing secret is checked against locations, see CheckReplication().
+// If successful the latest version will have 'data' as its secret value, otherwise return error
+func (cl *Client) UpsertReplicatedSecretManagerSecret(project, id string, locations []string, data []byte) error {
 	parent := "projects/" + project
 	// Check if the secret exists
-	_, err := cl.GetSecretManagerSecretValue(project, id)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			// Create secret
-			req := &secretmanagerpb.CreateSecretRequest{
-				Parent:   parent,
-				SecretId: id,
-				Secret: &secretmanagerpb.Secret{
-					Replication: &secretmanagerpb.Replication{
-						Replication: &secretmanagerpb.Replication_Automatic_{
-							Automatic: &secretmanagerpb.Replication_Automatic{},
-						},
-					},
-				},
-			}
-			_, err := cl.SecretManagerClient.CreateSecret(context.TODO(), req)
-			if err != nil {
-				return err
-			}
-		} else {
+	secret, err := cl.secretManagerClient().GetSecret(context.TODO(), &secretmanagerpb.GetSecretRequest{
+		Name: parent + "/secrets/" + id,
+	})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		// Create secret
+		req := &secretmanagerpb.CreateSecretRequest{
+			Parent:   parent,
+			SecretId: id,
+			Secret: &secretmanagerpb.Secret{
+				Replication: replicationPolicy(locations),
+			},
+		}
+		_, err := cl.secretManagerClient().CreateSecret(context.TODO(), req)
+		if err != nil {
 			return err
 		}
+	case err != nil:
+		ResetReplication(project, id)
+		return err
+	default:
+		CheckReplication(project, id, replicaLocations(secret.GetReplication()), locations)
 	}
 
 	// Add secret version
@@ -220,7 +716,7 @@ func (cl *Client) UpsertSecretManagerSecret(project, id string, data []byte) err
 			Data: data,
 		},
 	}
-	_, err = cl.SecretManagerClient.AddSecretVersion(context.TODO(), verReq)
+	_, err = cl.secretManagerClient().AddSecretVersion(context.TODO(), verReq)
 	if err != nil {
 		return err
 	}
@@ -230,16 +726,54 @@ func (cl *Client) UpsertSecretManagerSecret(project, id string, data []byte) err
 // GetSecretManagerSecretValue gets the value from the Secret Manager secret specified by project, id.
 // Returns nil and secret value if successful, error otherwise
 func (cl *Client) GetSecretManagerSecretValue(project, id string) ([]byte, error) {
+	data, _, err := cl.GetSecretManagerSecretVersion(project, id)
+	return data, err
+}
+
+// GetSecretManagerSecretCreateTime gets the createTime of the secret version specified by project, id, version.
+// Returns createTime if successful, otherwise error.
+func (cl *Client) GetSecretManagerSecretCreateTime(project, id, version string) (time.Time, error) {
+	getReq := &secretmanagerpb.GetSecretVersionRequest{
+		Name: "projects/" + project + "/secrets/" + id + "/versions/" + version,
+	}
+	getResult, err := cl.secretManagerClient().GetSecretVersion(context.TODO(), getReq)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return ptypes.Timestamp(getResult.CreateTime)
+}
+
+// GetSecretManagerSecretLabels gets the labels of the Secret Manager secret specified by project, id.
+// Returns the secret labels if successful, error otherwise
+func (cl *Client) GetSecretManagerSecretLabels(project, id string) (map[string]string, error) {
+	getReq := &secretmanagerpb.GetSecretRequest{
+		Name: "projects/" + project + "/secrets/" + id,
+	}
+	secret, err := cl.secretManagerClient().GetSecret(context.TODO(), getReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret.Labels, nil
+}
+
+// GetSecretManagerSecretVersion gets the value and the version of the latest Secret Manager secret version specified by project, id.
+// Returns nil, the secret value and the resolved version if successful, error otherwise
+func (cl *Client) GetSecretManagerSecretVersion(project, id string) ([]byte, string, error) {
 	ctx := context.TODO()
 	name := "projects/" + project + "/secrets/" + id + "/versions/latest"
 
 	accReq := &secretmanagerpb.AccessSecretVersionRequest{
 		Name: name,
 	}
-	accResult, err := cl.SecretManagerClient.AccessSecretVersion(ctx, accReq)
+	accResult, err := cl.secretManagerClient().AccessSecretVersion(ctx, accReq)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return accResult.Payload.Data, nil
+	// accResult.Name is the resolved name projects/*/secrets/*/versions/*
+	version := accResult.Name[strings.LastIndex(accResult.Name, "/")+1:]
+
+	return accResult.Payload.Data, version, nil
 }
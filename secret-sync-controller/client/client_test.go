@@ -0,0 +1,484 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"sigs.k8s.io/k8s-gsm-tools/gsmoption"
+)
+
+// fakeSecretWriter returns the injected errors in order, one per call, then succeeds.
+type fakeSecretWriter struct {
+	patchErrs  []error
+	createErrs []error
+	patches    int
+	creates    int
+}
+
+func (f *fakeSecretWriter) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*v1.Secret, error) {
+	f.patches++
+	if len(f.patchErrs) == 0 {
+		return &v1.Secret{}, nil
+	}
+	err := f.patchErrs[0]
+	f.patchErrs = f.patchErrs[1:]
+	return nil, err
+}
+
+func (f *fakeSecretWriter) Create(secret *v1.Secret) (*v1.Secret, error) {
+	f.creates++
+	if len(f.createErrs) == 0 {
+		return secret, nil
+	}
+	err := f.createErrs[0]
+	f.createErrs = f.createErrs[1:]
+	return nil, err
+}
+
+func TestUpsertSecret(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+	notFound := apierrors.NewNotFound(resource, "secret-a")
+	alreadyExists := apierrors.NewAlreadyExists(resource, "secret-a")
+	conflict := apierrors.NewConflict(resource, "secret-a", fmt.Errorf("the object has been modified"))
+
+	var testcases = []struct {
+		name          string
+		patchErrs     []error
+		createErrs    []error
+		expectErr     bool
+		expectPatches int
+		expectCreates int
+	}{
+		{
+			name:          "Existing secret. Should patch once.",
+			expectErr:     false,
+			expectPatches: 1,
+			expectCreates: 0,
+		},
+		{
+			name:          "Missing secret. Should create it.",
+			patchErrs:     []error{notFound},
+			expectErr:     false,
+			expectPatches: 1,
+			expectCreates: 1,
+		},
+		{
+			name:          "Secret created concurrently. Should retry the patch on AlreadyExists.",
+			patchErrs:     []error{notFound},
+			createErrs:    []error{alreadyExists},
+			expectErr:     false,
+			expectPatches: 2,
+			expectCreates: 1,
+		},
+		{
+			name:          "Conflict on the first patch. Should retry the patch.",
+			patchErrs:     []error{conflict},
+			expectErr:     false,
+			expectPatches: 2,
+			expectCreates: 0,
+		},
+		{
+			name:          "Persistent conflict. Should give up after the bounded retries.",
+			patchErrs:     []error{conflict, conflict, conflict, conflict},
+			expectErr:     true,
+			expectPatches: upsertBackoff.Steps,
+			expectCreates: 0,
+		},
+		{
+			name:          "Other patch error. Should fail without retry.",
+			patchErrs:     []error{apierrors.NewForbidden(resource, "secret-a", fmt.Errorf("forbidden"))},
+			expectErr:     true,
+			expectPatches: 1,
+			expectCreates: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			secrets := &fakeSecretWriter{
+				patchErrs:  tc.patchErrs,
+				createErrs: tc.createErrs,
+			}
+			newSecret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "secret-a",
+					Namespace: "ns-a",
+				},
+			}
+
+			err := upsertSecret(secrets, []byte(`{"data":{}}`), newSecret)
+			if tc.expectErr && err == nil {
+				t.Errorf("Expected error but got nil.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if secrets.patches != tc.expectPatches {
+				t.Errorf("Expected %d patches, but got %d.", tc.expectPatches, secrets.patches)
+			}
+			if secrets.creates != tc.expectCreates {
+				t.Errorf("Expected %d creates, but got %d.", tc.expectCreates, secrets.creates)
+			}
+		})
+	}
+}
+
+func TestUpsertSecretBackoff(t *testing.T) {
+	resource := schema.GroupResource{Resource: "secrets"}
+	secrets := &fakeSecretWriter{
+		patchErrs: []error{apierrors.NewConflict(resource, "secret-a", fmt.Errorf("the object has been modified"))},
+	}
+	newSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "secret-a",
+			Namespace: "ns-a",
+		},
+	}
+
+	start := time.Now()
+	err := upsertSecret(secrets, []byte(`{"data":{}}`), newSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the patch is retried after the first interval of the backoff, not back-to-back
+	if elapsed := time.Since(start); elapsed < upsertBackoff.Duration {
+		t.Errorf("Expected the retry to back off for %s, but it took %s.", upsertBackoff.Duration, elapsed)
+	}
+}
+
+func TestUpsertKubernetesSecretValue(t *testing.T) {
+	var testcases = []struct {
+		name              string
+		existing          *v1.Secret
+		stringData        bool
+		annotations       map[string]string
+		expectLabels      map[string]string
+		expectAnnotations map[string]string
+	}{
+		{
+			name:              "Missing secret. Should create it labeled and annotated.",
+			annotations:       map[string]string{SourceAnnotation("key-a"): "projects/project-1/secrets/secret-1@1"},
+			expectLabels:      map[string]string{ManagedByLabel: ManagedByValue},
+			expectAnnotations: map[string]string{SourceAnnotation("key-a"): "projects/project-1/secrets/secret-1@1"},
+		},
+		{
+			name: "Existing unlabeled secret. Should label and annotate it on patch.",
+			existing: &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "secret-a",
+					Namespace:   "ns-a",
+					Labels:      map[string]string{"team": "team-a"},
+					Annotations: map[string]string{"note": "hand-written"},
+				},
+				Data: map[string][]byte{"other": []byte("value")},
+			},
+			annotations:       map[string]string{SourceAnnotation("key-a"): "projects/project-1/secrets/secret-1@1"},
+			expectLabels:      map[string]string{ManagedByLabel: ManagedByValue, "team": "team-a"},
+			expectAnnotations: map[string]string{SourceAnnotation("key-a"): "projects/project-1/secrets/secret-1@1", "note": "hand-written"},
+		},
+		{
+			name: "Existing unlabeled secret without annotations. Should label it and keep its annotations.",
+			existing: &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "secret-a",
+					Namespace:   "ns-a",
+					Annotations: map[string]string{"note": "hand-written"},
+				},
+			},
+			stringData:        true,
+			expectLabels:      map[string]string{ManagedByLabel: ManagedByValue},
+			expectAnnotations: map[string]string{"note": "hand-written"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			objects := []runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns-a"}}}
+			if tc.existing != nil {
+				objects = append(objects, tc.existing)
+			}
+			cl := &Client{K8sClientset: fake.NewSimpleClientset(objects...)}
+
+			err := cl.UpsertKubernetesSecretValue("ns-a", "secret-a", "key-a", []byte("value-a"), tc.stringData, tc.annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			secret, err := cl.K8sClientset.CoreV1().Secrets("ns-a").Get("secret-a", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(secret.Labels, tc.expectLabels) {
+				t.Errorf("Expected labels %v, but got %v.", tc.expectLabels, secret.Labels)
+			}
+			if !reflect.DeepEqual(secret.Annotations, tc.expectAnnotations) {
+				t.Errorf("Expected annotations %v, but got %v.", tc.expectAnnotations, secret.Annotations)
+			}
+		})
+	}
+}
+
+func TestGetKubernetesSecretKeyUpdateTime(t *testing.T) {
+	created := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(manager string, minutes int, fields string) metav1.ManagedFieldsEntry {
+		updated := metav1.NewTime(created.Add(time.Duration(minutes) * time.Minute))
+		return metav1.ManagedFieldsEntry{
+			Manager:  manager,
+			Time:     &updated,
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(fields)},
+		}
+	}
+
+	var testcases = []struct {
+		name          string
+		managedFields []metav1.ManagedFieldsEntry
+		expectTime    time.Time
+	}{
+		{
+			name:          "No managed fields. Should return the creation time.",
+			managedFields: nil,
+			expectTime:    created,
+		},
+		{
+			name: "Key owned by a manager. Should return the time of the manager.",
+			managedFields: []metav1.ManagedFieldsEntry{
+				entry("kubectl-edit", 10, `{"f:data":{"f:key-a":{}}}`),
+			},
+			expectTime: created.Add(10 * time.Minute),
+		},
+		{
+			name: "Other key and annotations updated later. Should return the time of the manager owning the key.",
+			managedFields: []metav1.ManagedFieldsEntry{
+				entry("kubectl-edit", 10, `{"f:data":{"f:key-a":{}}}`),
+				entry("secret-sync-controller", 20, `{"f:data":{"f:key-b":{}},"f:metadata":{"f:annotations":{"f:secret-sync/key-a.synced":{}}}}`),
+			},
+			expectTime: created.Add(10 * time.Minute),
+		},
+		{
+			name: "Key written as stringData. Should return the time of the manager.",
+			managedFields: []metav1.ManagedFieldsEntry{
+				entry("kubectl-create", 5, `{"f:stringData":{".":{},"f:key-a":{}}}`),
+			},
+			expectTime: created.Add(5 * time.Minute),
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			secret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "secret-a",
+					Namespace:         "ns-a",
+					CreationTimestamp: metav1.NewTime(created),
+					ManagedFields:     tc.managedFields,
+				},
+			}
+			cl := &Client{K8sClientset: fake.NewSimpleClientset(secret)}
+
+			updateTime, err := cl.GetKubernetesSecretKeyUpdateTime("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !updateTime.Equal(tc.expectTime) {
+				t.Errorf("Expected update time %s, but got %s.", tc.expectTime, updateTime)
+			}
+		})
+	}
+}
+
+func TestRecreatedSecret(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "secret-a",
+			Namespace: "ns-a",
+			Labels: map[string]string{
+				ManagedByLabel:                ManagedByValue,
+				"argocd.argoproj.io/instance": "app-a",
+				"team":                        "team-a",
+			},
+			Annotations: map[string]string{
+				"meta.helm.sh/release-name": "release-a",
+				LastWriterAnnotation:        "controller-1",
+			},
+		},
+		Type: "kubernetes.io/tls",
+		Data: map[string][]byte{"key-a": []byte("value-a")},
+	}
+
+	var testcases = []struct {
+		name              string
+		preserve          []string
+		expectLabels      map[string]string
+		expectAnnotations map[string]string
+	}{
+		{
+			name:     "Nothing preserved. Should reset labels and annotations.",
+			preserve: nil,
+			expectLabels: map[string]string{
+				ManagedByLabel: ManagedByValue,
+			},
+			expectAnnotations: nil,
+		},
+		{
+			name:     "Preserved keys. Should carry them over and reset the others.",
+			preserve: []string{"argocd.argoproj.io/instance", "meta.helm.sh/release-name", "missing-key"},
+			expectLabels: map[string]string{
+				ManagedByLabel:                ManagedByValue,
+				"argocd.argoproj.io/instance": "app-a",
+			},
+			expectAnnotations: map[string]string{
+				"meta.helm.sh/release-name": "release-a",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			newSecret := recreatedSecret(secret, tc.preserve, ManagedByValue)
+			if newSecret.Type != v1.SecretTypeOpaque {
+				t.Errorf("Expected type %s, but got %s.", v1.SecretTypeOpaque, newSecret.Type)
+			}
+			if !reflect.DeepEqual(newSecret.Data, secret.Data) {
+				t.Errorf("Expected data %v, but got %v.", secret.Data, newSecret.Data)
+			}
+			if !reflect.DeepEqual(newSecret.Labels, tc.expectLabels) {
+				t.Errorf("Expected labels %v, but got %v.", tc.expectLabels, newSecret.Labels)
+			}
+			if !reflect.DeepEqual(newSecret.Annotations, tc.expectAnnotations) {
+				t.Errorf("Expected annotations %v, but got %v.", tc.expectAnnotations, newSecret.Annotations)
+			}
+		})
+	}
+}
+
+func TestNewSecretManagerClientOptions(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		endpoint   string
+		featureSet gsmoption.FeatureSet
+		expected   []option.ClientOption
+	}{
+		{
+			name:       "Global endpoint with all features.",
+			endpoint:   "",
+			featureSet: gsmoption.FeatureSetFull,
+			expected:   nil,
+		},
+		{
+			name:       "Regional endpoint with all features.",
+			endpoint:   "secretmanager.us-east1.rep.googleapis.com:443",
+			featureSet: gsmoption.FeatureSetFull,
+			expected:   []option.ClientOption{option.WithEndpoint("secretmanager.us-east1.rep.googleapis.com:443")},
+		},
+		{
+			name:       "Emulator endpoint with features disabled.",
+			endpoint:   "localhost:9090",
+			featureSet: gsmoption.FeatureSetEmulator,
+			expected: []option.ClientOption{
+				option.WithEndpoint("localhost:9090"),
+				option.WithoutAuthentication(),
+				option.WithGRPCDialOption(grpc.WithInsecure()),
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			opts, err := gsmoption.ClientOptions(tc.endpoint, tc.featureSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the options are passed as is to the created client
+			var actual []option.ClientOption
+			defer func(orig func(context.Context, ...option.ClientOption) (*secretmanager.Client, error)) {
+				newSecretManagerClient = orig
+			}(newSecretManagerClient)
+			newSecretManagerClient = func(ctx context.Context, opts ...option.ClientOption) (*secretmanager.Client, error) {
+				actual = opts
+				return &secretmanager.Client{}, nil
+			}
+			_, err = NewSecretManagerClient(context.Background(), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected client options %v, got %v.", tc.expected, actual)
+			}
+
+			// the clients of the credentials cache share the options
+			actual = nil
+			cache := NewSecretManagerCredentialsCache(context.Background(), nil, opts...)
+			_, err = cache.New([]byte("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := append([]option.ClientOption{option.WithCredentialsJSON([]byte("{}"))}, tc.expected...)
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Expected credentials client options %v, got %v.", expected, actual)
+			}
+		})
+	}
+}
+
+func TestReloadSecretManagerClient(t *testing.T) {
+	defer func(orig func(context.Context, ...option.ClientOption) (*secretmanager.Client, error)) {
+		newSecretManagerClient = orig
+	}(newSecretManagerClient)
+
+	// each created client is told apart by its call options
+	created := []*secretmanager.Client{}
+	newSecretManagerClient = func(ctx context.Context, opts ...option.ClientOption) (*secretmanager.Client, error) {
+		smClient := &secretmanager.Client{CallOptions: &secretmanager.CallOptions{}}
+		created = append(created, smClient)
+		return smClient, nil
+	}
+
+	initial, err := NewSecretManagerClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &Client{SecretManagerClient: *initial}
+
+	// the credentials source is swapped, e.g. a rotated key in the credentials file
+	previous, err := cl.ReloadSecretManagerClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != 2 {
+		t.Fatalf("Expected a freshly built client, got %d clients.", len(created))
+	}
+	if cl.secretManagerClient().CallOptions != created[1].CallOptions {
+		t.Errorf("Expected the subsequent calls to use the freshly built client.")
+	}
+	if previous.(*secretmanager.Client).CallOptions != created[0].CallOptions {
+		t.Errorf("Expected the initial client to be returned for closing.")
+	}
+}
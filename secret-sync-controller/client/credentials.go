@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"google.golang.org/api/option"
+)
+
+// SourceReader reads the latest version of Secret Manager secrets.
+type SourceReader interface {
+	GetSecretManagerSecretVersion(project, id string) ([]byte, string, error)
+}
+
+// credentialsReader is a pooled SourceReader of a CredentialsCache.
+type credentialsReader struct {
+	SourceReader
+}
+
+// Close closes the Secret Manager client of the reader, if any.
+func (r credentialsReader) Close() error {
+	closeReader(r.SourceReader)
+	return nil
+}
+
+// CredentialsCache lazily creates and caches one SourceReader per credentials secret in a ClientPool,
+// built from the service account key JSON stored in the secret, e.g. for cross-org access.
+// The credentials are read with Bootstrap, and the reader is rebuilt once a new version of the credentials is added.
+// The replaced reader is closed once the callers still reading through it release it.
+// It is safe for concurrent use.
+type CredentialsCache struct {
+	pool ClientPool
+	// Bootstrap reads the credentials secrets, e.g. with the default credentials.
+	Bootstrap SourceReader
+	// New creates a new reader from the credentials. The credentials are zeroed once it returns.
+	New func(credentials []byte) (SourceReader, error)
+}
+
+// NewSecretManagerCredentialsCache creates a CredentialsCache of Secret Manager clients,
+// reading the credentials secrets with bootstrap. The clients are created with opts in addition to the credentials.
+func NewSecretManagerCredentialsCache(ctx context.Context, bootstrap SourceReader, opts ...option.ClientOption) *CredentialsCache {
+	return &CredentialsCache{
+		Bootstrap: bootstrap,
+		New: func(credentials []byte) (SourceReader, error) {
+			smClient, err := NewSecretManagerClient(ctx, append([]option.ClientOption{option.WithCredentialsJSON(credentials)}, opts...)...)
+			if err != nil {
+				return nil, err
+			}
+			return &Client{SecretManagerClient: *smClient}, nil
+		},
+	}
+}
+
+// Get returns the cached reader built from the latest version of the credentials secret specified by project, id,
+// creating it if it does not exist yet or the credentials have a new version.
+// The returned release is called once the caller is done reading, see ClientPool.Acquire().
+// Returns error if the credentials cannot be read or the creation fails.
+func (c *CredentialsCache) Get(project, id string) (SourceReader, func(), error) {
+	credentials, version, err := c.Bootstrap.GetSecretManagerSecretVersion(project, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Fail to read credentials from projects/%s/secrets/%s: %s", project, id, err)
+	}
+	defer zero(credentials)
+
+	name := fmt.Sprintf("projects/%s/secrets/%s", project, id)
+	reader, release, err := c.pool.Acquire(ClientKey{Credentials: name}, version, func() (io.Closer, error) {
+		reader, err := c.New(credentials)
+		if err != nil {
+			return nil, err
+		}
+		return credentialsReader{reader}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reader.(credentialsReader).SourceReader, release, nil
+}
+
+// closeReader closes the Secret Manager client of reader, if any.
+func closeReader(reader SourceReader) {
+	switch r := reader.(type) {
+	case *Client:
+		r.SecretManagerClient.Close()
+	case io.Closer:
+		r.Close()
+	}
+}
+
+// zero overwrites data, so that key material does not linger in memory.
+func zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+// fakeReader serves a single value per secret, whose version is bumped by each set.
+type fakeReader struct {
+	values   map[string][]byte
+	versions map[string]int
+	closed   bool
+}
+
+func (r *fakeReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (r *fakeReader) set(project, id string, data []byte) {
+	if r.values == nil {
+		r.values = make(map[string][]byte)
+		r.versions = make(map[string]int)
+	}
+	r.values[project+"/"+id] = data
+	r.versions[project+"/"+id]++
+}
+
+func (r *fakeReader) GetSecretManagerSecretVersion(project, id string) ([]byte, string, error) {
+	data, ok := r.values[project+"/"+id]
+	if !ok {
+		return nil, "", fmt.Errorf("secret %s/%s not found", project, id)
+	}
+	return append([]byte(nil), data...), strconv.Itoa(r.versions[project+"/"+id]), nil
+}
+
+func TestCredentialsCache(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		rotate        bool
+		newErr        error
+		expectErr     bool
+		expectCreated int
+	}{
+		{
+			name:          "Unchanged credentials. Should reuse the cached client.",
+			expectErr:     false,
+			expectCreated: 1,
+		},
+		{
+			name:          "Rotated credentials. Should rebuild the client.",
+			rotate:        true,
+			expectErr:     false,
+			expectCreated: 2,
+		},
+		{
+			name:          "Invalid credentials. Should fail.",
+			newErr:        fmt.Errorf("invalid key"),
+			expectErr:     true,
+			expectCreated: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			bootstrap := &fakeReader{}
+			bootstrap.set("project-1", "credentials", []byte("key-v1"))
+
+			created := 0
+			seen := [][]byte{}
+			passed := [][]byte{}
+			cache := &CredentialsCache{
+				Bootstrap: bootstrap,
+				New: func(credentials []byte) (SourceReader, error) {
+					seen = append(seen, append([]byte(nil), credentials...))
+					passed = append(passed, credentials)
+					if tc.newErr != nil {
+						return nil, tc.newErr
+					}
+					created++
+					reader := &fakeReader{}
+					reader.set("project-2", "secret-a", append([]byte("value-with-"), credentials...))
+					return reader, nil
+				},
+			}
+
+			var reader SourceReader
+			var err error
+			readers := []SourceReader{}
+			releases := []func(){}
+			for i := 0; i < 2; i++ {
+				if tc.rotate && i == 1 {
+					bootstrap.set("project-1", "credentials", []byte("key-v2"))
+				}
+				var release func()
+				reader, release, err = cache.Get("project-1", "credentials")
+				if err != nil {
+					break
+				}
+				readers = append(readers, reader)
+				releases = append(releases, release)
+			}
+
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("Expected error %v, but got %v.", tc.expectErr, err)
+			}
+			if created != tc.expectCreated {
+				t.Errorf("Expected %d clients created, but got %d.", tc.expectCreated, created)
+			}
+			for i, credentials := range passed {
+				if !bytes.Equal(credentials, make([]byte, len(credentials))) {
+					t.Errorf("Expected credentials %s to be zeroed after building the client.", seen[i])
+				}
+			}
+			if tc.expectErr {
+				return
+			}
+
+			// the replaced reader may still be read through until released
+			if readers[0].(*fakeReader).closed {
+				t.Errorf("Expected the first reader to stay open until released.")
+			}
+			releases[0]()
+			if closed := readers[0].(*fakeReader).closed; closed != tc.rotate {
+				t.Errorf("Expected the first reader closed: %t once released, but got %t.", tc.rotate, closed)
+			}
+
+			value, _, err := reader.GetSecretManagerSecretVersion("project-2", "secret-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectValue := "value-with-key-v1"
+			if tc.rotate {
+				expectValue = "value-with-key-v2"
+			}
+			if string(value) != expectValue {
+				t.Errorf("Expected value %s, but got %s.", expectValue, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// NewDynamicClient creates a new K8s dynamic client, configured as NewK8sClientset.
+func NewDynamicClient(kubeconfig string) (dynamic.Interface, error) {
+	config, err := restConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(config)
+}
+
+// ResourceClient reads and writes secret values in fields of custom resource objects.
+// Values are stored base64 encoded, as in the data field of a core v1 Secret.
+type ResourceClient struct {
+	Dynamic dynamic.Interface
+	// Manager is the value of ManagedByLabel of the created objects. Defaults to ManagedByValue.
+	Manager string
+}
+
+// GetResourceValue gets the value of the field at fields of the object specified by gvr, namespace, name.
+// Returns nil if the object or the field doesn't exist.
+func (cl *ResourceClient) GetResourceValue(gvr schema.GroupVersionResource, namespace, name string, fields []string) ([]byte, error) {
+	obj, err := cl.Dynamic.Resource(gvr).Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	encoded, found, err := unstructured.NestedString(obj.Object, fields...)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// GetResourceUID gets the uid of the object specified by gvr, namespace, name, e.g. to reference it as an owner.
+// Returns error if the object doesn't exist.
+func (cl *ResourceClient) GetResourceUID(gvr schema.GroupVersionResource, namespace, name string) (types.UID, error) {
+	obj, err := cl.Dynamic.Resource(gvr).Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return obj.GetUID(), nil
+}
+
+// UpsertResourceValue sets the value of the field at fields of the object specified by gvr, namespace, name.
+// It creates a new object of kind if name doesn't already exist.
+// Returns nil if successful, error otherwise
+func (cl *ResourceClient) UpsertResourceValue(gvr schema.GroupVersionResource, kind, namespace, name string, fields []string, data []byte) error {
+	resources := cl.Dynamic.Resource(gvr).Namespace(namespace)
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	obj, err := resources.Get(name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		// create a new object in the case that it does not already exist
+		obj = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetAPIVersion(schema.GroupVersion{Group: gvr.Group, Version: gvr.Version}.String())
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(map[string]string{
+			ManagedByLabel: managerOrDefault(cl.Manager),
+		})
+		err = unstructured.SetNestedField(obj.Object, encoded, fields...)
+		if err != nil {
+			return fmt.Errorf("Fail to set field %v: %s", fields, err)
+		}
+		_, err = resources.Create(obj, metav1.CreateOptions{})
+		return err
+	}
+
+	err = unstructured.SetNestedField(obj.Object, encoded, fields...)
+	if err != nil {
+		return fmt.Errorf("Fail to set field %v: %s", fields, err)
+	}
+	_, err = resources.Update(obj, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	kms "cloud.google.com/go/kms/apiv1"
+	"context"
+	"google.golang.org/api/option"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+// KMSClient encrypts and decrypts the values of the destinations with envelope encryption with Cloud KMS keys.
+type KMSClient struct {
+	Client *kms.KeyManagementClient
+}
+
+// NewKMSClient creates a new Cloud KMS client with opts, using the default credentials if none is given.
+func NewKMSClient(ctx context.Context, opts ...option.ClientOption) (*KMSClient, error) {
+	client, err := kms.NewKeyManagementClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &KMSClient{Client: client}, nil
+}
+
+// Encrypt encrypts plaintext with the Cloud KMS key keyName, in format projects/<project>/locations/<location>/keyRings/<keyRing>/cryptoKeys/<key>,
+// with its primary version.
+func (cl *KMSClient) Encrypt(keyName string, plaintext []byte) ([]byte, error) {
+	resp, err := cl.Client.Encrypt(context.Background(), &kmspb.EncryptRequest{
+		Name:      keyName,
+		Plaintext: plaintext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Ciphertext, nil
+}
+
+// Decrypt decrypts ciphertext encrypted by any version of the Cloud KMS key keyName.
+func (cl *KMSClient) Decrypt(keyName string, ciphertext []byte) ([]byte, error) {
+	resp, err := cl.Client.Decrypt(context.Background(), &kmspb.DecryptRequest{
+		Name:       keyName,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
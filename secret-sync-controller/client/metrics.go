@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"net/http"
+	"path"
+
+	"k8s.io/client-go/transport"
+)
+
+// Values of the api label of the apiCalls metric.
+const (
+	kubernetesAPI    = "kubernetes"
+	secretManagerAPI = "secretmanager"
+)
+
+// apiCalls is updated by the clients created by NewK8sClientset(), NewDynamicClient() and NewSecretManagerClient(),
+// for each request sent to the Kubernetes API, by HTTP method, and to the Secret Manager API, by RPC name.
+var apiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "secret_sync_api_calls_total",
+	Help: "Number of requests sent to the Kubernetes and Secret Manager APIs.",
+}, []string{"api", "method"})
+
+// replicationDrift is updated by CheckReplication() for the Secret Manager secrets written by the reverse and bidirectional specs.
+var replicationDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "secret_sync_replication_drift",
+	Help: "Whether the replication policy of an existing Secret Manager secret written by the controller differs from its spec (1) or not (0). Replication is immutable, drifted secrets need manual recreation.",
+}, []string{"project", "secret"})
+
+func init() {
+	prometheus.MustRegister(apiCalls, replicationDrift)
+}
+
+// countingTransport counts the requests sent to the Kubernetes API through its RoundTripper.
+type countingTransport struct {
+	http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	apiCalls.WithLabelValues(kubernetesAPI, req.Method).Inc()
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// countKubernetesCalls wraps the transport of the Kubernetes clients, see rest.Config.Wrap().
+var countKubernetesCalls transport.WrapperFunc = func(rt http.RoundTripper) http.RoundTripper {
+	return countingTransport{rt}
+}
+
+// countSecretManagerCalls is the interceptor of the Secret Manager clients counting their calls,
+// e.g. AccessSecretVersion for /google.cloud.secretmanager.v1.SecretManagerService/AccessSecretVersion.
+func countSecretManagerCalls(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	apiCalls.WithLabelValues(secretManagerAPI, path.Base(method)).Inc()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
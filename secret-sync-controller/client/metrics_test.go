@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountKubernetesCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: countKubernetesCalls(http.DefaultTransport)}
+	before := testutil.ToFloat64(apiCalls.WithLabelValues(kubernetesAPI, http.MethodGet))
+	resp, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if delta := testutil.ToFloat64(apiCalls.WithLabelValues(kubernetesAPI, http.MethodGet)) - before; delta != 1 {
+		t.Errorf("Expected 1 counted call, but got %v.", delta)
+	}
+}
+
+func TestCountSecretManagerCalls(t *testing.T) {
+	method := "/google.cloud.secretmanager.v1.SecretManagerService/AccessSecretVersion"
+	before := testutil.ToFloat64(apiCalls.WithLabelValues(secretManagerAPI, "AccessSecretVersion"))
+
+	invoked := false
+	invoker := func(ctx context.Context, m string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked = m == method
+		return nil
+	}
+	err := countSecretManagerCalls(context.Background(), method, nil, nil, nil, invoker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !invoked {
+		t.Errorf("Expected the call to be invoked with method %s.", method)
+	}
+
+	if delta := testutil.ToFloat64(apiCalls.WithLabelValues(secretManagerAPI, "AccessSecretVersion")) - before; delta != 1 {
+		t.Errorf("Expected 1 counted call, but got %v.", delta)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+// ClientKey identifies a pooled client by the credentials and the project it serves.
+type ClientKey struct {
+	// Credentials identifies the credentials of the client, e.g. the path to a credentials file
+	// or the name of the Secret Manager secret holding them, empty for the default credentials.
+	Credentials string
+	Project     string
+}
+
+// String describes the project and the credentials of the key, e.g. in errors.
+func (key ClientKey) String() string {
+	switch {
+	case key.Credentials == "":
+		return "project " + key.Project
+	case key.Project == "":
+		return "credentials " + key.Credentials
+	}
+	return fmt.Sprintf("project %s with credentials %s", key.Project, key.Credentials)
+}
+
+// pooledClient is a client of a ClientPool, created for a version of its credentials.
+type pooledClient struct {
+	client  io.Closer
+	version string
+	// calls counts the acquisitions of the client not released yet.
+	calls int
+	// retired is set once the client is replaced or the pool is closed, to close the client once calls drops to 0.
+	retired bool
+}
+
+// ClientPool lazily creates and caches one client per ClientKey,
+// so that clients are reused across specs and sync cycles instead of being constructed per call.
+// It is safe for concurrent use.
+type ClientPool struct {
+	mutex   sync.Mutex
+	clients map[ClientKey]*pooledClient
+	closed  bool
+	// New creates a new client for key, unless Acquire() is given another constructor. It is called at most once per key.
+	New func(key ClientKey) (io.Closer, error)
+}
+
+// Get returns the cached client of key, creating it with p.New if it does not exist yet.
+// The client is closed by Close(), unless replaced by Acquire() of another version first.
+// Returns error if the creation fails or the pool is closed.
+func (p *ClientPool) Get(key ClientKey) (io.Closer, error) {
+	client, release, err := p.Acquire(key, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return client, nil
+}
+
+// Acquire returns the cached client of key created for version, e.g. the version of the credentials secret,
+// creating it with create, or with p.New if create is nil, if it does not exist yet or was created for another version.
+// The client of another version is retired once replaced, and kept if the creation fails.
+// A retired client is closed once all its acquisitions are released, so that the calls in flight through it complete.
+// The returned release is called once the caller is done with the client.
+// Returns error if the creation fails or the pool is closed.
+func (p *ClientPool) Acquire(key ClientKey, version string, create func() (io.Closer, error)) (io.Closer, func(), error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil, nil, fmt.Errorf("Client pool is closed")
+	}
+
+	replaced, ok := p.clients[key]
+	if ok && replaced.version == version {
+		return replaced.client, p.acquire(replaced), nil
+	}
+
+	if create == nil {
+		create = func() (io.Closer, error) {
+			return p.New(key)
+		}
+	}
+	client, err := create()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Fail to create client for %s: %s", key, err)
+	}
+
+	if ok {
+		err = p.retire(key, replaced)
+		if err != nil {
+			klog.Warning(err)
+		}
+	}
+	if p.clients == nil {
+		p.clients = make(map[ClientKey]*pooledClient)
+	}
+	pooled := &pooledClient{
+		client:  client,
+		version: version,
+	}
+	p.clients[key] = pooled
+
+	return client, p.acquire(pooled), nil
+}
+
+// acquire counts an acquisition of pooled, returns its release. Should be called with p.mutex held.
+func (p *ClientPool) acquire(pooled *pooledClient) func() {
+	pooled.calls++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+
+			pooled.calls--
+			if pooled.retired && pooled.calls == 0 {
+				pooled.client.Close()
+			}
+		})
+	}
+}
+
+// retire closes the client pooled for key if no acquisition of it is in flight, otherwise once the last one is released.
+// Returns the error of closing the client right away. Should be called with p.mutex held.
+func (p *ClientPool) retire(key ClientKey, pooled *pooledClient) error {
+	pooled.retired = true
+	if pooled.calls != 0 {
+		return nil
+	}
+
+	err := pooled.client.Close()
+	if err != nil {
+		return fmt.Errorf("Fail to close client for %s: %s", key, err)
+	}
+	return nil
+}
+
+// Close closes all pooled clients, those in use once released, and rejects further Get() and Acquire() calls.
+// Returns the aggregated error of the clients that fail to close right away.
+func (p *ClientPool) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	errs := []error{}
+	for key, pooled := range p.clients {
+		err := p.retire(key, pooled)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	p.clients = nil
+	p.closed = true
+
+	return utilerrors.NewAggregate(errs)
+}
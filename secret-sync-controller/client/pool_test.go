@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+type fakeClient struct {
+	key    ClientKey
+	closed bool
+}
+
+func (c *fakeClient) Close() error {
+	if c.closed {
+		return fmt.Errorf("client of %s already closed", c.key.Project)
+	}
+	c.closed = true
+	return nil
+}
+
+func newFakePool() (*ClientPool, *int) {
+	created := 0
+	return &ClientPool{
+		New: func(key ClientKey) (io.Closer, error) {
+			created++
+			return &fakeClient{key: key}, nil
+		},
+	}, &created
+}
+
+func TestClientPoolConcurrentGet(t *testing.T) {
+	pool, created := newFakePool()
+
+	keys := []ClientKey{
+		{Project: "project-1"},
+		{Project: "project-2"},
+		{Credentials: "/path/to/credentials.json", Project: "project-1"},
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]io.Closer, len(keys))
+	for i := range keys {
+		results[i] = make([]io.Closer, 50)
+		for j := range results[i] {
+			wg.Add(1)
+			go func(i, j int) {
+				defer wg.Done()
+				client, err := pool.Get(keys[i])
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				results[i][j] = client
+			}(i, j)
+		}
+	}
+	wg.Wait()
+
+	if *created != len(keys) {
+		t.Errorf("Expected %d clients created, but got %d.", len(keys), *created)
+	}
+
+	for i, key := range keys {
+		for _, client := range results[i] {
+			if client != results[i][0] {
+				t.Errorf("Expected the same cached client for %v.", key)
+				break
+			}
+		}
+		if results[i][0].(*fakeClient).key != key {
+			t.Errorf("Expected client for %v, but got %v.", key, results[i][0].(*fakeClient).key)
+		}
+	}
+
+	if results[0][0] == results[2][0] {
+		t.Errorf("Expected different clients for different credentials of the same project.")
+	}
+}
+
+func TestClientPoolClose(t *testing.T) {
+	pool, _ := newFakePool()
+
+	clients := []*fakeClient{}
+	for _, project := range []string{"project-1", "project-2"} {
+		client, err := pool.Get(ClientKey{Project: project})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		clients = append(clients, client.(*fakeClient))
+	}
+
+	err := pool.Close()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	for _, client := range clients {
+		if !client.closed {
+			t.Errorf("Expected client of %s to be closed.", client.key.Project)
+		}
+	}
+
+	_, err = pool.Get(ClientKey{Project: "project-1"})
+	if err == nil {
+		t.Errorf("Expected error getting client from a closed pool.")
+	}
+
+	// closing again should not close the clients twice
+	err = pool.Close()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestClientPoolAcquireVersion(t *testing.T) {
+	pool, created := newFakePool()
+	key := ClientKey{Credentials: "projects/project-1/secrets/credentials"}
+
+	acquire := func(version string, createErr error) (*fakeClient, func(), error) {
+		client, release, err := pool.Acquire(key, version, func() (io.Closer, error) {
+			if createErr != nil {
+				return nil, createErr
+			}
+			return pool.New(key)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return client.(*fakeClient), release, nil
+	}
+
+	v1, releaseV1, err := acquire("1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	again, releaseAgain, err := acquire("1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if again != v1 || *created != 1 {
+		t.Errorf("Expected the cached client of the same version, but got %d clients created.", *created)
+	}
+	releaseAgain()
+
+	// a failed creation keeps the client of the previous version
+	_, _, err = acquire("2", fmt.Errorf("invalid key"))
+	if err == nil {
+		t.Errorf("Expected error creating the client of version 2.")
+	}
+	if v1.closed {
+		t.Errorf("Expected the client of version 1 to be kept.")
+	}
+
+	v2, releaseV2, err := acquire("2", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if v2 == v1 {
+		t.Errorf("Expected a new client for version 2.")
+	}
+	if v1.closed {
+		t.Errorf("Expected the client of version 1 to stay open until released.")
+	}
+
+	// releasing twice should not close the client twice
+	releaseV1()
+	releaseV1()
+	if !v1.closed {
+		t.Errorf("Expected the client of version 1 to be closed once released.")
+	}
+
+	// the client in use when the pool is closed is closed once released
+	err = pool.Close()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if v2.closed {
+		t.Errorf("Expected the client of version 2 to stay open until released.")
+	}
+	releaseV2()
+	if !v2.closed {
+		t.Errorf("Expected the client of version 2 to be closed once released.")
+	}
+}
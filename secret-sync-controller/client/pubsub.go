@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+	"k8s.io/klog"
+	"strings"
+	"time"
+)
+
+const (
+	// eventTypeAttribute is the attribute of Secret Manager notifications holding the event type.
+	eventTypeAttribute = "eventType"
+	// secretIDAttribute is the attribute of Secret Manager notifications holding the secret resource name,
+	// projects/<project-number>/secrets/<secret>.
+	secretIDAttribute = "secretId"
+	// secretVersionAddEvent is the event type of a new secret version.
+	secretVersionAddEvent = "SECRET_VERSION_ADD"
+
+	// pullBatchSize is the maximum number of messages of each pull.
+	pullBatchSize = 100
+	// pullRetryDelay is the delay before pulling again after a failed pull.
+	pullRetryDelay = 10 * time.Second
+)
+
+// PubSubSubscriber receives the Secret Manager notifications published to a Pub/Sub topic,
+// by pulling from Subscription, in format projects/<project>/subscriptions/<subscription>.
+type PubSubSubscriber struct {
+	Service      *pubsub.Service
+	Subscription string
+}
+
+// NewPubSubSubscriber creates a PubSubSubscriber of subscription with opts, using the default credentials if none is given.
+func NewPubSubSubscriber(ctx context.Context, subscription string, opts ...option.ClientOption) (*PubSubSubscriber, error) {
+	service, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &PubSubSubscriber{
+		Service:      service,
+		Subscription: subscription,
+	}, nil
+}
+
+// Receive pulls the notifications until ctx is done, and calls notify with the resource name of the secret of each version added.
+// Messages are acknowledged once notify returns, and other events are acknowledged without notifying.
+// Pull failures are logged and retried after a delay.
+func (s *PubSubSubscriber) Receive(ctx context.Context, notify func(secret string)) error {
+	subscriptions := s.Service.Projects.Subscriptions
+	for {
+		resp, err := subscriptions.Pull(s.Subscription, &pubsub.PullRequest{MaxMessages: pullBatchSize}).Context(ctx).Do()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			klog.Errorf("Fail to pull from %s: %s", s.Subscription, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(pullRetryDelay):
+			}
+			continue
+		}
+
+		ackIDs := []string{}
+		for _, received := range resp.ReceivedMessages {
+			if secret, ok := NotifiedSecret(received.Message); ok {
+				notify(secret)
+			}
+			ackIDs = append(ackIDs, received.AckId)
+		}
+		if len(ackIDs) == 0 {
+			continue
+		}
+
+		_, err = subscriptions.Acknowledge(s.Subscription, &pubsub.AcknowledgeRequest{AckIds: ackIDs}).Context(ctx).Do()
+		if err != nil {
+			// unacknowledged messages are redelivered, which only triggers extra syncs
+			klog.Errorf("Fail to acknowledge %d messages from %s: %s", len(ackIDs), s.Subscription, err)
+		}
+	}
+}
+
+// NotifiedSecret returns the resource name of the secret of a version-added notification of Secret Manager,
+// and false for other events.
+func NotifiedSecret(msg *pubsub.PubsubMessage) (string, bool) {
+	if msg == nil || msg.Attributes[eventTypeAttribute] != secretVersionAddEvent {
+		return "", false
+	}
+	secret := msg.Attributes[secretIDAttribute]
+	if secret == "" {
+		klog.Warningf("Notification %s has no %s attribute", msg.MessageId, secretIDAttribute)
+		return "", false
+	}
+	return secret, true
+}
+
+// ParseSecretName returns the project and the id of the secret resource name projects/<project>/secrets/<secret>.
+func ParseSecretName(name string) (string, string, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[1] == "" || parts[2] != "secrets" || parts[3] == "" {
+		return "", "", fmt.Errorf("Invalid secret name %s, should be in format projects/<project>/secrets/<secret>", name)
+	}
+	return parts[1], parts[3], nil
+}
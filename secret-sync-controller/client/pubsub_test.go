@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"google.golang.org/api/pubsub/v1"
+)
+
+func TestNotifiedSecret(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		msg          *pubsub.PubsubMessage
+		expectSecret string
+		expectOK     bool
+	}{
+		{
+			name: "Version added. Should notify the secret.",
+			msg: &pubsub.PubsubMessage{
+				Attributes: map[string]string{
+					"eventType": "SECRET_VERSION_ADD",
+					"secretId":  "projects/project-1/secrets/gsm-token",
+				},
+			},
+			expectSecret: "projects/project-1/secrets/gsm-token",
+			expectOK:     true,
+		},
+		{
+			name: "Version destroyed. Should not notify.",
+			msg: &pubsub.PubsubMessage{
+				Attributes: map[string]string{
+					"eventType": "SECRET_VERSION_DESTROY",
+					"secretId":  "projects/project-1/secrets/gsm-token",
+				},
+			},
+		},
+		{
+			name: "Version added without secret. Should not notify.",
+			msg: &pubsub.PubsubMessage{
+				Attributes: map[string]string{
+					"eventType": "SECRET_VERSION_ADD",
+				},
+			},
+		},
+		{
+			name: "No attributes. Should not notify.",
+			msg:  &pubsub.PubsubMessage{},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			secret, ok := NotifiedSecret(tc.msg)
+			if secret != tc.expectSecret || ok != tc.expectOK {
+				t.Errorf("Expected (%q, %t), got (%q, %t).", tc.expectSecret, tc.expectOK, secret, ok)
+			}
+		})
+	}
+}
+
+func TestParseSecretName(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		secret        string
+		expectProject string
+		expectID      string
+		expectErr     bool
+	}{
+		{
+			name:          "Valid name.",
+			secret:        "projects/project-1/secrets/gsm-token",
+			expectProject: "project-1",
+			expectID:      "gsm-token",
+		},
+		{
+			name:      "Version name. Should fail.",
+			secret:    "projects/project-1/secrets/gsm-token/versions/1",
+			expectErr: true,
+		},
+		{
+			name:      "Missing project. Should fail.",
+			secret:    "projects//secrets/gsm-token",
+			expectErr: true,
+		},
+		{
+			name:      "Bare secret id. Should fail.",
+			secret:    "gsm-token",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			project, id, err := ParseSecretName(tc.secret)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got none.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if project != tc.expectProject || id != tc.expectID {
+				t.Errorf("Expected %s/%s, got %s/%s.", tc.expectProject, tc.expectID, project, id)
+			}
+		})
+	}
+}
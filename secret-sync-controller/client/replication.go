@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// CheckReplication compares the replica locations of the existing Secret Manager secret specified by project, id
+// with the expected locations, nil for both meaning an automatic replication.
+// Since replication is immutable after creation, a drift is only warned and exported as a metric.
+// Returns true if the replication drifts.
+func CheckReplication(project, id string, locations, expected []string) bool {
+	drift := replicationDrift.WithLabelValues(project, id)
+	if sets.NewString(locations...).Equal(sets.NewString(expected...)) {
+		drift.Set(0)
+		return false
+	}
+
+	klog.Warningf("Replication policy of projects/%s/secrets/%s drifts from the spec: expected %s, but got %s. The secret needs to be recreated manually.",
+		project, id, replicationString(expected), replicationString(locations))
+	drift.Set(1)
+	return true
+}
+
+// ResetReplication drops the replication drift of the Secret Manager secret specified by project, id,
+// e.g. once its replication cannot be checked, so that a stale drift is not reported.
+func ResetReplication(project, id string) {
+	replicationDrift.DeleteLabelValues(project, id)
+}
+
+// replicationPolicy returns the replication policy to the given locations, or the automatic one if no locations are given.
+func replicationPolicy(locations []string) *secretmanagerpb.Replication {
+	if len(locations) == 0 {
+		return &secretmanagerpb.Replication{
+			Replication: &secretmanagerpb.Replication_Automatic_{
+				Automatic: &secretmanagerpb.Replication_Automatic{},
+			},
+		}
+	}
+
+	replicas := []*secretmanagerpb.Replication_UserManaged_Replica{}
+	for _, location := range locations {
+		replicas = append(replicas, &secretmanagerpb.Replication_UserManaged_Replica{
+			Location: location,
+		})
+	}
+	return &secretmanagerpb.Replication{
+		Replication: &secretmanagerpb.Replication_UserManaged_{
+			UserManaged: &secretmanagerpb.Replication_UserManaged{
+				Replicas: replicas,
+			},
+		},
+	}
+}
+
+// replicaLocations returns the replica locations of a user-managed replication, nil for an automatic replication.
+func replicaLocations(replication *secretmanagerpb.Replication) []string {
+	userManaged := replication.GetUserManaged()
+	if userManaged == nil {
+		return nil
+	}
+
+	locations := []string{}
+	for _, replica := range userManaged.GetReplicas() {
+		locations = append(locations, replica.GetLocation())
+	}
+	return locations
+}
+
+// replicationString formats the replica locations of a replication policy.
+func replicationString(locations []string) string {
+	if len(locations) == 0 {
+		return "automatic"
+	}
+	return fmt.Sprintf("user-managed %v", sets.NewString(locations...).List())
+}
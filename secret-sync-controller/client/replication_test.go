@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"reflect"
+	"testing"
+)
+
+func TestCheckReplication(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		locations   []string
+		expected    []string
+		expectDrift bool
+	}{
+		{
+			name:        "Automatic replication as expected. Should not report drift.",
+			locations:   nil,
+			expected:    nil,
+			expectDrift: false,
+		},
+		{
+			name:        "Same locations in different order. Should not report drift.",
+			locations:   []string{"us-west1", "us-east1"},
+			expected:    []string{"us-east1", "us-west1"},
+			expectDrift: false,
+		},
+		{
+			name:        "User-managed replication with automatic replication expected. Should report drift.",
+			locations:   []string{"us-east1"},
+			expected:    nil,
+			expectDrift: true,
+		},
+		{
+			name:        "Automatic replication with user-managed replication expected. Should report drift.",
+			locations:   nil,
+			expected:    []string{"us-east1"},
+			expectDrift: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			drift := CheckReplication("project-1", "secret-1", tc.locations, tc.expected)
+			if drift != tc.expectDrift {
+				t.Errorf("Expected drift %v, but got %v.", tc.expectDrift, drift)
+			}
+
+			expectGauge := 0.0
+			if tc.expectDrift {
+				expectGauge = 1
+			}
+			gauge := testutil.ToFloat64(replicationDrift.WithLabelValues("project-1", "secret-1"))
+			if gauge != expectGauge {
+				t.Errorf("Expected replication drift %v, but got %v.", expectGauge, gauge)
+			}
+		})
+	}
+}
+
+func TestResetReplication(t *testing.T) {
+	CheckReplication("project-1", "deleted-secret", nil, []string{"us-east1"})
+
+	ResetReplication("project-1", "deleted-secret")
+
+	gauge := testutil.ToFloat64(replicationDrift.WithLabelValues("project-1", "deleted-secret"))
+	if gauge != 0 {
+		t.Errorf("Expected the stale replication drift to be reset, but got %v.", gauge)
+	}
+}
+
+func TestReplicaLocations(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		locations []string
+	}{
+		{
+			name:      "Automatic replication.",
+			locations: nil,
+		},
+		{
+			name:      "User-managed replication.",
+			locations: []string{"us-east1", "us-west1"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			locations := replicaLocations(replicationPolicy(tc.locations))
+			if !reflect.DeepEqual(locations, tc.locations) {
+				t.Errorf("Expected locations %v, but got %v.", tc.locations, locations)
+			}
+		})
+	}
+}
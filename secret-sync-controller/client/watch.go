@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"reflect"
+)
+
+// SecretWatcher watches the Kubernetes secrets managed by the secret sync controller, in all namespaces,
+// to tell the controller about the changes made outside of it.
+type SecretWatcher struct {
+	Clientset kubernetes.Interface
+	// Manager is the value of ManagedByLabel of the watched secrets. Defaults to ManagedByValue.
+	Manager string
+}
+
+// Watch watches the managed secrets with an informer until ctx is done,
+// and calls notify with the namespace and name of each secret whose data is changed, or which is deleted.
+// The changes of the labels and annotations only are skipped, e.g. the status annotations written by the controller itself.
+func (w *SecretWatcher) Watch(ctx context.Context, notify func(namespace, name string)) error {
+	manager := managerOrDefault(w.Manager)
+	secrets := w.Clientset.CoreV1().Secrets(v1.NamespaceAll)
+
+	// the informer only lists and watches the managed secrets
+	selector := ManagedByLabel + "=" + manager
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return secrets.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return secrets.Watch(options)
+		},
+	}
+
+	// the label selector is not honored by every clientset, e.g. fake ones
+	managed := func(secret *v1.Secret) bool {
+		return secret.Labels[ManagedByLabel] == manager
+	}
+
+	_, informer := cache.NewInformer(listWatch, &v1.Secret{}, 0, cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, ok := oldObj.(*v1.Secret)
+			if !ok {
+				return
+			}
+			newSecret, ok := newObj.(*v1.Secret)
+			if !ok || !managed(newSecret) {
+				return
+			}
+			if reflect.DeepEqual(oldSecret.Data, newSecret.Data) {
+				return
+			}
+			notify(newSecret.Namespace, newSecret.Name)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			secret, ok := obj.(*v1.Secret)
+			if !ok || !managed(secret) {
+				return
+			}
+			notify(secret.Namespace, secret.Name)
+		},
+	})
+
+	informer.Run(ctx.Done())
+	return nil
+}
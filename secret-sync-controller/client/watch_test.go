@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newWatchedSecret returns the secret namespace/name labeled as managed by manager, unless empty.
+func newWatchedSecret(namespace, name, manager string) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       map[string][]byte{"key-a": []byte("value-a")},
+	}
+	if manager != "" {
+		secret.Labels = map[string]string{ManagedByLabel: manager}
+	}
+	return secret
+}
+
+func TestSecretWatcher(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		mutate        func(clientset kubernetes.Interface) error
+		expectChanged []string
+	}{
+		{
+			name: "Managed secret edited. Should notify.",
+			mutate: func(clientset kubernetes.Interface) error {
+				secret := newWatchedSecret("ns-a", "managed", ManagedByValue)
+				secret.Data["key-a"] = []byte("edited")
+				_, err := clientset.CoreV1().Secrets("ns-a").Update(secret)
+				return err
+			},
+			expectChanged: []string{"ns-a/managed"},
+		},
+		{
+			name: "Managed secret deleted. Should notify.",
+			mutate: func(clientset kubernetes.Interface) error {
+				return clientset.CoreV1().Secrets("ns-a").Delete("managed", &metav1.DeleteOptions{})
+			},
+			expectChanged: []string{"ns-a/managed"},
+		},
+		{
+			name: "Managed secret annotated only. Should not notify.",
+			mutate: func(clientset kubernetes.Interface) error {
+				secret := newWatchedSecret("ns-a", "managed", ManagedByValue)
+				secret.Annotations = map[string]string{LastResultAnnotation: SyncSucceeded}
+				_, err := clientset.CoreV1().Secrets("ns-a").Update(secret)
+				return err
+			},
+			expectChanged: []string{},
+		},
+		{
+			name: "Unmanaged or otherwise managed secrets edited and deleted. Should not notify.",
+			mutate: func(clientset kubernetes.Interface) error {
+				secret := newWatchedSecret("ns-a", "unmanaged", "")
+				secret.Data["key-a"] = []byte("edited")
+				_, err := clientset.CoreV1().Secrets("ns-a").Update(secret)
+				if err != nil {
+					return err
+				}
+				return clientset.CoreV1().Secrets("ns-b").Delete("other", &metav1.DeleteOptions{})
+			},
+			expectChanged: []string{},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(
+				newWatchedSecret("ns-a", "managed", ManagedByValue),
+				newWatchedSecret("ns-a", "unmanaged", ""),
+				newWatchedSecret("ns-b", "other", "other-manager"),
+			)
+			watcher := &SecretWatcher{Clientset: clientset}
+
+			var mutex sync.Mutex
+			changed := []string{}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go watcher.Watch(ctx, func(namespace, name string) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				changed = append(changed, namespace+"/"+name)
+			})
+
+			// give the informer the time to list the secrets before the change
+			time.Sleep(100 * time.Millisecond)
+			err := tc.mutate(clientset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !reflect.DeepEqual(changed, tc.expectChanged) {
+				t.Errorf("Expected changes of %v, but got %v.", tc.expectChanged, changed)
+			}
+		})
+	}
+}
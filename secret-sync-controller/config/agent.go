@@ -14,29 +14,41 @@ limitations under the License.
 package config
 
 // This is a config agent for SecretSyncConfig.
-// It watches the mounted configMap, and updates the SecretSyncConfig accordingly.
+// It watches the mounted configMap, the configMap through the API, or the SecretSync custom resources,
+// and updates the SecretSyncConfig accordingly.
 
 import (
 	"context"
 	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
-	prow "k8s.io/test-infra/prow/config"
-	"path/filepath"
+	"sigs.k8s.io/k8s-gsm-tools/configwatch"
 	"sync"
 )
 
 type Agent struct {
+	// WatchOptions tunes how quickly WatchConfig() picks up a change of the config files.
+	WatchOptions configwatch.Options
+
 	mutex  sync.RWMutex
 	config *SecretSyncConfig
 }
 
-// WatchConfig will begin watching the config file at the provided configPath.
+// WatchConfig will begin watching the config files at the provided configPath, a file, a directory or a glob pattern.
 // If the first load or valiadate fails, WatchConfig will return the error and abort.
 // Future load or valiadate failures will be logged but continue to attempt loading config.
 func (ca *Agent) WatchConfig(configPath string) (func(ctx context.Context), error) {
 	updateFunc := func() error {
 		newConfig := &SecretSyncConfig{}
-		err := newConfig.LoadFrom(configPath)
+		err := newConfig.Load(configPath)
 		if err != nil {
 			return fmt.Errorf("Fail to load config: %s", err)
 		}
@@ -59,20 +71,203 @@ func (ca *Agent) WatchConfig(configPath string) (func(ctx context.Context), erro
 		return nil, err
 	}
 
-	runFunc, err := prow.GetCMMountWatcher(updateFunc, errFunc, filepath.Dir(configPath))
+	runFunc, err := configwatch.Watch(configPath, ca.WatchOptions, updateFunc, errFunc)
 
 	return runFunc, err
 }
 
+// WatchConfigMap will begin watching the ConfigMap namespace/name through the API with an informer, instead of mounting it,
+// see SecretSyncConfig.LoadFromConfigMap().
+// If the first get, load or valiadate fails, WatchConfigMap will return the error and abort.
+// Future load or valiadate failures, or the deletion of the ConfigMap, will be logged and the last valid config is kept.
+func (ca *Agent) WatchConfigMap(clientset kubernetes.Interface, namespace, name string) (func(ctx context.Context), error) {
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+
+	updateFunc := func(configMap *corev1.ConfigMap) error {
+		newConfig := &SecretSyncConfig{}
+		err := newConfig.LoadFromConfigMap(configMap)
+		if err != nil {
+			return fmt.Errorf("Fail to load config: %s", err)
+		}
+
+		err = newConfig.Validate()
+		if err != nil {
+			return fmt.Errorf("Fail to validate config: %s", err)
+		}
+
+		ca.Set(newConfig)
+		return nil
+	}
+
+	configMap, err := configMaps.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Fail to get ConfigMap %s/%s: %s", namespace, name, err)
+	}
+	err = updateFunc(configMap)
+	if err != nil {
+		return nil, err
+	}
+	loadedVersion := configMap.ResourceVersion
+
+	// the informer only lists and watches the ConfigMap namespace/name
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return configMaps.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return configMaps.Watch(options)
+		},
+	}
+
+	onChange := func(obj interface{}) {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		// the field selector is not honored by every clientset, e.g. fake ones
+		if !ok || configMap.Name != name {
+			return
+		}
+		// skip the initial listing of the version loaded above
+		if configMap.ResourceVersion != "" && configMap.ResourceVersion == loadedVersion {
+			return
+		}
+		loadedVersion = configMap.ResourceVersion
+
+		err := updateFunc(configMap)
+		if err != nil {
+			klog.Errorf("Fail to reload ConfigMap %s/%s: %s", namespace, name, err)
+		}
+	}
+
+	onDelete := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok || configMap.Name != name {
+			return
+		}
+		klog.Errorf("ConfigMap %s/%s is deleted. Keeping the last loaded config...", namespace, name)
+	}
+
+	_, informer := cache.NewInformer(listWatch, &corev1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: onChange,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			onChange(newObj)
+		},
+		DeleteFunc: onDelete,
+	})
+
+	runFunc := func(ctx context.Context) {
+		informer.Run(ctx.Done())
+	}
+
+	return runFunc, nil
+}
+
+// WatchSecretSyncs will begin watching the SecretSync custom resources of all namespaces with an informer,
+// reading the source projects allowed by projects only,
+// see SecretSyncResource and SecretSyncConfig.LoadFromSecretSyncs(). No SecretSync objects mean an empty config.
+// If the first list or valiadate fails, WatchSecretSyncs will return the error and abort.
+// The config is reloaded from all objects on each change once the informer has synced.
+// Future valiadate failures, e.g. two objects of a namespace with the same destination, will be logged and the last valid config is kept.
+func (ca *Agent) WatchSecretSyncs(dynamicClient dynamic.Interface, projects SourceProjects) (func(ctx context.Context), error) {
+	secretSyncs := dynamicClient.Resource(SecretSyncResource)
+
+	updateFunc := func(objects []unstructured.Unstructured) error {
+		newConfig := &SecretSyncConfig{}
+		newConfig.LoadFromSecretSyncs(objects, projects)
+		if len(newConfig.Specs) != 0 {
+			err := newConfig.Validate()
+			if err != nil {
+				return fmt.Errorf("Fail to validate config: %s", err)
+			}
+		}
+
+		ca.Set(newConfig)
+		return nil
+	}
+
+	list, err := secretSyncs.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Fail to list %s: %s", SecretSyncResource.Resource, err)
+	}
+	err = updateFunc(list.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return secretSyncs.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return secretSyncs.Watch(options)
+		},
+	}
+
+	var store cache.Store
+	var informer cache.Controller
+	reload := func() {
+		// a partial listing would drop the specs of the objects not listed yet
+		if !informer.HasSynced() {
+			return
+		}
+		objects := []unstructured.Unstructured{}
+		for _, obj := range store.List() {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				objects = append(objects, *u)
+			}
+		}
+		err := updateFunc(objects)
+		if err != nil {
+			klog.Errorf("Fail to reload %s: %s", SecretSyncResource.Resource, err)
+		}
+	}
+
+	store, informer = cache.NewInformer(listWatch, &unstructured.Unstructured{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			reload()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			reload()
+		},
+		DeleteFunc: func(obj interface{}) {
+			reload()
+		},
+	})
+
+	runFunc := func(ctx context.Context) {
+		go informer.Run(ctx.Done())
+		// the changes made while the informer lists the objects are picked up once it has synced
+		if cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			reload()
+		}
+		<-ctx.Done()
+	}
+
+	return runFunc, nil
+}
+
 func (ca *Agent) Config() *SecretSyncConfig {
 	ca.mutex.RLock()
 	defer ca.mutex.RUnlock()
 	return ca.config
 }
 
+// Ready returns an error until a valid config is loaded, for the readiness of the command.
+func (ca *Agent) Ready() error {
+	if ca.Config() == nil {
+		return fmt.Errorf("No valid config loaded")
+	}
+	return nil
+}
+
 func (ca *Agent) Set(newConfig *SecretSyncConfig) {
 	ca.mutex.Lock()
 	defer ca.mutex.Unlock()
 
 	ca.config = newConfig
+	recordConfigReload(newConfig)
 }
@@ -0,0 +1,332 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetUpdatesMetrics(t *testing.T) {
+	agent := &Agent{}
+
+	var testcases = []struct {
+		name     string
+		config   *SecretSyncConfig
+		expected float64
+	}{
+		{
+			name: "Config with two specs.",
+			config: &SecretSyncConfig{
+				Specs: []SecretSyncSpec{{}, {}},
+			},
+			expected: 2,
+		},
+		{
+			name: "Config shrinks to one spec.",
+			config: &SecretSyncConfig{
+				Specs: []SecretSyncSpec{{}},
+			},
+			expected: 1,
+		},
+		{
+			name:     "Empty config.",
+			config:   &SecretSyncConfig{},
+			expected: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			before := float64(time.Now().Unix())
+
+			agent.Set(tc.config)
+
+			specs := testutil.ToFloat64(configSpecs)
+			if specs != tc.expected {
+				t.Errorf("Expected %v specs, but got %v.", tc.expected, specs)
+			}
+
+			reloaded := testutil.ToFloat64(configLastReloadTimestamp)
+			if reloaded < before {
+				t.Errorf("Expected last reload timestamp no earlier than %v, but got %v.", before, reloaded)
+			}
+		})
+	}
+}
+
+func TestWatchConfigMap(t *testing.T) {
+	teamA := `specs:
+- source:
+    project: proj-1
+    secret: secret-1
+  destination:
+    namespace: ns-a
+    secret: secret-a
+    key: key-a
+`
+	teamB := `specs:
+- source:
+    project: proj-2
+    secret: secret-2
+  destination:
+    namespace: ns-b
+    secret: secret-b
+    key: key-b
+`
+	teamBDuplicate := `specs:
+- source:
+    project: proj-2
+    secret: secret-2
+  destination:
+    namespace: ns-a
+    secret: secret-a
+    key: key-a
+`
+	newConfigMap := func(name string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns-config", Name: name},
+			Data:       data,
+		}
+	}
+
+	var testcases = []struct {
+		name          string
+		configMap     *corev1.ConfigMap
+		expectError   bool
+		update        func(configMaps typedcorev1.ConfigMapInterface) error
+		expectSecrets []string
+	}{
+		{
+			name:      "ConfigMap updated. Should reload the specs of its keys in order.",
+			configMap: newConfigMap("config", map[string]string{"syncConfig": teamA}),
+			update: func(configMaps typedcorev1.ConfigMapInterface) error {
+				_, err := configMaps.Update(newConfigMap("config", map[string]string{"b": teamB, "a": teamA}))
+				return err
+			},
+			expectSecrets: []string{"secret-1", "secret-2"},
+		},
+		{
+			name:      "ConfigMap updated with an invalid config. Should keep the last valid config.",
+			configMap: newConfigMap("config", map[string]string{"syncConfig": teamA}),
+			update: func(configMaps typedcorev1.ConfigMapInterface) error {
+				_, err := configMaps.Update(newConfigMap("config", map[string]string{"a": teamA, "b": teamBDuplicate}))
+				return err
+			},
+			expectSecrets: []string{"secret-1"},
+		},
+		{
+			name:      "ConfigMap deleted. Should keep the last valid config.",
+			configMap: newConfigMap("config", map[string]string{"syncConfig": teamA}),
+			update: func(configMaps typedcorev1.ConfigMapInterface) error {
+				return configMaps.Delete("config", &metav1.DeleteOptions{})
+			},
+			expectSecrets: []string{"secret-1"},
+		},
+		{
+			name:      "Another ConfigMap created. Should be ignored.",
+			configMap: newConfigMap("config", map[string]string{"syncConfig": teamA}),
+			update: func(configMaps typedcorev1.ConfigMapInterface) error {
+				_, err := configMaps.Create(newConfigMap("other", map[string]string{"syncConfig": teamB}))
+				return err
+			},
+			expectSecrets: []string{"secret-1"},
+		},
+		{
+			name:        "Missing ConfigMap. Should fail.",
+			configMap:   newConfigMap("other", map[string]string{"syncConfig": teamA}),
+			expectError: true,
+		},
+		{
+			name:        "ConfigMap with an invalid config. Should fail.",
+			configMap:   newConfigMap("config", map[string]string{"a": teamA, "b": teamBDuplicate}),
+			expectError: true,
+		},
+		{
+			name:        "ConfigMap without data. Should fail.",
+			configMap:   newConfigMap("config", nil),
+			expectError: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.configMap)
+			agent := &Agent{}
+
+			runFunc, err := agent.WatchConfigMap(clientset, "ns-config", "config")
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Failed to receive expected error.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go runFunc(ctx)
+
+			err = tc.update(clientset.CoreV1().ConfigMaps("ns-config"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// give the informer the time to deliver the update
+			time.Sleep(100 * time.Millisecond)
+			secrets := []string{}
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				secrets = []string{}
+				for _, spec := range agent.Config().Specs {
+					secrets = append(secrets, spec.Source.Secret)
+				}
+				if reflect.DeepEqual(secrets, tc.expectSecrets) {
+					return
+				}
+			}
+			t.Errorf("Expected specs of %v, but got %v.", tc.expectSecrets, secrets)
+		})
+	}
+}
+
+// newSecretSync returns a SecretSync object namespace/name syncing secret into the destination secret-a/key-a of destNamespace.
+func newSecretSync(namespace, name, secret, destNamespace string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": SecretSyncResource.GroupVersion().String(),
+		"kind":       "SecretSync",
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"project": "proj-1",
+				"secret":  secret,
+			},
+			"destination": map[string]interface{}{
+				"namespace": destNamespace,
+				"secret":    "secret-a",
+				"key":       "key-a",
+			},
+		},
+	}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestWatchSecretSyncs(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		objects       []*unstructured.Unstructured
+		update        func(secretSyncs dynamic.NamespaceableResourceInterface) error
+		expectSecrets []string
+	}{
+		{
+			name:    "SecretSync created in another namespace. Should add its spec.",
+			objects: []*unstructured.Unstructured{newSecretSync("ns-a", "sync", "secret-1", "")},
+			update: func(secretSyncs dynamic.NamespaceableResourceInterface) error {
+				_, err := secretSyncs.Namespace("ns-b").Create(newSecretSync("ns-b", "sync", "secret-2", ""), metav1.CreateOptions{})
+				return err
+			},
+			expectSecrets: []string{"secret-1", "secret-2"},
+		},
+		{
+			name: "SecretSync deleted. Should drop its spec.",
+			objects: []*unstructured.Unstructured{
+				newSecretSync("ns-a", "sync", "secret-1", ""),
+				newSecretSync("ns-b", "sync", "secret-2", ""),
+			},
+			update: func(secretSyncs dynamic.NamespaceableResourceInterface) error {
+				return secretSyncs.Namespace("ns-b").Delete("sync", &metav1.DeleteOptions{})
+			},
+			expectSecrets: []string{"secret-1"},
+		},
+		{
+			name: "SecretSync updated to sync into another namespace. Should skip its spec only.",
+			objects: []*unstructured.Unstructured{
+				newSecretSync("ns-a", "sync", "secret-1", ""),
+				newSecretSync("ns-b", "sync", "secret-2", ""),
+			},
+			update: func(secretSyncs dynamic.NamespaceableResourceInterface) error {
+				_, err := secretSyncs.Namespace("ns-b").Update(newSecretSync("ns-b", "sync", "secret-2", "ns-a"), metav1.UpdateOptions{})
+				return err
+			},
+			expectSecrets: []string{"secret-1"},
+		},
+		{
+			name:    "No SecretSync. Should start empty and add the spec of a created one.",
+			objects: []*unstructured.Unstructured{},
+			update: func(secretSyncs dynamic.NamespaceableResourceInterface) error {
+				_, err := secretSyncs.Namespace("ns-a").Create(newSecretSync("ns-a", "sync", "secret-1", "ns-a"), metav1.CreateOptions{})
+				return err
+			},
+			expectSecrets: []string{"secret-1"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+			secretSyncs := dynamicClient.Resource(SecretSyncResource)
+			for _, obj := range tc.objects {
+				_, err := secretSyncs.Namespace(obj.GetNamespace()).Create(obj, metav1.CreateOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			agent := &Agent{}
+
+			runFunc, err := agent.WatchSecretSyncs(dynamicClient, SourceProjects{"*": {"proj-1"}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if len(agent.Config().Specs) != len(tc.objects) {
+				t.Errorf("Expected %d specs initially, but got %v.", len(tc.objects), agent.Config().Specs)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go runFunc(ctx)
+
+			// give the informer the time to list the objects before the update
+			time.Sleep(100 * time.Millisecond)
+			err = tc.update(secretSyncs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			secrets := []string{}
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				secrets = []string{}
+				for _, spec := range agent.Config().Specs {
+					secrets = append(secrets, spec.Source.Secret)
+				}
+				if reflect.DeepEqual(secrets, tc.expectSecrets) {
+					return
+				}
+			}
+			t.Errorf("Expected specs of %v, but got %v.", tc.expectSecrets, secrets)
+		})
+	}
+}
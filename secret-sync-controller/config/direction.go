@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+)
+
+// Direction selects which way the values of a SecretSyncSpec flow between its Source and its Destination.
+type Direction string
+
+const (
+	// DirectionForward syncs the Secret Manager Source into the Kubernetes Destination. It is the default direction.
+	DirectionForward Direction = "forward"
+	// DirectionReverse syncs the Kubernetes Destination into the Secret Manager Source,
+	// adding a new version of the Secret Manager secret whenever the Kubernetes value changes.
+	DirectionReverse Direction = "reverse"
+	// DirectionBidirectional syncs whichever of the Source and the Destination changed since their last sync into the other,
+	// resolving the changes of both by the ConflictPolicy of the spec.
+	DirectionBidirectional Direction = "bidirectional"
+)
+
+// Validate returns error if the direction is not a known direction.
+func (d Direction) Validate() error {
+	switch d {
+	case "", DirectionForward, DirectionReverse, DirectionBidirectional:
+		return nil
+	}
+	return fmt.Errorf("Unknown direction %q", d)
+}
+
+// Enum returns the known directions, for the config schema.
+func (d Direction) Enum() []string {
+	return []string{string(DirectionForward), string(DirectionReverse), string(DirectionBidirectional)}
+}
+
+// IsReverse returns true if the values flow from the Kubernetes Destination into the Secret Manager Source.
+func (d Direction) IsReverse() bool {
+	return d == DirectionReverse
+}
+
+// WritesSecretManager returns true if the values may flow from the Kubernetes Destination into the Secret Manager Source,
+// i.e. the Kubernetes secret is a source of the spec.
+func (d Direction) WritesSecretManager() bool {
+	return d == DirectionReverse || d == DirectionBidirectional
+}
+
+// ConflictPolicy selects which side of a bidirectional spec wins if both changed since their last sync.
+type ConflictPolicy string
+
+const (
+	// ConflictGSMWins syncs the Secret Manager Source into the Kubernetes Destination. It is the default policy.
+	ConflictGSMWins ConflictPolicy = "gsm-wins"
+	// ConflictK8sWins syncs the Kubernetes Destination into the Secret Manager Source.
+	ConflictK8sWins ConflictPolicy = "k8s-wins"
+	// ConflictNewestWins syncs the side written last into the other,
+	// by the create time of the latest Secret Manager version and the update time of the Kubernetes secret.
+	ConflictNewestWins ConflictPolicy = "newest-wins"
+)
+
+// Validate returns error if the policy is not a known conflict policy.
+func (p ConflictPolicy) Validate() error {
+	switch p {
+	case "", ConflictGSMWins, ConflictK8sWins, ConflictNewestWins:
+		return nil
+	}
+	return fmt.Errorf("Unknown conflict policy %q", p)
+}
+
+// Enum returns the known conflict policies, for the config schema.
+func (p ConflictPolicy) Enum() []string {
+	return []string{string(ConflictGSMWins), string(ConflictK8sWins), string(ConflictNewestWins)}
+}
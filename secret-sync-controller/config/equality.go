@@ -0,0 +1,100 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
+)
+
+// EqualityMode selects how a source value is compared with its destination value,
+// so that the destination is only written if their normalized forms differ.
+type EqualityMode string
+
+const (
+	// EqualityExact compares the values byte for byte. It is the default mode.
+	EqualityExact EqualityMode = "exact"
+	// EqualityJSONCanonical compares the JSON values regardless of their white spaces and the order of their object keys.
+	EqualityJSONCanonical EqualityMode = "json-canonical"
+	// EqualityTrim compares the values regardless of their leading and trailing white spaces, e.g. in PEM blocks.
+	EqualityTrim EqualityMode = "trim"
+)
+
+// Validate returns error if the mode is not a known equality mode.
+func (m EqualityMode) Validate() error {
+	switch m {
+	case "", EqualityExact, EqualityJSONCanonical, EqualityTrim:
+		return nil
+	}
+	return fmt.Errorf("Unknown equality mode %q", m)
+}
+
+// Enum returns the known equality modes, for the config schema.
+func (m EqualityMode) Enum() []string {
+	return []string{string(EqualityExact), string(EqualityJSONCanonical), string(EqualityTrim)}
+}
+
+// Normalize returns the canonical form of data under the mode, written into the destination.
+// The canonical JSON is compact with its object keys sorted, so that the same value is always written the same.
+// Returns error if data cannot be normalized, e.g. invalid JSON. The errors never hold data.
+func (m EqualityMode) Normalize(data []byte) ([]byte, error) {
+	switch m {
+	case "", EqualityExact:
+		return data, nil
+	case EqualityTrim:
+		return bytes.TrimSpace(data), nil
+	case EqualityJSONCanonical:
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		// keep the numbers as written, instead of rounding them through float64
+		decoder.UseNumber()
+		err := decoder.Decode(&value)
+		if err == nil && decoder.More() {
+			err = fmt.Errorf("unexpected data after the JSON value")
+		}
+		if err != nil {
+			return nil, redact.Error(err, data)
+		}
+
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		err = encoder.Encode(value)
+		if err != nil {
+			return nil, redact.Error(err, data)
+		}
+		// Encode terminates the value with a newline
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+	return nil, m.Validate()
+}
+
+// Equal returns true if a and b are equal under the mode.
+// Values that cannot be normalized, e.g. a destination that is not valid JSON, are only equal byte for byte.
+func (m EqualityMode) Equal(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	normalizedA, err := m.Normalize(a)
+	if err != nil {
+		return false
+	}
+	normalizedB, err := m.Normalize(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(normalizedA, normalizedB)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		mode      EqualityMode
+		data      string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "Default mode. Should keep the value.",
+			mode:     "",
+			data:     " value\n",
+			expected: " value\n",
+		},
+		{
+			name:     "Exact. Should keep the value.",
+			mode:     EqualityExact,
+			data:     " value\n",
+			expected: " value\n",
+		},
+		{
+			name:     "Trim.",
+			mode:     EqualityTrim,
+			data:     "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n\n",
+			expected: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----",
+		},
+		{
+			name:     "Canonical JSON. Should sort the keys and drop the white spaces.",
+			mode:     EqualityJSONCanonical,
+			data:     "{\n  \"b\": [1, 2.50, {\"d\": 1, \"c\": 2}],\n  \"a\": \"<&>\"\n}\n",
+			expected: `{"a":"<&>","b":[1,2.50,{"c":2,"d":1}]}`,
+		},
+		{
+			name:      "Invalid JSON.",
+			mode:      EqualityJSONCanonical,
+			data:      `{"a": `,
+			expectErr: true,
+		},
+		{
+			name:      "Trailing data after JSON.",
+			mode:      EqualityJSONCanonical,
+			data:      `{"a": 1} {"b": 2}`,
+			expectErr: true,
+		},
+		{
+			name:      "Unknown mode.",
+			mode:      "yaml",
+			data:      "a: 1",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			normalized, err := tc.mode.Normalize([]byte(tc.data))
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, but got %q.", normalized)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(normalized) != tc.expected {
+				t.Errorf("Expected %q, but got %q.", tc.expected, normalized)
+			}
+
+			// the canonical form is stable, so that it is never rewritten
+			again, err := tc.mode.Normalize(normalized)
+			if err != nil || string(again) != string(normalized) {
+				t.Errorf("Expected %q to be stable, but got %q: %v.", normalized, again, err)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	var testcases = []struct {
+		name     string
+		mode     EqualityMode
+		a        string
+		b        string
+		expected bool
+	}{
+		{
+			name:     "Exact with trailing newline.",
+			mode:     EqualityExact,
+			a:        "value",
+			b:        "value\n",
+			expected: false,
+		},
+		{
+			name:     "Trim with trailing newline.",
+			mode:     EqualityTrim,
+			a:        "value",
+			b:        "value\n",
+			expected: true,
+		},
+		{
+			name:     "Canonical JSON with reordered keys.",
+			mode:     EqualityJSONCanonical,
+			a:        `{"a": 1, "b": 2}`,
+			b:        "{\n  \"b\": 2,\n  \"a\": 1\n}",
+			expected: true,
+		},
+		{
+			name:     "Canonical JSON with different values.",
+			mode:     EqualityJSONCanonical,
+			a:        `{"a": 1, "b": 2}`,
+			b:        `{"a": 1, "b": 3}`,
+			expected: false,
+		},
+		{
+			name:     "Canonical JSON against invalid JSON.",
+			mode:     EqualityJSONCanonical,
+			a:        `{"a": 1}`,
+			b:        `{"a": 1`,
+			expected: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			if equal := tc.mode.Equal([]byte(tc.a), []byte(tc.b)); equal != tc.expected {
+				t.Errorf("Expected %v, but got %v.", tc.expected, equal)
+			}
+		})
+	}
+}
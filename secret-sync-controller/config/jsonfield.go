@@ -0,0 +1,51 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Extract returns the value of the field JSONField of the JSON object data, or data itself if JSONField is empty.
+// String fields are returned unquoted, and other fields in their compact JSON encoding, e.g. a nested object.
+// Returns error if data is not a JSON object, or the field is missing or null. The errors never hold data.
+func (gsm SecretManagerSpec) Extract(data []byte) ([]byte, error) {
+	if gsm.JSONField == "" {
+		return data, nil
+	}
+
+	fields := make(map[string]json.RawMessage)
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		// the syntax errors quote the offending characters of data
+		return nil, fmt.Errorf("Value is not a JSON object")
+	}
+	field, ok := fields[gsm.JSONField]
+	if !ok || bytes.Equal(field, []byte("null")) {
+		return nil, fmt.Errorf("Field %q not found", gsm.JSONField)
+	}
+
+	var str string
+	if json.Unmarshal(field, &str) == nil {
+		return []byte(str), nil
+	}
+	var buf bytes.Buffer
+	err = json.Compact(&buf, field)
+	if err != nil {
+		return nil, fmt.Errorf("Field %q is not valid JSON", gsm.JSONField)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		field     string
+		data      string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "No field. Should return the whole value.",
+			field:    "",
+			data:     "not JSON",
+			expected: "not JSON",
+		},
+		{
+			name:     "String field.",
+			field:    "user",
+			data:     `{"user": "admin", "pass": "p@ss\n"}`,
+			expected: "admin",
+		},
+		{
+			name:     "String field with escapes. Should be unquoted.",
+			field:    "pass",
+			data:     `{"user": "admin", "pass": "p@ss\n"}`,
+			expected: "p@ss\n",
+		},
+		{
+			name:     "Number field. Should keep the number as written.",
+			field:    "port",
+			data:     `{"port": 5432}`,
+			expected: "5432",
+		},
+		{
+			name:     "Object field. Should be compact JSON.",
+			field:    "tls",
+			data:     `{"tls": { "ca": "ca-value", "verify": true }}`,
+			expected: `{"ca":"ca-value","verify":true}`,
+		},
+		{
+			name:      "Missing field.",
+			field:     "user",
+			data:      `{"pass": "secret-value"}`,
+			expectErr: true,
+		},
+		{
+			name:      "Null field.",
+			field:     "user",
+			data:      `{"user": null}`,
+			expectErr: true,
+		},
+		{
+			name:      "JSON array.",
+			field:     "user",
+			data:      `["secret-value"]`,
+			expectErr: true,
+		},
+		{
+			name:      "Invalid JSON.",
+			field:     "user",
+			data:      `{"user": secret-value}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			gsm := SecretManagerSpec{Project: "proj-1", Secret: "secret-1", JSONField: tc.field}
+			actual, err := gsm.Extract([]byte(tc.data))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error but got %q.", actual)
+				}
+				if strings.Contains(err.Error(), "secret-value") {
+					t.Errorf("Error holds the secret value: %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !bytes.Equal(actual, []byte(tc.expected)) {
+				t.Errorf("Expected %q, got %q.", tc.expected, actual)
+			}
+		})
+	}
+}
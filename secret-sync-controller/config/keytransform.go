@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// KeyTransform renames the fields of a JSON source mirrored by a SecretSyncSpec into the keys of its destination,
+// bridging the naming conventions of Secret Manager JSON documents and of the Kubernetes consumers.
+type KeyTransform string
+
+const (
+	// KeyTransformAsIs keeps the field names as keys. It is the default transform.
+	KeyTransformAsIs KeyTransform = "as-is"
+	// KeyTransformUpperSnake renames the fields into upper snake case, e.g. apiKey into API_KEY, as expected of environment variables.
+	KeyTransformUpperSnake KeyTransform = "upper-snake"
+	// KeyTransformLowerKebab renames the fields into lower kebab case, e.g. apiKey into api-key.
+	KeyTransformLowerKebab KeyTransform = "lower-kebab"
+)
+
+// Validate returns error if the transform is not a known key transform.
+func (t KeyTransform) Validate() error {
+	switch t {
+	case "", KeyTransformAsIs, KeyTransformUpperSnake, KeyTransformLowerKebab:
+		return nil
+	}
+	return fmt.Errorf("Unknown key transform %q", t)
+}
+
+// Enum returns the known key transforms, for the config schema.
+func (t KeyTransform) Enum() []string {
+	return []string{string(KeyTransformAsIs), string(KeyTransformUpperSnake), string(KeyTransformLowerKebab)}
+}
+
+// Apply returns the key of field. The words of field are split at the changes of case,
+// e.g. apiKey or APIKey into api and Key, and at any character other than a letter or a digit, e.g. api_key or api.key.
+func (t KeyTransform) Apply(field string) string {
+	switch t {
+	case KeyTransformUpperSnake:
+		return strings.ToUpper(strings.Join(words(field), "_"))
+	case KeyTransformLowerKebab:
+		return strings.ToLower(strings.Join(words(field), "-"))
+	}
+	return field
+}
+
+// words splits field into its words for KeyTransform.Apply().
+func words(field string) []string {
+	runes := []rune(field)
+	words := []string{}
+	start := -1
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start >= 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			// a lower case letter or a digit ends a word, e.g. api|Key, and so does the last capital of an acronym, e.g. API|Key
+			if !unicode.IsUpper(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
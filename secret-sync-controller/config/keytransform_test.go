@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+)
+
+func TestKeyTransformApply(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		transform KeyTransform
+		field     string
+		expected  string
+	}{
+		{
+			name:      "Default transform. Should keep the field.",
+			transform: "",
+			field:     "apiKey",
+			expected:  "apiKey",
+		},
+		{
+			name:      "As-is. Should keep the field.",
+			transform: KeyTransformAsIs,
+			field:     "api.key",
+			expected:  "api.key",
+		},
+		{
+			name:      "Upper snake of camel case.",
+			transform: KeyTransformUpperSnake,
+			field:     "apiKey",
+			expected:  "API_KEY",
+		},
+		{
+			name:      "Upper snake of an acronym.",
+			transform: KeyTransformUpperSnake,
+			field:     "DBHost2Name",
+			expected:  "DB_HOST2_NAME",
+		},
+		{
+			name:      "Upper snake of separated words.",
+			transform: KeyTransformUpperSnake,
+			field:     "db.host-name",
+			expected:  "DB_HOST_NAME",
+		},
+		{
+			name:      "Lower kebab of camel case.",
+			transform: KeyTransformLowerKebab,
+			field:     "apiKey",
+			expected:  "api-key",
+		},
+		{
+			name:      "Lower kebab of upper snake case.",
+			transform: KeyTransformLowerKebab,
+			field:     "API_KEY",
+			expected:  "api-key",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			if err := tc.transform.Validate(); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			actual := tc.transform.Apply(tc.field)
+			if actual != tc.expected {
+				t.Errorf("Expected %s, but got %s.", tc.expected, actual)
+			}
+		})
+	}
+}
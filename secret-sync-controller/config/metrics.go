@@ -0,0 +1,45 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics of the loaded config, updated by Agent.Set().
+// Operators can alert on an unexpected drop in the number of specs, e.g. after a bad config push.
+var (
+	configSpecs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "secret_sync_config_specs",
+		Help: "Number of specs in the config currently loaded by the secret sync controller.",
+	})
+	configLastReloadTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "secret_sync_config_last_reload_timestamp",
+		Help: "Unix timestamp of the last config reload of the secret sync controller.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configSpecs, configLastReloadTimestamp)
+}
+
+// recordConfigReload updates the config metrics with the newly loaded config.
+func recordConfigReload(newConfig *SecretSyncConfig) {
+	specs := 0
+	if newConfig != nil {
+		specs = len(newConfig.Specs)
+	}
+	configSpecs.Set(float64(specs))
+	configLastReloadTimestamp.SetToCurrentTime()
+}
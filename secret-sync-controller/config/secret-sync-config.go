@@ -16,10 +16,24 @@ package config
 // Package config defines configuration and sync-pair structs
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sigs.k8s.io/k8s-gsm-tools/configwatch"
+	"sigs.k8s.io/k8s-gsm-tools/gsmoption"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Structs for secret sync configuration
@@ -27,20 +41,205 @@ type SecretSyncConfig struct {
 	Specs []SecretSyncSpec `yaml:"specs"`
 }
 
+// MirrorDataKey is the key of the source value mirrored into the destination secret of a spec if the value is not a JSON object,
+// see SecretSyncSpec.MirrorPairs().
+const MirrorDataKey = "data"
+
 type SecretSyncSpec struct {
-	Source      SecretManagerSpec `yaml:"source"`
+	// Name is an optional stable identifier of the spec, unique within the config, referenced by DependsOn of other specs.
+	Name        string            `yaml:"name,omitempty"`
+	Source      SecretManagerSpec `yaml:"source,omitempty"`
 	Destination KubernetesSpec    `yaml:"destination"`
+	// Mappings syncs multiple Secret Manager secrets into named keys of the single Destination secret.
+	// If specified, Source and Destination.Key should be left empty.
+	Mappings []KeyMapping `yaml:"mappings,omitempty"`
+	// Keys syncs Source into each of the named keys of the Destination secret, e.g. a token consumed under several names.
+	// If specified, Destination.Key should be left empty.
+	Keys []string `yaml:"keys,omitempty"`
+	// KeyMap syncs the fields of the JSON object value of Source into the keys of the Destination secret they map to,
+	// e.g. {user: username, pass: password}. If specified, Destination.Key should be left empty.
+	KeyMap map[string]string `yaml:"keyMap,omitempty"`
+	// IncludeKeys restricts the fields of a JSON source mirrored without Destination.Key to the named top-level fields,
+	// so that unrelated fields never leak into the destination. All fields are mirrored if empty. See MirrorPairs().
+	IncludeKeys []string `yaml:"includeKeys,omitempty"`
+	// ExcludeKeys leaves the named top-level fields of a JSON source mirrored without Destination.Key out of the destination.
+	ExcludeKeys []string `yaml:"excludeKeys,omitempty"`
+	// KeyTransform renames the fields of a JSON source mirrored without Destination.Key into the keys of the destination,
+	// e.g. apiKey into API_KEY with KeyTransformUpperSnake. The key MirrorDataKey of other values is kept. Defaults to KeyTransformAsIs.
+	KeyTransform KeyTransform `yaml:"keyTransform,omitempty"`
+	// CredentialsFrom is a Secret Manager secret holding the service account key JSON used to read the sources,
+	// e.g. for cross-org access. The secret itself is read with the default credentials.
+	CredentialsFrom *SecretManagerSpec `yaml:"credentialsFrom,omitempty"`
+	// Transforms are applied in order to each source value before it is compared with and written into the destination.
+	Transforms []Transform `yaml:"transforms,omitempty"`
+	// DependsOn lists the names of the specs synced before this one in each cycle,
+	// e.g. a CA secret referenced by the leaf certificates of this spec.
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+	// MirrorLabels stamps the labels of the Secret Manager sources onto the destination secret, for discoverability,
+	// e.g. owner or env. Labels removed from the sources are left on the destination secret.
+	MirrorLabels bool `yaml:"mirrorLabels,omitempty"`
+	// MirrorLabelsFilter selects the mirrored labels if MirrorLabels is set. All labels are mirrored if empty.
+	MirrorLabelsFilter LabelFilter `yaml:"mirrorLabelsFilter,omitempty"`
+	// EqualityMode selects how the source values, after Transforms, are compared with the destination values,
+	// so that a destination canonicalized by its consumers is not rewritten needlessly.
+	// The normalized form of the source values is written into the destination. Defaults to EqualityExact.
+	EqualityMode EqualityMode `yaml:"equalityMode,omitempty"`
+	// WriteWindow restricts the writes into the destination to a recurring maintenance window.
+	// The changes detected while the window is closed are held until it opens. Writes are never deferred if nil.
+	WriteWindow *WriteWindow `yaml:"writeWindow,omitempty"`
+	// Direction reverses the sync if set to DirectionReverse: the Kubernetes secret keys of Destination are read,
+	// and their values are added as new versions of the Secret Manager secrets of Source. Defaults to DirectionForward.
+	Direction Direction `yaml:"direction,omitempty"`
+	// ConflictPolicy resolves the changes of both sides of a bidirectional spec. Defaults to ConflictGSMWins.
+	ConflictPolicy ConflictPolicy `yaml:"conflictPolicy,omitempty"`
+	// Replication is the replication policy of the Secret Manager secrets created by a reverse or bidirectional spec.
+	// The replication of the existing secrets is checked against it, see client.CheckReplication().
+	Replication ReplicationSpec `yaml:"replication,omitempty"`
+}
+
+// ReplicationSpec specifies the replication policy of a Secret Manager secret.
+// The secret is replicated automatically if no Locations are specified.
+// Note that the replication policy of a secret is immutable after creation.
+type ReplicationSpec struct {
+	Locations []string `yaml:"locations,omitempty"`
+}
+
+// LabelFilter selects labels by key with glob patterns, e.g. "team-*".
+// A label is selected if its key matches any of Include, or Include is empty, and none of Exclude.
+type LabelFilter struct {
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// Match returns true if the label key is selected by the filter.
+func (f LabelFilter) Match(key string) bool {
+	included := len(f.Include) == 0
+	for _, pattern := range f.Include {
+		if ok, _ := path.Match(pattern, key); ok {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range f.Exclude {
+		if ok, _ := path.Match(pattern, key); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate returns error if any pattern of the filter is malformed.
+func (f LabelFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// KeyMapping specifies the Source of a single Key in the destination secret of a SecretSyncSpec.
+type KeyMapping struct {
+	Source SecretManagerSpec `yaml:"source"`
+	Key    string            `yaml:"key"`
 }
 
 type KubernetesSpec struct {
+	// Namespace is either a namespace or a glob pattern, e.g. team-*, syncing into all the matching namespaces.
 	Namespace string `yaml:"namespace"`
-	Secret    string `yaml:"secret"`
-	Key       string `yaml:"key"`
+	// NamespaceRegex is a regular expression matching whole namespaces, syncing into all of them, in place of Namespace.
+	NamespaceRegex string `yaml:"namespaceRegex,omitempty"`
+	Secret         string `yaml:"secret"`
+	// Key is left empty with the Mappings of a SecretSyncSpec,
+	// or to mirror the whole source into the secret, see SecretSyncSpec.MirrorsSecret().
+	Key string `yaml:"key,omitempty"`
+	// StringData writes the secret values through the stringData field instead of the binary data field,
+	// for human-readable values. Values that are not valid UTF-8 are still written as binary data.
+	StringData bool `yaml:"stringData,omitempty"`
+	// Resource writes the keys into a custom resource, e.g. of the External Secrets Operator,
+	// instead of a core v1 Secret. Secret then names the custom resource object.
+	Resource ResourceSpec `yaml:"resource,omitempty"`
+	// OwnerRef stamps an owner reference onto the destination secret created by the controller,
+	// so that it is garbage collected once the owner is deleted.
+	OwnerRef *OwnerReference `yaml:"ownerRef,omitempty"`
+	// EnvelopeEncrypt stores the secret values encrypted with a Cloud KMS key instead of in plaintext,
+	// for defense-in-depth in clusters without etcd encryption. The consumers decrypt them, e.g. in an init container.
+	EnvelopeEncrypt *EnvelopeEncryption `yaml:"envelopeEncrypt,omitempty"`
+}
+
+// EnvelopeEncryption specifies the Cloud KMS key encrypting the values of a destination secret.
+type EnvelopeEncryption struct {
+	// KMSKey is the Cloud KMS key, in format projects/<project>/locations/<location>/keyRings/<keyRing>/cryptoKeys/<key>.
+	KMSKey string `yaml:"kmsKey"`
+}
+
+// OwnerReference specifies the object owning a destination secret, in the namespace of the secret.
+type OwnerReference struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+}
+
+// ResourceSpec specifies a custom resource destination, written through the dynamic client.
+// Each key is written base64 encoded into the field FieldPath.<key> of the object.
+type ResourceSpec struct {
+	Group    string `yaml:"group,omitempty"`
+	Version  string `yaml:"version"`
+	Resource string `yaml:"resource"`
+	// Kind is needed to create the object if it does not exist.
+	Kind string `yaml:"kind"`
+	// FieldPath is the dot-separated path of the object field holding the keys, e.g. spec.data.
+	FieldPath string `yaml:"fieldPath"`
 }
 
 type SecretManagerSpec struct {
 	Project string `yaml:"project"`
 	Secret  string `yaml:"secret"`
+	// MinLength is the minimum length in bytes of the secret value, before any transform.
+	// A shorter value, e.g. truncated upstream, is refused and the destination keeps its previous value.
+	MinLength int `yaml:"minLength,omitempty"`
+	// JSONField selects a top-level field of the secret value, which is then a JSON object, e.g. user of {"user": ..., "pass": ...},
+	// so that the fields of a single secret can be synced into several keys with Mappings. The whole value is synced if empty.
+	JSONField string `yaml:"jsonField,omitempty"`
+}
+
+// SpecID identifies a SecretSyncSpec by its destination secret keys, which are unique within a valid config.
+// It is comparable, and should be used as map key instead of formatted strings, which may collide.
+type SpecID struct {
+	Namespace string
+	Secret    string
+	// Key is the destination key, empty for the specs with key mappings.
+	Key string
+	// Keys is the JSON array of the sorted destination keys of the key mappings, empty otherwise.
+	// Unlike joined keys, it is unambiguous, e.g. for the keys of custom resource destinations, which may hold any character.
+	Keys string `json:",omitempty"`
+	// Resource is the group/version/resource of a custom resource destination, empty for a core v1 Secret.
+	Resource string `json:",omitempty"`
+}
+
+func (id SpecID) String() string {
+	key := strings.Join(id.DestinationKeys(), ",")
+	if id.Resource != "" {
+		return fmt.Sprintf("%s/namespaces/%s/%s[%s]", id.Resource, id.Namespace, id.Secret, key)
+	}
+	return fmt.Sprintf("namespaces/%s/secrets/%s[%s]", id.Namespace, id.Secret, key)
+}
+
+// DestinationKeys returns the destination keys of the spec, sorted, or nil if the spec mirrors its source.
+func (id SpecID) DestinationKeys() []string {
+	if id.Keys != "" {
+		var keys []string
+		// Keys is only encoded by SecretSyncSpec.ID()
+		_ = json.Unmarshal([]byte(id.Keys), &keys)
+		return keys
+	}
+	if id.Key != "" {
+		return []string{id.Key}
+	}
+	return nil
 }
 
 func (config SecretSyncConfig) String() string {
@@ -48,13 +247,428 @@ func (config SecretSyncConfig) String() string {
 	return string(d)
 }
 func (spec SecretSyncSpec) String() string {
-	return fmt.Sprintf("{%s -> %s}", spec.Source, spec.Destination)
+	arrow := "->"
+	switch spec.Direction {
+	case DirectionReverse:
+		arrow = "<-"
+	case DirectionBidirectional:
+		arrow = "<->"
+	}
+	if mappings := spec.KeyMappings(); len(mappings) != 0 {
+		return fmt.Sprintf("{%v %s Kubernetes:/namespaces/%s/secrets/%s}", mappings, arrow, spec.Destination.namespace(), spec.Destination.Secret)
+	}
+	return fmt.Sprintf("{%s %s %s}", spec.Source, arrow, spec.Destination)
+}
+func (mapping KeyMapping) String() string {
+	return fmt.Sprintf("%s -> [%s]", mapping.Source, mapping.Key)
 }
 func (gsm SecretManagerSpec) String() string {
+	if gsm.JSONField != "" {
+		return fmt.Sprintf("SecretManager:/projects/%s/secrets/%s#%s", gsm.Project, gsm.Secret, gsm.JSONField)
+	}
 	return fmt.Sprintf("SecretManager:/projects/%s/secrets/%s", gsm.Project, gsm.Secret)
 }
 func (k8s KubernetesSpec) String() string {
-	return fmt.Sprintf("Kubernetes:/namespaces/%s/secrets/%s[%s]", k8s.Namespace, k8s.Secret, k8s.Key)
+	if k8s.Resource.IsSet() {
+		return fmt.Sprintf("Kubernetes:/%s/namespaces/%s/%s[%s]", k8s.Resource, k8s.namespace(), k8s.Secret, k8s.Key)
+	}
+	return fmt.Sprintf("Kubernetes:/namespaces/%s/secrets/%s[%s]", k8s.namespace(), k8s.Secret, k8s.Key)
+}
+
+// namespace returns the namespace or the namespace pattern of k8s, with a regular expression rendered as ~<regex>.
+func (k8s KubernetesSpec) namespace() string {
+	if k8s.NamespaceRegex != "" {
+		return "~" + k8s.NamespaceRegex
+	}
+	return k8s.Namespace
+}
+
+// HasNamespacePattern returns true if the destination is in any number of namespaces,
+// i.e. Namespace is a glob pattern or NamespaceRegex is set.
+func (k8s KubernetesSpec) HasNamespacePattern() bool {
+	return k8s.NamespaceRegex != "" || strings.ContainsAny(k8s.Namespace, "*?[")
+}
+
+// namespaceMatcher returns the function matching the namespaces of the namespace pattern of k8s,
+// or error if the pattern is malformed.
+func (k8s KubernetesSpec) namespaceMatcher() (func(namespace string) bool, error) {
+	if k8s.NamespaceRegex != "" {
+		// the whole namespace matches, as with the glob patterns
+		re, err := regexp.Compile("^(?:" + k8s.NamespaceRegex + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(k8s.Namespace, ""); err != nil {
+		return nil, err
+	}
+	return func(namespace string) bool {
+		ok, _ := path.Match(k8s.Namespace, namespace)
+		return ok
+	}, nil
+}
+func (res ResourceSpec) String() string {
+	if !res.IsSet() {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s", res.Group, res.Version, res.Resource)
+}
+
+// IsSet returns true if the ResourceSpec specifies a custom resource destination.
+func (res ResourceSpec) IsSet() bool {
+	return res != ResourceSpec{}
+}
+
+// GroupVersionResource returns the GVR of the custom resource for the dynamic client.
+func (res ResourceSpec) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    res.Group,
+		Version:  res.Version,
+		Resource: res.Resource,
+	}
+}
+
+// Fields returns the path of the object field holding key.
+func (res ResourceSpec) Fields(key string) []string {
+	return append(strings.Split(res.FieldPath, "."), key)
+}
+
+func (owner OwnerReference) String() string {
+	return fmt.Sprintf("%s %s/%s", owner.APIVersion, owner.Kind, owner.Name)
+}
+
+// GroupVersionResource returns the GVR of the owner for the dynamic client, guessed from its kind,
+// e.g. deployments for a Deployment.
+func (owner OwnerReference) GroupVersionResource() schema.GroupVersionResource {
+	gv, _ := schema.ParseGroupVersion(owner.APIVersion)
+	gvr, _ := meta.UnsafeGuessKindToResource(gv.WithKind(owner.Kind))
+	return gvr
+}
+
+// Validate returns error if the OwnerReference is incomplete or malformed.
+func (owner OwnerReference) Validate() error {
+	switch {
+	case owner.APIVersion == "":
+		return fmt.Errorf("Missing <apiVersion> field")
+	case owner.Kind == "":
+		return fmt.Errorf("Missing <kind> field")
+	case owner.Name == "":
+		return fmt.Errorf("Missing <name> field")
+	}
+
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil || gv.Version == "" {
+		return fmt.Errorf("Invalid <apiVersion> %s", owner.APIVersion)
+	}
+	if errs := validation.IsDNS1123Subdomain(owner.Name); len(errs) > 0 {
+		return fmt.Errorf("Invalid <name> %s: %s", owner.Name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Validate returns error if the KMSKey is missing or not a Cloud KMS key resource name.
+func (e EnvelopeEncryption) Validate() error {
+	if e.KMSKey == "" {
+		return fmt.Errorf("Missing <kmsKey> field")
+	}
+	parts := strings.Split(e.KMSKey, "/")
+	if len(parts) != 8 || parts[0] != "projects" || parts[2] != "locations" || parts[4] != "keyRings" || parts[6] != "cryptoKeys" {
+		return fmt.Errorf("Invalid <kmsKey> %s: should be in format projects/<project>/locations/<location>/keyRings/<keyRing>/cryptoKeys/<key>", e.KMSKey)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("Invalid <kmsKey> %s: empty segment", e.KMSKey)
+		}
+	}
+	return nil
+}
+
+// Validate returns error if the ResourceSpec is incomplete or its FieldPath is invalid.
+func (res ResourceSpec) Validate() error {
+	switch {
+	case res.Version == "":
+		return fmt.Errorf("Missing <version> field")
+	case res.Resource == "":
+		return fmt.Errorf("Missing <resource> field")
+	case res.Kind == "":
+		return fmt.Errorf("Missing <kind> field")
+	case res.FieldPath == "":
+		return fmt.Errorf("Missing <fieldPath> field")
+	}
+
+	fields := strings.Split(res.FieldPath, ".")
+	for _, field := range fields {
+		if field == "" {
+			return fmt.Errorf("Empty field in <fieldPath> %s", res.FieldPath)
+		}
+	}
+	switch fields[0] {
+	case "apiVersion", "kind", "metadata":
+		return fmt.Errorf("<fieldPath> %s cannot overwrite the object %s", res.FieldPath, fields[0])
+	}
+
+	return nil
+}
+
+// ID returns the SpecID identifying the spec.
+func (spec SecretSyncSpec) ID() SpecID {
+	id := SpecID{
+		Namespace: spec.Destination.Namespace,
+		Secret:    spec.Destination.Secret,
+		Key:       spec.Destination.Key,
+		Resource:  spec.Destination.Resource.String(),
+	}
+	if mappings := spec.KeyMappings(); len(mappings) != 0 {
+		// sorted, so that the same keys identify the same spec in any order
+		keys := []string{}
+		for _, mapping := range mappings {
+			keys = append(keys, mapping.Key)
+		}
+		sort.Strings(keys)
+		encoded, _ := json.Marshal(keys)
+		id.Keys = string(encoded)
+	}
+	return id
+}
+
+// MirrorsSecret returns true if the spec mirrors its whole Source into the Destination secret,
+// as neither Destination.Key nor Mappings are set. See MirrorPairs().
+func (spec SecretSyncSpec) MirrorsSecret() bool {
+	return len(spec.KeyMappings()) == 0 && spec.Destination.Key == ""
+}
+
+// KeyMappings returns the Mappings of the spec, or the mappings of Source into the Keys or the KeyMap of the spec,
+// the latter sorted by key. Returns nil if none is set.
+func (spec SecretSyncSpec) KeyMappings() []KeyMapping {
+	if len(spec.Mappings) != 0 {
+		return spec.Mappings
+	}
+
+	var mappings []KeyMapping
+	for _, key := range spec.Keys {
+		mappings = append(mappings, KeyMapping{Source: spec.Source, Key: key})
+	}
+	for field, key := range spec.KeyMap {
+		source := spec.Source
+		source.JSONField = field
+		mappings = append(mappings, KeyMapping{Source: source, Key: key})
+	}
+	if len(spec.KeyMap) != 0 {
+		sort.Slice(mappings, func(i, j int) bool {
+			return mappings[i].Key < mappings[j].Key
+		})
+	}
+	return mappings
+}
+
+// MirrorPairs expands the spec mirroring its whole source secret into single source-to-key sync pairs, given data, the source value.
+// Returns a pair for each field of data selected by IncludeKeys and ExcludeKeys if it is a JSON object,
+// extracting the field into the key named by KeyTransform, otherwise a single pair syncing data into the key MirrorDataKey.
+// The pairs are sorted by key. The fields that are not valid secret keys, or that collide into the same key, are left out,
+// and returned in the error.
+// Returns error if IncludeKeys or ExcludeKeys are set and data is not a JSON object, or none of its fields is selected.
+func (spec SecretSyncSpec) MirrorPairs(data []byte) ([]SecretSyncSpec, error) {
+	pair := spec
+	pair.Destination.Key = MirrorDataKey
+
+	filtered := len(spec.IncludeKeys) != 0 || len(spec.ExcludeKeys) != 0
+	fields := make(map[string]json.RawMessage)
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) || json.Unmarshal(data, &fields) != nil {
+		if filtered {
+			return nil, fmt.Errorf("Value of %s is not a JSON object to select the fields of", spec.Source)
+		}
+		return []SecretSyncSpec{pair}, nil
+	}
+
+	// fields of each key
+	keyFields := map[string][]string{}
+	invalid := []string{}
+	for field, value := range fields {
+		// null fields are missing, see SecretManagerSpec.Extract()
+		if bytes.Equal(value, []byte("null")) {
+			continue
+		}
+		if !spec.selectsField(field) {
+			continue
+		}
+		key := spec.KeyTransform.Apply(field)
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			invalid = append(invalid, strconv.Quote(field))
+			continue
+		}
+		keyFields[key] = append(keyFields[key], field)
+	}
+
+	keys := []string{}
+	collisions := []string{}
+	for key, fields := range keyFields {
+		if len(fields) > 1 {
+			sort.Strings(fields)
+			collisions = append(collisions, fmt.Sprintf("%s into [%s]", strings.Join(fields, ", "), key))
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []SecretSyncSpec{}
+	for _, key := range keys {
+		pair := spec
+		pair.Source.JSONField = keyFields[key][0]
+		pair.Destination.Key = key
+		pairs = append(pairs, pair)
+	}
+	if len(invalid) != 0 {
+		sort.Strings(invalid)
+		return pairs, fmt.Errorf("Fields %s of %s are not valid secret keys", strings.Join(invalid, ", "), spec.Source)
+	}
+	if len(collisions) != 0 {
+		sort.Strings(collisions)
+		return pairs, fmt.Errorf("Fields of %s collide: %s", spec.Source, strings.Join(collisions, "; "))
+	}
+	if filtered && len(pairs) == 0 {
+		return nil, fmt.Errorf("No field of %s is selected by <includeKeys> and <excludeKeys>", spec.Source)
+	}
+	return pairs, nil
+}
+
+// validateKeyFilter returns error if IncludeKeys and ExcludeKeys contradict each other,
+// or if a field of IncludeKeys cannot be written into a key by KeyTransform, so that IncludeKeys selects at least one key.
+func (spec SecretSyncSpec) validateKeyFilter() error {
+	excluded := map[string]bool{}
+	for _, key := range spec.ExcludeKeys {
+		if key == "" {
+			return fmt.Errorf("Empty field in <excludeKeys>")
+		}
+		excluded[key] = true
+	}
+	// field of each transformed key
+	included := map[string]string{}
+	for _, key := range spec.IncludeKeys {
+		if key == "" {
+			return fmt.Errorf("Empty field in <includeKeys>")
+		}
+		if excluded[key] {
+			return fmt.Errorf("Field %q is both in <includeKeys> and <excludeKeys>", key)
+		}
+		transformed := spec.KeyTransform.Apply(key)
+		if errs := validation.IsConfigMapKey(transformed); len(errs) > 0 {
+			return fmt.Errorf("Field %q of <includeKeys> is not a valid secret key: %s", key, strings.Join(errs, ", "))
+		}
+		if field, ok := included[transformed]; ok {
+			return fmt.Errorf("Fields %q and %q of <includeKeys> collide into key [%s]", field, key, transformed)
+		}
+		included[transformed] = key
+	}
+	return nil
+}
+
+// selectsField returns true if the top-level field of a mirrored JSON source is selected by IncludeKeys and ExcludeKeys.
+func (spec SecretSyncSpec) selectsField(field string) bool {
+	included := len(spec.IncludeKeys) == 0
+	for _, key := range spec.IncludeKeys {
+		if key == field {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, key := range spec.ExcludeKeys {
+		if key == field {
+			return false
+		}
+	}
+	return true
+}
+
+// Pairs expands the spec into single source-to-key sync pairs.
+// Returns one pair for each of spec.KeyMappings() if any, otherwise the spec itself.
+func (spec SecretSyncSpec) Pairs() []SecretSyncSpec {
+	mappings := spec.KeyMappings()
+	if len(mappings) == 0 {
+		return []SecretSyncSpec{spec}
+	}
+
+	pairs := []SecretSyncSpec{}
+	for _, mapping := range mappings {
+		pairs = append(pairs, SecretSyncSpec{
+			Source: mapping.Source,
+			Destination: KubernetesSpec{
+				Namespace:       spec.Destination.Namespace,
+				NamespaceRegex:  spec.Destination.NamespaceRegex,
+				Secret:          spec.Destination.Secret,
+				Key:             mapping.Key,
+				StringData:      spec.Destination.StringData,
+				Resource:        spec.Destination.Resource,
+				OwnerRef:        spec.Destination.OwnerRef,
+				EnvelopeEncrypt: spec.Destination.EnvelopeEncrypt,
+			},
+			CredentialsFrom: spec.CredentialsFrom,
+			Transforms:      spec.Transforms,
+			EqualityMode:    spec.EqualityMode,
+			WriteWindow:     spec.WriteWindow,
+			Direction:       spec.Direction,
+			ConflictPolicy:  spec.ConflictPolicy,
+			Replication:     spec.Replication,
+		})
+	}
+
+	return pairs
+}
+
+// Load loads the secret sync configuration at path, either a single yaml file, a directory (see LoadFromDir())
+// or a glob pattern (see LoadFromGlob()). Returns error if fails.
+func (config *SecretSyncConfig) Load(path string) error {
+	files, err := configwatch.Files(path)
+	if err != nil {
+		return err
+	}
+	return config.loadFiles(files)
+}
+
+// LoadFromDir loads and merges the secret sync configurations of the *.yaml and *.yml files in dir, see LoadFromGlob().
+func (config *SecretSyncConfig) LoadFromDir(dir string) error {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("config is not a dir - %s", dir)
+	}
+	return config.Load(dir)
+}
+
+// LoadFromGlob loads the secret sync configurations of the files matching pattern, and concatenates their specs in the lexical order of the files,
+// so that teams can own separate files, e.g. mounted from separate ConfigMaps.
+// The merged config is meant to be validated as a whole, e.g. for the specs duplicated across files.
+func (config *SecretSyncConfig) LoadFromGlob(pattern string) error {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no config file matches %s", pattern)
+	}
+	sort.Strings(matches)
+	return config.loadFiles(matches)
+}
+
+// loadFiles loads the specs of each of files in order into config.
+func (config *SecretSyncConfig) loadFiles(files []string) error {
+	specs := config.Specs
+	for _, file := range files {
+		part := &SecretSyncConfig{}
+		err := part.LoadFrom(file)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, part.Specs...)
+	}
+	config.Specs = specs
+	return nil
 }
 
 // LoadFrom loads the secret sync configuration from a yaml, returns error if fails.
@@ -81,31 +695,464 @@ func (config *SecretSyncConfig) LoadFrom(file string) error {
 	return nil
 }
 
+// LoadFromConfigMap loads the secret sync configurations of the data keys of configMap, read through the API instead of mounted,
+// and concatenates their specs in the lexical order of the keys, like the files of a mounted directory.
+func (config *SecretSyncConfig) LoadFromConfigMap(configMap *corev1.ConfigMap) error {
+	keys := []string{}
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("ConfigMap %s/%s has no data", configMap.Namespace, configMap.Name)
+	}
+	sort.Strings(keys)
+
+	specs := config.Specs
+	for _, key := range keys {
+		part := &SecretSyncConfig{}
+		err := yaml.Unmarshal([]byte(configMap.Data[key]), part)
+		if err != nil {
+			return fmt.Errorf("Error unmarshalling %s/%s[%s]: %s\n", configMap.Namespace, configMap.Name, key, err)
+		}
+		specs = append(specs, part.Specs...)
+	}
+	config.Specs = specs
+	return nil
+}
+
 func (config *SecretSyncConfig) Validate() error {
 	if len(config.Specs) == 0 {
 		return fmt.Errorf("Empty secret sync configuration.")
 	}
 	syncFrom := make(map[KubernetesSpec]SecretManagerSpec)
+	// the Secret Manager secrets written by the reverse and bidirectional specs
+	syncTo := make(map[SecretManagerSpec]KubernetesSpec)
+	for _, spec := range config.Specs {
+		err := spec.Validate()
+		if err != nil {
+			return err
+		}
+
+		for _, pair := range spec.Pairs() {
+			// check if pair.Destination already has a source, regardless of how it is written
+			dest := pair.Destination
+			dest.StringData = false
+			dest.OwnerRef = nil
+			dest.EnvelopeEncrypt = nil
+			src, ok := syncFrom[dest]
+			if ok {
+				return fmt.Errorf("Fail to generate sync pair %s: Secret %s already has a source (%s).", pair, pair.Destination, src)
+			}
+			syncFrom[dest] = pair.Source
+
+			if pair.Direction.WritesSecretManager() {
+				from, ok := syncTo[pair.Source]
+				if ok {
+					return fmt.Errorf("Fail to generate sync pair %s: Secret %s already has a reverse source (%s).", pair, pair.Source, from)
+				}
+				syncTo[pair.Source] = pair.Destination
+			}
+		}
+	}
+
+	// a mirrored secret holds the keys of its source only
+	mirrored := make(map[KubernetesSpec]SecretSyncSpec)
 	for _, spec := range config.Specs {
+		if spec.MirrorsSecret() {
+			mirrored[KubernetesSpec{Namespace: spec.Destination.Namespace, Secret: spec.Destination.Secret}] = spec
+		}
+	}
+	for _, spec := range config.Specs {
+		if spec.MirrorsSecret() || spec.Destination.Resource.IsSet() {
+			continue
+		}
+		mirror, ok := mirrored[KubernetesSpec{Namespace: spec.Destination.Namespace, Secret: spec.Destination.Secret}]
+		if ok {
+			return fmt.Errorf("Fail to generate sync pairs of spec %s: Secret namespaces/%s/secrets/%s is mirrored by spec %s.", spec, spec.Destination.Namespace, spec.Destination.Secret, mirror)
+		}
+	}
+
+	_, err := OrderSpecs(config.Specs)
+	return err
+}
+
+// AnyNamespacePattern returns true if the destination of any of specs has a namespace pattern.
+func AnyNamespacePattern(specs []SecretSyncSpec) bool {
+	for _, spec := range specs {
+		if spec.Destination.HasNamespacePattern() {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandNamespaces returns specs with each spec whose destination has a namespace pattern replaced by a copy of it
+// for each of namespaces matching the pattern, in the order of namespaces, keeping the order of specs otherwise.
+// A copy is left out if any of its destination keys is targeted by a spec without pattern or by an earlier copy,
+// so that a spec of an explicit namespace overrides the patterns. The copies left out are returned in the error.
+// The specs are expected to be valid.
+func ExpandNamespaces(specs []SecretSyncSpec, namespaces []string) ([]SecretSyncSpec, error) {
+	targeted := make(map[SpecID]bool)
+	for _, spec := range specs {
+		if spec.Destination.HasNamespacePattern() {
+			continue
+		}
+		for _, pair := range spec.Pairs() {
+			targeted[pair.ID()] = true
+		}
+	}
+
+	expanded := []SecretSyncSpec{}
+	overridden := []string{}
+	for _, spec := range specs {
+		if !spec.Destination.HasNamespacePattern() {
+			expanded = append(expanded, spec)
+			continue
+		}
+		match, err := spec.Destination.namespaceMatcher()
+		if err != nil {
+			continue
+		}
+
+		for _, namespace := range namespaces {
+			if !match(namespace) {
+				continue
+			}
+			copied := spec
+			copied.Destination.Namespace = namespace
+			copied.Destination.NamespaceRegex = ""
+
+			pairs := copied.Pairs()
+			taken := false
+			for _, pair := range pairs {
+				taken = taken || targeted[pair.ID()]
+			}
+			if taken {
+				overridden = append(overridden, copied.String())
+				continue
+			}
+			for _, pair := range pairs {
+				targeted[pair.ID()] = true
+			}
+			expanded = append(expanded, copied)
+		}
+	}
+
+	if len(overridden) != 0 {
+		return expanded, fmt.Errorf("Specs %s are overridden by other specs of the same destination keys", strings.Join(overridden, ", "))
+	}
+	return expanded, nil
+}
+
+// FindSpec returns the spec identified by id, which is either the name of the spec,
+// <namespace>/<secret>/<key> of one of its destination keys, or <namespace>/<secret> of its destination secret.
+// Returns error if no spec or more than one spec matches id.
+func (config SecretSyncConfig) FindSpec(id string) (SecretSyncSpec, error) {
+	matches := []SecretSyncSpec{}
+	for _, spec := range config.Specs {
+		if spec.Name == id || spec.matches(id) {
+			matches = append(matches, spec)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return SecretSyncSpec{}, fmt.Errorf("No spec found for %s.", id)
+	case 1:
+		return matches[0], nil
+	}
+	found := []string{}
+	for _, spec := range matches {
+		found = append(found, spec.String())
+	}
+	return SecretSyncSpec{}, fmt.Errorf("Ambiguous spec %s, matching %d specs: %s.", id, len(matches), strings.Join(found, ", "))
+}
+
+// matches returns true if id is <namespace>/<secret> of the destination of spec, or <namespace>/<secret>/<key> of any of its keys.
+func (spec SecretSyncSpec) matches(id string) bool {
+	dest := spec.Destination.Namespace + "/" + spec.Destination.Secret
+	if id == dest {
+		return true
+	}
+	for _, pair := range spec.Pairs() {
+		if id == dest+"/"+pair.Destination.Key {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderSpecs returns specs ordered so that each spec comes after the specs named in its DependsOn,
+// keeping the order of specs otherwise.
+// Returns error if a name is duplicated, a dependency is not found, or the dependencies form a cycle.
+func OrderSpecs(specs []SecretSyncSpec) ([]SecretSyncSpec, error) {
+	names := make(map[string]bool)
+	for _, spec := range specs {
+		if spec.Name == "" {
+			continue
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("Duplicated <name> %s in spec %s.", spec.Name, spec)
+		}
+		names[spec.Name] = true
+	}
+	for _, spec := range specs {
+		for _, dep := range spec.DependsOn {
+			if !names[dep] {
+				return nil, fmt.Errorf("Dependency %s of spec %s not found.", dep, spec)
+			}
+		}
+	}
+
+	ordered := []SecretSyncSpec{}
+	done := make(map[string]bool)
+	remaining := specs
+	for len(remaining) != 0 {
+		next := []SecretSyncSpec{}
+		for _, spec := range remaining {
+			ready := true
+			for _, dep := range spec.DependsOn {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				next = append(next, spec)
+				continue
+			}
+			ordered = append(ordered, spec)
+			if spec.Name != "" {
+				done[spec.Name] = true
+			}
+		}
+
+		// no spec became ready in this pass, the remaining ones are in or behind a cycle
+		if len(next) == len(remaining) {
+			blocked := []string{}
+			for _, spec := range next {
+				if spec.Name != "" {
+					blocked = append(blocked, spec.Name)
+				}
+			}
+			return nil, fmt.Errorf("Dependency cycle among specs %s.", strings.Join(blocked, ", "))
+		}
+		remaining = next
+	}
+
+	return ordered, nil
+}
+
+// Validate checks the structure of the spec on its own.
+// Checks across specs, e.g. duplicated destinations, are left to SecretSyncConfig.Validate().
+func (spec SecretSyncSpec) Validate() error {
+	if len(spec.Mappings) != 0 {
 		switch {
-		case spec.Source.Project == "":
+		case spec.Source != SecretManagerSpec{}:
+			return fmt.Errorf("Field <source> cannot be used with <mappings> in spec %s.", spec)
+		case spec.Destination.Key != "":
+			return fmt.Errorf("Field <key> for <destination> cannot be used with <mappings> in spec %s.", spec)
+		case len(spec.Keys) != 0:
+			return fmt.Errorf("Field <keys> cannot be used with <mappings> in spec %s.", spec)
+		case len(spec.KeyMap) != 0:
+			return fmt.Errorf("Field <keyMap> cannot be used with <mappings> in spec %s.", spec)
+		}
+	}
+	if len(spec.Keys) != 0 || len(spec.KeyMap) != 0 {
+		switch {
+		case spec.Destination.Key != "":
+			return fmt.Errorf("Field <key> for <destination> cannot be used with <keys> or <keyMap> in spec %s.", spec)
+		case len(spec.Keys) != 0 && len(spec.KeyMap) != 0:
+			return fmt.Errorf("Field <keys> cannot be used with <keyMap> in spec %s.", spec)
+		case len(spec.KeyMap) != 0 && spec.Source.JSONField != "":
+			return fmt.Errorf("Field <jsonField> for <source> cannot be used with <keyMap> in spec %s.", spec)
+		}
+		for field := range spec.KeyMap {
+			if field == "" {
+				return fmt.Errorf("Empty field in <keyMap> in spec %s.", spec)
+			}
+		}
+	}
+
+	if spec.CredentialsFrom != nil {
+		switch {
+		case spec.CredentialsFrom.Project == "":
+			return fmt.Errorf("Missing <project> field for <credentialsFrom> in spec %s.", spec)
+		case spec.CredentialsFrom.Secret == "":
+			return fmt.Errorf("Missing <secret> field for <credentialsFrom> in spec %s.", spec)
+		case spec.CredentialsFrom.JSONField != "":
+			return fmt.Errorf("Field <jsonField> cannot be used for <credentialsFrom> in spec %s.", spec)
+		}
+		if err := gsmoption.ValidateProject(spec.CredentialsFrom.Project); err != nil {
+			return fmt.Errorf("Invalid <project> field for <credentialsFrom> in spec %s: %s", spec, err)
+		}
+	}
+
+	if err := spec.EqualityMode.Validate(); err != nil {
+		return fmt.Errorf("Invalid <equalityMode> in spec %s: %s", spec, err)
+	}
+
+	if err := spec.Direction.Validate(); err != nil {
+		return fmt.Errorf("Invalid <direction> in spec %s: %s", spec, err)
+	}
+	if err := spec.ConflictPolicy.Validate(); err != nil {
+		return fmt.Errorf("Invalid <conflictPolicy> in spec %s: %s", spec, err)
+	}
+	if spec.ConflictPolicy != "" && spec.Direction != DirectionBidirectional {
+		return fmt.Errorf("Field <conflictPolicy> can only be used with bidirectional <direction> in spec %s.", spec)
+	}
+	if len(spec.Replication.Locations) != 0 && !spec.Direction.WritesSecretManager() {
+		return fmt.Errorf("Field <replication> can only be used with a <direction> writing Secret Manager in spec %s.", spec)
+	}
+	for _, location := range spec.Replication.Locations {
+		if location == "" {
+			return fmt.Errorf("Empty location in <replication> of spec %s.", spec)
+		}
+	}
+	if spec.Direction.WritesSecretManager() {
+		// the Kubernetes values are written into Secret Manager as they are
+		for _, field := range []struct {
+			name string
+			set  bool
+		}{
+			{"credentialsFrom", spec.CredentialsFrom != nil},
+			{"transforms", len(spec.Transforms) != 0},
+			{"mirrorLabels", spec.MirrorLabels},
+			{"writeWindow", spec.WriteWindow != nil},
+			{"stringData", spec.Destination.StringData},
+			{"resource", spec.Destination.Resource.IsSet()},
+			{"ownerRef", spec.Destination.OwnerRef != nil},
+			{"envelopeEncrypt", spec.Destination.EnvelopeEncrypt != nil},
+		} {
+			if field.set {
+				return fmt.Errorf("Field <%s> cannot be used with %s <direction> in spec %s.", field.name, spec.Direction, spec)
+			}
+		}
+	}
+
+	if spec.Destination.NamespaceRegex != "" && spec.Destination.Namespace != "" {
+		return fmt.Errorf("Field <namespaceRegex> cannot be used with <namespace> for <destination> in spec %s.", spec)
+	}
+	if spec.Destination.HasNamespacePattern() {
+		if _, err := spec.Destination.namespaceMatcher(); err != nil {
+			return fmt.Errorf("Invalid namespace pattern for <destination> in spec %s: %s", spec, err)
+		}
+		// a single Secret Manager secret cannot be written from several namespaces
+		if spec.Direction.WritesSecretManager() {
+			return fmt.Errorf("Namespace pattern for <destination> cannot be used with %s <direction> in spec %s.", spec.Direction, spec)
+		}
+	}
+
+	if spec.MirrorsSecret() {
+		// the keys of a mirrored secret are only known from the value of its source
+		switch {
+		case spec.Direction.WritesSecretManager():
+			return fmt.Errorf("Missing <key> field for <destination> with %s <direction> in spec %s.", spec.Direction, spec)
+		case spec.Destination.Resource.IsSet():
+			return fmt.Errorf("Missing <key> field for <destination> with <resource> in spec %s.", spec)
+		case spec.Source.JSONField != "":
+			return fmt.Errorf("Field <jsonField> for <source> cannot be used without <key> for <destination> in spec %s.", spec)
+		}
+	} else {
+		// the filters select the keys derived from the fields of a mirrored source
+		switch {
+		case len(spec.IncludeKeys) != 0:
+			return fmt.Errorf("Field <includeKeys> cannot be used with <key> for <destination> or key mappings in spec %s.", spec)
+		case len(spec.ExcludeKeys) != 0:
+			return fmt.Errorf("Field <excludeKeys> cannot be used with <key> for <destination> or key mappings in spec %s.", spec)
+		case spec.KeyTransform != "":
+			return fmt.Errorf("Field <keyTransform> cannot be used with <key> for <destination> or key mappings in spec %s.", spec)
+		}
+	}
+	if err := spec.KeyTransform.Validate(); err != nil {
+		return fmt.Errorf("Invalid <keyTransform> in spec %s: %s", spec, err)
+	}
+	if err := spec.validateKeyFilter(); err != nil {
+		return fmt.Errorf("Invalid key filter in spec %s: %s", spec, err)
+	}
+
+	if spec.WriteWindow != nil {
+		if err := spec.WriteWindow.Validate(); err != nil {
+			return fmt.Errorf("Invalid <writeWindow> in spec %s: %s", spec, err)
+		}
+	}
+
+	if spec.MirrorLabels && spec.Destination.Resource.IsSet() {
+		return fmt.Errorf("Field <mirrorLabels> cannot be used with <resource> in spec %s.", spec)
+	}
+	if spec.Destination.OwnerRef != nil {
+		if spec.Destination.Resource.IsSet() {
+			return fmt.Errorf("Field <ownerRef> cannot be used with <resource> in spec %s.", spec)
+		}
+		if err := spec.Destination.OwnerRef.Validate(); err != nil {
+			return fmt.Errorf("Invalid <ownerRef> for <destination> in spec %s: %s", spec, err)
+		}
+	}
+	if spec.Destination.EnvelopeEncrypt != nil {
+		if spec.Destination.Resource.IsSet() {
+			return fmt.Errorf("Field <envelopeEncrypt> cannot be used with <resource> in spec %s.", spec)
+		}
+		if err := spec.Destination.EnvelopeEncrypt.Validate(); err != nil {
+			return fmt.Errorf("Invalid <envelopeEncrypt> for <destination> in spec %s: %s", spec, err)
+		}
+	}
+
+	if err := spec.MirrorLabelsFilter.Validate(); err != nil {
+		return fmt.Errorf("Invalid <mirrorLabelsFilter> in spec %s: %s", spec, err)
+	}
+
+	for _, t := range spec.Transforms {
+		err := t.Validate()
+		if err != nil {
+			return fmt.Errorf("Invalid <transforms> in spec %s: %s", spec, err)
+		}
+	}
+
+	keys := make(map[string]bool)
+	for _, pair := range spec.Pairs() {
+		switch {
+		case pair.Source.Project == "":
 			return fmt.Errorf("Missing <project> field for <source> in spec %s.", spec)
-		case spec.Source.Secret == "":
+		case pair.Source.Secret == "":
 			return fmt.Errorf("Missing <secret> field for <source> in spec %s.", spec)
-		case spec.Destination.Namespace == "":
+		case pair.Source.MinLength < 0:
+			return fmt.Errorf("Negative <minLength> for <source> in spec %s.", spec)
+		case pair.Source.MinLength != 0 && spec.Direction.WritesSecretManager():
+			return fmt.Errorf("Field <minLength> for <source> cannot be used with %s <direction> in spec %s.", spec.Direction, spec)
+		case pair.Source.JSONField != "" && spec.Direction.WritesSecretManager():
+			return fmt.Errorf("Field <jsonField> for <source> cannot be used with %s <direction> in spec %s.", spec.Direction, spec)
+		case pair.Destination.Namespace == "" && pair.Destination.NamespaceRegex == "":
 			return fmt.Errorf("Missing <namespace> field for <destination> in spec %s.", spec)
-		case spec.Destination.Secret == "":
+		case pair.Destination.Secret == "":
 			return fmt.Errorf("Missing <secret> field for <destination> in spec %s.", spec)
-		case spec.Destination.Key == "":
+		case pair.Destination.Key == "" && !spec.MirrorsSecret():
 			return fmt.Errorf("Missing <key> field for <destination> in spec %s.", spec)
 		}
 
-		// check if spec.Destination already has a source
-		src, ok := syncFrom[spec.Destination]
-		if ok {
-			return fmt.Errorf("Fail to generate sync pair %s: Secret %s already has a source (%s).", spec, spec.Destination, src)
+		if err := gsmoption.ValidateProject(pair.Source.Project); err != nil {
+			return fmt.Errorf("Invalid <project> field for <source> in spec %s: %s", spec, err)
+		}
+
+		if !pair.Destination.Resource.IsSet() && !spec.MirrorsSecret() {
+			if errs := validation.IsConfigMapKey(pair.Destination.Key); len(errs) > 0 {
+				return fmt.Errorf("Invalid <key> %q for <destination> in spec %s: %s", pair.Destination.Key, spec, strings.Join(errs, ", "))
+			}
+		}
+
+		if pair.Destination.Resource.IsSet() {
+			err := pair.Destination.Resource.Validate()
+			if err != nil {
+				return fmt.Errorf("Invalid <resource> for <destination> in spec %s: %s", spec, err)
+			}
+			if pair.Destination.StringData {
+				return fmt.Errorf("Field <stringData> cannot be used with <resource> in spec %s.", spec)
+			}
+		}
+
+		if keys[pair.Destination.Key] {
+			return fmt.Errorf("Fail to generate sync pair %s: Key [%s] is mapped more than once in spec %s.", pair, pair.Destination.Key, spec)
 		}
-		syncFrom[spec.Destination] = spec.Source
+		keys[pair.Destination.Key] = true
 	}
 	return nil
 }
@@ -14,7 +14,12 @@ limitations under the License.
 package config
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestValidate(t *testing.T) {
@@ -53,6 +58,69 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name: "Reverse spec syncing into the source of a forward spec",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-b",
+							Secret:    "secret-b",
+							Key:       "key-b",
+						},
+						Direction: DirectionReverse,
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Reverse specs syncing into the same secret",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+						Direction: DirectionReverse,
+					},
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-b",
+							Secret:    "secret-b",
+							Key:       "key-b",
+						},
+						Direction: DirectionReverse,
+					},
+				},
+			},
+			expectErr: true,
+		},
 		{
 			name: "Correct config, <Different source secrets> for <two different secret keys< in the <same Kubernetes secret>.",
 			config: SecretSyncConfig{
@@ -119,6 +187,83 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "Project number for <source>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "123456789012",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Malformed <project> with spaces for <source>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj 1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Malformed <project> with slashes for <source>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1/secrets/secret-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Negative <minLength> for <source>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project:   "proj-1",
+							Secret:    "secret-1",
+							MinLength: -1,
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
 		{
 			name: "Missing <namespace> field for <destination>.",
 			config: SecretSyncConfig{
@@ -156,7 +301,54 @@ func TestValidate(t *testing.T) {
 			expectErr: true,
 		},
 		{
-			name: "Missing <key> field for <destination>.",
+			name: "Missing <key> field for <destination>. Should mirror the whole secret.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Key of a mirrored secret targeted by another spec.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-2",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Secret mirrored twice.",
 			config: SecretSyncConfig{
 				Specs: []SecretSyncSpec{
 					{
@@ -169,6 +361,16 @@ func TestValidate(t *testing.T) {
 							Secret:    "secret-a",
 						},
 					},
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-2",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+					},
 				},
 			},
 			expectErr: true,
@@ -203,6 +405,37 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "<Multiple sources> for a <single Kunernetes secret key>, written as <stringData> and <data>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace:  "ns-a",
+							Secret:     "secret-a",
+							Key:        "key-a",
+							StringData: true,
+						},
+					},
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-2",
+							Secret:  "secret-2",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
 		{
 			name: "<Multiple declaration> for the <same secret sync pair>.",
 			config: SecretSyncConfig{
@@ -233,18 +466,2058 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: true,
 		},
-	}
-	for _, tc := range testcases {
-		testname := tc.name
-		t.Run(testname, func(t *testing.T) {
-
-			err := tc.config.Validate()
-			if tc.expectErr && err == nil {
-				t.Errorf("Expected error but got nil.")
-			} else if !tc.expectErr && err != nil {
-				t.Errorf("Unexpected error: %s", err)
-			}
-
+		{
+			name: "Correct config, <Mappings> of <different source secrets> to <different keys> in the <same Kubernetes secret>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+						Mappings: []KeyMapping{
+							{
+								Source: SecretManagerSpec{
+									Project: "proj-1",
+									Secret:  "secret-1",
+								},
+								Key: "key-a",
+							},
+							{
+								Source: SecretManagerSpec{
+									Project: "proj-2",
+									Secret:  "secret-2",
+								},
+								Key: "key-b",
+							},
+						},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<Mappings> writing the <same key>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+						Mappings: []KeyMapping{
+							{
+								Source: SecretManagerSpec{
+									Project: "proj-1",
+									Secret:  "secret-1",
+								},
+								Key: "key-a",
+							},
+							{
+								Source: SecretManagerSpec{
+									Project: "proj-2",
+									Secret:  "secret-2",
+								},
+								Key: "key-a",
+							},
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<Mappings> writing the <same key> as another spec.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+					{
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+						Mappings: []KeyMapping{
+							{
+								Source: SecretManagerSpec{
+									Project: "proj-2",
+									Secret:  "secret-2",
+								},
+								Key: "key-a",
+							},
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Missing <key> field for <mappings>.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+						Mappings: []KeyMapping{
+							{
+								Source: SecretManagerSpec{
+									Project: "proj-1",
+									Secret:  "secret-1",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<Mappings> with <source> field.",
+			config: SecretSyncConfig{
+				Specs: []SecretSyncSpec{
+					{
+						Source: SecretManagerSpec{
+							Project: "proj-1",
+							Secret:  "secret-1",
+						},
+						Destination: KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+						},
+						Mappings: []KeyMapping{
+							{
+								Source: SecretManagerSpec{
+									Project: "proj-2",
+									Secret:  "secret-2",
+								},
+								Key: "key-b",
+							},
+						},
+					},
+				},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+
+			err := tc.config.Validate()
+			if tc.expectErr && err == nil {
+				t.Errorf("Expected error but got nil.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+		})
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		spec      SecretSyncSpec
+		expectErr bool
+	}{
+		{
+			name: "Correct spec.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <key> field for <destination>. Should mirror the whole secret.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <key> field for <destination> with reverse <direction>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Direction: DirectionReverse,
+			},
+			expectErr: true,
+		},
+		{
+			name: "Field <jsonField> for <source> of a mirrored secret.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project:   "proj-1",
+					Secret:    "secret-1",
+					JSONField: "user",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Correct <mappings> spec.",
+			spec: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []KeyMapping{
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-1"},
+						Key:    "key-a",
+					},
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-2"},
+						Key:    "key-b",
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<Mappings> writing the <same key> within the spec.",
+			spec: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []KeyMapping{
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-1"},
+						Key:    "key-a",
+					},
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-2"},
+						Key:    "key-a",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<Mappings> with <source> field.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []KeyMapping{
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-2"},
+						Key:    "key-a",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Correct <resource> destination.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Resource: ResourceSpec{
+						Group:     "external-secrets.io",
+						Version:   "v1",
+						Resource:  "externalsecrets",
+						Kind:      "ExternalSecret",
+						FieldPath: "spec.data",
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <kind> field for <resource>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Resource: ResourceSpec{
+						Group:     "external-secrets.io",
+						Version:   "v1",
+						Resource:  "externalsecrets",
+						FieldPath: "spec.data",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Empty field in <fieldPath> of <resource>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Resource: ResourceSpec{
+						Group:     "external-secrets.io",
+						Version:   "v1",
+						Resource:  "externalsecrets",
+						Kind:      "ExternalSecret",
+						FieldPath: "spec..data",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<Resource> field path overwriting metadata.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Resource: ResourceSpec{
+						Group:     "external-secrets.io",
+						Version:   "v1",
+						Resource:  "externalsecrets",
+						Kind:      "ExternalSecret",
+						FieldPath: "metadata.labels",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<StringData> with <resource>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace:  "ns-a",
+					Secret:     "secret-a",
+					Key:        "key-a",
+					StringData: true,
+					Resource: ResourceSpec{
+						Group:     "external-secrets.io",
+						Version:   "v1",
+						Resource:  "externalsecrets",
+						Kind:      "ExternalSecret",
+						FieldPath: "spec.data",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Correct <credentialsFrom>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				CredentialsFrom: &SecretManagerSpec{
+					Project: "proj-0",
+					Secret:  "credentials",
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <secret> field for <credentialsFrom>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				CredentialsFrom: &SecretManagerSpec{
+					Project: "proj-0",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Valid <key> with dots, dashes and underscores.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "tls_ca.crt-1",
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Valid <mirrorLabels> with <mirrorLabelsFilter>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				MirrorLabels:       true,
+				MirrorLabelsFilter: LabelFilter{Include: []string{"team-*"}, Exclude: []string{"team-internal"}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Valid <equalityMode>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				EqualityMode: EqualityJSONCanonical,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Unknown <equalityMode>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				EqualityMode: "json",
+			},
+			expectErr: true,
+		},
+		{
+			name: "Valid <writeWindow>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				WriteWindow: &WriteWindow{Cron: "0 0 2 * * 6", Duration: 4 * time.Hour},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<writeWindow> without duration.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				WriteWindow: &WriteWindow{Cron: "0 0 2 * * 6"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Valid <ownerRef>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					OwnerRef:  &OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app-a"},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <kind> field for <ownerRef>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					OwnerRef:  &OwnerReference{APIVersion: "apps/v1", Name: "app-a"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid <name> for <ownerRef>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					OwnerRef:  &OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "App_A"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<ownerRef> with <resource>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Resource: ResourceSpec{
+						Group:     "external-secrets.io",
+						Version:   "v1beta1",
+						Resource:  "externalsecrets",
+						Kind:      "ExternalSecret",
+						FieldPath: "spec.data",
+					},
+					OwnerRef: &OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app-a"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Valid <envelopeEncrypt>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace:       "ns-a",
+					Secret:          "secret-a",
+					Key:             "key-a",
+					EnvelopeEncrypt: &EnvelopeEncryption{KMSKey: "projects/proj-1/locations/global/keyRings/ring-1/cryptoKeys/key-1"},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Missing <kmsKey> field for <envelopeEncrypt>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace:       "ns-a",
+					Secret:          "secret-a",
+					Key:             "key-a",
+					EnvelopeEncrypt: &EnvelopeEncryption{KMSKey: ""},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid <kmsKey> for <envelopeEncrypt>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace:       "ns-a",
+					Secret:          "secret-a",
+					Key:             "key-a",
+					EnvelopeEncrypt: &EnvelopeEncryption{KMSKey: "projects/proj-1/keyRings/ring-1/cryptoKeys/key-1"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<envelopeEncrypt> with <resource>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Resource: ResourceSpec{
+						Group:     "external-secrets.io",
+						Version:   "v1beta1",
+						Resource:  "externalsecrets",
+						Kind:      "ExternalSecret",
+						FieldPath: "spec.data",
+					},
+					EnvelopeEncrypt: &EnvelopeEncryption{KMSKey: "projects/proj-1/locations/global/keyRings/ring-1/cryptoKeys/key-1"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Valid reverse <direction>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction: DirectionReverse,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Unknown <direction>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction: "both",
+			},
+			expectErr: true,
+		},
+		{
+			name: "Reverse <direction> with <transforms>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction:  DirectionReverse,
+				Transforms: []Transform{TransformTrim},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Reverse <direction> with <stringData>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace:  "ns-a",
+					Secret:     "secret-a",
+					Key:        "key-a",
+					StringData: true,
+				},
+				Direction: DirectionReverse,
+			},
+			expectErr: true,
+		},
+		{
+			name: "Valid bidirectional <direction> with <conflictPolicy>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction:      DirectionBidirectional,
+				ConflictPolicy: ConflictNewestWins,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Unknown <conflictPolicy>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction:      DirectionBidirectional,
+				ConflictPolicy: "last-wins",
+			},
+			expectErr: true,
+		},
+		{
+			name: "<conflictPolicy> without bidirectional <direction>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				ConflictPolicy: ConflictK8sWins,
+			},
+			expectErr: true,
+		},
+		{
+			name: "Valid reverse <direction> with <replication>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction:   DirectionReverse,
+				Replication: ReplicationSpec{Locations: []string{"us-east1", "us-west1"}},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<replication> with forward <direction>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Replication: ReplicationSpec{Locations: []string{"us-east1"}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Empty location in <replication>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction:   DirectionBidirectional,
+				Replication: ReplicationSpec{Locations: []string{"us-east1", ""}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Bidirectional <direction> with <writeWindow>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction:   DirectionBidirectional,
+				WriteWindow: &WriteWindow{Cron: "0 2 * * 6", Duration: 2 * time.Hour},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid pattern in <mirrorLabelsFilter>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				MirrorLabels:       true,
+				MirrorLabelsFilter: LabelFilter{Include: []string{"team-["}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid <key> containing a slash.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "certs/ca.crt",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid <key> containing a space.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "ca crt",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid <key> containing unicode.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "clé",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid <key> starting with '..'.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "..data",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Invalid mapped <key>.",
+			spec: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []KeyMapping{
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-1"},
+						Key:    "key one",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Correct <transforms>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Transforms: []Transform{TransformTrim, TransformBase64Decode},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Fields of a JSON secret mapped to several keys.",
+			spec: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []KeyMapping{
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-1", JSONField: "user"},
+						Key:    "username",
+					},
+					{
+						Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-1", JSONField: "pass"},
+						Key:    "password",
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Field <jsonField> with reverse <direction>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project:   "proj-1",
+					Secret:    "secret-1",
+					JSONField: "user",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction: DirectionReverse,
+			},
+			expectErr: true,
+		},
+		{
+			name: "Field <jsonField> for <credentialsFrom>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				CredentialsFrom: &SecretManagerSpec{
+					Project:   "proj-1",
+					Secret:    "credentials",
+					JSONField: "key",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Source synced into <keys>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Keys: []string{"token", "TOKEN"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Fields of source synced with <keyMap>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				KeyMap: map[string]string{"user": "username", "pass": "password"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Field <keys> with destination <key>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Keys: []string{"token", "TOKEN"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Field <keys> with <keyMap>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Keys:   []string{"token", "TOKEN"},
+				KeyMap: map[string]string{"user": "username", "pass": "password"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Field <keyMap> with source <jsonField>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project:   "proj-1",
+					Secret:    "secret-1",
+					JSONField: "credentials",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				KeyMap: map[string]string{"user": "username", "pass": "password"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Empty field in <keyMap>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				KeyMap: map[string]string{"": "username"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<includeKeys> of a mirrored secret.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				IncludeKeys: []string{"user", "pass"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<excludeKeys> of a mirrored secret.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				ExcludeKeys: []string{"admin-pass"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "<includeKeys> and <excludeKeys> not contradicting.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				IncludeKeys: []string{"user", "pass"},
+				ExcludeKeys: []string{"admin-pass"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Field both in <includeKeys> and <excludeKeys>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				IncludeKeys: []string{"user", "pass"},
+				ExcludeKeys: []string{"pass"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Field of <includeKeys> not a valid secret key.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				IncludeKeys: []string{"pass word"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Empty field in <excludeKeys>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				ExcludeKeys: []string{""},
+			},
+			expectErr: true,
+		},
+		{
+			name: "<keyTransform> of a mirrored secret.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				KeyTransform: KeyTransformUpperSnake,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Unknown <keyTransform>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				KeyTransform: "camel",
+			},
+			expectErr: true,
+		},
+		{
+			name: "Fields of <includeKeys> colliding by <keyTransform>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				IncludeKeys:  []string{"apiKey", "api_key"},
+				KeyTransform: KeyTransformUpperSnake,
+			},
+			expectErr: true,
+		},
+		{
+			name: "<includeKeys> with <key> for <destination>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				IncludeKeys: []string{"user"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Namespace glob pattern.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "team-*",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Namespace regex.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					NamespaceRegex: "team-(a|b)",
+					Secret:         "secret-a",
+					Key:            "key-a",
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Malformed namespace glob pattern.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "team-[",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Malformed namespace regex.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					NamespaceRegex: "team-(",
+					Secret:         "secret-a",
+					Key:            "key-a",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Field <namespaceRegex> with <namespace>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace:      "team-a",
+					NamespaceRegex: "team-.*",
+					Secret:         "secret-a",
+					Key:            "key-a",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Namespace pattern with reverse <direction>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "team-*",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction: DirectionReverse,
+			},
+			expectErr: true,
+		},
+		{
+			name: "Unknown <transforms>.",
+			spec: SecretSyncSpec{
+				Source: SecretManagerSpec{
+					Project: "proj-1",
+					Secret:  "secret-1",
+				},
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Transforms: []Transform{"base64"},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+
+			err := tc.spec.Validate()
+			if tc.expectErr && err == nil {
+				t.Errorf("Expected error but got nil.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+		})
+	}
+}
+
+func TestMirrorPairs(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		data      string
+		include   []string
+		exclude   []string
+		transform KeyTransform
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name:     "Opaque value. Should mirror into the data key.",
+			data:     "value",
+			expected: map[string]string{"data": ""},
+		},
+		{
+			name:     "JSON array. Should mirror into the data key.",
+			data:     `["value"]`,
+			expected: map[string]string{"data": ""},
+		},
+		{
+			name:     "JSON object. Should mirror each field into its key.",
+			data:     `{"user": "admin", "pass": "value", "port": 5432, "tls.crt": "crt"}`,
+			expected: map[string]string{"pass": "pass", "port": "port", "tls.crt": "tls.crt", "user": "user"},
+		},
+		{
+			name:     "JSON object with null fields. Should leave them out.",
+			data:     `{"user": "admin", "pass": null}`,
+			expected: map[string]string{"user": "user"},
+		},
+		{
+			name:      "JSON object with invalid keys. Should mirror the valid ones.",
+			data:      `{"user": "admin", "pass word": "value"}`,
+			expected:  map[string]string{"user": "user"},
+			expectErr: true,
+		},
+		{
+			name:     "Included fields. Should mirror only them.",
+			data:     `{"user": "admin", "pass": "value", "admin-pass": "root"}`,
+			include:  []string{"user", "pass", "port"},
+			expected: map[string]string{"pass": "pass", "user": "user"},
+		},
+		{
+			name:     "Excluded fields. Should mirror the others.",
+			data:     `{"user": "admin", "pass": "value", "admin-pass": "root"}`,
+			exclude:  []string{"admin-pass"},
+			expected: map[string]string{"pass": "pass", "user": "user"},
+		},
+		{
+			name:     "Excluded invalid key. Should mirror the others without error.",
+			data:     `{"user": "admin", "pass word": "value"}`,
+			exclude:  []string{"pass word"},
+			expected: map[string]string{"user": "user"},
+		},
+		{
+			name:      "No field included. Should return error.",
+			data:      `{"user": "admin", "pass": "value"}`,
+			include:   []string{"token"},
+			expected:  map[string]string{},
+			expectErr: true,
+		},
+		{
+			name:      "All fields excluded. Should return error.",
+			data:      `{"user": "admin", "pass": "value"}`,
+			exclude:   []string{"user", "pass"},
+			expected:  map[string]string{},
+			expectErr: true,
+		},
+		{
+			name:      "Upper snake keys. Should mirror each field into its transformed key.",
+			data:      `{"apiKey": "value", "db.host": "localhost"}`,
+			transform: KeyTransformUpperSnake,
+			expected:  map[string]string{"API_KEY": "apiKey", "DB_HOST": "db.host"},
+		},
+		{
+			name:      "Lower kebab keys. Should mirror each field into its transformed key.",
+			data:      `{"apiKey": "value", "DB_HOST": "localhost"}`,
+			transform: KeyTransformLowerKebab,
+			expected:  map[string]string{"api-key": "apiKey", "db-host": "DB_HOST"},
+		},
+		{
+			name:      "Fields colliding into the same key. Should mirror the others and return error.",
+			data:      `{"apiKey": "value-1", "api_key": "value-2", "user": "admin"}`,
+			transform: KeyTransformUpperSnake,
+			expected:  map[string]string{"USER": "user"},
+			expectErr: true,
+		},
+		{
+			name:      "Opaque value with transformed keys. Should mirror into the data key.",
+			data:      "value",
+			transform: KeyTransformUpperSnake,
+			expected:  map[string]string{"data": ""},
+		},
+		{
+			name:      "Opaque value with included fields. Should return error.",
+			data:      "value",
+			include:   []string{"user"},
+			expected:  map[string]string{},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			spec := SecretSyncSpec{
+				Source:       SecretManagerSpec{Project: "proj-1", Secret: "secret-1"},
+				Destination:  KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+				IncludeKeys:  tc.include,
+				ExcludeKeys:  tc.exclude,
+				KeyTransform: tc.transform,
+			}
+			pairs, err := spec.MirrorPairs([]byte(tc.data))
+			if tc.expectErr && err == nil {
+				t.Errorf("Expected error but got nil.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			// map of destination key to source field
+			actual := map[string]string{}
+			for _, pair := range pairs {
+				if pair.Source.Secret != "secret-1" || pair.Destination.Secret != "secret-a" {
+					t.Errorf("Unexpected pair %s.", pair)
+				}
+				actual[pair.Destination.Key] = pair.Source.JSONField
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected keys %v, got %v.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestKeyMappings(t *testing.T) {
+	source := SecretManagerSpec{Project: "proj-1", Secret: "secret-1"}
+	var testcases = []struct {
+		name     string
+		spec     SecretSyncSpec
+		expected map[string]string
+	}{
+		{
+			name:     "Destination key. Should have no mappings.",
+			spec:     SecretSyncSpec{Source: source, Destination: KubernetesSpec{Namespace: "ns-a", Secret: "secret-a", Key: "key-a"}},
+			expected: map[string]string{},
+		},
+		{
+			name:     "Keys. Should map the source into each key.",
+			spec:     SecretSyncSpec{Source: source, Destination: KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"}, Keys: []string{"token", "TOKEN"}},
+			expected: map[string]string{"token": "", "TOKEN": ""},
+		},
+		{
+			name:     "KeyMap. Should map each field into its key.",
+			spec:     SecretSyncSpec{Source: source, Destination: KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"}, KeyMap: map[string]string{"user": "username", "pass": "password"}},
+			expected: map[string]string{"username": "user", "password": "pass"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			// map of destination key to source field
+			actual := map[string]string{}
+			for _, pair := range tc.spec.Pairs() {
+				if pair.Destination.Key == "" {
+					continue
+				}
+				if pair.Source.Secret != "secret-1" || pair.Destination.Secret != "secret-a" {
+					t.Errorf("Unexpected pair %s.", pair)
+				}
+				actual[pair.Destination.Key] = pair.Source.JSONField
+			}
+			if len(tc.expected) == 0 && tc.spec.KeyMappings() != nil {
+				t.Errorf("Expected no mappings, got %v.", tc.spec.KeyMappings())
+			} else if len(tc.expected) != 0 && !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected keys %v, got %v.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExpandNamespaces(t *testing.T) {
+	newSpec := func(namespace, regex, key string) SecretSyncSpec {
+		return SecretSyncSpec{
+			Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-1"},
+			Destination: KubernetesSpec{
+				Namespace:      namespace,
+				NamespaceRegex: regex,
+				Secret:         "secret-a",
+				Key:            key,
+			},
+		}
+	}
+	namespaces := []string{"default", "team-a", "team-b", "team-c"}
+
+	var testcases = []struct {
+		name      string
+		specs     []SecretSyncSpec
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "No pattern. Should keep the specs.",
+			specs:    []SecretSyncSpec{newSpec("team-a", "", "key-a"), newSpec("other", "", "key-a")},
+			expected: []string{"team-a/key-a", "other/key-a"},
+		},
+		{
+			name:     "Glob pattern. Should expand into the matching namespaces in order.",
+			specs:    []SecretSyncSpec{newSpec("default", "", "key-a"), newSpec("team-*", "", "key-a")},
+			expected: []string{"default/key-a", "team-a/key-a", "team-b/key-a", "team-c/key-a"},
+		},
+		{
+			name:     "Regex. Should match whole namespaces only.",
+			specs:    []SecretSyncSpec{newSpec("", "team-(a|c)", "key-a"), newSpec("", "team", "key-b")},
+			expected: []string{"team-a/key-a", "team-c/key-a"},
+		},
+		{
+			name:     "Pattern matching no namespace. Should drop the spec.",
+			specs:    []SecretSyncSpec{newSpec("prod-*", "", "key-a")},
+			expected: []string{},
+		},
+		{
+			name:      "Explicit spec of a matching namespace. Should override the pattern there.",
+			specs:     []SecretSyncSpec{newSpec("team-*", "", "key-a"), newSpec("team-b", "", "key-a")},
+			expected:  []string{"team-a/key-a", "team-c/key-a", "team-b/key-a"},
+			expectErr: true,
+		},
+		{
+			name:      "Overlapping patterns. Should keep the earlier one.",
+			specs:     []SecretSyncSpec{newSpec("team-[ab]", "", "key-a"), newSpec("team-*", "", "key-a")},
+			expected:  []string{"team-a/key-a", "team-b/key-a", "team-c/key-a"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			expanded, err := ExpandNamespaces(tc.specs, namespaces)
+			if tc.expectErr && err == nil {
+				t.Errorf("Expected error but got nil.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			actual := []string{}
+			for _, spec := range expanded {
+				if spec.Destination.HasNamespacePattern() {
+					t.Errorf("Expected no namespace pattern, got %s.", spec.Destination)
+				}
+				actual = append(actual, spec.Destination.Namespace+"/"+spec.Destination.Key)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %v, got %v.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSpecIDKeys(t *testing.T) {
+	specA := SecretSyncSpec{
+		Destination: KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+		Mappings:    []KeyMapping{{Key: "key-b"}, {Key: "key-a"}},
+	}
+	specB := SecretSyncSpec{
+		Destination: KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+		Keys:        []string{"key-a", "key-b"},
+	}
+	if specA.ID() != specB.ID() {
+		t.Errorf("Expected the same SpecID for the same keys in any order, but got %s and %s.", specA.ID(), specB.ID())
+	}
+
+	expect := []string{"key-a", "key-b"}
+	if keys := specA.ID().DestinationKeys(); !reflect.DeepEqual(keys, expect) {
+		t.Errorf("Expected destination keys %v, but got %v.", expect, keys)
+	}
+	if id := specA.ID().String(); id != "namespaces/ns-a/secrets/secret-a[key-a,key-b]" {
+		t.Errorf("Unexpected SpecID string %s.", id)
+	}
+}
+
+func TestSpecIDCollision(t *testing.T) {
+	var testcases = []struct {
+		name  string
+		specA SecretSyncSpec
+		specB SecretSyncSpec
+	}{
+		{
+			name: "Destinations rendering to the same string.",
+			specA: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a/secrets/secret-a",
+					Secret:    "b",
+					Key:       "key-a",
+				},
+			},
+			specB: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a/secrets/b",
+					Key:       "key-a",
+				},
+			},
+		},
+		{
+			name: "Mappings and a single key in the same destination secret.",
+			specA: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+			},
+			specB: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []KeyMapping{
+					{Key: "key-a"},
+					{Key: "key-b"},
+				},
+			},
+		},
+		{
+			name: "Mappings and a single key joining their keys in the same custom resource.",
+			specA: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "resource-a",
+					Key:       "key-a,key-b",
+					Resource:  ResourceSpec{Group: "example.com", Version: "v1", Resource: "widgets", FieldPath: "spec.token"},
+				},
+			},
+			specB: SecretSyncSpec{
+				Destination: KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "resource-a",
+					Resource:  ResourceSpec{Group: "example.com", Version: "v1", Resource: "widgets", FieldPath: "spec.token"},
+				},
+				Mappings: []KeyMapping{
+					{Key: "key-a"},
+					{Key: "key-b"},
+				},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			if tc.specA.ID() == tc.specB.ID() {
+				t.Errorf("Expected different SpecIDs, but both are %s", tc.specA.ID())
+			}
+
+			ids := map[SpecID]bool{
+				tc.specA.ID(): true,
+				tc.specB.ID(): true,
+			}
+			if len(ids) != 2 {
+				t.Errorf("Expected 2 distinct map keys, but got %d", len(ids))
+			}
+		})
+	}
+}
+
+func TestOrderSpecs(t *testing.T) {
+	spec := func(name string, deps ...string) SecretSyncSpec {
+		return SecretSyncSpec{
+			Name: name,
+			Source: SecretManagerSpec{
+				Project: "proj-1",
+				Secret:  "secret-" + name,
+			},
+			Destination: KubernetesSpec{
+				Namespace: "ns-a",
+				Secret:    "secret-" + name,
+				Key:       "key",
+			},
+			DependsOn: deps,
+		}
+	}
+
+	var testcases = []struct {
+		name      string
+		specs     []SecretSyncSpec
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "No dependency. Should keep the config order.",
+			specs:    []SecretSyncSpec{spec("b"), spec(""), spec("a")},
+			expected: []string{"b", "", "a"},
+		},
+		{
+			name:     "Dependent before its dependency. Should move after it.",
+			specs:    []SecretSyncSpec{spec("leaf", "ca"), spec("other"), spec("ca")},
+			expected: []string{"other", "ca", "leaf"},
+		},
+		{
+			name:     "Chained dependencies.",
+			specs:    []SecretSyncSpec{spec("c", "b"), spec("b", "a"), spec("a")},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "Multiple dependencies.",
+			specs:    []SecretSyncSpec{spec("leaf", "ca", "key"), spec("ca"), spec("key", "ca")},
+			expected: []string{"ca", "key", "leaf"},
+		},
+		{
+			name:      "Dependency cycle.",
+			specs:     []SecretSyncSpec{spec("a", "c"), spec("b", "a"), spec("c", "b")},
+			expectErr: true,
+		},
+		{
+			name:      "Self dependency.",
+			specs:     []SecretSyncSpec{spec("a", "a")},
+			expectErr: true,
+		},
+		{
+			name:      "Missing dependency.",
+			specs:     []SecretSyncSpec{spec("leaf", "ca")},
+			expectErr: true,
+		},
+		{
+			name:      "Duplicated <name>.",
+			specs:     []SecretSyncSpec{spec("a"), spec("a")},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			ordered, err := OrderSpecs(tc.specs)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				}
+				// the config validation fails likewise
+				cfg := SecretSyncConfig{Specs: tc.specs}
+				if cfg.Validate() == nil {
+					t.Errorf("Expected validation error but got nil.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			actual := []string{}
+			for _, spec := range ordered {
+				actual = append(actual, spec.Name)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected order %v, got %v.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFindSpec(t *testing.T) {
+	named := SecretSyncSpec{
+		Name:        "ca",
+		Source:      SecretManagerSpec{Project: "proj-1", Secret: "secret-1"},
+		Destination: KubernetesSpec{Namespace: "ns-a", Secret: "secret-a", Key: "ca.crt"},
+	}
+	sameSecret := SecretSyncSpec{
+		Source:      SecretManagerSpec{Project: "proj-1", Secret: "secret-2"},
+		Destination: KubernetesSpec{Namespace: "ns-a", Secret: "secret-a", Key: "tls.crt"},
+	}
+	mappings := SecretSyncSpec{
+		Destination: KubernetesSpec{Namespace: "ns-b", Secret: "secret-b"},
+		Mappings: []KeyMapping{
+			{Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-3"}, Key: "key-1"},
+			{Source: SecretManagerSpec{Project: "proj-1", Secret: "secret-4"}, Key: "key-2"},
+		},
+	}
+	cfg := SecretSyncConfig{
+		Specs: []SecretSyncSpec{named, sameSecret, mappings},
+	}
+
+	var testcases = []struct {
+		name      string
+		id        string
+		expected  SecretSyncSpec
+		expectErr bool
+	}{
+		{
+			name:     "Found by name.",
+			id:       "ca",
+			expected: named,
+		},
+		{
+			name:     "Found by destination key.",
+			id:       "ns-a/secret-a/tls.crt",
+			expected: sameSecret,
+		},
+		{
+			name:     "Found by mapped key.",
+			id:       "ns-b/secret-b/key-2",
+			expected: mappings,
+		},
+		{
+			name:     "Found by destination secret.",
+			id:       "ns-b/secret-b",
+			expected: mappings,
+		},
+		{
+			name:      "Not found.",
+			id:        "ns-a/secret-a/missing",
+			expectErr: true,
+		},
+		{
+			name:      "Ambiguous destination secret written by multiple specs.",
+			id:        "ns-a/secret-a",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			actual, err := cfg.FindSpec(tc.id)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got %s.", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %s, got %s.", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadMultipleFiles(t *testing.T) {
+	teamA := `specs:
+- source:
+    project: proj-1
+    secret: secret-1
+  destination:
+    namespace: ns-a
+    secret: secret-a
+    key: key-a
+`
+	teamB := `specs:
+- source:
+    project: proj-2
+    secret: secret-2
+  destination:
+    namespace: ns-b
+    secret: secret-b
+    key: key-b
+`
+	teamBDuplicate := `specs:
+- source:
+    project: proj-2
+    secret: secret-2
+  destination:
+    namespace: ns-a
+    secret: secret-a
+    key: key-a
+`
+	var testcases = []struct {
+		name           string
+		files          map[string]string
+		load           func(config *SecretSyncConfig, dir string) error
+		expectLoadErr  bool
+		expectSecrets  []string
+		expectValidErr bool
+	}{
+		{
+			name:  "Two files in a dir. Should concatenate the specs in the order of the files.",
+			files: map[string]string{"b.yaml": teamB, "a.yaml": teamA, ".hidden.yaml": teamBDuplicate, "README.md": "not a config"},
+			load: func(config *SecretSyncConfig, dir string) error {
+				return config.LoadFromDir(dir)
+			},
+			expectSecrets: []string{"secret-1", "secret-2"},
+		},
+		{
+			name:  "Two files matching a glob. Should concatenate the specs in the order of the files.",
+			files: map[string]string{"team-b.yml": teamB, "team-a.yml": teamA, "other.yaml": teamBDuplicate},
+			load: func(config *SecretSyncConfig, dir string) error {
+				return config.LoadFromGlob(filepath.Join(dir, "team-*.yml"))
+			},
+			expectSecrets: []string{"secret-1", "secret-2"},
+		},
+		{
+			name:  "Glob pattern through Load(). Should concatenate the specs in the order of the files.",
+			files: map[string]string{"team-b.yaml": teamB, "team-a.yaml": teamA},
+			load: func(config *SecretSyncConfig, dir string) error {
+				return config.Load(filepath.Join(dir, "team-*.yaml"))
+			},
+			expectSecrets: []string{"secret-1", "secret-2"},
+		},
+		{
+			name:  "Same destination in two files. Should fail validation.",
+			files: map[string]string{"a.yaml": teamA, "b.yaml": teamBDuplicate},
+			load: func(config *SecretSyncConfig, dir string) error {
+				return config.LoadFromDir(dir)
+			},
+			expectSecrets:  []string{"secret-1", "secret-2"},
+			expectValidErr: true,
+		},
+		{
+			name:  "Glob matching no file. Should return error.",
+			files: map[string]string{"a.yaml": teamA},
+			load: func(config *SecretSyncConfig, dir string) error {
+				return config.LoadFromGlob(filepath.Join(dir, "team-*.yaml"))
+			},
+			expectLoadErr: true,
+		},
+		{
+			name:  "A file is not a dir. Should return error.",
+			files: map[string]string{"a.yaml": teamA},
+			load: func(config *SecretSyncConfig, dir string) error {
+				return config.LoadFromDir(filepath.Join(dir, "a.yaml"))
+			},
+			expectLoadErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, content := range tc.files {
+				err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config := &SecretSyncConfig{}
+			err = tc.load(config, dir)
+			if tc.expectLoadErr {
+				if err == nil {
+					t.Errorf("Failed to receive expected error.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			secrets := []string{}
+			for _, spec := range config.Specs {
+				secrets = append(secrets, spec.Source.Secret)
+			}
+			if !reflect.DeepEqual(secrets, tc.expectSecrets) {
+				t.Errorf("Expected specs of %v, but got %v.", tc.expectSecrets, secrets)
+			}
+
+			err = config.Validate()
+			if tc.expectValidErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectValidErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
 		})
 	}
 }
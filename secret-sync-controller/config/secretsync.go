@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+	"sort"
+	"strings"
+)
+
+// SecretSyncResource is the resource of the SecretSync custom resources,
+// each declaring a SecretSyncSpec in its spec field, for the secrets of its own namespace.
+var SecretSyncResource = schema.GroupVersionResource{
+	Group:    "secretsync.x-k8s.io",
+	Version:  "v1alpha1",
+	Resource: "secretsyncs",
+}
+
+// SourceProjects lists the projects of the Secret Manager secrets the SecretSync objects of each namespace may read,
+// since the controller reads them with its own credentials on behalf of whoever can create the objects.
+// The projects of the namespace "*" are allowed to the objects of all namespaces.
+type SourceProjects map[string][]string
+
+// ParseSourceProjects parses the comma-separated <namespace>=<project> entries of value, e.g. "team-a=proj-a,*=proj-shared".
+func ParseSourceProjects(value string) (SourceProjects, error) {
+	projects := SourceProjects{}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid entry %q, should be in format <namespace>=<project>", entry)
+		}
+		projects[parts[0]] = append(projects[parts[0]], parts[1])
+	}
+	return projects, nil
+}
+
+// Allows returns true if the SecretSync objects of namespace may read the secrets of project.
+func (p SourceProjects) Allows(namespace, project string) bool {
+	for _, allowed := range append(append([]string{}, p[namespace]...), p["*"]...) {
+		if allowed == project {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadFromSecretSyncs loads the specs of the SecretSync objects, see SecretSyncResource, in order of <namespace>/<name>.
+// The destination of each spec defaults to, and is restricted to, the namespace of its object,
+// and its sources are restricted to the projects allowed to the namespace by projects.
+// The specs writing into Secret Manager or reading with <credentialsFrom> are refused, as they would act with the controller's
+// Secret Manager permissions beyond reading the allowed projects.
+// Each spec is named <namespace>/<name> after its object, and the names in its DependsOn are qualified likewise
+// unless they hold a namespace already.
+// Objects with an invalid spec are logged and skipped, so that they don't block the specs of other namespaces.
+func (config *SecretSyncConfig) LoadFromSecretSyncs(objects []unstructured.Unstructured, projects SourceProjects) {
+	sorted := append([]unstructured.Unstructured{}, objects...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return secretSyncName(sorted[i]) < secretSyncName(sorted[j])
+	})
+
+	for _, obj := range sorted {
+		spec, err := secretSyncSpec(obj, projects)
+		if err != nil {
+			klog.Errorf("Fail to load SecretSync %s: %s", secretSyncName(obj), err)
+			continue
+		}
+		config.Specs = append(config.Specs, spec)
+	}
+}
+
+// secretSyncName returns <namespace>/<name> of the SecretSync object obj.
+func secretSyncName(obj unstructured.Unstructured) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// secretSyncSpec returns the validated spec declared by the SecretSync object obj, reading the projects allowed by projects only.
+func secretSyncSpec(obj unstructured.Unstructured, projects SourceProjects) (SecretSyncSpec, error) {
+	spec := SecretSyncSpec{}
+	fields, ok := obj.Object["spec"]
+	if !ok {
+		return spec, fmt.Errorf("Missing <spec> field.")
+	}
+	// the fields are converted through yaml, to share the yaml tags of the config files
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return spec, fmt.Errorf("Error marshalling <spec>: %s", err)
+	}
+	err = yaml.Unmarshal(data, &spec)
+	if err != nil {
+		return spec, fmt.Errorf("Error unmarshalling <spec>: %s", err)
+	}
+
+	namespace := obj.GetNamespace()
+	if spec.Destination.NamespaceRegex != "" {
+		return spec, fmt.Errorf("Field <namespaceRegex> for <destination> cannot be used in a SecretSync.")
+	}
+	if spec.Destination.Namespace == "" {
+		spec.Destination.Namespace = namespace
+	}
+	if spec.Destination.Namespace != namespace {
+		return spec, fmt.Errorf("Field <namespace> for <destination> should be the namespace of the SecretSync, %s.", namespace)
+	}
+
+	if spec.Direction.WritesSecretManager() {
+		return spec, fmt.Errorf("Field <direction> %s cannot be used in a SecretSync.", spec.Direction)
+	}
+	if spec.CredentialsFrom != nil {
+		return spec, fmt.Errorf("Field <credentialsFrom> cannot be used in a SecretSync.")
+	}
+	sources := []SecretManagerSpec{spec.Source}
+	for _, mapping := range spec.Mappings {
+		sources = append(sources, mapping.Source)
+	}
+	for _, source := range sources {
+		if source.Project != "" && !projects.Allows(namespace, source.Project) {
+			return spec, fmt.Errorf("Project %s of <source> is not allowed for the SecretSyncs of namespace %s.", source.Project, namespace)
+		}
+	}
+
+	spec.Name = secretSyncName(obj)
+	dependsOn := []string{}
+	for _, dep := range spec.DependsOn {
+		if !strings.Contains(dep, "/") {
+			dep = namespace + "/" + dep
+		}
+		dependsOn = append(dependsOn, dep)
+	}
+	if len(dependsOn) != 0 {
+		spec.DependsOn = dependsOn
+	}
+
+	return spec, spec.Validate()
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadFromSecretSyncs(t *testing.T) {
+	withDependsOn := newSecretSync("ns-b", "sync-b", "secret-2", "")
+	withDependsOn.Object["spec"].(map[string]interface{})["dependsOn"] = []interface{}{"sync-a", "ns-c/sync-c"}
+	withoutSpec := newSecretSync("ns-a", "sync-c", "secret-3", "")
+	delete(withoutSpec.Object, "spec")
+	reverse := newSecretSync("ns-a", "sync-d", "secret-4", "")
+	reverse.Object["spec"].(map[string]interface{})["direction"] = "reverse"
+	withCredentials := newSecretSync("ns-a", "sync-e", "secret-5", "")
+	withCredentials.Object["spec"].(map[string]interface{})["credentialsFrom"] = map[string]interface{}{"project": "proj-1", "secret": "key"}
+	withMappings := newSecretSync("ns-a", "sync-f", "", "")
+	delete(withMappings.Object["spec"].(map[string]interface{}), "source")
+	withMappings.Object["spec"].(map[string]interface{})["destination"].(map[string]interface{})["key"] = ""
+	withMappings.Object["spec"].(map[string]interface{})["mappings"] = []interface{}{
+		map[string]interface{}{"source": map[string]interface{}{"project": "proj-1", "secret": "secret-6"}, "key": "key-a"},
+		map[string]interface{}{"source": map[string]interface{}{"project": "proj-2", "secret": "secret-7"}, "key": "key-b"},
+	}
+
+	var testcases = []struct {
+		name            string
+		objects         []*unstructured.Unstructured
+		expectNames     []string
+		expectDependsOn [][]string
+	}{
+		{
+			name: "Destination namespace omitted. Should default to the namespace of the SecretSync, in order of names.",
+			objects: []*unstructured.Unstructured{
+				newSecretSync("ns-b", "sync", "secret-2", ""),
+				newSecretSync("ns-a", "sync", "secret-1", "ns-a"),
+			},
+			expectNames:     []string{"ns-a/sync", "ns-b/sync"},
+			expectDependsOn: [][]string{nil, nil},
+		},
+		{
+			name:            "Unqualified dependsOn. Should be qualified with the namespace of the SecretSync.",
+			objects:         []*unstructured.Unstructured{withDependsOn},
+			expectNames:     []string{"ns-b/sync-b"},
+			expectDependsOn: [][]string{{"ns-b/sync-a", "ns-c/sync-c"}},
+		},
+		{
+			name: "Destination in another namespace or missing spec. Should skip them only.",
+			objects: []*unstructured.Unstructured{
+				newSecretSync("ns-a", "sync-a", "secret-1", ""),
+				newSecretSync("ns-a", "sync-b", "secret-2", "ns-b"),
+				withoutSpec,
+			},
+			expectNames:     []string{"ns-a/sync-a"},
+			expectDependsOn: [][]string{nil},
+		},
+		{
+			name: "Source project allowed to another namespace only. Should skip its spec only.",
+			objects: []*unstructured.Unstructured{
+				newSecretSync("ns-a", "sync", "secret-1", ""),
+				newSecretSync("ns-c", "sync", "secret-2", ""),
+			},
+			expectNames:     []string{"ns-a/sync"},
+			expectDependsOn: [][]string{nil},
+		},
+		{
+			name:            "Mapping of a project not allowed to the namespace. Should skip its spec.",
+			objects:         []*unstructured.Unstructured{withMappings},
+			expectNames:     []string{},
+			expectDependsOn: [][]string{},
+		},
+		{
+			name:            "Reverse direction or credentialsFrom. Should skip them, as they go beyond reading the allowed projects.",
+			objects:         []*unstructured.Unstructured{reverse, withCredentials},
+			expectNames:     []string{},
+			expectDependsOn: [][]string{},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			objects := []unstructured.Unstructured{}
+			for _, obj := range tc.objects {
+				objects = append(objects, *obj)
+			}
+			config := &SecretSyncConfig{}
+			config.LoadFromSecretSyncs(objects, SourceProjects{"ns-a": {"proj-1"}, "ns-b": {"proj-1"}})
+
+			names := []string{}
+			dependsOn := [][]string{}
+			for _, spec := range config.Specs {
+				names = append(names, spec.Name)
+				dependsOn = append(dependsOn, spec.DependsOn)
+				if !strings.HasPrefix(spec.Name, spec.Destination.Namespace+"/") {
+					t.Errorf("Expected destination namespace of %s, but got %s.", spec.Name, spec.Destination.Namespace)
+				}
+			}
+			if !reflect.DeepEqual(names, tc.expectNames) {
+				t.Errorf("Expected specs %v, but got %v.", tc.expectNames, names)
+			}
+			if !reflect.DeepEqual(dependsOn, tc.expectDependsOn) {
+				t.Errorf("Expected dependsOn %v, but got %v.", tc.expectDependsOn, dependsOn)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
+)
+
+// Transform is a named built-in transformation of a secret value, applied between reading the source and writing the destination.
+type Transform string
+
+const (
+	// TransformTrim removes the leading and trailing white spaces, e.g. a trailing newline added by a tool.
+	TransformTrim Transform = "trim"
+	// TransformBase64Decode decodes a standard base64 encoded value.
+	TransformBase64Decode Transform = "base64decode"
+	// TransformBase64Encode encodes the value in standard base64.
+	TransformBase64Encode Transform = "base64encode"
+	// TransformJSONMinify removes the insignificant white spaces of a JSON value.
+	TransformJSONMinify Transform = "jsonminify"
+)
+
+// Validate returns error if the transform is not a known built-in.
+func (t Transform) Validate() error {
+	switch t {
+	case TransformTrim, TransformBase64Decode, TransformBase64Encode, TransformJSONMinify:
+		return nil
+	}
+	return fmt.Errorf("Unknown transform %q", t)
+}
+
+// Enum returns the known built-in transforms, for the config schema.
+func (t Transform) Enum() []string {
+	return []string{string(TransformTrim), string(TransformBase64Decode), string(TransformBase64Encode), string(TransformJSONMinify)}
+}
+
+// Apply returns the transformed data, or error if data cannot be transformed, e.g. invalid base64 or JSON.
+func (t Transform) Apply(data []byte) ([]byte, error) {
+	switch t {
+	case TransformTrim:
+		return bytes.TrimSpace(data), nil
+	case TransformBase64Decode:
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+		n, err := base64.StdEncoding.Decode(decoded, data)
+		if err != nil {
+			return nil, err
+		}
+		return decoded[:n], nil
+	case TransformBase64Encode:
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+		base64.StdEncoding.Encode(encoded, data)
+		return encoded, nil
+	case TransformJSONMinify:
+		var buf bytes.Buffer
+		err := json.Compact(&buf, data)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, t.Validate()
+}
+
+// ApplyTransforms applies transforms to data in order.
+// Returns data unchanged if transforms is empty, or error if any transform fails.
+// The errors never hold data nor its intermediate transformations, e.g. in a JSON syntax error.
+func ApplyTransforms(transforms []Transform, data []byte) ([]byte, error) {
+	values := [][]byte{data}
+	for _, t := range transforms {
+		transformed, err := t.Apply(data)
+		if err != nil {
+			return nil, fmt.Errorf("Fail to apply transform %s: %s", t, redact.Error(err, values...))
+		}
+		data = transformed
+		values = append(values, data)
+	}
+	return data, nil
+}
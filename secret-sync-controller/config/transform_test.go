@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestApplyTransforms(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		transforms []Transform
+		data       string
+		expected   string
+		expectErr  bool
+	}{
+		{
+			name:       "No transform.",
+			transforms: nil,
+			data:       " value\n",
+			expected:   " value\n",
+		},
+		{
+			name:       "Trim.",
+			transforms: []Transform{TransformTrim},
+			data:       " value\n",
+			expected:   "value",
+		},
+		{
+			name:       "Base64 decode.",
+			transforms: []Transform{TransformBase64Decode},
+			data:       "dmFsdWU=",
+			expected:   "value",
+		},
+		{
+			name:       "Invalid base64.",
+			transforms: []Transform{TransformBase64Decode},
+			data:       "value!",
+			expectErr:  true,
+		},
+		{
+			name:       "Base64 encode.",
+			transforms: []Transform{TransformBase64Encode},
+			data:       "value",
+			expected:   "dmFsdWU=",
+		},
+		{
+			name:       "JSON minify.",
+			transforms: []Transform{TransformJSONMinify},
+			data:       "{\n  \"key\": [1, 2],\n  \"other\": \"a b\"\n}\n",
+			expected:   `{"key":[1,2],"other":"a b"}`,
+		},
+		{
+			name:       "Invalid JSON.",
+			transforms: []Transform{TransformJSONMinify},
+			data:       "{\"key\":",
+			expectErr:  true,
+		},
+		{
+			name:       "Chained trim and base64 decode.",
+			transforms: []Transform{TransformTrim, TransformBase64Decode},
+			data:       "dmFsdWU=\n",
+			expected:   "value",
+		},
+		{
+			name:       "Chained base64 decode and JSON minify.",
+			transforms: []Transform{TransformBase64Decode, TransformJSONMinify},
+			data:       "eyAia2V5IjogMSB9",
+			expected:   `{"key":1}`,
+		},
+		{
+			name:       "Chain order matters. Should fail to decode before trimming.",
+			transforms: []Transform{TransformBase64Decode, TransformTrim},
+			data:       " dmFsdWU= ",
+			expectErr:  true,
+		},
+		{
+			name:       "Unknown transform.",
+			transforms: []Transform{"rot13"},
+			data:       "value",
+			expectErr:  true,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			actual, err := ApplyTransforms(tc.transforms, []byte(tc.data))
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got %q.", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !bytes.Equal(actual, []byte(tc.expected)) {
+				t.Errorf("Expected %q, got %q.", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	cron "gopkg.in/robfig/cron.v2"
+)
+
+// WriteWindow is a recurring maintenance window during which the destination of a spec may be written,
+// opening at each time Cron fires, evaluated in UTC like the refresh crons of the secret rotator, and closing Duration later.
+type WriteWindow struct {
+	Cron     string        `yaml:"cron"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+// schedule parses the cron of the window.
+func (w WriteWindow) schedule() (cron.Schedule, error) {
+	schedule, err := cron.Parse("TZ=UTC " + w.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cron %s: %v", w.Cron, err)
+	}
+	return schedule, nil
+}
+
+// Validate returns error if the cron of the window cannot be parsed or its duration is not positive.
+func (w WriteWindow) Validate() error {
+	if w.Duration <= 0 {
+		return fmt.Errorf("Invalid duration %s, must be positive", w.Duration)
+	}
+	_, err := w.schedule()
+	return err
+}
+
+// Open returns true if the window is open at now, i.e. the cron fired within Duration before now.
+// Otherwise, also returns the next time the window opens.
+func (w WriteWindow) Open(now time.Time) (bool, time.Time, error) {
+	schedule, err := w.schedule()
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	// the window is open if it last opened in (now-Duration, now]
+	opened := schedule.Next(now.Add(-w.Duration))
+	if !opened.After(now) {
+		return true, time.Time{}, nil
+	}
+	return false, opened, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteWindowOpen(t *testing.T) {
+	// daily from 02:00 to 04:00 UTC
+	window := WriteWindow{Cron: "0 0 2 * * *", Duration: 2 * time.Hour}
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var testcases = []struct {
+		name        string
+		now         time.Time
+		expectOpen  bool
+		expectOpens time.Time
+	}{
+		{
+			name:        "Before the window. Should be closed until it opens the same day.",
+			now:         day.Add(time.Hour),
+			expectOpen:  false,
+			expectOpens: day.Add(2 * time.Hour),
+		},
+		{
+			name:       "Window opening. Should be open.",
+			now:        day.Add(2 * time.Hour),
+			expectOpen: true,
+		},
+		{
+			name:       "Within the window. Should be open.",
+			now:        day.Add(3 * time.Hour),
+			expectOpen: true,
+		},
+		{
+			name:        "Window closing. Should be closed until it opens the next day.",
+			now:         day.Add(4 * time.Hour),
+			expectOpen:  false,
+			expectOpens: day.Add(26 * time.Hour),
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			open, opens, err := window.Open(tc.now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if open != tc.expectOpen || !opens.Equal(tc.expectOpens) {
+				t.Errorf("Expected (%v, %s), but got (%v, %s).", tc.expectOpen, tc.expectOpens, open, opens)
+			}
+		})
+	}
+}
+
+func TestWriteWindowValidate(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		window    WriteWindow
+		expectErr bool
+	}{
+		{
+			name:      "Valid window.",
+			window:    WriteWindow{Cron: "0 0 2 * * *", Duration: time.Hour},
+			expectErr: false,
+		},
+		{
+			name:      "Invalid cron. Should return error.",
+			window:    WriteWindow{Cron: "every night", Duration: time.Hour},
+			expectErr: true,
+		},
+		{
+			name:      "Missing duration. Should return error.",
+			window:    WriteWindow{Cron: "0 0 2 * * *"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			err := tc.window.Validate()
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"strings"
+)
+
+// syncState is the state of the last bidirectional sync of a key, recorded in its client.SyncStateAnnotation().
+// The value is only recorded by its checksum, next to the value itself in the secret.
+type syncState struct {
+	Version  string
+	Checksum string
+}
+
+func (s syncState) String() string {
+	return s.Version + ":" + s.Checksum
+}
+
+// stateChecksum returns the truncated sha256 of data recorded in a syncState.
+// It is longer than redact.Sum as it is never logged, and its length is kept so that the recorded states stay comparable.
+func stateChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// parseSyncState parses the <version>:<checksum> of value. The zero syncState is returned if value is malformed.
+func parseSyncState(value string) syncState {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return syncState{}
+	}
+	return syncState{Version: parts[0], Checksum: parts[1]}
+}
+
+// bidirectionalSyncPair sychronizes the secret values of pair.Source and pair.Destination both ways.
+// The side that changed since the last sync, by the state recorded in the destination secret, is synced into the other.
+// If both changed, or no state is recorded, the conflict is resolved by pair.ConflictPolicy.
+// A missing side is synced from the other one, and the state is recorded after each sync.
+// Returns true if either side is updated, and the synced version of pair.Source.
+// Returns errWindowClosed instead of writing if writable is false.
+func (c *SecretSyncController) bidirectionalSyncPair(ctx context.Context, pair config.SecretSyncSpec, writable bool) (bool, string, error) {
+	// get the Secret Manager secret value, nil if the secret doesn't exist yet
+	_, span := trace.StartSpan(ctx, gsmReadSpan)
+	span.AddAttributes(trace.StringAttribute("source", pair.Source.String()))
+	gsmData, version, err := c.Client.GetSecretManagerSecretVersion(pair.Source.Project, pair.Source.Secret)
+	if status.Code(err) == codes.NotFound {
+		gsmData, err = nil, nil
+	}
+	endSpan(span, err)
+	if err != nil {
+		return false, "", err
+	}
+
+	// get the Kubernetes secret value, nil if the key doesn't exist yet
+	_, span = trace.StartSpan(ctx, k8sReadSpan)
+	span.AddAttributes(trace.StringAttribute("destination", pair.Destination.String()))
+	k8sData, err := c.Client.GetKubernetesSecretValue(pair.Destination.Namespace, pair.Destination.Secret, pair.Destination.Key)
+	endSpan(span, err)
+	if err != nil {
+		return false, "", err
+	}
+
+	if gsmData == nil && k8sData == nil {
+		return false, "", fmt.Errorf("Neither %s nor %s found", pair.Source, pair.Destination)
+	}
+	if gsmData != nil {
+		gsmData, err = pair.EqualityMode.Normalize(gsmData)
+		if err != nil {
+			return false, "", fmt.Errorf("Fail to normalize %s as %s: %s", pair.Source, pair.EqualityMode, err)
+		}
+	}
+	if k8sData != nil {
+		k8sData, err = pair.EqualityMode.Normalize(k8sData)
+		if err != nil {
+			return false, "", fmt.Errorf("Fail to normalize %s as %s: %s", pair.Destination, pair.EqualityMode, err)
+		}
+	}
+
+	state, err := c.getSyncState(pair.Destination)
+	if err != nil {
+		return false, "", err
+	}
+
+	var toK8s bool
+	switch {
+	case k8sData == nil:
+		toK8s = true
+	case gsmData == nil:
+		toK8s = false
+	case pair.EqualityMode.Equal(gsmData, k8sData):
+		// in sync, possibly changed the same way on both sides
+		synced := syncState{Version: version, Checksum: stateChecksum(k8sData)}
+		if state != synced {
+			err = c.setSyncState(pair.Destination, synced)
+			if err != nil {
+				return false, "", err
+			}
+		}
+		return false, version, nil
+	default:
+		gsmChanged := state.Version != version
+		k8sChanged := state.Checksum != stateChecksum(k8sData)
+		if gsmChanged != k8sChanged {
+			toK8s = gsmChanged
+			break
+		}
+		toK8s, err = c.resolveConflict(pair, version)
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	if !writable {
+		return false, "", errWindowClosed
+	}
+
+	synced := syncState{Version: version}
+	if toK8s {
+		if c.RefuseUnmanaged {
+			err = c.checkManaged(pair.Destination)
+			if err != nil {
+				return false, "", err
+			}
+		}
+
+		_, span = trace.StartSpan(ctx, k8sWriteSpan)
+		span.AddAttributes(trace.StringAttribute("destination", pair.Destination.String()))
+		err = c.upsertDestination(pair.Destination, gsmData, sourceIdentity(pair, version))
+		// the client errors may echo the written value, e.g. in a rejected patch
+		err = redact.Error(err, gsmData, k8sData)
+		endSpan(span, err)
+		if err != nil {
+			return false, "", err
+		}
+		synced.Checksum = stateChecksum(gsmData)
+	} else {
+		_, span = trace.StartSpan(ctx, gsmWriteSpan)
+		span.AddAttributes(trace.StringAttribute("source", pair.Source.String()))
+		err = c.Client.UpsertReplicatedSecretManagerSecret(pair.Source.Project, pair.Source.Secret, pair.Replication.Locations, k8sData)
+		// the client errors may echo the written value
+		err = redact.Error(err, k8sData, gsmData)
+		endSpan(span, err)
+		if err != nil {
+			return false, "", err
+		}
+
+		_, synced.Version, err = c.Client.GetSecretManagerSecretVersion(pair.Source.Project, pair.Source.Secret)
+		if err != nil {
+			return true, "", fmt.Errorf("Fail to get the version of %s: %s", pair.Source, redact.Error(err, k8sData))
+		}
+		synced.Checksum = stateChecksum(k8sData)
+	}
+
+	err = c.setSyncState(pair.Destination, synced)
+	if err != nil {
+		return true, "", err
+	}
+	return true, synced.Version, nil
+}
+
+// resolveConflict returns true if the Secret Manager side of pair wins the conflict by pair.ConflictPolicy,
+// where version is the latest version of pair.Source.
+func (c *SecretSyncController) resolveConflict(pair config.SecretSyncSpec, version string) (bool, error) {
+	syncConflicts.WithLabelValues(pair.Source.String()).Inc()
+
+	gsmWins := true
+	switch pair.ConflictPolicy {
+	case config.ConflictK8sWins:
+		gsmWins = false
+	case config.ConflictNewestWins:
+		gsmTime, err := c.Client.GetSecretManagerSecretCreateTime(pair.Source.Project, pair.Source.Secret, version)
+		if err != nil {
+			return false, fmt.Errorf("Fail to get the create time of %s: %s", pair.Source, err)
+		}
+		k8sTime, err := c.Client.GetKubernetesSecretKeyUpdateTime(pair.Destination.Namespace, pair.Destination.Secret, pair.Destination.Key)
+		if err != nil {
+			return false, fmt.Errorf("Fail to get the update time of %s: %s", pair.Destination, err)
+		}
+		// Secret Manager wins the ties, as with the default policy
+		gsmWins = !k8sTime.After(gsmTime)
+	}
+
+	winner := pair.Source.String()
+	if !gsmWins {
+		winner = pair.Destination.String()
+	}
+	klog.Warningf("Secrets %s and %s both changed since their last sync. Syncing from %s by the %s policy...", pair.Source, pair.Destination, winner, pair.ConflictPolicy)
+	return gsmWins, nil
+}
+
+// getSyncState returns the state of the last bidirectional sync of dest,
+// or the zero syncState if none is recorded, e.g. if the destination secret doesn't exist.
+func (c *SecretSyncController) getSyncState(dest config.KubernetesSpec) (syncState, error) {
+	annotations, err := c.Client.GetKubernetesSecretAnnotations(dest.Namespace, dest.Secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return syncState{}, nil
+		}
+		return syncState{}, fmt.Errorf("Fail to get annotations of %s: %s", dest, err)
+	}
+	return parseSyncState(annotations[client.SyncStateAnnotation(dest.Key)]), nil
+}
+
+// setSyncState records state as the state of the last bidirectional sync of dest.
+func (c *SecretSyncController) setSyncState(dest config.KubernetesSpec, state syncState) error {
+	err := c.Client.AnnotateKubernetesSecret(dest.Namespace, dest.Secret, map[string]string{
+		client.SyncStateAnnotation(dest.Key): state.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("Fail to record the sync state of %s: %s", dest, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+	"time"
+)
+
+func TestBidirectionalSync(t *testing.T) {
+	now := time.Now()
+	updateGSM := func(cl *tests.MockClient, value string, createTime time.Time) error {
+		err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte(value))
+		cl.SetSecretManagerSecretCreateTime("project-1", "gsm-token", createTime)
+		return err
+	}
+	updateK8s := func(cl *tests.MockClient, value string, updateTime time.Time) error {
+		err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte(value))
+		cl.SetKubernetesSecretKeyUpdateTime("ns-a", "secret-a", "key-a", updateTime)
+		return err
+	}
+
+	var testcases = []struct {
+		name          string
+		policy        config.ConflictPolicy
+		mutate        func(cl *tests.MockClient) error
+		expectUpdated bool
+		expectValue   string
+	}{
+		{
+			name:          "Unchanged. Should not update.",
+			mutate:        func(cl *tests.MockClient) error { return nil },
+			expectUpdated: false,
+			expectValue:   "gsm-token-v1",
+		},
+		{
+			name:   "Secret Manager changed. Should sync into Kubernetes regardless of the policy.",
+			policy: config.ConflictK8sWins,
+			mutate: func(cl *tests.MockClient) error {
+				return updateGSM(cl, "gsm-token-v2", now)
+			},
+			expectUpdated: true,
+			expectValue:   "gsm-token-v2",
+		},
+		{
+			name:   "Kubernetes changed. Should sync into Secret Manager regardless of the policy.",
+			policy: config.ConflictGSMWins,
+			mutate: func(cl *tests.MockClient) error {
+				return updateK8s(cl, "k8s-token-v2", now)
+			},
+			expectUpdated: true,
+			expectValue:   "k8s-token-v2",
+		},
+		{
+			name:   "Both changed with the default policy. Should sync from Secret Manager.",
+			policy: "",
+			mutate: func(cl *tests.MockClient) error {
+				if err := updateGSM(cl, "gsm-token-v2", now); err != nil {
+					return err
+				}
+				return updateK8s(cl, "k8s-token-v2", now.Add(time.Minute))
+			},
+			expectUpdated: true,
+			expectValue:   "gsm-token-v2",
+		},
+		{
+			name:   "Both changed with k8s-wins. Should sync from Kubernetes.",
+			policy: config.ConflictK8sWins,
+			mutate: func(cl *tests.MockClient) error {
+				if err := updateGSM(cl, "gsm-token-v2", now.Add(time.Minute)); err != nil {
+					return err
+				}
+				return updateK8s(cl, "k8s-token-v2", now)
+			},
+			expectUpdated: true,
+			expectValue:   "k8s-token-v2",
+		},
+		{
+			name:   "Both changed with newest-wins, Kubernetes written last. Should sync from Kubernetes.",
+			policy: config.ConflictNewestWins,
+			mutate: func(cl *tests.MockClient) error {
+				if err := updateGSM(cl, "gsm-token-v2", now); err != nil {
+					return err
+				}
+				return updateK8s(cl, "k8s-token-v2", now.Add(time.Minute))
+			},
+			expectUpdated: true,
+			expectValue:   "k8s-token-v2",
+		},
+		{
+			name:   "Both changed with newest-wins, Secret Manager written last. Should sync from Secret Manager.",
+			policy: config.ConflictNewestWins,
+			mutate: func(cl *tests.MockClient) error {
+				if err := updateGSM(cl, "gsm-token-v2", now.Add(time.Minute)); err != nil {
+					return err
+				}
+				return updateK8s(cl, "k8s-token-v2", now)
+			},
+			expectUpdated: true,
+			expectValue:   "gsm-token-v2",
+		},
+		{
+			name:   "Both changed with newest-wins, another key of the secret written last. Should sync from Secret Manager.",
+			policy: config.ConflictNewestWins,
+			mutate: func(cl *tests.MockClient) error {
+				if err := updateGSM(cl, "gsm-token-v2", now.Add(time.Minute)); err != nil {
+					return err
+				}
+				if err := updateK8s(cl, "k8s-token-v2", now); err != nil {
+					return err
+				}
+				err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-b", []byte("unrelated"))
+				cl.SetKubernetesSecretKeyUpdateTime("ns-a", "secret-a", "key-b", now.Add(2*time.Minute))
+				return err
+			},
+			expectUpdated: true,
+			expectValue:   "gsm-token-v2",
+		},
+		{
+			name:   "Missing Kubernetes secret. Should sync from Secret Manager.",
+			policy: config.ConflictK8sWins,
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteKubernetesSecret("ns-a", "secret-a")
+			},
+			expectUpdated: true,
+			expectValue:   "gsm-token-v1",
+		},
+		{
+			name:   "Missing Secret Manager secret. Should sync from Kubernetes.",
+			policy: config.ConflictGSMWins,
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteSecretManagerSecret("project-1", "gsm-token")
+			},
+			expectUpdated: true,
+			expectValue:   "gsm-token-v1",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			spec := verifySpec
+			spec.Direction = config.DirectionBidirectional
+			spec.ConflictPolicy = tc.policy
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			// the first sync records the state of the values in sync
+			updated, err := controller.Sync(spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if updated {
+				t.Errorf("Expected no update of the values in sync.")
+			}
+
+			err = tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			updated, err = controller.Sync(spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if updated != tc.expectUpdated {
+				t.Errorf("Expected updated %v, but got %v.", tc.expectUpdated, updated)
+			}
+
+			gsmValue, err := cl.GetSecretManagerSecretValue("project-1", "gsm-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			k8sValue, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(gsmValue) != tc.expectValue || string(k8sValue) != tc.expectValue {
+				t.Errorf("Expected both sides to be %s, but got %s in Secret Manager and %s in Kubernetes.", tc.expectValue, gsmValue, k8sValue)
+			}
+
+			// the state recorded by the sync keeps the sides in sync
+			updated, err = controller.Sync(spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if updated {
+				t.Errorf("Expected the synced sides to be left unchanged.")
+			}
+		})
+	}
+}
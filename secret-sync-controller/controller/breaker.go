@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+)
+
+// maxBreakerBackoff is the maximum number of SyncAll() cycles skipped while the circuit breaker is open.
+const maxBreakerBackoff = 16
+
+// breaker is the circuit breaker of the Kubernetes API if BreakerThreshold is set.
+// It opens after BreakerThreshold consecutive specs failed by an unavailable Kubernetes API,
+// skipping the rest of the cycle and the next cycles with backoff, then lets the next cycle try again.
+type breaker struct {
+	// failures is the number of consecutive specs failed by an unavailable Kubernetes API.
+	failures int
+	// trips is the number of times the breaker opened since the last spec reaching the Kubernetes API.
+	trips int
+	// skip is the number of cycles to skip before trying the Kubernetes API again.
+	skip int
+}
+
+// open returns true if the current cycle should be skipped, counting down the backoff.
+func (b *breaker) open() bool {
+	if b.skip == 0 {
+		return false
+	}
+	b.skip--
+	return true
+}
+
+// record records the result of a spec, and returns true if the breaker trips,
+// i.e. threshold consecutive specs failed by an unavailable Kubernetes API.
+// The backoff doubles with each trip without a spec reaching the Kubernetes API, up to maxBreakerBackoff cycles.
+func (b *breaker) record(err error, threshold int) bool {
+	if err == nil {
+		b.failures = 0
+		b.trips = 0
+		return false
+	}
+	if !isAPIUnavailable(err) {
+		// failures of the sources say nothing about the Kubernetes API
+		return false
+	}
+
+	b.failures++
+	if b.failures < threshold {
+		return false
+	}
+
+	b.failures = 0
+	b.trips++
+	b.skip = maxBreakerBackoff
+	if b.trips <= 4 {
+		b.skip = 1 << uint(b.trips-1)
+	}
+	return true
+}
+
+// isAPIUnavailable returns true if err, or any error it aggregates, is returned by an unavailable Kubernetes API,
+// i.e. a timeout, an overloaded or failing API server, or a network error reaching it.
+func isAPIUnavailable(err error) bool {
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		for _, e := range agg.Errors() {
+			if isAPIUnavailable(e) {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsTooManyRequests(err)
+}
+
+// breakerOpen returns true if SyncAll() should skip the current cycle, and updates the breaker metric.
+func (c *SecretSyncController) breakerOpen() bool {
+	if c.BreakerThreshold <= 0 {
+		return false
+	}
+	if !c.breaker.open() {
+		breakerState.Set(0)
+		return false
+	}
+	breakerState.Set(1)
+	klog.Warningf("Kubernetes API circuit breaker open. Sync cycle skipped, %d more to skip.", c.breaker.skip)
+	return true
+}
+
+// recordBreaker records the result of a spec synced by SyncAll(),
+// and returns true if the rest of the cycle should be skipped.
+func (c *SecretSyncController) recordBreaker(err error) bool {
+	if c.BreakerThreshold <= 0 || !c.breaker.record(err, c.BreakerThreshold) {
+		return false
+	}
+	breakerTrips.Inc()
+	breakerState.Set(1)
+	klog.Errorf("Kubernetes API circuit breaker tripped after %d consecutive failures. Skipping the next %d sync cycles.", c.BreakerThreshold, c.breaker.skip)
+	return true
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+)
+
+// outageClient fails the reads of kubernetes secrets while down, as an unavailable API server would.
+type outageClient struct {
+	*tests.MockClient
+	down  bool
+	calls int
+}
+
+func (cl *outageClient) GetKubernetesSecretValue(namespace, id, key string) ([]byte, error) {
+	cl.calls++
+	if cl.down {
+		return nil, apierrors.NewServiceUnavailable("apiserver down")
+	}
+	return cl.MockClient.GetKubernetesSecretValue(namespace, id, key)
+}
+
+func TestSyncAllBreaker(t *testing.T) {
+	// each step is a SyncAll() cycle against 5 specs, with a threshold of 2 consecutive failures
+	var steps = []struct {
+		name          string
+		down          bool
+		expectCalls   int
+		expectFailed  int
+		expectSkipped int
+		expectUpdated int
+		expectOpen    float64
+	}{
+		{
+			name:          "API down. Should trip after 2 failures and skip the rest of the cycle.",
+			down:          true,
+			expectCalls:   2,
+			expectFailed:  2,
+			expectSkipped: 3,
+			expectOpen:    1,
+		},
+		{
+			name:          "Breaker open. Should skip the cycle.",
+			down:          true,
+			expectSkipped: 5,
+			expectOpen:    1,
+		},
+		{
+			name:          "API still down after backoff. Should trip again.",
+			down:          true,
+			expectCalls:   2,
+			expectFailed:  2,
+			expectSkipped: 3,
+			expectOpen:    1,
+		},
+		{
+			name:          "API recovered, breaker open. Should skip the cycle with doubled backoff.",
+			expectSkipped: 5,
+			expectOpen:    1,
+		},
+		{
+			name:          "API recovered, breaker still open. Should skip the cycle.",
+			expectSkipped: 5,
+			expectOpen:    1,
+		},
+		{
+			name:          "API recovered after backoff. Should sync all specs.",
+			expectCalls:   5,
+			expectUpdated: 5,
+			expectOpen:    0,
+		},
+	}
+
+	cl := &outageClient{MockClient: tests.NewMockClient([]string{"project-1"})}
+	err := cl.CreateKubernetesNamespace("ns-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := []config.SecretSyncSpec{}
+	for i := 0; i < 5; i++ {
+		err := cl.UpsertSecretManagerSecret("project-1", fmt.Sprintf("gsm-%d", i), []byte("value"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		specs = append(specs, config.SecretSyncSpec{
+			Source: config.SecretManagerSpec{
+				Project: "project-1",
+				Secret:  fmt.Sprintf("gsm-%d", i),
+			},
+			Destination: config.KubernetesSpec{
+				Namespace: "ns-a",
+				Secret:    fmt.Sprintf("secret-%d", i),
+				Key:       "key",
+			},
+		})
+	}
+
+	controller := &SecretSyncController{
+		Client:           cl,
+		Agent:            &config.Agent{},
+		BreakerThreshold: 2,
+	}
+	controller.Agent.Set(&config.SecretSyncConfig{Specs: specs})
+
+	trips := testutil.ToFloat64(breakerTrips)
+	for _, step := range steps {
+		cl.down = step.down
+		cl.calls = 0
+		summary := controller.SyncAll()
+
+		if cl.calls != step.expectCalls {
+			t.Errorf("%s: Expected %d Kubernetes reads, but got %d.", step.name, step.expectCalls, cl.calls)
+		}
+		if len(summary.Failed) != step.expectFailed || summary.Skipped != step.expectSkipped || summary.Updated != step.expectUpdated {
+			t.Errorf("%s: Expected %d failed, %d skipped and %d updated specs, but got %+v.", step.name, step.expectFailed, step.expectSkipped, step.expectUpdated, summary)
+		}
+		if open := testutil.ToFloat64(breakerState); open != step.expectOpen {
+			t.Errorf("%s: Expected breaker state %v, but got %v.", step.name, step.expectOpen, open)
+		}
+	}
+
+	if delta := testutil.ToFloat64(breakerTrips) - trips; delta != 2 {
+		t.Errorf("Expected 2 breaker trips, but got %v.", delta)
+	}
+}
+
+func TestSyncAllBreakerIgnoresSourceFailures(t *testing.T) {
+	cl := &outageClient{MockClient: tests.NewMockClient([]string{"project-1"})}
+	err := cl.CreateKubernetesNamespace("ns-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := []config.SecretSyncSpec{}
+	for i := 0; i < 3; i++ {
+		// missing sources fail before reaching the Kubernetes API
+		specs = append(specs, config.SecretSyncSpec{
+			Source: config.SecretManagerSpec{
+				Project: "project-1",
+				Secret:  fmt.Sprintf("missing-%d", i),
+			},
+			Destination: config.KubernetesSpec{
+				Namespace: "ns-a",
+				Secret:    fmt.Sprintf("secret-%d", i),
+				Key:       "key",
+			},
+		})
+	}
+
+	controller := &SecretSyncController{
+		Client:           cl,
+		Agent:            &config.Agent{},
+		BreakerThreshold: 1,
+	}
+	controller.Agent.Set(&config.SecretSyncConfig{Specs: specs})
+
+	summary := controller.SyncAll()
+	if len(summary.Failed) != 3 || summary.Skipped != 0 {
+		t.Errorf("Expected 3 failed and 0 skipped specs, but got %+v.", summary)
+	}
+}
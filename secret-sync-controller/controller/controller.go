@@ -14,11 +14,21 @@ limitations under the License.
 package controller
 
 import (
-	"bytes"
+	"context"
+	"fmt"
+	"go.opencensus.io/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/audit"
+	"sigs.k8s.io/k8s-gsm-tools/leaderelect"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 type SecretSyncController struct {
@@ -26,19 +36,218 @@ type SecretSyncController struct {
 	Agent        *config.Agent
 	RunOnce      bool
 	ResyncPeriod time.Duration
+	// MaxSpecsPerCycle caps the number of specs synced by each SyncAll() call.
+	// Specs are processed in a round-robin manner, so that all specs are covered over multiple cycles.
+	// All specs are synced in each cycle if MaxSpecsPerCycle <= 0.
+	MaxSpecsPerCycle int
+	// AnnotateSource records the source secret version of each synced key
+	// in the client.SourceAnnotation(key) annotation of the destination secret, even if the key is unchanged.
+	// The keys written are annotated with their source in any case.
+	AnnotateSource bool
+	// VerifyPeriod is the period of VerifyAll(), independent of ResyncPeriod.
+	// Drift verification is disabled if VerifyPeriod <= 0.
+	VerifyPeriod time.Duration
+	// AutoRemediate re-syncs the specs found drifted by VerifyAll(), recreating their managed destination secrets of a drifted type.
+	AutoRemediate bool
+	// MaxDriftCycles stops Start() with ErrPersistentDrift once a spec is found drifted by MaxDriftCycles consecutive VerifyAll() calls,
+	// e.g. to fail the canary of a controller upgrade. The drifts reconciled in between, e.g. by the syncs, are tolerated.
+	// Disabled if <= 0.
+	MaxDriftCycles int
+	// InstanceID identifies this controller instance in the client.LastWriterAnnotation of the secrets it writes.
+	// The annotation is not written if InstanceID is empty.
+	InstanceID string
+	// Manifest skips the specs whose sources have not changed since their last successful sync, on the first cycle after its Load().
+	// All specs are synced if Manifest is nil.
+	Manifest *HashManifest
+	// Resources writes the destinations of custom resources specified by KubernetesSpec.Resource.
+	// Specs with resource destinations fail to sync if Resources is nil.
+	Resources *client.ResourceClient
+	// WaitForNamespace keeps the specs whose destination namespace does not exist yet pending,
+	// instead of failing them, and retries them with backoff until another process creates the namespace.
+	WaitForNamespace bool
+	// RefuseUnmanaged refuses to write into existing destination secrets without the client.ManagedByLabel,
+	// e.g. hand-created or owned by another controller, failing their sync with ErrUnmanagedDestination.
+	RefuseUnmanaged bool
+	// AdoptUnmanaged stamps the client.ManagedByLabel on unmanaged destination secrets refused by RefuseUnmanaged,
+	// and writes into them.
+	AdoptUnmanaged bool
+	// NoOpVerbosity is the klog verbosity of the "checked, no change" logs of the synced keys,
+	// so that they can be enabled without the noise of the most verbose logs.
+	// Defaults to defaultNoOpVerbosity if <= 0.
+	NoOpVerbosity klog.Level
+	// StatusAnnotations records the time, the result and the source versions of each Sync() of a spec
+	// in the client.LastSyncTimeAnnotation, client.LastResultAnnotation and client.SourceVersionAnnotation
+	// annotations of its destination secret, so that the secret is self-describing, e.g. for kubectl-only debugging.
+	StatusAnnotations bool
+	// Prune deletes the destination secrets of the specs removed from the config, see PruneRemoved().
+	Prune bool
+	// PruneKeys removes the keys of the removed specs from the destination secrets that Prune keeps,
+	// as they hold keys of the current specs or of other writers.
+	PruneKeys bool
+	// Credentials creates the clients reading the sources of specs with CredentialsFrom.
+	// Specs with CredentialsFrom fail to sync if Credentials is nil.
+	Credentials *client.CredentialsCache
+	// MaxSourceBytes bounds the size of the source values read from Secret Manager, whatever the destination,
+	// failing the sync of larger values with ErrSourceTooLarge before they are transformed or written.
+	// Defaults to DefaultMaxSourceBytes if <= 0.
+	MaxSourceBytes int
+	// BreakerThreshold is the number of consecutive specs failed by an unavailable Kubernetes API
+	// after which SyncAll() skips the rest of its cycle, and the next cycles with backoff, instead of timing out on each spec.
+	// The circuit breaker is disabled if BreakerThreshold <= 0.
+	BreakerThreshold int
+	// Subscriber triggers an immediate Sync() of the specs sourcing from the notified secrets,
+	// while SyncAll() keeps running every ResyncPeriod as a safety net. Disabled if nil.
+	Subscriber Subscriber
+	// DestinationWatcher triggers an immediate Sync() of the specs writing to the secrets edited or deleted outside of the controller,
+	// restoring their values within seconds instead of at the next SyncAll(). Disabled if nil.
+	DestinationWatcher DestinationWatcher
+	// Encrypter encrypts the values of the destinations with KubernetesSpec.EnvelopeEncrypt, see EnvelopePrefix.
+	// Specs with envelope encryption fail to sync if Encrypter is nil.
+	Encrypter Encrypter
+	// AuditLogger records each Sync() writing, deferring or failing to write a destination in the audit trail.
+	// The syncs finding the destination unchanged are not recorded. Auditing is disabled if nil.
+	AuditLogger *audit.Logger
+	// LeaderElection runs the loop of Start() only while holding its lease if set,
+	// so that several replicas can run without double-writing secrets. The followers wait for the lease.
+	LeaderElection *leaderelect.Config
+
+	// resync queues the SyncAll() requests of ResyncHandler() to the loop of Start().
+	resync     chan chan SyncSummary
+	resyncOnce sync.Once
+
+	// covered tracks the specs that have been synced in the current round-robin round.
+	// It is keyed by spec identity, so that the round survives config reloads.
+	covered map[config.SpecID]bool
+	// pending tracks the specs waiting for their destination namespace if WaitForNamespace is set.
+	pending map[config.SpecID]*pendingSpec
+	// previous tracks the specs of the previous SyncAll() call if Prune is set, to detect the removed specs.
+	previous map[config.SpecID]config.SecretSyncSpec
+	// namespaces are the namespaces listed last by ExpandSpecs(), used if listing them fails.
+	namespaces []string
+	// drifted counts the consecutive VerifyAll() calls finding each spec drifted.
+	drifted map[config.SpecID]int
+	// breaker is the state of the Kubernetes API circuit breaker if BreakerThreshold is set.
+	breaker breaker
+	// deferred tracks the changes held until the write windows of their specs open.
+	deferred     map[config.SpecID]PendingWrite
+	deferredLock sync.Mutex
+	// now returns the current time if set, e.g. a fake clock in tests.
+	now func() time.Time
+	// cycled is called with the summary of each scheduled SyncAll() of Start() if set, e.g. to wait for the initial cycle in tests.
+	cycled func(SyncSummary)
+}
+
+// defaultNoOpVerbosity is the klog verbosity of the no-op logs if NoOpVerbosity is unset.
+const defaultNoOpVerbosity klog.Level = 3
+
+// DefaultMaxSourceBytes is the maximum size of the source values if MaxSourceBytes is unset,
+// the size limit of a Kubernetes secret, well above the 64KiB limit of a Secret Manager payload.
+const DefaultMaxSourceBytes = 1 << 20
+
+// ErrUnmanagedDestination is returned by Sync() if RefuseUnmanaged is set
+// and the destination secret exists without the client.ManagedByLabel.
+type ErrUnmanagedDestination struct {
+	Namespace string
+	Secret    string
+	// Manager is the expected value of the client.ManagedByLabel.
+	Manager string
+}
+
+func (e *ErrUnmanagedDestination) Error() string {
+	return fmt.Sprintf("Secret namespaces/%s/secrets/%s is not managed by %s", e.Namespace, e.Secret, e.Manager)
+}
+
+// ErrSourceTooShort is returned by Sync() if the value of a source is shorter than its MinLength,
+// e.g. truncated or partially written upstream. The destination keeps its previous value.
+type ErrSourceTooShort struct {
+	Source config.SecretManagerSpec
+	Length int
+}
+
+func (e *ErrSourceTooShort) Error() string {
+	return fmt.Sprintf("Secret %s is %d bytes long, shorter than its minimum length of %d bytes", e.Source, e.Length, e.Source.MinLength)
+}
+
+// ErrSourceTooLarge is returned by Sync() if the value of a source is larger than MaxSourceBytes,
+// e.g. a misconfigured source pointing at a bulk payload. The destination keeps its previous value.
+type ErrSourceTooLarge struct {
+	Source config.SecretManagerSpec
+	Length int
+	Max    int
+}
+
+func (e *ErrSourceTooLarge) Error() string {
+	return fmt.Sprintf("Secret %s is %d bytes long, larger than the maximum of %d bytes", e.Source, e.Length, e.Max)
+}
+
+// maxNamespaceBackoff is the maximum number of SyncAll() cycles between two namespace checks of a pending spec.
+const maxNamespaceBackoff = 16
+
+// pendingSpec is the backoff state of a spec waiting for its destination namespace.
+type pendingSpec struct {
+	// attempts is the number of namespace checks that found the namespace missing.
+	attempts int
+	// skip is the number of cycles to skip before the next namespace check.
+	skip int
 }
 
 // Start starts the secret sync controller in continuous mode.
-// stops when stop sinal is received from stopChan.
+// SyncAll() runs every ResyncPeriod, VerifyAll() every VerifyPeriod if set, and SyncNotified() on each notification of Subscriber if set.
+// SyncChanged() runs on each change seen by DestinationWatcher if set.
+// The requests of ResyncHandler() run SyncAll() in the same loop, so that they never overlap a running cycle.
+// stops when stop sinal is received from stopChan, or with ErrPersistentDrift if MaxDriftCycles is set.
+// With LeaderElection, the loop waits for the lease, and stops with an error once the lease is lost.
 func (c *SecretSyncController) Start(stopChan <-chan struct{}) error {
-	runChan := make(chan struct{})
+	if c.LeaderElection != nil {
+		return c.LeaderElection.Run(stopChan, c.start)
+	}
+	return c.start(stopChan)
+}
 
-	go func() {
-		for {
-			runChan <- struct{}{}
-			time.Sleep(c.ResyncPeriod)
+// start runs the loop of Start() until stopChan is closed.
+func (c *SecretSyncController) start(stopChan <-chan struct{}) error {
+	if c.Manifest != nil {
+		err := c.Manifest.Load(c.Client)
+		if err != nil {
+			// fall back to syncing all specs
+			klog.Errorf("Fail to load manifest: %s", err)
 		}
-	}()
+	}
+
+	// done stops the scheduling goroutines once Start returns, including in RunOnce mode
+	done := make(chan struct{})
+	defer close(done)
+
+	runChan := schedule(0, c.ResyncPeriod, done, func() {
+		cycleOverruns.WithLabelValues("sync").Inc()
+		klog.Warningf("Sync cycle overran the resync period of %s. Tick dropped.", c.ResyncPeriod)
+	})
+
+	// a nil channel never fires, which disables the notifications
+	var notifyChan <-chan string
+	if c.Subscriber != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		notifyChan = c.receive(ctx)
+	}
+
+	// a nil channel never fires, which disables the watch of the destinations
+	var changedChan <-chan changedSecret
+	if c.DestinationWatcher != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changedChan = c.watchDestinations(ctx)
+	}
+
+	// a nil channel never fires, which disables the verification
+	var verifyChan <-chan struct{}
+	if c.VerifyPeriod > 0 {
+		// the first verification waits for a period, right after the initial sync
+		verifyChan = schedule(c.VerifyPeriod, c.VerifyPeriod, done, func() {
+			cycleOverruns.WithLabelValues("verify").Inc()
+			klog.Warningf("Drift verification waited over the verify period of %s. Tick dropped.", c.VerifyPeriod)
+		})
+	}
 
 	for {
 		select {
@@ -46,56 +255,775 @@ func (c *SecretSyncController) Start(stopChan <-chan struct{}) error {
 			klog.V(2).Info("Stop signal received. Quitting...")
 			return nil
 		case <-runChan:
-			c.SyncAll()
+			summary := c.SyncAll()
+			if c.cycled != nil {
+				c.cycled(summary)
+			}
 			if c.RunOnce {
 				return nil
 			}
+		case <-verifyChan:
+			c.VerifyAll()
+			if err := c.persistentDrift(); err != nil {
+				return err
+			}
+		case secret := <-notifyChan:
+			c.SyncNotified(secret)
+		case secret := <-changedChan:
+			c.SyncChanged(secret.namespace, secret.name)
+		case reply := <-c.resyncRequests():
+			reply <- c.SyncAll()
 		}
 	}
 }
 
+// schedule returns a channel that fires after delay, then every period, or only once if period <= 0.
+// If the receiver is still busy when the next period elapses, the tick is dropped and overrun is called,
+// so that the effective interval never silently skews. The scheduling goroutine quits once done is closed.
+func schedule(delay, period time.Duration, done <-chan struct{}, overrun func()) <-chan struct{} {
+	ch := make(chan struct{})
+
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+
+		var tick <-chan time.Time
+		if period > 0 {
+			ticker := time.NewTicker(period)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+		send:
+			for {
+				select {
+				case <-done:
+					return
+				case ch <- struct{}{}:
+					break send
+				case <-tick:
+					overrun()
+				}
+			}
+
+			// a nil tick never fires, which waits for done
+			select {
+			case <-done:
+				return
+			case <-tick:
+			}
+		}
+	}()
+
+	return ch
+}
+
 // SyncAll sychronizes all secret pairs specified in Agent.Config().Specs
 // Pops error message for any secret pair that it failed to sync or access
-func (c *SecretSyncController) SyncAll() {
+// Returns the summary of the results of the specs synced in this cycle.
+func (c *SecretSyncController) SyncAll() SyncSummary {
 	// iterate on copy of Specs instead of index,
 	// so that the update in Agent.config will only be observed outside of the loop SyncAll()
-	for _, spec := range c.Agent.Config().Specs {
-		updated, err := c.Sync(spec)
+	specs := c.Agent.Config().Specs
+
+	ctx, span := trace.StartSpan(context.Background(), syncAllSpan)
+	defer span.End()
+
+	ordered, err := config.OrderSpecs(specs)
+	if err != nil {
+		// only reachable with a config that skipped validation
+		klog.Errorf("Fail to order specs by dependency: %s", err)
+		ordered = specs
+	}
+	// the specs are expanded once ordered, as the copies of a spec with a namespace pattern share its name
+	ordered = c.ExpandSpecs(ordered)
+	specs = ordered
+
+	summary := SyncSummary{Failed: map[string]string{}}
+
+	if c.breakerOpen() {
+		summary.Skipped = len(specs)
+		return summary
+	}
+
+	// the unchanged specs are only skipped on the first cycle since the manifest was loaded, e.g. on restart,
+	// so that the later cycles restore the destinations edited or deleted meanwhile
+	skipUnchanged := c.Manifest != nil && c.Manifest.startCycle()
+
+	// failed holds the names of the specs not synced in this cycle, so that their dependents wait for the next one
+	failed := map[string]bool{}
+	next := c.nextSpecs(ordered)
+	tripped := false
+	for i, spec := range next {
+		if dep, ok := failedDependency(spec, failed); ok {
+			klog.Errorf("Secret sync skipped for %s: dependency %s is not synced", spec, dep)
+			failed[spec.Name] = true
+			summary.Skipped++
+			continue
+		}
+
+		if c.WaitForNamespace && c.waitForNamespace(spec) {
+			failed[spec.Name] = true
+			summary.Skipped++
+			continue
+		}
+
+		// the Kubernetes sources of a reverse or bidirectional spec are outside of the manifest
+		if skipUnchanged && !spec.Direction.WritesSecretManager() {
+			hash, err := c.sourceHash(spec)
+			if err == nil && c.Manifest.Match(spec.ID(), hash) {
+				syncNoOps.Inc()
+				klog.V(c.noOpVerbosity()).Infof("Secret %s unchanged since its last sync. Skipping...", spec)
+				summary.Unchanged++
+				continue
+			}
+		}
+
+		updated, hash, err := c.syncContext(ctx, spec)
+		if deferred, ok := err.(*ErrWriteDeferred); ok {
+			// the destination was read, so the Kubernetes API is available
+			c.recordBreaker(nil)
+			klog.Info(deferred)
+			// the dependents wait for the change to be written
+			failed[spec.Name] = true
+			summary.Deferred++
+			continue
+		}
+		tripped = c.recordBreaker(err)
 		if err != nil {
 			klog.Errorf("Secret sync failed for %s: %s", spec, err)
+			failed[spec.Name] = true
+			summary.Failed[spec.String()] = err.Error()
+		}
+		if tripped {
+			// the skipped specs are left uncovered, so that the next cycles of the round retry them
+			for _, skipped := range next[i+1:] {
+				delete(c.covered, skipped.ID())
+			}
+			summary.Skipped += len(next) - i - 1
+			break
+		}
+		if err != nil {
+			continue
 		}
 		if updated {
-			klog.V(2).Infof("Secret %s synced from %s", spec.Destination, spec.Source)
+			summary.Updated++
+		} else {
+			summary.Unchanged++
+		}
+
+		if c.Manifest != nil && hash != "" {
+			c.Manifest.Set(spec.ID(), hash)
+		}
+	}
+
+	if c.WaitForNamespace {
+		c.prunePending(specs)
+	}
+	c.pruneDeferred(specs)
+
+	if tripped {
+		// pruning and saving the manifest would only time out on the Kubernetes API too
+		return summary
+	}
+
+	kept := specs
+	if c.Prune {
+		c.PruneRemoved(specs)
+		// keep the entries of the removed specs failed to be pruned, so that they are retried after a restart
+		kept = nil
+		for _, spec := range c.previous {
+			kept = append(kept, spec)
+		}
+	}
+
+	if c.Manifest != nil {
+		c.Manifest.Prune(kept)
+		err := c.Manifest.Save(c.Client)
+		if err != nil {
+			klog.Error(err)
+		}
+	}
+
+	return summary
+}
+
+// failedDependency returns the first dependency of spec found in failed, and true if any.
+func failedDependency(spec config.SecretSyncSpec, failed map[string]bool) (string, bool) {
+	for _, dep := range spec.DependsOn {
+		if failed[dep] {
+			return dep, true
+		}
+	}
+	return "", false
+}
+
+// waitForNamespace returns true if spec should be skipped in the current cycle,
+// because its destination namespace does not exist yet or its next check is backed off.
+// The backoff doubles with each missing check, up to maxNamespaceBackoff cycles.
+func (c *SecretSyncController) waitForNamespace(spec config.SecretSyncSpec) bool {
+	if c.pending == nil {
+		c.pending = map[config.SpecID]*pendingSpec{}
+	}
+
+	id := spec.ID()
+	state, ok := c.pending[id]
+	if ok && state.skip > 0 {
+		state.skip--
+		return true
+	}
+
+	err := c.Client.ValidateKubernetesNamespace(spec.Destination.Namespace)
+	if err == nil || !apierrors.IsNotFound(err) {
+		// other errors are surfaced by the sync itself
+		if ok {
+			klog.V(2).Infof("Namespace %s of secret %s appeared after %d checks.", spec.Destination.Namespace, spec, state.attempts)
+			delete(c.pending, id)
+		}
+		return false
+	}
+
+	if !ok {
+		state = &pendingSpec{}
+		c.pending[id] = state
+	}
+	state.attempts++
+	backoff := maxNamespaceBackoff
+	if state.attempts <= 4 {
+		backoff = 1 << uint(state.attempts-1)
+	}
+	state.skip = backoff - 1
+	klog.V(2).Infof("Namespace %s of secret %s not found. Retrying in %d cycles...", spec.Destination.Namespace, spec, backoff)
+
+	return true
+}
+
+// prunePending drops the pending state of the specs no longer in specs, and updates the pending metric.
+func (c *SecretSyncController) prunePending(specs []config.SecretSyncSpec) {
+	ids := map[config.SpecID]bool{}
+	for _, spec := range specs {
+		ids[spec.ID()] = true
+	}
+	for id := range c.pending {
+		if !ids[id] {
+			delete(c.pending, id)
 		}
 	}
+	pendingSpecs.Set(float64(len(c.pending)))
+}
+
+// nextSpecs returns the specs to be synced in the current cycle.
+// If c.MaxSpecsPerCycle is set, returns up to c.MaxSpecsPerCycle specs, in config order,
+// that have not been synced in the current round, and starts a new round once all specs are covered.
+// Specs added during a round are synced within the round, and removed specs are simply dropped.
+func (c *SecretSyncController) nextSpecs(specs []config.SecretSyncSpec) []config.SecretSyncSpec {
+	if c.MaxSpecsPerCycle <= 0 || c.MaxSpecsPerCycle >= len(specs) {
+		return specs
+	}
+
+	if c.covered == nil {
+		c.covered = map[config.SpecID]bool{}
+	}
+
+	pending := []config.SecretSyncSpec{}
+	for _, spec := range specs {
+		if !c.covered[spec.ID()] {
+			pending = append(pending, spec)
+		}
+	}
+
+	// all specs are covered, start a new round
+	if len(pending) == 0 {
+		c.covered = map[config.SpecID]bool{}
+		pending = specs
+	}
+
+	if len(pending) > c.MaxSpecsPerCycle {
+		pending = pending[:c.MaxSpecsPerCycle]
+	}
+	for _, spec := range pending {
+		c.covered[spec.ID()] = true
+	}
+
+	return pending
 }
 
-// Sync sychronizes the secret value from spec.Source to spec.Destination.
-// Returns true if the secret value in spec.Destination is updated,
-// otherwise returns false, meaning that the secret value in spec.Destination remains unchanged.
+// Sync sychronizes the secret values from the sources to the destination keys of spec.
+// Each of spec.Pairs() is synced independently, so that a failing source does not block the other keys.
+// A spec mirroring its whole source secret also removes the keys that disappeared from the source.
+// Returns true if any secret value in spec.Destination is updated,
+// otherwise returns false, meaning that the secret values in spec.Destination remain unchanged.
 func (c *SecretSyncController) Sync(spec config.SecretSyncSpec) (bool, error) {
+	return c.SyncContext(context.Background(), spec)
+}
+
+// SyncContext is Sync() tracing the sync of spec in a child span of the span in ctx, if any.
+func (c *SecretSyncController) SyncContext(ctx context.Context, spec config.SecretSyncSpec) (bool, error) {
+	updated, _, err := c.syncContext(ctx, spec)
+	return updated, err
+}
+
+// syncContext is SyncContext(), also returning the checksum of the source values synced for the manifest,
+// or an empty checksum if spec writes Secret Manager or fails to sync.
+func (c *SecretSyncController) syncContext(ctx context.Context, spec config.SecretSyncSpec) (bool, string, error) {
+	ctx, span := trace.StartSpan(ctx, syncSpan)
+	span.AddAttributes(trace.StringAttribute("spec", spec.String()))
+	syncsAttempted.WithLabelValues(spec.ID().String()).Inc()
+
+	// the window is checked once, so that the keys of a spec are never written partially as the window closes
+	writable, opens, err := c.writeWindow(spec)
+	if err != nil {
+		c.audit(spec, audit.Failed, nil, err)
+		recordSyncResult(spec, err)
+		endSpan(span, err)
+		return false, "", err
+	}
+
+	var digest *sourceDigest
+	if !spec.Direction.WritesSecretManager() {
+		digest = newSourceDigest()
+	}
+
+	updated := false
+	deferred := false
+	errs := []error{}
+	versions := []string{}
+	syncPair := func(ctx context.Context, pair config.SecretSyncSpec, writable bool) (bool, string, error) {
+		return c.syncPair(ctx, pair, writable, digest)
+	}
+	switch spec.Direction {
+	case config.DirectionReverse:
+		syncPair = c.reverseSyncPair
+	case config.DirectionBidirectional:
+		syncPair = c.bidirectionalSyncPair
+	}
+	pairs, pairsErr := c.pairs(spec)
+	if pairsErr != nil {
+		errs = append(errs, pairsErr)
+	}
+	for _, pair := range pairs {
+		pairUpdated, version, err := syncPair(ctx, pair, writable)
+		if err == errWindowClosed {
+			deferred = true
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		} else if spec.MirrorsSecret() {
+			// the mirrored keys share the version of the source
+			versions = []string{version}
+		} else if len(spec.KeyMappings()) != 0 {
+			versions = append(versions, pair.Destination.Key+"="+version)
+		} else {
+			versions = append(versions, version)
+		}
+		var to, from fmt.Stringer = pair.Destination, pair.Source
+		synced := "synced from"
+		switch spec.Direction {
+		case config.DirectionReverse:
+			to, from = pair.Source, pair.Destination
+		case config.DirectionBidirectional:
+			synced = "synced with"
+		}
+		if pairUpdated {
+			klog.V(2).Infof("Secret %s %s %s", to, synced, from)
+			updated = true
+		} else if err == nil {
+			syncNoOps.Inc()
+			klog.V(c.noOpVerbosity()).Infof("Secret %s checked against %s, no change", to, from)
+		}
+	}
+
+	// the keys are only known to have vanished once all the keys of the source are listed
+	if spec.MirrorsSecret() && pairsErr == nil {
+		removed, err := c.removeVanishedKeys(spec, pairs, writable)
+		if err == errWindowClosed {
+			deferred = true
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+		if removed {
+			updated = true
+		}
+	}
+
+	// the status annotations keep describing the values held by the secret until the deferred change is written
+	// the Kubernetes secret of a reverse spec is its source, left as it is
+	if c.StatusAnnotations && !spec.Destination.Resource.IsSet() && !spec.Direction.IsReverse() && !deferred {
+		err := c.annotateStatus(spec.Destination, len(errs) == 0, strings.Join(versions, ","))
+		if err != nil {
+			klog.Warning(err)
+		}
+	}
+
+	if spec.MirrorLabels && writable {
+		err := c.mirrorLabels(spec)
+		if err != nil {
+			klog.Warning(err)
+		}
+	}
+
+	if spec.Destination.OwnerRef != nil && writable {
+		err := c.setOwner(spec.Destination)
+		if err != nil {
+			klog.Warning(err)
+		}
+	}
+
+	if deferred {
+		c.deferWrite(spec, opens)
+		if len(errs) == 0 {
+			err = &ErrWriteDeferred{Spec: spec.String(), Opens: opens}
+			c.audit(spec, audit.Deferred, versions, err)
+			endSpan(span, err)
+			return false, "", err
+		}
+	} else if len(errs) == 0 {
+		c.clearDeferred(spec)
+	}
+
+	err = utilerrors.NewAggregate(errs)
+	if err != nil {
+		c.audit(spec, audit.Failed, versions, err)
+	} else if updated {
+		c.audit(spec, audit.Succeeded, versions, nil)
+	}
+	recordSyncResult(spec, err)
+	endSpan(span, err)
+	if err != nil || digest == nil {
+		return updated, "", err
+	}
+	return updated, digest.sum(), nil
+}
+
+// audit records the result of a Sync() of spec in the audit trail, with the synced source versions.
+// The errors of Sync() are redacted already.
+func (c *SecretSyncController) audit(spec config.SecretSyncSpec, result audit.Result, versions []string, err error) {
+	record := audit.Record{
+		Operation: audit.Sync,
+		Spec:      spec.String(),
+		Result:    result,
+		Version:   strings.Join(versions, ","),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	c.AuditLogger.Log(record)
+}
+
+// annotateStatus records the result of the last sync in the status annotations of the destination secret of dest.
+// The source versions are only recorded on success, so that they describe the values held by the secret.
+// Missing destination secrets are skipped, e.g. if the sync failed before creating it.
+func (c *SecretSyncController) annotateStatus(dest config.KubernetesSpec, succeeded bool, versions string) error {
+	annotations := map[string]string{
+		client.LastSyncTimeAnnotation: time.Now().UTC().Format(time.RFC3339),
+		client.LastResultAnnotation:   client.SyncFailed,
+	}
+	if succeeded {
+		annotations[client.LastResultAnnotation] = client.SyncSucceeded
+		annotations[client.SourceVersionAnnotation] = versions
+	}
+
+	err := c.Client.AnnotateKubernetesSecret(dest.Namespace, dest.Secret, annotations)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Fail to annotate status of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	return nil
+}
+
+// noOpVerbosity returns the klog verbosity of the no-op logs.
+func (c *SecretSyncController) noOpVerbosity() klog.Level {
+	if c.NoOpVerbosity <= 0 {
+		return defaultNoOpVerbosity
+	}
+	return c.NoOpVerbosity
+}
+
+// maxSourceBytes returns the maximum size of the source values.
+func (c *SecretSyncController) maxSourceBytes() int {
+	if c.MaxSourceBytes <= 0 {
+		return DefaultMaxSourceBytes
+	}
+	return c.MaxSourceBytes
+}
+
+// syncPair sychronizes the secret value from pair.Source to pair.Destination,
+// tracing each read and write of a secret value in a child span of the span in ctx.
+// The source value is added to digest, if not nil, once read.
+// Returns true if the secret value in pair.Destination is updated, and the synced version of pair.Source.
+// Returns errWindowClosed instead of writing if writable is false.
+func (c *SecretSyncController) syncPair(ctx context.Context, pair config.SecretSyncSpec, writable bool, digest *sourceDigest) (bool, string, error) {
 	// get source secret
-	srcData, err := c.Client.GetSecretManagerSecretValue(spec.Source.Project, spec.Source.Secret)
+	_, span := trace.StartSpan(ctx, gsmReadSpan)
+	span.AddAttributes(trace.StringAttribute("source", pair.Source.String()))
+	srcData, version, err := c.getSource(pair)
+	endSpan(span, err)
 	if err != nil {
-		return false, err
+		if _, ok := err.(*ErrSourceTooShort); ok {
+			shortSources.WithLabelValues(pair.Source.String()).Inc()
+		}
+		return false, "", err
+	}
+	if digest != nil {
+		digest.add(pair.Destination.Key, srcData)
 	}
 
 	// get destination secret
-	destData, err := c.Client.GetKubernetesSecretValue(spec.Destination.Namespace, spec.Destination.Secret, spec.Destination.Key)
+	_, span = trace.StartSpan(ctx, k8sReadSpan)
+	span.AddAttributes(trace.StringAttribute("destination", pair.Destination.String()))
+	destData, err := c.getDestination(pair.Destination)
+	missing := false
+	if err == nil && destData == nil {
+		missing, err = c.destinationMissing(pair.Destination)
+	}
+	endSpan(span, err)
 	if err != nil {
-		return false, err
+		return false, "", err
+	}
+
+	updated := false
+	// a deleted destination secret is re-created even if the source value compares equal to the missing one, e.g. if empty
+	if missing || !pair.EqualityMode.Equal(srcData, destData) {
+		if !writable {
+			return false, "", errWindowClosed
+		}
+
+		if c.RefuseUnmanaged && !pair.Destination.Resource.IsSet() {
+			err = c.checkManaged(pair.Destination)
+			if err != nil {
+				return false, "", err
+			}
+		}
+
+		// update destination secret value
+		// inserts a key-value pair if pair.Destination does not exist yet
+		_, span = trace.StartSpan(ctx, k8sWriteSpan)
+		span.AddAttributes(trace.StringAttribute("destination", pair.Destination.String()))
+		err = c.upsertDestination(pair.Destination, srcData, sourceIdentity(pair, version))
+		// the client errors may echo the written value, e.g. in a rejected patch
+		err = redact.Error(err, srcData, destData)
+		endSpan(span, err)
+		if err != nil {
+			return false, "", err
+		}
+		updated = true
+
+		if c.InstanceID != "" && !pair.Destination.Resource.IsSet() {
+			err = c.Client.AnnotateKubernetesSecret(pair.Destination.Namespace, pair.Destination.Secret, map[string]string{
+				client.LastWriterAnnotation: c.InstanceID,
+			})
+			if err != nil {
+				return updated, "", fmt.Errorf("Fail to annotate %s: %s", pair.Destination, err)
+			}
+		}
+	}
+
+	if c.AnnotateSource && !pair.Destination.Resource.IsSet() {
+		err = c.annotateSource(pair, version)
+		if err != nil {
+			return updated, "", err
+		}
 	}
 
-	// update destination secret
-	if bytes.Equal(srcData, destData) {
+	return updated, version, nil
+}
+
+// destinationMissing returns true if the destination secret of dest doesn't exist, e.g. if it was deleted.
+// Custom resource destinations are never reported missing.
+func (c *SecretSyncController) destinationMissing(dest config.KubernetesSpec) (bool, error) {
+	if dest.Resource.IsSet() {
 		return false, nil
 	}
-	// update destination secret value
-	// inserts a key-value pair if spec.Destination does not exist yet
-	err = c.Client.UpsertKubernetesSecret(spec.Destination.Namespace, spec.Destination.Secret, spec.Destination.Key, srcData)
+	err := c.Client.ValidateKubernetesSecret(dest.Namespace, dest.Secret)
+	if err == nil {
+		return false, nil
+	}
+	if apierrors.IsNotFound(err) {
+		klog.V(2).Infof("Destination secret namespaces/%s/secrets/%s is missing. Creating it...", dest.Namespace, dest.Secret)
+		return true, nil
+	}
+	return false, fmt.Errorf("Fail to get namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+}
+
+// checkManaged returns ErrUnmanagedDestination if the destination secret exists without the client.ManagedByLabel,
+// unless c.AdoptUnmanaged is set, in which case the label is stamped on the secret.
+// Missing destination secrets are created with the label, thus considered managed.
+func (c *SecretSyncController) checkManaged(dest config.KubernetesSpec) error {
+	labels, err := c.Client.GetKubernetesSecretLabels(dest.Namespace, dest.Secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Fail to get labels of %s: %s", dest, err)
+	}
+	if labels[client.ManagedByLabel] == c.Client.ManagerName() {
+		return nil
+	}
+
+	if !c.AdoptUnmanaged {
+		return &ErrUnmanagedDestination{
+			Namespace: dest.Namespace,
+			Secret:    dest.Secret,
+			Manager:   c.Client.ManagerName(),
+		}
+	}
+
+	err = c.Client.LabelKubernetesSecret(dest.Namespace, dest.Secret, map[string]string{
+		client.ManagedByLabel: c.Client.ManagerName(),
+	})
+	if err != nil {
+		return fmt.Errorf("Fail to adopt %s: %s", dest, err)
+	}
+	klog.V(2).Infof("Adopted unmanaged secret namespaces/%s/secrets/%s", dest.Namespace, dest.Secret)
+
+	return nil
+}
+
+// getSource reads the latest version of pair.Source, checks it against pair.Source.MinLength,
+// extracts its pair.Source.JSONField if set, and applies pair.Transforms to the value.
+// Returns the transformed secret value and its version, or ErrSourceTooShort if the value is too short.
+func (c *SecretSyncController) getSource(pair config.SecretSyncSpec) ([]byte, string, error) {
+	data, version, err := c.readSource(pair)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) < pair.Source.MinLength {
+		return nil, "", &ErrSourceTooShort{
+			Source: pair.Source,
+			Length: len(data),
+		}
+	}
+	data, err = pair.Source.Extract(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("Fail to extract %s: %s", pair.Source, err)
+	}
+	if len(pair.Transforms) != 0 {
+		data, err = config.ApplyTransforms(pair.Transforms, data)
+		if err != nil {
+			return nil, "", fmt.Errorf("Fail to transform %s: %s", pair.Source, err)
+		}
+	}
+
+	data, err = pair.EqualityMode.Normalize(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("Fail to normalize %s as %s: %s", pair.Source, pair.EqualityMode, err)
+	}
+	return data, version, nil
+}
+
+// readSource reads the latest version of pair.Source,
+// with the credentials stored in pair.CredentialsFrom if set, otherwise with c.Client.
+// Returns the secret value and its version, or ErrSourceTooLarge if the value is larger than MaxSourceBytes.
+func (c *SecretSyncController) readSource(pair config.SecretSyncSpec) ([]byte, string, error) {
+	var reader client.SourceReader = c.Client
+	if pair.CredentialsFrom != nil {
+		if c.Credentials == nil {
+			return nil, "", fmt.Errorf("No credentials cache to read %s with credentials from %s", pair.Source, pair.CredentialsFrom)
+		}
+
+		credentialsReader, release, err := c.Credentials.Get(pair.CredentialsFrom.Project, pair.CredentialsFrom.Secret)
+		if err != nil {
+			return nil, "", err
+		}
+		defer release()
+		reader = credentialsReader
+	}
+
+	data, version, err := reader.GetSecretManagerSecretVersion(pair.Source.Project, pair.Source.Secret)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > c.maxSourceBytes() {
+		return nil, "", &ErrSourceTooLarge{
+			Source: pair.Source,
+			Length: len(data),
+			Max:    c.maxSourceBytes(),
+		}
+	}
+	return data, version, nil
+}
+
+// getDestination reads the value of dest, from the custom resource object if dest.Resource is set,
+// decrypted if dest.EnvelopeEncrypt is set.
+// Returns nil if the destination key doesn't exist.
+func (c *SecretSyncController) getDestination(dest config.KubernetesSpec) ([]byte, error) {
+	if dest.Resource.IsSet() {
+		if c.Resources == nil {
+			return nil, fmt.Errorf("No dynamic client to access %s", dest)
+		}
+		return c.Resources.GetResourceValue(dest.Resource.GroupVersionResource(), dest.Namespace, dest.Secret, dest.Resource.Fields(dest.Key))
+	}
+	data, err := c.Client.GetKubernetesSecretValue(dest.Namespace, dest.Secret, dest.Key)
+	if err != nil || dest.EnvelopeEncrypt == nil {
+		return data, err
+	}
+	return c.open(dest, data)
+}
+
+// upsertDestination writes data into dest, through stringData if dest.StringData is set and data is valid UTF-8,
+// or into the custom resource object if dest.Resource is set.
+// data is encrypted before it is written if dest.EnvelopeEncrypt is set.
+// A secret is labeled as managed and annotated with source, the identity of the source of dest.Key, as it is written.
+func (c *SecretSyncController) upsertDestination(dest config.KubernetesSpec, data []byte, source string) error {
+	if dest.Resource.IsSet() {
+		if c.Resources == nil {
+			return fmt.Errorf("No dynamic client to access %s", dest)
+		}
+		return c.Resources.UpsertResourceValue(dest.Resource.GroupVersionResource(), dest.Resource.Kind, dest.Namespace, dest.Secret, dest.Resource.Fields(dest.Key), data)
+	}
+	if dest.EnvelopeEncrypt != nil {
+		var err error
+		data, err = c.seal(dest, data)
+		if err != nil {
+			return err
+		}
+	}
+	stringData := dest.StringData
+	if stringData && !utf8.Valid(data) {
+		klog.Warningf("Secret value for %s is not valid UTF-8. Writing it as binary data...", dest)
+		stringData = false
+	}
+	annotations := map[string]string{
+		client.SourceAnnotation(dest.Key): source,
+	}
+	return c.Client.UpsertKubernetesSecretValue(dest.Namespace, dest.Secret, dest.Key, data, stringData, annotations)
+}
+
+// sourceIdentity returns the identity of pair.Source at version recorded in the source annotation of pair.Destination.Key.
+func sourceIdentity(pair config.SecretSyncSpec, version string) string {
+	return fmt.Sprintf("projects/%s/secrets/%s@%s", pair.Source.Project, pair.Source.Secret, version)
+}
+
+// annotateSource records pair.Source at version in the source annotation of pair.Destination.Key,
+// if the destination secret exists and the annotation is outdated.
+func (c *SecretSyncController) annotateSource(pair config.SecretSyncSpec, version string) error {
+	annotations, err := c.Client.GetKubernetesSecretAnnotations(pair.Destination.Namespace, pair.Destination.Secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// nothing has been synced to the destination secret
+			return nil
+		}
+		return fmt.Errorf("Fail to get annotations of %s: %s", pair.Destination, err)
+	}
+
+	key := client.SourceAnnotation(pair.Destination.Key)
+	value := sourceIdentity(pair, version)
+	if annotations[key] == value {
+		return nil
+	}
+
+	err = c.Client.AnnotateKubernetesSecret(pair.Destination.Namespace, pair.Destination.Secret, map[string]string{key: value})
 	if err != nil {
-		return false, err
+		return fmt.Errorf("Fail to annotate %s: %s", pair.Destination, err)
 	}
+	klog.V(2).Infof("Secret %s annotated with source %s", pair.Destination, value)
 
-	return true, nil
+	return nil
 }
@@ -16,14 +16,30 @@ package controller
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 	"os"
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/audit"
+	"sigs.k8s.io/k8s-gsm-tools/leaderelect"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
 	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"strings"
 	"testing"
 	"text/template"
+	"time"
 )
 
 var testClient tests.ClientInterface
@@ -105,7 +121,9 @@ func TestSync(t *testing.T) {
 		t.Fatalf("Fail to setup fixture: %s", err)
 	}
 
-	defer fixture.Teardown(testClient)
+	// the destination secrets synced by the test cases
+	synced := &config.SecretSyncConfig{}
+	defer fixture.Teardown(testClient, decommissionSynced(synced))
 
 	var testcases = []struct {
 		name      string
@@ -294,6 +312,7 @@ func TestSync(t *testing.T) {
 				t.Error(err)
 			}
 
+			synced.Specs = append(synced.Specs, tc.spec)
 			updated, err := controller.Sync(tc.spec)
 			if tc.update && !updated {
 				t.Errorf("Expected update in destination secret value.")
@@ -354,7 +373,9 @@ func TestSyncAll(t *testing.T) {
 		t.Fatalf("Fail to setup fixture: %s", err)
 	}
 
-	defer fixture.Teardown(testClient)
+	// the destination secrets synced by the test cases
+	synced := &config.SecretSyncConfig{}
+	defer fixture.Teardown(testClient, decommissionSynced(synced))
 
 	var testcases = []struct {
 		name string
@@ -497,6 +518,7 @@ func TestSyncAll(t *testing.T) {
 				Agent:   &config.Agent{},
 				RunOnce: true,
 			}
+			synced.Specs = append(synced.Specs, tc.conf.Specs...)
 			controller.Agent.Set(&tc.conf)
 
 			err = fixture.Reset(testClient)
@@ -520,3 +542,2126 @@ func TestSyncAll(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncMappings(t *testing.T) {
+	var fixtureConfig = `
+      secretmanager:
+        {{.}}: 
+          gsm-password: gsm-password-v1
+          gsm-token: gsm-token-v1
+          gsm-old-token: old-token
+      kubernetes:
+        ns-a:
+          secret-a:
+            key-a: old-token
+            key-b: gsm-password-v1
+`
+	// substitute fixture project to testOpts.gsmProject
+	temp := template.Must(template.New("config").Parse(fixtureConfig))
+	fixtureBuffer := new(bytes.Buffer)
+	temp.Execute(fixtureBuffer, testOpts.gsmProject)
+
+	fixture, err := tests.NewFixture(fixtureBuffer.Bytes())
+	if err != nil {
+		t.Fatalf("Fail to parse fixture: %s", err)
+	}
+
+	err = fixture.Setup(testClient)
+	if err != nil {
+		t.Fatalf("Fail to setup fixture: %s", err)
+	}
+
+	// the destination secrets synced by the test cases
+	synced := &config.SecretSyncConfig{}
+	defer fixture.Teardown(testClient, decommissionSynced(synced))
+
+	var testcases = []struct {
+		name      string
+		spec      config.SecretSyncSpec
+		want      []KubernetesSecret
+		update    bool
+		expectErr bool
+	}{
+		{
+			name: "Sync mappings with <same secret values> for all keys. Should not update.",
+			spec: config.SecretSyncSpec{
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []config.KeyMapping{
+					{
+						Source: config.SecretManagerSpec{
+							Project: testOpts.gsmProject,
+							Secret:  "gsm-old-token",
+						},
+						Key: "key-a",
+					},
+					{
+						Source: config.SecretManagerSpec{
+							Project: testOpts.gsmProject,
+							Secret:  "gsm-password",
+						},
+						Key: "key-b",
+					},
+				},
+			},
+
+			want: []KubernetesSecret{
+				{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Value:     "old-token",
+				},
+				{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-b",
+					Value:     "gsm-password-v1",
+				},
+			},
+
+			update: false,
+
+			expectErr: false,
+		},
+		{
+			name: "Sync mappings with <same secret value> for one key and <new key>. Should only insert the new key.",
+			spec: config.SecretSyncSpec{
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []config.KeyMapping{
+					{
+						Source: config.SecretManagerSpec{
+							Project: testOpts.gsmProject,
+							Secret:  "gsm-old-token",
+						},
+						Key: "key-a",
+					},
+					{
+						Source: config.SecretManagerSpec{
+							Project: testOpts.gsmProject,
+							Secret:  "gsm-token",
+						},
+						Key: "key-c",
+					},
+				},
+			},
+
+			want: []KubernetesSecret{
+				{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Value:     "old-token",
+				},
+				{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-b",
+					Value:     "gsm-password-v1",
+				},
+				{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-c",
+					Value:     "gsm-token-v1",
+				},
+			},
+
+			update: true,
+
+			expectErr: false,
+		},
+		{
+			name: "Sync mappings with <non-existing gsm secret> for one key. Should update the other keys and return error.",
+			spec: config.SecretSyncSpec{
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+				},
+				Mappings: []config.KeyMapping{
+					{
+						Source: config.SecretManagerSpec{
+							Project: testOpts.gsmProject,
+							Secret:  "missed",
+						},
+						Key: "key-a",
+					},
+					{
+						Source: config.SecretManagerSpec{
+							Project: testOpts.gsmProject,
+							Secret:  "gsm-token",
+						},
+						Key: "key-b",
+					},
+				},
+			},
+
+			want: []KubernetesSecret{
+				{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+					Value:     "old-token",
+				},
+				{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-b",
+					Value:     "gsm-token-v1",
+				},
+			},
+
+			update: true,
+
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+
+			controller := &SecretSyncController{
+				Client:  testClient,
+				RunOnce: true,
+			}
+
+			err = fixture.Reset(testClient)
+			if err != nil {
+				t.Error(err)
+			}
+
+			synced.Specs = append(synced.Specs, tc.spec)
+			updated, err := controller.Sync(tc.spec)
+			if tc.update && !updated {
+				t.Errorf("Expected update in destination secret value.")
+			} else if !tc.update && updated {
+				t.Errorf("Unexpected update in destination secret value.")
+			}
+
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			// validate result
+			for _, k8sSecret := range tc.want {
+				value, err := controller.Client.GetKubernetesSecretValue(k8sSecret.Namespace, k8sSecret.Secret, k8sSecret.Key)
+				if err != nil {
+					t.Error(err)
+				}
+				if !bytes.Equal(value, []byte(k8sSecret.Value)) {
+					t.Errorf("Fail to validate namespaces/%s/secrets/%s[%s]. Expected %s but got %s.", k8sSecret.Namespace, k8sSecret.Secret, k8sSecret.Key, k8sSecret.Value, value)
+				}
+			}
+		})
+	}
+}
+
+func TestNextSpecs(t *testing.T) {
+	newSpec := func(secret string) config.SecretSyncSpec {
+		return config.SecretSyncSpec{
+			Source: config.SecretManagerSpec{
+				Project: "project-1",
+				Secret:  "gsm-" + secret,
+			},
+			Destination: config.KubernetesSpec{
+				Namespace: "ns-a",
+				Secret:    secret,
+				Key:       "key",
+			},
+		}
+	}
+	secrets := func(specs []config.SecretSyncSpec) []string {
+		res := []string{}
+		for _, spec := range specs {
+			res = append(res, spec.Destination.Secret)
+		}
+		return res
+	}
+
+	var testcases = []struct {
+		name     string
+		max      int
+		specs    [][]string
+		expected [][]string
+	}{
+		{
+			name:     "No cap. Should sync all specs in every cycle.",
+			max:      0,
+			specs:    [][]string{{"a", "b", "c"}, {"a", "b", "c"}},
+			expected: [][]string{{"a", "b", "c"}, {"a", "b", "c"}},
+		},
+		{
+			name:     "Cap not smaller than the number of specs. Should sync all specs in every cycle.",
+			max:      3,
+			specs:    [][]string{{"a", "b", "c"}, {"a", "b", "c"}},
+			expected: [][]string{{"a", "b", "c"}, {"a", "b", "c"}},
+		},
+		{
+			name:     "Cap smaller than the number of specs. Should cover all specs over several cycles.",
+			max:      2,
+			specs:    [][]string{{"a", "b", "c", "d", "e"}, {"a", "b", "c", "d", "e"}, {"a", "b", "c", "d", "e"}, {"a", "b", "c", "d", "e"}},
+			expected: [][]string{{"a", "b"}, {"c", "d"}, {"e"}, {"a", "b"}},
+		},
+		{
+			name:     "Specs reordered between cycles. Should not re-sync covered specs.",
+			max:      2,
+			specs:    [][]string{{"a", "b", "c", "d"}, {"d", "c", "b", "a"}, {"a", "b", "c", "d"}},
+			expected: [][]string{{"a", "b"}, {"d", "c"}, {"a", "b"}},
+		},
+		{
+			name:     "Specs added during a round. Should sync the added specs within the round.",
+			max:      2,
+			specs:    [][]string{{"a", "b", "c"}, {"x", "a", "b", "c"}, {"x", "a", "b", "c"}},
+			expected: [][]string{{"a", "b"}, {"x", "c"}, {"x", "a"}},
+		},
+		{
+			name:     "Specs removed during a round. Should continue with the remaining specs.",
+			max:      2,
+			specs:    [][]string{{"a", "b", "c", "d", "e"}, {"a", "c", "e"}, {"a", "c", "e"}},
+			expected: [][]string{{"a", "b"}, {"c", "e"}, {"a", "c"}},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			controller := &SecretSyncController{
+				MaxSpecsPerCycle: tc.max,
+			}
+
+			for i, cycle := range tc.specs {
+				specs := []config.SecretSyncSpec{}
+				for _, secret := range cycle {
+					specs = append(specs, newSpec(secret))
+				}
+
+				got := secrets(controller.nextSpecs(specs))
+				if !reflect.DeepEqual(got, tc.expected[i]) {
+					t.Errorf("Cycle %d: expected %v, but got %v.", i, tc.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestAnnotateSource(t *testing.T) {
+	var fixtureConfig = `
+      secretmanager:
+        {{.}}:
+          gsm-token: gsm-token-v1
+      kubernetes:
+        ns-a:
+`
+	// substitute fixture project to testOpts.gsmProject
+	temp := template.Must(template.New("config").Parse(fixtureConfig))
+	fixtureBuffer := new(bytes.Buffer)
+	temp.Execute(fixtureBuffer, testOpts.gsmProject)
+
+	fixture, err := tests.NewFixture(fixtureBuffer.Bytes())
+	if err != nil {
+		t.Fatalf("Fail to parse fixture: %s", err)
+	}
+
+	err = fixture.Setup(testClient)
+	if err != nil {
+		t.Fatalf("Fail to setup fixture: %s", err)
+	}
+
+	// the destination secrets synced by the test cases
+	synced := &config.SecretSyncConfig{}
+	defer fixture.Teardown(testClient, decommissionSynced(synced))
+
+	var testcases = []struct {
+		name string
+		key  string
+	}{
+		{
+			name: "Valid annotation key. Should annotate with the key.",
+			key:  "key-a",
+		},
+		{
+			name: "Key too long for an annotation. Should annotate with the hashed key.",
+			key:  strings.Repeat("k", 100),
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			err = fixture.Reset(testClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = testClient.UpsertSecretManagerSecret(testOpts.gsmProject, "gsm-token", []byte("gsm-token-v1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:         testClient,
+				RunOnce:        true,
+				AnnotateSource: true,
+			}
+			spec := config.SecretSyncSpec{
+				Source: config.SecretManagerSpec{
+					Project: testOpts.gsmProject,
+					Secret:  "gsm-token",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       tc.key,
+				},
+			}
+			annotation := client.SourceAnnotation(tc.key)
+			if len(validation.IsQualifiedName(annotation)) != 0 {
+				t.Errorf("Invalid annotation key %s.", annotation)
+			}
+
+			validate := func(expected string) {
+				_, version, err := testClient.GetSecretManagerSecretVersion(testOpts.gsmProject, "gsm-token")
+				if err != nil {
+					t.Fatal(err)
+				}
+				annotations, err := testClient.GetKubernetesSecretAnnotations("ns-a", "secret-a")
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := fmt.Sprintf("projects/%s/secrets/gsm-token@%s", testOpts.gsmProject, version)
+				if annotations[annotation] != want {
+					t.Errorf("Expected annotation %s=%s, but got %s.", annotation, want, annotations[annotation])
+				}
+				value, err := testClient.GetKubernetesSecretValue("ns-a", "secret-a", tc.key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(value) != expected {
+					t.Errorf("Expected value %s, but got %s.", expected, value)
+				}
+			}
+
+			synced.Specs = append(synced.Specs, spec)
+			_, err = controller.Sync(spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			validate("gsm-token-v1")
+
+			// a new source version should update the annotation, even with the same value
+			for _, data := range []string{"gsm-token-v2", "gsm-token-v2"} {
+				err = testClient.UpsertSecretManagerSecret(testOpts.gsmProject, "gsm-token", []byte(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = controller.Sync(spec)
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+				validate(data)
+			}
+		})
+	}
+}
+
+func TestLastWriterAnnotation(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		instanceID string
+		destValue  string
+		expected   string
+	}{
+		{
+			name:       "Destination updated. Should annotate with the instance id.",
+			instanceID: "controller-b",
+			destValue:  "old-token",
+			expected:   "controller-b",
+		},
+		{
+			name:       "Destination updated without instance id. Should keep the previous annotation.",
+			instanceID: "",
+			destValue:  "old-token",
+			expected:   "controller-a",
+		},
+		{
+			name:       "Destination already in sync. Should keep the previous annotation.",
+			instanceID: "controller-b",
+			destValue:  "gsm-token-v1",
+			expected:   "controller-a",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte(tc.destValue))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = cl.AnnotateKubernetesSecret("ns-a", "secret-a", map[string]string{
+				client.LastWriterAnnotation: "controller-a",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:     cl,
+				InstanceID: tc.instanceID,
+			}
+			_, err = controller.Sync(verifySpec)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			annotations, err := cl.GetKubernetesSecretAnnotations("ns-a", "secret-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if annotations[client.LastWriterAnnotation] != tc.expected {
+				t.Errorf("Expected last writer %s, but got %s.", tc.expected, annotations[client.LastWriterAnnotation])
+			}
+		})
+	}
+}
+
+func TestSyncStringData(t *testing.T) {
+	var testcases = []struct {
+		name             string
+		stringData       bool
+		source           []byte
+		expectStringData int
+	}{
+		{
+			name:             "String value with stringData. Should write through stringData once.",
+			stringData:       true,
+			source:           []byte("gsm-token-v1"),
+			expectStringData: 1,
+		},
+		{
+			name:             "Binary value with stringData. Should fall back to binary data.",
+			stringData:       true,
+			source:           []byte{0xff, 0xfe, 0x00},
+			expectStringData: 0,
+		},
+		{
+			name:             "String value without stringData. Should write binary data.",
+			stringData:       false,
+			source:           []byte("gsm-token-v1"),
+			expectStringData: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", tc.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := verifySpec
+			spec.Destination.Secret = "secret-string"
+			spec.Destination.StringData = tc.stringData
+
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			// the second sync should be a no-op, as the value reads back from data
+			for i, expectUpdated := range []bool{true, false} {
+				updated, err := controller.Sync(spec)
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				if updated != expectUpdated {
+					t.Errorf("Sync %d: expected updated %v, but got %v.", i, expectUpdated, updated)
+				}
+			}
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-string", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(value, tc.source) {
+				t.Errorf("Expected %v, but got %v.", tc.source, value)
+			}
+			if cl.StringDataWrites != tc.expectStringData {
+				t.Errorf("Expected %d stringData writes, but got %d.", tc.expectStringData, cl.StringDataWrites)
+			}
+		})
+	}
+}
+
+func TestSyncResource(t *testing.T) {
+	resource := config.ResourceSpec{
+		Group:     "external-secrets.io",
+		Version:   "v1",
+		Resource:  "externalsecrets",
+		Kind:      "ExternalSecret",
+		FieldPath: "spec.data",
+	}
+	var testcases = []struct {
+		name      string
+		resources bool
+		expectErr bool
+	}{
+		{
+			name:      "Resource destination with dynamic client. Should create the object.",
+			resources: true,
+			expectErr: false,
+		},
+		{
+			name:      "Resource destination without dynamic client. Should fail.",
+			resources: false,
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			dynamicClient := fake.NewSimpleDynamicClient(runtime.NewScheme())
+
+			spec := verifySpec
+			spec.Destination.Secret = "external-a"
+			spec.Destination.Resource = resource
+
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+			if tc.resources {
+				controller.Resources = &client.ResourceClient{Dynamic: dynamicClient}
+			}
+
+			_, err := controller.Sync(spec)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			// the value should be base64 encoded in the field path of the object
+			obj, err := dynamicClient.Resource(resource.GroupVersionResource()).Namespace("ns-a").Get("external-a", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, _, err := unstructured.NestedString(obj.Object, "spec", "data", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoded != base64.StdEncoding.EncodeToString([]byte("gsm-token-v1")) {
+				t.Errorf("Expected encoded gsm-token-v1, but got %q.", encoded)
+			}
+			if obj.GetKind() != resource.Kind {
+				t.Errorf("Expected kind %s, but got %s.", resource.Kind, obj.GetKind())
+			}
+			if obj.GetLabels()[client.ManagedByLabel] != client.ManagedByValue {
+				t.Errorf("Expected label %s=%s, but got %v.", client.ManagedByLabel, client.ManagedByValue, obj.GetLabels())
+			}
+
+			// the second sync should be a no-op
+			updated, err := controller.Sync(spec)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if updated {
+				t.Errorf("Expected no update on the second sync.")
+			}
+
+			result, err := controller.Verify(spec)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if result.Drifted() {
+				t.Errorf("Expected no drift, but got %v.", result.Drifts)
+			}
+		})
+	}
+}
+
+func TestWaitForNamespace(t *testing.T) {
+	var testcases = []struct {
+		name string
+		// cycle at which the namespace appears
+		appearAt int
+		// cycle at which the spec is expected to be synced
+		expectSyncedAt int
+	}{
+		{
+			name:           "Namespace exists. Should sync in the first cycle.",
+			appearAt:       0,
+			expectSyncedAt: 0,
+		},
+		{
+			name:           "Namespace appears after the first check. Should sync in the next cycle.",
+			appearAt:       1,
+			expectSyncedAt: 1,
+		},
+		{
+			name:           "Namespace appears during the backoff. Should sync at the next check.",
+			appearAt:       2,
+			expectSyncedAt: 3,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := tests.NewMockClient([]string{"project-1"})
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:           cl,
+				Agent:            &config.Agent{},
+				WaitForNamespace: true,
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			for cycle := 0; cycle <= tc.expectSyncedAt; cycle++ {
+				if cycle == tc.appearAt {
+					err = cl.CreateKubernetesNamespace("ns-a")
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				controller.SyncAll()
+
+				value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+				synced := err == nil && bytes.Equal(value, []byte("gsm-token-v1"))
+				if synced != (cycle == tc.expectSyncedAt) {
+					t.Errorf("Cycle %d: expected synced %v, but got %v.", cycle, cycle == tc.expectSyncedAt, synced)
+				}
+
+				expectPending := 1
+				if synced {
+					expectPending = 0
+				}
+				if len(controller.pending) != expectPending {
+					t.Errorf("Cycle %d: expected %d pending specs, but got %d.", cycle, expectPending, len(controller.pending))
+				}
+				if testutil.ToFloat64(pendingSpecs) != float64(expectPending) {
+					t.Errorf("Cycle %d: expected pending metric %d, but got %v.", cycle, expectPending, testutil.ToFloat64(pendingSpecs))
+				}
+			}
+		})
+	}
+}
+
+func TestRefuseUnmanaged(t *testing.T) {
+	var testcases = []struct {
+		name  string
+		adopt bool
+		// permissive writes without RefuseUnmanaged
+		permissive   bool
+		unmanaged    bool
+		expectRefuse bool
+	}{
+		{
+			name:         "Unmanaged destination without adopt. Should refuse to write.",
+			adopt:        false,
+			unmanaged:    true,
+			expectRefuse: true,
+		},
+		{
+			name:         "Unmanaged destination with adopt. Should label and write.",
+			adopt:        true,
+			unmanaged:    true,
+			expectRefuse: false,
+		},
+		{
+			name:         "Missing destination. Should create it.",
+			adopt:        false,
+			unmanaged:    false,
+			expectRefuse: false,
+		},
+		{
+			name:         "Unmanaged destination without refuseUnmanaged. Should write and label it.",
+			permissive:   true,
+			unmanaged:    true,
+			expectRefuse: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+
+			spec := verifySpec
+			spec.Destination.Secret = "secret-other"
+			if tc.unmanaged {
+				// hand-created secret without the managed-by label
+				err := cl.CreateKubernetesSecret("ns-a", "secret-other")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &SecretSyncController{
+				Client:          cl,
+				RefuseUnmanaged: !tc.permissive,
+				AdoptUnmanaged:  tc.adopt,
+			}
+
+			_, err := controller.Sync(spec)
+			refused := false
+			if agg, ok := err.(utilerrors.Aggregate); ok {
+				for _, e := range agg.Errors() {
+					if _, ok := e.(*ErrUnmanagedDestination); ok {
+						refused = true
+					}
+				}
+			}
+			if refused != tc.expectRefuse {
+				t.Errorf("Expected refused %v, but got error: %v.", tc.expectRefuse, err)
+			}
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-other", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expectRefuse {
+				if value != nil {
+					t.Errorf("Expected unmanaged secret untouched, but got %s.", value)
+				}
+				return
+			}
+			if string(value) != "gsm-token-v1" {
+				t.Errorf("Expected gsm-token-v1, but got %s.", value)
+			}
+			labels, err := cl.GetKubernetesSecretLabels("ns-a", "secret-other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if labels[client.ManagedByLabel] != client.ManagedByValue {
+				t.Errorf("Expected label %s=%s, but got %v.", client.ManagedByLabel, client.ManagedByValue, labels)
+			}
+			annotations, err := cl.GetKubernetesSecretAnnotations("ns-a", "secret-other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, version, err := cl.GetSecretManagerSecretVersion("project-1", "gsm-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectSource := "projects/project-1/secrets/gsm-token@" + version
+			if annotations[client.SourceAnnotation("key-a")] != expectSource {
+				t.Errorf("Expected the key annotated with its source %s, but got %v.", expectSource, annotations)
+			}
+		})
+	}
+}
+
+func TestManagerName(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		labeledBy    string
+		expectRefuse bool
+	}{
+		{
+			name:         "Destination labeled by another manager. Should refuse to write.",
+			labeledBy:    client.ManagedByValue,
+			expectRefuse: true,
+		},
+		{
+			name:         "Destination labeled by this manager. Should write.",
+			labeledBy:    "sync-staging",
+			expectRefuse: false,
+		},
+		{
+			name:         "Missing destination. Should create it labeled by this manager.",
+			labeledBy:    "",
+			expectRefuse: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			cl.Manager = "sync-staging"
+
+			spec := verifySpec
+			spec.Destination.Secret = "secret-other"
+			if tc.labeledBy != "" {
+				err := cl.CreateKubernetesSecret("ns-a", "secret-other")
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = cl.LabelKubernetesSecret("ns-a", "secret-other", map[string]string{client.ManagedByLabel: tc.labeledBy})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &SecretSyncController{
+				Client:          cl,
+				RefuseUnmanaged: true,
+			}
+
+			_, err := controller.Sync(spec)
+			refused := false
+			if agg, ok := err.(utilerrors.Aggregate); ok {
+				for _, e := range agg.Errors() {
+					if unmanaged, ok := e.(*ErrUnmanagedDestination); ok {
+						refused = true
+						if !strings.Contains(unmanaged.Error(), "sync-staging") {
+							t.Errorf("Expected the error to name manager sync-staging, but got %s.", unmanaged)
+						}
+					}
+				}
+			}
+			if refused != tc.expectRefuse {
+				t.Errorf("Expected refused %v, but got error: %v.", tc.expectRefuse, err)
+			}
+
+			labels, err := cl.GetKubernetesSecretLabels("ns-a", "secret-other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectLabel := "sync-staging"
+			if tc.expectRefuse {
+				expectLabel = tc.labeledBy
+			}
+			if labels[client.ManagedByLabel] != expectLabel {
+				t.Errorf("Expected label %s=%s, but got %v.", client.ManagedByLabel, expectLabel, labels)
+			}
+		})
+	}
+}
+
+func TestRecreateDeletedDestination(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		source []byte
+	}{
+		{
+			name:   "Deleted destination with an unchanged source value. Should re-create it.",
+			source: []byte("gsm-token-v1"),
+		},
+		{
+			name:   "Deleted destination with an empty source value. Should re-create it.",
+			source: []byte{},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", tc.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			_, err = controller.Sync(verifySpec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			err = cl.DeleteKubernetesSecret("ns-a", "secret-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			updated, err := controller.Sync(verifySpec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !updated {
+				t.Errorf("Expected the deleted destination to be re-created.")
+			}
+			err = cl.ValidateKubernetesSecret("ns-a", "secret-a")
+			if err != nil {
+				t.Fatalf("Expected the deleted destination to be re-created, but got error: %s", err)
+			}
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != string(tc.source) {
+				t.Errorf("Expected %q, but got %q.", tc.source, value)
+			}
+
+			// the re-created destination is in sync
+			updated, err = controller.Sync(verifySpec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if updated {
+				t.Errorf("Expected the re-created destination to be in sync.")
+			}
+		})
+	}
+}
+
+func TestSyncCredentialsFrom(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		credentials string
+		noCache     bool
+		expectErr   bool
+		expectValue string
+	}{
+		{
+			name:        "Valid bootstrap credentials. Should read the source with them.",
+			credentials: "cross-org-key",
+			expectErr:   false,
+			expectValue: "cross-org-token",
+		},
+		{
+			name:        "Invalid bootstrap credentials. Should fail.",
+			credentials: "wrong-key",
+			expectErr:   true,
+		},
+		{
+			name:        "No credentials cache. Should fail.",
+			credentials: "cross-org-key",
+			noCache:     true,
+			expectErr:   true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			// the ambient client only reads the credentials, the source lives in another org
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "cross-org-credentials", []byte(tc.credentials))
+			if err != nil {
+				t.Fatal(err)
+			}
+			crossOrg := tests.NewMockClient([]string{"project-2"})
+			err = crossOrg.UpsertSecretManagerSecret("project-2", "gsm-token", []byte("cross-org-token"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+			if !tc.noCache {
+				controller.Credentials = &client.CredentialsCache{
+					Bootstrap: cl,
+					New: func(credentials []byte) (client.SourceReader, error) {
+						if string(credentials) != "cross-org-key" {
+							return nil, fmt.Errorf("invalid credentials")
+						}
+						return crossOrg, nil
+					},
+				}
+			}
+
+			spec := verifySpec
+			spec.Source.Project = "project-2"
+			spec.Destination.Secret = "secret-cross-org"
+			spec.CredentialsFrom = &config.SecretManagerSpec{
+				Project: "project-1",
+				Secret:  "cross-org-credentials",
+			}
+
+			_, err = controller.Sync(spec)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("Expected error %v, but got %v.", tc.expectErr, err)
+			}
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-cross-org", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != tc.expectValue {
+				t.Errorf("Expected value %q, but got %q.", tc.expectValue, value)
+			}
+
+			// the stored credentials are left intact by zeroing the copy read
+			stored, err := cl.GetSecretManagerSecretValue("project-1", "cross-org-credentials")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(stored) != tc.credentials {
+				t.Errorf("Expected stored credentials %s, but got %q.", tc.credentials, stored)
+			}
+		})
+	}
+}
+
+func TestSyncNoOp(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		mutate       func(cl *tests.MockClient) error
+		expectNoOps  float64
+		expectUpdate bool
+	}{
+		{
+			name:         "Destination in sync. Should count a no-op.",
+			mutate:       func(cl *tests.MockClient) error { return nil },
+			expectNoOps:  1,
+			expectUpdate: false,
+		},
+		{
+			name: "Destination drifted. Should update without counting a no-op.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("old-token"))
+			},
+			expectNoOps:  0,
+			expectUpdate: true,
+		},
+		{
+			name: "Missing source. Should fail without counting a no-op.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteSecretManagerSecret("project-1", "gsm-token")
+			},
+			expectNoOps:  0,
+			expectUpdate: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:        cl,
+				NoOpVerbosity: 5,
+			}
+
+			noOpsBefore := testutil.ToFloat64(syncNoOps)
+			updated, _ := controller.Sync(verifySpec)
+			if updated != tc.expectUpdate {
+				t.Errorf("Expected updated %v, but got %v.", tc.expectUpdate, updated)
+			}
+			noOps := testutil.ToFloat64(syncNoOps) - noOpsBefore
+			if noOps != tc.expectNoOps {
+				t.Errorf("Expected %v no-ops, but got %v.", tc.expectNoOps, noOps)
+			}
+		})
+	}
+}
+
+func TestStatusAnnotations(t *testing.T) {
+	mappingSpec := config.SecretSyncSpec{
+		Destination: config.KubernetesSpec{
+			Namespace: "ns-a",
+			Secret:    "secret-a",
+		},
+		Mappings: []config.KeyMapping{
+			{
+				Source: config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token"},
+				Key:    "key-a",
+			},
+			{
+				Source: config.SecretManagerSpec{Project: "project-1", Secret: "gsm-password"},
+				Key:    "key-b",
+			},
+		},
+	}
+
+	var testcases = []struct {
+		name          string
+		spec          config.SecretSyncSpec
+		expectVersion string
+	}{
+		{
+			name:          "Single source. Should record its version.",
+			spec:          verifySpec,
+			expectVersion: "1",
+		},
+		{
+			name:          "Mappings. Should record the version of each key.",
+			spec:          mappingSpec,
+			expectVersion: "key-a=1,key-b=2",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			for _, value := range []string{"gsm-password-v1", "gsm-password-v2"} {
+				err := cl.UpsertSecretManagerSecret("project-1", "gsm-password", []byte(value))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &SecretSyncController{
+				Client:            cl,
+				StatusAnnotations: true,
+			}
+
+			before := time.Now().UTC().Truncate(time.Second)
+			_, err := controller.Sync(tc.spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			annotations := cl.K8sSecretAnnotations["ns-a"]["secret-a"]
+			if annotations[client.LastResultAnnotation] != client.SyncSucceeded {
+				t.Errorf("Expected result %s, but got %v.", client.SyncSucceeded, annotations)
+			}
+			if annotations[client.SourceVersionAnnotation] != tc.expectVersion {
+				t.Errorf("Expected source version %s, but got %v.", tc.expectVersion, annotations)
+			}
+			syncTime, err := time.Parse(time.RFC3339, annotations[client.LastSyncTimeAnnotation])
+			if err != nil || syncTime.Before(before) {
+				t.Errorf("Expected sync time after %s, but got %v.", before, annotations)
+			}
+
+			// a failed sync keeps the versions held by the secret
+			err = cl.DeleteSecretManagerSecret("project-1", "gsm-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = controller.Sync(tc.spec)
+			if err == nil {
+				t.Fatalf("Expected error but got nil.")
+			}
+			annotations = cl.K8sSecretAnnotations["ns-a"]["secret-a"]
+			if annotations[client.LastResultAnnotation] != client.SyncFailed {
+				t.Errorf("Expected result %s, but got %v.", client.SyncFailed, annotations)
+			}
+			if annotations[client.SourceVersionAnnotation] != tc.expectVersion {
+				t.Errorf("Expected source version %s kept, but got %v.", tc.expectVersion, annotations)
+			}
+		})
+	}
+}
+
+func TestScheduleOverrun(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		period        time.Duration
+		busy          time.Duration
+		expectOverrun bool
+	}{
+		{
+			name:          "Cycles within the period. Should not drop ticks.",
+			period:        50 * time.Millisecond,
+			busy:          0,
+			expectOverrun: false,
+		},
+		{
+			name:          "Cycle overrunning multiple periods. Should drop ticks.",
+			period:        20 * time.Millisecond,
+			busy:          110 * time.Millisecond,
+			expectOverrun: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+
+			overruns := make(chan struct{}, 100)
+			ch := schedule(0, tc.period, done, func() { overruns <- struct{}{} })
+
+			for i := 0; i < 3; i++ {
+				select {
+				case <-ch:
+				case <-time.After(time.Second):
+					t.Fatalf("Tick %d not received.", i)
+				}
+				// simulate a busy cycle
+				time.Sleep(tc.busy)
+			}
+
+			if len(overruns) > 0 != tc.expectOverrun {
+				t.Errorf("Expected overrun %v, got %d dropped ticks.", tc.expectOverrun, len(overruns))
+			}
+		})
+	}
+}
+
+func TestSyncTransforms(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		source     string
+		transforms []config.Transform
+		expected   string
+		expectErr  bool
+	}{
+		{
+			name:       "Trailing newline trimmed. Should write and then no-op.",
+			source:     "gsm-token-v1\n",
+			transforms: []config.Transform{config.TransformTrim},
+			expected:   "gsm-token-v1",
+		},
+		{
+			name:       "Chained transforms. Should write and then no-op.",
+			source:     "Z3NtLXRva2VuLXYx\n",
+			transforms: []config.Transform{config.TransformTrim, config.TransformBase64Decode},
+			expected:   "gsm-token-v1",
+		},
+		{
+			name:       "Failing transform. Should not write.",
+			source:     "not base64!",
+			transforms: []config.Transform{config.TransformBase64Decode},
+			expectErr:  true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := tests.NewMockClient([]string{"project-1"})
+			for _, err := range []error{
+				cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte(tc.source)),
+				cl.CreateKubernetesNamespace("ns-a"),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			spec := verifySpec
+			spec.Transforms = tc.transforms
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			updated, err := controller.Sync(spec)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				}
+				data, _ := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+				if data != nil {
+					t.Errorf("Expected no destination value, got %q.", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !updated {
+				t.Errorf("Expected the first sync to update the destination.")
+			}
+			data, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("Expected %q, got %q.", tc.expected, data)
+			}
+
+			// the no-op check and the verification compare the transformed value
+			updated, err = controller.Sync(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated {
+				t.Errorf("Expected the second sync to be a no-op.")
+			}
+			result, err := controller.Verify(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Drifted() {
+				t.Errorf("Expected no drift, got %v.", result.Drifts)
+			}
+		})
+	}
+}
+
+func TestSyncJSONFields(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		source    string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name:     "Fields mapped to keys. Should write each field and then no-op.",
+			source:   `{"user": "admin", "pass": "gsm-token-v1", "port": 5432}`,
+			expected: map[string]string{"username": "admin", "password": "gsm-token-v1"},
+		},
+		{
+			name:      "Missing field. Should fail on the missing field only.",
+			source:    `{"user": "admin"}`,
+			expected:  map[string]string{"username": "admin"},
+			expectErr: true,
+		},
+		{
+			name:      "Not a JSON object. Should not write.",
+			source:    "gsm-token-v1",
+			expected:  map[string]string{},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := tests.NewMockClient([]string{"project-1"})
+			for _, err := range []error{
+				cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte(tc.source)),
+				cl.CreateKubernetesNamespace("ns-a"),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			spec := config.SecretSyncSpec{
+				Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+				Mappings: []config.KeyMapping{
+					{
+						Source: config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token", JSONField: "user"},
+						Key:    "username",
+					},
+					{
+						Source: config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token", JSONField: "pass"},
+						Key:    "password",
+					},
+				},
+			}
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			_, err := controller.Sync(spec)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				} else if strings.Contains(err.Error(), "gsm-token-v1") {
+					t.Errorf("Error holds the secret value: %s", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"username", "password"} {
+				data, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected, ok := tc.expected[key]
+				if !ok && data != nil {
+					t.Errorf("Expected no value of %s, got %q.", key, data)
+				} else if ok && string(data) != expected {
+					t.Errorf("Expected %q for %s, got %q.", expected, key, data)
+				}
+			}
+			if tc.expectErr {
+				return
+			}
+
+			updated, err := controller.Sync(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated {
+				t.Errorf("Expected the second sync to be a no-op.")
+			}
+			result, err := controller.Verify(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Drifted() {
+				t.Errorf("Expected no drift, got %v.", result.Drifts)
+			}
+		})
+	}
+}
+
+func TestSyncKeys(t *testing.T) {
+	var testcases = []struct {
+		name     string
+		source   string
+		spec     config.SecretSyncSpec
+		expected map[string]string
+	}{
+		{
+			name:   "Keys. Should write the source into each key.",
+			source: "gsm-token-v1",
+			spec: config.SecretSyncSpec{
+				Source:      config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token"},
+				Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+				Keys:        []string{"token", "TOKEN"},
+			},
+			expected: map[string]string{"token": "gsm-token-v1", "TOKEN": "gsm-token-v1"},
+		},
+		{
+			name:   "KeyMap. Should write each field into its key.",
+			source: `{"user": "admin", "pass": "gsm-token-v1", "port": 5432}`,
+			spec: config.SecretSyncSpec{
+				Source:      config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token"},
+				Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+				KeyMap:      map[string]string{"user": "username", "pass": "password"},
+			},
+			expected: map[string]string{"username": "admin", "password": "gsm-token-v1"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := tests.NewMockClient([]string{"project-1"})
+			for _, err := range []error{
+				cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte(tc.source)),
+				cl.CreateKubernetesNamespace("ns-a"),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tc.spec.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			if _, err := controller.Sync(tc.spec); err != nil {
+				t.Fatal(err)
+			}
+			actual := map[string]string{}
+			for key, data := range cl.K8sSecret["ns-a"]["secret-a"] {
+				actual[key] = string(data)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %v, got %v.", tc.expected, actual)
+			}
+
+			updated, err := controller.Sync(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated {
+				t.Errorf("Expected the second sync to be a no-op.")
+			}
+		})
+	}
+}
+
+// orderRecorder records the destination secrets written, in order.
+type orderRecorder struct {
+	*tests.MockClient
+	written []string
+}
+
+func (cl *orderRecorder) UpsertKubernetesSecretValue(namespace, id, key string, data []byte, stringData bool, annotations map[string]string) error {
+	cl.written = append(cl.written, id)
+	return cl.MockClient.UpsertKubernetesSecretValue(namespace, id, key, data, stringData, annotations)
+}
+
+func TestSyncAllDependsOn(t *testing.T) {
+	spec := func(name string, deps ...string) config.SecretSyncSpec {
+		return config.SecretSyncSpec{
+			Name: name,
+			Source: config.SecretManagerSpec{
+				Project: "project-1",
+				Secret:  "gsm-" + name,
+			},
+			Destination: config.KubernetesSpec{
+				Namespace: "ns-a",
+				Secret:    "secret-" + name,
+				Key:       "key",
+			},
+			DependsOn: deps,
+		}
+	}
+
+	var testcases = []struct {
+		name     string
+		specs    []config.SecretSyncSpec
+		sources  []string
+		expected []string
+	}{
+		{
+			name:     "Dependents listed first. Should sync dependencies first.",
+			specs:    []config.SecretSyncSpec{spec("leaf", "ca"), spec("ca", "root"), spec("root")},
+			sources:  []string{"leaf", "ca", "root"},
+			expected: []string{"secret-root", "secret-ca", "secret-leaf"},
+		},
+		{
+			name:     "Dependency failing. Should skip its dependents only.",
+			specs:    []config.SecretSyncSpec{spec("leaf", "ca"), spec("ca"), spec("other")},
+			sources:  []string{"leaf", "other"},
+			expected: []string{"secret-other"},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := &orderRecorder{MockClient: tests.NewMockClient([]string{"project-1"})}
+			err := cl.CreateKubernetesNamespace("ns-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, source := range tc.sources {
+				err := cl.UpsertSecretManagerSecret("project-1", "gsm-"+source, []byte(source))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &SecretSyncController{
+				Client: cl,
+				Agent:  &config.Agent{},
+			}
+			cfg := &config.SecretSyncConfig{Specs: tc.specs}
+			err = cfg.Validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			controller.Agent.Set(cfg)
+			controller.SyncAll()
+
+			if !reflect.DeepEqual(cl.written, tc.expected) {
+				t.Errorf("Expected writes %v, got %v.", tc.expected, cl.written)
+			}
+		})
+	}
+}
+
+func TestSyncMinLength(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		minLength    int
+		expectRefuse bool
+	}{
+		{
+			name:         "Source shorter than minLength. Should refuse to write.",
+			minLength:    6,
+			expectRefuse: true,
+		},
+		{
+			name:         "Source as long as minLength. Should write.",
+			minLength:    5,
+			expectRefuse: false,
+		},
+		{
+			name:         "Source longer than minLength. Should write.",
+			minLength:    4,
+			expectRefuse: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("short"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := verifySpec
+			spec.Source.MinLength = tc.minLength
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			before := testutil.ToFloat64(shortSources.WithLabelValues(spec.Source.String()))
+			_, err = controller.Sync(spec)
+			refused := false
+			if agg, ok := err.(utilerrors.Aggregate); ok {
+				for _, e := range agg.Errors() {
+					if _, ok := e.(*ErrSourceTooShort); ok {
+						refused = true
+					}
+				}
+			}
+			if refused != tc.expectRefuse {
+				t.Errorf("Expected refused %v, but got error: %v.", tc.expectRefuse, err)
+			}
+			if !tc.expectRefuse && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			expectValue := "short"
+			expectShort := before
+			if tc.expectRefuse {
+				expectValue = "gsm-token-v1"
+				expectShort = before + 1
+			}
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != expectValue {
+				t.Errorf("Expected %s, but got %s.", expectValue, value)
+			}
+			short := testutil.ToFloat64(shortSources.WithLabelValues(spec.Source.String()))
+			if short != expectShort {
+				t.Errorf("Expected %v short sources, but got %v.", expectShort, short)
+			}
+		})
+	}
+}
+
+// echoingClient fails the writes of destination secrets with an error echoing the strategic merge patch,
+// as the API server may do for a rejected patch.
+type echoingClient struct {
+	*tests.MockClient
+}
+
+func (cl *echoingClient) UpsertKubernetesSecretValue(namespace, id, key string, data []byte, stringData bool, annotations map[string]string) error {
+	if stringData {
+		return fmt.Errorf(`Secret "%s" is invalid: patch {"stringData":{"%s":%q}}`, id, key, data)
+	}
+	return fmt.Errorf(`Secret "%s" is invalid: patch {"data":{"%s":"%s"}}`, id, key, base64.StdEncoding.EncodeToString(data))
+}
+
+func TestSyncRedactsValues(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		stringData bool
+	}{
+		{
+			name:       "Rejected data patch. Should redact the value from the errors.",
+			stringData: false,
+		},
+		{
+			name:       "Rejected stringData patch. Should redact the value from the errors.",
+			stringData: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := verifySpec
+			spec.Destination.StringData = tc.stringData
+			controller := &SecretSyncController{
+				Client: &echoingClient{cl},
+				Agent:  &config.Agent{},
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{spec},
+			})
+
+			_, syncErr := controller.Sync(spec)
+			if syncErr == nil {
+				t.Fatalf("Expected error but got nil.")
+			}
+			outputs := []string{syncErr.Error(), fmt.Sprintf("%v", syncErr)}
+			for _, msg := range controller.SyncAll().Failed {
+				outputs = append(outputs, msg)
+			}
+			for _, output := range outputs {
+				for _, leak := range []string{"gsm-token-v2", base64.StdEncoding.EncodeToString([]byte("gsm-token-v2"))} {
+					if strings.Contains(output, leak) {
+						t.Errorf("Expected the value redacted, but got %s.", output)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSyncMaxSourceBytes(t *testing.T) {
+	var testcases = []struct {
+		name           string
+		maxSourceBytes int
+		expectRefuse   bool
+	}{
+		{
+			name:           "Source larger than the maximum. Should refuse to write.",
+			maxSourceBytes: 11,
+			expectRefuse:   true,
+		},
+		{
+			name:           "Source as large as the maximum. Should write.",
+			maxSourceBytes: 12,
+			expectRefuse:   false,
+		},
+		{
+			name:           "Source smaller than the maximum. Should write.",
+			maxSourceBytes: 13,
+			expectRefuse:   false,
+		},
+		{
+			name:           "Default maximum. Should write.",
+			maxSourceBytes: 0,
+			expectRefuse:   false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			// 12 bytes long
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:         cl,
+				MaxSourceBytes: tc.maxSourceBytes,
+			}
+
+			_, err = controller.Sync(verifySpec)
+			refused := false
+			if agg, ok := err.(utilerrors.Aggregate); ok {
+				for _, e := range agg.Errors() {
+					if tooLarge, ok := e.(*ErrSourceTooLarge); ok {
+						refused = true
+						if tooLarge.Length != 12 || tooLarge.Max != tc.maxSourceBytes {
+							t.Errorf("Expected 12 bytes over a maximum of %d, but got %s.", tc.maxSourceBytes, tooLarge)
+						}
+					}
+				}
+			}
+			if refused != tc.expectRefuse {
+				t.Errorf("Expected refused %v, but got error: %v.", tc.expectRefuse, err)
+			}
+
+			expectValue := "gsm-token-v2"
+			if tc.expectRefuse {
+				expectValue = "gsm-token-v1"
+			}
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != expectValue {
+				t.Errorf("Expected %s, but got %s.", expectValue, value)
+			}
+		})
+	}
+}
+
+func TestSyncEqualityMode(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		mode          config.EqualityMode
+		source        string
+		destination   string
+		expectUpdated bool
+		expectValue   string
+	}{
+		{
+			name:          "Exact with reordered JSON keys. Should update.",
+			mode:          config.EqualityExact,
+			source:        `{"user": "admin", "password": "pw"}`,
+			destination:   `{"password":"pw","user":"admin"}`,
+			expectUpdated: true,
+			expectValue:   `{"user": "admin", "password": "pw"}`,
+		},
+		{
+			name:          "Canonical JSON with reordered JSON keys. Should not update.",
+			mode:          config.EqualityJSONCanonical,
+			source:        `{"user": "admin", "password": "pw"}`,
+			destination:   "{\n  \"password\": \"pw\",\n  \"user\": \"admin\"\n}\n",
+			expectUpdated: false,
+			expectValue:   "{\n  \"password\": \"pw\",\n  \"user\": \"admin\"\n}\n",
+		},
+		{
+			name:          "Canonical JSON with a changed value. Should write the canonical form.",
+			mode:          config.EqualityJSONCanonical,
+			source:        `{"user": "admin", "password": "pw2"}`,
+			destination:   `{"password":"pw","user":"admin"}`,
+			expectUpdated: true,
+			expectValue:   `{"password":"pw2","user":"admin"}`,
+		},
+		{
+			name:          "Trim with trailing whitespace. Should not update.",
+			mode:          config.EqualityTrim,
+			source:        "token\n",
+			destination:   "token",
+			expectUpdated: false,
+			expectValue:   "token",
+		},
+		{
+			name:          "Trim with a changed value. Should write the trimmed form.",
+			mode:          config.EqualityTrim,
+			source:        "token-v2\n",
+			destination:   "token",
+			expectUpdated: true,
+			expectValue:   "token-v2",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			for _, err := range []error{
+				cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte(tc.source)),
+				cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte(tc.destination)),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			spec := verifySpec
+			spec.EqualityMode = tc.mode
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+			updated, err := controller.Sync(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated != tc.expectUpdated {
+				t.Errorf("Expected updated %v, but got %v.", tc.expectUpdated, updated)
+			}
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != tc.expectValue {
+				t.Errorf("Expected value %q, but got %q.", tc.expectValue, value)
+			}
+
+			// the written value is stable, so that the next sync is a no-op
+			updated, err = controller.Sync(spec)
+			if err != nil || updated {
+				t.Errorf("Expected the next sync to be a no-op, but got updated %v: %v.", updated, err)
+			}
+		})
+	}
+}
+
+func TestSyncAudit(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		mutate        func(cl *tests.MockClient) error
+		spec          func(spec config.SecretSyncSpec) config.SecretSyncSpec
+		expectRecords []audit.Record
+	}{
+		{
+			name: "Destination updated. Should record a succeeded sync.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+			},
+			expectRecords: []audit.Record{{Operation: audit.Sync, Spec: verifySpec.String(), Result: audit.Succeeded}},
+		},
+		{
+			name:          "Destination unchanged. Should not record.",
+			mutate:        func(cl *tests.MockClient) error { return nil },
+			expectRecords: []audit.Record{},
+		},
+		{
+			name: "Source missing. Should record a failed sync.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteSecretManagerSecret("project-1", "gsm-token")
+			},
+			expectRecords: []audit.Record{{Operation: audit.Sync, Spec: verifySpec.String(), Result: audit.Failed}},
+		},
+		{
+			name: "Write window closed. Should record a deferred sync.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+			},
+			spec: func(spec config.SecretSyncSpec) config.SecretSyncSpec {
+				// opens one minute past midnight only
+				spec.WriteWindow = &config.WriteWindow{Cron: "0 1 0 1 1 *", Duration: time.Minute}
+				return spec
+			},
+			expectRecords: []audit.Record{{Operation: audit.Sync, Spec: verifySpec.String(), Result: audit.Deferred}},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec := verifySpec
+			if tc.spec != nil {
+				spec = tc.spec(spec)
+			}
+
+			var buf bytes.Buffer
+			controller := &SecretSyncController{
+				Client:      cl,
+				AuditLogger: audit.NewLogger(&buf, "secret-sync-controller", "pod-1"),
+				now:         func() time.Time { return time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC) },
+			}
+			controller.Sync(spec)
+
+			if bytes.Contains(buf.Bytes(), []byte("gsm-token-v")) {
+				t.Errorf("Expected no secret value in the audit log, but got %q.", buf.String())
+			}
+			records := []audit.Record{}
+			for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
+				if len(line) == 0 {
+					continue
+				}
+				record := audit.Record{}
+				err := json.Unmarshal(line, &record)
+				if err != nil {
+					t.Fatalf("Invalid audit record %q: %s", line, err)
+				}
+				if record.Component != "secret-sync-controller" || record.Actor != "pod-1" || record.Time.IsZero() {
+					t.Errorf("Expected the record stamped with its time, component and actor, but got %+v.", record)
+				}
+				if record.Result == audit.Succeeded && record.Version == "" {
+					t.Errorf("Expected the source version recorded, but got %+v.", record)
+				}
+				if (record.Result == audit.Succeeded) != (record.Error == "") {
+					t.Errorf("Expected an error recorded only if not succeeded, but got %+v.", record)
+				}
+				records = append(records, audit.Record{Operation: record.Operation, Spec: record.Spec, Result: record.Result})
+			}
+			if !reflect.DeepEqual(records, tc.expectRecords) {
+				t.Errorf("Expected records %v, but got %v.", tc.expectRecords, records)
+			}
+		})
+	}
+}
+
+func TestSyncMetrics(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		source        string
+		expectSuccess bool
+	}{
+		{
+			name:          "Unchanged source. Should count a success.",
+			source:        "gsm-token",
+			expectSuccess: true,
+		},
+		{
+			name:          "Updated source. Should count a success.",
+			source:        "gsm-token-2",
+			expectSuccess: true,
+		},
+		{
+			name:          "Missing source. Should count a failure.",
+			source:        "missing",
+			expectSuccess: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token-2", []byte("gsm-token-v2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := verifySpec
+			spec.Source.Secret = tc.source
+			id := spec.ID().String()
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			attempted := testutil.ToFloat64(syncsAttempted.WithLabelValues(id))
+			succeeded := testutil.ToFloat64(syncsSucceeded.WithLabelValues(id))
+			failed := testutil.ToFloat64(syncsFailed.WithLabelValues(id))
+			lastSuccess := testutil.ToFloat64(lastSyncSuccess.WithLabelValues(id))
+			start := time.Now()
+
+			_, err = controller.Sync(spec)
+			if tc.expectSuccess != (err == nil) {
+				t.Errorf("Expected success %v, but got error: %v.", tc.expectSuccess, err)
+			}
+
+			if delta := testutil.ToFloat64(syncsAttempted.WithLabelValues(id)) - attempted; delta != 1 {
+				t.Errorf("Expected 1 attempted sync, but got %v.", delta)
+			}
+			expectSucceeded, expectFailed := 0.0, 1.0
+			if tc.expectSuccess {
+				expectSucceeded, expectFailed = 1, 0
+			}
+			if delta := testutil.ToFloat64(syncsSucceeded.WithLabelValues(id)) - succeeded; delta != expectSucceeded {
+				t.Errorf("Expected %v succeeded syncs, but got %v.", expectSucceeded, delta)
+			}
+			if delta := testutil.ToFloat64(syncsFailed.WithLabelValues(id)) - failed; delta != expectFailed {
+				t.Errorf("Expected %v failed syncs, but got %v.", expectFailed, delta)
+			}
+			last := testutil.ToFloat64(lastSyncSuccess.WithLabelValues(id))
+			if tc.expectSuccess && last < float64(start.Unix()) {
+				t.Errorf("Expected last success timestamp after %v, but got %v.", start.Unix(), last)
+			}
+			if !tc.expectSuccess && last != lastSuccess {
+				t.Errorf("Expected last success timestamp %v, but got %v.", lastSuccess, last)
+			}
+		})
+	}
+}
+
+func TestStartLeaderElection(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		leaseHolder  string
+		expectSynced bool
+	}{
+		{
+			name:         "Free lease. Should sync as the leader.",
+			expectSynced: true,
+		},
+		{
+			name:         "Lease held by another replica. Should wait without syncing.",
+			leaseHolder:  "replica-b",
+			expectSynced: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clientset := k8sfake.NewSimpleClientset()
+			if tc.leaseHolder != "" {
+				_, err := clientset.CoordinationV1().Leases("ns-a").Create(&coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{Name: "lease"},
+					Spec:       coordinationv1.LeaseSpec{HolderIdentity: &tc.leaseHolder},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &SecretSyncController{
+				Client:  cl,
+				Agent:   &config.Agent{},
+				RunOnce: true,
+				LeaderElection: &leaderelect.Config{
+					Clientset: clientset,
+					Namespace: "ns-a",
+					Name:      "lease",
+					Identity:  "replica-a",
+				},
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{Specs: []config.SecretSyncSpec{verifySpec}})
+
+			stopChan := make(chan struct{})
+			time.AfterFunc(500*time.Millisecond, func() { close(stopChan) })
+			err = controller.Start(stopChan)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+
+			expectValue := "gsm-token-v1"
+			if tc.expectSynced {
+				expectValue = "gsm-token-v2"
+			}
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != expectValue {
+				t.Errorf("Expected %s, but got %s.", expectValue, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// Decommission deletes the destination K8s secrets of all specs in cfg, in all the matching namespaces of a namespace pattern.
+// Only secrets labeled as managed by the secret sync controller are deleted,
+// unmanaged secrets and the sources of reverse or bidirectional specs are left untouched, and missing namespaces or secrets are skipped,
+// so that it is safe to re-run.
+// Returns the aggregated error of all secrets that it failed to delete.
+func Decommission(cl client.Interface, cfg *config.SecretSyncConfig) error {
+	errs := []error{}
+	visited := map[config.KubernetesSpec]bool{}
+
+	specs := cfg.Specs
+	if config.AnyNamespacePattern(specs) {
+		namespaces, err := cl.ListKubernetesNamespaces()
+		if err != nil {
+			return fmt.Errorf("Fail to list namespaces: %s", err)
+		}
+		// the copies overridden by other specs are decommissioned with them
+		specs, _ = config.ExpandNamespaces(specs, namespaces)
+	}
+
+	for _, spec := range specs {
+		if spec.Destination.Resource.IsSet() {
+			klog.Warningf("Custom resource destination %s is not decommissioned. Skipping...", spec.Destination)
+			continue
+		}
+		if spec.Direction.WritesSecretManager() {
+			klog.Warningf("Secret %s is a source of a %s spec, not decommissioned. Skipping...", spec.Destination, spec.Direction)
+			continue
+		}
+
+		// several specs may share the same destination secret with different keys
+		dest := config.KubernetesSpec{
+			Namespace: spec.Destination.Namespace,
+			Secret:    spec.Destination.Secret,
+		}
+		if visited[dest] {
+			continue
+		}
+		visited[dest] = true
+
+		labels, err := cl.GetKubernetesSecretLabels(dest.Namespace, dest.Secret)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				klog.V(2).Infof("Secret namespaces/%s/secrets/%s not found. Skipping...", dest.Namespace, dest.Secret)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("Fail to get labels of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err))
+			continue
+		}
+
+		if labels[client.ManagedByLabel] != cl.ManagerName() {
+			klog.Warningf("Secret namespaces/%s/secrets/%s is not managed by %s. Skipping...", dest.Namespace, dest.Secret, cl.ManagerName())
+			continue
+		}
+
+		err = cl.DeleteKubernetesSecret(dest.Namespace, dest.Secret)
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("Fail to delete namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err))
+			continue
+		}
+
+		klog.V(2).Infof("Decommissioned secret namespaces/%s/secrets/%s", dest.Namespace, dest.Secret)
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+	"text/template"
+)
+
+func TestDecommission(t *testing.T) {
+	var fixtureConfig = `
+      secretmanager:
+        {{.}}:
+          gsm-password: gsm-password-v1
+          gsm-token: gsm-token-v1
+      kubernetes:
+        ns-a:
+          secret-a:
+            key-a: old-token
+        ns-c:
+`
+	// substitute fixture project to testOpts.gsmProject
+	temp := template.Must(template.New("config").Parse(fixtureConfig))
+	fixtureBuffer := new(bytes.Buffer)
+	temp.Execute(fixtureBuffer, testOpts.gsmProject)
+
+	fixture, err := tests.NewFixture(fixtureBuffer.Bytes())
+	if err != nil {
+		t.Fatalf("Fail to parse fixture: %s", err)
+	}
+
+	err = fixture.Setup(testClient)
+	if err != nil {
+		t.Fatalf("Fail to setup fixture: %s", err)
+	}
+
+	err = fixture.Reset(testClient)
+	if err != nil {
+		t.Fatalf("Fail to reset fixture: %s", err)
+	}
+
+	conf := &config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{
+			{
+				// secret-a is created by the fixture and never synced, thus not managed by the controller
+				Source: config.SecretManagerSpec{
+					Project: testOpts.gsmProject,
+					Secret:  "gsm-token",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+			},
+			{
+				// secret-c is created by the controller
+				Source: config.SecretManagerSpec{
+					Project: testOpts.gsmProject,
+					Secret:  "gsm-token",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-c",
+					Secret:    "secret-c",
+					Key:       "key-c",
+				},
+			},
+			{
+				Source: config.SecretManagerSpec{
+					Project: testOpts.gsmProject,
+					Secret:  "gsm-password",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-c",
+					Secret:    "secret-c",
+					Key:       "key-d",
+				},
+			},
+			{
+				Source: config.SecretManagerSpec{
+					Project: testOpts.gsmProject,
+					Secret:  "gsm-password",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "missed",
+					Secret:    "secret-missed",
+					Key:       "key-missed",
+				},
+			},
+		},
+	}
+
+	defer fixture.Teardown(testClient, decommissionSynced(conf))
+
+	controller := &SecretSyncController{
+		Client:  testClient,
+		RunOnce: true,
+	}
+	// a sync labels the secrets it writes as managed
+	for _, spec := range conf.Specs[1:3] {
+		_, err := controller.Sync(spec)
+		if err != nil {
+			t.Fatalf("Fail to sync %s: %s", spec, err)
+		}
+	}
+
+	// decommission twice to make sure it is safe to re-run
+	for i := 0; i < 2; i++ {
+		err = Decommission(testClient, conf)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+
+		err = testClient.ValidateKubernetesSecret("ns-a", "secret-a")
+		if err != nil {
+			t.Errorf("Unmanaged secret namespaces/ns-a/secrets/secret-a should not be deleted: %s", err)
+		}
+
+		err = testClient.ValidateKubernetesSecret("ns-c", "secret-c")
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("Managed secret namespaces/ns-c/secrets/secret-c should be deleted, but got: %v", err)
+		}
+	}
+}
+
+// decommissionSynced returns the decommission of tests.Fixture.Teardown(), deleting the managed destination secrets of the specs in cfg by then.
+func decommissionSynced(cfg *config.SecretSyncConfig) func() error {
+	return func() error {
+		return Decommission(testClient, cfg)
+	}
+}
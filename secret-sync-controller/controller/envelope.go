@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// EnvelopePrefix marks the values of the destinations with KubernetesSpec.EnvelopeEncrypt,
+// stored as EnvelopePrefix followed by the base64 encoded Cloud KMS ciphertext of the value.
+// The consumers strip it and decrypt the ciphertext with the same key, e.g. in an init container.
+const EnvelopePrefix = "gsm-kms:v1:"
+
+// Encrypter encrypts and decrypts the values of the destinations with KubernetesSpec.EnvelopeEncrypt
+// with Cloud KMS keys, e.g. client.KMSClient.
+type Encrypter interface {
+	Encrypt(keyName string, plaintext []byte) ([]byte, error)
+	Decrypt(keyName string, ciphertext []byte) ([]byte, error)
+}
+
+// seal encrypts data with the KMS key of dest, and returns the marked ciphertext stored in dest.
+func (c *SecretSyncController) seal(dest config.KubernetesSpec, data []byte) ([]byte, error) {
+	if c.Encrypter == nil {
+		return nil, fmt.Errorf("No KMS client to encrypt %s", dest)
+	}
+
+	ciphertext, err := c.Encrypter.Encrypt(dest.EnvelopeEncrypt.KMSKey, data)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to encrypt %s with %s: %s", dest, dest.EnvelopeEncrypt.KMSKey, err)
+	}
+	return []byte(EnvelopePrefix + base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// open decrypts the marked ciphertext stored in dest, so that the destination is compared with the source in plaintext:
+// the ciphertexts of the same plaintext differ at each encryption, and would be rewritten at each sync otherwise.
+// Returns nil, i.e. a missing value to be rewritten, if data is not a ciphertext of the KMS key of dest,
+// e.g. written in plaintext before EnvelopeEncrypt is set, or encrypted with a previous key.
+func (c *SecretSyncController) open(dest config.KubernetesSpec, data []byte) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+	if !bytes.HasPrefix(data, []byte(EnvelopePrefix)) {
+		klog.V(2).Infof("Secret %s is not encrypted with %s. Considering it out of sync...", dest, dest.EnvelopeEncrypt.KMSKey)
+		return nil, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(string(data[len(EnvelopePrefix):]))
+	if err != nil {
+		klog.Warningf("Secret %s holds a malformed ciphertext. Considering it out of sync...", dest)
+		return nil, nil
+	}
+
+	if c.Encrypter == nil {
+		return nil, fmt.Errorf("No KMS client to decrypt %s", dest)
+	}
+	plaintext, err := c.Encrypter.Decrypt(dest.EnvelopeEncrypt.KMSKey, ciphertext)
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			klog.V(2).Infof("Secret %s is not encrypted with %s. Considering it out of sync...", dest, dest.EnvelopeEncrypt.KMSKey)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Fail to decrypt %s with %s: %s", dest, dest.EnvelopeEncrypt.KMSKey, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+)
+
+func TestEnvelopeEncrypt(t *testing.T) {
+	kmsKey := "projects/project-1/locations/global/keyRings/ring-1/cryptoKeys/key-1"
+	spec := verifySpec
+	spec.Destination.EnvelopeEncrypt = &config.EnvelopeEncryption{KMSKey: kmsKey}
+
+	// sealed returns the stored ciphertext of plaintext with key
+	sealed := func(key, plaintext string) []byte {
+		ciphertext, _ := (&tests.FakeKMS{}).Encrypt(key, []byte(plaintext))
+		return []byte(EnvelopePrefix + base64.StdEncoding.EncodeToString(ciphertext))
+	}
+
+	var testcases = []struct {
+		name          string
+		destination   []byte
+		kms           *tests.FakeKMS
+		expectUpdated bool
+		expectError   bool
+		// expectPlaintext is the plaintext of the ciphertext expected in the destination, if any
+		expectPlaintext string
+	}{
+		{
+			name:            "Missing destination. Should write the ciphertext of the source.",
+			destination:     nil,
+			kms:             &tests.FakeKMS{},
+			expectUpdated:   true,
+			expectPlaintext: "gsm-token-v1",
+		},
+		{
+			name:            "Destination encrypted from the same plaintext. Should not rewrite.",
+			destination:     sealed(kmsKey, "gsm-token-v1"),
+			kms:             &tests.FakeKMS{},
+			expectUpdated:   false,
+			expectPlaintext: "gsm-token-v1",
+		},
+		{
+			name:            "Destination encrypted from an outdated plaintext. Should rewrite.",
+			destination:     sealed(kmsKey, "gsm-token-v0"),
+			kms:             &tests.FakeKMS{},
+			expectUpdated:   true,
+			expectPlaintext: "gsm-token-v1",
+		},
+		{
+			name:            "Destination in plaintext. Should rewrite it encrypted.",
+			destination:     []byte("gsm-token-v1"),
+			kms:             &tests.FakeKMS{},
+			expectUpdated:   true,
+			expectPlaintext: "gsm-token-v1",
+		},
+		{
+			name:            "Destination encrypted with another key. Should rewrite it with the key of the spec.",
+			destination:     sealed("projects/project-1/locations/global/keyRings/ring-1/cryptoKeys/key-0", "gsm-token-v1"),
+			kms:             &tests.FakeKMS{},
+			expectUpdated:   true,
+			expectPlaintext: "gsm-token-v1",
+		},
+		{
+			name:            "Destination with a malformed ciphertext. Should rewrite.",
+			destination:     []byte(EnvelopePrefix + "not base64!"),
+			kms:             &tests.FakeKMS{},
+			expectUpdated:   true,
+			expectPlaintext: "gsm-token-v1",
+		},
+		{
+			name:          "Cloud KMS unavailable. Should fail without writing.",
+			destination:   sealed(kmsKey, "gsm-token-v0"),
+			kms:           &tests.FakeKMS{Err: status.Error(codes.Unavailable, "unavailable")},
+			expectUpdated: false,
+			expectError:   true,
+		},
+		{
+			name:          "No KMS client. Should fail without writing.",
+			destination:   nil,
+			kms:           nil,
+			expectUpdated: false,
+			expectError:   true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			if tc.destination == nil {
+				err := cl.DeleteKubernetesSecret("ns-a", "secret-a")
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", tc.destination)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &SecretSyncController{
+				Client: cl,
+				Agent:  &config.Agent{},
+			}
+			if tc.kms != nil {
+				controller.Encrypter = tc.kms
+			}
+
+			updated, err := controller.Sync(spec)
+			if tc.expectError && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if updated != tc.expectUpdated {
+				t.Errorf("Expected updated %v, but got %v.", tc.expectUpdated, updated)
+			}
+
+			data, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.expectUpdated {
+				if !bytes.Equal(data, tc.destination) {
+					t.Errorf("Expected unchanged destination %q, but got %q.", tc.destination, data)
+				}
+				return
+			}
+
+			if !bytes.HasPrefix(data, []byte(EnvelopePrefix)) {
+				t.Fatalf("Expected a ciphertext marked with %s, but got %q.", EnvelopePrefix, data)
+			}
+			ciphertext, err := base64.StdEncoding.DecodeString(string(data[len(EnvelopePrefix):]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, err := tc.kms.Decrypt(kmsKey, ciphertext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plaintext) != tc.expectPlaintext {
+				t.Errorf("Expected ciphertext of %q, but got %q.", tc.expectPlaintext, plaintext)
+			}
+		})
+	}
+}
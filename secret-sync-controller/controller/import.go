@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// ReverseImport promotes the destination K8s secret values of all specs in cfg into their Secret Manager sources,
+// reversing the normal sync flow for onboarding existing K8s secrets.
+// Only missing Secret Manager secrets are created, existing secret values are never overwritten,
+// and missing destination keys are skipped, so that it is safe to re-run.
+// Returns the aggregated error of all sources that it failed to import.
+func ReverseImport(cl client.Interface, cfg *config.SecretSyncConfig) error {
+	errs := []error{}
+
+	for _, spec := range cfg.Specs {
+		if spec.Direction.WritesSecretManager() {
+			klog.V(2).Infof("Spec %s is synced into Secret Manager already. Skipping...", spec)
+			continue
+		}
+		if spec.Destination.Resource.IsSet() {
+			klog.Warningf("Custom resource destination %s cannot be imported. Skipping...", spec.Destination)
+			continue
+		}
+		if spec.Destination.EnvelopeEncrypt != nil {
+			klog.Warningf("Encrypted destination %s cannot be imported. Skipping...", spec.Destination)
+			continue
+		}
+		if spec.Destination.HasNamespacePattern() {
+			klog.Warningf("Destination %s in several namespaces cannot be imported. Skipping...", spec.Destination)
+			continue
+		}
+		if spec.MirrorsSecret() {
+			klog.Warningf("Mirrored destination %s cannot be imported. Skipping...", spec.Destination)
+			continue
+		}
+
+		for _, pair := range spec.Pairs() {
+			if pair.Source.JSONField != "" {
+				klog.Warningf("Secret %s cannot be imported into a field of %s. Skipping...", pair.Destination, pair.Source)
+				continue
+			}
+			_, err := cl.GetSecretManagerSecretValue(pair.Source.Project, pair.Source.Secret)
+			if err == nil {
+				klog.V(2).Infof("Secret %s already exists. Skipping...", pair.Source)
+				continue
+			}
+			if status.Code(err) != codes.NotFound {
+				errs = append(errs, fmt.Errorf("Fail to get %s: %s", pair.Source, err))
+				continue
+			}
+
+			data, err := cl.GetKubernetesSecretValue(pair.Destination.Namespace, pair.Destination.Secret, pair.Destination.Key)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Fail to get %s: %s", pair.Destination, err))
+				continue
+			}
+			if data == nil {
+				klog.Warningf("Secret %s not found. Skipping...", pair.Destination)
+				continue
+			}
+
+			err = cl.UpsertSecretManagerSecret(pair.Source.Project, pair.Source.Secret, data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Fail to create %s: %s", pair.Source, redact.Error(err, data)))
+				continue
+			}
+
+			klog.V(2).Infof("Imported secret %s into %s", pair.Destination, pair.Source)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+	"text/template"
+)
+
+func TestReverseImport(t *testing.T) {
+	var fixtureConfig = `
+      secretmanager:
+        {{.}}:
+          gsm-existing: gsm-existing-v1
+      kubernetes:
+        ns-a:
+          secret-a:
+            key-existing: k8s-existing
+            key-missing: k8s-missing
+`
+	// substitute fixture project to testOpts.gsmProject
+	temp := template.Must(template.New("config").Parse(fixtureConfig))
+	fixtureBuffer := new(bytes.Buffer)
+	temp.Execute(fixtureBuffer, testOpts.gsmProject)
+
+	fixture, err := tests.NewFixture(fixtureBuffer.Bytes())
+	if err != nil {
+		t.Fatalf("Fail to parse fixture: %s", err)
+	}
+
+	err = fixture.Setup(testClient)
+	if err != nil {
+		t.Fatalf("Fail to setup fixture: %s", err)
+	}
+
+	// gsm-missing is created by ReverseImport
+	defer testClient.DeleteSecretManagerSecret(testOpts.gsmProject, "gsm-missing")
+	defer fixture.Teardown(testClient, nil)
+
+	err = fixture.Reset(testClient)
+	if err != nil {
+		t.Fatalf("Fail to reset fixture: %s", err)
+	}
+
+	newSpec := func(source, key string) config.SecretSyncSpec {
+		return config.SecretSyncSpec{
+			Source: config.SecretManagerSpec{
+				Project: testOpts.gsmProject,
+				Secret:  source,
+			},
+			Destination: config.KubernetesSpec{
+				Namespace: "ns-a",
+				Secret:    "secret-a",
+				Key:       key,
+			},
+		}
+	}
+	conf := &config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{
+			newSpec("gsm-existing", "key-existing"),
+			newSpec("gsm-missing", "key-missing"),
+			// the destination key does not exist either
+			newSpec("gsm-nowhere", "key-nowhere"),
+		},
+	}
+
+	// import twice to make sure it is safe to re-run
+	for i := 0; i < 2; i++ {
+		err = ReverseImport(testClient, conf)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+
+		var testcases = []struct {
+			source   string
+			expected string
+		}{
+			{
+				// existing source should not be overwritten
+				source:   "gsm-existing",
+				expected: "gsm-existing-v1",
+			},
+			{
+				// missing source should be created from the destination
+				source:   "gsm-missing",
+				expected: "k8s-missing",
+			},
+		}
+		for _, tc := range testcases {
+			value, err := testClient.GetSecretManagerSecretValue(testOpts.gsmProject, tc.source)
+			if err != nil {
+				t.Errorf("Fail to get %s: %s", tc.source, err)
+			}
+			if string(value) != tc.expected {
+				t.Errorf("Expected %s to be %s, but got %s.", tc.source, tc.expected, value)
+			}
+		}
+
+		_, err = testClient.GetSecretManagerSecretValue(testOpts.gsmProject, "gsm-nowhere")
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Secret gsm-nowhere should not be created, but got: %v", err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sort"
+)
+
+// manifestKey is the ConfigMap key holding the manifest.
+const manifestKey = "manifest.json"
+
+// HashManifest is a manifest of the source checksum of each spec at its last successful sync,
+// persisted in the K8s ConfigMap Namespace/Name, so that unchanged specs can be skipped across restarts.
+// The specs are only skipped on the first cycle after Load, so that the later cycles keep restoring the destinations.
+type HashManifest struct {
+	Namespace string
+	Name      string
+
+	hashes map[config.SpecID]string
+	// dirty marks changes not saved yet
+	dirty bool
+	// fresh marks a manifest loaded and not used by a cycle yet
+	fresh bool
+}
+
+// manifestEntry is the persisted form of a HashManifest entry.
+type manifestEntry struct {
+	config.SpecID
+	Hash string
+}
+
+// Load loads the manifest from its ConfigMap.
+// A missing ConfigMap results in an empty manifest, meaning that all specs are synced.
+func (m *HashManifest) Load(cl client.Interface) error {
+	m.hashes = map[config.SpecID]string{}
+	m.dirty = false
+	m.fresh = true
+
+	data, err := cl.GetKubernetesConfigMap(m.Namespace, m.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Fail to get manifest namespaces/%s/configmaps/%s: %s", m.Namespace, m.Name, err)
+	}
+
+	entries := []manifestEntry{}
+	err = json.Unmarshal([]byte(data[manifestKey]), &entries)
+	if err != nil {
+		return fmt.Errorf("Fail to parse manifest namespaces/%s/configmaps/%s: %s", m.Namespace, m.Name, err)
+	}
+
+	for _, entry := range entries {
+		m.hashes[entry.SpecID] = entry.Hash
+	}
+	return nil
+}
+
+// Save persists the manifest into its ConfigMap, if it has changed since the last Load or Save.
+func (m *HashManifest) Save(cl client.Interface) error {
+	if !m.dirty {
+		return nil
+	}
+
+	entries := []manifestEntry{}
+	for id, hash := range m.hashes {
+		entries = append(entries, manifestEntry{SpecID: id, Hash: hash})
+	}
+	// keep the persisted manifest stable
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].SpecID.String() < entries[j].SpecID.String()
+	})
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	err = cl.UpsertKubernetesConfigMap(m.Namespace, m.Name, map[string]string{manifestKey: string(data)})
+	if err != nil {
+		return fmt.Errorf("Fail to save manifest namespaces/%s/configmaps/%s: %s", m.Namespace, m.Name, err)
+	}
+	m.dirty = false
+	return nil
+}
+
+// startCycle returns true if the cycle starting is the first one since Load, the only one skipping the unchanged specs.
+func (m *HashManifest) startCycle() bool {
+	fresh := m.fresh
+	m.fresh = false
+	return fresh
+}
+
+// Match returns true if the manifest records hash for the spec of id.
+func (m *HashManifest) Match(id config.SpecID, hash string) bool {
+	recorded, ok := m.hashes[id]
+	return ok && recorded == hash
+}
+
+// Set records hash for the spec of id.
+func (m *HashManifest) Set(id config.SpecID, hash string) {
+	if m.hashes == nil {
+		m.hashes = map[config.SpecID]string{}
+	}
+	if m.hashes[id] != hash {
+		m.hashes[id] = hash
+		m.dirty = true
+	}
+}
+
+// Prune removes the entries of specs no longer in specs.
+func (m *HashManifest) Prune(specs []config.SecretSyncSpec) {
+	ids := map[config.SpecID]bool{}
+	for _, spec := range specs {
+		ids[spec.ID()] = true
+	}
+	for id := range m.hashes {
+		if !ids[id] {
+			delete(m.hashes, id)
+			m.dirty = true
+		}
+	}
+}
+
+// specs returns the specs recorded in the manifest, rebuilt from their IDs, e.g. to detect the specs removed across restarts.
+// The rebuilt specs only hold their destination keys, or none if they mirror their source.
+func (m *HashManifest) specs() map[config.SpecID]config.SecretSyncSpec {
+	specs := map[config.SpecID]config.SecretSyncSpec{}
+	for id := range m.hashes {
+		// the custom resource destinations are never pruned
+		if id.Resource != "" {
+			continue
+		}
+		spec := config.SecretSyncSpec{
+			Destination: config.KubernetesSpec{
+				Namespace: id.Namespace,
+				Secret:    id.Secret,
+			},
+		}
+		spec.Keys = id.DestinationKeys()
+		specs[id] = spec
+	}
+	return specs
+}
+
+// sourceHash returns the checksum of the source values of spec, reading them as Sync() would.
+// Only used to skip unchanged specs, as Sync() computes the checksum of the values it syncs on its own.
+func (c *SecretSyncController) sourceHash(spec config.SecretSyncSpec) (string, error) {
+	pairs, err := c.pairs(spec)
+	if err != nil {
+		return "", err
+	}
+	digest := newSourceDigest()
+	for _, pair := range pairs {
+		data, _, err := c.getSource(pair)
+		if err != nil {
+			return "", err
+		}
+		digest.add(pair.Destination.Key, data)
+	}
+	return digest.sum(), nil
+}
+
+// sourceDigest computes the checksum of the source values of a spec, as recorded in the manifest.
+type sourceDigest struct {
+	hash hash.Hash
+}
+
+func newSourceDigest() *sourceDigest {
+	return &sourceDigest{hash: sha256.New()}
+}
+
+// add adds the source value data of the destination key to the checksum.
+func (d *sourceDigest) add(key string, data []byte) {
+	// separate the keys and values by their lengths, so that different pairs never collide
+	fmt.Fprintf(d.hash, "%d:%s:%d:", len(key), key, len(data))
+	d.hash.Write(data)
+}
+
+func (d *sourceDigest) sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	cl := newVerifyClient(t)
+
+	ids := []config.SpecID{
+		{Namespace: "ns-a", Secret: "secret-a", Key: "key-a"},
+		config.SecretSyncSpec{Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"}, Keys: []string{"key-b", "key-c"}}.ID(),
+	}
+
+	manifest := &HashManifest{Namespace: "ns-a", Name: "manifest"}
+	err := manifest.Load(cl)
+	if err != nil {
+		t.Fatalf("Unexpected error loading a missing manifest: %s", err)
+	}
+	if manifest.Match(ids[0], "hash-a") {
+		t.Errorf("Missing manifest should not match.")
+	}
+
+	manifest.Set(ids[0], "hash-a")
+	manifest.Set(ids[1], "hash-b")
+	err = manifest.Save(cl)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	loaded := &HashManifest{Namespace: "ns-a", Name: "manifest"}
+	err = loaded.Load(cl)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for i, hash := range []string{"hash-a", "hash-b"} {
+		if !loaded.Match(ids[i], hash) {
+			t.Errorf("Expected %s to match %s after round trip.", ids[i], hash)
+		}
+		if loaded.Match(ids[i], "changed") {
+			t.Errorf("Expected %s not to match a changed hash.", ids[i])
+		}
+	}
+}
+
+func TestSyncAllManifest(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		mutate      func(cl *tests.MockClient) error
+		expectValue string
+	}{
+		{
+			name: "Source unchanged since the last sync. Should skip the spec, even if the destination drifted.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("drifted"))
+			},
+			expectValue: "drifted",
+		},
+		{
+			name: "Source changed since the last sync. Should sync the spec.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+			},
+			expectValue: "gsm-token-v2",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("old-token"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			agent := &config.Agent{}
+			agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			// the first controller syncs and saves the manifest
+			first := &SecretSyncController{
+				Client:   cl,
+				Agent:    agent,
+				Manifest: &HashManifest{Namespace: "ns-a", Name: "manifest"},
+			}
+			first.SyncAll()
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != "gsm-token-v1" {
+				t.Fatalf("Expected initial sync to gsm-token-v1, but got %s.", value)
+			}
+
+			err = tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a restarted controller loads the manifest
+			restarted := &SecretSyncController{
+				Client:   cl,
+				Agent:    agent,
+				Manifest: &HashManifest{Namespace: "ns-a", Name: "manifest"},
+			}
+			err = restarted.Manifest.Load(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			restarted.SyncAll()
+
+			value, err = cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != tc.expectValue {
+				t.Errorf("Expected %s, but got %s.", tc.expectValue, value)
+			}
+		})
+	}
+}
+
+func TestSyncAllManifestRestoresDestination(t *testing.T) {
+	cl := newVerifyClient(t)
+	agent := &config.Agent{}
+	agent.Set(&config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{verifySpec},
+	})
+
+	first := &SecretSyncController{
+		Client:   cl,
+		Agent:    agent,
+		Manifest: &HashManifest{Namespace: "ns-a", Name: "manifest"},
+	}
+	first.SyncAll()
+
+	// a restarted controller skips the unchanged spec on its first cycle only
+	restarted := &SecretSyncController{
+		Client:   cl,
+		Agent:    agent,
+		Manifest: &HashManifest{Namespace: "ns-a", Name: "manifest"},
+	}
+	err := restarted.Manifest.Load(cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := restarted.SyncAll()
+	if summary.Unchanged != 1 {
+		t.Fatalf("Expected the spec to be skipped as unchanged, but got %+v.", summary)
+	}
+
+	// the destination deleted while the manifest still matches the source
+	err = cl.DeleteKubernetesSecret("ns-a", "secret-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary = restarted.SyncAll()
+	if summary.Updated != 1 {
+		t.Errorf("Expected the spec to be synced, but got %+v.", summary)
+	}
+
+	value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "gsm-token-v1" {
+		t.Errorf("Expected the deleted destination to be re-created with gsm-token-v1, but got %q.", value)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// Metrics of the drift verification, updated by VerifyAll().
+var (
+	specDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "secret_sync_drift",
+		Help: "Whether the destination of a spec drifted from its sources (1) or not (0) at the last verification.",
+	}, []string{"spec"})
+	verifyRuns = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "secret_sync_verify_runs_total",
+		Help: "Number of drift verification runs of the secret sync controller.",
+	})
+)
+
+// pendingSpecs is updated by SyncAll() if WaitForNamespace is set.
+var pendingSpecs = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "secret_sync_pending_specs",
+	Help: "Number of specs waiting for their destination namespace to be created.",
+})
+
+// syncNoOps is updated by Sync() and SyncAll() for the keys found unchanged.
+var syncNoOps = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "secret_sync_noop_total",
+	Help: "Number of destination keys checked without change, including the specs skipped by the manifest.",
+})
+
+// cycleOverruns is updated by Start() for each tick dropped while the previous cycle is still running.
+var cycleOverruns = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "secret_sync_cycle_overrun_total",
+	Help: "Number of sync or verification ticks dropped because the previous cycle overran its period.",
+}, []string{"cycle"})
+
+// shortSources is updated by Sync() for each source value refused for being shorter than its MinLength.
+var shortSources = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "secret_sync_short_source_total",
+	Help: "Number of source values refused because they were shorter than the minLength of the source.",
+}, []string{"source"})
+
+// syncConflicts is updated by Sync() for each key of a bidirectional spec changed on both sides since its last sync.
+var syncConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "secret_sync_conflict_total",
+	Help: "Number of keys of bidirectional specs changed on both sides since their last sync, resolved by the conflict policy.",
+}, []string{"source"})
+
+// Metrics of the Kubernetes API circuit breaker, updated by SyncAll() if BreakerThreshold is set.
+var (
+	breakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "secret_sync_breaker_open",
+		Help: "Whether the Kubernetes API circuit breaker is open (1), skipping sync cycles, or closed (0).",
+	})
+	breakerTrips = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "secret_sync_breaker_trips_total",
+		Help: "Number of times the Kubernetes API circuit breaker opened after consecutive Kubernetes API failures.",
+	})
+)
+
+// deferredWrites is updated by Sync() for each spec with a change held until its write window opens.
+var deferredWrites = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "secret_sync_write_deferred",
+	Help: "Whether a change of the destination of a spec is held until its write window opens (1).",
+}, []string{"spec"})
+
+// Metrics of the syncs of each spec, updated by Sync().
+// Operators can alert on the specs whose last success gets too old, e.g. stuck on a failing source.
+// A sync deferred by the write window of its spec is neither a success nor a failure.
+var (
+	syncsAttempted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_sync_syncs_attempted_total",
+		Help: "Number of syncs of a spec attempted by the secret sync controller.",
+	}, []string{"spec"})
+	syncsSucceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_sync_syncs_succeeded_total",
+		Help: "Number of syncs of a spec that succeeded, with or without change.",
+	}, []string{"spec"})
+	syncsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_sync_syncs_failed_total",
+		Help: "Number of syncs of a spec that failed.",
+	}, []string{"spec"})
+	lastSyncSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "secret_sync_last_success_timestamp",
+		Help: "Unix timestamp of the last successful sync of a spec.",
+	}, []string{"spec"})
+)
+
+func init() {
+	prometheus.MustRegister(specDrift, verifyRuns, pendingSpecs, syncNoOps, cycleOverruns, shortSources, breakerState, breakerTrips, deferredWrites, syncConflicts,
+		syncsAttempted, syncsSucceeded, syncsFailed, lastSyncSuccess)
+}
+
+// recordSyncResult updates the sync metrics of spec with the result of its sync.
+func recordSyncResult(spec config.SecretSyncSpec, err error) {
+	id := spec.ID().String()
+	if err != nil {
+		syncsFailed.WithLabelValues(id).Inc()
+		return
+	}
+	syncsSucceeded.WithLabelValues(id).Inc()
+	lastSyncSuccess.WithLabelValues(id).SetToCurrentTime()
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sanitizeLabel returns the Kubernetes label mirroring the Secret Manager label key=value,
+// i.e. the key prefixed by client.MirroredLabelPrefix and both trimmed of the trailing or leading
+// '-' and '_' allowed by Secret Manager but not by Kubernetes.
+// Returns false if the label cannot be mirrored, e.g. if the key is too long.
+func sanitizeLabel(key, value string) (string, string, bool) {
+	key = client.MirroredLabelPrefix + strings.TrimRight(key, "-_")
+	value = strings.Trim(value, "-_")
+	if len(validation.IsQualifiedName(key)) != 0 || len(validation.IsValidLabelValue(value)) != 0 {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// mirrorLabels stamps the labels of the Secret Manager sources of spec, selected by spec.MirrorLabelsFilter,
+// onto the destination secret. Labels are merged in the order of spec.Pairs() if several sources share a key.
+// Missing sources and destination secrets are skipped, e.g. if the sync failed before creating it.
+func (c *SecretSyncController) mirrorLabels(spec config.SecretSyncSpec) error {
+	labels := map[string]string{}
+	for _, pair := range spec.Pairs() {
+		sourceLabels, err := c.Client.GetSecretManagerSecretLabels(pair.Source.Project, pair.Source.Secret)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			return fmt.Errorf("Fail to get labels of %s: %s", pair.Source, err)
+		}
+		for key, val := range sourceLabels {
+			if !spec.MirrorLabelsFilter.Match(key) {
+				continue
+			}
+			label, labelVal, ok := sanitizeLabel(key, val)
+			if !ok {
+				klog.Warningf("Label %s=%s of %s cannot be mirrored, skipped", key, val, pair.Source)
+				continue
+			}
+			labels[label] = labelVal
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	err := c.Client.LabelKubernetesSecret(spec.Destination.Namespace, spec.Destination.Secret, labels)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Fail to mirror labels to namespaces/%s/secrets/%s: %s", spec.Destination.Namespace, spec.Destination.Secret, err)
+	}
+	return nil
+}
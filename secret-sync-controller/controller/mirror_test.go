@@ -0,0 +1,150 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"testing"
+)
+
+func TestSanitizeLabel(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		key         string
+		value       string
+		expectKey   string
+		expectValue string
+		expectOk    bool
+	}{
+		{
+			name:        "Valid label. Should be prefixed.",
+			key:         "owner",
+			value:       "team-a",
+			expectKey:   client.MirroredLabelPrefix + "owner",
+			expectValue: "team-a",
+			expectOk:    true,
+		},
+		{
+			name:        "Key and value ending with '-' or '_'. Should be trimmed.",
+			key:         "env_-",
+			value:       "_prod-",
+			expectKey:   client.MirroredLabelPrefix + "env",
+			expectValue: "prod",
+			expectOk:    true,
+		},
+		{
+			name:        "Empty value. Should be mirrored.",
+			key:         "env",
+			value:       "",
+			expectKey:   client.MirroredLabelPrefix + "env",
+			expectValue: "",
+			expectOk:    true,
+		},
+		{
+			name:     "Key too long. Should be skipped.",
+			key:      "a123456789b123456789c123456789d123456789e123456789f123456789g1234",
+			value:    "prod",
+			expectOk: false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			key, value, ok := sanitizeLabel(tc.key, tc.value)
+			if ok != tc.expectOk || key != tc.expectKey || value != tc.expectValue {
+				t.Errorf("Expected (%q, %q, %v), but got (%q, %q, %v).", tc.expectKey, tc.expectValue, tc.expectOk, key, value, ok)
+			}
+		})
+	}
+}
+
+func TestSyncMirrorLabels(t *testing.T) {
+	sourceLabels := map[string]string{
+		"owner":   "team-a",
+		"env-":    "prod",
+		"team-id": "42",
+	}
+	var testcases = []struct {
+		name         string
+		mirrorLabels bool
+		filter       config.LabelFilter
+		expectLabels map[string]string
+	}{
+		{
+			name:         "Mirroring disabled. Should not mirror labels.",
+			mirrorLabels: false,
+			expectLabels: map[string]string{},
+		},
+		{
+			name:         "No filter. Should mirror all labels.",
+			mirrorLabels: true,
+			expectLabels: map[string]string{
+				client.MirroredLabelPrefix + "owner":   "team-a",
+				client.MirroredLabelPrefix + "env":     "prod",
+				client.MirroredLabelPrefix + "team-id": "42",
+			},
+		},
+		{
+			name:         "Include filter. Should only mirror included labels.",
+			mirrorLabels: true,
+			filter:       config.LabelFilter{Include: []string{"team-*", "owner"}},
+			expectLabels: map[string]string{
+				client.MirroredLabelPrefix + "owner":   "team-a",
+				client.MirroredLabelPrefix + "team-id": "42",
+			},
+		},
+		{
+			name:         "Include and exclude filters. Should not mirror excluded labels.",
+			mirrorLabels: true,
+			filter:       config.LabelFilter{Include: []string{"team-*", "owner"}, Exclude: []string{"team-*"}},
+			expectLabels: map[string]string{
+				client.MirroredLabelPrefix + "owner": "team-a",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			cl.SetSecretManagerSecretLabels("project-1", "gsm-token", sourceLabels)
+
+			spec := verifySpec
+			spec.MirrorLabels = tc.mirrorLabels
+			spec.MirrorLabelsFilter = tc.filter
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+			_, err := controller.Sync(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			labels, err := cl.GetKubernetesSecretLabels("ns-a", "secret-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			mirrored := map[string]string{}
+			for key, val := range labels {
+				if key != client.ManagedByLabel {
+					mirrored[key] = val
+				}
+			}
+			if !reflect.DeepEqual(mirrored, tc.expectLabels) {
+				t.Errorf("Expected labels %v, but got %v.", tc.expectLabels, mirrored)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// ExpandSpecs returns specs with each spec whose destination has a namespace pattern expanded into a copy of it
+// for each matching namespace, see config.ExpandNamespaces(). Returns specs itself if none has a namespace pattern.
+// The namespaces are listed on each call, and the namespaces listed last are used if listing fails,
+// so that a transient failure does not drop the copies, e.g. to be pruned.
+func (c *SecretSyncController) ExpandSpecs(specs []config.SecretSyncSpec) []config.SecretSyncSpec {
+	if !config.AnyNamespacePattern(specs) {
+		return specs
+	}
+
+	namespaces, err := c.Client.ListKubernetesNamespaces()
+	if err != nil {
+		klog.Errorf("Fail to list namespaces, using the %d namespaces listed last: %s", len(c.namespaces), err)
+		namespaces = c.namespaces
+	} else {
+		c.namespaces = namespaces
+	}
+
+	expanded, err := config.ExpandNamespaces(specs, namespaces)
+	if err != nil {
+		klog.V(2).Info(err)
+	}
+	return expanded
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+)
+
+func TestSyncAllNamespacePattern(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		destination config.KubernetesSpec
+		expected    map[string]bool
+	}{
+		{
+			name:        "Glob pattern. Should sync into the matching namespaces, including the ones created later.",
+			destination: config.KubernetesSpec{Namespace: "team-*", Secret: "secret-a", Key: "key-a"},
+			expected:    map[string]bool{"team-a": true, "team-b": true, "team-new": true, "other": false},
+		},
+		{
+			name:        "Regex. Should sync into the matching namespaces, including the ones created later.",
+			destination: config.KubernetesSpec{NamespaceRegex: "team-(b|new)|other", Secret: "secret-a", Key: "key-a"},
+			expected:    map[string]bool{"team-a": false, "team-b": true, "team-new": true, "other": true},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := tests.NewMockClient([]string{"project-1"})
+			for _, err := range []error{
+				cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v1")),
+				cl.CreateKubernetesNamespace("team-a"),
+				cl.CreateKubernetesNamespace("team-b"),
+				cl.CreateKubernetesNamespace("other"),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			controller := &SecretSyncController{
+				Client: cl,
+				Agent:  &config.Agent{},
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{
+					{
+						Source:      config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token"},
+						Destination: tc.destination,
+					},
+				},
+			})
+
+			controller.SyncAll()
+			// the namespaces are listed on each cycle
+			err := cl.CreateKubernetesNamespace("team-new")
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary := controller.SyncAll()
+			if len(summary.Failed) != 0 {
+				t.Errorf("Unexpected failures: %v", summary.Failed)
+			}
+
+			for namespace, expected := range tc.expected {
+				data, err := cl.GetKubernetesSecretValue(namespace, "secret-a", "key-a")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if synced := string(data) == "gsm-token-v1"; synced != expected {
+					t.Errorf("Expected namespace %s synced %t, got value %q.", namespace, expected, data)
+				}
+			}
+		})
+	}
+}
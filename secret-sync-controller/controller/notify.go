@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/gsmoption"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// Subscriber receives the notifications of changed Secret Manager secrets, e.g. client.PubSubSubscriber.
+type Subscriber interface {
+	// Receive calls notify with the resource name of each changed secret, projects/<project>/secrets/<secret>,
+	// until ctx is done.
+	Receive(ctx context.Context, notify func(secret string)) error
+}
+
+// notifyQueueSize is the number of notifications buffered while a sync is running.
+const notifyQueueSize = 100
+
+// receive starts receiving the notifications of c.Subscriber, and returns the channel of the notified secrets.
+// Notifications are dropped if the channel is full, the periodic resync still picks up the changes.
+func (c *SecretSyncController) receive(ctx context.Context) <-chan string {
+	notified := make(chan string, notifyQueueSize)
+	go func() {
+		err := c.Subscriber.Receive(ctx, func(secret string) {
+			select {
+			case notified <- secret:
+			default:
+				klog.Warningf("Notification queue is full. Dropped notification of %s.", secret)
+			}
+		})
+		if err != nil {
+			klog.Errorf("Fail to receive notifications: %s", err)
+		}
+	}()
+	return notified
+}
+
+// SyncNotified syncs the specs of the current config sourcing any key from the notified secret,
+// in format projects/<project>/secrets/<secret>. Returns the number of specs synced.
+func (c *SecretSyncController) SyncNotified(secret string) int {
+	project, id, err := client.ParseSecretName(secret)
+	if err != nil {
+		klog.Errorf("Ignored notification: %s", err)
+		return 0
+	}
+
+	synced := 0
+	for _, spec := range c.ExpandSpecs(c.Agent.Config().Specs) {
+		if !sourcesFrom(spec, project, id) {
+			continue
+		}
+		_, err := c.Sync(spec)
+		if err != nil {
+			klog.Errorf("Secret sync failed for %s on notification of %s: %s", spec, secret, err)
+			continue
+		}
+		synced++
+	}
+	klog.V(2).Infof("Synced %d specs on notification of %s", synced, secret)
+	return synced
+}
+
+// sourcesFrom returns true if any key of spec is sourced from the secret id of project.
+// Notifications name the project by number, which cannot be mapped to the project ids of the specs without extra lookups,
+// so secrets of numeric projects match the sources of the same secret id in any project.
+// The false positives only cause extra syncs.
+func sourcesFrom(spec config.SecretSyncSpec, project, id string) bool {
+	// the Secret Manager secrets of a reverse spec are written by the spec itself
+	if spec.Direction.IsReverse() {
+		return false
+	}
+	byNumber := gsmoption.IsProjectNumber(project)
+	for _, pair := range spec.Pairs() {
+		if pair.Source.Secret == id && (byNumber || pair.Source.Project == project) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+	"time"
+)
+
+func TestSyncNotified(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		secret       string
+		expectSynced int
+	}{
+		{
+			name:         "Source secret notified by project id. Should sync its spec.",
+			secret:       "projects/project-1/secrets/gsm-token",
+			expectSynced: 1,
+		},
+		{
+			name:         "Source secret notified by project number. Should sync its spec.",
+			secret:       "projects/123456789/secrets/gsm-token",
+			expectSynced: 1,
+		},
+		{
+			name:         "Same secret id in another project. Should not sync.",
+			secret:       "projects/project-2/secrets/gsm-token",
+			expectSynced: 0,
+		},
+		{
+			name:         "Unrelated secret. Should not sync.",
+			secret:       "projects/project-1/secrets/other",
+			expectSynced: 0,
+		},
+		{
+			name:         "Invalid secret name. Should be ignored.",
+			secret:       "gsm-token",
+			expectSynced: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			controller := &SecretSyncController{
+				Client: newVerifyClient(t),
+				Agent:  &config.Agent{},
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			synced := controller.SyncNotified(tc.secret)
+			if synced != tc.expectSynced {
+				t.Errorf("Expected %d synced specs, got %d.", tc.expectSynced, synced)
+			}
+		})
+	}
+}
+
+func TestReceive(t *testing.T) {
+	subscriber := tests.NewFakeSubscriber()
+	controller := &SecretSyncController{
+		Subscriber: subscriber,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifyChan := controller.receive(ctx)
+
+	secrets := []string{
+		"projects/project-1/secrets/gsm-token",
+		"projects/project-1/secrets/other",
+	}
+	for _, secret := range secrets {
+		subscriber.Publish(secret)
+	}
+	for _, secret := range secrets {
+		select {
+		case received := <-notifyChan:
+			if received != secret {
+				t.Errorf("Expected notification of %s, got %s.", secret, received)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected notification of %s, got none.", secret)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// setOwner stamps dest.OwnerRef onto the destination secret of dest, with the uid of the owner resolved through c.Resources.
+// Only the secrets managed by the controller are stamped, so that the garbage collection never deletes a secret created by others.
+// A missing owner fails the stamping only, e.g. if the owner is not created yet, and the stamping is retried at the next sync.
+// Missing destination secrets are skipped, e.g. if the sync failed before creating it.
+func (c *SecretSyncController) setOwner(dest config.KubernetesSpec) error {
+	labels, err := c.Client.GetKubernetesSecretLabels(dest.Namespace, dest.Secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Fail to get labels of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	if labels[client.ManagedByLabel] != c.Client.ManagerName() {
+		return fmt.Errorf("Fail to set owner %s of namespaces/%s/secrets/%s: secret not managed by the controller", dest.OwnerRef, dest.Namespace, dest.Secret)
+	}
+
+	if c.Resources == nil {
+		return fmt.Errorf("Fail to resolve owner %s of namespaces/%s/secrets/%s: no dynamic client", dest.OwnerRef, dest.Namespace, dest.Secret)
+	}
+	uid, err := c.Resources.GetResourceUID(dest.OwnerRef.GroupVersionResource(), dest.Namespace, dest.OwnerRef.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("Owner %s of namespaces/%s/secrets/%s not found, retrying at the next sync", dest.OwnerRef, dest.Namespace, dest.Secret)
+		}
+		return fmt.Errorf("Fail to resolve owner %s of namespaces/%s/secrets/%s: %s", dest.OwnerRef, dest.Namespace, dest.Secret, err)
+	}
+
+	err = c.Client.SetKubernetesSecretOwner(dest.Namespace, dest.Secret, metav1.OwnerReference{
+		APIVersion: dest.OwnerRef.APIVersion,
+		Kind:       dest.OwnerRef.Kind,
+		Name:       dest.OwnerRef.Name,
+		UID:        uid,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Fail to set owner %s of namespaces/%s/secrets/%s: %s", dest.OwnerRef, dest.Namespace, dest.Secret, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"testing"
+)
+
+func TestSyncOwnerRef(t *testing.T) {
+	owner := &config.OwnerReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "app-a",
+	}
+	expectRef := metav1.OwnerReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "app-a",
+		UID:        "uid-app-a",
+	}
+	var testcases = []struct {
+		name         string
+		ownerExists  bool
+		unmanaged    bool
+		syncs        int
+		expectOwners []metav1.OwnerReference
+	}{
+		{
+			name:         "Owner exists. Should set the owner reference on the created secret.",
+			ownerExists:  true,
+			syncs:        1,
+			expectOwners: []metav1.OwnerReference{expectRef},
+		},
+		{
+			name:         "Synced twice. Should set the owner reference once.",
+			ownerExists:  true,
+			syncs:        2,
+			expectOwners: []metav1.OwnerReference{expectRef},
+		},
+		{
+			name:         "Owner not found. Should sync without owner reference.",
+			ownerExists:  false,
+			syncs:        1,
+			expectOwners: nil,
+		},
+		{
+			name:         "Secret not managed by the controller. Should not set the owner reference.",
+			ownerExists:  true,
+			unmanaged:    true,
+			syncs:        1,
+			expectOwners: nil,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			if tc.unmanaged {
+				// in sync already, as a sync labels the secrets it writes as managed
+				err := cl.CreateKubernetesSecretData("ns-a", "secret-b", map[string][]byte{"key-a": []byte("gsm-token-v1")})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dynamicClient := fake.NewSimpleDynamicClient(runtime.NewScheme())
+			if tc.ownerExists {
+				obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+				obj.SetAPIVersion("apps/v1")
+				obj.SetKind("Deployment")
+				obj.SetNamespace("ns-a")
+				obj.SetName("app-a")
+				obj.SetUID("uid-app-a")
+				_, err := dynamicClient.Resource(owner.GroupVersionResource()).Namespace("ns-a").Create(obj, metav1.CreateOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			spec := verifySpec
+			spec.Destination.Secret = "secret-b"
+			spec.Destination.OwnerRef = owner
+			controller := &SecretSyncController{
+				Client:    cl,
+				Resources: &client.ResourceClient{Dynamic: dynamicClient},
+			}
+			for i := 0; i < tc.syncs; i++ {
+				_, err := controller.Sync(spec)
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+			}
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-b", "key-a")
+			if err != nil || string(value) != "gsm-token-v1" {
+				t.Errorf("Expected the secret to be synced, but got %q, %v.", value, err)
+			}
+			owners := cl.K8sSecretOwners["ns-a"]["secret-b"]
+			if !reflect.DeepEqual(owners, tc.expectOwners) {
+				t.Errorf("Expected owner references %v, but got %v.", tc.expectOwners, owners)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"io"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"text/tabwriter"
+)
+
+// PlanAction is the action a sync would take on a destination key.
+type PlanAction string
+
+const (
+	// PlanCreate means that the destination key does not exist yet.
+	PlanCreate PlanAction = "create"
+	// PlanUpdate means that the destination key differs from its source.
+	PlanUpdate PlanAction = "update"
+	// PlanNoop means that the destination key is in sync with its source.
+	PlanNoop PlanAction = "no-op"
+	// PlanDelete means that the destination key of a mirrored secret disappeared from its source.
+	PlanDelete PlanAction = "delete"
+	// PlanDeferred means that the destination key would be created, updated or deleted, but its write window is closed.
+	PlanDeferred PlanAction = "deferred"
+	// PlanError means that the source or the destination could not be read.
+	PlanError PlanAction = "error"
+)
+
+// PlanEntry is the planned action for a single source-to-key pair of a spec.
+// It never holds secret values, only their lengths and truncated checksums.
+type PlanEntry struct {
+	Spec   config.SpecID
+	Pair   config.SecretSyncSpec
+	Action PlanAction
+	// SourceLength and SourceChecksum describe the source value, empty on error.
+	SourceLength   int
+	SourceChecksum string
+	// DestinationLength and DestinationChecksum describe the destination value, empty if it does not exist.
+	DestinationLength   int
+	DestinationChecksum string
+	Err                 error
+}
+
+// Plan computes the actions SyncAll() would take on all specs specified in Agent.Config().Specs, without writing.
+// Each of spec.Pairs() is planned independently, along with the keys vanished from the source of a mirrored secret.
+// Reverse and bidirectional specs are left out.
+func (c *SecretSyncController) Plan() []PlanEntry {
+	plan := []PlanEntry{}
+	for _, spec := range c.ExpandSpecs(c.Agent.Config().Specs) {
+		// only the specs syncing from Secret Manager into Kubernetes are planned
+		if spec.Direction.WritesSecretManager() {
+			continue
+		}
+		writable, _, windowErr := c.writeWindow(spec)
+		entries := []PlanEntry{}
+		pairs, err := c.pairs(spec)
+		if err != nil {
+			entries = append(entries, PlanEntry{Spec: spec.ID(), Pair: spec, Action: PlanError, Err: err})
+		}
+		for _, pair := range pairs {
+			entries = append(entries, c.planPair(spec.ID(), pair))
+		}
+		if spec.MirrorsSecret() && err == nil {
+			entries = append(entries, c.planVanished(spec, pairs)...)
+		}
+
+		for _, entry := range entries {
+			switch {
+			case entry.Action == PlanError:
+			case windowErr != nil:
+				entry.Action = PlanError
+				entry.Err = windowErr
+			case !writable && (entry.Action == PlanCreate || entry.Action == PlanUpdate || entry.Action == PlanDelete):
+				entry.Action = PlanDeferred
+			}
+			plan = append(plan, entry)
+		}
+	}
+	return plan
+}
+
+// planPair computes the action syncPair() would take on pair.
+func (c *SecretSyncController) planPair(id config.SpecID, pair config.SecretSyncSpec) PlanEntry {
+	entry := PlanEntry{
+		Spec: id,
+		Pair: pair,
+	}
+
+	srcData, _, err := c.getSource(pair)
+	if err != nil {
+		entry.Action = PlanError
+		entry.Err = err
+		return entry
+	}
+	entry.SourceLength = len(srcData)
+	entry.SourceChecksum = redact.Sum(srcData)
+
+	destData, err := c.getDestination(pair.Destination)
+	if err != nil {
+		entry.Action = PlanError
+		entry.Err = err
+		return entry
+	}
+
+	switch {
+	case destData == nil:
+		entry.Action = PlanCreate
+	case pair.EqualityMode.Equal(srcData, destData):
+		entry.Action = PlanNoop
+	default:
+		entry.Action = PlanUpdate
+	}
+	if destData != nil {
+		entry.DestinationLength = len(destData)
+		entry.DestinationChecksum = redact.Sum(destData)
+	}
+
+	return entry
+}
+
+// planVanished computes the keys removeVanishedKeys() would remove from the destination secret of the mirroring spec.
+func (c *SecretSyncController) planVanished(spec config.SecretSyncSpec, pairs []config.SecretSyncSpec) []PlanEntry {
+	vanished, err := c.vanishedKeys(spec, pairs)
+	if err == nil && len(vanished) != 0 {
+		var labels map[string]string
+		labels, err = c.Client.GetKubernetesSecretLabels(spec.Destination.Namespace, spec.Destination.Secret)
+		if err == nil && labels[client.ManagedByLabel] != c.Client.ManagerName() {
+			return nil
+		}
+	}
+	if err != nil {
+		return []PlanEntry{{Spec: spec.ID(), Pair: spec, Action: PlanError, Err: err}}
+	}
+
+	entries := []PlanEntry{}
+	for _, key := range vanished {
+		pair := spec
+		pair.Destination.Key = key
+		entry := PlanEntry{
+			Spec:   spec.ID(),
+			Pair:   pair,
+			Action: PlanDelete,
+		}
+		destData, err := c.getDestination(pair.Destination)
+		if err != nil {
+			entry.Action = PlanError
+			entry.Err = err
+		} else {
+			entry.DestinationLength = len(destData)
+			entry.DestinationChecksum = redact.Sum(destData)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// WritePlan prints plan as a table to w.
+func WritePlan(w io.Writer, plan []PlanEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DESTINATION\tSOURCE\tACTION\tSOURCE SUM\tDESTINATION SUM\tDETAIL")
+	for _, entry := range plan {
+		src := "-"
+		if entry.SourceChecksum != "" {
+			src = fmt.Sprintf("%s (%dB)", entry.SourceChecksum, entry.SourceLength)
+		}
+		dest := "-"
+		if entry.DestinationChecksum != "" {
+			dest = fmt.Sprintf("%s (%dB)", entry.DestinationChecksum, entry.DestinationLength)
+		}
+		detail := ""
+		if entry.Err != nil {
+			detail = entry.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Pair.Destination, entry.Pair.Source, entry.Action, src, dest, detail)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		mutate       func(cl *tests.MockClient) error
+		expectAction PlanAction
+	}{
+		{
+			name:         "Destination in sync. Should plan a no-op.",
+			mutate:       func(cl *tests.MockClient) error { return nil },
+			expectAction: PlanNoop,
+		},
+		{
+			name: "Destination value differs. Should plan an update.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("stale-token"))
+			},
+			expectAction: PlanUpdate,
+		},
+		{
+			name: "Destination secret missing. Should plan a create.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteKubernetesSecret("ns-a", "secret-a")
+			},
+			expectAction: PlanCreate,
+		},
+		{
+			name: "Source missing. Should plan an error.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteSecretManagerSecret("project-1", "gsm-token")
+			},
+			expectAction: PlanError,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := cl.SecretManagerSecret["project-1"]["gsm-token"]
+
+			controller := &SecretSyncController{
+				Client: cl,
+				Agent:  &config.Agent{},
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			plan := controller.Plan()
+			if len(plan) != 1 {
+				t.Fatalf("Expected 1 entry, but got %d.", len(plan))
+			}
+			if plan[0].Action != tc.expectAction {
+				t.Errorf("Expected action %s, but got %s.", tc.expectAction, plan[0].Action)
+			}
+			if (plan[0].Err != nil) != (tc.expectAction == PlanError) {
+				t.Errorf("Unexpected error: %v", plan[0].Err)
+			}
+
+			// the plan is read-only
+			value, _ := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if tc.expectAction == PlanUpdate && string(value) != "stale-token" {
+				t.Errorf("Expected destination untouched, but got %s.", value)
+			}
+			if !bytes.Equal(cl.SecretManagerSecret["project-1"]["gsm-token"], before) {
+				t.Errorf("Expected source untouched.")
+			}
+
+			// the printed plan never reveals secret values
+			out := &bytes.Buffer{}
+			err = WritePlan(out, plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range []string{"gsm-token-v1", "stale-token"} {
+				if strings.Contains(out.String(), secret) {
+					t.Errorf("Plan reveals secret value %s:\n%s", secret, out.String())
+				}
+			}
+			if !strings.Contains(out.String(), string(tc.expectAction)) {
+				t.Errorf("Expected action %s in plan:\n%s", tc.expectAction, out.String())
+			}
+		})
+	}
+}
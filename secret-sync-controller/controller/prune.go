@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// PruneRemoved deletes the destination secrets of the specs removed since its previous call.
+// A destination secret is only deleted if it is labeled as managed by the secret sync controller,
+// no spec in specs targets it anymore, and all its keys were written by the removed specs.
+// Secrets holding any other key are left untouched, unless PruneKeys is set to remove the keys of the removed specs from them.
+// The removed specs are detected across restarts from the Manifest if set, otherwise nothing is pruned on the first call.
+// Secrets that fail to be pruned are retried on the next call.
+func (c *SecretSyncController) PruneRemoved(specs []config.SecretSyncSpec) {
+	if c.previous == nil && c.Manifest != nil {
+		c.previous = c.Manifest.specs()
+	}
+
+	current := map[config.SpecID]config.SecretSyncSpec{}
+	// keys of the current specs, grouped by destination secret
+	targeted := map[config.KubernetesSpec]map[string]bool{}
+	for _, spec := range specs {
+		current[spec.ID()] = spec
+		dest := destinationSecret(spec.Destination)
+		if targeted[dest] == nil {
+			targeted[dest] = map[string]bool{}
+		}
+		for _, pair := range spec.Pairs() {
+			targeted[dest][pair.Destination.Key] = true
+		}
+	}
+
+	// keys of the removed specs, grouped by destination secret
+	owned := map[config.KubernetesSpec]map[string]bool{}
+	removed := map[config.KubernetesSpec][]config.SecretSyncSpec{}
+	mirrored := map[config.KubernetesSpec]bool{}
+	for id, spec := range c.previous {
+		// the Kubernetes secret of a reverse or bidirectional spec is one of its sources, never pruned
+		if _, ok := current[id]; ok || spec.Destination.Resource.IsSet() || spec.Direction.WritesSecretManager() {
+			continue
+		}
+		dest := destinationSecret(spec.Destination)
+		// the keys of a mirrored secret are unknown, and a mirroring spec targets them all
+		if targeted[dest] != nil && (!c.PruneKeys || spec.MirrorsSecret() || targeted[dest][""]) {
+			continue
+		}
+		if owned[dest] == nil {
+			owned[dest] = map[string]bool{}
+		}
+		for _, pair := range spec.Pairs() {
+			owned[dest][pair.Destination.Key] = true
+		}
+		// a mirrored secret holds the keys of its spec only, whichever they are
+		if spec.MirrorsSecret() {
+			mirrored[dest] = true
+		}
+		removed[dest] = append(removed[dest], spec)
+	}
+
+	for dest, keys := range owned {
+		if mirrored[dest] {
+			keys = nil
+		}
+		err := c.pruneSecret(dest, keys, targeted[dest])
+		if err != nil {
+			klog.Error(err)
+			// keep tracking the removed specs, so that the secret is retried
+			for _, spec := range removed[dest] {
+				current[spec.ID()] = spec
+			}
+		}
+	}
+
+	c.previous = current
+}
+
+// pruneSecret deletes the destination secret dest if it is managed and holds no keys but owned, or any keys if owned is nil,
+// and none of kept, the keys of the current specs.
+// Otherwise, the owned keys but kept are removed from the secret if PruneKeys is set.
+func (c *SecretSyncController) pruneSecret(dest config.KubernetesSpec, owned, kept map[string]bool) error {
+	labels, err := c.Client.GetKubernetesSecretLabels(dest.Namespace, dest.Secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Fail to get labels of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	if labels[client.ManagedByLabel] != c.Client.ManagerName() {
+		klog.Warningf("Secret namespaces/%s/secrets/%s is not managed by %s. Not pruning...", dest.Namespace, dest.Secret, c.Client.ManagerName())
+		return nil
+	}
+
+	keys, err := c.Client.GetKubernetesSecretKeys(dest.Namespace, dest.Secret)
+	if err != nil {
+		return fmt.Errorf("Fail to get keys of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	foreign := ""
+	for _, key := range keys {
+		if owned != nil && !owned[key] {
+			foreign = key
+			break
+		}
+	}
+
+	if foreign == "" && len(kept) == 0 {
+		err = c.Client.DeleteKubernetesSecret(dest.Namespace, dest.Secret)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Fail to prune namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+		}
+		klog.V(2).Infof("Pruned secret namespaces/%s/secrets/%s", dest.Namespace, dest.Secret)
+		return nil
+	}
+
+	if !c.PruneKeys {
+		klog.Warningf("Secret namespaces/%s/secrets/%s holds key [%s] not written by the removed specs. Not pruning...", dest.Namespace, dest.Secret, foreign)
+		return nil
+	}
+	for _, key := range keys {
+		if !owned[key] || kept[key] {
+			continue
+		}
+		err = c.Client.DeleteKubernetesSecretKey(dest.Namespace, dest.Secret, key)
+		if err != nil {
+			return fmt.Errorf("Fail to prune key [%s] of namespaces/%s/secrets/%s: %s", key, dest.Namespace, dest.Secret, err)
+		}
+		klog.V(2).Infof("Pruned key [%s] of secret namespaces/%s/secrets/%s", key, dest.Namespace, dest.Secret)
+	}
+
+	return nil
+}
+
+// destinationSecret returns dest without its key, identifying the destination secret.
+func destinationSecret(dest config.KubernetesSpec) config.KubernetesSpec {
+	return config.KubernetesSpec{
+		Namespace: dest.Namespace,
+		Secret:    dest.Secret,
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"sort"
+	"testing"
+)
+
+func TestPruneRemoved(t *testing.T) {
+	specA := verifySpec
+	specB := verifySpec
+	specB.Source.Secret = "gsm-password"
+	specB.Destination.Key = "key-b"
+	specOther := verifySpec
+	specOther.Destination.Secret = "secret-other"
+	specMirror := verifySpec
+	specMirror.Destination.Key = ""
+
+	var testcases = []struct {
+		name         string
+		before       []config.SecretSyncSpec
+		after        []config.SecretSyncSpec
+		mutate       func(cl *tests.MockClient) error
+		pruneKeys    bool
+		expectExists bool
+		// expectKeys are the keys of the kept secret, unchecked if nil
+		expectKeys []string
+	}{
+		{
+			name:         "All keys of the secret removed. Should delete the secret.",
+			before:       []config.SecretSyncSpec{specA, specB, specOther},
+			after:        []config.SecretSyncSpec{specOther},
+			mutate:       func(cl *tests.MockClient) error { return nil },
+			expectExists: false,
+		},
+		{
+			name:         "Another spec still targets the secret. Should keep the secret.",
+			before:       []config.SecretSyncSpec{specA, specB, specOther},
+			after:        []config.SecretSyncSpec{specB, specOther},
+			mutate:       func(cl *tests.MockClient) error { return nil },
+			expectExists: true,
+			expectKeys:   []string{"key-a", "key-b"},
+		},
+		{
+			name:         "Another spec still targets the secret with pruneKeys. Should remove the key of the removed spec.",
+			before:       []config.SecretSyncSpec{specA, specB, specOther},
+			after:        []config.SecretSyncSpec{specB, specOther},
+			mutate:       func(cl *tests.MockClient) error { return nil },
+			pruneKeys:    true,
+			expectExists: true,
+			expectKeys:   []string{"key-b"},
+		},
+		{
+			name:   "Secret holds a foreign key with pruneKeys. Should remove the keys of the removed specs only.",
+			before: []config.SecretSyncSpec{specA, specB, specOther},
+			after:  []config.SecretSyncSpec{specOther},
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "hand-written", []byte("foreign"))
+			},
+			pruneKeys:    true,
+			expectExists: true,
+			expectKeys:   []string{"hand-written"},
+		},
+		{
+			name:         "Mirroring spec replaced by a key with pruneKeys. Should keep the mirrored keys, as they are unknown.",
+			before:       []config.SecretSyncSpec{specMirror, specOther},
+			after:        []config.SecretSyncSpec{specA, specOther},
+			mutate:       func(cl *tests.MockClient) error { return nil },
+			pruneKeys:    true,
+			expectExists: true,
+			expectKeys:   []string{"data", "key-a"},
+		},
+		{
+			name:   "Secret holds a foreign key. Should keep the secret.",
+			before: []config.SecretSyncSpec{specA, specB, specOther},
+			after:  []config.SecretSyncSpec{specOther},
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "hand-written", []byte("foreign"))
+			},
+			expectExists: true,
+		},
+		{
+			name:   "Mirroring spec removed. Should delete the secret, whichever its keys.",
+			before: []config.SecretSyncSpec{specMirror, specOther},
+			after:  []config.SecretSyncSpec{specOther},
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "hand-written", []byte("foreign"))
+			},
+			expectExists: false,
+		},
+		{
+			name:   "Unmanaged secret. Should keep the secret.",
+			before: []config.SecretSyncSpec{specA, specB, specOther},
+			after:  []config.SecretSyncSpec{specOther},
+			mutate: func(cl *tests.MockClient) error {
+				cl.K8sSecretLabels["ns-a"]["secret-a"] = map[string]string{}
+				return nil
+			},
+			expectExists: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-password", []byte("gsm-password-v1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:    cl,
+				Agent:     &config.Agent{},
+				Prune:     true,
+				PruneKeys: tc.pruneKeys,
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{Specs: tc.before})
+			controller.SyncAll()
+
+			labels, err := cl.GetKubernetesSecretLabels("ns-a", "secret-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if labels[client.ManagedByLabel] != client.ManagedByValue {
+				t.Fatalf("Expected the synced secret to be managed, but got labels %v.", labels)
+			}
+			err = tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller.Agent.Set(&config.SecretSyncConfig{Specs: tc.after})
+			controller.SyncAll()
+
+			exists := cl.ValidateKubernetesSecret("ns-a", "secret-a") == nil
+			if exists != tc.expectExists {
+				t.Errorf("Expected secret existing %v, but got %v.", tc.expectExists, exists)
+			}
+			if exists && tc.expectKeys != nil {
+				keys, err := cl.GetKubernetesSecretKeys("ns-a", "secret-a")
+				if err != nil {
+					t.Fatal(err)
+				}
+				sort.Strings(keys)
+				if !reflect.DeepEqual(keys, tc.expectKeys) {
+					t.Errorf("Expected keys %v, but got %v.", tc.expectKeys, keys)
+				}
+			}
+			if cl.ValidateKubernetesSecret("ns-a", "secret-other") != nil {
+				t.Errorf("Expected namespaces/ns-a/secrets/secret-other to be kept.")
+			}
+		})
+	}
+}
+
+func TestPruneRemovedAfterRestart(t *testing.T) {
+	specB := verifySpec
+	specB.Source.Secret = "gsm-password"
+	specB.Destination.Key = "key-b"
+	specOther := verifySpec
+	specOther.Destination.Secret = "secret-other"
+
+	var testcases = []struct {
+		name         string
+		manifest     bool
+		expectExists bool
+	}{
+		{
+			name:         "Removed specs recorded in the manifest. Should delete the secret.",
+			manifest:     true,
+			expectExists: false,
+		},
+		{
+			name:         "No manifest. Should keep the secret, as the removed specs are unknown.",
+			manifest:     false,
+			expectExists: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-password", []byte("gsm-password-v1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			newController := func(specs []config.SecretSyncSpec) *SecretSyncController {
+				controller := &SecretSyncController{
+					Client: cl,
+					Agent:  &config.Agent{},
+					Prune:  true,
+				}
+				if tc.manifest {
+					controller.Manifest = &HashManifest{Namespace: "ns-a", Name: "manifest"}
+					if err := controller.Manifest.Load(cl); err != nil {
+						t.Fatal(err)
+					}
+				}
+				controller.Agent.Set(&config.SecretSyncConfig{Specs: specs})
+				return controller
+			}
+
+			newController([]config.SecretSyncSpec{verifySpec, specB, specOther}).SyncAll()
+			if cl.ValidateKubernetesSecret("ns-a", "secret-a") != nil {
+				t.Fatalf("Expected namespaces/ns-a/secrets/secret-a to be synced.")
+			}
+
+			// the restarted controller starts from the removal of the specs
+			newController([]config.SecretSyncSpec{specOther}).SyncAll()
+
+			exists := cl.ValidateKubernetesSecret("ns-a", "secret-a") == nil
+			if exists != tc.expectExists {
+				t.Errorf("Expected secret existing %v, but got %v.", tc.expectExists, exists)
+			}
+			if cl.ValidateKubernetesSecret("ns-a", "secret-other") != nil {
+				t.Errorf("Expected namespaces/ns-a/secrets/secret-other to be kept.")
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"k8s.io/klog"
+	"net/http"
+	"strings"
+)
+
+// SyncSummary is the summary of the results of a SyncAll() cycle.
+type SyncSummary struct {
+	// Updated is the number of specs with at least one destination key written.
+	Updated int `json:"updated"`
+	// Unchanged is the number of specs synced without any write, or skipped by Manifest.
+	Unchanged int `json:"unchanged"`
+	// Skipped is the number of specs left for a later cycle, waiting for a dependency or a namespace.
+	Skipped int `json:"skipped"`
+	// Deferred is the number of specs with changes held until their write windows open.
+	Deferred int `json:"deferred"`
+	// Failed maps the specs failed to sync to their errors.
+	Failed map[string]string `json:"failed"`
+}
+
+// resyncRequests returns the channel of the SyncAll() requests served by Start().
+func (c *SecretSyncController) resyncRequests() chan chan SyncSummary {
+	c.resyncOnce.Do(func() {
+		c.resync = make(chan chan SyncSummary)
+	})
+	return c.resync
+}
+
+// ResyncHandler returns the handler of POST /resync, running an immediate SyncAll() out of the schedule of ResyncPeriod,
+// and responding with its SyncSummary in JSON. Requests must carry token as a bearer token.
+// The SyncAll() runs in the loop of Start(), after the cycle in progress if any, so requests wait until Start() is running.
+func (c *SecretSyncController) ResyncHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, token) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reply := make(chan SyncSummary, 1)
+		select {
+		case c.resyncRequests() <- reply:
+		case <-r.Context().Done():
+			return
+		}
+		// the cycle completes even if the request is canceled, the buffered reply is then dropped
+		var summary SyncSummary
+		select {
+		case summary = <-reply:
+		case <-r.Context().Done():
+			return
+		}
+		klog.Infof("Resync requested by %s: %d updated, %d unchanged, %d skipped, %d failed", r.RemoteAddr, summary.Updated, summary.Unchanged, summary.Skipped, len(summary.Failed))
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(summary)
+		if err != nil {
+			klog.Errorf("Fail to write resync summary: %s", err)
+		}
+	})
+}
+
+// authorized returns true if r carries token in its Authorization header as a bearer token.
+// An empty token never authorizes, so that the endpoint is not left open by a missing token.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	bearer := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
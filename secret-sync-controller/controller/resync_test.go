@@ -0,0 +1,139 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"testing"
+	"time"
+)
+
+func TestResyncHandler(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		method        string
+		authorization string
+		expectStatus  int
+		expectUpdated int
+		expectValue   string
+	}{
+		{
+			name:          "Authorized POST. Should sync right away.",
+			method:        http.MethodPost,
+			authorization: "Bearer admin-token",
+			expectStatus:  http.StatusOK,
+			expectUpdated: 1,
+			expectValue:   "gsm-token-v2",
+		},
+		{
+			name:          "Wrong token. Should not sync.",
+			method:        http.MethodPost,
+			authorization: "Bearer other-token",
+			expectStatus:  http.StatusUnauthorized,
+			expectValue:   "gsm-token-v1",
+		},
+		{
+			name:          "Token without bearer scheme. Should not sync.",
+			method:        http.MethodPost,
+			authorization: "admin-token",
+			expectStatus:  http.StatusUnauthorized,
+			expectValue:   "gsm-token-v1",
+		},
+		{
+			name:          "GET. Should not sync.",
+			method:        http.MethodGet,
+			authorization: "Bearer admin-token",
+			expectStatus:  http.StatusMethodNotAllowed,
+			expectValue:   "gsm-token-v1",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			initial := make(chan SyncSummary, 1)
+			controller := &SecretSyncController{
+				Client: cl,
+				Agent:  &config.Agent{},
+				// only the initial cycle runs on schedule during the test
+				ResyncPeriod: time.Hour,
+				cycled: func(summary SyncSummary) {
+					initial <- summary
+				},
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+			handler := controller.ResyncHandler("admin-token")
+
+			stopChan := make(chan struct{})
+			stopped := make(chan struct{})
+			go func() {
+				controller.Start(stopChan)
+				close(stopped)
+			}()
+
+			// the source is updated once the initial cycle is done, so that only the resync can sync it
+			select {
+			case <-initial:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Timed out waiting for the initial cycle.")
+			}
+			err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp := serveResync(handler, tc.method, tc.authorization)
+
+			// the mock client is only safe to read once Start() has returned
+			close(stopChan)
+			<-stopped
+
+			if resp.Code != tc.expectStatus {
+				t.Fatalf("Expected status %d, but got %d: %s", tc.expectStatus, resp.Code, resp.Body)
+			}
+			if tc.expectStatus == http.StatusOK {
+				summary := SyncSummary{}
+				err = json.NewDecoder(resp.Body).Decode(&summary)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if summary.Updated != tc.expectUpdated || len(summary.Failed) != 0 {
+					t.Errorf("Expected %d updated specs, but got %+v.", tc.expectUpdated, summary)
+				}
+			}
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != tc.expectValue {
+				t.Errorf("Expected %s, but got %s.", tc.expectValue, value)
+			}
+		})
+	}
+}
+
+// serveResync serves a request of method to /resync with the authorization header by handler.
+func serveResync(handler http.Handler, method, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/resync", nil)
+	req.Header.Set("Authorization", authorization)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
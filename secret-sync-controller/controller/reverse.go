@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+)
+
+// reverseSyncPair sychronizes the secret value from pair.Destination to pair.Source, for the reverse direction,
+// tracing each read and write of a secret value in a child span of the span in ctx.
+// A new version of pair.Source is added if its latest value differs, and pair.Source is created if missing.
+// Returns true if pair.Source is updated, and its latest version.
+// Returns errWindowClosed instead of writing if writable is false.
+func (c *SecretSyncController) reverseSyncPair(ctx context.Context, pair config.SecretSyncSpec, writable bool) (bool, string, error) {
+	// get the Kubernetes secret value
+	_, span := trace.StartSpan(ctx, k8sReadSpan)
+	span.AddAttributes(trace.StringAttribute("destination", pair.Destination.String()))
+	k8sData, err := c.Client.GetKubernetesSecretValue(pair.Destination.Namespace, pair.Destination.Secret, pair.Destination.Key)
+	if err == nil && k8sData == nil {
+		err = fmt.Errorf("Secret %s not found", pair.Destination)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return false, "", err
+	}
+	k8sData, err = pair.EqualityMode.Normalize(k8sData)
+	if err != nil {
+		return false, "", fmt.Errorf("Fail to normalize %s as %s: %s", pair.Destination, pair.EqualityMode, err)
+	}
+
+	// get the Secret Manager secret value, nil if the secret doesn't exist yet
+	_, span = trace.StartSpan(ctx, gsmReadSpan)
+	span.AddAttributes(trace.StringAttribute("source", pair.Source.String()))
+	gsmData, version, err := c.Client.GetSecretManagerSecretVersion(pair.Source.Project, pair.Source.Secret)
+	if status.Code(err) == codes.NotFound {
+		err = nil
+	}
+	endSpan(span, err)
+	if err != nil {
+		return false, "", err
+	}
+
+	if gsmData != nil && pair.EqualityMode.Equal(k8sData, gsmData) {
+		return false, version, nil
+	}
+	if !writable {
+		return false, "", errWindowClosed
+	}
+
+	_, span = trace.StartSpan(ctx, gsmWriteSpan)
+	span.AddAttributes(trace.StringAttribute("source", pair.Source.String()))
+	err = c.Client.UpsertReplicatedSecretManagerSecret(pair.Source.Project, pair.Source.Secret, pair.Replication.Locations, k8sData)
+	// the client errors may echo the written value
+	err = redact.Error(err, k8sData, gsmData)
+	endSpan(span, err)
+	if err != nil {
+		return false, "", err
+	}
+
+	_, version, err = c.Client.GetSecretManagerSecretVersion(pair.Source.Project, pair.Source.Secret)
+	if err != nil {
+		return true, "", fmt.Errorf("Fail to get the version of %s: %s", pair.Source, redact.Error(err, k8sData))
+	}
+	return true, version, nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"strconv"
+	"testing"
+)
+
+func TestReverseSync(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		gsmValue      []byte
+		key           string
+		expectUpdated bool
+		expectValue   string
+		expectVersion int
+		expectErr     bool
+	}{
+		{
+			name:          "Missing Secret Manager secret. Should create it.",
+			gsmValue:      nil,
+			key:           "key-a",
+			expectUpdated: true,
+			expectValue:   "gsm-token-v1",
+			expectVersion: 1,
+		},
+		{
+			name:          "Unchanged Kubernetes value. Should not add a version.",
+			gsmValue:      []byte("gsm-token-v1"),
+			key:           "key-a",
+			expectUpdated: false,
+			expectValue:   "gsm-token-v1",
+			expectVersion: 1,
+		},
+		{
+			name:          "Changed Kubernetes value. Should add a version.",
+			gsmValue:      []byte("gsm-token-v0"),
+			key:           "key-a",
+			expectUpdated: true,
+			expectValue:   "gsm-token-v1",
+			expectVersion: 2,
+		},
+		{
+			name:          "Missing Kubernetes key. Should fail.",
+			gsmValue:      []byte("gsm-token-v0"),
+			key:           "key-missing",
+			expectUpdated: false,
+			expectValue:   "gsm-token-v0",
+			expectVersion: 1,
+			expectErr:     true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			if tc.gsmValue != nil {
+				err := cl.UpsertSecretManagerSecret("project-1", "k8s-token", tc.gsmValue)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			spec := config.SecretSyncSpec{
+				Source: config.SecretManagerSpec{
+					Project: "project-1",
+					Secret:  "k8s-token",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       tc.key,
+				},
+				Direction: config.DirectionReverse,
+			}
+			controller := &SecretSyncController{
+				Client:            cl,
+				StatusAnnotations: true,
+			}
+
+			updated, err := controller.Sync(spec)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("Expected error %v, but got %v.", tc.expectErr, err)
+			}
+			if updated != tc.expectUpdated {
+				t.Errorf("Expected updated %v, but got %v.", tc.expectUpdated, updated)
+			}
+
+			value, version, err := cl.GetSecretManagerSecretVersion("project-1", "k8s-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != tc.expectValue {
+				t.Errorf("Expected %s, but got %s.", tc.expectValue, value)
+			}
+			if version != strconv.Itoa(tc.expectVersion) {
+				t.Errorf("Expected version %d, but got %s.", tc.expectVersion, version)
+			}
+
+			// the Kubernetes source is left as it is
+			annotations, err := cl.GetKubernetesSecretAnnotations("ns-a", "secret-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(annotations) != 0 {
+				t.Errorf("Expected no annotation on the Kubernetes source, but got %v.", annotations)
+			}
+		})
+	}
+}
+
+func TestReverseSyncReplication(t *testing.T) {
+	var testcases = []struct {
+		name            string
+		existing        bool
+		locations       []string
+		expectLocations []string
+	}{
+		{
+			name:            "Missing Secret Manager secret. Should create it with the replication of the spec.",
+			existing:        false,
+			locations:       []string{"us-east1", "us-west1"},
+			expectLocations: []string{"us-east1", "us-west1"},
+		},
+		{
+			name:            "Existing secret replicated automatically. Should add a version without recreating it.",
+			existing:        true,
+			locations:       []string{"us-east1"},
+			expectLocations: nil,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			if tc.existing {
+				err := cl.UpsertSecretManagerSecret("project-1", "k8s-token", []byte("gsm-token-v0"))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			spec := config.SecretSyncSpec{
+				Source: config.SecretManagerSpec{
+					Project: "project-1",
+					Secret:  "k8s-token",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction:   config.DirectionReverse,
+				Replication: config.ReplicationSpec{Locations: tc.locations},
+			}
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			_, err := controller.Sync(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			locations := cl.SecretManagerReplication["project-1"]["k8s-token"]
+			if !reflect.DeepEqual(locations, tc.expectLocations) {
+				t.Errorf("Expected locations %v, but got %v.", tc.expectLocations, locations)
+			}
+		})
+	}
+}
+
+func TestDecommissionReverse(t *testing.T) {
+	cl := newVerifyClient(t)
+	cfg := &config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{
+			{
+				Source: config.SecretManagerSpec{
+					Project: "project-1",
+					Secret:  "k8s-token",
+				},
+				Destination: config.KubernetesSpec{
+					Namespace: "ns-a",
+					Secret:    "secret-a",
+					Key:       "key-a",
+				},
+				Direction: config.DirectionReverse,
+			},
+		},
+	}
+
+	err := Decommission(cl, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	err = cl.ValidateKubernetesSecret("ns-a", "secret-a")
+	if err != nil {
+		t.Errorf("Expected the source of the reverse spec to be left, but got error: %s", err)
+	}
+}
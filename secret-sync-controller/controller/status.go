@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SpecStatus is the read-only status of a spec, holding no secret value.
+type SpecStatus struct {
+	VerifyResult
+	// MissingSources lists the Secret Manager sources of the spec that do not exist.
+	MissingSources []config.SecretManagerSpec
+	// DestinationExists is true if the destination secret exists,
+	// or for custom resource destinations, if any destination key exists.
+	DestinationExists bool
+	// WriteDeferredUntil is the next time the write window of the spec opens if the destination drifted while the window is closed,
+	// the zero time otherwise. The drift is held as a pending write until then.
+	WriteDeferredUntil time.Time
+}
+
+// InSync returns true if all sources and the destination exist and no drift is found.
+func (s SpecStatus) InSync() bool {
+	return len(s.MissingSources) == 0 && s.DestinationExists && !s.Drifted()
+}
+
+// Status checks the existence of the sources and the destination of spec, and verifies it if they all exist.
+// It only reads, like Verify.
+func (c *SecretSyncController) Status(spec config.SecretSyncSpec) (SpecStatus, error) {
+	result := SpecStatus{
+		VerifyResult: VerifyResult{
+			Spec: spec,
+		},
+	}
+
+	for _, pair := range spec.Pairs() {
+		var err error
+		if spec.MirrorsSecret() {
+			// the whole value of a mirrored source is only parsed into its keys, left to Verify
+			_, _, err = c.readSource(pair)
+		} else {
+			_, _, err = c.getSource(pair)
+		}
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				result.MissingSources = append(result.MissingSources, pair.Source)
+				continue
+			}
+			return result, err
+		}
+	}
+
+	dest := spec.Destination
+	if dest.Resource.IsSet() {
+		for _, pair := range spec.Pairs() {
+			destData, err := c.getDestination(pair.Destination)
+			if err != nil {
+				return result, err
+			}
+			if destData != nil {
+				result.DestinationExists = true
+				break
+			}
+		}
+	} else {
+		err := c.Client.ValidateKubernetesSecret(dest.Namespace, dest.Secret)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return result, fmt.Errorf("Fail to get namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+		}
+		result.DestinationExists = err == nil
+	}
+
+	if len(result.MissingSources) != 0 || !result.DestinationExists {
+		return result, nil
+	}
+
+	verifyResult, err := c.Verify(spec)
+	result.VerifyResult = verifyResult
+	if err != nil || !result.Drifted() {
+		return result, err
+	}
+
+	writable, opens, err := c.writeWindow(spec)
+	if err == nil && !writable {
+		result.WriteDeferredUntil = opens
+	}
+	return result, err
+}
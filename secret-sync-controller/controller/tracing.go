@@ -0,0 +1,38 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"go.opencensus.io/trace"
+)
+
+// Span names of a sync cycle: a SyncAll span parents a Sync span per spec,
+// which parents a span per client call on the keys of the spec.
+// Spans are only exported once an exporter is registered, e.g. by --otel-endpoint.
+const (
+	syncAllSpan  = "secret-sync/SyncAll"
+	syncSpan     = "secret-sync/Sync"
+	gsmReadSpan  = "secret-sync/gsm.Read"
+	k8sReadSpan  = "secret-sync/k8s.Read"
+	k8sWriteSpan = "secret-sync/k8s.Write"
+	gsmWriteSpan = "secret-sync/gsm.Write"
+)
+
+// endSpan records err as the status of span, and ends it.
+func endSpan(span *trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	span.End()
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"go.opencensus.io/trace"
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryExporter keeps the exported spans in memory.
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (e *memoryExporter) ExportSpan(s *trace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// paths returns the span names joined from the root of each span, e.g. "SyncAll > Sync", in sorted order.
+func (e *memoryExporter) paths() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	byID := map[trace.SpanID]*trace.SpanData{}
+	for _, s := range e.spans {
+		byID[s.SpanID] = s
+	}
+
+	paths := []string{}
+	for _, s := range e.spans {
+		names := []string{s.Name}
+		for parent, ok := byID[s.ParentSpanID]; ok; parent, ok = byID[parent.ParentSpanID] {
+			names = append([]string{parent.Name}, names...)
+		}
+		paths = append(paths, strings.Join(names, " > "))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestSyncAllTracing(t *testing.T) {
+	exporter := &memoryExporter{}
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	// restore the default sampler
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	cl := tests.NewMockClient([]string{"project-1"})
+	err := cl.CreateKubernetesNamespace("ns-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.UpsertSecretManagerSecret("project-1", "gsm-synced", []byte("synced"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controller := &SecretSyncController{
+		Client: cl,
+		Agent:  &config.Agent{},
+	}
+	controller.Agent.Set(&config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{
+			{
+				Source:      config.SecretManagerSpec{Project: "project-1", Secret: "gsm-synced"},
+				Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-synced", Key: "key"},
+			},
+			{
+				// the missing source fails the sync before reading the destination
+				Source:      config.SecretManagerSpec{Project: "project-1", Secret: "gsm-missing"},
+				Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-missing", Key: "key"},
+			},
+		},
+	})
+	controller.SyncAll()
+
+	expected := []string{
+		syncAllSpan,
+		syncAllSpan + " > " + syncSpan,
+		syncAllSpan + " > " + syncSpan,
+		syncAllSpan + " > " + syncSpan + " > " + gsmReadSpan,
+		syncAllSpan + " > " + syncSpan + " > " + gsmReadSpan,
+		syncAllSpan + " > " + syncSpan + " > " + k8sReadSpan,
+		syncAllSpan + " > " + syncSpan + " > " + k8sWriteSpan,
+	}
+	sort.Strings(expected)
+	if paths := exporter.paths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected spans %v, got %v.", expected, paths)
+	}
+
+	for _, s := range exporter.spans {
+		if s.TraceID != exporter.spans[0].TraceID {
+			t.Errorf("Expected a single trace for the cycle, got span %s in another trace.", s.Name)
+		}
+
+		failing := s.Attributes["spec"] != nil && strings.Contains(s.Attributes["spec"].(string), "gsm-missing") ||
+			s.Attributes["source"] != nil && strings.Contains(s.Attributes["source"].(string), "gsm-missing")
+		if failing && s.Code == trace.StatusCodeOK {
+			t.Errorf("Expected an error status on span %s of the missing source.", s.Name)
+		}
+		if !failing && s.Code != trace.StatusCodeOK {
+			t.Errorf("Unexpected error status on span %s: %s", s.Name, s.Message)
+		}
+	}
+}
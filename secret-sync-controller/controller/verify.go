@@ -0,0 +1,255 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/redact"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sort"
+	"strings"
+)
+
+// VerifyResult is the result of a deep comparison between the sources and the destination of a spec.
+type VerifyResult struct {
+	Spec config.SecretSyncSpec
+	// Drifts describes each difference found, empty if the destination is in sync.
+	Drifts []string
+	// TypeDrifted is true if the destination secret is not Opaque, which a sync cannot fix.
+	TypeDrifted bool
+}
+
+// Drifted returns true if any difference is found.
+func (r VerifyResult) Drifted() bool {
+	return len(r.Drifts) != 0
+}
+
+// ErrPersistentDrift is returned by Start() if MaxDriftCycles is set
+// and specs are found drifted by MaxDriftCycles consecutive VerifyAll() calls.
+type ErrPersistentDrift struct {
+	Specs  []string
+	Cycles int
+}
+
+func (e *ErrPersistentDrift) Error() string {
+	return fmt.Sprintf("Secrets %s drifted for %d consecutive verifications", strings.Join(e.Specs, ", "), e.Cycles)
+}
+
+// VerifyAll verifies all specs specified in Agent.Config().Specs, and updates the drift metrics.
+// Drifted specs are re-synced if c.AutoRemediate is set, otherwise nothing is written. Reverse and bidirectional specs are not verified.
+// Managed destination secrets of a drifted type are recreated before the re-sync, as a sync cannot change the type of a secret.
+// The type drift of unmanaged secrets is excluded from the remediation, and left to their owners: only their values are re-synced.
+// The drift metric of a spec failing verification is reset.
+func (c *SecretSyncController) VerifyAll() {
+	verifyRuns.Inc()
+	// the specs removed from the config are dropped from the drift counts
+	drifted := map[config.SpecID]int{}
+	for _, spec := range c.ExpandSpecs(c.Agent.Config().Specs) {
+		// the Kubernetes secret of a reverse or bidirectional spec is a source, there is no drift to verify
+		if spec.Direction.WritesSecretManager() {
+			continue
+		}
+		result, err := c.Verify(spec)
+		if err != nil {
+			// an unverified spec neither breaks nor extends its drift streak
+			if count, ok := c.drifted[spec.ID()]; ok {
+				drifted[spec.ID()] = count
+			}
+			specDrift.DeleteLabelValues(spec.ID().String())
+			klog.Errorf("Secret verification failed for %s: %s", spec, err)
+			continue
+		}
+
+		if !result.Drifted() {
+			specDrift.WithLabelValues(spec.ID().String()).Set(0)
+			continue
+		}
+		specDrift.WithLabelValues(spec.ID().String()).Set(1)
+		drifted[spec.ID()] = c.drifted[spec.ID()] + 1
+		klog.Warningf("Secret %s drifted: %v", spec, result.Drifts)
+
+		if c.AutoRemediate {
+			if result.TypeDrifted {
+				err = c.recreate(spec.Destination)
+				if err == errUnmanagedType {
+					klog.Warningf("Secret namespaces/%s/secrets/%s of %s is not managed by the controller, its type needs to be reset manually.", spec.Destination.Namespace, spec.Destination.Secret, spec)
+				} else if err != nil {
+					klog.Errorf("Secret remediation failed for %s: %s", spec, err)
+					continue
+				}
+			}
+			_, err = c.Sync(spec)
+			if err != nil {
+				klog.Errorf("Secret remediation failed for %s: %s", spec, err)
+			}
+		}
+	}
+	c.drifted = drifted
+}
+
+// persistentDrift returns ErrPersistentDrift if MaxDriftCycles is set
+// and any spec is found drifted by the last MaxDriftCycles VerifyAll() calls, otherwise nil.
+func (c *SecretSyncController) persistentDrift() error {
+	if c.MaxDriftCycles <= 0 {
+		return nil
+	}
+
+	specs := []string{}
+	for id, count := range c.drifted {
+		if count >= c.MaxDriftCycles {
+			specs = append(specs, id.String())
+		}
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	sort.Strings(specs)
+	return &ErrPersistentDrift{Specs: specs, Cycles: c.MaxDriftCycles}
+}
+
+// errUnmanagedType is returned by recreate() if the destination secret of a drifted type is not managed by the controller.
+var errUnmanagedType = errors.New("secret of a drifted type not managed by the controller")
+
+// recreate recreates the destination secret of dest to reset its type, if it is managed by the controller.
+// Returns errUnmanagedType otherwise.
+func (c *SecretSyncController) recreate(dest config.KubernetesSpec) error {
+	labels, err := c.Client.GetKubernetesSecretLabels(dest.Namespace, dest.Secret)
+	if err != nil {
+		return fmt.Errorf("Fail to get labels of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	if labels[client.ManagedByLabel] != c.Client.ManagerName() {
+		return errUnmanagedType
+	}
+
+	err = c.Client.RecreateKubernetesSecret(dest.Namespace, dest.Secret)
+	if err != nil {
+		return fmt.Errorf("Fail to recreate namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	klog.V(2).Infof("Recreated secret namespaces/%s/secrets/%s as %s", dest.Namespace, dest.Secret, v1.SecretTypeOpaque)
+
+	return nil
+}
+
+// Verify compares the destination of spec with its sources, without writing.
+// Besides the secret values, it checks the type of the destination secret,
+// and the source annotations if c.AnnotateSource is set.
+// Only the values are compared for custom resource destinations.
+func (c *SecretSyncController) Verify(spec config.SecretSyncSpec) (VerifyResult, error) {
+	result := VerifyResult{
+		Spec: spec,
+	}
+	dest := spec.Destination
+	if dest.Resource.IsSet() {
+		return c.verifyValues(result)
+	}
+
+	secretType, err := c.Client.GetKubernetesSecretType(dest.Namespace, dest.Secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			result.Drifts = append(result.Drifts, fmt.Sprintf("secret namespaces/%s/secrets/%s not found", dest.Namespace, dest.Secret))
+			return result, nil
+		}
+		return result, fmt.Errorf("Fail to get type of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	if secretType != string(v1.SecretTypeOpaque) {
+		result.Drifts = append(result.Drifts, fmt.Sprintf("type is %s instead of %s", secretType, v1.SecretTypeOpaque))
+		result.TypeDrifted = true
+	}
+
+	var annotations map[string]string
+	if c.AnnotateSource {
+		annotations, err = c.Client.GetKubernetesSecretAnnotations(dest.Namespace, dest.Secret)
+		if err != nil {
+			return result, fmt.Errorf("Fail to get annotations of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+		}
+	}
+
+	errs := []error{}
+	pairs, err := c.pairs(spec)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, pair := range pairs {
+		srcData, version, err := c.getSource(pair)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		destData, err := c.getDestination(pair.Destination)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if !pair.EqualityMode.Equal(srcData, destData) {
+			result.Drifts = append(result.Drifts, fmt.Sprintf("value of [%s] differs from %s: %s instead of %s", pair.Destination.Key, pair.Source, redact.Value(destData), redact.Value(srcData)))
+		}
+
+		if c.AnnotateSource {
+			key := client.SourceAnnotation(pair.Destination.Key)
+			value := fmt.Sprintf("projects/%s/secrets/%s@%s", pair.Source.Project, pair.Source.Secret, version)
+			if annotations[key] != value {
+				result.Drifts = append(result.Drifts, fmt.Sprintf("annotation %s is %q instead of %q", key, annotations[key], value))
+			}
+		}
+	}
+
+	if spec.MirrorsSecret() && err == nil {
+		vanished, err := c.vanishedKeys(spec, pairs)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, key := range vanished {
+			result.Drifts = append(result.Drifts, fmt.Sprintf("key [%s] is not in %s", key, spec.Source))
+		}
+	}
+
+	return result, utilerrors.NewAggregate(errs)
+}
+
+// verifyValues compares the destination values of result.Spec with its sources,
+// adding the differences found to result.Drifts.
+func (c *SecretSyncController) verifyValues(result VerifyResult) (VerifyResult, error) {
+	errs := []error{}
+	for _, pair := range result.Spec.Pairs() {
+		srcData, _, err := c.getSource(pair)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		destData, err := c.getDestination(pair.Destination)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if destData == nil {
+			result.Drifts = append(result.Drifts, fmt.Sprintf("%s not found", pair.Destination))
+			continue
+		}
+
+		if !pair.EqualityMode.Equal(srcData, destData) {
+			result.Drifts = append(result.Drifts, fmt.Sprintf("value of [%s] differs from %s: %s instead of %s", pair.Destination.Key, pair.Source, redact.Value(destData), redact.Value(srcData)))
+		}
+	}
+
+	return result, utilerrors.NewAggregate(errs)
+}
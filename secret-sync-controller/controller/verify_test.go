@@ -0,0 +1,563 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"reflect"
+	"runtime"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+	"time"
+)
+
+// newVerifyClient returns a mock client with a synced destination secret namespaces/ns-a/secrets/secret-a[key-a].
+func newVerifyClient(t *testing.T) *tests.MockClient {
+	cl := tests.NewMockClient([]string{"project-1"})
+	for _, err := range []error{
+		cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v1")),
+		cl.CreateKubernetesNamespace("ns-a"),
+		cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("gsm-token-v1")),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cl
+}
+
+var verifySpec = config.SecretSyncSpec{
+	Source: config.SecretManagerSpec{
+		Project: "project-1",
+		Secret:  "gsm-token",
+	},
+	Destination: config.KubernetesSpec{
+		Namespace: "ns-a",
+		Secret:    "secret-a",
+		Key:       "key-a",
+	},
+}
+
+func TestVerify(t *testing.T) {
+	var testcases = []struct {
+		name           string
+		annotateSource bool
+		mutate         func(cl *tests.MockClient) error
+		expectDrifts   int
+	}{
+		{
+			name:         "Destination in sync. Should not report drift.",
+			mutate:       func(cl *tests.MockClient) error { return nil },
+			expectDrifts: 0,
+		},
+		{
+			name: "Destination value differs. Should report drift.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("old-token"))
+			},
+			expectDrifts: 1,
+		},
+		{
+			name: "Destination secret type differs. Should report drift.",
+			mutate: func(cl *tests.MockClient) error {
+				cl.K8sSecretTypes = map[string]map[string]string{
+					"ns-a": {"secret-a": "kubernetes.io/tls"},
+				}
+				return nil
+			},
+			expectDrifts: 1,
+		},
+		{
+			name: "Destination secret missing. Should report drift.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteKubernetesSecret("ns-a", "secret-a")
+			},
+			expectDrifts: 1,
+		},
+		{
+			name:           "Source annotation missing. Should report drift.",
+			annotateSource: true,
+			mutate:         func(cl *tests.MockClient) error { return nil },
+			expectDrifts:   1,
+		},
+		{
+			name:           "Source annotation up to date. Should not report drift.",
+			annotateSource: true,
+			mutate: func(cl *tests.MockClient) error {
+				return cl.AnnotateKubernetesSecret("ns-a", "secret-a", map[string]string{
+					client.SourceAnnotation("key-a"): "projects/project-1/secrets/gsm-token@1",
+				})
+			},
+			expectDrifts: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:         cl,
+				AnnotateSource: tc.annotateSource,
+			}
+			result, err := controller.Verify(verifySpec)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if len(result.Drifts) != tc.expectDrifts {
+				t.Errorf("Expected %d drifts, but got %v.", tc.expectDrifts, result.Drifts)
+			}
+		})
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		autoRemediate bool
+		expectValue   string
+	}{
+		{
+			name:          "Drifted value without auto-remediation. Should not write.",
+			autoRemediate: false,
+			expectValue:   "old-token",
+		},
+		{
+			name:          "Drifted value with auto-remediation. Should re-sync.",
+			autoRemediate: true,
+			expectValue:   "gsm-token-v1",
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("old-token"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:        cl,
+				Agent:         &config.Agent{},
+				AutoRemediate: tc.autoRemediate,
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			controller.VerifyAll()
+
+			drift := testutil.ToFloat64(specDrift.WithLabelValues(verifySpec.ID().String()))
+			if drift != 1 {
+				t.Errorf("Expected drift 1, but got %v.", drift)
+			}
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != tc.expectValue {
+				t.Errorf("Expected value %s, but got %s.", tc.expectValue, value)
+			}
+		})
+	}
+}
+
+func TestVerifyAllRecreate(t *testing.T) {
+	var testcases = []struct {
+		name    string
+		managed bool
+		// value is the drifted value of the destination key, in sync if empty
+		value             string
+		expectType        string
+		expectLabels      map[string]string
+		expectAnnotations map[string]string
+	}{
+		{
+			name:       "Managed secret of drifted type. Should recreate it, keeping only the preserved metadata.",
+			managed:    true,
+			expectType: "Opaque",
+			expectLabels: map[string]string{
+				client.ManagedByLabel:         client.ManagedByValue,
+				"argocd.argoproj.io/instance": "app-a",
+			},
+			expectAnnotations: map[string]string{
+				"meta.helm.sh/release-name": "release-a",
+			},
+		},
+		{
+			name:       "Unmanaged secret of drifted type. Should not recreate it.",
+			managed:    false,
+			expectType: "kubernetes.io/tls",
+			expectLabels: map[string]string{
+				"argocd.argoproj.io/instance": "app-a",
+				"team":                        "team-a",
+			},
+			expectAnnotations: map[string]string{
+				"meta.helm.sh/release-name": "release-a",
+				"note":                      "hand-written",
+			},
+		},
+		{
+			name:       "Unmanaged secret of drifted type and value. Should re-sync the value without recreating it.",
+			managed:    false,
+			value:      "old-token",
+			expectType: "kubernetes.io/tls",
+			expectLabels: map[string]string{
+				client.ManagedByLabel:         client.ManagedByValue,
+				"argocd.argoproj.io/instance": "app-a",
+				"team":                        "team-a",
+			},
+			expectAnnotations: map[string]string{
+				client.SourceAnnotation("key-a"): "projects/project-1/secrets/gsm-token@1",
+				"meta.helm.sh/release-name":      "release-a",
+				"note":                           "hand-written",
+			},
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			if tc.value != "" {
+				cl.K8sSecret["ns-a"]["secret-a"]["key-a"] = []byte(tc.value)
+			}
+			cl.PreserveMetadata = []string{"argocd.argoproj.io/instance", "meta.helm.sh/release-name"}
+			cl.K8sSecretTypes = map[string]map[string]string{
+				"ns-a": {"secret-a": "kubernetes.io/tls"},
+			}
+			labels := map[string]string{
+				"argocd.argoproj.io/instance": "app-a",
+				"team":                        "team-a",
+			}
+			if tc.managed {
+				labels[client.ManagedByLabel] = client.ManagedByValue
+			}
+			cl.K8sSecretLabels["ns-a"]["secret-a"] = labels
+			err := cl.AnnotateKubernetesSecret("ns-a", "secret-a", map[string]string{
+				"meta.helm.sh/release-name": "release-a",
+				"note":                      "hand-written",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controller := &SecretSyncController{
+				Client:        cl,
+				Agent:         &config.Agent{},
+				AutoRemediate: true,
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			controller.VerifyAll()
+
+			secretType, err := cl.GetKubernetesSecretType("ns-a", "secret-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secretType != tc.expectType {
+				t.Errorf("Expected type %s, but got %s.", tc.expectType, secretType)
+			}
+			if !reflect.DeepEqual(cl.K8sSecretLabels["ns-a"]["secret-a"], tc.expectLabels) {
+				t.Errorf("Expected labels %v, but got %v.", tc.expectLabels, cl.K8sSecretLabels["ns-a"]["secret-a"])
+			}
+			if !reflect.DeepEqual(cl.K8sSecretAnnotations["ns-a"]["secret-a"], tc.expectAnnotations) {
+				t.Errorf("Expected annotations %v, but got %v.", tc.expectAnnotations, cl.K8sSecretAnnotations["ns-a"]["secret-a"])
+			}
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != "gsm-token-v1" {
+				t.Errorf("Expected value gsm-token-v1 kept, but got %s.", value)
+			}
+		})
+	}
+}
+
+func TestVerifyAllError(t *testing.T) {
+	cl := newVerifyClient(t)
+	controller := &SecretSyncController{
+		Client: cl,
+		Agent:  &config.Agent{},
+	}
+	controller.Agent.Set(&config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{verifySpec},
+	})
+
+	// a drift reported before the source became unreadable
+	specDrift.WithLabelValues(verifySpec.ID().String()).Set(1)
+	err := cl.DeleteSecretManagerSecret("project-1", "gsm-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controller.VerifyAll()
+
+	drift := testutil.ToFloat64(specDrift.WithLabelValues(verifySpec.ID().String()))
+	if drift != 0 {
+		t.Errorf("Expected the stale drift to be reset, but got %v.", drift)
+	}
+}
+
+func TestStartSchedules(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		verifyPeriod time.Duration
+		expectVerify bool
+	}{
+		{
+			name:         "Verification disabled. Should only sync.",
+			verifyPeriod: 0,
+			expectVerify: false,
+		},
+		{
+			name:         "Both schedules. Should sync, and report the drift that sync cannot fix.",
+			verifyPeriod: time.Millisecond,
+			expectVerify: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("old-token"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// secret type drift is never fixed by sync
+			cl.K8sSecretTypes = map[string]map[string]string{
+				"ns-a": {"secret-a": "kubernetes.io/tls"},
+			}
+			specDrift.Reset()
+
+			controller := &SecretSyncController{
+				Client:       cl,
+				Agent:        &config.Agent{},
+				ResyncPeriod: time.Millisecond,
+				VerifyPeriod: tc.verifyPeriod,
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			verifyRunsBefore := testutil.ToFloat64(verifyRuns)
+			stopChan := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				controller.Start(stopChan)
+				close(done)
+			}()
+
+			time.Sleep(20 * time.Millisecond)
+			close(stopChan)
+			<-done
+
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != "gsm-token-v1" {
+				t.Errorf("Expected value gsm-token-v1 synced, but got %s.", value)
+			}
+
+			verified := testutil.ToFloat64(verifyRuns) > verifyRunsBefore
+			if verified != tc.expectVerify {
+				t.Errorf("Expected verification %v, but got %v.", tc.expectVerify, verified)
+			}
+			if tc.expectVerify {
+				drift := testutil.ToFloat64(specDrift.WithLabelValues(verifySpec.ID().String()))
+				if drift != 1 {
+					t.Errorf("Expected drift 1, but got %v.", drift)
+				}
+			}
+		})
+	}
+}
+
+func TestStartNoGoroutineLeak(t *testing.T) {
+	var testcases = []struct {
+		name    string
+		runOnce bool
+	}{
+		{
+			name:    "Stopped by stop signal. Should not leak goroutines.",
+			runOnce: false,
+		},
+		{
+			name:    "Returned in run-once mode without stop signal. Should not leak goroutines.",
+			runOnce: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			controller := &SecretSyncController{
+				Client:       cl,
+				Agent:        &config.Agent{},
+				RunOnce:      tc.runOnce,
+				ResyncPeriod: time.Millisecond,
+				VerifyPeriod: time.Millisecond,
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			before := runtime.NumGoroutine()
+
+			for i := 0; i < 10; i++ {
+				stopChan := make(chan struct{})
+				done := make(chan struct{})
+				go func() {
+					controller.Start(stopChan)
+					close(done)
+				}()
+
+				if !tc.runOnce {
+					time.Sleep(5 * time.Millisecond)
+					close(stopChan)
+				}
+				<-done
+			}
+
+			// the scheduling goroutines quit asynchronously after Start returns
+			after := runtime.NumGoroutine()
+			for i := 0; i < 100 && after > before; i++ {
+				time.Sleep(time.Millisecond)
+				after = runtime.NumGoroutine()
+			}
+			if after > before {
+				t.Errorf("Expected at most %d goroutines after Start returns, but got %d.", before, after)
+			}
+		})
+	}
+}
+
+func TestPersistentDrift(t *testing.T) {
+	var testcases = []struct {
+		name           string
+		maxDriftCycles int
+		// drifts tells whether the destination is drifted before each verification
+		drifts      []bool
+		expectError bool
+	}{
+		{
+			name:           "Drifted by as many consecutive verifications as the threshold. Should fail.",
+			maxDriftCycles: 3,
+			drifts:         []bool{true, true, true},
+			expectError:    true,
+		},
+		{
+			name:           "Drifted by fewer consecutive verifications than the threshold. Should not fail.",
+			maxDriftCycles: 3,
+			drifts:         []bool{true, true},
+			expectError:    false,
+		},
+		{
+			name:           "Drift reconciled in between. Should tolerate the transient drifts.",
+			maxDriftCycles: 3,
+			drifts:         []bool{true, true, false, true, true},
+			expectError:    false,
+		},
+		{
+			name:           "Threshold unset. Should never fail.",
+			maxDriftCycles: 0,
+			drifts:         []bool{true, true, true},
+			expectError:    false,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			controller := &SecretSyncController{
+				Client:         cl,
+				Agent:          &config.Agent{},
+				MaxDriftCycles: tc.maxDriftCycles,
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+
+			for _, drift := range tc.drifts {
+				value := "gsm-token-v1"
+				if drift {
+					value = "tampered"
+				}
+				err := cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte(value))
+				if err != nil {
+					t.Fatal(err)
+				}
+				controller.VerifyAll()
+			}
+
+			err := controller.persistentDrift()
+			if tc.expectError {
+				if _, ok := err.(*ErrPersistentDrift); !ok {
+					t.Errorf("Expected ErrPersistentDrift, but got %v.", err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestStartPersistentDrift(t *testing.T) {
+	cl := newVerifyClient(t)
+	// secret type drift is never fixed by sync
+	cl.K8sSecretTypes = map[string]map[string]string{
+		"ns-a": {"secret-a": "kubernetes.io/tls"},
+	}
+
+	controller := &SecretSyncController{
+		Client:         cl,
+		Agent:          &config.Agent{},
+		ResyncPeriod:   time.Millisecond,
+		VerifyPeriod:   time.Millisecond,
+		MaxDriftCycles: 3,
+	}
+	controller.Agent.Set(&config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{verifySpec},
+	})
+
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	errChan := make(chan error)
+	go func() {
+		errChan <- controller.Start(stopChan)
+	}()
+
+	select {
+	case err := <-errChan:
+		e, ok := err.(*ErrPersistentDrift)
+		if !ok {
+			t.Fatalf("Expected ErrPersistentDrift, but got %v.", err)
+		}
+		if len(e.Specs) != 1 || e.Specs[0] != verifySpec.ID().String() {
+			t.Errorf("Expected drifted spec %s, but got %v.", verifySpec.ID(), e.Specs)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected Start to stop on the persistent drift.")
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"k8s.io/klog"
+)
+
+// DestinationWatcher watches the destination Kubernetes secrets for the changes made outside of the controller,
+// e.g. client.SecretWatcher.
+type DestinationWatcher interface {
+	// Watch calls notify with the namespace and name of each edited or deleted secret, until ctx is done.
+	Watch(ctx context.Context, notify func(namespace, name string)) error
+}
+
+// changedSecret is the Kubernetes secret namespace/name of a change seen by the DestinationWatcher.
+type changedSecret struct {
+	namespace string
+	name      string
+}
+
+// watchDestinations starts watching the destinations with c.DestinationWatcher, and returns the channel of the changed secrets.
+// Changes are dropped if the channel is full, the periodic resync still restores the secrets.
+func (c *SecretSyncController) watchDestinations(ctx context.Context) <-chan changedSecret {
+	changed := make(chan changedSecret, notifyQueueSize)
+	go func() {
+		err := c.DestinationWatcher.Watch(ctx, func(namespace, name string) {
+			select {
+			case changed <- changedSecret{namespace: namespace, name: name}:
+			default:
+				klog.Warningf("Destination queue is full. Dropped change of secret %s/%s.", namespace, name)
+			}
+		})
+		if err != nil {
+			klog.Errorf("Fail to watch destinations: %s", err)
+		}
+	}()
+	return changed
+}
+
+// SyncChanged syncs the specs of the current config writing to the Kubernetes secret namespace/name,
+// once it is edited or deleted outside of the controller. Returns the number of specs synced.
+// The changed values are restored from their sources, and the deleted secrets are created again.
+func (c *SecretSyncController) SyncChanged(namespace, name string) int {
+	synced := 0
+	for _, spec := range c.ExpandSpecs(c.Agent.Config().Specs) {
+		dest := spec.Destination
+		if dest.Resource.IsSet() || dest.Namespace != namespace || dest.Secret != name {
+			continue
+		}
+		_, err := c.Sync(spec)
+		if err != nil {
+			klog.Errorf("Secret sync failed for %s on change of secret %s/%s: %s", spec, namespace, name, err)
+			continue
+		}
+		synced++
+	}
+	if synced != 0 {
+		klog.V(2).Infof("Synced %d specs on change of secret %s/%s", synced, namespace, name)
+	}
+	return synced
+}
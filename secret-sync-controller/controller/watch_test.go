@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+	"time"
+)
+
+func TestSyncChanged(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		mutate       func(cl *tests.MockClient) error
+		namespace    string
+		secret       string
+		expectSynced int
+	}{
+		{
+			name: "Destination edited. Should restore its value.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("edited"))
+			},
+			namespace:    "ns-a",
+			secret:       "secret-a",
+			expectSynced: 1,
+		},
+		{
+			name: "Destination deleted. Should create it again.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.DeleteKubernetesSecret("ns-a", "secret-a")
+			},
+			namespace:    "ns-a",
+			secret:       "secret-a",
+			expectSynced: 1,
+		},
+		{
+			name: "Same secret name in another namespace. Should not sync.",
+			mutate: func(cl *tests.MockClient) error {
+				return cl.UpsertKubernetesSecret("ns-a", "secret-a", "key-a", []byte("edited"))
+			},
+			namespace:    "ns-b",
+			secret:       "secret-a",
+			expectSynced: 0,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := newVerifyClient(t)
+			controller := &SecretSyncController{
+				Client: cl,
+				Agent:  &config.Agent{},
+			}
+			controller.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{verifySpec},
+			})
+			err := tc.mutate(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			synced := controller.SyncChanged(tc.namespace, tc.secret)
+			if synced != tc.expectSynced {
+				t.Errorf("Expected %d synced specs, got %d.", tc.expectSynced, synced)
+			}
+
+			if tc.expectSynced == 0 {
+				return
+			}
+			value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != "gsm-token-v1" {
+				t.Errorf("Expected restored value gsm-token-v1, but got %s.", value)
+			}
+		})
+	}
+}
+
+func TestWatchDestinations(t *testing.T) {
+	watcher := tests.NewFakeDestinationWatcher()
+	controller := &SecretSyncController{
+		DestinationWatcher: watcher,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changedChan := controller.watchDestinations(ctx)
+
+	changes := []changedSecret{
+		{namespace: "ns-a", name: "secret-a"},
+		{namespace: "ns-b", name: "secret-b"},
+	}
+	for _, change := range changes {
+		watcher.Change(change.namespace, change.name)
+	}
+	for _, change := range changes {
+		select {
+		case changed := <-changedChan:
+			if changed != change {
+				t.Errorf("Expected change of %v, got %v.", change, changed)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected change of %v, got none.", change)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sort"
+)
+
+// pairs expands spec into its sync pairs, see config.SecretSyncSpec.Pairs().
+// The pairs of a spec mirroring its whole source secret depend on the keys of the source value, which is read to list them,
+// see config.SecretSyncSpec.MirrorPairs(). The pairs of the valid keys are returned along with the error of the invalid ones.
+func (c *SecretSyncController) pairs(spec config.SecretSyncSpec) ([]config.SecretSyncSpec, error) {
+	if !spec.MirrorsSecret() {
+		return spec.Pairs(), nil
+	}
+
+	data, _, err := c.readSource(spec)
+	if err != nil {
+		return nil, err
+	}
+	return spec.MirrorPairs(data)
+}
+
+// vanishedKeys returns the sorted keys of the destination secret of the mirroring spec that are not in pairs,
+// i.e. that disappeared from its source. Returns nil if the secret doesn't exist.
+func (c *SecretSyncController) vanishedKeys(spec config.SecretSyncSpec, pairs []config.SecretSyncSpec) ([]string, error) {
+	dest := spec.Destination
+	keys, err := c.Client.GetKubernetesSecretKeys(dest.Namespace, dest.Secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Fail to get keys of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+
+	mirrored := map[string]bool{}
+	for _, pair := range pairs {
+		mirrored[pair.Destination.Key] = true
+	}
+	vanished := []string{}
+	for _, key := range keys {
+		if !mirrored[key] {
+			vanished = append(vanished, key)
+		}
+	}
+	sort.Strings(vanished)
+	return vanished, nil
+}
+
+// removeVanishedKeys removes the vanishedKeys() of the mirroring spec from its destination secret,
+// only if the secret is labeled as managed by the controller.
+// Returns true if any key is removed, or errWindowClosed instead of removing if writable is false.
+func (c *SecretSyncController) removeVanishedKeys(spec config.SecretSyncSpec, pairs []config.SecretSyncSpec, writable bool) (bool, error) {
+	vanished, err := c.vanishedKeys(spec, pairs)
+	if err != nil || len(vanished) == 0 {
+		return false, err
+	}
+	if !writable {
+		return false, errWindowClosed
+	}
+
+	dest := spec.Destination
+	labels, err := c.Client.GetKubernetesSecretLabels(dest.Namespace, dest.Secret)
+	if err != nil {
+		return false, fmt.Errorf("Fail to get labels of namespaces/%s/secrets/%s: %s", dest.Namespace, dest.Secret, err)
+	}
+	if labels[client.ManagedByLabel] != c.Client.ManagerName() {
+		klog.Warningf("Secret namespaces/%s/secrets/%s is not managed by %s. Not removing keys %v vanished from %s...", dest.Namespace, dest.Secret, c.Client.ManagerName(), vanished, spec.Source)
+		return false, nil
+	}
+
+	removed := false
+	for _, key := range vanished {
+		err = c.Client.DeleteKubernetesSecretKey(dest.Namespace, dest.Secret, key)
+		if err != nil {
+			return removed, fmt.Errorf("Fail to remove key [%s] of namespaces/%s/secrets/%s: %s", key, dest.Namespace, dest.Secret, err)
+		}
+		removed = true
+		klog.V(2).Infof("Removed key [%s] of namespaces/%s/secrets/%s vanished from %s", key, dest.Namespace, dest.Secret, spec.Source)
+	}
+	return removed, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/tests"
+	"testing"
+)
+
+func TestSyncWholeSecret(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		source      string
+		destination map[string]string
+		unmanaged   bool
+		// inSync means that the destination holds the source already, thus is not written
+		inSync      bool
+		expected    map[string]string
+		expectDrift bool
+	}{
+		{
+			name:     "JSON object into a missing secret. Should write each field into its key.",
+			source:   `{"user": "admin", "pass": "gsm-token-v1"}`,
+			expected: map[string]string{"user": "admin", "pass": "gsm-token-v1"},
+		},
+		{
+			name:        "Field removed from the source. Should remove its key.",
+			source:      `{"user": "admin"}`,
+			destination: map[string]string{"user": "admin", "pass": "gsm-token-v1"},
+			expected:    map[string]string{"user": "admin"},
+		},
+		{
+			name:        "Opaque value replacing a JSON object. Should write the data key only.",
+			source:      "gsm-token-v2",
+			destination: map[string]string{"user": "admin", "pass": "gsm-token-v1"},
+			expected:    map[string]string{"data": "gsm-token-v2"},
+		},
+		{
+			name:        "Unmanaged secret. Should label it as managed on write, thus remove the other keys.",
+			source:      `{"user": "admin"}`,
+			destination: map[string]string{"other": "other-value"},
+			unmanaged:   true,
+			expected:    map[string]string{"user": "admin"},
+		},
+		{
+			name:        "Unmanaged secret in sync. Should not remove the other keys.",
+			source:      `{"user": "admin"}`,
+			destination: map[string]string{"user": "admin", "other": "other-value"},
+			unmanaged:   true,
+			inSync:      true,
+			expected:    map[string]string{"user": "admin", "other": "other-value"},
+			expectDrift: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			cl := tests.NewMockClient([]string{"project-1"})
+			for _, err := range []error{
+				cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte(tc.source)),
+				cl.CreateKubernetesNamespace("ns-a"),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.unmanaged {
+				// hand-created secret without the managed-by label
+				err := cl.CreateKubernetesSecret("ns-a", "secret-a")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for key, value := range tc.destination {
+				if tc.unmanaged {
+					// written by hand, as the upserts label the secret
+					cl.K8sSecret["ns-a"]["secret-a"][key] = []byte(value)
+					continue
+				}
+				err := cl.UpsertKubernetesSecret("ns-a", "secret-a", key, []byte(value))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			spec := config.SecretSyncSpec{
+				Source:      config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token"},
+				Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+			}
+			controller := &SecretSyncController{
+				Client: cl,
+			}
+
+			updated, err := controller.Sync(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated == tc.inSync {
+				t.Errorf("Expected the first sync to update the destination %t, got %t.", !tc.inSync, updated)
+			}
+			actual := map[string]string{}
+			for key, value := range cl.K8sSecret["ns-a"]["secret-a"] {
+				actual[key] = string(value)
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected %v, got %v.", tc.expected, actual)
+			}
+
+			updated, err = controller.Sync(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated {
+				t.Errorf("Expected the second sync to be a no-op.")
+			}
+			result, err := controller.Verify(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Drifted() != tc.expectDrift {
+				t.Errorf("Expected drift %t, got %v.", tc.expectDrift, result.Drifts)
+			}
+		})
+	}
+}
+
+func TestPlanWholeSecret(t *testing.T) {
+	cl := tests.NewMockClient([]string{"project-1"})
+	for _, err := range []error{
+		cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte(`{"user": "admin", "port": "5432"}`)),
+		cl.CreateKubernetesNamespace("ns-a"),
+		cl.UpsertKubernetesSecret("ns-a", "secret-a", "user", []byte("admin")),
+		cl.UpsertKubernetesSecret("ns-a", "secret-a", "pass", []byte("gsm-token-v1")),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	controller := &SecretSyncController{
+		Client: cl,
+		Agent:  &config.Agent{},
+	}
+	controller.Agent.Set(&config.SecretSyncConfig{
+		Specs: []config.SecretSyncSpec{
+			{
+				Source:      config.SecretManagerSpec{Project: "project-1", Secret: "gsm-token"},
+				Destination: config.KubernetesSpec{Namespace: "ns-a", Secret: "secret-a"},
+			},
+		},
+	})
+
+	actions := map[string]PlanAction{}
+	for _, entry := range controller.Plan() {
+		actions[entry.Pair.Destination.Key] = entry.Action
+	}
+	expected := map[string]PlanAction{"port": PlanCreate, "user": PlanNoop, "pass": PlanDelete}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Expected actions %v, got %v.", expected, actions)
+	}
+	if len(cl.K8sSecret["ns-a"]["secret-a"]) != 2 {
+		t.Errorf("Expected destination untouched, got keys %v.", cl.K8sSecret["ns-a"]["secret-a"])
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sort"
+	"time"
+)
+
+// errWindowClosed is returned by syncPair() if the destination differs from the source while the write window of the spec is closed.
+var errWindowClosed = errors.New("write window closed")
+
+// ErrWriteDeferred is returned by Sync() if the destination of a spec differs from its sources
+// while its WriteWindow is closed. The change is held as a PendingWrite until the window opens.
+type ErrWriteDeferred struct {
+	Spec  string
+	Opens time.Time
+}
+
+func (e *ErrWriteDeferred) Error() string {
+	return fmt.Sprintf("Write to %s deferred until its write window opens at %s", e.Spec, e.Opens.UTC().Format(time.RFC3339))
+}
+
+// PendingWrite is a change of the destination of a spec held until its write window opens.
+type PendingWrite struct {
+	Spec config.SpecID `json:"spec"`
+	// Since is the time the change was first deferred.
+	Since time.Time `json:"since"`
+	// Opens is the next time the write window of the spec opens.
+	Opens time.Time `json:"opens"`
+}
+
+// currentTime returns the current time, or the fake time of the tests.
+func (c *SecretSyncController) currentTime() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// writeWindow returns true if the destination of spec may be written now.
+// Otherwise, also returns the next time its WriteWindow opens.
+func (c *SecretSyncController) writeWindow(spec config.SecretSyncSpec) (bool, time.Time, error) {
+	if spec.WriteWindow == nil {
+		return true, time.Time{}, nil
+	}
+	open, opens, err := spec.WriteWindow.Open(c.currentTime())
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("Fail to check the write window of %s: %s", spec, err)
+	}
+	return open, opens, nil
+}
+
+// deferWrite holds the change of the destination of spec until opens.
+func (c *SecretSyncController) deferWrite(spec config.SecretSyncSpec, opens time.Time) {
+	c.deferredLock.Lock()
+	defer c.deferredLock.Unlock()
+
+	if c.deferred == nil {
+		c.deferred = map[config.SpecID]PendingWrite{}
+	}
+	id := spec.ID()
+	pending, ok := c.deferred[id]
+	if !ok {
+		pending = PendingWrite{Spec: id, Since: c.currentTime()}
+	}
+	pending.Opens = opens
+	c.deferred[id] = pending
+	deferredWrites.WithLabelValues(id.String()).Set(1)
+}
+
+// clearDeferred drops the pending write of spec, once its destination is in sync.
+func (c *SecretSyncController) clearDeferred(spec config.SecretSyncSpec) {
+	c.deferredLock.Lock()
+	defer c.deferredLock.Unlock()
+
+	id := spec.ID()
+	if _, ok := c.deferred[id]; ok {
+		delete(c.deferred, id)
+		deferredWrites.DeleteLabelValues(id.String())
+	}
+}
+
+// pruneDeferred drops the pending writes of the specs removed from the config.
+func (c *SecretSyncController) pruneDeferred(specs []config.SecretSyncSpec) {
+	c.deferredLock.Lock()
+	defer c.deferredLock.Unlock()
+
+	ids := map[config.SpecID]bool{}
+	for _, spec := range specs {
+		ids[spec.ID()] = true
+	}
+	for id := range c.deferred {
+		if !ids[id] {
+			delete(c.deferred, id)
+			deferredWrites.DeleteLabelValues(id.String())
+		}
+	}
+}
+
+// PendingWrites returns the changes held until the write windows of their specs open, sorted by spec.
+func (c *SecretSyncController) PendingWrites() []PendingWrite {
+	c.deferredLock.Lock()
+	defer c.deferredLock.Unlock()
+
+	pending := []PendingWrite{}
+	for _, p := range c.deferred {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Spec.String() < pending[j].Spec.String()
+	})
+	return pending
+}
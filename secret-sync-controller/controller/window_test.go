@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"testing"
+	"time"
+)
+
+func TestSyncWriteWindow(t *testing.T) {
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	opens := day.Add(2 * time.Hour)
+
+	cl := newVerifyClient(t)
+	err := cl.UpsertSecretManagerSecret("project-1", "gsm-token", []byte("gsm-token-v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := verifySpec
+	// daily from 02:00 to 04:00 UTC
+	spec.WriteWindow = &config.WriteWindow{Cron: "0 0 2 * * *", Duration: 2 * time.Hour}
+	now := day.Add(time.Hour)
+	controller := &SecretSyncController{
+		Client: cl,
+		Agent:  &config.Agent{},
+		now:    func() time.Time { return now },
+	}
+	controller.Agent.Set(&config.SecretSyncConfig{Specs: []config.SecretSyncSpec{spec}})
+
+	var steps = []struct {
+		name           string
+		now            time.Time
+		expectDeferred int
+		expectUpdated  int
+		expectValue    string
+	}{
+		{
+			name:           "Outside the window. Should defer the write.",
+			now:            day.Add(time.Hour),
+			expectDeferred: 1,
+			expectValue:    "gsm-token-v1",
+		},
+		{
+			name:           "Still outside the window. Should keep deferring the write.",
+			now:            day.Add(90 * time.Minute),
+			expectDeferred: 1,
+			expectValue:    "gsm-token-v1",
+		},
+		{
+			name:          "Inside the window. Should apply the write.",
+			now:           day.Add(150 * time.Minute),
+			expectUpdated: 1,
+			expectValue:   "gsm-token-v2",
+		},
+	}
+	for _, step := range steps {
+		now = step.now
+		summary := controller.SyncAll()
+		if summary.Deferred != step.expectDeferred || summary.Updated != step.expectUpdated || len(summary.Failed) != 0 {
+			t.Errorf("%s Expected %d deferred and %d updated, but got %+v.", step.name, step.expectDeferred, step.expectUpdated, summary)
+		}
+
+		value, err := cl.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != step.expectValue {
+			t.Errorf("%s Expected destination %q, but got %q.", step.name, step.expectValue, value)
+		}
+
+		pending := controller.PendingWrites()
+		gauge := testutil.ToFloat64(deferredWrites.WithLabelValues(spec.ID().String()))
+		if step.expectDeferred == 0 {
+			if len(pending) != 0 || gauge != 0 {
+				t.Errorf("%s Expected no pending write, but got %v with gauge %v.", step.name, pending, gauge)
+			}
+			continue
+		}
+		// the pending write is held since it was first deferred
+		if len(pending) != 1 || !pending[0].Since.Equal(day.Add(time.Hour)) || !pending[0].Opens.Equal(opens) || gauge != 1 {
+			t.Errorf("%s Expected a pending write since %s until %s, but got %v with gauge %v.", step.name, day.Add(time.Hour), opens, pending, gauge)
+		}
+
+		status, err := controller.Status(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.WriteDeferredUntil.Equal(opens) {
+			t.Errorf("%s Expected the status deferred until %s, but got %s.", step.name, opens, status.WriteDeferredUntil)
+		}
+
+		plan := controller.Plan()
+		if len(plan) != 1 || plan[0].Action != PlanDeferred {
+			t.Errorf("%s Expected a deferred plan, but got %v.", step.name, plan)
+		}
+	}
+
+	// no-op detection is not gated
+	now = day.Add(5 * time.Hour)
+	updated, err := controller.Sync(spec)
+	if err != nil || updated {
+		t.Errorf("Expected a no-op outside the window, but got (%v, %v).", updated, err)
+	}
+}
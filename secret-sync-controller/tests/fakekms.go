@@ -0,0 +1,56 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FakeKMS is an in-memory Cloud KMS. Like Cloud KMS, it encrypts with a random nonce,
+// so that the ciphertexts of the same plaintext differ, and fails to decrypt the ciphertexts of other keys with InvalidArgument.
+// The "ciphertext" holds the plaintext in clear. Should be used for testing only.
+type FakeKMS struct {
+	// Encrypts and Decrypts count the calls to Encrypt and Decrypt.
+	Encrypts int
+	Decrypts int
+	// Err fails every call if set, e.g. an unavailable Cloud KMS.
+	Err error
+}
+
+// Encrypt returns the fake ciphertext of plaintext with keyName.
+func (k *FakeKMS) Encrypt(keyName string, plaintext []byte) ([]byte, error) {
+	k.Encrypts++
+	if k.Err != nil {
+		return nil, k.Err
+	}
+	return []byte(fmt.Sprintf("%s|%016x|%s", keyName, rand.Uint64(), plaintext)), nil
+}
+
+// Decrypt returns the plaintext of a fake ciphertext of keyName.
+func (k *FakeKMS) Decrypt(keyName string, ciphertext []byte) ([]byte, error) {
+	k.Decrypts++
+	if k.Err != nil {
+		return nil, k.Err
+	}
+	parts := bytes.SplitN(ciphertext, []byte("|"), 3)
+	if len(parts) != 3 || string(parts[0]) != keyName {
+		return nil, status.Errorf(codes.InvalidArgument, "Decryption failed: the ciphertext is invalid.")
+	}
+	return parts[2], nil
+}
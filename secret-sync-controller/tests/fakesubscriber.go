@@ -0,0 +1,48 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"context"
+)
+
+// FakeSubscriber is an in-memory subscriber of Secret Manager notifications,
+// notifying the secrets published with Publish().
+type FakeSubscriber struct {
+	notifications chan string
+}
+
+func NewFakeSubscriber() *FakeSubscriber {
+	return &FakeSubscriber{
+		notifications: make(chan string),
+	}
+}
+
+// Publish notifies secret, in format projects/<project>/secrets/<secret>, to the receiver.
+// It blocks until the receiver takes the notification.
+func (s *FakeSubscriber) Publish(secret string) {
+	s.notifications <- secret
+}
+
+// Receive calls notify with each published secret until ctx is done.
+func (s *FakeSubscriber) Receive(ctx context.Context, notify func(secret string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case secret := <-s.notifications:
+			notify(secret)
+		}
+	}
+}
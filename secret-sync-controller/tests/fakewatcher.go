@@ -0,0 +1,48 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"context"
+)
+
+// FakeDestinationWatcher is an in-memory watcher of destination Kubernetes secrets,
+// notifying the secrets changed with Change().
+type FakeDestinationWatcher struct {
+	changes chan [2]string
+}
+
+func NewFakeDestinationWatcher() *FakeDestinationWatcher {
+	return &FakeDestinationWatcher{
+		changes: make(chan [2]string),
+	}
+}
+
+// Change notifies the secret namespace/name to the watcher.
+// It blocks until the watcher takes the change.
+func (w *FakeDestinationWatcher) Change(namespace, name string) {
+	w.changes <- [2]string{namespace, name}
+}
+
+// Watch calls notify with each changed secret until ctx is done.
+func (w *FakeDestinationWatcher) Watch(ctx context.Context, notify func(namespace, name string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change := <-w.changes:
+			notify(change[0], change[1])
+		}
+	}
+}
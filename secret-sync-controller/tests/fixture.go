@@ -18,6 +18,7 @@ package tests
 
 import (
 	"context"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"strings"
 	"time"
@@ -33,6 +34,7 @@ import (
 
 type ClientInterface interface {
 	CreateKubernetesSecret(namespace, id string) error
+	CreateKubernetesSecretData(namespace, id string, data map[string][]byte) error
 	DeleteSecretManagerSecret(project, id string) error
 	CleanupKubernetesNamespace(namespace string) error
 	CleanupKubernetesSecrets(namespace string) error
@@ -46,11 +48,19 @@ type E2eTestClient struct {
 // CreateKubernetesSecret creates an empty K8s secret under namespace.
 // Returns nil if successful, error otherwise
 func (cl *E2eTestClient) CreateKubernetesSecret(namespace, id string) error {
+	return cl.CreateKubernetesSecretData(namespace, id, nil)
+}
+
+// CreateKubernetesSecretData creates a K8s secret holding data under namespace,
+// without the labels stamped by the upserts, as if created by hand.
+// Returns nil if successful, error otherwise
+func (cl *E2eTestClient) CreateKubernetesSecretData(namespace, id string, data map[string][]byte) error {
 	newSecret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      id,
 			Namespace: namespace,
 		},
+		Data: data,
 	}
 	_, err := cl.K8sClientset.CoreV1().Secrets(namespace).Create(newSecret)
 	return err
@@ -176,29 +186,48 @@ func (f Fixture) Reset(cl ClientInterface) error {
 		}
 
 		for secret, secretItem := range nsItem {
-			err = cl.CreateKubernetesSecret(namespace, secret)
+			// the secrets are created as by hand, thus not managed by the controller
+			data := map[string][]byte{}
+			for key, value := range secretItem {
+				data[key] = []byte(value)
+			}
+			err = cl.CreateKubernetesSecretData(namespace, secret, data)
 			if err != nil {
 				return err
 			}
-
-			if secretItem == nil {
-				continue
-			}
-			for key, data := range secretItem {
-				err = cl.UpsertKubernetesSecret(namespace, secret, key, []byte(data))
-				if err != nil {
-					return err
-				}
-
-			}
 		}
 	}
 	return nil
 }
 
-// Teardown deletes all Secret Manager secrets and Kubernetes secrets and namespaces created by Setup().
+// NamespaceDeletionTimeout bounds the wait of Teardown() for the deletion of the namespaces,
+// e.g. stuck on a finalizer, so that the tests fail instead of hanging.
+var NamespaceDeletionTimeout = 5 * time.Minute
+
+// namespaceDeletionPollInterval is the interval of checking whether a deleted namespace is gone.
+var namespaceDeletionPollInterval = time.Second
+
+// Teardown deletes the managed destination secrets synced by the test with decommission, if not nil,
+// e.g. controller.Decommission of the synced specs, then all Secret Manager secrets and Kubernetes secrets and namespaces
+// created by Setup(), waiting up to NamespaceDeletionTimeout for the namespace deletions to complete.
 // Returns nil if successful, error otherwise
-func (f Fixture) Teardown(cl ClientInterface) error {
+func (f Fixture) Teardown(cl ClientInterface, decommission func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), NamespaceDeletionTimeout)
+	defer cancel()
+
+	return f.TeardownContext(ctx, cl, decommission)
+}
+
+// TeardownContext is Teardown() waiting for the namespace deletions until ctx is done.
+// Returns error if a namespace is still not deleted by then.
+func (f Fixture) TeardownContext(ctx context.Context, cl ClientInterface, decommission func() error) error {
+	if decommission != nil {
+		err := decommission()
+		if err != nil {
+			return err
+		}
+	}
+
 	for project, projItem := range f.SecretManager {
 		for secret := range projItem {
 			err := cl.DeleteSecretManagerSecret(project, secret)
@@ -208,29 +237,44 @@ func (f Fixture) Teardown(cl ClientInterface) error {
 		}
 	}
 
-	for namespace := range f.Kubernetes {
-		err := cl.CleanupKubernetesSecrets(namespace)
+	for namespace, nsItem := range f.Kubernetes {
+		// the secrets of the fixture are created as by hand, thus left by decommission
+		for secret := range nsItem {
+			err := cl.DeleteKubernetesSecret(namespace, secret)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+
+		err := cl.CleanupKubernetesNamespace(namespace)
 		if err != nil {
 			return err
 		}
 
-		err = cl.CleanupKubernetesNamespace(namespace)
+		err = waitNamespaceDeleted(ctx, cl, namespace)
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		// wait until the namespace deletion completes
-		for {
-			err := cl.ValidateKubernetesNamespace(namespace)
-			if err != nil {
-				if !apierrors.IsNotFound(err) {
-					return err
-				} else {
-					break
-				}
+// waitNamespaceDeleted polls until namespace is not found.
+// Returns error if ctx is done first.
+func waitNamespaceDeleted(ctx context.Context, cl ClientInterface, namespace string) error {
+	for {
+		err := cl.ValidateKubernetesNamespace(namespace)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
 			}
-			time.Sleep(1000 * time.Millisecond)
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Namespace %s is still not deleted: %s", namespace, ctx.Err())
+		case <-time.After(namespaceDeletionPollInterval):
 		}
 	}
-	return nil
 }
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// stuckNamespaceClient never deletes the namespaces, as if they were stuck on a finalizer.
+type stuckNamespaceClient struct {
+	*MockClient
+}
+
+func (cl *stuckNamespaceClient) CleanupKubernetesNamespace(namespace string) error {
+	return nil
+}
+
+func TestTeardownTimeout(t *testing.T) {
+	defer func(interval time.Duration) { namespaceDeletionPollInterval = interval }(namespaceDeletionPollInterval)
+	namespaceDeletionPollInterval = 10 * time.Millisecond
+
+	var testcases = []struct {
+		name      string
+		stuck     bool
+		expectErr bool
+	}{
+		{
+			name:      "Namespace deleted. Should tear down.",
+			stuck:     false,
+			expectErr: false,
+		},
+		{
+			name:      "Namespace never deleted. Should time out.",
+			stuck:     true,
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			fixture := Fixture{
+				Kubernetes: map[string]map[string]map[string]string{
+					"ns-a": nil,
+				},
+			}
+
+			mock := NewMockClient(nil)
+			var cl ClientInterface = mock
+			if tc.stuck {
+				cl = &stuckNamespaceClient{mock}
+			}
+
+			err := fixture.Setup(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			done := make(chan error)
+			go func() {
+				done <- fixture.TeardownContext(ctx, cl, nil)
+			}()
+
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Teardown did not return.")
+			}
+
+			if tc.expectErr && err == nil {
+				t.Errorf("Failed to receive expected error.")
+			} else if !tc.expectErr && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -20,18 +20,50 @@ import (
 	"fmt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+	"sort"
+	"strconv"
+	"time"
 )
 
 type MockClient struct { // mock client
-	K8sSecret           map[string]map[string]map[string][]byte
+	K8sSecret       map[string]map[string]map[string][]byte
+	K8sSecretLabels map[string]map[string]map[string]string
+	// map of namespace to secret to annotations
+	K8sSecretAnnotations map[string]map[string]map[string]string
+	// map of namespace to secret to type, secrets are of type Opaque if not specified
+	K8sSecretTypes map[string]map[string]string
+	// map of namespace to ConfigMap name to data
+	K8sConfigMaps       map[string]map[string]map[string]string
 	SecretManagerSecret map[string]map[string][]byte
+	// map of project to secret to the number of versions
+	SecretManagerVersions map[string]map[string]int
+	// map of project to secret to labels
+	SecretManagerLabels map[string]map[string]map[string]string
+	// map of project to secret to the replica locations, secrets are replicated automatically if not specified
+	SecretManagerReplication map[string]map[string][]string
+	// StringDataWrites counts the writes through UpsertKubernetesSecretStringData
+	StringDataWrites int
+	// PreserveMetadata lists the label and annotation keys carried over by RecreateKubernetesSecret
+	PreserveMetadata []string
+	// map of namespace to secret to owner references
+	K8sSecretOwners map[string]map[string][]metav1.OwnerReference
+	// Manager is the value of the managed-by label of the created secrets, client.ManagedByValue by default.
+	Manager string
+	// map of namespace to secret to key to the time of its last value write
+	K8sSecretUpdateTimes map[string]map[string]map[string]time.Time
+	// map of project to secret to the create time of its latest version
+	SecretManagerCreateTimes map[string]map[string]time.Time
 }
 
 func NewMockClient(namespaces []string) *MockClient {
 	mock := MockClient{
 		K8sSecret:           make(map[string]map[string]map[string][]byte),
+		K8sSecretLabels:     make(map[string]map[string]map[string]string),
 		SecretManagerSecret: make(map[string]map[string][]byte),
 	}
 
@@ -41,6 +73,13 @@ func NewMockClient(namespaces []string) *MockClient {
 	return &mock
 }
 
+func (cl *MockClient) ManagerName() string {
+	if cl.Manager == "" {
+		return client.ManagedByValue
+	}
+	return cl.Manager
+}
+
 func (cl *MockClient) ValidateKubernetesNamespace(namespace string) error {
 	_, ok := cl.K8sSecret[namespace]
 	if !ok {
@@ -59,6 +98,14 @@ func (cl *MockClient) CreateKubernetesNamespace(namespace string) error {
 	cl.K8sSecret[namespace] = make(map[string]map[string][]byte)
 	return nil
 }
+func (cl *MockClient) ListKubernetesNamespaces() ([]string, error) {
+	namespaces := []string{}
+	for namespace := range cl.K8sSecret {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
 func (cl *MockClient) GetKubernetesSecretValue(namespace, id, key string) ([]byte, error) {
 	err := cl.ValidateKubernetesNamespace(namespace)
 	if err != nil {
@@ -75,21 +122,227 @@ func (cl *MockClient) GetKubernetesSecretValue(namespace, id, key string) ([]byt
 	}
 	return val, nil
 }
+func (cl *MockClient) GetKubernetesSecretKeys(namespace, id string) ([]string, error) {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for key := range cl.K8sSecret[namespace][id] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
 func (cl *MockClient) UpsertKubernetesSecret(namespace, id, key string, data []byte) error {
+	return cl.UpsertKubernetesSecretValue(namespace, id, key, data, false, nil)
+}
+func (cl *MockClient) UpsertKubernetesSecretStringData(namespace, id, key string, data []byte) error {
+	return cl.UpsertKubernetesSecretValue(namespace, id, key, data, true, nil)
+}
+func (cl *MockClient) UpsertKubernetesSecretValue(namespace, id, key string, data []byte, stringData bool, annotations map[string]string) error {
 	err := cl.ValidateKubernetesNamespace(namespace)
 	if err != nil {
 		return err
 	}
+	if stringData {
+		cl.StringDataWrites++
+		// as the API server, store stringData into data
+		data = []byte(string(data))
+	}
 
 	err = cl.ValidateKubernetesSecret(namespace, id)
 	if err != nil {
 		cl.K8sSecret[namespace][id] = make(map[string][]byte)
 	}
 	cl.K8sSecret[namespace][id][key] = data
+	cl.SetKubernetesSecretKeyUpdateTime(namespace, id, key, time.Now())
 
+	// as the patch, stamp the label on existing secrets too
+	err = cl.LabelKubernetesSecret(namespace, id, map[string]string{
+		client.ManagedByLabel: cl.ManagerName(),
+	})
+	if err != nil {
+		return err
+	}
+	return cl.AnnotateKubernetesSecret(namespace, id, annotations)
+}
+func (cl *MockClient) GetKubernetesSecretLabels(namespace, id string) (map[string]string, error) {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	return cl.K8sSecretLabels[namespace][id], nil
+}
+func (cl *MockClient) DeleteKubernetesSecret(namespace, id string) error {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return err
+	}
+	delete(cl.K8sSecret[namespace], id)
+	delete(cl.K8sSecretLabels[namespace], id)
+	delete(cl.K8sSecretAnnotations[namespace], id)
+	delete(cl.K8sSecretTypes[namespace], id)
+	delete(cl.K8sSecretOwners[namespace], id)
+	return nil
+}
+func (cl *MockClient) DeleteKubernetesSecretKey(namespace, id, key string) error {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return nil
+	}
+	delete(cl.K8sSecret[namespace][id], key)
+	delete(cl.K8sSecretUpdateTimes[namespace][id], key)
+	return nil
+}
+func (cl *MockClient) GetKubernetesSecretAnnotations(namespace, id string) (map[string]string, error) {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	return cl.K8sSecretAnnotations[namespace][id], nil
+}
+func (cl *MockClient) GetKubernetesSecretKeyUpdateTime(namespace, id, key string) (time.Time, error) {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cl.K8sSecretUpdateTimes[namespace][id][key], nil
+}
+func (cl *MockClient) SetKubernetesSecretKeyUpdateTime(namespace, id, key string, updateTime time.Time) {
+	if cl.K8sSecretUpdateTimes == nil {
+		cl.K8sSecretUpdateTimes = make(map[string]map[string]map[string]time.Time)
+	}
+	if _, ok := cl.K8sSecretUpdateTimes[namespace]; !ok {
+		cl.K8sSecretUpdateTimes[namespace] = make(map[string]map[string]time.Time)
+	}
+	if _, ok := cl.K8sSecretUpdateTimes[namespace][id]; !ok {
+		cl.K8sSecretUpdateTimes[namespace][id] = make(map[string]time.Time)
+	}
+	cl.K8sSecretUpdateTimes[namespace][id][key] = updateTime
+}
+func (cl *MockClient) GetKubernetesSecretType(namespace, id string) (string, error) {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return "", err
+	}
+	secretType, ok := cl.K8sSecretTypes[namespace][id]
+	if !ok {
+		return string(v1.SecretTypeOpaque), nil
+	}
+	return secretType, nil
+}
+func (cl *MockClient) AnnotateKubernetesSecret(namespace, id string, annotations map[string]string) error {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return err
+	}
+	if cl.K8sSecretAnnotations == nil {
+		cl.K8sSecretAnnotations = make(map[string]map[string]map[string]string)
+	}
+	if _, ok := cl.K8sSecretAnnotations[namespace]; !ok {
+		cl.K8sSecretAnnotations[namespace] = make(map[string]map[string]string)
+	}
+	if _, ok := cl.K8sSecretAnnotations[namespace][id]; !ok {
+		cl.K8sSecretAnnotations[namespace][id] = make(map[string]string)
+	}
+	for k, v := range annotations {
+		cl.K8sSecretAnnotations[namespace][id][k] = v
+	}
+	return nil
+}
+func (cl *MockClient) LabelKubernetesSecret(namespace, id string, labels map[string]string) error {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return err
+	}
+	merged := map[string]string{}
+	for k, v := range cl.K8sSecretLabels[namespace][id] {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	cl.setKubernetesSecretLabels(namespace, id, merged)
+	return nil
+}
+func (cl *MockClient) SetKubernetesSecretOwner(namespace, id string, owner metav1.OwnerReference) error {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return err
+	}
+	for _, ref := range cl.K8sSecretOwners[namespace][id] {
+		if ref.UID == owner.UID {
+			return nil
+		}
+	}
+	if cl.K8sSecretOwners == nil {
+		cl.K8sSecretOwners = map[string]map[string][]metav1.OwnerReference{}
+	}
+	if cl.K8sSecretOwners[namespace] == nil {
+		cl.K8sSecretOwners[namespace] = map[string][]metav1.OwnerReference{}
+	}
+	cl.K8sSecretOwners[namespace][id] = append(cl.K8sSecretOwners[namespace][id], owner)
+	return nil
+}
+func (cl *MockClient) RecreateKubernetesSecret(namespace, id string) error {
+	err := cl.ValidateKubernetesSecret(namespace, id)
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{
+		client.ManagedByLabel: cl.ManagerName(),
+	}
+	annotations := map[string]string{}
+	for _, key := range cl.PreserveMetadata {
+		if val, ok := cl.K8sSecretLabels[namespace][id][key]; ok {
+			labels[key] = val
+		}
+		if val, ok := cl.K8sSecretAnnotations[namespace][id][key]; ok {
+			annotations[key] = val
+		}
+	}
+	delete(cl.K8sSecretTypes[namespace], id)
+	delete(cl.K8sSecretAnnotations[namespace], id)
+	cl.setKubernetesSecretLabels(namespace, id, labels)
+	if len(annotations) != 0 {
+		return cl.AnnotateKubernetesSecret(namespace, id, annotations)
+	}
+	return nil
+}
+func (cl *MockClient) GetKubernetesConfigMap(namespace, name string) (map[string]string, error) {
+	data, ok := cl.K8sConfigMaps[namespace][name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{"", "configmaps"}, name)
+	}
+	return data, nil
+}
+func (cl *MockClient) UpsertKubernetesConfigMap(namespace, name string, data map[string]string) error {
+	err := cl.ValidateKubernetesNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if cl.K8sConfigMaps == nil {
+		cl.K8sConfigMaps = make(map[string]map[string]map[string]string)
+	}
+	if _, ok := cl.K8sConfigMaps[namespace]; !ok {
+		cl.K8sConfigMaps[namespace] = make(map[string]map[string]string)
+	}
+	cl.K8sConfigMaps[namespace][name] = data
 	return nil
 }
+func (cl *MockClient) setKubernetesSecretLabels(namespace, id string, labels map[string]string) {
+	if cl.K8sSecretLabels == nil {
+		cl.K8sSecretLabels = make(map[string]map[string]map[string]string)
+	}
+	if _, ok := cl.K8sSecretLabels[namespace]; !ok {
+		cl.K8sSecretLabels[namespace] = make(map[string]map[string]string)
+	}
+	cl.K8sSecretLabels[namespace][id] = labels
+}
 func (cl *MockClient) CreateKubernetesSecret(namespace, id string) error {
+	return cl.CreateKubernetesSecretData(namespace, id, nil)
+}
+func (cl *MockClient) CreateKubernetesSecretData(namespace, id string, data map[string][]byte) error {
 	err := cl.ValidateKubernetesNamespace(namespace)
 	if err != nil {
 		return err
@@ -100,6 +353,10 @@ func (cl *MockClient) CreateKubernetesSecret(namespace, id string) error {
 		return fmt.Errorf("secret \"%s\" already exists", id)
 	}
 	cl.K8sSecret[namespace][id] = make(map[string][]byte)
+	for key, value := range data {
+		cl.K8sSecret[namespace][id][key] = value
+	}
+	cl.setKubernetesSecretLabels(namespace, id, map[string]string{})
 
 	return nil
 }
@@ -108,25 +365,100 @@ func (cl *MockClient) GetSecretManagerSecretValue(project, id string) ([]byte, e
 	if !ok {
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("Secret [projects/%s/secrets/%s] not found or has no versions.", project, id))
 	}
-	return val, nil
+	// return a copy like the actual client, so that callers may overwrite it
+	return append([]byte(nil), val...), nil
+}
+func (cl *MockClient) GetSecretManagerSecretVersion(project, id string) ([]byte, string, error) {
+	val, err := cl.GetSecretManagerSecretValue(project, id)
+	if err != nil {
+		return nil, "", err
+	}
+	return val, strconv.Itoa(cl.SecretManagerVersions[project][id]), nil
+}
+func (cl *MockClient) GetSecretManagerSecretLabels(project, id string) (map[string]string, error) {
+	if _, ok := cl.SecretManagerSecret[project][id]; !ok {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("Secret [projects/%s/secrets/%s] not found.", project, id))
+	}
+	labels := map[string]string{}
+	for key, val := range cl.SecretManagerLabels[project][id] {
+		labels[key] = val
+	}
+	return labels, nil
+}
+func (cl *MockClient) SetSecretManagerSecretLabels(project, id string, labels map[string]string) {
+	if cl.SecretManagerLabels == nil {
+		cl.SecretManagerLabels = make(map[string]map[string]map[string]string)
+	}
+	if _, ok := cl.SecretManagerLabels[project]; !ok {
+		cl.SecretManagerLabels[project] = make(map[string]map[string]string)
+	}
+	cl.SecretManagerLabels[project][id] = labels
 }
 func (cl *MockClient) UpsertSecretManagerSecret(project, id string, data []byte) error {
+	return cl.UpsertReplicatedSecretManagerSecret(project, id, nil, data)
+}
+func (cl *MockClient) UpsertReplicatedSecretManagerSecret(project, id string, locations []string, data []byte) error {
 	_, ok := cl.SecretManagerSecret[project]
 	if !ok {
+		client.ResetReplication(project, id)
 		return status.Error(codes.NotFound, fmt.Sprintf("Project [projects/%s] not found.", project))
 	}
+	if _, ok := cl.SecretManagerSecret[project][id]; ok {
+		client.CheckReplication(project, id, cl.SecretManagerReplication[project][id], locations)
+	} else if len(locations) != 0 {
+		if cl.SecretManagerReplication == nil {
+			cl.SecretManagerReplication = make(map[string]map[string][]string)
+		}
+		if _, ok := cl.SecretManagerReplication[project]; !ok {
+			cl.SecretManagerReplication[project] = make(map[string][]string)
+		}
+		cl.SecretManagerReplication[project][id] = locations
+	}
 	cl.SecretManagerSecret[project][id] = data
+
+	if cl.SecretManagerVersions == nil {
+		cl.SecretManagerVersions = make(map[string]map[string]int)
+	}
+	if _, ok := cl.SecretManagerVersions[project]; !ok {
+		cl.SecretManagerVersions[project] = make(map[string]int)
+	}
+	cl.SecretManagerVersions[project][id]++
+	cl.SetSecretManagerSecretCreateTime(project, id, time.Now())
 	return nil
 }
+func (cl *MockClient) GetSecretManagerSecretCreateTime(project, id, version string) (time.Time, error) {
+	if _, ok := cl.SecretManagerSecret[project][id]; !ok || version != strconv.Itoa(cl.SecretManagerVersions[project][id]) {
+		return time.Time{}, status.Error(codes.NotFound, fmt.Sprintf("Secret Version [projects/%s/secrets/%s/versions/%s] not found.", project, id, version))
+	}
+	return cl.SecretManagerCreateTimes[project][id], nil
+}
+func (cl *MockClient) SetSecretManagerSecretCreateTime(project, id string, createTime time.Time) {
+	if cl.SecretManagerCreateTimes == nil {
+		cl.SecretManagerCreateTimes = make(map[string]map[string]time.Time)
+	}
+	if _, ok := cl.SecretManagerCreateTimes[project]; !ok {
+		cl.SecretManagerCreateTimes[project] = make(map[string]time.Time)
+	}
+	cl.SecretManagerCreateTimes[project][id] = createTime
+}
 func (cl *MockClient) DeleteSecretManagerSecret(project, id string) error {
 	delete(cl.SecretManagerSecret[project], id)
+	delete(cl.SecretManagerVersions[project], id)
+	delete(cl.SecretManagerLabels[project], id)
 	return nil
 }
 func (cl *MockClient) CleanupKubernetesNamespace(namespace string) error {
 	delete(cl.K8sSecret, namespace)
+	delete(cl.K8sSecretLabels, namespace)
+	delete(cl.K8sSecretAnnotations, namespace)
+	delete(cl.K8sSecretTypes, namespace)
+	delete(cl.K8sConfigMaps, namespace)
 	return nil
 }
 func (cl *MockClient) CleanupKubernetesSecrets(namespace string) error {
 	cl.K8sSecret[namespace] = make(map[string]map[string][]byte)
+	delete(cl.K8sSecretLabels, namespace)
+	delete(cl.K8sSecretAnnotations, namespace)
+	delete(cl.K8sSecretTypes, namespace)
 	return nil
 }
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/client"
+)
+
+// MockGSMClient serves the Secret Manager calls from the mocked GSM, and all other calls from the embedded Interface,
+// so that the controller can run against a fake Secret Manager and a real cluster, e.g. a kind cluster.
+// Only for local development.
+type MockGSMClient struct {
+	client.Interface
+	GSM *MockClient
+}
+
+func (cl *MockGSMClient) GetSecretManagerSecretValue(project, id string) ([]byte, error) {
+	return cl.GSM.GetSecretManagerSecretValue(project, id)
+}
+func (cl *MockGSMClient) GetSecretManagerSecretVersion(project, id string) ([]byte, string, error) {
+	return cl.GSM.GetSecretManagerSecretVersion(project, id)
+}
+func (cl *MockGSMClient) GetSecretManagerSecretLabels(project, id string) (map[string]string, error) {
+	return cl.GSM.GetSecretManagerSecretLabels(project, id)
+}
+func (cl *MockGSMClient) UpsertSecretManagerSecret(project, id string, data []byte) error {
+	return cl.GSM.UpsertSecretManagerSecret(project, id, data)
+}
+func (cl *MockGSMClient) UpsertReplicatedSecretManagerSecret(project, id string, locations []string, data []byte) error {
+	return cl.GSM.UpsertReplicatedSecretManagerSecret(project, id, locations, data)
+}
+
+// LoadMockGSM returns a MockClient seeded with the Secret Manager secrets in the yaml file,
+// which maps each project to its secret ids and their values, e.g.
+//
+//	project-1:
+//	  gsm-token: token-value
+func LoadMockGSM(file string) (*MockClient, error) {
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", file, err)
+	}
+
+	seed := map[string]map[string]string{}
+	err = yaml.Unmarshal(yamlFile, &seed)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling %s: %s", file, err)
+	}
+
+	projects := []string{}
+	for project := range seed {
+		projects = append(projects, project)
+	}
+	mock := NewMockClient(projects)
+	for project, secrets := range seed {
+		for id, value := range secrets {
+			err = mock.UpsertSecretManagerSecret(project, id, []byte(value))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return mock, nil
+}
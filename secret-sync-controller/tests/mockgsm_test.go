@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/config"
+	"sigs.k8s.io/k8s-gsm-tools/secret-sync-controller/controller"
+	"testing"
+)
+
+func TestMockGSMClient(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		seed        string
+		expectErr   bool
+		expectValue string
+	}{
+		{
+			name:        "Seeded source. Should sync it into the cluster.",
+			seed:        "project-1:\n  gsm-token: token-from-seed\n",
+			expectErr:   false,
+			expectValue: "token-from-seed",
+		},
+		{
+			name:        "Missing source. Should not sync.",
+			seed:        "project-1:\n  other-token: other-value\n",
+			expectErr:   false,
+			expectValue: "",
+		},
+		{
+			name:      "Malformed seed. Should fail to load.",
+			seed:      "project-1: [gsm-token]\n",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		testname := tc.name
+		t.Run(testname, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "mockgsm")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			seedPath := filepath.Join(dir, "seed.yaml")
+			err = ioutil.WriteFile(seedPath, []byte(tc.seed), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gsm, err := LoadMockGSM(seedPath)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error but got nil.")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the cluster has no Secret Manager secrets, so that synced values can only come from the fake
+			cluster := NewMockClient(nil)
+			err = cluster.CreateKubernetesNamespace("ns-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &controller.SecretSyncController{
+				Client: &MockGSMClient{
+					Interface: cluster,
+					GSM:       gsm,
+				},
+				Agent: &config.Agent{},
+			}
+			c.Agent.Set(&config.SecretSyncConfig{
+				Specs: []config.SecretSyncSpec{
+					{
+						Source: config.SecretManagerSpec{
+							Project: "project-1",
+							Secret:  "gsm-token",
+						},
+						Destination: config.KubernetesSpec{
+							Namespace: "ns-a",
+							Secret:    "secret-a",
+							Key:       "key-a",
+						},
+					},
+				},
+			})
+
+			c.SyncAll()
+
+			value, err := cluster.GetKubernetesSecretValue("ns-a", "secret-a", "key-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != tc.expectValue {
+				t.Errorf("Expected value %q, but got %q.", tc.expectValue, value)
+			}
+		})
+	}
+}